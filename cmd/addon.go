@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var addonParams map[string]string
+var addonChecksums map[string]string
+
+var addonCmd = &cobra.Command{
+	Use:   "addon",
+	Short: "install, upgrade or remove addons of running clusters",
+}
+
+var addonInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "install an addon in a running cluster",
+	Long: `install an addon in a running cluster, see 'qks get addons' for available ones, for example:
+  qks addon install my-k8s-cluster cert-manager
+  qks addon install my-k8s-cluster monitoring=9.4.10 --param grafanaPassword=xxx`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAddonAction(args, app.App.RunAddonInstall)
+	},
+}
+
+var addonUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "install another version of an addon in a running cluster",
+	Long: `install another version of an addon, params are not saved and must be given again, for example:
+  qks addon upgrade my-k8s-cluster cert-manager=v1.0.4`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAddonAction(args, app.App.RunAddonUpgrade)
+	},
+}
+
+var addonRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "delete what an addon applied to a running cluster",
+	Long: `delete what an addon applied to a running cluster, for example:
+  qks addon remove my-k8s-cluster monitoring`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAddonAction(args, app.App.RunAddonRemove)
+	},
+}
+
+func runAddonAction(args []string, run func(app.App, *api.AddonActionOption) error) {
+	o, err := addon.ParseOption(args[1])
+	if err != nil {
+		klog.Errorln(err)
+		os.Exit(api.ExitCode(err))
+	}
+	o.Params = addonParams
+	opt := &api.AddonActionOption{ClusterName: args[0], Zone: zone, Addon: o, Checksums: addonChecksums}
+	if err = run(newApp(), opt); err != nil {
+		klog.Errorln(err)
+		os.Exit(api.ExitCode(err))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(addonCmd)
+	addonCmd.AddCommand(addonInstallCmd, addonUpgradeCmd, addonRemoveCmd)
+	for _, c := range []*cobra.Command{addonInstallCmd, addonUpgradeCmd} {
+		c.Flags().StringToStringVar(&addonParams, "param", nil, "param of the addon like 'key=value', can be repeated")
+		c.Flags().StringToStringVar(&addonChecksums, "checksum", nil, "sha256 of a manifest the addon downloads like 'url=sha256', it is refused unless it matches, can be repeated")
+	}
+}
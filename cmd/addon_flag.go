@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// addonsValue is the --addon flag, an addon given again replaces the earlier one, e.g. of a template
+type addonsValue struct {
+	addons *[]api.AddonOption
+}
+
+func (v *addonsValue) String() string {
+	values := make([]string, 0, len(*v.addons))
+	for _, a := range *v.addons {
+		s := a.Name
+		if a.Version != "" {
+			s += "=" + a.Version
+		}
+		values = append(values, s)
+	}
+	return strings.Join(values, ",")
+}
+
+func (v *addonsValue) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		opt, err := addon.ParseOption(item)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for i := range *v.addons {
+			if (*v.addons)[i].Name == opt.Name {
+				(*v.addons)[i].Version = opt.Version
+				replaced = true
+			}
+		}
+		if !replaced {
+			*v.addons = append(*v.addons, opt)
+		}
+	}
+	return nil
+}
+
+func (v *addonsValue) Type() string {
+	return "addons"
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var captureImageOpt = new(api.CaptureImageOption)
+
+var captureImageCmd = &cobra.Command{
+	Use:   "capture",
+	Short: "capture a customized node of a cluster as a node image variant",
+	Long: `capture a node customized by hand as a node image variant of the kubernetes version of its cluster. The node is drained, reset and stopped
+while it is captured, then it joins again. Nodes added to the cluster later are created from the variant, other clusters take it by --node-image-variant,
+for example:
+  qks create image capture my-k8s-cluster --node i-xxxxxxxx --variant gpu
+A snapshot of a prepared machine which never joined a cluster is captured as it is, so nodes boot without pulling images:
+  qks create image capture my-k8s-cluster --snapshot ss-xxxxxxxx --variant warm`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		captureImageOpt.ClusterName = args[0]
+		captureImageOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunCaptureImage(captureImageOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	createImageCmd.AddCommand(captureImageCmd)
+	captureImageCmd.Flags().StringVar(&captureImageOpt.InstanceID, "node", "", "instance id of the linux node to capture")
+	captureImageCmd.Flags().StringVar(&captureImageOpt.SnapshotID, "snapshot", "", "id of an instance snapshot to capture instead of a node")
+	captureImageCmd.Flags().StringVar(&captureImageOpt.Variant, "variant", "", "name of the node image variant, an existing one is replaced")
+	captureImageCmd.Flags().StringVar(&captureImageOpt.ImageName, "image-name", "", "name of the image, default is qks-<version>-<variant>")
+	captureImageCmd.Flags().StringVar(&captureImageOpt.BootstrapLogDir, "bootstrap-log-dir", "", "folder keeping outputs of the join, default is ~/.qks/logs/<cluster>")
+}
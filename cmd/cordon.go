@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var cordonOpt = new(api.CordonOption)
+
+var cordonCmd = &cobra.Command{
+	Use:   "cordon",
+	Short: "mark all nodes of a pool unschedulable",
+	Long: `mark all nodes of a pool unschedulable before maintenance of the cloud, like migrating volumes, for example:
+  qks cordon my-k8s-cluster --pool node --drain
+  qks uncordon my-k8s-cluster --pool node`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cordonOpt.ClusterName = args[0]
+		cordonOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunCordon(cordonOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+var uncordonOpt = new(api.CordonOption)
+
+var uncordonCmd = &cobra.Command{
+	Use:   "uncordon",
+	Short: "mark all nodes of a pool schedulable again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uncordonOpt.ClusterName = args[0]
+		uncordonOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunUncordon(uncordonOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cordonCmd)
+	rootCmd.AddCommand(uncordonCmd)
+	cordonCmd.Flags().StringVar(&cordonOpt.Pool, "pool", "node", "the pool of nodes, one of master, node and winnode")
+	cordonCmd.Flags().BoolVar(&cordonOpt.Drain, "drain", false, "evict pods from the nodes as well, pods of daemonsets are left running")
+	uncordonCmd.Flags().StringVar(&uncordonOpt.Pool, "pool", "node", "the pool of nodes, one of master, node and winnode")
+}
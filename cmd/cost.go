@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var costOpt = new(api.CostOption)
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "show the cost of a cluster",
+	Long: `show accumulated and projected monthly cost of all resources of a cluster, every report is recorded to follow the cost over time, for example:
+  qks cost my-k8s-cluster`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		costOpt.ClusterName = args[0]
+		costOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunCost(costOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(costCmd)
+	costCmd.Flags().StringVar(&costOpt.HistoryPath, "history", "", "the file reports are appended to, default is $HOME/.qks/cost/<cluster>.jsonl")
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+var createBatchYaml string
+var createBatchCount int
+var createBatchConcurrency int
+var createBatchAPIRate float64
+
+var createBatchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "create clusters of a template in parallel",
+	Long: `create clusters of a template in parallel, like labs of a class, and report them together. The yaml has the template,
+which is a cluster as in 'qks create cluster -Y', and either count or names of clusters, for example:
+  template:
+    clusterName: lab
+    kubernetesVersion: 1.15.5
+    nodeCount: 2
+  count: 20
+
+  qks create batch -Y lab.yaml --concurrency 5`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if createBatchYaml == "" {
+			klog.Errorln("yaml of the batch is required by -Y")
+			os.Exit(api.ExitCodeValidation)
+		}
+		bytes, err := ioutil.ReadFile(createBatchYaml)
+		if err != nil {
+			klog.Errorf("Failed to read yaml,err: %s", err.Error())
+			os.Exit(api.ExitCodeValidation)
+		}
+		spec := new(api.BatchSpec)
+		// the template starts from defaults of 'qks create cluster'
+		addCreateClusterFlags(pflag.NewFlagSet("batch", pflag.ContinueOnError), &spec.Template)
+		spec.Template.Zone = zone
+		spec.Template.VxNet = vxnet
+		spec.Template.UseExistKey = useExistKey
+		err = yaml.UnmarshalStrict(bytes, spec)
+		if err != nil {
+			klog.Errorf("Failed to parse yaml,err: %s", err.Error())
+			os.Exit(api.ExitCodeValidation)
+		}
+		if cmd.Flags().Changed("count") {
+			spec.Count = createBatchCount
+			spec.Names = nil
+		}
+		if cmd.Flags().Changed("concurrency") {
+			spec.Concurrency = createBatchConcurrency
+		}
+		clusters, err := spec.Clusters()
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+		opts := make([]app.Option, 0)
+		if createBatchAPIRate > 0 {
+			opts = append(opts, app.WithAPIRateLimit(createBatchAPIRate))
+		}
+		toRun := newApp(opts...)
+		err = toRun.RunCreateBatch(clusters, spec.Concurrency)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	createCmd.AddCommand(createBatchCmd)
+	createBatchCmd.Flags().StringVarP(&createBatchYaml, "yaml", "Y", "", "yaml of the batch")
+	createBatchCmd.Flags().IntVar(&createBatchCount, "count", 0, "create this many clusters named <clusterName>-01 and so on, overrides count and names of the yaml")
+	createBatchCmd.Flags().IntVar(&createBatchConcurrency, "concurrency", app.DefaultBatchConcurrency, "how many clusters are created at once")
+	createBatchCmd.Flags().Float64Var(&createBatchAPIRate, "api-rate", app.DefaultBatchAPIRate, "requests per second to qingcloud shared by all clusters of the batch")
+}
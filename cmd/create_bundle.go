@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var createBundleOpt = new(api.CreateBundleOption)
+
+var createBundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "pack images, packages and CNI manifests of a kubernetes version into one file",
+	Long: `pack images, packages and CNI manifests of a kubernetes version into one file on a temporary machine, for air-gapped sites, for example:
+  qks create bundle 1.30.5 -x=vxnet-xxx -o qks-bundle-1.30.5.tar.gz`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		createBundleOpt.KubernetesVersion = args[0]
+		createBundleOpt.Zone = zone
+		createBundleOpt.VxNet = vxnet
+		createBundleOpt.UseExistKey = useExistKey
+		toRun := newApp()
+		err := toRun.RunCreateBundle(createBundleOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	createCmd.AddCommand(createBundleCmd)
+	createBundleCmd.Flags().StringVarP(&createBundleOpt.Output, "output", "o", "", "local path of the bundle, default is qks-bundle-<version>-<arch>.tar.gz in the current folder")
+	createBundleCmd.Flags().StringVar(&createBundleOpt.Arch, "arch", api.ArchAMD64, "arch of the images the bundle is built from, amd64 or arm64")
+	createBundleCmd.Flags().BoolVar(&createBundleOpt.KeepMachine, "keep-machine", false, "keep the builder machine to look into a failure")
+	createBundleCmd.Flags().StringVar(&createBundleOpt.BootstrapLogDir, "log-dir", "", "save output of the bundle script in this folder, default is $HOME/.qks/logs/bundle-<version>")
+}
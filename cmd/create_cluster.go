@@ -4,27 +4,119 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/magicsong/yunify-k8s/pkg/addon"
 	"github.com/magicsong/yunify-k8s/pkg/api"
-	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/magicsong/yunify-k8s/pkg/catalog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v2"
 	"k8s.io/klog"
 )
 
 var createClusterOpt *api.CreateClusterOption
 var createClusterYaml string
+var createClusterTemplate string
 
 func init() {
 	createCmd.AddCommand(createClusterCmd)
 	createClusterOpt = new(api.CreateClusterOption)
-	createClusterCmd.Flags().StringVarP(&createClusterOpt.KubernetesVersion, "k8s-version", "k", "1.13.1", "specify k8s version of cluster")
-	createClusterCmd.Flags().StringVarP(&createClusterOpt.PodNetWorkCIDR, "pod-cidr", "p", "10.233.0.0/16", "specify PodNetWorkCIDR")
-	createClusterCmd.Flags().IntVarP(&createClusterOpt.NodeCount, "node-count", "c", 2, "specify the number of nodes")
-	createClusterCmd.Flags().StringVar(&createClusterOpt.CNIName, "cni", "calico", "cni plugin to use")
-	createClusterCmd.Flags().IntVar(&createClusterOpt.InstanceClass, "class", 101, "instance class of machine,available values: 0, 1, 2, 3, 4, 5, 6, 100, 101, 200, 201, 300, 301")
-	createClusterCmd.Flags().BoolVarP(&createClusterOpt.ScpKubeConfigToLocal, "scp-kubeconfig", "s", false, "specify whether copy kubeconfig to local")
-	createClusterCmd.Flags().StringVar(&createClusterOpt.LocalKubeConfigPath, "kubeconfig-path", ".", "specify the path where kubeconfig copy to")
+	addCreateClusterFlags(createClusterCmd.Flags(), createClusterOpt)
 	createClusterCmd.Flags().StringVarP(&createClusterYaml, "yaml", "Y", "", "Use yaml instead of Command line")
+	createClusterCmd.Flags().StringVar(&createClusterTemplate, "template", "", "create the cluster from a template like 'dev-small' or 'prod-ha', flags given explicitly override it, see 'qks get templates'")
+}
+
+// addCreateClusterFlags binds flags to fields of opt, their defaults are set to opt at once
+func addCreateClusterFlags(fs *pflag.FlagSet, opt *api.CreateClusterOption) {
+	fs.StringVarP(&opt.KubernetesVersion, "k8s-version", "k", "1.13.1", "specify k8s version of cluster, a minor like '1.15' or 'latest' takes the newest preset with images in the zone")
+	fs.StringVarP(&opt.PodNetWorkCIDR, "pod-cidr", "p", "10.233.0.0/16", "specify PodNetWorkCIDR")
+	fs.IntVarP(&opt.NodeCount, "node-count", "c", 2, "specify the number of nodes")
+	fs.StringVar(&opt.CNIName, "cni", "calico", "cni plugin to use")
+	fs.BoolVar(&opt.SkipNetworkCheck, "skip-network-check", false, "do not check pods on different nodes reach each other, services and DNS after nodes join")
+	fs.StringVar(&opt.CNIVersion, "cni-version", "", "pin a release of the cni like v3.29.1, releases not bundled in images are downloaded by master, default is the one in images")
+	fs.IntVar(&opt.InstanceClass, "class", 101, "instance class of machine,available values: 0, 1, 2, 3, 4, 5, 6, 100, 101, 200, 201, 300, 301")
+	fs.StringVar(&opt.MasterInstanceType, "master-type", "", "instance type of master, a family like 'standard', 'enterprise-memory' or a qingcloud instance type like 'c4m8', overrides --class")
+	fs.StringVar(&opt.NodeInstanceType, "node-type", "", "instance type of nodes, same values as --master-type")
+	fs.IntVar(&opt.WindowsNodeCount, "windows-nodes", 0, "experimental, count of windows nodes joined after linux nodes, requires --cni flannel and a windowsNodeImageID in ~/.qks/images.yaml")
+	fs.StringVar(&opt.WindowsNodeInstanceType, "windows-node-type", "", "instance type of windows nodes, same values as --master-type")
+	fs.StringArrayVar(&opt.FallbackInstanceTypes, "fallback-instance-type", nil, "instance type tried for master and nodes if the zone has no capacity of theirs, same values as --master-type, can be repeated in order of preference")
+	fs.StringArrayVar(&opt.FallbackZones, "fallback-zone", nil, "zone tried if the zone offers none of the instance types, before anything is created, --vxnet must be usable there, can be repeated")
+	fs.StringVar(&opt.Arch, "arch", api.ArchAMD64, "arch of machines, amd64 or arm64, arm64 requires arm instance types by --master-type and --node-type")
+	fs.StringVar(&opt.NodeImageVariant, "node-image-variant", "", "create linux nodes from the node image variant captured by 'qks create image capture', nodes added by scaling take it too")
+	fs.StringVar(&opt.NodeSnapshot, "node-snapshot", "", "create linux nodes from an instance snapshot of a prepared node which never joined, captured once as the node image variant named by its id")
+	fs.BoolVarP(&opt.ScpKubeConfigToLocal, "scp-kubeconfig", "s", false, "specify whether copy kubeconfig to local")
+	fs.StringVar(&opt.LocalKubeConfigPath, "kubeconfig-path", "", "specify the file (or an existing folder) where kubeconfig copy to, default is $HOME/.kube/yunify-<cluster>.conf")
+	fs.BoolVar(&opt.OverwriteKubeConfig, "force", false, "overwrite the local kubeconfig if it already exists")
+	fs.BoolVar(&opt.ConfirmDeleteByName, "confirm-delete-by-name", false, "require typing the cluster name to delete it, for production clusters")
+	fs.StringVar(&opt.DriftPolicy, "drift-policy", "", "what 'qks watch --spec' does to drifts of the cluster from its spec, correct the count of nodes or flag them, default is flag")
+	fs.StringVar(&opt.UserData, "user-data", "", "script run as root once on every linux machine before kubeadm, e.g. to install agents the site requires, its output is in the bootstrap logs")
+	fs.StringVar(&opt.BootWait, "boot-wait", "", "how linux machines tell they are booted before kubeadm: 'ssh' once ssh connects, 'cloud-init' once cloud-init is done, or 'file:<path>' once the sentinel file exists")
+	fs.DurationVar(&opt.BootWaitTimeout, "boot-wait-timeout", 0, "how long machines may take to be booted by --boot-wait, default is 10m")
+	fs.BoolVar(&opt.Adopt, "adopt", false, "create the cluster into the existing tag of the same name, e.g. left by a failed create, instead of refusing the name")
+	fs.BoolVar(&opt.Protect, "protect", false, "protect the cluster from deletion until 'qks protect cluster <name> --unprotect' is run")
+	fs.StringVar(&opt.BootstrapLogDir, "bootstrap-log-dir", "", "save output of bootstrap scripts of every machine in this folder, default is $HOME/.qks/logs/<cluster>")
+	fs.IntVar(&opt.JoinRetries, "join-retries", 2, "how many times to retry joining a node before giving up on it")
+	fs.IntVar(&opt.InitRetries, "init-retries", 2, "how many times to reset master and retry 'kubeadm init' before giving up on the cluster")
+	fs.DurationVar(&opt.Timeout, "timeout", 0, "stop the create once it runs longer than this, like '30m', it is checked between phases only and does not cancel the running phase, whose waits like --boot-wait-timeout have their own limits, 0 means no limit")
+	fs.BoolVar(&opt.DeleteOnTimeout, "delete-on-timeout", false, "delete what this create created once --timeout is exceeded, resources of an adopted tag are kept")
+	fs.StringVar(&opt.TokenTTL, "token-ttl", "", "ttl of the bootstrap token, e.g. '1h', the token is deleted after nodes join anyway")
+	fs.StringArrayVar(&opt.KubeadmInitExtraFlags, "kubeadm-init-flag", nil, "extra flag appended to 'kubeadm init' as is, can be repeated")
+	fs.StringArrayVar(&opt.KubeadmJoinExtraFlags, "kubeadm-join-flag", nil, "extra flag appended to 'kubeadm join' as is, can be repeated")
+	fs.StringVar(&opt.ControlPlanePatchesDir, "patches", "", "folder of patches to control plane static pods, named like 'kube-apiserver+strategic.yaml', needs k8s 1.19+")
+	fs.IntVar(&opt.EtcdVolumeSize, "etcd-volume-size", 0, "size in GB of a dedicated ssd volume mounted at /var/lib/etcd of master, 0 keeps etcd on the root disk")
+	fs.IntVar(&opt.EtcdVolumeType, "etcd-volume-type", 0, "qingcloud volume type of the etcd volume, default is a ssd type usable by --class")
+	fs.Int64Var(&opt.Etcd.QuotaBackendBytes, "etcd-quota-backend-bytes", 0, "size limit of the etcd database in bytes, at most 8GB, 0 keeps the default 2GB")
+	fs.IntVar(&opt.Etcd.HeartbeatInterval, "etcd-heartbeat-interval", 0, "heartbeat interval of etcd in milliseconds, 0 keeps the default 100")
+	fs.IntVar(&opt.Etcd.ElectionTimeout, "etcd-election-timeout", 0, "election timeout of etcd in milliseconds, at least 5 heartbeats, 0 keeps the default 1000")
+	fs.IntVar(&opt.Etcd.SnapshotCount, "etcd-snapshot-count", 0, "committed transactions to trigger a snapshot of etcd, 0 keeps the default of etcd")
+	fs.StringVar(&opt.CACertFile, "ca-cert", "", "PEM certificate of an existing CA, or an intermediate of corporate PKI, used by kubeadm to sign cluster certificates")
+	fs.StringVar(&opt.CAKeyFile, "ca-key", "", "unencrypted PEM key of --ca-cert, it is only uploaded to master")
+	fs.StringVar(&opt.ResourcesManifest, "resources-manifest", "", "write created cloud resources to this file for inventory tools, terraform import blocks if it ends with .tf, json otherwise")
+	fs.StringVar(&opt.EndpointsFile, "endpoints-file", "", "write master, node ips, ssh user and key and kubeconfig of the cluster to this file for downstream automation")
+	fs.StringVar(&opt.EndpointsFormat, "endpoints-format", "", "format of --endpoints-file, env, terraform-output or ansible, told by extension if empty: .json for terraform-output, .ini for ansible, env otherwise")
+	fs.StringVar(&opt.SecurityGroup, "security-group", "", "id of an existing security group attached to all instances instead of the default one of the zone, for centrally managed firewalls")
+	fs.StringVar(&opt.ResourceGroup, "resource-group", "", "id of the resource group all created resources are put into, for rbac and billing boundaries")
+	fs.StringArrayVar(&opt.PrePullImages, "pre-pull-image", nil, "image pulled on every node after it joins, so the first rollout is not throttled by the registry, can be repeated")
+	fs.Var(&addonsValue{addons: &opt.Addons}, "addon", "addon installed once nodes join, 'name' or 'name=version', can be repeated, see 'qks get addons'")
+	fs.BoolVar(&opt.ExposeIngress, "expose-ingress", false, "install ingress-nginx and bind a new eip to a node as the public entry of http traffic")
+	fs.IntVar(&opt.IngressBandwidth, "ingress-bandwidth", api.DefaultIngressBandwidth, "bandwidth of the ingress eip in Mbps")
+	fs.StringVar(&opt.KubeSphere, "with-kubesphere", "", "install KubeSphere of this version by ks-installer after addons, '--with-kubesphere' alone installs the default one")
+	fs.Lookup("with-kubesphere").NoOptDefVal = addon.KubeSphereDefaultVersion
+	fs.StringVar(&opt.ControlPlaneEndpoint, "control-plane-endpoint", "", "dns name[:port] of apiserver used in kubeconfig and cert SANs, so the cluster can move to HA behind it, needs k8s 1.16+")
+	fs.BoolVar(&opt.ControlPlaneEndpointResolvable, "control-plane-endpoint-resolvable", false, "machines resolve --control-plane-endpoint by themselves, like a dns record of an internal load balancer, so nodes join through it instead of pinning it to master")
+	fs.StringSliceVar(&opt.APIServerCertSANs, "apiserver-cert-sans", nil, "extra ips and dns names in the apiserver certificate, like vpn addresses, internal dns names or ips of load balancers, comma separated")
+}
+
+// applyTemplate returns options of the template overridden by flags explicitly given
+func applyTemplate(cmd *cobra.Command, name string) (*api.CreateClusterOption, error) {
+	t, err := catalog.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	opt := new(api.CreateClusterOption)
+	fs := pflag.NewFlagSet("template", pflag.ContinueOnError)
+	addCreateClusterFlags(fs, opt)
+	if err = t.Apply(opt); err != nil {
+		return nil, err
+	}
+	// replay flags given on the command line onto the template
+	args := make([]string, 0)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			return
+		}
+		if f.Value.Type() == "stringArray" {
+			values, _ := cmd.Flags().GetStringArray(f.Name)
+			for _, v := range values {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	if err = fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return opt, nil
 }
 
 var createClusterCmd = &cobra.Command{
@@ -38,24 +130,32 @@ var createClusterCmd = &cobra.Command{
 			bytes, err := ioutil.ReadFile(createClusterYaml)
 			if err != nil {
 				klog.Errorf("Failed to read yaml,err: %s", err.Error())
-				os.Exit(1)
+				os.Exit(api.ExitCodeValidation)
 			}
 			err = yaml.UnmarshalStrict(bytes, createClusterOpt)
 			if err != nil {
 				klog.Errorf("Failed to parse yaml,err: %s", err.Error())
-				os.Exit(1)
+				os.Exit(api.ExitCodeValidation)
 			}
 		} else {
+			if createClusterTemplate != "" {
+				opt, err := applyTemplate(cmd, createClusterTemplate)
+				if err != nil {
+					klog.Errorln(err)
+					os.Exit(api.ExitCode(err))
+				}
+				createClusterOpt = opt
+			}
 			createClusterOpt.ClusterName = args[0]
 			createClusterOpt.Zone = zone
 			createClusterOpt.VxNet = vxnet
 			createClusterOpt.UseExistKey = useExistKey
 		}
-		toRun := app.NewApp(cfgFile)
+		toRun := newApp()
 		err := toRun.RunCreate(createClusterOpt)
 		if err != nil {
 			klog.Errorln(err)
-			os.Exit(1)
+			os.Exit(api.ExitCode(err))
 		}
 	},
 }
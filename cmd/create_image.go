@@ -5,7 +5,6 @@ import (
 	"os"
 
 	"github.com/magicsong/yunify-k8s/pkg/api"
-	"github.com/magicsong/yunify-k8s/pkg/app"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 	"k8s.io/klog"
@@ -19,6 +18,7 @@ func init() {
 	createImageOpt = new(api.CreateImageOption)
 	createImageCmd.Flags().StringVarP(&createImageYaml, "yaml", "Y", "", "Use yaml instead of Command line")
 	createImageCmd.Flags().StringVarP(&createImageOpt.InstanceInfo.BaseImage, "base-image", "i", "xenial5x64a", "specify the base image to work on")
+	createImageCmd.Flags().StringVar(&createImageOpt.InstanceInfo.InstanceType, "instance-type", "", "qingcloud instance type of the builder machine like 'c4m8', an arm one is required by arm64 base images")
 	createImageCmd.Flags().BoolVarP(&createImageOpt.DeleteMachine, "delete-machine", "D", false, "specify whether deleting  machine or not in the end")
 	createImageCmd.Flags().StringArrayVarP(&createImageOpt.Manifest.Folders, "scripts-folder", "F", nil, "folders will be upload to image")
 	createImageCmd.Flags().StringArrayVarP(&createImageOpt.Manifest.Scripts, "script-file", "f", nil, "files to be uploaded")
@@ -35,28 +35,28 @@ var createImageCmd = &cobra.Command{
 			bytes, err := ioutil.ReadFile(createImageYaml)
 			if err != nil {
 				klog.Errorf("Failed to read yaml,err: %s", err.Error())
-				os.Exit(1)
+				os.Exit(api.ExitCodeValidation)
 			}
 			err = yaml.UnmarshalStrict(bytes, createImageOpt)
 			if err != nil {
 				klog.Errorf("Failed to parse yaml,err: %s", err.Error())
-				os.Exit(1)
+				os.Exit(api.ExitCodeValidation)
 			}
 		} else {
 			if len(args) != 1 {
 				klog.Error("Must specify a image name, for example 'qks create image test-image'")
-				os.Exit(1)
+				os.Exit(api.ExitCodeValidation)
 			}
 			createImageOpt.ImageName = args[0]
 			createImageOpt.InstanceInfo.Zone = zone
 			createImageOpt.InstanceInfo.VxNet = vxnet
 			createImageOpt.InstanceInfo.UseExistKey = useExistKey
 		}
-		toRun := app.NewApp(cfgFile)
+		toRun := newApp()
 		err := toRun.RunCreateImage(createImageOpt)
 		if err != nil {
 			klog.Errorln(err)
-			os.Exit(1)
+			os.Exit(api.ExitCode(err))
 		}
 	},
 }
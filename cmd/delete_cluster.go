@@ -4,7 +4,6 @@ import (
 	"os"
 
 	"github.com/magicsong/yunify-k8s/pkg/api"
-	"github.com/magicsong/yunify-k8s/pkg/app"
 	"github.com/spf13/cobra"
 	"k8s.io/klog"
 )
@@ -14,6 +13,12 @@ var deleteClusterOpt *api.DeleteClusterOption
 func init() {
 	deleteCmd.AddCommand(deleteClusterCmd)
 	deleteClusterOpt = new(api.DeleteClusterOption)
+	deleteClusterCmd.Flags().BoolVarP(&deleteClusterOpt.ForceDelete, "force", "f", false, "delete without asking for confirmation")
+	deleteClusterCmd.Flags().BoolVar(&deleteClusterOpt.KeepEIP, "keep-eip", false, "do not release eips tagged with the cluster")
+	deleteClusterCmd.Flags().BoolVar(&deleteClusterOpt.KeepVolumes, "keep-volumes", false, "do not delete volumes tagged with the cluster")
+	deleteClusterCmd.Flags().BoolVar(&deleteClusterOpt.KeepSSHKey, "keep-sshkey", false, "do not delete keypairs tagged with the cluster")
+	deleteClusterCmd.Flags().DurationVar(&deleteClusterOpt.Timeout, "timeout", 0, "stop the delete once it runs longer than this, like '10m', it is checked between phases only and does not cancel the running phase, 0 means no limit")
+	deleteClusterCmd.Flags().StringVar(&deleteClusterOpt.ConfirmName, "confirm-name", "", "the cluster name, needed to delete clusters created with --confirm-delete-by-name non-interactively")
 }
 
 var deleteClusterCmd = &cobra.Command{
@@ -26,11 +31,11 @@ var deleteClusterCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		deleteClusterOpt.ClusterName = args[0]
 		deleteClusterOpt.Zone = zone
-		toRun := app.NewApp(cfgFile)
+		toRun := newApp()
 		err := toRun.RunDelete(deleteClusterOpt)
 		if err != nil {
 			klog.Errorln(err)
-			os.Exit(1)
+			os.Exit(api.ExitCode(err))
 		}
 	},
 }
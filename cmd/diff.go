@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var diffOpt = new(api.DiffOption)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "show differences between a spec and the running cluster",
+	Long: `compare a spec with the running cluster without changing anything, exit code is 7 if they differ, for example:
+  qks export cluster my-k8s-cluster -o spec.yaml
+  qks diff -f spec.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		diffOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunDiff(diffOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVarP(&diffOpt.SpecPath, "filename", "f", "", "the spec of the cluster")
+	diffCmd.MarkFlagRequired("filename")
+}
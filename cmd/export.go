@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export specs of existing clusters",
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
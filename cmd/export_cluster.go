@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var exportClusterOpt = new(api.ExportSpecOption)
+
+var exportClusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "export the spec of a running cluster",
+	Long: `export the spec of a running cluster as yaml, which can be created again in another zone or account, for example:
+  qks export cluster my-k8s-cluster -o spec.yaml
+  qks create cluster -Y spec.yaml
+  qks export cluster my-k8s-cluster --format terraform -o imports.tf`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exportClusterOpt.ClusterName = args[0]
+		exportClusterOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunExportSpec(exportClusterOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportClusterCmd)
+	exportClusterCmd.Flags().StringVarP(&exportClusterOpt.OutputPath, "output", "o", "", "write to this file instead of printing")
+	exportClusterCmd.Flags().StringVar(&exportClusterOpt.Format, "format", "spec", "what to export, 'spec' for 'qks create cluster -Y', or 'json' and 'terraform' for a manifest of cloud resources")
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var getAddonsCmd = &cobra.Command{
+	Use:   "addons",
+	Short: "list addons usable by 'qks create cluster --addon'",
+	Long: `list addons which can be installed once the cluster is up, params are given in 'addons' of the cluster yaml, for example:
+  qks get addons
+  qks create cluster testk8s --addon pod-security`,
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tDEFAULT VERSION\tDESCRIPTION")
+		for _, name := range addon.Names() {
+			a, _ := addon.Get(name)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, a.DefaultVersion, a.Description)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getAddonsCmd)
+}
@@ -18,7 +18,7 @@ package cmd
 import (
 	"os"
 
-	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/magicsong/yunify-k8s/pkg/api"
 	"github.com/spf13/cobra"
 	"k8s.io/klog"
 )
@@ -34,11 +34,11 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		toRun := app.NewApp(cfgFile)
+		toRun := newApp()
 		err := toRun.RunList(zone)
 		if err != nil {
 			klog.Errorln(err)
-			os.Exit(1)
+			os.Exit(api.ExitCode(err))
 		}
 	},
 }
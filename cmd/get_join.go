@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var printJoinOpt = new(api.PrintJoinOption)
+
+var getJoinCmd = &cobra.Command{
+	Use:   "join-command",
+	Short: "print kubeadm join commands with a fresh token",
+	Long: `create a new token on master and print kubeadm join commands, so machines not created by qks can join the cluster, for example:
+  qks get join-command my-k8s-cluster`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		toRun := newApp()
+		printJoinOpt.ClusterName = args[0]
+		printJoinOpt.Zone = zone
+		err := toRun.RunPrintJoin(printJoinOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getJoinCmd)
+	getJoinCmd.Flags().StringVar(&printJoinOpt.TokenTTL, "token-ttl", "", "ttl of the new token, e.g. '2h'")
+	getJoinCmd.Flags().BoolVar(&printJoinOpt.CAHashOnly, "ca-hash", false, "only print the hash of cluster CA for --discovery-token-ca-cert-hash")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/catalog"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var getTemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "list cluster templates usable by 'qks create cluster --template'",
+	Long: `list builtin cluster templates and the ones in $HOME/.qks/templates, for example:
+  qks get templates`,
+	Run: func(cmd *cobra.Command, args []string) {
+		templates, err := catalog.List()
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+		w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE\tDESCRIPTION")
+		for _, t := range templates {
+			source := catalog.Dir()
+			if t.Builtin {
+				source = "builtin"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, source, t.Description)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getTemplatesCmd)
+}
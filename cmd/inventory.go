@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var inventoryOpt = new(api.InventoryOption)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "print an ansible inventory of a cluster",
+	Long: `print an ansible inventory of machines a cluster has now, grouped by pools as <cluster>_master, <cluster>_node
+and <cluster>_winnode with the ssh user and key, for example:
+  qks inventory my-k8s-cluster -o hosts.ini
+  ansible -i hosts.ini my_k8s_cluster_node -m ping
+  qks inventory my-k8s-cluster --format json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		inventoryOpt.ClusterName = args[0]
+		inventoryOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunInventory(inventoryOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.Flags().StringVarP(&inventoryOpt.OutputPath, "output", "o", "", "write to this file instead of printing")
+	inventoryCmd.Flags().StringVar(&inventoryOpt.Format, "format", "ini", "'ini' for a static inventory, or 'json' as printed by dynamic inventory scripts for --list")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var kubectlOpt = new(api.KubectlOption)
+
+var kubectlCmd = &cobra.Command{
+	Use:   "kubectl",
+	Short: "run kubectl against a cluster without handling its kubeconfig",
+	Long: `run kubectl with the kubeconfig of a cluster, it is fetched from master if there is none locally, and kubectl runs on master
+if the apiserver is not reachable from here. Give args of kubectl after '--', for example:
+  qks kubectl my-k8s-cluster -- get pods -n kube-system`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		kubectlOpt.ClusterName = args[0]
+		kubectlOpt.Args = args[1:]
+		kubectlOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunKubectl(kubectlOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(kubectlCmd)
+	kubectlCmd.Flags().BoolVar(&kubectlOpt.OnMaster, "on-master", false, "run kubectl on master over ssh even if the apiserver is reachable from here")
+}
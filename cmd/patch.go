@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var patchOpt = new(api.PatchOption)
+
+var patchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "apply updates of OS packages on workers one by one",
+	Long: `drain, patch, reboot and uncordon workers of a cluster in turn, kubernetes packages are kept at their versions, for example:
+  qks patch my-k8s-cluster --parallel 2`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		patchOpt.ClusterName = args[0]
+		patchOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunPatch(patchOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(patchCmd)
+	patchCmd.Flags().IntVar(&patchOpt.Parallelism, "parallel", 1, "how many workers are patched at a time")
+	patchCmd.Flags().StringVar(&patchOpt.BootstrapLogDir, "log-dir", "", "save output of package managers in this folder, default is $HOME/.qks/logs/<cluster>")
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var protectCmd = &cobra.Command{
+	Use:   "protect",
+	Short: "protect clusters from deletion",
+}
+
+func init() {
+	rootCmd.AddCommand(protectCmd)
+}
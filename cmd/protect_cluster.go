@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var protectClusterOpt = new(api.ProtectClusterOption)
+
+var protectClusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "protect a cluster from deletion",
+	Long: `protect a cluster from deletion, protected clusters must be unprotected before deleting, for example:
+  qks protect cluster my-k8s-cluster
+  qks protect cluster my-k8s-cluster --unprotect`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		protectClusterOpt.ClusterName = args[0]
+		protectClusterOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunProtect(protectClusterOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	protectCmd.AddCommand(protectClusterCmd)
+	protectClusterCmd.Flags().BoolVar(&protectClusterOpt.Unprotect, "unprotect", false, "remove the protection")
+}
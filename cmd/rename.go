@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "rename clusters",
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+}
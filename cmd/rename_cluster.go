@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var renameClusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "rename a cluster without recreating it",
+	Long: `rename a cluster without recreating it, for example:
+  qks rename cluster old-name new-name`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		toRun := newApp()
+		err := toRun.RunRename(&api.RenameClusterOption{
+			ClusterName: args[0],
+			NewName:     args[1],
+			Zone:        zone,
+		})
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	renameCmd.AddCommand(renameClusterCmd)
+}
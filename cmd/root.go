@@ -19,13 +19,42 @@ import (
 	goflag "flag"
 	"fmt"
 	"os"
+	"strings"
 
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/cassette"
+	"github.com/magicsong/yunify-k8s/pkg/hook"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/trace"
 	"github.com/spf13/cobra"
 	"k8s.io/klog"
 )
 
 var cfgFile string
+var endpoint string
+var insecureSkipTLSVerify bool
 var zone string
+var metricsAddr string
+var otlpEndpoint string
+var pushgateway string
+var pushgatewayJob string
+var pushgatewayLabels []string
+var webhooks []string
+var hookSpecs []string
+var hooks []hook.Hook
+var auditLog string
+var logFormat, logFile, logLevel string
+var debugAPI string
+var recordAPI, replayAPI string
+var quiet, verbose bool
+var showSecrets bool
+var tagPrefix, owner string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -33,6 +62,77 @@ var rootCmd = &cobra.Command{
 	Short: "qks is a CLI to rapidly create/detele a kubernetes in qingcloud",
 	Long: `qks is a CLI to rapidly create/detele a kubernetes in qingcloud. for example:
   qks create my-k8s-cluster --vxnet=vxxxxx`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if quiet {
+			output.CurrentMode = output.Quiet
+			if logLevel == "" {
+				logLevel = "error"
+			}
+		} else if verbose {
+			output.CurrentMode = output.Verbose
+			goflag.Set("v", "2")
+		}
+		log.ShowSecrets(showSecrets)
+		if err := log.Setup(logFormat, logFile, logLevel); err != nil {
+			fmt.Println(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := log.ConfigureAPIDebug(debugAPI); err != nil {
+			fmt.Println(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := cassette.ConfigureRecord(recordAPI); err != nil {
+			fmt.Println(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := cassette.ConfigureReplay(replayAPI); err != nil {
+			fmt.Println(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if metricsAddr != "" {
+			metrics.Serve(metricsAddr)
+		}
+		if err := metrics.ConfigurePush(pushgateway, pushgatewayJob, pushgatewayLabels...); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		trace.Configure(otlpEndpoint)
+		if err := api.ValidateOwner(owner); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := api.ValidateTagPrefix(tagPrefix); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := notify.Register(webhooks...); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		execHooks, err := hook.ParseExecs(hookSpecs...)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		hooks = execHooks
+		if err := api.LoadZoneImages(api.ZoneImagesFile()); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+		if err := audit.Configure(auditLog); err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCodeValidation)
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		trace.Flush()
+	},
+}
+
+// newApp returns the app configured by global flags
+func newApp(opts ...app.Option) app.App {
+	opts = append([]app.Option{app.WithTagPrefix(tagPrefix), app.WithOwner(owner), app.WithEndpoint(endpoint, insecureSkipTLSVerify), app.WithHooks(hooks...)}, opts...)
+	return app.NewApp(cfgFile, opts...)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -40,7 +140,7 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(api.ExitCodeValidation)
 	}
 }
 
@@ -50,7 +150,28 @@ func init() {
 	goflag.Set("alsologtostderr", "false")
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.qingcloud/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&endpoint, "endpoint", os.Getenv(accesskey.EnvEndpoint), "qingcloud api endpoint of a private cloud, e.g. 'https://api.example.com:443/iaas', overrides host/port/protocol/uri of the config file")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "skip verifying the api endpoint certificate, for self-signed appliance certs")
 	rootCmd.PersistentFlags().StringVarP(&zone, "zone", "z", "ap2a", "specify zone to delete cluster")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "expose prometheus metrics on this address while running, e.g. ':9090'")
+	rootCmd.PersistentFlags().StringVar(&pushgateway, "pushgateway", os.Getenv(metrics.EnvPushgateway), "push duration and result of creations and deletions to this prometheus pushgateway once they finish, e.g. 'http://pushgateway:9091'")
+	rootCmd.PersistentFlags().StringVar(&pushgatewayJob, "pushgateway-job", metrics.DefaultPushJob, "job label of metrics pushed to --pushgateway")
+	rootCmd.PersistentFlags().StringArrayVar(&pushgatewayLabels, "pushgateway-label", nil, "group metrics pushed to --pushgateway by this label in form of 'name=value', e.g. 'instance=ci-runner-1', can be repeated")
+	rootCmd.PersistentFlags().StringVar(&otlpEndpoint, "otlp-endpoint", os.Getenv(trace.EnvOTLPEndpoint), "export traces to this OTLP/HTTP endpoint, e.g. 'http://localhost:4318'")
+	rootCmd.PersistentFlags().StringArrayVar(&webhooks, "webhook", nil, "notify when an operation finishes, in form of '[http|slack|dingtalk=]url', can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&hookSpecs, "hook", nil, "run a command with the cluster as JSON on stdin at lifecycle points, in form of 'point[,point]=command', points: "+strings.Join(hook.Points, ", ")+", can be repeated")
+	rootCmd.PersistentFlags().StringVar(&auditLog, "audit-log", "", "append an audit record of every operation to a local file or 'qingstor://bucket/prefix?zone=pek3b'")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", log.FormatText, "log format, available values: text, json")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "write logs to this file instead of stderr")
+	rootCmd.PersistentFlags().StringVar(&debugAPI, "debug-api", "", "append every qingcloud api request and response to this file, access keys and secrets are redacted")
+	rootCmd.PersistentFlags().StringVar(&recordAPI, "record-api", "", "record every qingcloud api request and response in this file with secrets redacted, for --replay-api")
+	rootCmd.PersistentFlags().StringVar(&replayAPI, "replay-api", "", "answer qingcloud api requests by the file recorded by --record-api instead of calling qingcloud, no access key is needed")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "drop logs below this level, available values: info, warning, error")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only print the final result or errors")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "also print output of commands run on machines")
+	rootCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "do not redact tokens, CA hashes and keys in logs and saved bootstrap output")
+	rootCmd.PersistentFlags().StringVar(&tagPrefix, "tag-prefix", api.ClusterTagPrefix, "prefix of tags marking clusters, teams sharing one account can use different prefixes")
+	rootCmd.PersistentFlags().StringVar(&owner, "owner", os.Getenv(api.EnvOwner), "only list and manage clusters created with this owner, default is $"+api.EnvOwner)
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().AddGoFlagSet(goflag.CommandLine)
 }
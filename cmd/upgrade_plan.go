@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var upgradePlanOpt = new(api.UpgradePlanOption)
+
+var upgradePlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "report what upgrading a cluster would run into",
+	Long: `report the kubeadm upgrade path of a cluster, objects and addons using apis removed on the way, nothing is changed, for example:
+  qks upgrade plan my-k8s-cluster -k 1.30.5`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		upgradePlanOpt.ClusterName = args[0]
+		upgradePlanOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunUpgradePlan(upgradePlanOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	upgradeCmd.AddCommand(upgradePlanCmd)
+	upgradePlanCmd.Flags().StringVarP(&upgradePlanOpt.KubernetesVersion, "k8s-version", "k", "", "the k8s version to upgrade to, a minor like '1.30' or 'latest' takes the newest preset")
+	upgradePlanCmd.MarkFlagRequired("k8s-version")
+}
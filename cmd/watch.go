@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/app"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var watchOpt = new(api.WatchOption)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "watch the health of a cluster",
+	Long: `poll instances and nodes of a cluster and print how their states change until interrupted, for example:
+  qks watch my-k8s-cluster
+  qks watch my-k8s-cluster --interval 1m --notify --webhook slack=https://hooks.slack.com/services/xxx
+  qks watch my-k8s-cluster --heal --not-ready-threshold 15m --max-replacements-per-hour 1
+  qks watch my-k8s-cluster --scale "Mon-Fri 09:00-19:00=10" --scale "*=3"
+  qks watch my-k8s-cluster --spec my-k8s-cluster.yaml --drift-policy correct`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		watchOpt.ClusterName = args[0]
+		watchOpt.Zone = zone
+		toRun := newApp()
+		err := toRun.RunWatch(watchOpt)
+		if err != nil {
+			klog.Errorln(err)
+			os.Exit(api.ExitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().DurationVar(&watchOpt.Interval, "interval", 30*time.Second, "how long to wait between two polls")
+	watchCmd.Flags().BoolVar(&watchOpt.Notify, "notify", false, "send state transitions to webhooks given by --webhook")
+	watchCmd.Flags().BoolVar(&watchOpt.Heal, "heal", false, "replace nodes whose instances are stopped or terminated, or which stay NotReady, the master is never replaced")
+	watchCmd.Flags().DurationVar(&watchOpt.NotReadyThreshold, "not-ready-threshold", app.DefaultNotReadyThreshold, "how long a node can stay NotReady before it is replaced by --heal")
+	watchCmd.Flags().StringArrayVar(&watchOpt.ScalingProfiles, "scale", nil, "keep the count of nodes by local time like 'Mon-Fri 09:00-19:00=10', the first matching one is used, can be repeated")
+	watchCmd.Flags().StringVar(&watchOpt.SpecPath, "spec", "", "reconcile the cluster with this spec in every poll, like the one of 'qks export cluster', the count of nodes is corrected or flagged by the drift policy")
+	watchCmd.Flags().StringVar(&watchOpt.DriftPolicy, "drift-policy", "", "correct or flag drifts from --spec, overrides the policy given by 'qks create cluster --drift-policy', default is flag")
+	watchCmd.Flags().IntVar(&watchOpt.MaxReplacementsPerHour, "max-replacements-per-hour", app.DefaultMaxReplacementsPerHour, "stop replacing nodes when so many are replaced in the last hour")
+}
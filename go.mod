@@ -8,6 +8,7 @@ require (
 	github.com/onsi/gomega v1.5.0
 	github.com/sirupsen/logrus v1.4.2 // indirect
 	github.com/spf13/cobra v0.0.5
+	github.com/spf13/pflag v1.0.3
 	github.com/yunify/qingcloud-sdk-go v2.0.0-alpha.35.0.20190710082549-9b4f4db80863+incompatible
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 	gopkg.in/yaml.v2 v2.2.2
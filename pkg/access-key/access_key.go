@@ -1,17 +1,43 @@
 package key
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/magicsong/yunify-k8s/pkg/cassette"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	"github.com/magicsong/yunify-k8s/pkg/ratelimit"
 	"github.com/yunify/qingcloud-sdk-go/config"
 	"github.com/yunify/qingcloud-sdk-go/service"
+	"gopkg.in/yaml.v2"
 	"k8s.io/klog"
 )
 
+const EnvEndpoint = "QKS_ENDPOINT"
+
 type QingCloudAccessKeyHelper struct {
 	Zone          string
 	AccessKeyPath string
-	userID        string
+	// Endpoint overrides host, port, protocol and uri of the config file, like "https://api.qingcloud.example.com:443/iaas"
+	Endpoint string
+	// InsecureSkipTLSVerify accepts self-signed certs of private cloud appliances, it can also be set in the config file
+	InsecureSkipTLSVerify bool
+	// Credentials override keys in the config file and env, for programs embedding qks which keep keys elsewhere
+	Credentials *Credentials
+	// Limiter is waited for before every request, so operations in parallel share the rate limit of qingcloud
+	Limiter *ratelimit.Limiter
+	// credentialProcess of the config file prints keys
+	credentialProcess string
+	userID            string
 
 	qingCloudService *service.QingCloudService
 	qingCloudConfig  *config.Config
@@ -26,17 +52,67 @@ func NewQingCloudAccessKeyHelper(zone string, filepath string) *QingCloudAccessK
 
 func (q *QingCloudAccessKeyHelper) Init() error {
 	qcConfig, _ := config.NewDefault()
-	if q.AccessKeyPath == "" {
-		err := qcConfig.LoadUserConfig()
-		if err != nil {
-			return err
+	creds := q.Credentials
+	if creds == nil {
+		creds = credentialsFromEnv()
+	}
+	if creds == nil && cassette.Replaying() {
+		// requests are answered by the recording, whose signatures are not checked
+		creds = &Credentials{AccessKeyID: "replay", SecretAccessKey: "replay"}
+	}
+	path := q.configPath()
+	if _, err := os.Stat(path); err != nil && creds != nil && creds.AccessKeyID != "" {
+		// keys are not from the config file, defaults are used for the rest
+		klog.V(2).Infof("Config file %s is not used, err: %s", path, err.Error())
+	} else if err != nil && q.AccessKeyPath != "" {
+		if creds != nil {
+			return fmt.Errorf("QingCloud access key id is not found, config file %s is missing, set $%s along with $%s", path, EnvAccessKeyID, EnvSecretAccessKey)
 		}
+		return fmt.Errorf("QingCloud access key is not found, config file %s is missing, set $%s/$%s or write the config file", path, EnvAccessKeyID, EnvSecretAccessKey)
 	} else {
-		err := qcConfig.LoadConfigFromFilepath(q.AccessKeyPath)
-		if err != nil {
+		if q.AccessKeyPath == "" {
+			err := qcConfig.LoadUserConfig()
+			if err != nil {
+				return err
+			}
+		} else {
+			err := qcConfig.LoadConfigFromFilepath(q.AccessKeyPath)
+			if err != nil {
+				return err
+			}
+		}
+		if err := q.loadExtraConfig(); err != nil {
 			return err
 		}
+		if creds == nil && q.credentialProcess != "" {
+			c, err := runCredentialProcess(q.credentialProcess)
+			if err != nil {
+				return err
+			}
+			creds = c
+		}
+		if creds == nil {
+			warnPlaintextSecret(path, qcConfig)
+		}
+	}
+	if creds != nil {
+		applyCredentials(qcConfig, creds)
 	}
+	if qcConfig.AccessKeyID == "" || qcConfig.SecretAccessKey == "" {
+		return fmt.Errorf("QingCloud access key is not found in %s, $%s/$%s or credential_process", path, EnvAccessKeyID, EnvSecretAccessKey)
+	}
+	if q.Endpoint != "" {
+		if err := applyEndpoint(qcConfig, q.Endpoint); err != nil {
+			return err
+		}
+	}
+	if q.InsecureSkipTLSVerify {
+		klog.Warningf("TLS verification of %s is skipped", qcConfig.Host)
+		if t, ok := qcConfig.Connection.Transport.(*http.Transport); ok {
+			t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+	}
+	qcConfig.Connection.Transport = ratelimit.Transport(metrics.InstrumentTransport(log.WrapAPITransport(cassette.WrapTransport(qcConfig.Connection.Transport))), q.Limiter)
 	q.qingCloudConfig = qcConfig
 	qcService, err := service.Init(qcConfig)
 	if err != nil {
@@ -66,3 +142,64 @@ func (q *QingCloudAccessKeyHelper) GetUserID() string {
 func (q *QingCloudAccessKeyHelper) GetService() *service.QingCloudService {
 	return q.qingCloudService
 }
+
+func (q *QingCloudAccessKeyHelper) GetConfig() *config.Config {
+	return q.qingCloudConfig
+}
+
+func (q *QingCloudAccessKeyHelper) configPath() string {
+	path := q.AccessKeyPath
+	if path == "" {
+		path = config.GetUserConfigFilePath()
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+		path = filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+// loadExtraConfig reads keys of the config file which the sdk does not know
+func (q *QingCloudAccessKeyHelper) loadExtraConfig() error {
+	path := q.configPath()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	extra := struct {
+		InsecureSkipTLSVerify bool   `yaml:"insecure_skip_tls_verify"`
+		CredentialProcess     string `yaml:"credential_process"`
+	}{}
+	if err = yaml.Unmarshal(content, &extra); err != nil {
+		return fmt.Errorf("Failed to parse config file %s, err: %s", path, err.Error())
+	}
+	q.InsecureSkipTLSVerify = q.InsecureSkipTLSVerify || extra.InsecureSkipTLSVerify
+	q.credentialProcess = extra.CredentialProcess
+	return nil
+}
+
+func applyEndpoint(c *config.Config, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("Endpoint must be like https://host[:port][/uri], got %s", endpoint)
+	}
+	host, port := u.Host, ""
+	if strings.Contains(u.Host, ":") {
+		if host, port, err = net.SplitHostPort(u.Host); err != nil {
+			return fmt.Errorf("Invalid endpoint %s, err: %s", endpoint, err.Error())
+		}
+	} else if u.Scheme == "https" {
+		port = "443"
+	} else {
+		port = "80"
+	}
+	c.Host = host
+	c.Port, err = strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("Invalid port of endpoint %s", endpoint)
+	}
+	c.Protocol = u.Scheme
+	if u.Path != "" {
+		c.URI = u.Path
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package key
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/yunify/qingcloud-sdk-go/config"
+	"k8s.io/klog"
+)
+
+// EnvAccessKeyID and EnvSecretAccessKey override keys of the config file, which is not needed then
+const (
+	EnvAccessKeyID     = "QY_ACCESS_KEY_ID"
+	EnvSecretAccessKey = "QY_SECRET_ACCESS_KEY"
+)
+
+// Credentials is printed as json by credential_process of the config file, AccessKeyID can be left to the config file
+type Credentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// credentialsFromEnv returns nil if the secret key is not in env
+func credentialsFromEnv() *Credentials {
+	secret := os.Getenv(EnvSecretAccessKey)
+	if secret == "" {
+		return nil
+	}
+	return &Credentials{AccessKeyID: os.Getenv(EnvAccessKeyID), SecretAccessKey: secret}
+}
+
+// runCredentialProcess runs command by sh, e.g. "sops -d --output-type json ~/.qingcloud/credentials.enc.yaml"
+// to decrypt keys, its stderr goes to ours so it can ask for passphrases
+func runCredentialProcess(command string) (*Credentials, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run credential_process '%s', err: %s", command, err.Error())
+	}
+	c := &Credentials{}
+	if err = json.Unmarshal(bytes.TrimSpace(output), c); err != nil {
+		// never print the output, it holds the secret
+		return nil, fmt.Errorf("Output of credential_process '%s' must be json like {\"access_key_id\": \"...\", \"secret_access_key\": \"...\"}", command)
+	}
+	if c.SecretAccessKey == "" {
+		return nil, fmt.Errorf("credential_process '%s' gives no secret_access_key", command)
+	}
+	return c, nil
+}
+
+func applyCredentials(c *config.Config, creds *Credentials) {
+	if creds.AccessKeyID != "" {
+		c.AccessKeyID = strings.TrimSpace(creds.AccessKeyID)
+	}
+	c.SecretAccessKey = strings.TrimSpace(creds.SecretAccessKey)
+}
+
+// warnPlaintextSecret warns if the config file holds the secret key and others can read it
+func warnPlaintextSecret(path string, c *config.Config) {
+	info, err := os.Stat(path)
+	if err != nil || c.SecretAccessKey == "" || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+	klog.Warningf("Config file %s holds the secret key and is readable by others, run 'chmod 600 %s' or use credential_process or $%s instead", path, path, EnvSecretAccessKey)
+}
@@ -0,0 +1,118 @@
+package key
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	var (
+		dir    string
+		server *httptest.Server
+		keys   []string
+		saved  map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "qks-key")
+		Expect(err).ShouldNot(HaveOccurred())
+		keys = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.URL.Query().Get("access_key_id")
+			keys = append(keys, id)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"action":"DescribeAccessKeysResponse","ret_code":0,"total_count":1,"access_key_set":[{"access_key_id":"%s","owner":"usr-test"}]}`, id)
+		}))
+		// keys of whoever runs the tests are kept aside
+		saved = make(map[string]string)
+		for _, env := range []string{EnvAccessKeyID, EnvSecretAccessKey} {
+			if v, ok := os.LookupEnv(env); ok {
+				saved[env] = v
+			}
+			os.Unsetenv(env)
+		}
+	})
+
+	AfterEach(func() {
+		for _, env := range []string{EnvAccessKeyID, EnvSecretAccessKey} {
+			os.Unsetenv(env)
+			if v, ok := saved[env]; ok {
+				os.Setenv(env, v)
+			}
+		}
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("Should take keys from env only if the secret key is set", func() {
+		os.Unsetenv(EnvSecretAccessKey)
+		os.Setenv(EnvAccessKeyID, "AKID")
+		Expect(credentialsFromEnv()).To(BeNil())
+		os.Setenv(EnvSecretAccessKey, "SECRET")
+		Expect(credentialsFromEnv()).To(Equal(&Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}))
+		os.Unsetenv(EnvAccessKeyID)
+		Expect(credentialsFromEnv()).To(Equal(&Credentials{SecretAccessKey: "SECRET"}))
+	})
+
+	It("Should read keys printed by credential_process without printing them on failures", func() {
+		c, err := runCredentialProcess(`echo '{"access_key_id": "AKID", "secret_access_key": "SECRET"}'`)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c).To(Equal(&Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}))
+
+		_, err = runCredentialProcess(`echo secret_access_key: SECRET-$((40+2))`)
+		Expect(err).To(MatchError(ContainSubstring("must be json")))
+		Expect(err.Error()).NotTo(ContainSubstring("SECRET-42"))
+		_, err = runCredentialProcess(`echo '{"access_key_id": "AKID"}'`)
+		Expect(err).To(MatchError(ContainSubstring("gives no secret_access_key")))
+		_, err = runCredentialProcess("exit 3")
+		Expect(err).To(MatchError(ContainSubstring("Failed to run credential_process 'exit 3'")))
+	})
+
+	It("Should guide users whose config file is missing", func() {
+		helper := NewQingCloudAccessKeyHelper("ap2a", filepath.Join(dir, "config.yaml"))
+		helper.Endpoint = server.URL + "/iaas"
+		err := helper.Init()
+		Expect(err).To(MatchError(ContainSubstring("set $QY_ACCESS_KEY_ID/$QY_SECRET_ACCESS_KEY or write the config file")))
+
+		os.Setenv(EnvSecretAccessKey, "SECRET")
+		err = helper.Init()
+		Expect(err).To(MatchError(ContainSubstring("access key id is not found")))
+		Expect(err.Error()).To(ContainSubstring("set $QY_ACCESS_KEY_ID along with $QY_SECRET_ACCESS_KEY"))
+		Expect(keys).To(BeEmpty())
+
+		os.Setenv(EnvAccessKeyID, "AKID")
+		Expect(helper.Init()).To(Succeed())
+		Expect(helper.GetConfig().AccessKeyID).To(Equal("AKID"))
+		Expect(helper.GetConfig().SecretAccessKey).To(Equal("SECRET"))
+		Expect(helper.GetUserID()).To(Equal("usr-test"))
+	})
+
+	It("Should take keys of credential_process of the config file unless env has them", func() {
+		path := filepath.Join(dir, "config.yaml")
+		creds := filepath.Join(dir, "credentials.json")
+		Expect(ioutil.WriteFile(creds, []byte(`{"access_key_id": "PROCESS", "secret_access_key": "SECRET"}`), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte("credential_process: cat "+creds+"\n"), 0600)).To(Succeed())
+		helper := NewQingCloudAccessKeyHelper("ap2a", path)
+		helper.Endpoint = server.URL + "/iaas"
+		Expect(helper.Init()).To(Succeed())
+		Expect(helper.GetConfig().AccessKeyID).To(Equal("PROCESS"))
+		Expect(keys).To(Equal([]string{"PROCESS"}))
+
+		os.Setenv(EnvAccessKeyID, "ENV")
+		os.Setenv(EnvSecretAccessKey, "SECRET")
+		Expect(helper.Init()).To(Succeed())
+		Expect(helper.GetConfig().AccessKeyID).To(Equal("ENV"))
+
+		Expect(ioutil.WriteFile(path, []byte("credential_process: exit 1\n"), 0600)).To(Succeed())
+		os.Unsetenv(EnvSecretAccessKey)
+		Expect(helper.Init()).To(MatchError(ContainSubstring("Failed to run credential_process")))
+	})
+})
@@ -0,0 +1,194 @@
+package addon
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// Addon is an optional component applied to a cluster once it is up
+type Addon struct {
+	Name        string
+	Description string
+	// DefaultVersion is installed if no version is asked, empty if the addon is not versioned
+	DefaultVersion string
+	// URLs are manifests applied from the internet first, for addons too large to keep here
+	URLs func(ctx *Context) []string
+	// WaitNamespace is where deployments must be available before Manifests are applied, e.g. for webhooks
+	WaitNamespace string
+	// Manifests renders what is applied to the cluster, nothing is applied if it is nil or renders nothing
+	Manifests func(ctx *Context) ([]byte, error)
+	// Requires returns addons which must be installed too, it can be nil
+	Requires func(ctx *Context) []string
+	// Chart is installed by helm with Values before Manifests are applied, Version is the one of chart
+	Chart  *Chart
+	Values func(ctx *Context) ([]byte, error)
+	// MinKubernetesVersion is like "1.16", empty if the addon works with all presets
+	MinKubernetesVersion string
+	// RemoveHint tells how to remove the addon by hand, it is set if deleting what was applied would hurt workloads
+	RemoveHint string
+}
+
+// Chart is where a helm chart comes from
+type Chart struct {
+	Repo      string
+	RepoURL   string
+	Name      string
+	Namespace string
+}
+
+// DefaultWaitTimeout is how long deployments in WaitNamespace of an addon can take
+const DefaultWaitTimeout = "300s"
+
+// Context is what an addon is rendered with
+type Context struct {
+	ClusterName       string
+	Zone              string
+	KubernetesVersion string
+	// Version of the addon
+	Version string
+	Params  map[string]string
+}
+
+// Param returns the value of key, or def if it is not given
+func (c *Context) Param(key, def string) string {
+	if v, ok := c.Params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+var addons = make(map[string]*Addon)
+
+func register(a *Addon) {
+	addons[a.Name] = a
+}
+
+// Get returns the addon of name
+func Get(name string) (*Addon, error) {
+	if a, ok := addons[name]; ok {
+		return a, nil
+	}
+	return nil, api.NewValidationError("Addon %s is not found, available addons: %s", name, strings.Join(Names(), ", "))
+}
+
+// Names returns names of all addons in order
+func Names() []string {
+	names := make([]string, 0, len(addons))
+	for name := range addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseOption parses "name" or "name=version" of the --addon flag
+func ParseOption(s string) (api.AddonOption, error) {
+	opt := api.AddonOption{Name: s}
+	if i := strings.Index(s, "="); i != -1 {
+		opt.Name, opt.Version = s[:i], s[i+1:]
+	}
+	if _, err := Get(opt.Name); err != nil {
+		return opt, err
+	}
+	return opt, nil
+}
+
+// NewContext returns the addon asked by opt and the context to render it for the cluster
+func NewContext(opt *api.AddonOption, cluster *api.CreateClusterOption) (*Addon, *Context, error) {
+	a, err := Get(opt.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := &Context{
+		ClusterName:       cluster.ClusterName,
+		Zone:              cluster.Zone,
+		KubernetesVersion: cluster.KubernetesVersion,
+		Version:           opt.Version,
+		Params:            opt.Params,
+	}
+	if ctx.Version == "" {
+		ctx.Version = a.DefaultVersion
+	}
+	return a, ctx, nil
+}
+
+// Render returns manifests of the addon asked by opt for the cluster, nil if it has only URLs
+func Render(opt *api.AddonOption, cluster *api.CreateClusterOption) ([]byte, error) {
+	a, ctx, err := NewContext(opt, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if a.Manifests == nil {
+		return nil, nil
+	}
+	return a.Manifests(ctx)
+}
+
+// Validate renders all addons of cluster and checks what they require is installed as well
+func Validate(cluster *api.CreateClusterOption) error {
+	installed := make(map[string]bool)
+	if cluster.ExposeIngress {
+		installed[IngressNginx] = true
+	}
+	for _, o := range cluster.Addons {
+		installed[o.Name] = true
+	}
+	for i := range cluster.Addons {
+		if err := ValidateAddon(&cluster.Addons[i], cluster, installed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateAddon checks one addon of cluster, installed are addons which are or will be in the cluster
+func ValidateAddon(opt *api.AddonOption, cluster *api.CreateClusterOption, installed map[string]bool) error {
+	a, ctx, err := NewContext(opt, cluster)
+	if err != nil {
+		return err
+	}
+	if a.MinKubernetesVersion != "" {
+		var major, minor int
+		fmt.Sscanf(a.MinKubernetesVersion, "%d.%d", &major, &minor)
+		if !api.VersionAtLeast(cluster.KubernetesVersion, major, minor) {
+			return api.NewValidationError("Addon %s needs k8s %s or later, but the cluster is %s", a.Name, a.MinKubernetesVersion, cluster.KubernetesVersion)
+		}
+	}
+	if a.Values != nil {
+		if _, err = a.Values(ctx); err != nil {
+			return err
+		}
+	}
+	if a.Manifests != nil {
+		if _, err = a.Manifests(ctx); err != nil {
+			return err
+		}
+	}
+	if a.Requires == nil {
+		return nil
+	}
+	for _, r := range a.Requires(ctx) {
+		if !installed[r] {
+			return api.NewValidationError("Addon %s requires addon %s", a.Name, r)
+		}
+	}
+	return nil
+}
+
+// renderTemplate executes text with data, it is the common way addons render manifests
+func renderTemplate(name, text string, data interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, api.NewValidationError("Failed to render addon %s, err: %s", name, err.Error())
+	}
+	return buf.Bytes(), nil
+}
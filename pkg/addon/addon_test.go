@@ -0,0 +1,163 @@
+package addon_test
+
+import (
+	"os"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+// documents splits a rendered manifest and fails on invalid yaml
+func documents(manifest []byte) []map[string]interface{} {
+	docs := make([]map[string]interface{}, 0)
+	for _, doc := range strings.Split(string(manifest), "\n---") {
+		m := make(map[string]interface{})
+		Expect(yaml.Unmarshal([]byte(doc), &m)).ShouldNot(HaveOccurred())
+		if len(m) != 0 {
+			docs = append(docs, m)
+		}
+	}
+	return docs
+}
+
+var _ = Describe("Addon", func() {
+	cluster := &api.CreateClusterOption{ClusterName: "test", KubernetesVersion: "1.15.5"}
+
+	It("Should parse the addon flag", func() {
+		opt, err := addon.ParseOption("pod-security=v1")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(opt).To(Equal(api.AddonOption{Name: addon.PodSecurity, Version: "v1"}))
+		_, err = addon.ParseOption("unknown")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should render pod security labels and network policies", func() {
+		manifest, err := addon.Render(&api.AddonOption{Name: addon.PodSecurity}, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		docs := documents(manifest)
+		Expect(docs).To(HaveLen(2))
+		Expect(docs[0]["kind"]).To(Equal("Namespace"))
+		Expect(string(manifest)).To(ContainSubstring("pod-security.kubernetes.io/enforce: baseline"))
+		Expect(docs[1]["kind"]).To(Equal("NetworkPolicy"))
+
+		manifest, err = addon.Render(&api.AddonOption{Name: addon.PodSecurity, Params: map[string]string{
+			"level":         "restricted",
+			"namespaces":    "default,apps",
+			"networkPolicy": "false",
+		}}, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		docs = documents(manifest)
+		Expect(docs).To(HaveLen(2))
+		Expect(docs[1]["metadata"]).To(HaveKeyWithValue("name", "apps"))
+		Expect(string(manifest)).To(ContainSubstring("enforce: restricted"))
+
+		_, err = addon.Render(&api.AddonOption{Name: addon.PodSecurity, Params: map[string]string{"level": "strict"}}, cluster)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should render ingress-nginx of the asked version", func() {
+		manifest, err := addon.Render(&api.AddonOption{Name: addon.IngressNginx, Version: "0.29.0", Params: map[string]string{"publishStatusAddress": "139.198.0.1"}}, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		docs := documents(manifest)
+		Expect(docs).To(HaveLen(8))
+		Expect(docs[7]["kind"]).To(Equal("DaemonSet"))
+		Expect(string(manifest)).To(ContainSubstring("nginx-ingress-controller:0.29.0\n"))
+		Expect(string(manifest)).To(ContainSubstring("--publish-status-address=139.198.0.1"))
+		manifest, err = addon.Render(&api.AddonOption{Name: addon.IngressNginx}, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(manifest)).NotTo(ContainSubstring("publish-status-address"))
+	})
+
+	It("Should render a ClusterIssuer only with acme email and require ingress for it", func() {
+		opt := &api.AddonOption{Name: addon.CertManager}
+		manifest, err := addon.Render(opt, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifest).To(BeEmpty())
+		a, ctx, err := addon.NewContext(opt, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(a.URLs(ctx)).To(Equal([]string{"https://github.com/jetstack/cert-manager/releases/download/v0.15.2/cert-manager.yaml"}))
+
+		opt.Params = map[string]string{"acmeEmail": "ops@example.com", "staging": "true"}
+		manifest, err = addon.Render(opt, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(documents(manifest)[0]["apiVersion"]).To(Equal("cert-manager.io/v1alpha2"))
+		Expect(string(manifest)).To(ContainSubstring("server: " + addon.LetsEncryptStagingServer))
+		opt.Version = "v1.0.4"
+		manifest, _ = addon.Render(opt, cluster)
+		Expect(documents(manifest)[0]["apiVersion"]).To(Equal("cert-manager.io/v1"))
+
+		withAddons := *cluster
+		withAddons.Addons = []api.AddonOption{*opt}
+		Expect(api.ExitCode(addon.Validate(&withAddons))).To(Equal(api.ExitCodeValidation))
+		withAddons.ExposeIngress = true
+		Expect(addon.Validate(&withAddons)).ShouldNot(HaveOccurred())
+		withAddons.Addons[0].Params["acmeEmail"] = "ops"
+		Expect(api.ExitCode(addon.Validate(&withAddons))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should size the monitoring stack and check the k8s version", func() {
+		newer := &api.CreateClusterOption{ClusterName: "test", KubernetesVersion: "1.18.6"}
+		newer.Addons = []api.AddonOption{{Name: addon.Monitoring, Params: map[string]string{"size": "medium", "grafanaPassword": "pa:ss"}}}
+		Expect(addon.Validate(newer)).ShouldNot(HaveOccurred())
+		a, ctx, err := addon.NewContext(&newer.Addons[0], newer)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(a.Chart.Name).To(Equal("kube-prometheus-stack"))
+		values, err := a.Values(ctx)
+		Expect(err).ShouldNot(HaveOccurred())
+		parsed := documents(values)[0]
+		Expect(parsed["grafana"]).To(HaveKeyWithValue("adminPassword", "pa:ss"))
+		Expect(string(values)).To(ContainSubstring("retention: 15d"))
+		Expect(string(values)).NotTo(ContainSubstring("ingress"))
+
+		newer.Addons[0].Params["grafanaHost"] = "grafana.example.com"
+		Expect(api.ExitCode(addon.Validate(newer))).To(Equal(api.ExitCodeValidation))
+		newer.ExposeIngress = true
+		Expect(addon.Validate(newer)).ShouldNot(HaveOccurred())
+		delete(newer.Addons[0].Params, "grafanaPassword")
+		Expect(api.ExitCode(addon.Validate(newer))).To(Equal(api.ExitCodeValidation))
+
+		old := &api.CreateClusterOption{ClusterName: "test", KubernetesVersion: "1.15.5", Addons: []api.AddonOption{{Name: addon.Monitoring, Params: map[string]string{"grafanaPassword": "x"}}}}
+		err = addon.Validate(old)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("needs k8s 1.16"))
+	})
+
+	It("Should keep logs for a multiple of the loki index period", func() {
+		opt := &api.AddonOption{Name: addon.Logging, Params: map[string]string{"retention": "336h", "storageClass": "csi-ssd"}}
+		a, ctx, err := addon.NewContext(opt, cluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		values, err := a.Values(ctx)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(values)).To(ContainSubstring("retention_period: 336h\n"))
+		Expect(string(values)).To(ContainSubstring("storageClassName: csi-ssd\n    size: 20Gi"))
+
+		withAddons := *cluster
+		withAddons.Addons = []api.AddonOption{{Name: addon.Logging, Params: map[string]string{"retention": "100h"}}}
+		Expect(api.ExitCode(addon.Validate(&withAddons))).To(Equal(api.ExitCodeValidation))
+		withAddons.Addons[0].Params = nil
+		Expect(addon.Validate(&withAddons)).ShouldNot(HaveOccurred())
+	})
+
+	It("Should point velero to QingStor with credentials from env", func() {
+		os.Setenv("QKS_TEST_QINGSTOR_SECRET", "secret")
+		defer os.Unsetenv("QKS_TEST_QINGSTOR_SECRET")
+		withAddons := *cluster
+		withAddons.Zone = "pek3b"
+		withAddons.Addons = []api.AddonOption{{Name: addon.Velero, Params: map[string]string{"bucket": "backups", "accessKeyID": "AKID", "secretAccessKeyEnv": "QKS_TEST_QINGSTOR_SECRET"}}}
+		Expect(addon.Validate(&withAddons)).ShouldNot(HaveOccurred())
+		a, ctx, _ := addon.NewContext(&withAddons.Addons[0], &withAddons)
+		values, err := a.Values(ctx)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(documents(values)).To(HaveLen(1))
+		Expect(string(values)).To(ContainSubstring("s3Url: https://s3.pek3b.qingstor.com"))
+		Expect(string(values)).To(ContainSubstring("prefix: test\n"))
+		Expect(string(values)).To(ContainSubstring("aws_access_key_id=AKID\n      aws_secret_access_key=secret\n"))
+
+		os.Unsetenv("QKS_TEST_QINGSTOR_SECRET")
+		Expect(api.ExitCode(addon.Validate(&withAddons))).To(Equal(api.ExitCodeValidation))
+	})
+})
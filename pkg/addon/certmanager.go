@@ -0,0 +1,76 @@
+package addon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const CertManager = "cert-manager"
+
+const (
+	LetsEncryptServer        = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingServer = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+const clusterIssuerManifest = `apiVersion: {{ .APIVersion }}
+kind: ClusterIssuer
+metadata:
+  name: {{ .Name }}
+spec:
+  acme:
+    email: {{ .Email }}
+    server: {{ .Server }}
+    privateKeySecretRef:
+      name: {{ .Name }}-account-key
+    solvers:
+    - http01:
+        ingress:
+          class: nginx
+`
+
+func init() {
+	register(&Addon{
+		Name:           CertManager,
+		Description:    "cert-manager, with a let's encrypt ClusterIssuer solved by ingress-nginx if acmeEmail is given, params: acmeEmail, staging, issuerName",
+		DefaultVersion: "v0.15.2",
+		URLs: func(ctx *Context) []string {
+			return []string{fmt.Sprintf("https://github.com/jetstack/cert-manager/releases/download/%s/cert-manager.yaml", ctx.Version)}
+		},
+		WaitNamespace: "cert-manager",
+		Manifests:     clusterIssuer,
+		Requires: func(ctx *Context) []string {
+			if ctx.Param("acmeEmail", "") == "" {
+				return nil
+			}
+			return []string{IngressNginx}
+		},
+	})
+}
+
+// clusterIssuer renders nothing if no acmeEmail is given
+func clusterIssuer(ctx *Context) ([]byte, error) {
+	email := ctx.Param("acmeEmail", "")
+	if email == "" {
+		return nil, nil
+	}
+	if !strings.Contains(email, "@") {
+		return nil, api.NewValidationError("Invalid acme email %s", email)
+	}
+	server := LetsEncryptServer
+	if ctx.Param("staging", "false") == "true" {
+		server = LetsEncryptStagingServer
+	}
+	// cert-manager serves v1 from 1.0
+	apiVersion := "cert-manager.io/v1"
+	if strings.HasPrefix(ctx.Version, "v0.") {
+		apiVersion = "cert-manager.io/v1alpha2"
+	}
+	return renderTemplate(CertManager, clusterIssuerManifest, map[string]string{
+		"APIVersion": apiVersion,
+		"Name":       ctx.Param("issuerName", "letsencrypt"),
+		"Email":      email,
+		"Server":     server,
+	})
+}
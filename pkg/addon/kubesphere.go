@@ -0,0 +1,34 @@
+package addon
+
+import "fmt"
+
+const (
+	KubeSphere               = "kubesphere"
+	KubeSphereDefaultVersion = "v3.0.0"
+)
+
+const (
+	// KubeSphereConsolePort is the node port of ks-console
+	KubeSphereConsolePort = 30880
+	// KubeSphereDefaultUser and KubeSphereDefaultPassword log into a fresh console, the password must be changed then
+	KubeSphereDefaultUser     = "admin"
+	KubeSphereDefaultPassword = "P@88w0rd"
+	// KubeSphereReadyMessage is logged by ks-installer once all components are up
+	KubeSphereReadyMessage = "Welcome to KubeSphere"
+	KubeSphereNamespace    = "kubesphere-system"
+)
+
+func init() {
+	register(&Addon{
+		Name:           KubeSphere,
+		Description:    "kubesphere installed by ks-installer, needs a default storage class",
+		DefaultVersion: KubeSphereDefaultVersion,
+		URLs: func(ctx *Context) []string {
+			base := fmt.Sprintf("https://github.com/kubesphere/ks-installer/releases/download/%s/", ctx.Version)
+			return []string{base + "kubesphere-installer.yaml", base + "cluster-configuration.yaml"}
+		},
+		MinKubernetesVersion: "1.15",
+		// deleting ks-installer leaves components it installed
+		RemoveHint: "run scripts/kubesphere-delete.sh of ks-installer on master",
+	})
+}
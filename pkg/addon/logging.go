@@ -0,0 +1,55 @@
+package addon
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const Logging = "logging"
+
+// lokiIndexPeriod is the period of loki index tables, retention must be a multiple of it
+const lokiIndexPeriod = 168 * time.Hour
+
+const loggingValues = `loki:
+  config:
+    table_manager:
+      retention_deletes_enabled: true
+      retention_period: {{ .Retention }}
+{{- if .StorageClass }}
+  persistence:
+    enabled: true
+    storageClassName: {{ .StorageClass }}
+    size: {{ .Size }}
+{{- end }}
+promtail:
+  enabled: true
+grafana:
+  enabled: false
+`
+
+func init() {
+	register(&Addon{
+		Name:           Logging,
+		Description:    "loki with promtail on every machine, params: retention (multiple of 168h), storageClass and size to persist logs",
+		DefaultVersion: "2.1.2",
+		Chart: &Chart{
+			Repo:      "grafana",
+			RepoURL:   "https://grafana.github.io/helm-charts",
+			Name:      "loki-stack",
+			Namespace: "logging",
+		},
+		Values: func(ctx *Context) ([]byte, error) {
+			retention, err := time.ParseDuration(ctx.Param("retention", "168h"))
+			if err != nil || retention <= 0 || retention%lokiIndexPeriod != 0 {
+				return nil, api.NewValidationError("Retention of logs must be a multiple of %s, got %s", lokiIndexPeriod, ctx.Param("retention", ""))
+			}
+			return renderTemplate(Logging, loggingValues, map[string]string{
+				"Retention":    strconv.Itoa(int(retention.Hours())) + "h",
+				"StorageClass": ctx.Param("storageClass", ""),
+				"Size":         ctx.Param("size", "20Gi"),
+			})
+		},
+	})
+}
@@ -0,0 +1,81 @@
+package addon
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const Monitoring = "monitoring"
+
+type monitoringSize struct {
+	Retention     string
+	CPU           string
+	Memory        string
+	MemoryLimit   string
+	GrafanaMemory string
+}
+
+// monitoringSizes are resources of prometheus by the size of cluster
+var monitoringSizes = map[string]monitoringSize{
+	"small":  {Retention: "7d", CPU: "200m", Memory: "512Mi", MemoryLimit: "1Gi", GrafanaMemory: "128Mi"},
+	"medium": {Retention: "15d", CPU: "500m", Memory: "2Gi", MemoryLimit: "4Gi", GrafanaMemory: "256Mi"},
+}
+
+const monitoringValues = `prometheus:
+  prometheusSpec:
+    retention: {{ .Size.Retention }}
+    resources:
+      requests:
+        cpu: {{ .Size.CPU }}
+        memory: {{ .Size.Memory }}
+      limits:
+        memory: {{ .Size.MemoryLimit }}
+grafana:
+  adminPassword: {{ printf "%q" .GrafanaPassword }}
+  resources:
+    requests:
+      memory: {{ .Size.GrafanaMemory }}
+{{- if .GrafanaHost }}
+  ingress:
+    enabled: true
+    annotations:
+      kubernetes.io/ingress.class: nginx
+    hosts:
+    - {{ .GrafanaHost }}
+{{- end }}
+`
+
+func init() {
+	register(&Addon{
+		Name:                 Monitoring,
+		Description:          "prometheus, grafana and node-exporter by kube-prometheus-stack, params: size (small, medium), grafanaPassword, grafanaHost to expose grafana behind the ingress",
+		DefaultVersion:       "9.4.10",
+		MinKubernetesVersion: "1.16",
+		Chart: &Chart{
+			Repo:      "prometheus-community",
+			RepoURL:   "https://prometheus-community.github.io/helm-charts",
+			Name:      "kube-prometheus-stack",
+			Namespace: "monitoring",
+		},
+		Values: func(ctx *Context) ([]byte, error) {
+			size, ok := monitoringSizes[ctx.Param("size", "small")]
+			if !ok {
+				return nil, api.NewValidationError("Size of monitoring must be small or medium, got %s", ctx.Param("size", ""))
+			}
+			password := ctx.Param("grafanaPassword", "")
+			if password == "" {
+				return nil, api.NewValidationError("Monitoring needs grafanaPassword, the default one of the chart is public")
+			}
+			return renderTemplate(Monitoring, monitoringValues, map[string]interface{}{
+				"Size":            size,
+				"GrafanaPassword": password,
+				"GrafanaHost":     ctx.Param("grafanaHost", ""),
+			})
+		},
+		Requires: func(ctx *Context) []string {
+			if ctx.Param("grafanaHost", "") == "" {
+				return nil
+			}
+			return []string{IngressNginx}
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package addon
+
+import (
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const PodSecurity = "pod-security"
+
+var podSecurityLevels = []string{"privileged", "baseline", "restricted"}
+
+const podSecurityManifests = `{{- range .Namespaces }}
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ . }}
+  labels:
+    pod-security.kubernetes.io/enforce: {{ $.Level }}
+    pod-security.kubernetes.io/warn: {{ $.Level }}
+    pod-security.kubernetes.io/audit: {{ $.Level }}
+{{- if $.NetworkPolicy }}
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: qks-same-namespace-only
+  namespace: {{ . }}
+spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+  ingress:
+  - from:
+    - podSelector: {}
+{{- end }}
+---
+{{- end }}
+`
+
+func init() {
+	register(&Addon{
+		Name:        PodSecurity,
+		Description: "enforce a pod security level and only allow ingress from the same namespace, params: level, namespaces, networkPolicy",
+		Manifests:   podSecurity,
+		// the manifests hold namespaces of workloads
+		RemoveHint: "remove labels like 'pod-security.kubernetes.io/enforce' from namespaces and delete network policies named qks-same-namespace-only by kubectl",
+	})
+}
+
+// podSecurity labels namespaces for Pod Security admission, which is ignored by clusters older than 1.23 where only network policies apply
+func podSecurity(ctx *Context) ([]byte, error) {
+	level := ctx.Param("level", "baseline")
+	valid := false
+	for _, l := range podSecurityLevels {
+		valid = valid || l == level
+	}
+	if !valid {
+		return nil, api.NewValidationError("Pod security level must be one of %v, got %s", podSecurityLevels, level)
+	}
+	return renderTemplate(PodSecurity, podSecurityManifests, map[string]interface{}{
+		"Level":         level,
+		"Namespaces":    strings.Split(ctx.Param("namespaces", "default"), ","),
+		"NetworkPolicy": ctx.Param("networkPolicy", "true") == "true",
+	})
+}
@@ -0,0 +1,78 @@
+package addon
+
+import (
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const Velero = "velero"
+
+// VeleroAWSPlugin talks to QingStor by its s3 compatible api
+const VeleroAWSPlugin = "velero/velero-plugin-for-aws:v1.1.0"
+
+const veleroValues = `configuration:
+  provider: aws
+  backupStorageLocation:
+    name: default
+    bucket: {{ .Bucket }}
+    prefix: {{ .Prefix }}
+    config:
+      region: {{ .Zone }}
+      s3ForcePathStyle: "true"
+      s3Url: https://s3.{{ .Zone }}.qingstor.com
+credentials:
+  secretContents:
+    cloud: |
+      [default]
+      aws_access_key_id={{ .AccessKeyID }}
+      aws_secret_access_key={{ .SecretAccessKey }}
+initContainers:
+- name: velero-plugin-for-aws
+  image: {{ .Plugin }}
+  volumeMounts:
+  - mountPath: /target
+    name: plugins
+# qingcloud volumes have no snapshot plugin, restic copies data of volumes instead
+snapshotsEnabled: false
+deployRestic: {{ .Restic }}
+`
+
+func init() {
+	register(&Addon{
+		Name:           Velero,
+		Description:    "velero backing up to a QingStor bucket, params: bucket, accessKeyID, secretAccessKey or secretAccessKeyEnv, qingstorZone, prefix, restic",
+		DefaultVersion: "2.13.2",
+		Chart: &Chart{
+			Repo:      "vmware-tanzu",
+			RepoURL:   "https://vmware-tanzu.github.io/helm-charts",
+			Name:      "velero",
+			Namespace: "velero",
+		},
+		Values: veleroValuesOf,
+	})
+}
+
+func veleroValuesOf(ctx *Context) ([]byte, error) {
+	bucket := ctx.Param("bucket", "")
+	accessKeyID := ctx.Param("accessKeyID", "")
+	if bucket == "" || accessKeyID == "" {
+		return nil, api.NewValidationError("Velero needs bucket and accessKeyID of QingStor")
+	}
+	secret := ctx.Param("secretAccessKey", "")
+	if env := ctx.Param("secretAccessKeyEnv", ""); env != "" {
+		secret = os.Getenv(env)
+	}
+	if secret == "" {
+		return nil, api.NewValidationError("Velero needs secretAccessKey of QingStor, or secretAccessKeyEnv naming an env holding it")
+	}
+	return renderTemplate(Velero, veleroValues, map[string]string{
+		"Bucket":          bucket,
+		"Prefix":          ctx.Param("prefix", ctx.ClusterName),
+		"Zone":            ctx.Param("qingstorZone", ctx.Zone),
+		"AccessKeyID":     accessKeyID,
+		"SecretAccessKey": secret,
+		"Plugin":          VeleroAWSPlugin,
+		"Restic":          ctx.Param("restic", "true"),
+	})
+}
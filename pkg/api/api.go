@@ -1,43 +1,436 @@
 package api
 
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/util/homedir"
+)
+
 const (
 	ErrorK8sVersionNotSupport = "Currently we do not support k8s version %s"
-	SSHKeyName                = "DO_NOT_REMOVE_K8S_KEY"
-	CalicoCNI                 = "calico"
-	FlannelCNI                = "flannel"
-	HostnicCNI                = "hostnic"
-	ClusterTagPrefix          = "K8S-Cluster-"
+	// SSHKeyName is the key shared by clusters of old versions, new clusters get their own key named by SSHKeyNameOf
+	SSHKeyName          = "DO_NOT_REMOVE_K8S_KEY"
+	CalicoCNI           = "calico"
+	FlannelCNI          = "flannel"
+	HostnicCNI          = "hostnic"
+	ClusterTagPrefix    = "K8S-Cluster-"
+	ResourceTypeEIP     = "eip"
+	ResourceTypeVolume  = "volume"
+	ResourceTypeKeyPair = "keypair"
+	EnvOwner            = "QKS_OWNER"
 )
 
+// ConfigDir is where qks keeps its local files like logs
+func ConfigDir() string {
+	return filepath.Join(homedir.HomeDir(), ".qks")
+}
+
+// SSHKeyNameOf is the name of keypair created for a cluster, so concurrent runs never share or race on one key
+func SSHKeyNameOf(clusterName string) string {
+	return "qks-" + clusterName
+}
+
+// DefaultKubeConfigPath is where the kubeconfig of a cluster is copied to if not specified
+func DefaultKubeConfigPath(clusterName string) string {
+	return filepath.Join(homedir.HomeDir(), ".kube", "yunify-"+clusterName+".conf")
+}
+
 const (
 	RoleMaster byte = iota
 	RoleNode
+	// RoleWindowsNode is experimental, such nodes only run as workers
+	RoleWindowsNode
 )
 
 type CreateClusterOption struct {
-	ClusterName          string `yaml:"clusterName,omitempty"`
-	KubernetesVersion    string `yaml:"kubernetesVersion,omitempty"`
-	NodeCount            int    `yaml:"nodeCount,omitempty"`
-	VxNet                string `yaml:"vxNet,omitempty"`
-	InstanceClass        int    `yaml:"instanceClass,omitempty"`
+	ClusterName       string `yaml:"clusterName,omitempty"`
+	KubernetesVersion string `yaml:"kubernetesVersion,omitempty"`
+	NodeCount         int    `yaml:"nodeCount,omitempty"`
+	VxNet             string `yaml:"vxNet,omitempty"`
+	InstanceClass     int    `yaml:"instanceClass,omitempty"`
+	// MasterInstanceType and NodeInstanceType are like "enterprise-memory" or "c4m8", they override InstanceClass
+	MasterInstanceType string `yaml:"masterInstanceType,omitempty"`
+	NodeInstanceType   string `yaml:"nodeInstanceType,omitempty"`
+	// WindowsNodeCount windows workers are joined after linux ones, they need flannel and images of WindowsNodeImageID
+	WindowsNodeCount        int    `yaml:"windowsNodeCount,omitempty"`
+	WindowsNodeInstanceType string `yaml:"windowsNodeInstanceType,omitempty"`
+	// FallbackInstanceTypes are tried in order for master and nodes whose instance type the zone has no capacity of,
+	// like "c4m8" or "enterprise"
+	FallbackInstanceTypes []string `yaml:"fallbackInstanceTypes,omitempty"`
+	// FallbackZones are tried in order if the zone offers none of the instance types, before anything is created
+	FallbackZones []string `yaml:"fallbackZones,omitempty"`
+	// Arch of images and instances, ArchARM64 needs qingcloud instance types of arm for both roles
+	Arch string `yaml:"arch,omitempty"`
+	// NodeImageVariant creates linux nodes from a node image captured by 'qks create image capture', nodes added later take it too
+	NodeImageVariant string `yaml:"nodeImageVariant,omitempty"`
+	// NodeSnapshot is an instance snapshot like "ss-xxxx" of a prepared node which never joined a cluster, it is captured
+	// once as the node image variant named by its id, so linux nodes boot with images pulled and packages installed
+	NodeSnapshot         string `yaml:"nodeSnapshot,omitempty"`
 	Zone                 string `yaml:"zone,omitempty"`
 	NetworkOption        `yaml:"networkOption,omitempty"`
 	UseExistKey          bool   `yaml:"useExistKey,omitempty"`
 	ScpKubeConfigToLocal bool   `yaml:"scpKubeConfigToLocal,omitempty"`
 	LocalKubeConfigPath  string `yaml:"localKubeConfigPath,omitempty"`
+	ConfirmDeleteByName  bool   `yaml:"confirmDeleteByName,omitempty"`
+	Protect              bool   `yaml:"protect,omitempty"`
+	OverwriteKubeConfig  bool   `yaml:"overwriteKubeConfig,omitempty"`
+	BootstrapLogDir      string `yaml:"bootstrapLogDir,omitempty"`
+	JoinRetries          int    `yaml:"joinRetries,omitempty"`
+	// InitRetries is how many times master is reset and kubeadm init runs again after a failure
+	InitRetries int `yaml:"initRetries,omitempty"`
+	// TokenTTL is how long the bootstrap token lives, like "1h", it is deleted once nodes join anyway
+	TokenTTL string `yaml:"tokenTTL,omitempty"`
+	// Timeout bounds the whole create, no phase is begun after it is exceeded but the running one is not cancelled,
+	// 0 means no limit
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// DeleteOnTimeout deletes what is created so far once Timeout is exceeded
+	DeleteOnTimeout bool `yaml:"deleteOnTimeout,omitempty"`
+	// DriftPolicy tells 'qks watch --spec' to correct or only flag drifts from the spec, it is DriftPolicyFlag if empty
+	DriftPolicy string `yaml:"driftPolicy,omitempty"`
+	// UserData is a script run as root on every linux machine before kubeadm, like installers of agents the site requires
+	UserData string `yaml:"userData,omitempty"`
+	// BootWait is how linux machines tell they are booted before kubeadm, "ssh" once ssh connects, "cloud-init" once
+	// cloud-init is done, or "file:<path>" once a sentinel file like one written by user data of the image exists
+	BootWait string `yaml:"bootWait,omitempty"`
+	// BootWaitTimeout is how long machines may take to be booted by BootWait, 10 minutes if not set
+	BootWaitTimeout time.Duration `yaml:"bootWaitTimeout,omitempty"`
+	// Adopt creates the cluster into an existing tag of the same name, such as one left by a failed create
+	Adopt bool `yaml:"adopt,omitempty"`
+	// KubeadmInitExtraFlags and KubeadmJoinExtraFlags are appended to the generated commands as is
+	KubeadmInitExtraFlags []string `yaml:"kubeadmInitExtraFlags,omitempty"`
+	KubeadmJoinExtraFlags []string `yaml:"kubeadmJoinExtraFlags,omitempty"`
+	// ControlPlanePatchesDir is a local folder of patches to static pods, in the layout of kubeadm --patches
+	ControlPlanePatchesDir string `yaml:"controlPlanePatchesDir,omitempty"`
+	// ControlPlaneEndpoint is a dns name with optional port used by kubeconfigs and added to cert SANs, so the cluster can move behind it later
+	ControlPlaneEndpoint string `yaml:"controlPlaneEndpoint,omitempty"`
+	// ControlPlaneEndpointResolvable tells machines resolve the dns name of ControlPlaneEndpoint by themselves, like a record
+	// of an internal load balancer, so it is not pinned to master in /etc/hosts and nodes join through it
+	ControlPlaneEndpointResolvable bool `yaml:"controlPlaneEndpointResolvable,omitempty"`
+	// APIServerCertSANs are extra ips and dns names trusted by the apiserver certificate, like vpn addresses or ips of load balancers
+	APIServerCertSANs []string `yaml:"apiServerCertSANs,omitempty"`
+	// EtcdVolumeSize in GB attaches a dedicated volume to master for etcd data, 0 keeps etcd on the root disk
+	EtcdVolumeSize int `yaml:"etcdVolumeSize,omitempty"`
+	// EtcdVolumeType is a qingcloud volume type, 0 picks a ssd one usable by InstanceClass
+	EtcdVolumeType int `yaml:"etcdVolumeType,omitempty"`
+	// Etcd tunes the local etcd of master, defaults of kubeadm are used if empty
+	Etcd EtcdOption `yaml:"etcd,omitempty"`
+	// CACertFile and CAKeyFile are a local CA in PEM used by kubeadm instead of a generated one, e.g. an intermediate of corporate PKI
+	CACertFile string `yaml:"caCertFile,omitempty"`
+	CAKeyFile  string `yaml:"caKeyFile,omitempty"`
+	// ResourceGroup is the id of a qingcloud resource group like "rg-xxxx", all created resources are put into it
+	ResourceGroup string `yaml:"resourceGroup,omitempty"`
+	// SecurityGroup is the id of an existing security group like "sg-xxxx" attached to all instances instead of the
+	// default one of the zone, for firewalls managed centrally
+	SecurityGroup string `yaml:"securityGroup,omitempty"`
+	// ResourcesManifest is a file listing created cloud resources for inventory tools, terraform import blocks if it ends with .tf, json otherwise
+	ResourcesManifest string `yaml:"resourcesManifest,omitempty"`
+	// EndpointsFile is a file the machines of the created cluster are written to for downstream automation, in
+	// EndpointsFormat, which is told by extension if empty: terraform outputs for .json, an ansible inventory for .ini,
+	// dotenv otherwise
+	EndpointsFile   string `yaml:"endpointsFile,omitempty"`
+	EndpointsFormat string `yaml:"endpointsFormat,omitempty"`
+	// PrePullImages are pulled on every node after it joins, so the first rollout does not hit the registry from all nodes at once
+	PrePullImages []string `yaml:"prePullImages,omitempty"`
+	// Checksums are sha256 in hex of what is downloaded by url, like manifests of CNIs and addons or helm,
+	// a download which does not match is not used. They win over checksums declared by qks.
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+	// RequireChecksums refuses downloads without a declared checksum
+	RequireChecksums bool `yaml:"requireChecksums,omitempty"`
+	// Registry distributes credentials of private registries once the cluster is up
+	Registry RegistryOption `yaml:"registry,omitempty"`
+	// Teams get namespaces with quotas, limits and role bindings once nodes join, so a shared cluster is usable at once
+	Teams []TeamOption `yaml:"teams,omitempty"`
+	// Addons are applied in order once nodes join
+	Addons []AddonOption `yaml:"addons,omitempty"`
+	// ExposeIngress installs ingress-nginx and binds a new eip to a node as the public entry of http traffic
+	ExposeIngress bool `yaml:"exposeIngress,omitempty"`
+	// IngressBandwidth is the bandwidth of the ingress eip in Mbps, default is DefaultIngressBandwidth
+	IngressBandwidth int `yaml:"ingressBandwidth,omitempty"`
+	// KubeSphere is the version of KubeSphere installed last once the cluster is healthy, empty if not installed
+	KubeSphere string `yaml:"kubeSphere,omitempty"`
+}
+
+const DefaultIngressBandwidth = 10
+
+// policies of drifts found by watching a cluster with its spec, only the count of nodes can be corrected, other drifts are flagged
+const (
+	DriftPolicyFlag    = "flag"
+	DriftPolicyCorrect = "correct"
+)
+
+type AddonOption struct {
+	Name string `yaml:"name"`
+	// Version is the default one of the addon if empty
+	Version string            `yaml:"version,omitempty"`
+	Params  map[string]string `yaml:"params,omitempty"`
+}
+
+// EtcdOption holds flags of etcd, zero values keep the defaults of etcd
+type EtcdOption struct {
+	// QuotaBackendBytes raises the size limit of the database, etcd refuses writes beyond it
+	QuotaBackendBytes int64 `yaml:"quotaBackendBytes,omitempty"`
+	// HeartbeatInterval and ElectionTimeout are in milliseconds
+	HeartbeatInterval int `yaml:"heartbeatInterval,omitempty"`
+	ElectionTimeout   int `yaml:"electionTimeout,omitempty"`
+	// SnapshotCount is the number of committed transactions to trigger a snapshot to disk
+	SnapshotCount int `yaml:"snapshotCount,omitempty"`
+}
+
+// IsEmpty tells if etcd runs with the defaults
+func (e EtcdOption) IsEmpty() bool {
+	return e == EtcdOption{}
+}
+
+type RegistryOption struct {
+	Credentials []RegistryCredential `yaml:"credentials,omitempty"`
+	// Namespaces get an imagePullSecret holding all credentials, default is "default"
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// SecretName of the imagePullSecret, default is DefaultRegistrySecretName
+	SecretName string `yaml:"secretName,omitempty"`
+	// NodeAuth also gives the credentials to kubelet of every machine, so pods pull without imagePullSecrets
+	NodeAuth bool `yaml:"nodeAuth,omitempty"`
+}
+
+const DefaultRegistrySecretName = "qks-registry"
+
+type TeamOption struct {
+	Name string `yaml:"name"`
+	// Namespace of the team, default is Name
+	Namespace string `yaml:"namespace,omitempty"`
+	// Users and Groups are bound to Role in the namespace, as names authenticated by the apiserver
+	Users  []string `yaml:"users,omitempty"`
+	Groups []string `yaml:"groups,omitempty"`
+	// Role is a ClusterRole bound in the namespace, default is DefaultTeamRole
+	Role string `yaml:"role,omitempty"`
+	// Quota is spec.hard of a ResourceQuota, like "requests.cpu": "8" or "pods": "50"
+	Quota map[string]string `yaml:"quota,omitempty"`
+	// Limits are defaults and maximums of containers in a LimitRange
+	Limits TeamLimits `yaml:"limits,omitempty"`
+}
+
+const DefaultTeamRole = "edit"
+
+// GetNamespace returns Namespace, or Name if it is empty
+func (t *TeamOption) GetNamespace() string {
+	if t.Namespace == "" {
+		return t.Name
+	}
+	return t.Namespace
+}
+
+type TeamLimits struct {
+	// Default are limits and DefaultRequest are requests of containers giving none
+	Default        map[string]string `yaml:"default,omitempty"`
+	DefaultRequest map[string]string `yaml:"defaultRequest,omitempty"`
+	Max            map[string]string `yaml:"max,omitempty"`
+}
+
+// IsEmpty tells if no LimitRange is needed
+func (l TeamLimits) IsEmpty() bool {
+	return len(l.Default) == 0 && len(l.DefaultRequest) == 0 && len(l.Max) == 0
+}
+
+type RegistryCredential struct {
+	// Server is the host of registry like "harbor.example.com"
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password,omitempty"`
+	// PasswordEnv is the environment variable holding the password, so the spec can be kept in git
+	PasswordEnv string `yaml:"passwordEnv,omitempty"`
+}
+
+// GetPassword returns Password, or reads it from PasswordEnv
+func (r *RegistryCredential) GetPassword() (string, error) {
+	if r.PasswordEnv == "" {
+		return r.Password, nil
+	}
+	password := os.Getenv(r.PasswordEnv)
+	if password == "" {
+		return "", NewValidationError("Password of registry %s should be in env %s, but it is empty", r.Server, r.PasswordEnv)
+	}
+	return password, nil
 }
 
 type NetworkOption struct {
-	CNIName        string `yaml:"cniName,omitempty"`
+	CNIName string `yaml:"cniName,omitempty"`
+	// CNIVersion pins a release of the CNI, the one bundled in images is used if empty
+	CNIVersion     string `yaml:"cniVersion,omitempty"`
 	PodNetWorkCIDR string `yaml:"podNetWorkCIDR,omitempty"`
 	Mode           string `yaml:"mode,omitempty"`
 	SkipCNI        bool   `yaml:"skipCNI,omitempty"`
+	// SkipNetworkCheck does not check pods reach each other after nodes join, it is skipped with SkipCNI as well
+	SkipNetworkCheck bool `yaml:"skipNetworkCheck,omitempty"`
 }
 
 type DeleteClusterOption struct {
 	ClusterName string
+	// ForceDelete skips the interactive confirmation
 	ForceDelete bool
+	// ConfirmName must equal ClusterName to delete clusters created with ConfirmDeleteByName without typing it
+	ConfirmName string
+	Zone        string
+	// KeepEIP, KeepVolumes and KeepSSHKey leave tagged resources of the kind untouched
+	KeepEIP     bool
+	KeepVolumes bool
+	KeepSSHKey  bool
+	// Timeout bounds the whole delete like the one of create, 0 means no limit
+	Timeout time.Duration
+}
+
+type PrintJoinOption struct {
+	ClusterName string
+	Zone        string
+	// TokenTTL of the new token, default is the one of kubeadm
+	TokenTTL string
+	// CAHashOnly prints only the hash of cluster CA instead of creating a token
+	CAHashOnly bool
+}
+
+// KubectlOption runs kubectl against a cluster
+type KubectlOption struct {
+	ClusterName string
+	Zone        string
+	Args        []string
+	// OnMaster runs kubectl on master over ssh even if the apiserver is reachable from here
+	OnMaster bool
+}
+
+// CaptureImageOption captures a customized node of a cluster as a node image variant
+type CaptureImageOption struct {
+	ClusterName string
+	Zone        string
+	// InstanceID is the linux node captured, it leaves the cluster while it is stopped and joins again afterwards
+	InstanceID string
+	// SnapshotID is an instance snapshot captured instead of a node, the snapshot must be of a machine which never joined
+	SnapshotID string
+	// Variant names the image among node images of the kubernetes version of the cluster
+	Variant string
+	// ImageName is qks-<version>-<variant> if empty
+	ImageName string
+	// BootstrapLogDir keeps outputs of the join, default is ConfigDir()/logs/<cluster>
+	BootstrapLogDir string
+}
+
+// AddonActionOption installs, upgrades or removes an addon of a running cluster
+type AddonActionOption struct {
+	ClusterName string
 	Zone        string
+	// Addon is installed or upgraded with its params, only the name is used to remove it
+	Addon AddonOption
+	// Checksums are sha256 of what the addon downloads by url, like Checksums of CreateClusterOption
+	Checksums map[string]string
+}
+
+type ProtectClusterOption struct {
+	ClusterName string
+	// Unprotect removes the protection instead
+	Unprotect bool
+	Zone      string
+}
+
+type RenameClusterOption struct {
+	ClusterName string
+	NewName     string
+	Zone        string
+}
+
+type ExportSpecOption struct {
+	ClusterName string
+	Zone        string
+	// OutputPath is the file written, the spec is printed if it is empty
+	OutputPath string
+	// Format is "spec" for options of 'qks create cluster -Y', or "json" and "terraform" for a manifest of cloud resources
+	Format string
+}
+
+type InventoryOption struct {
+	ClusterName string
+	Zone        string
+	// OutputPath is the file written, the inventory is printed if it is empty
+	OutputPath string
+	// Format is "ini" for a static inventory of ansible, or "json" in the form dynamic inventory scripts print
+	Format string
+}
+
+type DiffOption struct {
+	// SpecPath is a yaml of CreateClusterOption, like the one written by 'qks export cluster'
+	SpecPath string
+	// Zone is used if the spec has no zone
+	Zone string
+}
+
+type CostOption struct {
+	ClusterName string
+	Zone        string
+	// HistoryPath is a jsonl file every report is appended to, so the cost can be followed over time
+	HistoryPath string
+}
+
+type WatchOption struct {
+	ClusterName string
+	Zone        string
+	// Interval is how long to wait between two polls
+	Interval time.Duration
+	// Rounds stops watching after polling so many times, 0 watches until interrupted
+	Rounds int
+	// Notify sends state transitions to webhooks in addition to printing them
+	Notify bool
+	// Heal replaces nodes whose instances are stopped or gone, or which stay not ready for NotReadyThreshold
+	Heal              bool
+	NotReadyThreshold time.Duration
+	// MaxReplacementsPerHour stops healing when something keeps breaking nodes
+	MaxReplacementsPerHour int
+	// ScalingProfiles are counts of nodes by time like "Mon-Fri 09:00-19:00=10", the first matching one is kept
+	ScalingProfiles []string
+	// BootstrapLogDir keeps join logs of new nodes, default is the one of creating the cluster
+	BootstrapLogDir string
+	// SpecPath is a spec of the cluster like the one of 'qks diff', the cluster is reconciled with it in every poll
+	SpecPath string
+	// DriftPolicy overrides the one of the cluster given when it was created
+	DriftPolicy string
+}
+
+type CordonOption struct {
+	ClusterName string
+	Zone        string
+	// Pool is the role of machines, one of master, node and winnode
+	Pool string
+	// Drain evicts pods of cordoned nodes as well
+	Drain bool
+}
+
+type PatchOption struct {
+	ClusterName string
+	Zone        string
+	// Parallelism is how many workers are patched at a time, 1 if not set
+	Parallelism int
+	// BootstrapLogDir keeps outputs of package managers, default is ConfigDir()/logs/<cluster>
+	BootstrapLogDir string
+}
+
+type UpgradePlanOption struct {
+	ClusterName string
+	Zone        string
+	// KubernetesVersion is the version to upgrade to, it must have a preset
+	KubernetesVersion string
+}
+
+// CreateBundleOption builds an offline bundle of a kubernetes version on a machine of its master image
+type CreateBundleOption struct {
+	KubernetesVersion string
+	Zone              string
+	VxNet             string
+	// Arch of the images, ArchAMD64 if empty
+	Arch        string
+	UseExistKey bool
+	// Output is the local path of the bundle, default is the file name of the bundle in the current folder
+	Output string
+	// KeepMachine leaves the builder running to look into a failure, it is deleted otherwise
+	KeepMachine bool
+	// BootstrapLogDir keeps the output of the bundle script, default is ConfigDir()/logs/bundle-<version>
+	BootstrapLogDir string
 }
 
 type CreateImageOption struct {
@@ -52,9 +445,11 @@ type CreateImageManifest struct {
 	Scripts []string `yaml:"scripts,omitempty,flow"`
 }
 type InstanceInfo struct {
-	BaseImage   string `yaml:"baseImage,omitempty"`
-	Role        byte   `yaml:"role,omitempty"`
-	VxNet       string `yaml:"vxNet,omitempty"`
-	UseExistKey bool   `yaml:"useExistKey,omitempty"`
-	Zone        string `yaml:"zone,omitempty"`
+	BaseImage string `yaml:"baseImage,omitempty"`
+	// InstanceType of the builder, required by base images of arm64
+	InstanceType string `yaml:"instanceType,omitempty"`
+	Role         byte   `yaml:"role,omitempty"`
+	VxNet        string `yaml:"vxNet,omitempty"`
+	UseExistKey  bool   `yaml:"useExistKey,omitempty"`
+	Zone         string `yaml:"zone,omitempty"`
 }
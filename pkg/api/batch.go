@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// BatchSpec describes clusters created together from one template, like labs of a class
+type BatchSpec struct {
+	// Template is the option of every cluster, its ClusterName is the prefix of generated names
+	Template CreateClusterOption `yaml:"template"`
+	// Count clusters are named <prefix>-01 to <prefix>-NN, it is ignored if Names are given
+	Count int `yaml:"count,omitempty"`
+	// Names of clusters created from the template
+	Names []string `yaml:"names,omitempty"`
+	// Concurrency is how many clusters are created at once, 0 uses the default of qks
+	Concurrency int `yaml:"concurrency,omitempty"`
+}
+
+// Clusters returns an option of the template for every cluster of the batch, they share nothing
+func (s *BatchSpec) Clusters() ([]CreateClusterOption, error) {
+	names := s.Names
+	if len(names) == 0 {
+		if s.Count <= 0 {
+			return nil, NewValidationError("Either names or a positive count of clusters is required in the batch")
+		}
+		if s.Template.ClusterName == "" {
+			return nil, NewValidationError("clusterName of the template is required as the prefix of %d clusters", s.Count)
+		}
+		width := len(strconv.Itoa(s.Count))
+		if width < 2 {
+			width = 2
+		}
+		for i := 1; i <= s.Count; i++ {
+			names = append(names, fmt.Sprintf("%s-%0*d", s.Template.ClusterName, width, i))
+		}
+	}
+	// a round trip of yaml copies slices and maps of the template, so clusters created in parallel do not share them
+	template, err := yaml.Marshal(&s.Template)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]CreateClusterOption, len(names))
+	for i, name := range names {
+		if err := yaml.UnmarshalStrict(template, &clusters[i]); err != nil {
+			return nil, err
+		}
+		clusters[i].ClusterName = name
+	}
+	return clusters, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+
+	qcerrors "github.com/yunify/qingcloud-sdk-go/request/errors"
+)
+
+// ErrorClass tells automation what kind of failure happened, every class maps to an exit code
+type ErrorClass int
+
+const (
+	ErrorClassUnknown ErrorClass = iota + 1
+	ErrorClassValidation
+	ErrorClassQuota
+	ErrorClassCloudAPI
+	ErrorClassBootstrap
+	ErrorClassPartialSuccess
+	// ErrorClassDrift means the cluster differs from its spec, nothing failed
+	ErrorClassDrift
+	// ErrorClassTimeout means the operation is stopped as it runs out of its time
+	ErrorClassTimeout
+	// ErrorClassCapacity means the zone has no capacity of the instance type, other types or zones may have
+	ErrorClassCapacity
+)
+
+// Exit codes of qks, 1 is kept for unclassified errors
+const (
+	ExitCodeOK             = 0
+	ExitCodeUnknown        = 1
+	ExitCodeValidation     = 2
+	ExitCodeQuota          = 3
+	ExitCodeCloudAPI       = 4
+	ExitCodeBootstrap      = 5
+	ExitCodePartialSuccess = 6
+	ExitCodeDrift          = 7
+	ExitCodeTimeout        = 8
+)
+
+// ret codes of qingcloud api which mean the account runs out of money or quota, or the zone runs out of resources
+const (
+	RetCodeBalanceNotEnough  = 2400
+	RetCodeQuotaNotEnough    = 2500
+	RetCodeResourceNotEnough = 5200
+)
+
+var exitCodes = map[ErrorClass]int{
+	ErrorClassUnknown:        ExitCodeUnknown,
+	ErrorClassValidation:     ExitCodeValidation,
+	ErrorClassQuota:          ExitCodeQuota,
+	ErrorClassCloudAPI:       ExitCodeCloudAPI,
+	ErrorClassBootstrap:      ExitCodeBootstrap,
+	ErrorClassPartialSuccess: ExitCodePartialSuccess,
+	ErrorClassDrift:          ExitCodeDrift,
+	ErrorClassTimeout:        ExitCodeTimeout,
+	// running out of resources is the same to automation whether the zone or the account does
+	ErrorClassCapacity: ExitCodeQuota,
+}
+
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (c *classifiedError) Error() string {
+	return c.err.Error()
+}
+
+func (c *classifiedError) Unwrap() error {
+	return c.err
+}
+
+// WithClass marks err with a class, it returns nil if err is nil
+func WithClass(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+func NewValidationError(format string, args ...interface{}) error {
+	return WithClass(ErrorClassValidation, fmt.Errorf(format, args...))
+}
+
+// NewCloudAPIError is used when qingcloud returns a non-zero ret code
+func NewCloudAPIError(retCode int, format string, args ...interface{}) error {
+	return WithClass(retCodeClass(retCode), fmt.Errorf(format, args...))
+}
+
+func retCodeClass(retCode int) ErrorClass {
+	if retCode == RetCodeBalanceNotEnough || retCode == RetCodeQuotaNotEnough {
+		return ErrorClassQuota
+	} else if retCode == RetCodeResourceNotEnough {
+		return ErrorClassCapacity
+	}
+	return ErrorClassCloudAPI
+}
+
+// FromQingCloud classifies err returned by the qingcloud sdk, which turns every non-zero ret code into a
+// *errors.QingCloudError, so running out of balance, quota or capacity is told apart from other failures of the api
+func FromQingCloud(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	msg := fmt.Sprintf(format, args...)
+	if retCode, ok := QingCloudRetCode(err); ok {
+		return NewCloudAPIError(retCode, "%s, err: %s", msg, err.Error())
+	}
+	return WithClass(ErrorClassCloudAPI, fmt.Errorf("%s, err: %s", msg, err.Error()))
+}
+
+// QingCloudRetCode returns the ret code qingcloud answers with, ok is false for failures before an answer like ones of network
+func QingCloudRetCode(err error) (retCode int, ok bool) {
+	for e := err; e != nil; {
+		if qcErr, ok := e.(*qcerrors.QingCloudError); ok {
+			return qcErr.RetCode, true
+		}
+		u, ok := e.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		e = u.Unwrap()
+	}
+	return 0, false
+}
+
+// ClassOf returns the outermost class of err, errors of the qingcloud sdk nobody classified are classified by their ret code
+func ClassOf(err error) ErrorClass {
+	for e := err; e != nil; {
+		if c, ok := e.(*classifiedError); ok {
+			return c.class
+		}
+		u, ok := e.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		e = u.Unwrap()
+	}
+	if retCode, ok := QingCloudRetCode(err); ok {
+		return retCodeClass(retCode)
+	}
+	return ErrorClassUnknown
+}
+
+// ExitCode maps err to the exit code of process
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+	return exitCodes[ClassOf(err)]
+}
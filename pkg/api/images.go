@@ -1,53 +1,306 @@
 package api
 
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
 var PresetKubernetes map[string]ImagesPreset
 
+const (
+	ContainerRuntimeDocker     = "docker"
+	ContainerRuntimeContainerd = "containerd"
+)
+
+// base OS of images, an empty one is the ubuntu of the oldest images
+const (
+	OSUbuntu2004 = "ubuntu-20.04"
+	OSUbuntu2204 = "ubuntu-22.04"
+	OSCentOS7    = "centos-7"
+	OSRocky8     = "rocky-8"
+	OSRocky9     = "rocky-9"
+)
+
+// architectures of images and instances
+const (
+	ArchAMD64 = "amd64"
+	ArchARM64 = "arm64"
+)
+
+type ZoneImages struct {
+	NodeImageID   string `yaml:"nodeImageID,omitempty"`
+	MasterImageID string `yaml:"masterImageID,omitempty"`
+	// ARM64NodeImageID and ARM64MasterImageID are built on an arm64 base image, they run on arm instance types only
+	ARM64NodeImageID   string `yaml:"arm64NodeImageID,omitempty"`
+	ARM64MasterImageID string `yaml:"arm64MasterImageID,omitempty"`
+	// WindowsNodeImageID is a windows server image with OpenSSH, containerd and kubeadm, for RoleWindowsNode
+	WindowsNodeImageID string `yaml:"windowsNodeImageID,omitempty"`
+	// NodeImageVariants and ARM64NodeImageVariants map names of variants to node images captured from customized nodes
+	NodeImageVariants      map[string]string `yaml:"nodeImageVariants,omitempty"`
+	ARM64NodeImageVariants map[string]string `yaml:"arm64NodeImageVariants,omitempty"`
+}
+
+// For returns the master and node images of arch, empty if there are none
+func (z ZoneImages) For(arch string) (master, node string) {
+	if arch == ArchARM64 {
+		return z.ARM64MasterImageID, z.ARM64NodeImageID
+	}
+	return z.MasterImageID, z.NodeImageID
+}
+
+// VariantsFor returns the node image variants of arch
+func (z ZoneImages) VariantsFor(arch string) map[string]string {
+	if arch == ArchARM64 {
+		return z.ARM64NodeImageVariants
+	}
+	return z.NodeImageVariants
+}
+
 type ImagesPreset struct {
 	KubernetesVersion string
-	NodeImageID       string
-	MasterImageID     string
-	NodeCPU           int
-	NodeMemory        int
-	MasterCPU         int
-	MasterMemory      int
-	CNIYamlPath       string
-	CNICmd            string
+	// NodeImageID and MasterImageID are the images of one zone and Arch, they are filled by PresetFor
+	NodeImageID   string
+	MasterImageID string
+	Arch          string
+	// WindowsNodeImageID is filled with the amd64 images only
+	WindowsNodeImageID string
+	// NodeImageVariants are the variants of NodeImageID, filled by PresetFor
+	NodeImageVariants map[string]string
+	// Zones maps zone to its images, images are not shared across zones
+	Zones        map[string]ZoneImages
+	NodeCPU      int
+	NodeMemory   int
+	MasterCPU    int
+	MasterMemory int
+	CNIYamlPath  string
+	CNICmd       string
+	// ContainerRuntime of the images, ContainerRuntimeDocker if empty
+	ContainerRuntime string
+	// OS the images are built on
+	OS string
 }
 
 func init() {
 	PresetKubernetes = make(map[string]ImagesPreset)
 	PresetKubernetes["1.13.1"] = ImagesPreset{
 		KubernetesVersion: "1.13.1",
-		NodeImageID:       "img-sykyoovw",
-		MasterImageID:     "img-ybttnmjg",
-		NodeCPU:           4,
-		NodeMemory:        4096,
-		MasterCPU:         4,
-		MasterMemory:      4096,
-		CNIYamlPath:       "/root/CNI",
-		CNICmd:            "cni.sh",
+		Zones: map[string]ZoneImages{
+			"ap2a": {NodeImageID: "img-sykyoovw", MasterImageID: "img-ybttnmjg"},
+		},
+		NodeCPU:      4,
+		NodeMemory:   4096,
+		MasterCPU:    4,
+		MasterMemory: 4096,
+		CNIYamlPath:  "/root/CNI",
+		CNICmd:       "cni.sh",
 	}
 
 	PresetKubernetes["1.15.2"] = ImagesPreset{
 		KubernetesVersion: "1.15.2",
-		NodeImageID:       "img-sykyoovw",
-		MasterImageID:     "img-kj5hg0fe",
-		NodeCPU:           4,
-		NodeMemory:        4096,
-		MasterCPU:         4,
-		MasterMemory:      4096,
-		CNIYamlPath:       "/root/CNI",
-		CNICmd:            "cni.sh",
+		Zones: map[string]ZoneImages{
+			"ap2a": {NodeImageID: "img-sykyoovw", MasterImageID: "img-kj5hg0fe"},
+		},
+		NodeCPU:      4,
+		NodeMemory:   4096,
+		MasterCPU:    4,
+		MasterMemory: 4096,
+		CNIYamlPath:  "/root/CNI",
+		CNICmd:       "cni.sh",
 	}
 	PresetKubernetes["1.15.5"] = ImagesPreset{
 		KubernetesVersion: "1.15.5",
-		NodeImageID:       "img-sykyoovw",
-		MasterImageID:     "img-kj5hg0fe",
+		Zones: map[string]ZoneImages{
+			"ap2a": {NodeImageID: "img-sykyoovw", MasterImageID: "img-kj5hg0fe"},
+		},
+		NodeCPU:      2,
+		NodeMemory:   2048,
+		MasterCPU:    2,
+		MasterMemory: 4096,
+		CNIYamlPath:  "/root/CNI",
+		CNICmd:       "cni.sh",
+	}
+	// images are built from vmimage/1.30.x and registered in ZoneImagesFile, there are no public ones yet
+	PresetKubernetes["1.30.5"] = ImagesPreset{
+		KubernetesVersion: "1.30.5",
+		Zones:             map[string]ZoneImages{},
 		NodeCPU:           2,
-		NodeMemory:        2048,
+		NodeMemory:        4096,
 		MasterCPU:         2,
 		MasterMemory:      4096,
 		CNIYamlPath:       "/root/CNI",
 		CNICmd:            "cni.sh",
+		ContainerRuntime:  ContainerRuntimeContainerd,
+		OS:                OSUbuntu2204,
+	}
+}
+
+// ZoneImagesFile lists images built by users for presets, as version -> zone -> images
+func ZoneImagesFile() string {
+	return filepath.Join(ConfigDir(), "images.yaml")
+}
+
+// LoadZoneImages adds images in file to presets, a missing file is ignored
+func LoadZoneImages(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	images := make(map[string]map[string]ZoneImages)
+	if err = yaml.UnmarshalStrict(content, &images); err != nil {
+		return NewValidationError("Invalid images in %s, err: %s", file, err.Error())
+	}
+	for version, zones := range images {
+		preset, ok := PresetKubernetes[version]
+		if !ok {
+			return NewValidationError("Images in %s are for kubernetes %s which has no preset", file, version)
+		}
+		for zone, z := range zones {
+			found := false
+			for _, arch := range []string{ArchAMD64, ArchARM64} {
+				master, node := z.For(arch)
+				if (master == "") != (node == "") {
+					return NewValidationError("Both master and node images of kubernetes %s in zone %s for %s are required in %s", version, zone, arch, file)
+				}
+				found = found || master != ""
+			}
+			if !found {
+				return NewValidationError("Kubernetes %s in zone %s has no images in %s", version, zone, file)
+			}
+			if preset.Zones == nil {
+				preset.Zones = make(map[string]ZoneImages)
+			}
+			preset.Zones[zone] = z
+		}
+		PresetKubernetes[version] = preset
+	}
+	return nil
+}
+
+// PresetFor returns the preset of version with images of zone and arch, amd64 if arch is empty
+func PresetFor(version, zone, arch string) (ImagesPreset, error) {
+	preset, ok := PresetKubernetes[version]
+	if !ok {
+		return preset, NewValidationError(ErrorK8sVersionNotSupport, version)
+	}
+	if arch == "" {
+		arch = ArchAMD64
+	}
+	if arch != ArchAMD64 && arch != ArchARM64 {
+		return preset, NewValidationError("Unknown arch %s, use %s or %s", arch, ArchAMD64, ArchARM64)
+	}
+	images, ok := preset.Zones[zone]
+	if master, _ := images.For(arch); ok && master == "" {
+		return preset, NewValidationError("Kubernetes %s has no %s images in zone %s, images can be built by 'qks create image' on an %s base image and listed in %s", version, arch, zone, arch, ZoneImagesFile())
+	}
+	if !ok {
+		zones := make([]string, 0, len(preset.Zones))
+		for z := range preset.Zones {
+			zones = append(zones, z)
+		}
+		sort.Strings(zones)
+		return preset, NewValidationError("Kubernetes %s has no images in zone %s, available zones: %v, images of other zones can be built by 'qks create image' and listed in %s", version, zone, zones, ZoneImagesFile())
+	}
+	preset.MasterImageID, preset.NodeImageID = images.For(arch)
+	preset.Arch = arch
+	preset.NodeImageVariants = images.VariantsFor(arch)
+	if arch == ArchAMD64 {
+		preset.WindowsNodeImageID = images.WindowsNodeImageID
+	}
+	return preset, nil
+}
+
+// WithNodeImageVariant returns the preset whose node image is the variant, the preset is unchanged if variant is empty
+func (p ImagesPreset) WithNodeImageVariant(variant string) (ImagesPreset, error) {
+	if variant == "" {
+		return p, nil
+	}
+	id, ok := p.NodeImageVariants[variant]
+	if !ok {
+		return p, NewValidationError("Kubernetes %s has no %s node image variant %s, variants are captured from nodes by 'qks create image capture'", p.KubernetesVersion, p.Arch, variant)
+	}
+	p.NodeImageID = id
+	return p, nil
+}
+
+// SaveNodeImageVariant registers the node image of variant for version, zone and arch in file and in presets.
+// A zone missing in file takes the images of its preset, so the file keeps passing LoadZoneImages.
+func SaveNodeImageVariant(file, version, zone, arch, variant, imageID string) error {
+	preset, ok := PresetKubernetes[version]
+	if !ok {
+		return NewValidationError(ErrorK8sVersionNotSupport, version)
+	}
+	images := make(map[string]map[string]ZoneImages)
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = yaml.UnmarshalStrict(content, &images); err != nil {
+		return NewValidationError("Invalid images in %s, err: %s", file, err.Error())
+	}
+	if images[version] == nil {
+		images[version] = make(map[string]ZoneImages)
+	}
+	z, ok := images[version][zone]
+	if !ok {
+		z = preset.Zones[zone]
+	}
+	variants := make(map[string]string)
+	for name, id := range z.VariantsFor(arch) {
+		variants[name] = id
+	}
+	variants[variant] = imageID
+	if arch == ArchARM64 {
+		z.ARM64NodeImageVariants = variants
+	} else {
+		z.NodeImageVariants = variants
+	}
+	images[version][zone] = z
+	content, err = yaml.Marshal(images)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+	if preset.Zones == nil {
+		preset.Zones = make(map[string]ZoneImages)
+	}
+	preset.Zones[zone] = z
+	PresetKubernetes[version] = preset
+	return nil
+}
+
+// ArchOfMasterImage tells if the master image in zone is an arm64 one of presets, ArchAMD64 otherwise
+func ArchOfMasterImage(zone, imageID string) string {
+	for _, preset := range PresetKubernetes {
+		if images, ok := preset.Zones[zone]; ok && images.ARM64MasterImageID == imageID && imageID != "" {
+			return ArchARM64
+		}
+	}
+	return ArchAMD64
+}
+
+// VersionOfMasterImage finds the kubernetes version whose preset uses the master image in zone,
+// it returns "" if the image is not a preset one or is shared by several versions
+func VersionOfMasterImage(zone, imageID string) string {
+	found := ""
+	for version, preset := range PresetKubernetes {
+		if images, ok := preset.Zones[zone]; ok && (images.MasterImageID == imageID || images.ARM64MasterImageID == imageID) {
+			if found != "" {
+				return ""
+			}
+			found = version
+		}
 	}
+	return found
 }
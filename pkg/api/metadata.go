@@ -0,0 +1,125 @@
+package api
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	metadataPrefix     = "qks-"
+	metadataOwner      = "owner"
+	metadataConfirmKey = "confirm-delete-by-name"
+	metadataProtected  = "protected"
+	metadataVersion    = "version"
+	metadataCNI        = "cni"
+	metadataPodCIDR    = "pod-cidr"
+	metadataAddons     = "addons"
+	metadataVariant    = "node-image-variant"
+	metadataDrift      = "drift-policy"
+)
+
+// ClusterMetadata is saved as the description of cluster tag, in form of "qks-owner=team-a;qks-confirm-delete-by-name=true"
+type ClusterMetadata struct {
+	// Owner tells which team the cluster belongs to
+	Owner string
+	// ConfirmDeleteByName requires typing the cluster name to delete it
+	ConfirmDeleteByName bool
+	// Protected clusters cannot be deleted until they are unprotected
+	Protected bool
+	// KubernetesVersion, CNIName and PodNetworkCIDR record how the cluster is created, they cannot be found from instances
+	KubernetesVersion string
+	CNIName           string
+	PodNetworkCIDR    string
+	// NodeImageVariant is the variant of node image which nodes added later are created from
+	NodeImageVariant string
+	// DriftPolicy tells 'qks watch --spec' to correct or flag drifts of the cluster from its spec
+	DriftPolicy string
+	// Addons maps installed addons to their versions, which are empty for unversioned addons
+	Addons map[string]string
+}
+
+// ParseClusterMetadata ignores anything in description not written by us
+func ParseClusterMetadata(description string) ClusterMetadata {
+	m := ClusterMetadata{}
+	for _, pair := range strings.Split(description, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], metadataPrefix) {
+			continue
+		}
+		switch strings.TrimPrefix(kv[0], metadataPrefix) {
+		case metadataOwner:
+			m.Owner = kv[1]
+		case metadataConfirmKey:
+			m.ConfirmDeleteByName = kv[1] == "true"
+		case metadataProtected:
+			m.Protected = kv[1] == "true"
+		case metadataVersion:
+			m.KubernetesVersion = kv[1]
+		case metadataCNI:
+			m.CNIName = kv[1]
+		case metadataPodCIDR:
+			m.PodNetworkCIDR = kv[1]
+		case metadataVariant:
+			m.NodeImageVariant = kv[1]
+		case metadataDrift:
+			m.DriftPolicy = kv[1]
+		case metadataAddons:
+			m.Addons = parseAddons(kv[1])
+		}
+	}
+	return m
+}
+
+func (m ClusterMetadata) String() string {
+	pairs := make([]string, 0)
+	if m.Owner != "" {
+		pairs = append(pairs, metadataPrefix+metadataOwner+"="+m.Owner)
+	}
+	if m.ConfirmDeleteByName {
+		pairs = append(pairs, metadataPrefix+metadataConfirmKey+"=true")
+	}
+	if m.Protected {
+		pairs = append(pairs, metadataPrefix+metadataProtected+"=true")
+	}
+	for key, value := range map[string]string{metadataVersion: m.KubernetesVersion, metadataCNI: m.CNIName, metadataPodCIDR: m.PodNetworkCIDR, metadataVariant: m.NodeImageVariant, metadataDrift: m.DriftPolicy} {
+		if value != "" {
+			pairs = append(pairs, metadataPrefix+key+"="+value)
+		}
+	}
+	if len(m.Addons) != 0 {
+		pairs = append(pairs, metadataPrefix+metadataAddons+"="+formatAddons(m.Addons))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// addons are saved like "cert-manager@v0.15.2,pod-security@"
+func parseAddons(value string) map[string]string {
+	addons := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		nv := strings.SplitN(item, "@", 2)
+		if nv[0] == "" {
+			continue
+		}
+		if len(nv) == 2 {
+			addons[nv[0]] = nv[1]
+		} else {
+			addons[nv[0]] = ""
+		}
+	}
+	return addons
+}
+
+func formatAddons(addons map[string]string) string {
+	items := make([]string, 0, len(addons))
+	for name, version := range addons {
+		items = append(items, name+"@"+version)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// OwnerOf returns the owner in the description of a cluster tag, or "" if the cluster has no owner
+func OwnerOf(description string) string {
+	return ParseClusterMetadata(description).Owner
+}
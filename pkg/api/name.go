@@ -0,0 +1,52 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+)
+
+// NameLimit is the most characters qingcloud takes in names of tags, keypairs and instances
+const NameLimit = 64
+
+// MaxClusterNameLength leaves room in NameLimit for the longest name derived from a cluster, the instance name
+// 'K8S-APP-<cluster>-winnode'
+const MaxClusterNameLength = NameLimit - len("K8S-APP--winnode")
+
+var clusterNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// NormalizeClusterName lowers the case of name and turns '_', '.' and spaces into '-', so the tag, keypair, instances
+// and the kubeconfig of a cluster are all named the same way
+func NormalizeClusterName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer("_", "-", ".", "-", " ", "-").Replace(name)
+}
+
+// ValidateClusterName makes sure a normalized name is a DNS label short enough for all names derived from it
+func ValidateClusterName(name string) error {
+	if name == "" {
+		return NewValidationError("ClusterName cannot be empty")
+	}
+	if len(name) > MaxClusterNameLength {
+		return NewValidationError("ClusterName %s is longer than %d characters", name, MaxClusterNameLength)
+	}
+	if !clusterNamePattern.MatchString(name) {
+		return NewValidationError("ClusterName %s must consist of lower case letters, digits and '-', and start and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// ValidateOwner makes sure owner can be kept in ClusterMetadata, whose pairs are split by ';' and '='
+func ValidateOwner(owner string) error {
+	if strings.ContainsAny(owner, ";=") {
+		return NewValidationError("Owner %s cannot contain ';' or '='", owner)
+	}
+	return nil
+}
+
+// ValidateTagPrefix makes sure names of cluster tags taking prefix cannot be mistaken for metadata
+func ValidateTagPrefix(prefix string) error {
+	if strings.ContainsAny(prefix, ";=") {
+		return NewValidationError("Tag prefix %s cannot contain ';' or '='", prefix)
+	}
+	return nil
+}
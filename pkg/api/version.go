@@ -0,0 +1,73 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionAtLeast compares a version like "1.15.5" with major.minor
+func VersionAtLeast(version string, major, minor int) bool {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return false
+	}
+	ma, err1 := strconv.Atoi(parts[0])
+	mi, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return ma > major || (ma == major && mi >= minor)
+}
+
+// KubernetesVersionLatest resolves to the newest kubernetes version with a preset
+const KubernetesVersionLatest = "latest"
+
+// ResolveKubernetesVersion turns version like "1.15", "v1.15.2" or "latest" into the version of a preset. A minor or
+// "latest" resolves to the newest matching preset, one with images in zone for arch is preferred if zone is given,
+// so what PresetFor finds is usable; an exact version is only trimmed.
+func ResolveKubernetesVersion(version, zone, arch string) (string, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if _, ok := PresetKubernetes[v]; ok {
+		return v, nil
+	}
+	matches := make([]string, 0)
+	for _, preset := range PresetVersions() {
+		if v == KubernetesVersionLatest || (strings.Count(v, ".") == 1 && strings.HasPrefix(preset, v+".")) {
+			matches = append(matches, preset)
+		}
+	}
+	if len(matches) == 0 {
+		return "", NewValidationError(ErrorK8sVersionNotSupport+", versions with presets are %s", version, strings.Join(PresetVersions(), ", "))
+	}
+	newest := matches[len(matches)-1]
+	if zone != "" {
+		for i := len(matches) - 1; i >= 0; i-- {
+			if _, err := PresetFor(matches[i], zone, arch); err == nil {
+				newest = matches[i]
+				break
+			}
+		}
+	}
+	return newest, nil
+}
+
+// PresetVersions are kubernetes versions with presets, sorted by minor and then patch
+func PresetVersions() []string {
+	versions := make([]string, 0, len(PresetKubernetes))
+	for v := range PresetKubernetes {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := strings.Split(versions[i], "."), strings.Split(versions[j], ".")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			x, _ := strconv.Atoi(a[k])
+			y, _ := strconv.Atoi(b[k])
+			if x != y {
+				return x < y
+			}
+		}
+		return len(a) < len(b)
+	})
+	return versions
+}
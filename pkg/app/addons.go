@@ -0,0 +1,207 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+const (
+	addonInstall = "install"
+	addonUpgrade = "upgrade"
+	addonRemove  = "remove"
+)
+
+// RunAddonInstall installs an addon which is not in the cluster yet
+func (a *app) RunAddonInstall(opt *api.AddonActionOption) error {
+	return a.runAddonAction(addonInstall, opt)
+}
+
+// RunAddonUpgrade installs another version of an installed addon, params are given again as they are not saved
+func (a *app) RunAddonUpgrade(opt *api.AddonActionOption) error {
+	return a.runAddonAction(addonUpgrade, opt)
+}
+
+// RunAddonRemove deletes what an addon applied to the cluster
+func (a *app) RunAddonRemove(opt *api.AddonActionOption) error {
+	return a.runAddonAction(addonRemove, opt)
+}
+
+func (a *app) runAddonAction(action string, opt *api.AddonActionOption) error {
+	start := time.Now()
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if _, err := addon.Get(opt.Addon.Name); err != nil {
+		return err
+	}
+	err := a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	operation := "addon-" + action
+	span := a.scope.StartRoot("RunAddon")
+	span.SetAttribute("cluster.name", opt.ClusterName)
+	span.SetAttribute("addon.name", opt.Addon.Name)
+	span.SetAttribute("addon.action", action)
+	a.record = audit.NewRecord(operation, opt.ClusterName, opt.Zone, opt)
+	err = a.runAddon(action, opt)
+	audit.Finish(a.record, a.userID, err)
+	span.Finish(err)
+	notify.Send(notify.NewEvent(operation, opt.ClusterName, start, err))
+	return err
+}
+
+func (a *app) runAddon(action string, opt *api.AddonActionOption) error {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return api.NewValidationError("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
+	}
+	if err = a.checkOwner(t); err != nil {
+		return err
+	}
+	a.record.AddResource("tag", t.TagID)
+	metadata := api.ParseClusterMetadata(t.Description)
+	name := opt.Addon.Name
+	current, installed := metadata.Addons[name]
+	if action == addonInstall && installed {
+		return api.NewValidationError("Addon %s is already installed in cluster %s, upgrade it instead", name, opt.ClusterName)
+	}
+	if action != addonInstall && !installed {
+		return api.NewValidationError("Addon %s is not installed in cluster %s", name, opt.ClusterName)
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	if err = bootstrap.ValidateChecksums(opt.Checksums); err != nil {
+		return err
+	}
+	cluster := &api.CreateClusterOption{
+		ClusterName:       opt.ClusterName,
+		Zone:              opt.Zone,
+		KubernetesVersion: metadata.KubernetesVersion,
+		Checksums:         opt.Checksums,
+	}
+	b := a.newBootstrapper(a.sshRunner, cluster)
+	if cluster.KubernetesVersion == "" {
+		// clusters created before the version was saved
+		info, err := b.Discover(master)
+		if err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		cluster.KubernetesVersion = info.KubernetesVersion
+	}
+	if action == addonRemove {
+		ad, ctx, err := addon.NewContext(&api.AddonOption{Name: name, Version: current}, cluster)
+		if err != nil {
+			return err
+		}
+		if ad.RemoveHint != "" {
+			return api.NewValidationError("Addon %s cannot be removed by qks, %s", name, ad.RemoveHint)
+		}
+		if err = removeAddon(b, master, ad, ctx); err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		if err = a.updateMetadata(opt.ClusterName, func(m *api.ClusterMetadata) { delete(m.Addons, name) }); err != nil {
+			return err
+		}
+		output.Printf("addon %s is removed from cluster %s\n", name, opt.ClusterName)
+		return nil
+	}
+
+	inCluster := map[string]bool{name: true}
+	for n := range metadata.Addons {
+		inCluster[n] = true
+	}
+	if err = addon.ValidateAddon(&opt.Addon, cluster, inCluster); err != nil {
+		return err
+	}
+	ad, ctx, err := addon.NewContext(&opt.Addon, cluster)
+	if err != nil {
+		return err
+	}
+	if action == addonUpgrade && ctx.Version == current {
+		return api.NewValidationError("Addon %s of cluster %s is already %s", name, opt.ClusterName, current)
+	}
+	klog.Infof("Installing addon %s %s", name, ctx.Version)
+	if err = installAddon(b, master, ad, ctx); err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	if err = a.updateMetadata(opt.ClusterName, func(m *api.ClusterMetadata) { m.Addons[name] = ctx.Version }); err != nil {
+		return err
+	}
+	if action == addonUpgrade {
+		output.Printf("addon %s of cluster %s is upgraded from %s to %s\n", name, opt.ClusterName, current, ctx.Version)
+	} else {
+		output.Printf("addon %s %s is installed in cluster %s\n", name, ctx.Version, opt.ClusterName)
+	}
+	return nil
+}
+
+// removeAddon deletes in the reverse order of installAddon
+func removeAddon(b bootstrap.Interface, master *instance.Instance, a *addon.Addon, ctx *addon.Context) error {
+	if a.Manifests != nil {
+		if err := b.DeleteManifest(master, "addon-"+a.Name); err != nil {
+			return err
+		}
+	}
+	if a.Chart != nil {
+		if err := b.UninstallHelmRelease(master, a.Name, a.Chart.Namespace); err != nil {
+			return err
+		}
+	}
+	if a.URLs == nil {
+		return nil
+	}
+	urls := a.URLs(ctx)
+	for i := len(urls) - 1; i >= 0; i-- {
+		if output, err := b.Kubectl(master, "delete --ignore-not-found -f "+urls[i]); err != nil {
+			return fmt.Errorf("Failed to delete %s, output: %s", urls[i], string(output))
+		}
+	}
+	return nil
+}
+
+// updateMetadata changes the metadata saved in the tag of cluster
+func (a *app) updateMetadata(clusterName string, change func(*api.ClusterMetadata)) error {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(clusterName))
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("Cannot find the tag of cluster %s", clusterName)
+	}
+	metadata := api.ParseClusterMetadata(t.Description)
+	if metadata.Addons == nil {
+		metadata.Addons = make(map[string]string)
+	}
+	change(&metadata)
+	return a.tagService.SetDescription(t.TagID, metadata.String())
+}
+
+func (a *app) saveAddonVersions(clusterName string, installed map[string]string) {
+	if len(installed) == 0 {
+		return
+	}
+	err := a.updateMetadata(clusterName, func(m *api.ClusterMetadata) {
+		for name, version := range installed {
+			m.Addons[name] = version
+		}
+	})
+	if err != nil {
+		klog.Warningf("Failed to save versions of addons, err: %s", err.Error())
+	}
+}
@@ -0,0 +1,363 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/cloud"
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	"github.com/magicsong/yunify-k8s/pkg/eip"
+	"github.com/magicsong/yunify-k8s/pkg/hook"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/ratelimit"
+	"github.com/magicsong/yunify-k8s/pkg/resourcegroup"
+	"github.com/magicsong/yunify-k8s/pkg/securitygroup"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"github.com/magicsong/yunify-k8s/pkg/sshkey"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+	"github.com/magicsong/yunify-k8s/pkg/volume"
+	"k8s.io/klog"
+)
+
+const KubeconfigFilePath = bootstrap.KubeconfigFilePath
+
+type App interface {
+	RunCreate(*api.CreateClusterOption) error
+	RunCreateBatch([]api.CreateClusterOption, int) error
+	RunDelete(*api.DeleteClusterOption) error
+	RunCreateImage(*api.CreateImageOption) error
+	RunCaptureImage(*api.CaptureImageOption) error
+	RunCreateBundle(*api.CreateBundleOption) error
+	RunList(string) error
+	RunRename(*api.RenameClusterOption) error
+	RunProtect(*api.ProtectClusterOption) error
+	RunPrintJoin(*api.PrintJoinOption) error
+	RunKubectl(*api.KubectlOption) error
+	RunExportSpec(*api.ExportSpecOption) error
+	RunInventory(*api.InventoryOption) error
+	RunDiff(*api.DiffOption) error
+	RunCost(*api.CostOption) error
+	RunWatch(*api.WatchOption) error
+	RunUpgradePlan(*api.UpgradePlanOption) error
+	RunCordon(*api.CordonOption) error
+	RunUncordon(*api.CordonOption) error
+	RunPatch(*api.PatchOption) error
+	RunAddonInstall(*api.AddonActionOption) error
+	RunAddonUpgrade(*api.AddonActionOption) error
+	RunAddonRemove(*api.AddonActionOption) error
+}
+
+// Option customizes the app, it is mostly used when the app is embedded by other programs
+type Option func(*app)
+
+// WithImageService sets the image service used by RunCreateImage
+func WithImageService(i image.Interface) Option {
+	return func(a *app) {
+		a.imageService = i
+	}
+}
+
+// WithUserID sets the qingcloud user which owns the resources
+func WithUserID(userID string) Option {
+	return func(a *app) {
+		a.userID = userID
+	}
+}
+
+// WithPublicKeyFile sets the ssh public key uploaded to qingcloud, default is $HOME/.ssh/id_rsa.pub
+func WithPublicKeyFile(path string) Option {
+	return func(a *app) {
+		a.publicKeyFile = path
+	}
+}
+
+// WithTagPrefix sets the prefix of tags marking clusters, default is api.ClusterTagPrefix
+func WithTagPrefix(prefix string) Option {
+	return func(a *app) {
+		a.tagPrefix = prefix
+	}
+}
+
+// WithOwner makes the app only see and manage clusters created with the same owner
+func WithOwner(owner string) Option {
+	return func(a *app) {
+		a.owner = owner
+	}
+}
+
+// WithEIPService sets the service releasing eips of deleted clusters
+func WithEIPService(e eip.Interface) Option {
+	return func(a *app) {
+		a.eipService = e
+	}
+}
+
+// WithVolumeService sets the service deleting volumes of deleted clusters
+func WithVolumeService(v volume.Interface) Option {
+	return func(a *app) {
+		a.volumeService = v
+	}
+}
+
+// WithResourceGroupService sets the service putting created resources into resource groups
+func WithResourceGroupService(r resourcegroup.Interface) Option {
+	return func(a *app) {
+		a.resourceGroupService = r
+	}
+}
+
+// WithSecurityGroupService sets the service checking security groups given to clusters
+func WithSecurityGroupService(s securitygroup.Interface) Option {
+	return func(a *app) {
+		a.securityGroupService = s
+	}
+}
+
+// WithConsoleService sets the service giving console output of machines which cannot be reached by ssh
+func WithConsoleService(c console.Interface) Option {
+	return func(a *app) {
+		a.consoleService = c
+	}
+}
+
+// WithBillingService sets the service giving prices of cluster resources
+func WithBillingService(b billing.Interface) Option {
+	return func(a *app) {
+		a.billingService = b
+	}
+}
+
+// WithProvider makes the app use services of the given cloud instead of connecting to qingcloud
+func WithProvider(p cloud.Provider) Option {
+	return func(a *app) {
+		a.useProvider(p)
+		a.injected = true
+	}
+}
+
+// WithProviderOf makes the app use services of the cloud newProvider returns for a zone instead of connecting to qingcloud,
+// unlike WithProvider the services follow the zone, e.g. when a create falls back to another zone
+func WithProviderOf(newProvider func(zone string) cloud.Provider) Option {
+	return func(a *app) {
+		a.newProvider = newProvider
+	}
+}
+
+// WithEndpoint overrides the qingcloud api endpoint, for private cloud deployments
+func WithEndpoint(endpoint string, insecureSkipTLSVerify bool) Option {
+	return func(a *app) {
+		a.endpoint = endpoint
+		a.insecureSkipTLSVerify = insecureSkipTLSVerify
+	}
+}
+
+// WithCredentials gives the QingCloud access key directly, so the config file needs no plaintext secret
+func WithCredentials(accessKeyID, secretAccessKey string) Option {
+	return func(a *app) {
+		a.credentials = &accesskey.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}
+	}
+}
+
+// WithStdin sets where answers of confirmations are read from, default is os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(a *app) {
+		a.stdin = r
+	}
+}
+
+// WithSSHRunner sets how commands are run on machines
+func WithSSHRunner(r ssh.Runner) Option {
+	return func(a *app) {
+		a.sshRunner = r
+	}
+}
+
+// WithWindowsRunner replaces how commands run on windows nodes
+func WithWindowsRunner(r ssh.Runner) Option {
+	return func(a *app) {
+		a.windowsRunner = r
+	}
+}
+
+// WithBootstrapper replaces how kubernetes is brought up on created machines
+func WithBootstrapper(newBootstrapper func(ssh.Runner, *api.CreateClusterOption) bootstrap.Interface) Option {
+	return func(a *app) {
+		a.newBootstrapper = newBootstrapper
+	}
+}
+
+// WithHooks adds hooks run at lifecycle points of creating and deleting clusters, in order
+func WithHooks(hooks ...hook.Hook) Option {
+	return func(a *app) {
+		a.hooks = append(a.hooks, hooks...)
+	}
+}
+
+// WithAPIRateLimit bounds requests to qingcloud to perSecond on average, with bursts of as many in a second,
+// it is shared by clusters created by RunCreateBatch. It limits the services qks creates from the access key only,
+// services given by NewAppWithServices or WithProviderOf are limited by their embedder, e.g. with ratelimit.Transport
+func WithAPIRateLimit(perSecond float64) Option {
+	return func(a *app) {
+		a.limiter = ratelimit.New(perSecond, int(perSecond))
+	}
+}
+
+// NewApp returns an app which creates qingcloud services from the access key in configFile
+func NewApp(configFile string, opts ...Option) App {
+	a := &app{
+		configFile:    configFile,
+		publicKeyFile: ssh.GetDefaultPublicKeyFile(),
+		sshRunner:     ssh.WithTracing(ssh.NewDefaultRunner(), nil),
+		windowsRunner: ssh.WithTracing(ssh.NewWindowsRunner(), nil),
+		tagPrefix:     api.ClusterTagPrefix,
+		stdin:         os.Stdin,
+		kubectl:       localKubectl(),
+	}
+	a.newBootstrapper = bootstrap.NewKubeadmBootstrapper
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// NewAppWithServices returns an app using the given services instead of connecting to qingcloud
+func NewAppWithServices(instanceIface instance.Interface, sshKeyIface sshkey.Interface, tagService tag.Interface, runner ssh.Runner, opts ...Option) App {
+	a := &app{
+		instanceIface: instanceIface,
+		sshKeyIface:   sshKeyIface,
+		tagService:    tagService,
+		sshRunner:     runner,
+		windowsRunner: runner,
+		publicKeyFile: ssh.GetDefaultPublicKeyFile(),
+		tagPrefix:     api.ClusterTagPrefix,
+		stdin:         os.Stdin,
+		kubectl:       localKubectl(),
+		injected:      true,
+	}
+	a.newBootstrapper = bootstrap.NewKubeadmBootstrapper
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+type app struct {
+	instanceIface        instance.Interface
+	sshKeyIface          sshkey.Interface
+	tagService           tag.Interface
+	imageService         image.Interface
+	eipService           eip.Interface
+	volumeService        volume.Interface
+	resourceGroupService resourcegroup.Interface
+	securityGroupService securitygroup.Interface
+	consoleService       console.Interface
+	billingService       billing.Interface
+	sshRunner            ssh.Runner
+	windowsRunner        ssh.Runner
+	// newBootstrapper is called for each created cluster
+	newBootstrapper       func(ssh.Runner, *api.CreateClusterOption) bootstrap.Interface
+	configFile            string
+	publicKeyFile         string
+	userID                string
+	endpoint              string
+	insecureSkipTLSVerify bool
+	credentials           *accesskey.Credentials
+	tagPrefix             string
+	owner                 string
+	stdin                 io.Reader
+	record                *audit.Record
+	// deadline of the running operation, nil if it has none
+	deadline *deadline
+	// kubectl runs the local kubectl with a kubeconfig, it is nil if kubectl is not installed
+	kubectl func(kubeconfig string, args []string) error
+	hooks   []hook.Hook
+	// limiter is shared by all requests to qingcloud, nil means no limit
+	limiter *ratelimit.Limiter
+	// scope holds the root span of the running operation, nil is the default scope
+	scope *trace.Scope
+	// onSummary takes the summary of a created cluster instead of printing it, for batches which report them together
+	onSummary func(*ClusterSummary)
+	// newProvider given by WithProviderOf is used by init instead of qingcloud
+	newProvider func(zone string) cloud.Provider
+	// injected means services are given by NewAppWithServices and init must not replace them
+	injected bool
+}
+
+func (a *app) tagName(name string) string {
+	return fmt.Sprintf("%s%s", a.tagPrefix, name)
+}
+
+// checkOwner refuses to touch clusters of other owners
+func (a *app) checkOwner(t *tag.TagCluster) error {
+	if owner := api.OwnerOf(t.Description); owner != a.owner {
+		return api.NewValidationError("Cluster tag %s belongs to owner '%s', not '%s'", t.Name, owner, a.owner)
+	}
+	return nil
+}
+
+func (a *app) useProvider(p cloud.Provider) {
+	a.instanceIface = p.Instances()
+	a.sshKeyIface = p.KeyPairs()
+	a.tagService = p.Tags()
+	a.imageService = p.Images()
+	a.eipService = p.EIPs()
+	a.volumeService = p.Volumes()
+	a.resourceGroupService = p.ResourceGroups()
+	a.securityGroupService = p.SecurityGroups()
+	a.consoleService = p.Consoles()
+	a.billingService = p.Billing()
+	a.userID = p.UserID()
+}
+
+func (a *app) init(zone string) error {
+	if err := api.ValidateOwner(a.owner); err != nil {
+		return err
+	}
+	if err := api.ValidateTagPrefix(a.tagPrefix); err != nil {
+		return err
+	}
+	if a.injected {
+		return nil
+	}
+	if a.newProvider != nil {
+		a.useProvider(a.newProvider(zone))
+		return nil
+	}
+	keyHelper, err := a.newKeyHelper(zone, a.limiter)
+	if err != nil {
+		return err
+	}
+	a.useProvider(cloud.NewQingCloudProvider(keyHelper, zone, a.scope))
+	return nil
+}
+
+// newKeyHelper loads the config and keys of qingcloud, its service can be used in any zone.
+// It must not run in parallel, since the sdk sets its global logger while loading the config.
+// Keys are kept once loaded, so credential_process runs and asks for passphrases only once per process.
+func (a *app) newKeyHelper(zone string, limiter *ratelimit.Limiter) (*accesskey.QingCloudAccessKeyHelper, error) {
+	klog.Info("Init qingcloud service")
+	keyHelper := accesskey.NewQingCloudAccessKeyHelper(zone, a.configFile)
+	keyHelper.Endpoint = a.endpoint
+	keyHelper.InsecureSkipTLSVerify = a.insecureSkipTLSVerify
+	keyHelper.Credentials = a.credentials
+	keyHelper.Limiter = limiter
+	if err := keyHelper.Init(); err != nil {
+		return nil, err
+	}
+	qcConfig := keyHelper.GetConfig()
+	if a.credentials == nil {
+		a.credentials = &accesskey.Credentials{AccessKeyID: qcConfig.AccessKeyID, SecretAccessKey: qcConfig.SecretAccessKey}
+	}
+	if err := audit.SetCredentials(qcConfig.AccessKeyID, qcConfig.SecretAccessKey); err != nil {
+		return nil, err
+	}
+	return keyHelper, nil
+}
@@ -1,32 +1,1850 @@
 package app
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	billingfake "github.com/magicsong/yunify-k8s/pkg/billing/fake"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/cloud"
+	cloudfake "github.com/magicsong/yunify-k8s/pkg/cloud/fake"
+	consolefake "github.com/magicsong/yunify-k8s/pkg/console/fake"
+	eipfake "github.com/magicsong/yunify-k8s/pkg/eip/fake"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/hook"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	imagefake "github.com/magicsong/yunify-k8s/pkg/image/fake"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	instancefake "github.com/magicsong/yunify-k8s/pkg/instance/fake"
+	"github.com/magicsong/yunify-k8s/pkg/manifest"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	resourcegroupfake "github.com/magicsong/yunify-k8s/pkg/resourcegroup/fake"
+	securitygroupfake "github.com/magicsong/yunify-k8s/pkg/securitygroup/fake"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	sshfake "github.com/magicsong/yunify-k8s/pkg/ssh/fake"
+	sshkeyfake "github.com/magicsong/yunify-k8s/pkg/sshkey/fake"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	tagfake "github.com/magicsong/yunify-k8s/pkg/tag/fake"
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+	volumefake "github.com/magicsong/yunify-k8s/pkg/volume/fake"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
 )
 
 var _ = Describe("App", func() {
-	It("Should be able to extract kubeadm join", func() {
-		case1 := `
-		You should now deploy a pod network to the cluster.
-		Run "kubectl apply -f [podnetwork].yaml" with one of the options listed at:
-		  https://kubernetes.io/docs/concepts/cluster-administration/addons/
-		
-		You can now join any number of machines by running the following on each node
-		as root:
-		
-		  kubeadm join 192.168.97.4:6443 --token t2hu0m.iwosu060ldiaezuj --discovery-token-ca-cert-hash sha256:7c9c9419b645f772338246fba984adf033a06add4e8583549de05a3ad504cd89
-		
-		`
-		Expect(GetKubeJoinFromOutput(case1)).To(Equal("kubeadm join 192.168.97.4:6443 --token t2hu0m.iwosu060ldiaezuj --discovery-token-ca-cert-hash sha256:7c9c9419b645f772338246fba984adf033a06add4e8583549de05a3ad504cd89"))
-		case1 = `You should now deploy a pod network to the cluster.
-		Run "kubectl apply -f [podnetwork].yaml" with one of the options listed at:
-		  https://kubernetes.io/docs/concepts/cluster-administration/addons/
-		
-		Then you can join any number of worker nodes by running the following on each as root:
-		
-		kubeadm join 192.168.97.2:6443 --token ifqc4s.w1kemvf5d66v0qw1 \\
-			--discovery-token-ca-cert-hash sha256:912f6349636027c61d5d98dbfef2393106119e47093efa721afe9522f963df32`
-		Expect(GetKubeJoinFromOutput(case1)).To(Equal("kubeadm join 192.168.97.2:6443 --token ifqc4s.w1kemvf5d66v0qw1 --discovery-token-ca-cert-hash sha256:912f6349636027c61d5d98dbfef2393106119e47093efa721afe9522f963df32"))
+	var (
+		instances *instancefake.InstanceService
+		keys      *sshkeyfake.KeyPairService
+		tags      *tagfake.TagService
+		runner    *sshfake.Runner
+		toRun     App
+		logDir    string
+	)
+	const joinOutput = "You can now join any number of machines by running the following on each node\n\n  kubeadm join 192.168.0.3:6443 --token abc.def --discovery-token-ca-cert-hash sha256:123"
+
+	BeforeEach(func() {
+		instances = instancefake.NewInstanceService()
+		keys = sshkeyfake.NewKeyPairService()
+		tags = tagfake.NewTagService()
+		runner = sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, joinOutput, nil)
+		runner.RespondTo("get nodes -o jsonpath", fakeNodeList(), nil)
+		keyFile, err := ioutil.TempFile("", "id_rsa.pub")
+		Expect(err).ShouldNot(HaveOccurred())
+		keyFile.WriteString("ssh-rsa AAAA test")
+		keyFile.Close()
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(keyFile.Name()))
+		logDir, err = ioutil.TempDir("", "qks-logs")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(logDir)
+	})
+
+	// newCreateOption is a valid option of a cluster with a node, specs change the fields they test
+	newCreateOption := func() *api.CreateClusterOption {
+		return &api.CreateClusterOption{
+			ClusterName:       "test",
+			KubernetesVersion: "1.15.5",
+			Zone:              "ap2a",
+			NodeCount:         1,
+			BootstrapLogDir:   logDir,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+	}
+
+	It("Should create and delete a cluster", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.InstanceClass = 101
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(HaveLen(3))
+		Expect(keys.CallsOf("CreateSSHKey")).To(HaveLen(1))
+		Expect(keys.CallsOf("CreateSSHKey")[0].Args[0]).To(Equal(api.SSHKeyNameOf("test")))
+		cluster, err := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(cluster.Instances).To(HaveLen(3))
+		Expect(cluster.Resources[api.ResourceTypeKeyPair]).To(HaveLen(1))
+		master := cluster.Instances[0]
+		nodeIP := ""
+		for _, c := range runner.Calls() {
+			if c.Args[1] == "bash /root/scripts/qks/join.sh" {
+				nodeIP = c.Args[0].(string)
+			}
+		}
+		Expect(nodeIP).NotTo(BeEmpty())
+		script, _ := runner.File(nodeIP, "/root/scripts/qks/join.sh")
+		// nodes join the apiserver of master whatever address kubeadm prints
+		Expect(script).To(ContainSubstring("kubeadm join " + scriptRunOn(runner, bootstrap.InitScript) + ":6443 --token abc.def --discovery-token-ca-cert-hash sha256:123"))
+		logs, err := ioutil.ReadDir(logDir)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(logs).To(HaveLen(7))
+		masterInstance, _ := instances.GetInstance(master)
+		Expect(runner.CommandsOn(masterInstance.IP)).To(ContainElement("bash /root/scripts/qks/network-check.sh"))
+
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(BeEmpty())
+		Expect(instances.CallsOf("DeleteInstances")[0].Args[0]).To(ContainElement(master))
+		Expect(keys.CallsOf("DeleteSSHKey")).To(HaveLen(1))
+	})
+
+	It("Should report partial success when nodes fail to join", func() {
+		runner.RespondTo(bootstrap.JoinScript, "join failed", fmt.Errorf("exit status 1"))
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(instances.Instances()).To(HaveLen(3))
+	})
+
+	It("Should pre-pull images on joined nodes only", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.PrePullImages = []string{"nginx:1.17"}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		pulled := 0
+		for _, c := range runner.Calls() {
+			if c.Args[1] == "bash /root/scripts/qks/pull.sh" {
+				pulled++
+			}
+		}
+		Expect(pulled).To(Equal(2))
+
+		opt.ClusterName = "broken"
+		opt.PrePullImages = []string{"nginx:1.17; rm -rf /"}
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should install addons on master once nodes join", func() {
+		opt := newCreateOption()
+		opt.Addons = []api.AddonOption{{Name: addon.PodSecurity}}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		manifest, ok := runner.File(master.IP, bootstrap.RemoteManifestsLocation+"addon-pod-security.yaml")
+		Expect(ok).To(BeTrue())
+		Expect(manifest).To(ContainSubstring("kind: NetworkPolicy"))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f " + bootstrap.RemoteManifestsLocation + "addon-pod-security.yaml"))
+
+		runner.RespondTo("addon-pod-security.yaml", "connection refused", fmt.Errorf("exit status 1"))
+		opt.ClusterName = "test2"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodePartialSuccess))
+		opt.ClusterName = "test3"
+		opt.Addons = []api.AddonOption{{Name: addon.PodSecurity, Params: map[string]string{"level": "strict"}}}
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should install chart addons by helm on master", func() {
+		opt := newCreateOption()
+		opt.Addons = []api.AddonOption{{Name: addon.Logging, Params: map[string]string{"retention": "336h"}}}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		values, ok := runner.File(master.IP, bootstrap.RemoteManifestsLocation+"logging-values.yaml")
+		Expect(ok).To(BeTrue())
+		Expect(values).To(ContainSubstring("retention_period: 336h"))
+		script, _ := runner.File(master.IP, "/root/scripts/qks/helm.sh")
+		Expect(script).To(ContainSubstring("helm upgrade --install logging grafana/loki-stack --version 2.1.2 -n logging"))
+	})
+
+	It("Should track versions of addons through their lifecycle", func() {
+		opt := newCreateOption()
+		opt.Addons = []api.AddonOption{{Name: addon.CertManager}}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		addons := func() map[string]string {
+			cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+			return api.ParseClusterMetadata(cluster.Description).Addons
+		}
+		Expect(addons()).To(Equal(map[string]string{addon.CertManager: "v0.15.2"}))
+
+		action := func(name, version string) *api.AddonActionOption {
+			return &api.AddonActionOption{ClusterName: "test", Zone: "ap2a", Addon: api.AddonOption{Name: name, Version: version}}
+		}
+		Expect(api.ExitCode(toRun.RunAddonInstall(action(addon.CertManager, "")))).To(Equal(api.ExitCodeValidation))
+		Expect(api.ExitCode(toRun.RunAddonUpgrade(action(addon.CertManager, "v0.15.2")))).To(Equal(api.ExitCodeValidation))
+		Expect(api.ExitCode(toRun.RunAddonRemove(action(addon.PodSecurity, "")))).To(Equal(api.ExitCodeValidation))
+		Expect(api.ExitCode(toRun.RunAddonInstall(action(addon.Monitoring, "")))).To(Equal(api.ExitCodeValidation))
+
+		Expect(toRun.RunAddonUpgrade(action(addon.CertManager, "v1.0.4"))).ShouldNot(HaveOccurred())
+		Expect(toRun.RunAddonInstall(action(addon.PodSecurity, ""))).ShouldNot(HaveOccurred())
+		Expect(addons()).To(Equal(map[string]string{addon.CertManager: "v1.0.4", addon.PodSecurity: ""}))
+		Expect(api.ExitCode(toRun.RunAddonRemove(action(addon.PodSecurity, "")))).To(Equal(api.ExitCodeValidation))
+
+		Expect(toRun.RunAddonRemove(action(addon.CertManager, ""))).ShouldNot(HaveOccurred())
+		Expect(addons()).To(Equal(map[string]string{addon.PodSecurity: ""}))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		commands := runner.CommandsOn(master.IP)
+		Expect(commands).To(ContainElement(ContainSubstring("apply -f https://github.com/jetstack/cert-manager/releases/download/v1.0.4/cert-manager.yaml")))
+		Expect(commands).To(ContainElement(ContainSubstring("delete --ignore-not-found -f https://github.com/jetstack/cert-manager/releases/download/v1.0.4/cert-manager.yaml")))
+		Expect(commands).To(ContainElement(ContainSubstring("delete --ignore-not-found -f /root/scripts/qks/manifests/addon-cert-manager.yaml")))
+	})
+
+	It("Should install KubeSphere last and report its console", func() {
+		runner.RespondTo("deploy/ks-installer", "#####################################################\n###              Welcome to KubeSphere!           ###\n", nil)
+		opt := newCreateOption()
+		opt.KubeSphere = addon.KubeSphereDefaultVersion
+		opt.Addons = []api.AddonOption{{Name: addon.PodSecurity}}
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.Addons[1].Name).To(Equal(addon.KubeSphere))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(ContainSubstring("apply -f https://github.com/kubesphere/ks-installer/releases/download/v3.0.0/cluster-configuration.yaml")))
+		Expect(buf.String()).To(ContainSubstring(fmt.Sprintf("KubeSphere console: http://%s:30880 (admin / P@88w0rd)", master.IP)))
+	})
+
+	It("Should keep etcd of master on a dedicated volume", func() {
+		volumes := volumefake.NewVolumeService()
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithVolumeService(volumes))
+		opt := newCreateOption()
+		opt.InstanceClass = 101
+		opt.EtcdVolumeSize = 15
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		opt.EtcdVolumeSize = 20
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(volumes.CallsOf("CreateVolume")[0].Args).To(Equal([]interface{}{"qks-test-etcd", 20, 200}))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster.Resources[api.ResourceTypeVolume]).To(Equal([]string{"vol-1"}))
+		Expect(volumes.Attachments["vol-1"]).To(Equal(cluster.Instances[0]))
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		script, _ := runner.File(master.IP, "/root/scripts/qks/"+bootstrap.EtcdScript)
+		Expect(script).To(ContainSubstring("device=/dev/vdc\n"))
+		Expect(script).To(ContainSubstring("/var/lib/etcd ext4 defaults,noatime,nofail 0 2"))
+		commands := strings.Join(runner.CommandsOn(master.IP), "\n")
+		Expect(strings.Index(commands, bootstrap.EtcdScript)).To(BeNumerically("<", strings.Index(commands, bootstrap.InitScript)))
+
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(volumes.Volumes).To(BeEmpty())
+	})
+
+	It("Should expose ingress with an eip of the cluster", func() {
+		eips := eipfake.NewEIPService()
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithEIPService(eips))
+		opt := newCreateOption()
+		opt.ExposeIngress = true
+		opt.Addons = []api.AddonOption{{Name: addon.CertManager, Params: map[string]string{"acmeEmail": "ops@example.com"}}}
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(eips.CallsOf("AllocateEIP")[0].Args).To(Equal([]interface{}{"qks-test-ingress", api.DefaultIngressBandwidth}))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster.Resources[api.ResourceTypeEIP]).To(Equal([]string{"eip-1"}))
+		Expect(eips.Associations["eip-1"]).To(Equal(cluster.Instances[1]))
+		Expect(opt.Addons[0].Name).To(Equal(addon.IngressNginx))
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		manifest, _ := runner.File(master.IP, bootstrap.RemoteManifestsLocation+"addon-ingress-nginx.yaml")
+		Expect(manifest).To(ContainSubstring("--publish-status-address=139.198.0.1"))
+		Expect(buf.String()).To(ContainSubstring("Ingress: http://139.198.0.1"))
+		commands := runner.CommandsOn(master.IP)
+		Expect(commands).To(ContainElement(ContainSubstring("apply -f https://github.com/jetstack/cert-manager/releases/download/v0.15.2/cert-manager.yaml")))
+		Expect(commands).To(ContainElement(ContainSubstring("wait --for=condition=Available deployment --all -n cert-manager")))
+		manifest, _ = runner.File(master.IP, bootstrap.RemoteManifestsLocation+"addon-cert-manager.yaml")
+		Expect(manifest).To(ContainSubstring("email: ops@example.com"))
+
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(eips.EIPs).To(BeEmpty())
+	})
+
+	It("Should classify failures of cloud api", func() {
+		instances.FailOn("CreateInstances", api.NewCloudAPIError(api.RetCodeQuotaNotEnough, "quota"))
+		err := toRun.RunCreate(newCreateOption())
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeQuota))
+	})
+
+	It("Should copy kubeconfig to local without overwriting existing one", func() {
+		runner.RespondTo("cat "+KubeconfigFilePath, "apiVersion: v1", nil)
+		opt := newCreateOption()
+		opt.ScpKubeConfigToLocal = true
+		opt.LocalKubeConfigPath = logDir + "/kube/config"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		content, err := ioutil.ReadFile(opt.LocalKubeConfigPath)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(Equal("apiVersion: v1"))
+
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(HaveLen(2))
+		opt.OverwriteKubeConfig = true
+		opt.Adopt = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+	})
+
+	It("Should not delete clusters of other owners", func() {
+		opt := newCreateOption()
+		teamA := NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithOwner("team-a"))
+		Expect(teamA.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, err := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(api.OwnerOf(cluster.Description)).To(Equal("team-a"))
+
+		teamB := NewAppWithServices(instances, keys, tags, runner, WithOwner("team-b"))
+		err = teamB.RunDelete(&api.DeleteClusterOption{ClusterName: "test"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(HaveLen(2))
+		Expect(teamA.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+
+		// such owners would be read back as other metadata
+		forged := NewAppWithServices(instances, keys, tags, runner, WithOwner("team-b;qks-protected=true"))
+		err = forged.RunCreate(newCreateOption())
+		Expect(err).To(MatchError(ContainSubstring("cannot contain ';' or '='")))
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		forged = NewAppWithServices(instances, keys, tags, runner, WithTagPrefix("K8S=Cluster-"))
+		Expect(api.ExitCode(forged.RunDelete(&api.DeleteClusterOption{ClusterName: "test"}))).To(Equal(api.ExitCodeValidation))
+		Expect(tags.CallsOf("CreateTag")).To(HaveLen(1))
+	})
+
+	It("Should rename a cluster", func() {
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(toRun.RunRename(&api.RenameClusterOption{ClusterName: "test", NewName: "renamed"})).ShouldNot(HaveOccurred())
+		old, err := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(old).To(BeNil())
+		cluster, err := tags.GetTagClusterByName(api.ClusterTagPrefix + "renamed")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(cluster.Instances).To(HaveLen(2))
+		Expect(cluster.Resources[api.ResourceTypeKeyPair]).To(HaveLen(1))
+		for _, id := range cluster.Instances {
+			ins, _ := instances.GetInstance(id)
+			Expect(ins.Name).To(HavePrefix(instance.ClusterNamePrefix + "-renamed-"))
+		}
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "renamed", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(keys.CallsOf("DeleteSSHKey")).To(HaveLen(1))
+	})
+
+	It("Should fail the create if network of the cluster is broken", func() {
+		runner.RespondTo(bootstrap.NetworkCheckScript, "pod on node-2 cannot reach pod 10.233.1.5 on node-1", fmt.Errorf("exit status 1"))
+		opt := newCreateOption()
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeBootstrap))
+		Expect(err.Error()).To(ContainSubstring("cannot reach pod 10.233.1.5"))
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+
+		opt.SkipNetworkCheck = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+	})
+
+	It("Should report machines which never registered as nodes", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		runner.RespondTo("get nodes -o jsonpath", "master 192.168.0.2\nnode-1 192.168.0.3\n", nil)
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(err.Error()).To(ContainSubstring("[192.168.0.4] (logs: " + logDir))
+		Expect(runner.CommandsOn("192.168.0.2")).NotTo(ContainElement(ContainSubstring("label node node-2")))
+	})
+
+	It("Should stop the create once it runs out of its timeout", func() {
+		toRun.(*app).newBootstrapper = func(r ssh.Runner, opt *api.CreateClusterOption) bootstrap.Interface {
+			return &slowInitBootstrapper{Interface: bootstrap.NewKubeadmBootstrapper(r, opt), delay: 200 * time.Millisecond}
+		}
+		opt := newCreateOption()
+		opt.Timeout = 100 * time.Millisecond
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeTimeout))
+		// the timeout is classified, go 1.12 has no errors.As
+		timeout, ok := err.(interface{ Unwrap() error }).Unwrap().(*TimeoutError)
+		Expect(ok).To(BeTrue())
+		Expect(timeout.Phase).To(Equal("cni"))
+		Expect(timeout.Completed).To(Equal([]string{"images", "tag", "keypair", "instances", "bootstrap"}))
+		Expect(timeout.Resources["instance"]).To(HaveLen(2))
+		Expect(err.Error()).To(ContainSubstring("completed phases: images, tag, keypair, instances, bootstrap"))
+		Expect(instances.CallsOf("DeleteInstances")).To(BeEmpty())
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+
+		opt.DeleteOnTimeout = true
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeTimeout))
+		Expect(instances.CallsOf("DeleteInstances")).To(HaveLen(2))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster).To(BeNil())
+
+		existing := *opt
+		existing.Timeout, existing.DeleteOnTimeout, existing.Protect = 0, false, true
+		plain := NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile))
+		Expect(plain.RunCreate(&existing)).ShouldNot(HaveOccurred())
+		before, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		opt.Adopt = true
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeTimeout))
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster).NotTo(BeNil())
+		Expect(instances.Instances()).To(HaveLen(len(before.Instances)))
+		for _, id := range before.Instances {
+			Expect(instances.GetInstance(id)).NotTo(BeNil())
+		}
+		for _, call := range keys.CallsOf("DeleteSSHKey") {
+			Expect(before.Resources[api.ResourceTypeKeyPair]).NotTo(ContainElement(call.Args[0]))
+		}
+
+		opt.Timeout = 0
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should create namespaces of teams once nodes join", func() {
+		opt := newCreateOption()
+		opt.Teams = []api.TeamOption{{Name: "payments", Namespace: "Payments", Users: []string{"alice"}}}
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		Expect(instances.CallsOf("RunInstances")).To(BeEmpty())
+
+		opt.Teams[0].Namespace = ""
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		for _, id := range cluster.Instances {
+			ins, _ := instances.GetInstance(id)
+			if ins.Name != instance.GeneateName("test", api.RoleMaster) {
+				continue
+			}
+			manifest, ok := runner.File(ins.IP, bootstrap.RemoteManifestsLocation+bootstrap.TeamsManifestName+".yaml")
+			Expect(ok).To(BeTrue())
+			Expect(manifest).To(ContainSubstring("kind: RoleBinding"))
+			Expect(runner.CommandsOn(ins.IP)).To(ContainElement(ContainSubstring("apply -f " + bootstrap.RemoteManifestsLocation + bootstrap.TeamsManifestName + ".yaml")))
+		}
+	})
+
+	It("Should build a bundle on a temporary machine and download it verified", func() {
+		content := "tarball of images and packages"
+		sum := sha256.Sum256([]byte(content))
+		remote := "/root/qks-bundle-1.15.5-amd64.tar.gz"
+		runner.RespondTo(bootstrap.BundleScript, hex.EncodeToString(sum[:])+"  "+remote+"\n", nil)
+		runner.RespondTo(remote, content, nil)
+		opt := &api.CreateBundleOption{
+			KubernetesVersion: "1.15.5",
+			Zone:              "ap2a",
+			VxNet:             "vxnet-test",
+			Output:            filepath.Join(logDir, "bundle.tar.gz"),
+			BootstrapLogDir:   logDir,
+		}
+		Expect(toRun.RunCreateBundle(opt)).ShouldNot(HaveOccurred())
+		bundle, err := ioutil.ReadFile(opt.Output)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(bundle)).To(Equal(content))
+		Expect(instances.CallsOf("DeleteInstances")).To(HaveLen(1))
+
+		// a bundle corrupted on the way is not left behind
+		runner.RespondTo(remote, "truncated", nil)
+		opt.Output = filepath.Join(logDir, "corrupted.tar.gz")
+		Expect(toRun.RunCreateBundle(opt)).To(MatchError(ContainSubstring("Checksum of the downloaded")))
+		_, err = os.Stat(opt.Output)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		_, err = os.Stat(opt.Output + ".part")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(instances.CallsOf("DeleteInstances")).To(HaveLen(2))
+	})
+
+	It("Should refuse downloads without checksums before creating machines if they are required", func() {
+		url := "https://github.com/jetstack/cert-manager/releases/download/v0.15.2/cert-manager.yaml"
+		opt := newCreateOption()
+		opt.Addons = []api.AddonOption{{Name: addon.CertManager}}
+		opt.RequireChecksums = true
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring(url))
+		Expect(instances.CallsOf("RunInstances")).To(BeEmpty())
+
+		opt.Checksums = map[string]string{url: strings.Repeat("1a", 32)}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		found := false
+		for _, c := range runner.Calls() {
+			found = found || (c.Method == "RunAndGetOutput" && strings.Contains(c.Args[1].(string), "curl -fsSL "+url+" -o "))
+		}
+		Expect(found).To(BeTrue())
+	})
+
+	It("Should run kubectl with the local kubeconfig or on master", func() {
+		home := os.Getenv("HOME")
+		os.Setenv("HOME", logDir)
+		defer os.Setenv("HOME", home)
+		buf := new(bytes.Buffer)
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		var kubeconfigs []string
+		toRun.(*app).kubectl = func(kubeconfig string, args []string) error {
+			kubeconfigs = append(kubeconfigs, kubeconfig+" "+strings.Join(args, " "))
+			return nil
+		}
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		master := scriptRunOn(runner, bootstrap.InitScript)
+		// the apiserver in the fetched kubeconfig is not reachable from tests
+		runner.RespondTo("cat /etc/kubernetes/admin.conf", "apiVersion: v1\nclusters:\n- cluster:\n    server: https://127.0.0.1:1\n  name: kubernetes\n", nil)
+		runner.RespondTo("'get' 'pods'", "NAME READY\ncoredns-1 1/1\n", nil)
+		kubectlOpt := &api.KubectlOption{ClusterName: "test", Args: []string{"get", "pods", "-o", "jsonpath='{.items}'"}}
+		Expect(toRun.RunKubectl(kubectlOpt)).ShouldNot(HaveOccurred())
+		Expect(kubeconfigs).To(BeEmpty())
+		Expect(runner.CommandsOn(master)).To(ContainElement(`kubectl --kubeconfig=/etc/kubernetes/admin.conf 'get' 'pods' '-o' 'jsonpath='\''{.items}'\'''`))
+		Expect(buf.String()).To(ContainSubstring("coredns-1 1/1"))
+
+		local := filepath.Join(logDir, ".kube", "yunify-test.conf")
+		Expect(os.MkdirAll(filepath.Dir(local), 0700)).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(local, []byte("apiVersion: v1\n"), 0600)).ShouldNot(HaveOccurred())
+		Expect(toRun.RunKubectl(&api.KubectlOption{ClusterName: "test", Args: []string{"get", "nodes"}})).ShouldNot(HaveOccurred())
+		Expect(kubeconfigs).To(Equal([]string{local + " get nodes"}))
+		kubectlOpt.OnMaster = true
+		Expect(toRun.RunKubectl(kubectlOpt)).ShouldNot(HaveOccurred())
+		Expect(kubeconfigs).To(HaveLen(1))
+	})
+
+	It("Should remove the local kubeconfig and its merged entries on delete", func() {
+		home := os.Getenv("HOME")
+		os.Setenv("HOME", logDir)
+		defer os.Setenv("HOME", home)
+		admin := "apiVersion: v1\nclusters:\n- cluster:\n    certificate-authority-data: Q0E=\n    server: https://192.168.0.3:6443\n  name: kubernetes\n" +
+			"contexts:\n- context:\n    cluster: kubernetes\n    user: kubernetes-admin\n  name: kubernetes-admin@kubernetes\n" +
+			"current-context: kubernetes-admin@kubernetes\nkind: Config\nusers:\n- name: kubernetes-admin\n  user:\n    token: abc\n"
+		runner.RespondTo("cat /etc/kubernetes/admin.conf", admin, nil)
+		opt := newCreateOption()
+		opt.ScpKubeConfigToLocal = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		standalone := filepath.Join(logDir, ".kube", "yunify-test.conf")
+		Expect(standalone).To(BeAnExistingFile())
+		merged := filepath.Join(logDir, ".kube", "config")
+		other := "- cluster:\n    server: https://10.0.0.1:6443\n  name: other\n"
+		Expect(ioutil.WriteFile(merged, []byte(strings.Replace(admin, "clusters:\n", "clusters:\n"+other, 1)), 0600)).To(Succeed())
+
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(standalone).NotTo(BeAnExistingFile())
+		content, err := ioutil.ReadFile(merged)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("name: other"))
+		Expect(string(content)).NotTo(ContainSubstring("kubernetes-admin"))
+	})
+
+	It("Should prune the first kubeconfig of $KUBECONFIG in place of ~/.kube/config", func() {
+		home := os.Getenv("HOME")
+		os.Setenv("HOME", logDir)
+		defer os.Setenv("HOME", home)
+		kubeconfig, set := os.LookupEnv("KUBECONFIG")
+		defer func() {
+			os.Unsetenv("KUBECONFIG")
+			if set {
+				os.Setenv("KUBECONFIG", kubeconfig)
+			}
+		}()
+		admin := "apiVersion: v1\nclusters:\n- cluster:\n    server: https://192.168.0.3:6443\n  name: kubernetes\n" +
+			"contexts:\n- context:\n    cluster: kubernetes\n    user: kubernetes-admin\n  name: kubernetes-admin@kubernetes\n" +
+			"current-context: kubernetes-admin@kubernetes\nkind: Config\nusers:\n- name: kubernetes-admin\n  user:\n    token: abc\n"
+		runner.RespondTo("cat /etc/kubernetes/admin.conf", admin, nil)
+		opt := newCreateOption()
+		opt.ScpKubeConfigToLocal = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		dir := filepath.Join(logDir, "kubeconfigs")
+		Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+		first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+		Expect(ioutil.WriteFile(first, []byte(admin), 0640)).To(Succeed())
+		Expect(ioutil.WriteFile(second, []byte(admin), 0600)).To(Succeed())
+		os.Setenv("KUBECONFIG", first+string(filepath.ListSeparator)+second)
+
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		content, err := ioutil.ReadFile(first)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).NotTo(ContainSubstring("kubernetes-admin"))
+		info, err := os.Stat(first)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		content, err = ioutil.ReadFile(second)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(Equal(admin))
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+
+		// a $KUBECONFIG of the cluster itself is only deleted
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		standalone := filepath.Join(logDir, ".kube", "yunify-test.conf")
+		os.Setenv("KUBECONFIG", standalone)
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(standalone).NotTo(BeAnExistingFile())
+	})
+
+	It("Should ask for confirmation before deleting", func() {
+		opt := newCreateOption()
+		opt.ConfirmDeleteByName = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		keyFile := toRun.(*app).publicKeyFile
+		forced := NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(keyFile), WithStdin(strings.NewReader("y\n")))
+		err := forced.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(HaveLen(2))
+
+		typed := NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(keyFile), WithStdin(strings.NewReader("test\n")))
+		Expect(typed.RunDelete(&api.DeleteClusterOption{ClusterName: "test"})).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(BeEmpty())
+
+		opt.ConfirmDeleteByName = false
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		err = NewAppWithServices(instances, keys, tags, runner, WithStdin(strings.NewReader("n\n"))).RunDelete(&api.DeleteClusterOption{ClusterName: "test"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(HaveLen(2))
+		yes := NewAppWithServices(instances, keys, tags, runner, WithStdin(strings.NewReader("yes\n")))
+		Expect(yes.RunDelete(&api.DeleteClusterOption{ClusterName: "test"})).ShouldNot(HaveOccurred())
+	})
+
+	It("Should refuse to delete protected clusters", func() {
+		opt := newCreateOption()
+		opt.Protect = true
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		err := toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(HaveLen(2))
+		Expect(toRun.RunProtect(&api.ProtectClusterOption{ClusterName: "test", Unprotect: true})).ShouldNot(HaveOccurred())
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(BeEmpty())
+	})
+
+	It("Should keep resources specified when deleting", func() {
+		eips := eipfake.NewEIPService()
+		volumes := volumefake.NewVolumeService()
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithEIPService(eips), WithVolumeService(volumes))
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		tags.AttachResources(cluster.TagID, api.ResourceTypeEIP, "eip-1")
+		tags.AttachResources(cluster.TagID, api.ResourceTypeVolume, "vol-1", "vol-2")
+		tags.AttachResources(cluster.TagID, api.ResourceTypeKeyPair, "kp-1")
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true, KeepVolumes: true, KeepSSHKey: true})).ShouldNot(HaveOccurred())
+		Expect(eips.CallsOf("ReleaseEIPs")).To(HaveLen(1))
+		Expect(eips.CallsOf("ReleaseEIPs")[0].Args[0]).To(Equal([]string{"eip-1"}))
+		Expect(volumes.Calls()).To(BeEmpty())
+		Expect(keys.CallsOf("DeleteSSHKey")).To(BeEmpty())
+	})
+
+	It("Should create and delete a cluster with a cloud provider", func() {
+		provider := cloudfake.NewProvider()
+		toRun = NewApp("", WithProvider(provider), WithSSHRunner(runner), WithPublicKeyFile(toRun.(*app).publicKeyFile))
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(provider.InstanceService.Instances()).To(HaveLen(2))
+		Expect(provider.ImageService.CallsOf("GetImageStatus")).To(HaveLen(1))
+		Expect(instances.Calls()).To(BeEmpty())
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(provider.InstanceService.Instances()).To(BeEmpty())
+	})
+
+	It("Should export the spec of a cluster", func() {
+		opt := newCreateOption()
+		opt.VxNet = "vxnet-test"
+		opt.NodeCount = 2
+		opt.MasterInstanceType = "c2m4"
+		opt.NodeInstanceType = "c4m8"
+		opt.Protect = true
+		opt.CNIName = api.FlannelCNI
+		opt.PodNetWorkCIDR = "10.244.0.0/16"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		specFile := filepath.Join(logDir, "spec.yaml")
+		Expect(toRun.RunExportSpec(&api.ExportSpecOption{ClusterName: "test", Zone: "ap2a", OutputPath: specFile})).ShouldNot(HaveOccurred())
+		content, err := ioutil.ReadFile(specFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		spec := &api.CreateClusterOption{}
+		Expect(yaml.UnmarshalStrict(content, spec)).ShouldNot(HaveOccurred())
+		Expect(spec.KubernetesVersion).To(Equal("1.15.5"))
+		Expect(spec.NodeCount).To(Equal(2))
+		Expect(spec.VxNet).To(Equal("vxnet-test"))
+		Expect(spec.MasterInstanceType).To(Equal("c2m4"))
+		Expect(spec.NodeInstanceType).To(Equal("c4m8"))
+		Expect(spec.Protect).To(BeTrue())
+		Expect(spec.NetworkOption).To(Equal(opt.NetworkOption))
+		Expect(runner.CallsOf("RunAndGetOutput")).NotTo(ContainElement(WithTransform(func(c recorder.Call) string { return c.Args[1].(string) }, ContainSubstring("kubeadm version"))))
+	})
+
+	It("Should report drift between a spec and the cluster", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.MasterInstanceType = "c2m4"
+		opt.NodeInstanceType = "c4m8"
+		specFile := filepath.Join(logDir, "spec.yaml")
+		content, err := yaml.Marshal(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(specFile, content, 0644)).ShouldNot(HaveOccurred())
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		calls := len(instances.Calls())
+		Expect(toRun.RunDiff(&api.DiffOption{SpecPath: specFile})).ShouldNot(HaveOccurred())
+
+		opt.NodeCount = 3
+		opt.NodeInstanceType = "c2m4"
+		opt.CNIName = api.FlannelCNI
+		content, err = yaml.Marshal(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(specFile, content, 0644)).ShouldNot(HaveOccurred())
+		err = toRun.RunDiff(&api.DiffOption{SpecPath: specFile})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeDrift))
+		Expect(err.Error()).To(ContainSubstring("in 4 fields"))
+		for _, c := range instances.Calls()[calls:] {
+			Expect(c.Method).To(HavePrefix("Get"))
+		}
+	})
+
+	It("Should print states of instances and nodes when watching", func() {
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(instances.StopInstances(cluster.Instances[1])).To(Succeed())
+		runner.RespondTo(".status.conditions", "node2 192.168.0.2 Ready=True,\nnode3 192.168.0.3 Ready=False,\n", nil)
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunWatch(&api.WatchOption{ClusterName: "test", Zone: "ap2a", Interval: time.Millisecond, Rounds: 2})).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("instance " + cluster.Instances[0] + " is running"))
+		Expect(buf.String()).To(ContainSubstring("instance " + cluster.Instances[1] + " is stopped"))
+		Expect(buf.String()).To(ContainSubstring("apiserver is reachable"))
+		Expect(buf.String()).To(ContainSubstring("node node3 is NotReady"))
+		// nothing changes in the second poll
+		Expect(strings.Split(strings.TrimSpace(buf.String()), "\n")).To(HaveLen(5))
+
+		err := toRun.RunWatch(&api.WatchOption{ClusterName: "test", Zone: "ap2a"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should replace broken nodes when healing, no more than allowed per hour", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		stopped, _ := instances.GetInstance(cluster.Instances[1])
+		notReady, _ := instances.GetInstance(cluster.Instances[2])
+		Expect(instances.StopInstances(stopped.ID)).To(Succeed())
+		runner.RespondTo(".status.conditions", fmt.Sprintf("master %s Ready=True,\nnot-ready %s Ready=False,\n", master.IP, notReady.IP), nil)
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123", nil)
+		created := len(instances.CallsOf("CreateInstances"))
+		auditFile := filepath.Join(logDir, "audit.log")
+		Expect(audit.Configure(auditFile)).To(Succeed())
+		defer audit.Configure("")
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunWatch(&api.WatchOption{
+			ClusterName:            "test",
+			Zone:                   "ap2a",
+			Interval:               time.Millisecond * 5,
+			Rounds:                 3,
+			Heal:                   true,
+			NotReadyThreshold:      time.Millisecond,
+			MaxReplacementsPerHour: 2,
+			BootstrapLogDir:        logDir,
+		})).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("replaced instance " + stopped.ID + " (instance is stopped)"))
+		Expect(buf.String()).To(MatchRegexp("replaced instance " + notReady.ID + ` \(node is not ready for \w+\)`))
+		// the first replacement is not ready either, but the budget of the hour is used up
+		Expect(instances.CallsOf("CreateInstances")).To(HaveLen(created + 2))
+		Expect(instances.IsStopped(stopped.ID)).To(BeFalse())
+		_, err := instances.GetInstance(stopped.ID)
+		Expect(err).To(HaveOccurred())
+		_, err = instances.GetInstance(notReady.ID)
+		Expect(err).To(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf delete node not-ready"))
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster.Instances).To(HaveLen(5))
+		_, err = instances.GetInstance(master.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		records := auditRecords(auditFile)
+		Expect(records).To(HaveLen(2))
+		for i, old := range []string{stopped.ID, notReady.ID} {
+			Expect(records[i].Operation).To(Equal("heal"))
+			Expect(records[i].Cluster).To(Equal("test"))
+			Expect(records[i].Result).To(Equal("success"))
+			Expect(records[i].Resources["instance"]).To(HaveLen(2))
+			Expect(records[i].Resources["instance"]).To(ContainElement(old))
+			Expect(cluster.Instances).To(ContainElement(records[i].Resources["instance"][0]))
+		}
+
+		err = toRun.RunWatch(&api.WatchOption{ClusterName: "test", Zone: "ap2a", Interval: time.Second, Heal: true})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should scale nodes to the count of the matching profile", func() {
+		opt := newCreateOption()
+		opt.NodeInstanceType = "c4m8"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		runner.RespondTo(".status.conditions", "", nil)
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123", nil)
+		watch := &api.WatchOption{ClusterName: "test", Zone: "ap2a", Interval: time.Millisecond, Rounds: 1, BootstrapLogDir: logDir}
+		auditFile := filepath.Join(logDir, "audit.log")
+		Expect(audit.Configure(auditFile)).To(Succeed())
+		defer audit.Configure("")
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		watch.ScalingProfiles = []string{"*=3"}
+		Expect(toRun.RunWatch(watch)).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("scaled nodes from 1 to 3 by profile '*=3'"))
+		calls := instances.CallsOf("CreateInstances")
+		last := calls[len(calls)-1].Args[0].(*instance.CreateInstancesOption)
+		Expect(last.Count).To(Equal(2))
+		Expect(last.Role).To(Equal(api.RoleNode))
+		Expect(last.InstanceType).To(Equal("c4m8"))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster.Instances).To(HaveLen(4))
+		master, _ := instances.GetInstance(cluster.Instances[0])
+
+		var b strings.Builder
+		for _, id := range cluster.Instances[1:] {
+			ins, _ := instances.GetInstance(id)
+			fmt.Fprintf(&b, "%s %s Ready=True,\n", id, ins.IP)
+		}
+		runner.RespondTo(".status.conditions", b.String(), nil)
+		buf.Reset()
+		watch.ScalingProfiles = []string{"*=1"}
+		Expect(toRun.RunWatch(watch)).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("scaled nodes from 3 to 1"))
+		newest := cluster.Instances[3]
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(
+			"kubectl --kubeconfig=/etc/kubernetes/admin.conf drain " + newest + " --ignore-daemonsets --force --delete-local-data --timeout=5m"))
+		_, err := instances.GetInstance(newest)
+		Expect(err).To(HaveOccurred())
+		_, err = instances.GetInstance(cluster.Instances[1])
+		Expect(err).ShouldNot(HaveOccurred())
+		records := auditRecords(auditFile)
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Operation).To(Equal("scale"))
+		Expect(records[0].Result).To(Equal("success"))
+		Expect(records[0].Resources["instance"]).To(Equal(cluster.Instances[2:]))
+		Expect(records[0].Parameters).To(HaveKeyWithValue("profile", "*=3"))
+		Expect(records[1].Operation).To(Equal("scale"))
+		Expect(records[1].Resources["instance"]).To(ConsistOf(cluster.Instances[2:]))
+
+		watch.ScalingProfiles = []string{"Mon-Fri 9:00=10"}
+		Expect(api.ExitCode(toRun.RunWatch(watch))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should reconcile the count of nodes with the spec by the policy of the cluster", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.DriftPolicy = api.DriftPolicyCorrect
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		specFile := filepath.Join(logDir, "spec.yaml")
+		Expect(toRun.RunExportSpec(&api.ExportSpecOption{ClusterName: "test", Zone: "ap2a", OutputPath: specFile})).ShouldNot(HaveOccurred())
+		content, _ := ioutil.ReadFile(specFile)
+		Expect(string(content)).To(ContainSubstring("driftPolicy: correct"))
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123", nil)
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		var b strings.Builder
+		var master *instance.Instance
+		nodes := make([]string, 0)
+		for _, id := range cluster.Instances {
+			ins, _ := instances.GetInstance(id)
+			if ins.Name == instance.GeneateName("test", api.RoleMaster) {
+				master = ins
+				continue
+			}
+			nodes = append(nodes, id)
+			fmt.Fprintf(&b, "%s %s Ready=True,\n", id, ins.IP)
+		}
+		runner.RespondTo(".status.conditions", b.String(), nil)
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		watch := &api.WatchOption{ClusterName: "test", Zone: "ap2a", Interval: time.Millisecond, Rounds: 1, BootstrapLogDir: logDir, SpecPath: specFile}
+		Expect(toRun.RunWatch(watch)).ShouldNot(HaveOccurred())
+		Expect(buf.String()).NotTo(ContainSubstring("drifts"))
+
+		// deleted by hand
+		instances.SetStatus(nodes[0], instance.StatusTerminated)
+		created := len(instances.CallsOf("CreateInstances"))
+		Expect(toRun.RunWatch(watch)).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(MatchRegexp(`nodeCount drifts from 2 to 1, added i-\w+ \(correct\)`))
+		Expect(instances.CallsOf("CreateInstances")).To(HaveLen(created + 1))
+		Expect(instances.CallsOf("CreateInstances")[created].Args[0].(*instance.CreateInstancesOption).Count).To(Equal(1))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf delete node " + nodes[0]))
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(cluster.Instances).To(HaveLen(4))
+
+		buf.Reset()
+		instances.SetStatus(nodes[1], instance.StatusTerminated)
+		watch.DriftPolicy = api.DriftPolicyFlag
+		Expect(ioutil.WriteFile(specFile, []byte("clusterName: test\nkubernetesVersion: 1.16.0\nnodeCount: 2\n"), 0644)).ShouldNot(HaveOccurred())
+		created = len(instances.CallsOf("CreateInstances"))
+		Expect(toRun.RunWatch(watch)).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("kubernetesVersion drifts from 1.16.0 to 1.15.5, nodeCount drifts from 2 to 1 (flag)"))
+		Expect(instances.CallsOf("CreateInstances")).To(HaveLen(created))
+
+		watch.DriftPolicy = "fix"
+		Expect(api.ExitCode(toRun.RunWatch(watch))).To(Equal(api.ExitCodeValidation))
+		watch.DriftPolicy = ""
+		watch.ClusterName = "other"
+		Expect(api.ExitCode(toRun.RunWatch(watch))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should match scaling profiles by weekday and time of day", func() {
+		// 2024-01-05 is a friday
+		friday := func(clock string) time.Time {
+			t, err := time.ParseInLocation("2006-01-02 15:04", "2024-01-05 "+clock, time.Local)
+			Expect(err).ShouldNot(HaveOccurred())
+			return t
+		}
+		p, err := parseScalingProfile("Mon-Fri 09:00-19:00=10")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p.count).To(Equal(10))
+		Expect(p.matches(friday("09:00"))).To(BeTrue())
+		Expect(p.matches(friday("19:00"))).To(BeFalse())
+		Expect(p.matches(friday("12:00").AddDate(0, 0, 1))).To(BeFalse())
+		p, err = parseScalingProfile("Fri-Mon 22:00-06:00=2")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p.matches(friday("23:30"))).To(BeTrue())
+		Expect(p.matches(friday("05:59"))).To(BeTrue())
+		Expect(p.matches(friday("12:00"))).To(BeFalse())
+		Expect(p.matches(friday("23:30").AddDate(0, 0, 2))).To(BeTrue())
+		Expect(p.matches(friday("23:30").AddDate(0, 0, 4))).To(BeFalse())
+		p, err = parseScalingProfile("*=3")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p.matches(friday("03:00").AddDate(0, 0, 3))).To(BeTrue())
+		for _, s := range []string{"Mon-Fri", "Mon-Funday=1", "*=-1", "* 9-19=1"} {
+			_, err = parseScalingProfile(s)
+			Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		}
+	})
+
+	It("Should patch workers in turn and stop after a failure", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 3
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		var master *instance.Instance
+		workers := make([]*instance.Instance, 0)
+		for _, id := range cluster.Instances {
+			ins, _ := instances.GetInstance(id)
+			if ins.Name == instance.GeneateName("test", api.RoleMaster) {
+				master = ins
+			} else {
+				workers = append(workers, ins)
+			}
+		}
+		runner.RespondTo(".status.conditions", fmt.Sprintf("master %s Ready=True,\nnode-a %s Ready=True,\nnode-b %s Ready=True,\nnode-c %s Ready=True,\n",
+			master.IP, workers[0].IP, workers[1].IP, workers[2].IP), nil)
+		runner.RespondTo("drain node-b", "error: cannot evict pod as it would violate the pod's disruption budget", fmt.Errorf("exit status 1"))
+		const kubectl = "kubectl --kubeconfig=/etc/kubernetes/admin.conf "
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(api.ExitCode(toRun.RunPatch(&api.PatchOption{ClusterName: "test", Zone: "ap2a", Parallelism: -1}))).To(Equal(api.ExitCodeValidation))
+		err := toRun.RunPatch(&api.PatchOption{ClusterName: "test", Zone: "ap2a", BootstrapLogDir: logDir})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(runner.CommandsOn(workers[0].IP)).To(ContainElement(ContainSubstring("systemctl reboot")))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "uncordon node-a"))
+		Expect(runner.CommandsOn(master.IP)).NotTo(ContainElement(kubectl + "uncordon node-b"))
+		Expect(runner.CommandsOn(master.IP)).NotTo(ContainElement(ContainSubstring("drain node-c")))
+		Expect(runner.CommandsOn(workers[2].IP)).NotTo(ContainElement(ContainSubstring("apt-get upgrade")))
+		Expect(buf.String()).To(MatchRegexp(workers[0].ID + `\s+node-a\s+patched`))
+		Expect(buf.String()).To(MatchRegexp(workers[1].ID + `\s+node-b\s+failed, left cordoned`))
+		Expect(buf.String()).To(MatchRegexp(workers[2].ID + `\s+node-c\s+skipped`))
+	})
+
+	It("Should cordon, drain and uncordon nodes of a pool", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		node1, _ := instances.GetInstance(cluster.Instances[1])
+		node2, _ := instances.GetInstance(cluster.Instances[2])
+		runner.RespondTo(".status.conditions", fmt.Sprintf("master %s Ready=True,\nnode-a %s Ready=True,\nnode-b %s Ready=True,\n", master.IP, node1.IP, node2.IP), nil)
+		const kubectl = "kubectl --kubeconfig=/etc/kubernetes/admin.conf "
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		cordon := &api.CordonOption{ClusterName: "test", Zone: "ap2a", Pool: "node"}
+		Expect(toRun.RunCordon(cordon)).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "cordon node-a"))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "cordon node-b"))
+		Expect(runner.CommandsOn(master.IP)).NotTo(ContainElement(kubectl + "cordon master"))
+		Expect(buf.String()).To(MatchRegexp(node1.ID + `\s+node-a\s+cordoned`))
+
+		runner.RespondTo("drain node-b", "error: cannot evict pod as it would violate the pod's disruption budget", fmt.Errorf("exit status 1"))
+		cordon.Drain = true
+		err := toRun.RunCordon(cordon)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "drain node-a --ignore-daemonsets --force --delete-local-data --timeout=5m"))
+		Expect(buf.String()).To(MatchRegexp(node2.ID + `\s+node-b\s+failed`))
+
+		Expect(api.ExitCode(toRun.RunUncordon(cordon))).To(Equal(api.ExitCodeValidation))
+		cordon.Drain = false
+		cordon.Pool = "master"
+		Expect(toRun.RunUncordon(cordon)).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "uncordon master"))
+		cordon.Pool = "winnode"
+		Expect(api.ExitCode(toRun.RunUncordon(cordon))).To(Equal(api.ExitCodeValidation))
+		cordon.Pool = "gpu"
+		Expect(api.ExitCode(toRun.RunCordon(cordon))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should capture a node as a node image variant taken by clusters and nodes created later", func() {
+		home := os.Getenv("HOME")
+		os.Setenv("HOME", logDir)
+		defer os.Setenv("HOME", home)
+		saved := api.PresetKubernetes["1.15.5"]
+		defer func() { api.PresetKubernetes["1.15.5"] = saved }()
+		images := imagefake.NewImageService()
+		images.SetStatus(saved.Zones["ap2a"].MasterImageID, image.StatusAvailable)
+		images.SetStatus(saved.Zones["ap2a"].NodeImageID, image.StatusAvailable)
+		toRun.(*app).imageService = images
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		var master, node *instance.Instance
+		for _, id := range cluster.Instances {
+			ins, _ := instances.GetInstance(id)
+			if ins.Name == instance.GeneateName("test", api.RoleMaster) {
+				master = ins
+			} else {
+				node = ins
+			}
+		}
+		runner.RespondTo(".status.conditions", fmt.Sprintf("master %s Ready=True,\nnode-a %s Ready=True,\n", master.IP, node.IP), nil)
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123", nil)
+		const kubectl = "kubectl --kubeconfig=/etc/kubernetes/admin.conf "
+
+		capture := &api.CaptureImageOption{ClusterName: "test", Zone: "ap2a", InstanceID: master.ID, Variant: "gpu", BootstrapLogDir: logDir}
+		Expect(api.ExitCode(toRun.RunCaptureImage(capture))).To(Equal(api.ExitCodeValidation))
+		capture.InstanceID = node.ID
+		capture.Variant = "gpu;a"
+		Expect(api.ExitCode(toRun.RunCaptureImage(capture))).To(Equal(api.ExitCodeValidation))
+		Expect(images.CallsOf("CreateImageBasedInstanceID")).To(BeEmpty())
+
+		capture.Variant = "gpu"
+		Expect(toRun.RunCaptureImage(capture)).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "drain node-a --ignore-daemonsets --force --delete-local-data --timeout=5m"))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(kubectl + "delete node node-a"))
+		Expect(runner.CommandsOn(node.IP)).To(ContainElement(HavePrefix("kubeadm reset -f")))
+		Expect(images.CallsOf("CreateImageBasedInstanceID")[0].Args).To(Equal([]interface{}{node.ID, "qks-1.15.5-gpu"}))
+		Expect(instances.CallsOf("StartInstances")).To(HaveLen(1))
+		joins := 0
+		for _, c := range runner.CommandsOn(node.IP) {
+			if c == "bash /root/scripts/qks/join.sh" {
+				joins++
+			}
+		}
+		Expect(joins).To(Equal(2))
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(api.ParseClusterMetadata(cluster.Description).NodeImageVariant).To(Equal("gpu"))
+
+		api.PresetKubernetes["1.15.5"] = saved
+		Expect(api.LoadZoneImages(api.ZoneImagesFile())).To(Succeed())
+		preset, err := api.PresetFor("1.15.5", "ap2a", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(preset.MasterImageID).To(Equal(saved.Zones["ap2a"].MasterImageID))
+		preset, err = preset.WithNodeImageVariant("gpu")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(preset.NodeImageID).To(Equal("img-fake0001"))
+		_, err = preset.WithNodeImageVariant("fpga")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+
+		opt.ClusterName = "gpu"
+		opt.NodeImageVariant = "gpu"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "gpu")
+		for _, id := range cluster.Instances {
+			created, _ := instances.GetInstance(id)
+			if created.Name == instance.GeneateName("gpu", api.RoleNode) {
+				Expect(created.ImageID).To(Equal("img-fake0001"))
+			}
+		}
+	})
+
+	It("Should create nodes from an instance snapshot captured once as a node image variant", func() {
+		home := os.Getenv("HOME")
+		os.Setenv("HOME", logDir)
+		defer os.Setenv("HOME", home)
+		saved := api.PresetKubernetes["1.15.5"]
+		defer func() { api.PresetKubernetes["1.15.5"] = saved }()
+		images := imagefake.NewImageService()
+		images.SetStatus(saved.Zones["ap2a"].MasterImageID, image.StatusAvailable)
+		images.SetStatus(saved.Zones["ap2a"].NodeImageID, image.StatusAvailable)
+		toRun.(*app).imageService = images
+		opt := newCreateOption()
+		opt.NodeSnapshot = "warm"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		opt.NodeSnapshot = "ss-warm"
+		opt.NodeImageVariant = "gpu"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		Expect(images.CallsOf("CaptureImageFromSnapshot")).To(BeEmpty())
+
+		opt.NodeImageVariant = ""
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(images.CallsOf("CaptureImageFromSnapshot")[0].Args).To(Equal([]interface{}{"ss-warm", "qks-1.15.5-ss-warm"}))
+		nodes := func(name string) []*instance.Instance {
+			cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + name)
+			found, _ := toRun.(*app).poolMachines(name, cluster, api.RoleNode)
+			return found
+		}
+		Expect(nodes("test")[0].ImageID).To(Equal("img-fake0001"))
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(api.ParseClusterMetadata(cluster.Description).NodeImageVariant).To(Equal("ss-warm"))
+
+		second := *opt
+		second.ClusterName = "again"
+		second.NodeImageVariant = ""
+		Expect(toRun.RunCreate(&second)).ShouldNot(HaveOccurred())
+		Expect(images.CallsOf("CaptureImageFromSnapshot")).To(HaveLen(1))
+		Expect(nodes("again")[0].ImageID).To(Equal("img-fake0001"))
+
+		capture := &api.CaptureImageOption{ClusterName: "test", Zone: "ap2a", InstanceID: nodes("test")[0].ID, SnapshotID: "ss-cold", Variant: "cold"}
+		Expect(api.ExitCode(toRun.RunCaptureImage(capture))).To(Equal(api.ExitCodeValidation))
+		capture.InstanceID = ""
+		Expect(toRun.RunCaptureImage(capture)).ShouldNot(HaveOccurred())
+		Expect(images.CallsOf("CaptureImageFromSnapshot")[1].Args).To(Equal([]interface{}{"ss-cold", "qks-1.15.5-cold"}))
+		Expect(images.CallsOf("CreateImageBasedInstanceID")).To(BeEmpty())
+		Expect(instances.CallsOf("StopInstances")).To(BeEmpty())
+		cluster, _ = tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(api.ParseClusterMetadata(cluster.Description).NodeImageVariant).To(Equal("cold"))
+	})
+
+	It("Should attach the console output of machines ssh cannot reach to their errors", func() {
+		consoles := consolefake.NewConsoleService()
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithConsoleService(consoles))
+		var broken hook.Machine
+		panics := true
+		toRun.(*app).hooks = []hook.Hook{hook.Func(func(ctx *hook.Context) error {
+			if ctx.Point == hook.PostInstances {
+				for _, m := range ctx.Machines {
+					if m.Role == "node" {
+						broken = m
+					}
+				}
+				if panics {
+					consoles.Outputs[broken.ID] = "[    0.000000] Linux version 4.15.0\n[    1.424242] Kernel panic - not syncing: VFS: Unable to mount root fs on unknown-block(0,0)\n"
+				}
+				runner.Unreachable(broken.IP)
+			}
+			return nil
+		})}
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(err.Error()).To(ContainSubstring("Cannot connect to " + broken.IP + " by ssh"))
+		Expect(err.Error()).To(ContainSubstring("Last console output of " + broken.ID + ":\n[    0.000000] Linux version 4.15.0\n[    1.424242] Kernel panic - not syncing"))
+		content, readErr := ioutil.ReadFile(filepath.Join(logDir, broken.ID+"-console.log"))
+		Expect(readErr).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("Linux version 4.15.0"))
+
+		panics = false
+		opt.ClusterName = "again"
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(err.Error()).To(ContainSubstring("Instance " + broken.ID + " is running with ip " + broken.IP))
+	})
+
+	It("Should run hooks at lifecycle points of create and delete", func() {
+		points := make([]string, 0)
+		var postInstances *hook.Context
+		failAt := ""
+		toRun.(*app).hooks = []hook.Hook{hook.Func(func(ctx *hook.Context) error {
+			points = append(points, ctx.Point)
+			if ctx.Point == hook.PostInstances {
+				copied := *ctx
+				postInstances = &copied
+			}
+			if ctx.Point == failAt {
+				return fmt.Errorf("refused by site policy")
+			}
+			return nil
+		})}
+		opt := newCreateOption()
+		failAt = hook.PreCreate
+		err := toRun.RunCreate(opt)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("refused by site policy"))
+		Expect(instances.Calls()).To(BeEmpty())
+		Expect(tags.Calls()).To(BeEmpty())
+
+		points = points[:0]
+		failAt = hook.PostCreate
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(points).To(Equal([]string{hook.PreCreate, hook.PostInstances, hook.PreJoin, hook.PostCreate}))
+		Expect(postInstances.TagID).NotTo(BeEmpty())
+		Expect(postInstances.Machines).To(HaveLen(2))
+		roles := []string{postInstances.Machines[0].Role, postInstances.Machines[1].Role}
+		Expect(roles).To(ConsistOf("master", "node"))
+
+		failAt = hook.PreDelete
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).Should(HaveOccurred())
+		Expect(instances.Instances()).To(HaveLen(2))
+		failAt = ""
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(BeEmpty())
+		Expect(points[len(points)-1]).To(Equal(hook.PreDelete))
+	})
+
+	It("Should create clusters of a batch in parallel and report them together", func() {
+		buf := new(bytes.Buffer)
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		template := newCreateOption()
+		template.ClusterName = "lab"
+		spec := &api.BatchSpec{
+			Template: *template,
+			Count:    3,
+		}
+		clusters, err := spec.Clusters()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(clusters).To(HaveLen(3))
+		Expect(clusters[2].ClusterName).To(Equal("lab-03"))
+		clusters[1].CNIName = "unknown"
+		Expect(toRun.RunCreateBatch(clusters[:1], 2)).ShouldNot(HaveOccurred())
+		Expect(api.ClassOf(toRun.RunCreateBatch([]api.CreateClusterOption{clusters[0], clusters[0]}, 2))).To(Equal(api.ErrorClassValidation))
+
+		buf.Reset()
+		err = toRun.RunCreateBatch(clusters[1:], 2)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodePartialSuccess))
+		Expect(err.Error()).To(ContainSubstring("lab-02"))
+		Expect(instances.Instances()).To(HaveLen(4))
+		Expect(buf.String()).To(MatchRegexp(`lab-02\s+failed`))
+		Expect(buf.String()).To(MatchRegexp(`lab-03\s+ready\s+\S+\s+https://\S+:6443\s+1/1`))
+		Expect(buf.String()).To(ContainSubstring("1 of 2 clusters are created"))
+		Expect(buf.String()).NotTo(ContainSubstring("Next steps"))
+	})
+
+	It("Should trace clusters of a batch apart and share the rate limit of their requests", func() {
+		type span struct {
+			TraceID      string `json:"traceId"`
+			SpanID       string `json:"spanId"`
+			ParentSpanID string `json:"parentSpanId"`
+			Name         string `json:"name"`
+		}
+		var mu sync.Mutex
+		var spans []span
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload struct {
+				ResourceSpans []struct {
+					ScopeSpans []struct {
+						Spans []span `json:"spans"`
+					} `json:"scopeSpans"`
+				} `json:"resourceSpans"`
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+			mu.Lock()
+			defer mu.Unlock()
+			for _, rs := range payload.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					spans = append(spans, ss.Spans...)
+				}
+			}
+		}))
+		defer collector.Close()
+		trace.Configure(collector.URL)
+		defer trace.Configure("")
+		template := newCreateOption()
+		template.ClusterName = "lab"
+		clusters, err := (&api.BatchSpec{Template: *template, Count: 2}).Clusters()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(toRun.RunCreateBatch(clusters, 2)).ShouldNot(HaveOccurred())
+		roots := make(map[string]string)
+		for _, s := range spans {
+			if s.Name == "RunCreate" {
+				Expect(s.ParentSpanID).To(BeEmpty())
+				roots[s.TraceID] = s.SpanID
+			}
+		}
+		Expect(roots).To(HaveLen(2))
+		commands := make(map[string]int)
+		for _, s := range spans {
+			if s.Name != "RunCreate" {
+				Expect(s.ParentSpanID).To(Equal(roots[s.TraceID]), "span %s", s.Name)
+				commands[s.TraceID]++
+			}
+		}
+		Expect(commands).To(HaveLen(2))
+
+		var times []time.Time
+		lookups := 0
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			times = append(times, time.Now())
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("action") == "DescribeAccessKeys" {
+				lookups++
+				fmt.Fprint(w, `{"action":"DescribeAccessKeysResponse","ret_code":0,"total_count":1,"access_key_set":[{"access_key_id":"AKID","owner":"usr-test"}]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"action":"%sResponse","ret_code":1400,"message":"refused by the test"}`, r.URL.Query().Get("action"))
+		}))
+		defer endpoint.Close()
+		const rate = 4
+		remote := NewApp(filepath.Join(logDir, "config.yaml"), WithEndpoint(endpoint.URL+"/iaas", false), WithCredentials("AKID", "SECRET"),
+			WithAPIRateLimit(rate), WithPublicKeyFile(toRun.(*app).publicKeyFile))
+		clusters, err = (&api.BatchSpec{Template: clusters[0], Count: 4}).Clusters()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(remote.RunCreateBatch(clusters, 4)).Should(HaveOccurred())
+		// keys are looked up before members start, not by each of them
+		Expect(lookups).To(Equal(1))
+		// a burst of rate requests goes at once, the others wait for the limiter members share
+		Expect(len(times)).To(BeNumerically(">", rate))
+		minimum := time.Duration(float64(len(times)-rate) / rate * float64(time.Second))
+		Expect(times[len(times)-1].Sub(times[0])).To(BeNumerically(">=", minimum-50*time.Millisecond))
+	})
+
+	It("Should run credential_process once however many times qingcloud is connected", func() {
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"action":"DescribeAccessKeysResponse","ret_code":0,"total_count":1,"access_key_set":[{"access_key_id":"PROCESS","owner":"usr-test"}]}`)
+		}))
+		defer endpoint.Close()
+		runs := filepath.Join(logDir, "runs")
+		creds := filepath.Join(logDir, "credentials.json")
+		Expect(ioutil.WriteFile(creds, []byte(`{"access_key_id": "PROCESS", "secret_access_key": "SECRET"}`), 0600)).To(Succeed())
+		config := filepath.Join(logDir, "config.yaml")
+		Expect(ioutil.WriteFile(config, []byte("credential_process: echo run >> "+runs+" && cat "+creds+"\n"), 0600)).To(Succeed())
+		remote := NewApp(config, WithEndpoint(endpoint.URL+"/iaas", false)).(*app)
+		Expect(remote.init("ap2a")).To(Succeed())
+		Expect(remote.init("ap2b")).To(Succeed())
+		Expect(remote.userID).To(Equal("usr-test"))
+		output, err := ioutil.ReadFile(runs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(output)).To(Equal("run\n"))
+	})
+
+	It("Should fall back to other instance types when the zone has no capacity", func() {
+		opt := newCreateOption()
+		opt.MasterInstanceType = "c4m8"
+		opt.NodeInstanceType = "c16m32"
+		instances.Exhausted = []string{"c4m8"}
+		noFallback := *opt
+		noFallback.NodeInstanceType = "c4m8"
+		err := toRun.RunCreate(&noFallback)
+		Expect(api.ClassOf(err)).To(Equal(api.ErrorClassCapacity))
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeQuota))
+		Expect(instances.Instances()).To(BeEmpty())
+		Expect(toRun.RunDelete(&api.DeleteClusterOption{ClusterName: "test", ForceDelete: true})).ShouldNot(HaveOccurred())
+
+		opt.FallbackInstanceTypes = []string{"c4m8", "c2m4"}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.MasterInstanceType).To(Equal("c2m4"))
+		Expect(opt.NodeInstanceType).To(Equal("c2m4"))
+		Expect(instances.Instances()).To(HaveLen(2))
+		for _, id := range instances.Instances() {
+			ins, _ := instances.GetInstance(id)
+			Expect(ins.InstanceType).To(Equal("c2m4"))
+		}
+	})
+
+	It("Should fall back to another zone before anything is created", func() {
+		preset := api.PresetKubernetes["1.15.5"]
+		preset.Zones["ap2b"] = preset.Zones["ap2a"]
+		defer delete(preset.Zones, "ap2b")
+		providers := map[string]*cloudfake.Provider{"ap2a": cloudfake.NewProvider(), "ap2b": cloudfake.NewProvider(), "ap2c": cloudfake.NewProvider()}
+		providers["ap2a"].InstanceService.Types = []string{"c1m1"}
+		providers["ap2b"].InstanceService.Types = []string{"c1m1", "c2m4"}
+		toRun = NewApp("", WithProviderOf(func(zone string) cloud.Provider {
+			return providers[zone]
+		}), WithSSHRunner(runner), WithPublicKeyFile(toRun.(*app).publicKeyFile))
+		opt := newCreateOption()
+		opt.MasterInstanceType = "c4m8"
+		opt.NodeInstanceType = "c4m8"
+		opt.FallbackInstanceTypes = []string{"c2m4"}
+		opt.FallbackZones = []string{"ap2c", "ap2b"}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.Zone).To(Equal("ap2b"))
+		Expect(providers["ap2a"].InstanceService.Instances()).To(BeEmpty())
+		Expect(providers["ap2a"].TagService.Calls()).To(BeEmpty())
+		Expect(providers["ap2c"].InstanceService.Calls()).To(BeEmpty())
+		Expect(providers["ap2b"].InstanceService.Instances()).To(HaveLen(2))
+
+		opt = newCreateOption()
+		opt.ClusterName = "other"
+		opt.MasterInstanceType = "c8m16"
+		opt.FallbackZones = []string{"ap2b"}
+		err := toRun.RunCreate(opt)
+		Expect(api.ClassOf(err)).To(Equal(api.ErrorClassCapacity))
+		Expect(err.Error()).To(ContainSubstring("zone ap2b offers no instance type of master"))
+	})
+
+	It("Should tell state transitions between two polls", func() {
+		last := map[string]string{"node node2": "Ready", "instance i-1": "running", "instance i-2": "running"}
+		current := map[string]string{"node node2": "NotReady", "instance i-1": "stopped", "instance i-3": "pending"}
+		transitions := healthTransitions(last, current)
+		Expect(transitions).To(HaveLen(4))
+		Expect(transitions[0].String()).To(Equal("instance i-1: running -> stopped"))
+		Expect(transitions[1].String()).To(Equal("instance i-2 is gone, it was running"))
+		Expect(transitions[2].String()).To(Equal("instance i-3 is pending"))
+		Expect(transitions[3].String()).To(Equal("node node2: Ready -> NotReady"))
+		Expect(transitions[3].Healthy()).To(BeFalse())
+		Expect(healthTransitions(current, current)).To(BeEmpty())
+	})
+
+	It("Should plan upgrades without changing the cluster", func() {
+		opt := newCreateOption()
+		opt.Addons = []api.AddonOption{{Name: addon.IngressNginx}, {Name: addon.Logging}}
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		runner.RespondTo("--all-namespaces -o json", `{"items":[]}`, nil)
+		runner.RespondTo("get deployments --all-namespaces", `{"items":[{"metadata":{"name":"web","namespace":"default","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"extensions/v1beta1\",\"kind\":\"Deployment\"}"}}}]}`, nil)
+		runner.RespondTo("get csistoragecapacities", "error: the server doesn't have a resource type \"csistoragecapacities\"", fmt.Errorf("exit status 1"))
+		runner.RespondTo("get leases", "Unable to connect to the server", fmt.Errorf("exit status 1"))
+		calls := len(instances.Calls())
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunUpgradePlan(&api.UpgradePlanOption{ClusterName: "test", Zone: "ap2a", KubernetesVersion: "1.30.5"})).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("from 1.15.5 to 1.30.5 takes 15 steps"))
+		Expect(buf.String()).To(MatchRegexp(`Deployment default/web\s+extensions/v1beta1 Deployment is removed in 1.16, use apps/v1`))
+		Expect(buf.String()).To(ContainSubstring("leases cannot be listed"))
+		Expect(buf.String()).NotTo(ContainSubstring("csistoragecapacities"))
+		Expect(buf.String()).To(ContainSubstring("addon logging 2.1.2 is chart"))
+		Expect(buf.String()).To(ContainSubstring("1 problems are found"))
+		for _, c := range instances.Calls()[calls:] {
+			Expect(c.Method).To(HavePrefix("Get"))
+		}
+
+		err := toRun.RunUpgradePlan(&api.UpgradePlanOption{ClusterName: "test", Zone: "ap2a", KubernetesVersion: "1.13.1"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should report and record the cost of a cluster", func() {
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		tags.AttachResources(cluster.TagID, api.ResourceTypeEIP, "eip-1")
+		cost := billingfake.NewBillingService()
+		since := time.Now().Add(-10 * time.Hour)
+		cost.SetLease(&billing.Lease{ResourceID: cluster.Instances[0], Price: 1, Unit: billing.UnitHour, Since: since})
+		cost.SetLease(&billing.Lease{ResourceID: cluster.Instances[1], Price: 1, Unit: billing.UnitHour, Since: since})
+		cost.SetLease(&billing.Lease{ResourceID: "eip-1", Price: 72, Unit: billing.UnitMonth, Since: since})
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithBillingService(cost))
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		history := filepath.Join(logDir, "cost.jsonl")
+		Expect(toRun.RunCost(&api.CostOption{ClusterName: "test", Zone: "ap2a", HistoryPath: history})).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(MatchRegexp(`instance\s+2\s+20\.\d+\s+1440\.00`))
+		Expect(buf.String()).To(MatchRegexp(`eip\s+1\s+1\.\d+\s+72\.00`))
+		Expect(buf.String()).To(MatchRegexp(`total\s+21\.\d+\s+1512\.00`))
+		Expect(cost.CallsOf("GetLease")).To(HaveLen(3))
+
+		delete(cost.Leases, "eip-1")
+		buf.Reset()
+		Expect(toRun.RunCost(&api.CostOption{ClusterName: "test", Zone: "ap2a", HistoryPath: history})).ShouldNot(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring("monthly cost changed by -72.00"))
+		content, err := ioutil.ReadFile(history)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(strings.Split(strings.TrimSpace(string(content)), "\n")).To(HaveLen(2))
+	})
+
+	It("Should write manifests of created resources", func() {
+		manifestFile := filepath.Join(logDir, "resources.json")
+		opt := newCreateOption()
+		opt.ResourcesManifest = manifestFile
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		content, err := ioutil.ReadFile(manifestFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		resources := &manifest.Resources{}
+		Expect(json.Unmarshal(content, resources)).ShouldNot(HaveOccurred())
+		Expect(resources.TagID).To(Equal(cluster.TagID))
+		Expect(resources.Instances).To(HaveLen(2))
+		Expect(resources.Instances[0].Role).To(Equal("master"))
+		Expect(resources.Others[api.ResourceTypeKeyPair]).To(Equal(cluster.Resources[api.ResourceTypeKeyPair]))
+
+		tfFile := filepath.Join(logDir, "imports.tf")
+		Expect(toRun.RunExportSpec(&api.ExportSpecOption{ClusterName: "test", Zone: "ap2a", OutputPath: tfFile, Format: manifest.FormatTerraform})).ShouldNot(HaveOccurred())
+		content, err = ioutil.ReadFile(tfFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("import {\n  to = qingcloud_instance.test_master_0\n  id = \"" + cluster.Instances[0] + "\"\n}"))
+		Expect(string(content)).To(ContainSubstring("to = qingcloud_keypair.test_0"))
+		err = toRun.RunExportSpec(&api.ExportSpecOption{ClusterName: "test", Zone: "ap2a", Format: "xml"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should write endpoints of the created cluster for downstream automation", func() {
+		envFile := filepath.Join(logDir, "cluster.env")
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.EndpointsFile = envFile
+		var summary *ClusterSummary
+		toRun.(*app).onSummary = func(s *ClusterSummary) { summary = s }
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		content, err := ioutil.ReadFile(envFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("QKS_MASTER_IP=\"" + summary.Master.IP + "\"\n"))
+		Expect(string(content)).To(ContainSubstring("QKS_NODE_IPS=\"" + summary.Nodes[0].IP + "," + summary.Nodes[1].IP + "\"\n"))
+		Expect(string(content)).To(ContainSubstring("QKS_SSH_USER=\"root\"\n"))
+
+		endpoints := toRun.(*app).endpointsOf(summary)
+		content, err = endpoints.Render(manifest.FormatAnsible)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("[test_master]\n" + summary.Master.IP + "\n"))
+		Expect(string(content)).To(ContainSubstring("[test:children]\ntest_master\ntest_node\n"))
+		content, err = endpoints.Render(manifest.FormatTerraformOutput)
+		Expect(err).ShouldNot(HaveOccurred())
+		outputs := map[string]struct {
+			Value interface{} `json:"value"`
+		}{}
+		Expect(json.Unmarshal(content, &outputs)).ShouldNot(HaveOccurred())
+		Expect(outputs["master_ip"].Value).To(Equal(summary.Master.IP))
+		Expect(outputs["node_ips"].Value).To(HaveLen(2))
+
+		opt.EndpointsFormat = "xml"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should print an ansible inventory of a cluster grouped by pools", func() {
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		master, _ := instances.GetInstance(cluster.Instances[0])
+		inventoryFile := filepath.Join(logDir, "hosts.ini")
+		Expect(toRun.RunInventory(&api.InventoryOption{ClusterName: "test", Zone: "ap2a", OutputPath: inventoryFile})).ShouldNot(HaveOccurred())
+		content, err := ioutil.ReadFile(inventoryFile)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("[test_master]\n" + master.ID + " ansible_host=" + master.IP + "\n"))
+		Expect(string(content)).To(ContainSubstring("[test_node:vars]\nansible_ssh_private_key_file="))
+		Expect(string(content)).To(ContainSubstring("ansible_user=root\n"))
+		Expect(string(content)).To(ContainSubstring("[test:children]\ntest_master\ntest_node\n"))
+		Expect(string(content)).NotTo(ContainSubstring("test_winnode"))
+
+		buf := &bytes.Buffer{}
+		output.Out = buf
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunInventory(&api.InventoryOption{ClusterName: "test", Zone: "ap2a", Format: manifest.FormatJSON})).ShouldNot(HaveOccurred())
+		groups := map[string]struct {
+			Hosts    []string `json:"hosts"`
+			Children []string `json:"children"`
+		}{}
+		Expect(json.Unmarshal(buf.Bytes(), &groups)).ShouldNot(HaveOccurred())
+		Expect(groups["test_node"].Hosts).To(HaveLen(2))
+		Expect(groups["test"].Children).To(Equal([]string{"test_master", "test_node"}))
+
+		err = toRun.RunInventory(&api.InventoryOption{ClusterName: "test", Zone: "ap2a", Format: "yaml"})
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should put created resources into the resource group", func() {
+		groups := resourcegroupfake.NewResourceGroupService("rg-test")
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithResourceGroupService(groups))
+		opt := newCreateOption()
+		opt.ResourceGroup = "rg-missing"
+		Expect(toRun.RunCreate(opt)).Should(HaveOccurred())
+		Expect(instances.Instances()).To(BeEmpty())
+		opt.ResourceGroup = "rg-test"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		cluster, _ := tags.GetTagClusterByName(api.ClusterTagPrefix + "test")
+		Expect(groups.Groups["rg-test"]).To(ConsistOf(append([]string{cluster.TagID}, cluster.Instances...)))
+	})
+
+	It("Should attach an existing security group to all instances", func() {
+		groups := securitygroupfake.NewSecurityGroupService("sg-corp")
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithPublicKeyFile(toRun.(*app).publicKeyFile), WithSecurityGroupService(groups))
+		opt := newCreateOption()
+		opt.NodeCount = 2
+		opt.SecurityGroup = "sg-missing"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Instances()).To(BeEmpty())
+		opt.SecurityGroup = "corp"
+		Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation))
+		opt.SecurityGroup = "sg-corp"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(instances.Instances()).To(HaveLen(3))
+		for _, id := range instances.Instances() {
+			ins, _ := instances.GetInstance(id)
+			Expect(ins.SecurityGroup).To(Equal("sg-corp"))
+		}
+	})
+
+	It("Should print join commands of an existing cluster", func() {
+		opt := newCreateOption()
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123", nil)
+		runner.RespondTo("upload-certs", "[upload-certs] Using certificate key:\nabcdef", nil)
+		out := &bytes.Buffer{}
+		output.Out = out
+		defer func() { output.Out = os.Stdout }()
+		Expect(toRun.RunPrintJoin(&api.PrintJoinOption{ClusterName: "test"})).ShouldNot(HaveOccurred())
+		Expect(out.String()).To(ContainSubstring("kubeadm join 192.168.0.3:6443 --token new.token --discovery-token-ca-cert-hash sha256:123\n"))
+		Expect(out.String()).To(ContainSubstring("--control-plane --certificate-key abcdef"))
+	})
+
+	It("Should refuse zones without images", func() {
+		opt := newCreateOption()
+		opt.Zone = "pek3"
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring("qks create image"))
+		Expect(instances.Calls()).To(BeEmpty())
+	})
+
+	It("Should create machines of the given instance types", func() {
+		opt := newCreateOption()
+		opt.MasterInstanceType = "enterprise-memory"
+		opt.NodeInstanceType = "c4m8"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		for _, c := range instances.CallsOf("CreateInstances") {
+			createOpt := c.Args[0].(*instance.CreateInstancesOption)
+			if createOpt.Role == api.RoleMaster {
+				Expect(createOpt.InstanceClass).To(Equal(200))
+				Expect(createOpt.MasterMemory).To(Equal(createOpt.MasterCPU * 8192))
+			} else {
+				Expect(createOpt.InstanceType).To(Equal("c4m8"))
+			}
+		}
+
+		opt.NodeInstanceType = "c64m1"
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		opt.NodeInstanceType = "huge"
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should create arm64 machines from arm64 images and arm instance types", func() {
+		preset := api.PresetKubernetes["1.15.5"]
+		defer func() { api.PresetKubernetes["1.15.5"] = preset }()
+		arm := preset
+		arm.Zones = map[string]api.ZoneImages{"ap2a": {MasterImageID: "img-kj5hg0fe", NodeImageID: "img-sykyoovw", ARM64MasterImageID: "img-armmastr", ARM64NodeImageID: "img-armnode1"}}
+		api.PresetKubernetes["1.15.5"] = arm
+		instances.Types = []string{"c4m8", "a4m8"}
+		opt := newCreateOption()
+		opt.Arch = api.ArchARM64
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		opt.MasterInstanceType = "enterprise"
+		opt.NodeInstanceType = "a4m8"
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring("family of amd64"))
+		Expect(instances.Calls()).To(BeEmpty())
+
+		opt.MasterInstanceType = "a4m8"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		for _, c := range instances.CallsOf("CreateInstances") {
+			createOpt := c.Args[0].(*instance.CreateInstancesOption)
+			Expect(createOpt.InstanceType).To(Equal("a4m8"))
+			Expect(createOpt.Arch).To(Equal(api.ArchARM64))
+			Expect([]string{createOpt.MasterImageID, createOpt.NodeImageID}).To(Equal([]string{"img-armmastr", "img-armnode1"}))
+		}
+		Expect(api.ArchOfMasterImage("ap2a", "img-armmastr")).To(Equal(api.ArchARM64))
+
+		arm.Zones = map[string]api.ZoneImages{"ap2a": {MasterImageID: "img-kj5hg0fe", NodeImageID: "img-sykyoovw"}}
+		api.PresetKubernetes["1.15.5"] = arm
+		_, err = api.PresetFor("1.15.5", "ap2a", api.ArchARM64)
+		Expect(err.Error()).To(ContainSubstring("no arm64 images in zone ap2a"))
+	})
+
+	It("Should create and join experimental windows nodes after linux ones", func() {
+		preset := api.PresetKubernetes["1.30.5"]
+		defer func() { api.PresetKubernetes["1.30.5"] = preset }()
+		withImages := preset
+		withImages.Zones = map[string]api.ZoneImages{"ap2a": {MasterImageID: "img-master01", NodeImageID: "img-node0001", WindowsNodeImageID: "img-windows1"}}
+		api.PresetKubernetes["1.30.5"] = withImages
+		opt := newCreateOption()
+		opt.KubernetesVersion = "1.30.5"
+		opt.WindowsNodeCount = 1
+		opt.PodNetWorkCIDR = "10.244.0.0/16"
+		err := toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(instances.Calls()).To(BeEmpty())
+
+		opt.CNIName = api.FlannelCNI
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		calls := instances.CallsOf("CreateInstances")
+		Expect(calls).To(HaveLen(3))
+		createOpt := calls[2].Args[0].(*instance.CreateInstancesOption)
+		Expect(createOpt.Role).To(Equal(api.RoleWindowsNode))
+		Expect(createOpt.Count).To(Equal(1))
+		var windows *instance.Instance
+		for _, id := range instances.Instances() {
+			if ins, _ := instances.GetInstance(id); ins.ImageID == "img-windows1" {
+				windows = ins
+			}
+		}
+		Expect(windows).NotTo(BeNil())
+		Expect(windows.Name).To(HaveSuffix("-winnode"))
+		Expect(tags.Calls()).To(ContainElement(WithTransform(func(c recorder.Call) bool {
+			return c.Method == "TagInstances" && c.Args[1].([]string)[0] == windows.ID
+		}, BeTrue())))
+		script, ok := runner.File(windows.IP, `C:\qks\join-windows.ps1`)
+		Expect(ok).To(BeTrue())
+		Expect(script).To(ContainSubstring("kubeadm join " + scriptRunOn(runner, bootstrap.InitScript) + ":6443 --token abc.def --discovery-token-ca-cert-hash sha256:123 --cri-socket " + bootstrap.CRISocketWindows))
+	})
+
+	It("Should agree on the tag of the lowest id when another run creates it at the same time", func() {
+		a := toRun.(*app)
+		a.tagService = &racingTagService{Interface: tags, before: true}
+		t, created, err := a.getOrCreateTag(newCreateOption())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t.TagID).To(Equal("tag-fake0001"))
+		Expect(created).To(Equal("tag-fake0002"))
+		Expect(tags.CallsOf("DeleteTag")[0].Args[0]).To(Equal("tag-fake0002"))
+		Expect(tags.DeleteTag(t.TagID)).To(Succeed())
+
+		a.tagService = &racingTagService{Interface: tags}
+		t, created, err = a.getOrCreateTag(newCreateOption())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t.TagID).To(Equal("tag-fake0003"))
+		Expect(created).To(Equal(t.TagID))
+		other, err := tags.GetTags(api.ClusterTagPrefix + "test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(other).To(HaveLen(2))
+	})
+
+	It("Should normalize cluster names and refuse names taken in the zone", func() {
+		opt := newCreateOption()
+		opt.ClusterName = "Team_A.Dev"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.ClusterName).To(Equal("team-a-dev"))
+		t, err := tags.GetTagClusterByName(api.ClusterTagPrefix + "team-a-dev")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t).NotTo(BeNil())
+		Expect(keys.CallsOf("CreateSSHKey")[0].Args[0]).To(Equal("qks-team-a-dev"))
+
+		instancesBefore := len(instances.Instances())
+		opt.ClusterName = "TEAM-A-DEV"
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring("use --adopt"))
+		Expect(instances.Instances()).To(HaveLen(instancesBefore))
+
+		for _, name := range []string{"-dev", "dev@1", strings.Repeat("a", api.MaxClusterNameLength+1)} {
+			opt.ClusterName = name
+			Expect(api.ExitCode(toRun.RunCreate(opt))).To(Equal(api.ExitCodeValidation), name)
+		}
+		Expect(instances.Instances()).To(HaveLen(instancesBefore))
+	})
+
+	It("Should resolve kubernetes versions like a minor or latest to the newest preset", func() {
+		opt := newCreateOption()
+		opt.KubernetesVersion = "v1.15"
+		Expect(toRun.RunCreate(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.KubernetesVersion).To(Equal("1.15.5"))
+
+		// 1.30.5 is newer but has no images in ap2a
+		version, err := api.ResolveKubernetesVersion(api.KubernetesVersionLatest, "ap2a", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(version).To(Equal("1.15.5"))
+		version, err = api.ResolveKubernetesVersion(api.KubernetesVersionLatest, "", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(version).To(Equal("1.30.5"))
+		version, err = api.ResolveKubernetesVersion("v1.15.2", "ap2a", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(version).To(Equal("1.15.2"))
+
+		opt.ClusterName = "other"
+		opt.KubernetesVersion = "1.14"
+		err = toRun.RunCreate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring("versions with presets are 1.13.1, 1.15.2, 1.15.5, 1.30.5"))
+	})
+
+	It("Should check images are available before creating instances", func() {
+		images := imagefake.NewImageService()
+		preset, _ := api.PresetFor("1.15.5", "ap2a", "")
+		images.SetStatus(preset.MasterImageID, image.StatusAvailable)
+		images.SetStatus(preset.NodeImageID, "deprecated")
+		toRun = NewAppWithServices(instances, keys, tags, runner, WithImageService(images))
+		err := toRun.RunCreate(newCreateOption())
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring(preset.NodeImageID + " of kubernetes 1.15.5 is deprecated"))
+		Expect(instances.Calls()).To(BeEmpty())
+		Expect(tags.Calls()).To(BeEmpty())
 	})
 })
+
+// auditRecords reads the records written to the audit file at path
+func auditRecords(path string) []*audit.Record {
+	content, err := ioutil.ReadFile(path)
+	Expect(err).ShouldNot(HaveOccurred())
+	records := make([]*audit.Record, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		r := &audit.Record{}
+		Expect(json.Unmarshal([]byte(line), r)).To(Succeed())
+		records = append(records, r)
+	}
+	return records
+}
+
+// fakeNodeList lists a node for every ip given out by the fake instance service
+func fakeNodeList() string {
+	var b strings.Builder
+	for i := 2; i < 60; i++ {
+		fmt.Fprintf(&b, "node%d 192.168.0.%d\n", i, i)
+	}
+	return b.String()
+}
+
+// racingTagService creates a tag of the same name as another run would, before or after the one asked for
+type racingTagService struct {
+	tag.Interface
+	before bool
+}
+
+func (r *racingTagService) CreateTag(name, description string) (string, error) {
+	if r.before {
+		r.Interface.CreateTag(name, description)
+		return r.Interface.CreateTag(name, description)
+	}
+	id, err := r.Interface.CreateTag(name, description)
+	r.Interface.CreateTag(name, description)
+	return id, err
+}
+
+// slowInitBootstrapper takes delay to init master
+type slowInitBootstrapper struct {
+	bootstrap.Interface
+	delay time.Duration
+}
+
+func (s *slowInitBootstrapper) InitMaster(master *instance.Instance) (string, error) {
+	time.Sleep(s.delay)
+	return s.Interface.InitMaster(master)
+}
+
+// scriptRunOn returns the ip of the last machine script of bootstrap runs on
+func scriptRunOn(runner *sshfake.Runner, script string) string {
+	ip := ""
+	for _, c := range runner.Calls() {
+		if c.Method == "RunAndGetOutput" && c.Args[1] == "bash "+bootstrap.RemoteScriptsLocation+script {
+			ip = c.Args[0].(string)
+		}
+	}
+	return ip
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/cloud"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/ratelimit"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+	"k8s.io/klog"
+)
+
+const (
+	// DefaultBatchConcurrency is how many clusters of a batch are created at once
+	DefaultBatchConcurrency = 5
+	// DefaultBatchAPIRate is requests per second to qingcloud shared by a batch if WithAPIRateLimit is not given
+	DefaultBatchAPIRate = 10
+)
+
+// batchResult is how a cluster of a batch ends, summary is nil if the cluster is not created
+type batchResult struct {
+	name     string
+	summary  *ClusterSummary
+	err      error
+	duration time.Duration
+}
+
+// RunCreateBatch creates clusters of specs in parallel, at most concurrency of them at once. Requests to qingcloud
+// are rate limited together, and summaries are reported together once all of them finish.
+// A failed cluster does not stop others, the result is PartialSuccess if some clusters are created.
+func (a *app) RunCreateBatch(specs []api.CreateClusterOption, concurrency int) error {
+	if err := validateBatch(specs); err != nil {
+		return err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	limiter := a.limiter
+	if limiter == nil {
+		limiter = ratelimit.New(DefaultBatchAPIRate, DefaultBatchAPIRate)
+	}
+	var keyHelper *accesskey.QingCloudAccessKeyHelper
+	if !a.injected && a.newProvider == nil {
+		// qingcloud is connected once here, members only create services of their zones from it
+		var err error
+		if keyHelper, err = a.newKeyHelper(specs[0].Zone, limiter); err != nil {
+			return err
+		}
+	}
+	klog.Infof("Creating %d clusters, %d at once", len(specs), concurrency)
+	results := make([]*batchResult, len(specs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range specs {
+		result := &batchResult{name: specs[i].ClusterName}
+		results[i] = result
+		// every cluster has its own copy of the app, since states of an operation like its record are kept on the app,
+		// and its own scope of spans, services created by init and runners trace in it
+		member := *a
+		member.limiter = limiter
+		member.scope = trace.NewScope()
+		member.sshRunner = ssh.WithTracing(a.sshRunner, member.scope)
+		member.windowsRunner = ssh.WithTracing(a.windowsRunner, member.scope)
+		member.onSummary = func(s *ClusterSummary) {
+			result.summary = s
+		}
+		if keyHelper != nil {
+			scope := member.scope
+			member.newProvider = func(zone string) cloud.Provider {
+				return cloud.NewQingCloudProvider(keyHelper, zone, scope)
+			}
+		}
+		wg.Add(1)
+		go func(opt *api.CreateClusterOption) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			result.err = member.RunCreate(opt)
+			result.duration = time.Since(start)
+			if result.err != nil {
+				klog.Errorf("Failed to create cluster %s, err: %s", opt.ClusterName, result.err.Error())
+			}
+		}(&specs[i])
+	}
+	wg.Wait()
+	printBatch(results)
+	return batchError(results)
+}
+
+func validateBatch(specs []api.CreateClusterOption) error {
+	if len(specs) == 0 {
+		return api.NewValidationError("No cluster is given in the batch")
+	}
+	names := make(map[string]bool)
+	for _, s := range specs {
+		// names which normalize to the same one would race on one tag
+		name := api.NormalizeClusterName(s.ClusterName)
+		if names[name] {
+			return api.NewValidationError("Cluster %s is given more than once in the batch", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+func (r *batchResult) state() string {
+	switch {
+	case r.err == nil:
+		return "ready"
+	case r.summary != nil:
+		return "partial"
+	default:
+		return "failed"
+	}
+}
+
+func printBatch(results []*batchResult) {
+	created := 0
+	for _, r := range results {
+		if r.summary != nil {
+			created++
+		}
+	}
+	if output.IsQuiet() {
+		for _, r := range results {
+			fmt.Fprintf(output.Out, "cluster %s is %s\n", r.name, r.state())
+		}
+		return
+	}
+	fmt.Fprintln(output.Out)
+	w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tRESULT\tDURATION\tAPISERVER\tNODES\tERROR")
+	for _, r := range results {
+		apiServer, nodes, msg := "-", "-", ""
+		if r.summary != nil {
+			apiServer = "https://" + r.summary.APIServer
+			nodes = fmt.Sprintf("%d/%d", len(r.summary.Nodes)-len(r.summary.FailedNodes), len(r.summary.Nodes))
+		}
+		if r.err != nil {
+			msg = strings.SplitN(r.err.Error(), "\n", 2)[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.name, r.state(), r.duration.Round(time.Second), apiServer, nodes, msg)
+	}
+	w.Flush()
+	fmt.Fprintf(output.Out, "\n%d of %d clusters are created\n", created, len(results))
+}
+
+// batchError is nil if all clusters are ready, PartialSuccess if some are created, or the error of the first cluster
+func batchError(results []*batchResult) error {
+	var first error
+	failed := make([]string, 0)
+	created := 0
+	for _, r := range results {
+		if r.summary != nil {
+			created++
+		}
+		if r.err != nil {
+			failed = append(failed, r.name)
+			if first == nil {
+				first = r.err
+			}
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	if created == 0 {
+		return first
+	}
+	return api.WithClass(api.ErrorClassPartialSuccess, fmt.Errorf("%d of %d clusters are not ready: %s", len(failed), len(results), strings.Join(failed, ", ")))
+}
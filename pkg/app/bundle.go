@@ -0,0 +1,112 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// RunCreateBundle starts a machine of the master image of the version, packs what a node installs from the
+// internet into a bundle there, and downloads the bundle, so air-gapped sites are fed from a single file
+func (a *app) RunCreateBundle(opt *api.CreateBundleOption) error {
+	if opt.KubernetesVersion == "" {
+		return api.NewValidationError("KubernetesVersion cannot be empty")
+	}
+	if err := resolveKubernetesVersion(&opt.KubernetesVersion, opt.Zone, opt.Arch); err != nil {
+		return err
+	}
+	if opt.VxNet == "" {
+		return api.NewValidationError("VxNet of the builder cannot be empty")
+	}
+	if opt.Output == "" {
+		opt.Output = bootstrap.BundleFileName(opt.KubernetesVersion, opt.Arch)
+	}
+	if opt.BootstrapLogDir == "" {
+		opt.BootstrapLogDir = filepath.Join(api.ConfigDir(), "logs", "bundle-"+opt.KubernetesVersion)
+	}
+	preset, err := api.PresetFor(opt.KubernetesVersion, opt.Zone, opt.Arch)
+	if err != nil {
+		return err
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	klog.Info("Prepare ssh key")
+	keyid, _, err := a.prepareSSHKey(api.SSHKeyNameOf("bundle-"+opt.KubernetesVersion), opt.UseExistKey)
+	if err != nil {
+		return err
+	}
+	klog.Info("Creating machine to build the bundle")
+	instances, err := a.instanceIface.CreateInstances(&instance.CreateInstancesOption{
+		Name:         "BundleBuilder-" + opt.KubernetesVersion,
+		VxNet:        opt.VxNet,
+		SSHKeyID:     keyid,
+		Count:        1,
+		Role:         api.RoleMaster,
+		ImagesPreset: preset,
+	})
+	if err != nil {
+		klog.Error("Failed to create instance")
+		return err
+	}
+	builder := instances[0]
+	if opt.KeepMachine {
+		klog.Infof("Builder %s [%s] is kept, delete it when it is not needed", builder.ID, builder.IP)
+	} else {
+		defer func() {
+			klog.Infof("Deleting builder %s", builder.ID)
+			if err := a.instanceIface.DeleteInstances([]string{builder.ID}); err != nil {
+				klog.Warningf("Failed to delete machine %s, you have to do it manually. Err: %s", builder.ID, err.Error())
+			}
+		}()
+	}
+	klog.Infof("Building the bundle on %s, it takes minutes to save images", builder.IP)
+	remote := "/root/" + bootstrap.BundleFileName(opt.KubernetesVersion, preset.Arch)
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{
+		ClusterName:       "bundle-" + opt.KubernetesVersion,
+		Zone:              opt.Zone,
+		KubernetesVersion: opt.KubernetesVersion,
+		BootstrapLogDir:   opt.BootstrapLogDir,
+	})
+	checksum, err := bootstrapper.BuildBundle(builder, remote)
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	klog.Infof("Downloading the bundle to %s", opt.Output)
+	if err = a.downloadVerified(builder, remote, opt.Output, checksum); err != nil {
+		return err
+	}
+	klog.Infof("Done, bundle is %s, sha256: %s", opt.Output, checksum)
+	return nil
+}
+
+// downloadVerified downloads remote of machine to local, it is only put there if its sha256 is checksum
+func (a *app) downloadVerified(machine *instance.Instance, remote, local, checksum string) error {
+	partial := local + ".part"
+	f, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partial)
+	hash := sha256.New()
+	err = a.sshRunner.Download(machine.IP, remote, io.MultiWriter(f, hash))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != checksum {
+		return fmt.Errorf("Checksum of the downloaded %s is %s, but it is %s on %s", remote, got, checksum, machine.IP)
+	}
+	return os.Rename(partial, local)
+}
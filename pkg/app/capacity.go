@@ -0,0 +1,140 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// validateFallbacks checks FallbackInstanceTypes and FallbackZones of opt
+func validateFallbacks(opt *api.CreateClusterOption) error {
+	for _, s := range opt.FallbackInstanceTypes {
+		t, err := instance.ParseInstanceType(s)
+		if err != nil {
+			return err
+		}
+		if opt.Arch == api.ArchARM64 && t.ID == "" {
+			return api.NewValidationError("Fallback instance type %s is a family of amd64 machines, give an arm instance type of qingcloud for arch %s", s, opt.Arch)
+		}
+	}
+	for _, zone := range opt.FallbackZones {
+		if zone == "" || zone == opt.Zone {
+			return api.NewValidationError("Fallback zone '%s' must differ from zone %s", zone, opt.Zone)
+		}
+	}
+	return nil
+}
+
+// checkCapacity makes sure the zone offers instance types of master and nodes before anything is created. A role whose
+// type is not offered takes the first offered one of FallbackInstanceTypes, and FallbackZones are tried in order if none is.
+// Only qingcloud instance types are listed by zones, families are left to the create, which falls back by createMachines.
+func (a *app) checkCapacity(opt *api.CreateClusterOption) error {
+	if len(opt.FallbackInstanceTypes) == 0 && len(opt.FallbackZones) == 0 {
+		return nil
+	}
+	reasons := make([]string, 0)
+	for i, zone := range append([]string{opt.Zone}, opt.FallbackZones...) {
+		if i > 0 {
+			if _, err := api.PresetFor(opt.KubernetesVersion, zone, opt.Arch); err != nil {
+				reasons = append(reasons, fmt.Sprintf("zone %s has no images of kubernetes %s", zone, opt.KubernetesVersion))
+				continue
+			}
+			if err := a.init(zone); err != nil {
+				return err
+			}
+		}
+		available, err := a.instanceIface.GetInstanceTypes()
+		if err != nil {
+			return err
+		}
+		master, ok := offeredType(available, opt.MasterInstanceType, opt.FallbackInstanceTypes)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("zone %s offers no instance type of master", zone))
+			continue
+		}
+		node, ok := offeredType(available, opt.NodeInstanceType, opt.FallbackInstanceTypes)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("zone %s offers no instance type of nodes", zone))
+			continue
+		}
+		if zone != opt.Zone {
+			klog.Warningf("Falling back to zone %s, %s", zone, strings.Join(reasons, ", "))
+			opt.Zone = zone
+		}
+		for _, role := range []struct {
+			name    string
+			typ     *string
+			offered string
+		}{{"master", &opt.MasterInstanceType, master}, {"nodes", &opt.NodeInstanceType, node}} {
+			if *role.typ != role.offered {
+				klog.Warningf("Instance type %s of %s is not offered by zone %s, falling back to %s", typeOrClass(*role.typ, opt.InstanceClass), role.name, zone, role.offered)
+				*role.typ = role.offered
+			}
+		}
+		return nil
+	}
+	// services are back to the zone given for what follows the failure, like audit
+	if err := a.init(opt.Zone); err != nil {
+		klog.Warning(err)
+	}
+	return api.WithClass(api.ErrorClassCapacity, fmt.Errorf("No zone has capacity for cluster %s: %s", opt.ClusterName, strings.Join(reasons, ", ")))
+}
+
+// offeredType returns the first of s and fallbacks the zone offers, families and the instance class of "" are taken
+// as offered since zones do not list them
+func offeredType(available []string, s string, fallbacks []string) (string, bool) {
+	for _, candidate := range append([]string{s}, fallbacks...) {
+		if candidate == "" {
+			return candidate, true
+		}
+		t, err := instance.ParseInstanceType(candidate)
+		if err != nil {
+			continue
+		}
+		if t.ID == "" || containsString(available, t.ID) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func typeOrClass(s string, class int) string {
+	if s == "" {
+		return fmt.Sprintf("class %d", class)
+	}
+	return s
+}
+
+// createMachines creates machines of base in the instance type roleType, once the zone has no capacity of it, the types
+// of FallbackInstanceTypes are tried in order, and roleType is set to the one created
+func (a *app) createMachines(opt *api.CreateClusterOption, base *instance.CreateInstancesOption, roleType *string) ([]*instance.Instance, error) {
+	tried := make(map[string]bool)
+	candidates := append([]string{*roleType}, opt.FallbackInstanceTypes...)
+	last := ""
+	var err error
+	for _, t := range candidates {
+		if tried[t] {
+			continue
+		}
+		if len(tried) > 0 {
+			klog.Warningf("Zone %s has no capacity of %s for %s, falling back to %s", opt.Zone, typeOrClass(last, opt.InstanceClass), poolOf(base.Role), typeOrClass(t, opt.InstanceClass))
+		}
+		tried[t] = true
+		last = t
+		createOpt := *base
+		applyInstanceType(&createOpt, t)
+		var instances []*instance.Instance
+		instances, err = a.instanceIface.CreateInstances(&createOpt)
+		if api.ClassOf(err) == api.ErrorClassCapacity {
+			continue
+		}
+		if err == nil {
+			*roleType = t
+		}
+		return instances, err
+	}
+	return nil, err
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+// RunCaptureImage captures a node customized by hand as a node image variant of the kubernetes version of its cluster.
+// The variant is registered in ZoneImagesFile and in the metadata of the cluster, so nodes added by scaling are created from it.
+// The node is drained and reset before it is stopped and captured, it is started and joins again afterwards.
+// A snapshot of an instance is captured as it is instead, no node of the cluster is touched then.
+func (a *app) RunCaptureImage(opt *api.CaptureImageOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if (opt.InstanceID == "") == (opt.SnapshotID == "") {
+		return api.NewValidationError("Either the instance of the node or a snapshot to capture must be given")
+	}
+	if err := validateSnapshotID(opt.SnapshotID); err != nil {
+		return err
+	}
+	if opt.Variant == "" || strings.ContainsAny(opt.Variant, ";=,@ ") {
+		return api.NewValidationError("Invalid variant %q, it cannot be empty or have any of ';=,@ '", opt.Variant)
+	}
+	if opt.BootstrapLogDir == "" {
+		opt.BootstrapLogDir = filepath.Join(api.ConfigDir(), "logs", opt.ClusterName)
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	if a.imageService == nil {
+		return fmt.Errorf("No image service to capture images in zone %s", opt.Zone)
+	}
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	metadata := api.ParseClusterMetadata(t.Description)
+	version := metadata.KubernetesVersion
+	if version == "" {
+		version = api.VersionOfMasterImage(opt.Zone, master.ImageID)
+	}
+	if version == "" {
+		return api.NewValidationError("Cannot tell the kubernetes version of cluster %s, which the variant belongs to", opt.ClusterName)
+	}
+	arch := api.ArchOfMasterImage(opt.Zone, master.ImageID)
+	if _, err = api.PresetFor(version, opt.Zone, arch); err != nil {
+		return err
+	}
+	if opt.ImageName == "" {
+		opt.ImageName = fmt.Sprintf("qks-%s-%s", version, opt.Variant)
+	}
+	if opt.SnapshotID != "" {
+		klog.Infof("Capturing snapshot %s as image %s", opt.SnapshotID, opt.ImageName)
+		imageID, err := a.imageService.CaptureImageFromSnapshot(opt.SnapshotID, opt.ImageName)
+		if err != nil {
+			return err
+		}
+		return a.saveVariant(opt, t.TagID, metadata, version, arch, imageID)
+	}
+	nodes, err := a.poolMachines(opt.ClusterName, t, api.RoleNode)
+	if err != nil {
+		return err
+	}
+	var machine *instance.Instance
+	for _, n := range nodes {
+		if n.ID == opt.InstanceID {
+			machine = n
+		}
+	}
+	if machine == nil {
+		return api.NewValidationError("Instance %s is not a linux node of cluster %s", opt.InstanceID, opt.ClusterName)
+	}
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{
+		ClusterName:       opt.ClusterName,
+		Zone:              opt.Zone,
+		KubernetesVersion: version,
+		BootstrapLogDir:   opt.BootstrapLogDir,
+	})
+	statuses, err := bootstrapper.NodeStatuses(master)
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	for _, s := range statuses {
+		if s.IP != machine.IP {
+			continue
+		}
+		klog.Infof("Draining node %s of %s", s.Name, machine.ID)
+		if err = bootstrapper.DrainNode(master, s.Name); err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		if out, err := bootstrapper.Kubectl(master, "delete node "+s.Name); err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, fmt.Errorf("Failed to delete node %s, err: %s, output: %s", s.Name, err.Error(), strings.TrimSpace(string(out))))
+		}
+	}
+	// the image has to boot as a machine which never joined, or its nodes conflict with the captured one
+	if err = bootstrapper.ResetNode(machine); err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	klog.Infof("Capturing %s as image %s", machine.ID, opt.ImageName)
+	imageID, err := a.imageService.CreateImageBasedInstanceID(machine.ID, opt.ImageName)
+	if startErr := a.instanceIface.StartInstances(machine.ID); startErr != nil {
+		klog.Errorf("Failed to start %s, it is left out of cluster %s, err: %s", machine.ID, opt.ClusterName, startErr.Error())
+		if err == nil {
+			err = startErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = a.saveVariant(opt, t.TagID, metadata, version, arch, imageID); err != nil {
+		return err
+	}
+	return a.rejoinNode(bootstrapper, master, machine.ID)
+}
+
+// saveVariant registers imageID as the variant of opt and makes it the one nodes added to the cluster are created from
+func (a *app) saveVariant(opt *api.CaptureImageOption, tagID string, metadata api.ClusterMetadata, version, arch, imageID string) error {
+	if err := api.SaveNodeImageVariant(api.ZoneImagesFile(), version, opt.Zone, arch, opt.Variant, imageID); err != nil {
+		return err
+	}
+	metadata.NodeImageVariant = opt.Variant
+	if err := a.tagService.SetDescription(tagID, metadata.String()); err != nil {
+		return err
+	}
+	output.Printf("Image %s is node image variant %s of kubernetes %s in zone %s, nodes added to cluster %s are created from it\n",
+		imageID, opt.Variant, version, opt.Zone, opt.ClusterName)
+	return nil
+}
+
+// rejoinNode joins the captured machine again, it is described again as a started instance may get another ip
+func (a *app) rejoinNode(b bootstrap.Interface, master *instance.Instance, id string) error {
+	machine, err := a.instanceIface.GetInstance(id)
+	if err != nil {
+		return err
+	}
+	cmds, err := b.CreateJoinCommands(master, "")
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	joined := []*instance.Instance{machine}
+	if err = b.JoinNodes(cmds.Worker, joined); err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, fmt.Errorf("Node %s is captured but failed to join again, err: %s", id, err.Error()))
+	}
+	if err = b.LabelNodes(master, joined); err != nil {
+		klog.Warningf("Failed to label node %s, err: %s", id, err.Error())
+	}
+	if err = b.SetProviderIDs(master, joined); err != nil {
+		klog.Warningf("Failed to set provider id of node %s, err: %s", id, err.Error())
+	}
+	klog.Infof("Node %s joins cluster again", id)
+	return nil
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"k8s.io/klog"
+)
+
+// ConsoleLines is the number of console lines of an unreachable machine put into its error
+const ConsoleLines = 30
+
+// withConsole adds the console output of machine to err if ssh cannot reach it, so boot failures like a bad image or a
+// kernel panic are told without the web console. The whole output is kept in the bootstrap log dir, and clouds without
+// console output give the status of the instance instead.
+func (a *app) withConsole(opt *api.CreateClusterOption, machine *instance.Instance, err error) error {
+	if !ssh.IsUnreachable(err) {
+		return err
+	}
+	output, consoleErr := []byte(nil), console.ErrNotSupported
+	if a.consoleService != nil {
+		output, consoleErr = a.consoleService.Output(machine.ID)
+	}
+	if consoleErr == nil && len(output) != 0 {
+		redacted := log.Redact(string(output))
+		if opt.BootstrapLogDir != "" {
+			file := filepath.Join(opt.BootstrapLogDir, machine.ID+"-console.log")
+			if writeErr := ioutil.WriteFile(file, []byte(redacted), 0600); writeErr != nil {
+				klog.Warningf("Failed to keep console output of %s in %s, err: %s", machine.ID, file, writeErr.Error())
+			}
+		}
+		// what a machine prints last before it hangs tells why, lines are not picked like logs of kubelet
+		lines := strings.Split(strings.TrimRight(redacted, "\n"), "\n")
+		if len(lines) > ConsoleLines {
+			lines = lines[len(lines)-ConsoleLines:]
+		}
+		return fmt.Errorf("%s\nLast console output of %s:\n%s", err.Error(), machine.ID, strings.Join(lines, "\n"))
+	}
+	if consoleErr != nil && consoleErr != console.ErrNotSupported {
+		klog.Warningf("Failed to get console output of %s, err: %s", machine.ID, consoleErr.Error())
+	}
+	// the status cached before ssh is waited for is stale
+	cache.Invalidate(a.instanceIface)
+	described, descErr := a.instanceIface.GetInstance(machine.ID)
+	if descErr != nil {
+		return err
+	}
+	return fmt.Errorf("%s\nInstance %s is %s with ip %s from image %s, check its console by vnc in the web console of qingcloud",
+		err.Error(), described.ID, described.Status, described.IP, described.ImageID)
+}
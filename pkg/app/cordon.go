@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"k8s.io/klog"
+)
+
+// pools are roles of machines by the names users give, which are also suffixes of instance names
+var pools = map[string]byte{
+	"master":  api.RoleMaster,
+	"node":    api.RoleNode,
+	"winnode": api.RoleWindowsNode,
+}
+
+// RunCordon marks nodes of a pool unschedulable and evicts their pods if asked, for maintenance windows of the cloud
+func (a *app) RunCordon(opt *api.CordonOption) error {
+	action := "cordon"
+	if opt.Drain {
+		action = "drain"
+	}
+	return a.runCordon(opt, action)
+}
+
+// RunUncordon makes nodes of a pool schedulable again
+func (a *app) RunUncordon(opt *api.CordonOption) error {
+	if opt.Drain {
+		return api.NewValidationError("Nodes cannot be drained when uncordoning")
+	}
+	return a.runCordon(opt, "uncordon")
+}
+
+// poolMachines returns machines of cluster t in the pool of role
+func (a *app) poolMachines(name string, t *tag.TagCluster, role byte) ([]*instance.Instance, error) {
+	poolName := instance.GeneateName(name, role)
+	members := make([]*instance.Instance, 0)
+	for _, id := range t.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			return nil, err
+		}
+		if ins.Name == poolName {
+			members = append(members, ins)
+		}
+	}
+	return members, nil
+}
+
+func (a *app) runCordon(opt *api.CordonOption, action string) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	role, ok := pools[opt.Pool]
+	if !ok {
+		names := make([]string, 0, len(pools))
+		for name := range pools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return api.NewValidationError("Unknown pool %s, available pools: %s", opt.Pool, strings.Join(names, ", "))
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	members, err := a.poolMachines(opt.ClusterName, t, role)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return api.NewValidationError("Pool %s of cluster %s has no machines", opt.Pool, opt.ClusterName)
+	}
+	version := api.ParseClusterMetadata(t.Description).KubernetesVersion
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{ClusterName: opt.ClusterName, Zone: opt.Zone, KubernetesVersion: version})
+	nodes, err := bootstrapper.NodeStatuses(master)
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	names := make(map[string]string)
+	for _, n := range nodes {
+		names[n.IP] = n.Name
+	}
+	w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tNODE\tRESULT")
+	failed := 0
+	for _, m := range members {
+		name, ok := names[m.IP]
+		result := action + "ed"
+		switch {
+		case !ok:
+			result = "no node"
+			failed++
+		case action == "drain":
+			if err := bootstrapper.DrainNode(master, name); err != nil {
+				klog.Error(err)
+				result = "failed"
+				failed++
+			} else {
+				result = "drained"
+			}
+		default:
+			if out, err := bootstrapper.Kubectl(master, action+" "+name); err != nil {
+				klog.Errorf("Failed to %s node %s, err: %s, output: %s", action, name, err.Error(), strings.TrimSpace(string(out)))
+				result = "failed"
+				failed++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.ID, name, result)
+	}
+	w.Flush()
+	if failed == 0 {
+		return nil
+	}
+	err = fmt.Errorf("Failed to %s %d of %d nodes in pool %s", action, failed, len(members), opt.Pool)
+	if failed < len(members) {
+		return api.WithClass(api.ErrorClassPartialSuccess, err)
+	}
+	return api.WithClass(api.ErrorClassBootstrap, err)
+}
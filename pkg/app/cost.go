@@ -0,0 +1,156 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+const ResourceTypeInstance = "instance"
+
+// ResourceCost is the cost of all resources of one type
+type ResourceCost struct {
+	Count       int     `json:"count"`
+	Accumulated float64 `json:"accumulated"`
+	Monthly     float64 `json:"monthly"`
+}
+
+// CostReport is the cost of a cluster at a time, in the currency of the account
+type CostReport struct {
+	Time        time.Time                `json:"time"`
+	Cluster     string                   `json:"cluster"`
+	Zone        string                   `json:"zone"`
+	Accumulated float64                  `json:"accumulated"`
+	Monthly     float64                  `json:"monthly"`
+	Resources   map[string]*ResourceCost `json:"resources"`
+}
+
+// DefaultCostHistoryPath is where reports of a cluster are appended if not specified
+func DefaultCostHistoryPath(clusterName string) string {
+	return filepath.Join(api.ConfigDir(), "cost", clusterName+".jsonl")
+}
+
+// RunCost reports accumulated and projected monthly cost of everything tagged with the cluster
+func (a *app) RunCost(opt *api.CostOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if opt.HistoryPath == "" {
+		opt.HistoryPath = DefaultCostHistoryPath(opt.ClusterName)
+	}
+	err := a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	if a.billingService == nil {
+		return api.NewValidationError("Billing is not available in this cloud")
+	}
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	resources := map[string][]string{ResourceTypeInstance: t.Instances}
+	for kind, ids := range t.Resources {
+		// keypairs are free
+		if kind != api.ResourceTypeKeyPair {
+			resources[kind] = ids
+		}
+	}
+	report := &CostReport{Time: time.Now(), Cluster: opt.ClusterName, Zone: opt.Zone, Resources: make(map[string]*ResourceCost)}
+	for kind, ids := range resources {
+		c := &ResourceCost{}
+		for _, id := range ids {
+			lease, err := a.billingService.GetLease(id)
+			if err != nil {
+				return err
+			}
+			if lease == nil {
+				continue
+			}
+			c.Count++
+			c.Accumulated += lease.Accumulated(report.Time)
+			c.Monthly += lease.HourlyPrice() * billing.HoursPerMonth
+		}
+		report.Resources[kind] = c
+		report.Accumulated += c.Accumulated
+		report.Monthly += c.Monthly
+	}
+	last, err := lastCostReport(opt.HistoryPath)
+	if err != nil {
+		klog.Warningf("Failed to read cost history %s, err: %s", opt.HistoryPath, err.Error())
+	}
+	printCostReport(report, last)
+	if err = appendCostReport(opt.HistoryPath, report); err != nil {
+		klog.Warningf("Failed to record cost to %s, err: %s", opt.HistoryPath, err.Error())
+	}
+	return nil
+}
+
+func printCostReport(report, last *CostReport) {
+	kinds := make([]string, 0, len(report.Resources))
+	for kind := range report.Resources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tCOUNT\tACCUMULATED\tMONTHLY")
+	for _, kind := range kinds {
+		c := report.Resources[kind]
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\n", kind, c.Count, c.Accumulated, c.Monthly)
+	}
+	fmt.Fprintf(w, "total\t\t%.2f\t%.2f\n", report.Accumulated, report.Monthly)
+	w.Flush()
+	if last != nil {
+		output.Printf("monthly cost changed by %+.2f since %s\n", report.Monthly-last.Monthly, last.Time.Format(time.RFC3339))
+	}
+}
+
+// lastCostReport returns nil if nothing is recorded yet
+func lastCostReport(path string) (*CostReport, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var last *CostReport
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		r := &CostReport{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, err
+		}
+		last = r
+	}
+	return last, scanner.Err()
+}
+
+func appendCostReport(path string, report *CostReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -1,139 +1,418 @@
 package app
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
-	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/addon"
 	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/cni"
+	"github.com/magicsong/yunify-k8s/pkg/hook"
 	"github.com/magicsong/yunify-k8s/pkg/image"
 	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/manifest"
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
 	"github.com/magicsong/yunify-k8s/pkg/ssh"
-	"github.com/magicsong/yunify-k8s/pkg/sshkey"
 	"github.com/magicsong/yunify-k8s/pkg/tag"
 	"k8s.io/klog"
 )
 
-const KubeconfigFilePath = "/etc/kubernetes/admin.conf"
-
-type App interface {
-	RunCreate(*api.CreateClusterOption) error
-	RunDelete(*api.DeleteClusterOption) error
-	RunCreateImage(*api.CreateImageOption) error
-	RunList(string) error
+// presetOf returns the preset of opt, its node image is the variant of opt if there is one
+func presetOf(opt *api.CreateClusterOption) (api.ImagesPreset, error) {
+	preset, err := api.PresetFor(opt.KubernetesVersion, opt.Zone, opt.Arch)
+	if err != nil {
+		return preset, err
+	}
+	return preset.WithNodeImageVariant(opt.NodeImageVariant)
 }
 
-func NewApp(configFile string) App {
-	return &app{
-		configFile: configFile,
+func (a *app) validateCreateInput(opt *api.CreateClusterOption) error {
+	if err := a.normalizeClusterName(&opt.ClusterName); err != nil {
+		return err
+	}
+	if err := resolveKubernetesVersion(&opt.KubernetesVersion, opt.Zone, opt.Arch); err != nil {
+		return err
+	}
+	preset, err := presetOf(opt)
+	if err != nil {
+		return err
+	}
+	if _, err := bootstrap.KubeadmFor(opt.KubernetesVersion); err != nil {
+		return err
+	}
+	if _, err := bootstrap.OSFor(opt.KubernetesVersion); err != nil {
+		return err
+	}
+	if err := cni.Validate(opt); err != nil {
+		return err
+	}
+	if opt.ResourceGroup != "" && !strings.HasPrefix(opt.ResourceGroup, "rg-") {
+		return api.NewValidationError("Resource group must be an id like rg-xxxx, got %s", opt.ResourceGroup)
+	}
+	if opt.SecurityGroup != "" && !strings.HasPrefix(opt.SecurityGroup, "sg-") {
+		return api.NewValidationError("Security group must be an id like sg-xxxx, got %s", opt.SecurityGroup)
+	}
+	if opt.WindowsNodeInstanceType != "" {
+		if _, err := instance.ParseInstanceType(opt.WindowsNodeInstanceType); err != nil {
+			return err
+		}
+	}
+	if err := validateFallbacks(opt); err != nil {
+		return err
+	}
+	if err := validateDriftPolicy(opt.DriftPolicy); err != nil {
+		return err
+	}
+	for _, s := range []string{opt.MasterInstanceType, opt.NodeInstanceType} {
+		if s == "" {
+			if opt.Arch == api.ArchARM64 {
+				return api.NewValidationError("Instance types of arm must be given by --master-type and --node-type for arch %s", opt.Arch)
+			}
+			continue
+		}
+		t, err := instance.ParseInstanceType(s)
+		if err != nil {
+			return err
+		}
+		// families are instance classes of x86 machines
+		if opt.Arch == api.ArchARM64 && t.ID == "" {
+			return api.NewValidationError("Instance type %s is a family of amd64 machines, give an arm instance type of qingcloud for arch %s", s, opt.Arch)
+		}
+	}
+	if opt.ControlPlaneEndpoint != "" {
+		if _, err := bootstrap.ControlPlaneEndpointFlags(opt.KubernetesVersion, opt.ControlPlaneEndpoint); err != nil {
+			return err
+		}
+	} else if opt.ControlPlaneEndpointResolvable {
+		return api.NewValidationError("ControlPlaneEndpointResolvable needs a control plane endpoint")
+	}
+	if err := bootstrap.ValidateCertSANs(opt.APIServerCertSANs); err != nil {
+		return err
+	}
+	if err := bootstrap.ValidateTeams(opt.Teams); err != nil {
+		return err
+	}
+	if err := validateEtcdVolume(opt); err != nil {
+		return err
+	}
+	if err := bootstrap.ValidateEtcdOption(opt.Etcd); err != nil {
+		return err
+	}
+	if err := bootstrap.ValidateWindowsNodes(opt); err != nil {
+		return err
+	}
+	if opt.WindowsNodeCount > 0 && preset.WindowsNodeImageID == "" {
+		return api.NewValidationError("Kubernetes %s has no windows node image in zone %s, build one and list it as windowsNodeImageID in %s", opt.KubernetesVersion, opt.Zone, api.ZoneImagesFile())
+	}
+	if opt.CACertFile != "" || opt.CAKeyFile != "" {
+		if _, _, err := bootstrap.LoadCA(opt.CACertFile, opt.CAKeyFile); err != nil {
+			return err
+		}
+	}
+	if opt.UserData != "" {
+		if _, err := bootstrap.LoadUserData(opt.UserData); err != nil {
+			return err
+		}
+	}
+	if err := bootstrap.ValidateBootWait(opt.BootWait); err != nil {
+		return err
+	}
+	if err := manifest.ValidateEndpointsFormat(opt.EndpointsFormat); err != nil {
+		return err
+	}
+	if err := validateSnapshotID(opt.NodeSnapshot); err != nil {
+		return err
+	}
+	if opt.NodeSnapshot != "" && opt.NodeImageVariant != "" && opt.NodeImageVariant != opt.NodeSnapshot {
+		return api.NewValidationError("Node snapshot %s and node image variant %s cannot be used together", opt.NodeSnapshot, opt.NodeImageVariant)
+	}
+	if opt.ControlPlanePatchesDir != "" {
+		if _, err := bootstrap.PatchesFlag(opt.KubernetesVersion); err != nil {
+			return err
+		}
+		if _, err := bootstrap.LoadPatches(opt.ControlPlanePatchesDir); err != nil {
+			return err
+		}
+	}
+	for _, image := range opt.PrePullImages {
+		if image == "" || strings.ContainsAny(image, " \t\n'\"$;&|`\\") {
+			return api.NewValidationError("Invalid image to pre-pull: '%s'", image)
+		}
+	}
+	for i := range opt.Registry.Credentials {
+		c := &opt.Registry.Credentials[i]
+		if c.Server == "" || c.Username == "" {
+			return api.NewValidationError("Server and username of registry credentials cannot be empty")
+		}
+		if _, err := c.GetPassword(); err != nil {
+			return err
+		}
+	}
+	if err := addon.Validate(opt); err != nil {
+		return err
 	}
+	if err := validateChecksums(opt); err != nil {
+		return err
+	}
+	if opt.TokenTTL != "" {
+		if _, err := time.ParseDuration(opt.TokenTTL); err != nil {
+			return api.NewValidationError("Invalid token ttl %s, err: %s", opt.TokenTTL, err.Error())
+		}
+	}
+	if opt.Timeout < 0 {
+		return api.NewValidationError("Timeout %s cannot be negative", opt.Timeout)
+	}
+	if opt.DeleteOnTimeout && opt.Timeout == 0 {
+		return api.NewValidationError("DeleteOnTimeout needs a timeout")
+	}
+	return nil
 }
 
-type app struct {
-	instanceIface instance.Interface
-	sshKeyIface   sshkey.Interface
-	tagService    tag.Interface
-	imageService  image.Interface
-	configFile    string
+// validateChecksums makes sure what the cluster downloads has a checksum if they are required, before any resource is created
+func validateChecksums(opt *api.CreateClusterOption) error {
+	if err := bootstrap.ValidateChecksums(opt.Checksums); err != nil {
+		return err
+	}
+	if !opt.RequireChecksums {
+		return nil
+	}
+	if !opt.SkipCNI && opt.CNIName != "" {
+		p, err := cni.Get(opt.CNIName)
+		if err != nil {
+			return err
+		}
+		release, err := cni.ReleaseFor(p, opt.KubernetesVersion, opt.CNIVersion)
+		if err != nil {
+			return err
+		}
+		if release != nil && release.BundledIn == "" {
+			if _, err = bootstrap.ChecksumOf(opt, release.ManifestURL, release.ManifestSHA256); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.WindowsNodeCount > 0 {
+		if _, err := bootstrap.WindowsManifests(opt); err != nil {
+			return err
+		}
+	}
+	for i := range opt.Addons {
+		a, ctx, err := addon.NewContext(&opt.Addons[i], opt)
+		if err != nil {
+			return err
+		}
+		if a.URLs != nil {
+			for _, url := range a.URLs(ctx) {
+				if _, err = bootstrap.ChecksumOf(opt, url, ""); err != nil {
+					return err
+				}
+			}
+		}
+		if a.Chart != nil {
+			if _, err = bootstrap.HelmChecksums(opt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func tagName(name string) string {
-	return fmt.Sprintf("%s%s", api.ClusterTagPrefix, name)
+func (a *app) setCreateDefaults(opt *api.CreateClusterOption) {
+	if opt.ExposeIngress && opt.IngressBandwidth == 0 {
+		opt.IngressBandwidth = api.DefaultIngressBandwidth
+	}
+	if opt.BootstrapLogDir == "" {
+		opt.BootstrapLogDir = filepath.Join(api.ConfigDir(), "logs", opt.ClusterName)
+	}
+	if opt.ScpKubeConfigToLocal {
+		if opt.LocalKubeConfigPath == "" {
+			opt.LocalKubeConfigPath = api.DefaultKubeConfigPath(opt.ClusterName)
+		} else if info, err := os.Stat(opt.LocalKubeConfigPath); err == nil && info.IsDir() {
+			opt.LocalKubeConfigPath = filepath.Join(opt.LocalKubeConfigPath, filepath.Base(api.DefaultKubeConfigPath(opt.ClusterName)))
+		}
+	}
 }
 
-func (a *app) validateCreateInput(opt *api.CreateClusterOption) error {
-	if opt.ClusterName == "" {
-		return fmt.Errorf("ClusterName cannot be empty")
+// checkKubeconfigPath fails before any machine is created rather than after the cluster is up
+func checkKubeconfigPath(opt *api.CreateClusterOption) error {
+	if !opt.ScpKubeConfigToLocal || opt.OverwriteKubeConfig {
+		return nil
+	}
+	if _, err := os.Stat(opt.LocalKubeConfigPath); err == nil {
+		return api.NewValidationError("Kubeconfig %s already exists, use --force to overwrite it", opt.LocalKubeConfigPath)
 	}
 	return nil
 }
+
 func (a *app) RunCreate(opt *api.CreateClusterOption) error {
 	start := time.Now()
 	defer func() {
 		runningTime := time.Since(start)
 		klog.Infof("Finished, time cost(s): %d", runningTime/time.Second)
 	}()
+	addKubeSphere(opt)
 	err := a.validateCreateInput(opt)
 	if err != nil {
 		return err
 	}
-	err = a.init(opt.Zone)
+	a.setCreateDefaults(opt)
+	err = checkKubeconfigPath(opt)
 	if err != nil {
-		klog.Error("Falied to init command")
 		return err
 	}
-	return a.runCreate(opt)
-}
-
-func (a *app) init(zone string) error {
-	klog.Info("Init qingcloud service")
-	keyHelper := accesskey.NewQingCloudAccessKeyHelper(zone, a.configFile)
-	err := keyHelper.Init()
+	err = a.init(opt.Zone)
 	if err != nil {
+		klog.Error("Falied to init command")
 		return err
 	}
-	userid := keyHelper.GetUserID()
-	qcService := keyHelper.GetService()
-	instanceService, _ := qcService.Instance(zone)
-	jobService, _ := qcService.Job(zone)
-	a.instanceIface = instance.NewQingCloudInstanceService(instanceService, jobService)
-	keyService, _ := qcService.KeyPair(zone)
-	a.sshKeyIface = sshkey.NewQingCloudKeyPairService(keyService, userid)
-	tagService, _ := qcService.Tag(zone)
-	a.tagService = tag.NewQingCloudTagService(tagService, userid)
-	imageSerivice, _ := qcService.Image(zone)
-	a.imageService = image.NewQingCloudImageService(instanceService, jobService, imageSerivice, userid)
-	return nil
+	span := a.scope.StartRoot("RunCreate")
+	span.SetAttribute("cluster.name", opt.ClusterName)
+	a.record = audit.NewRecord("create", opt.ClusterName, opt.Zone, opt)
+	a.deadline = newDeadline(opt.Timeout)
+	err = a.runCreate(opt)
+	a.deadline.stop()
+	a.deadline = nil
+	audit.Finish(a.record, a.userID, err)
+	if opt.DeleteOnTimeout && api.ClassOf(err) == api.ErrorClassTimeout {
+		a.deleteTimedOut(opt)
+	}
+	span.Finish(err)
+	metrics.ClustersCreated.Inc(metrics.Result(err))
+	metrics.ObserveOperation("create", start, err)
+	metrics.Push()
+	notify.Send(notify.NewEvent("create", opt.ClusterName, start, err))
+	return err
 }
 
-func (a *app) prepareSSHKey(useExistKey bool) (string, error) {
-	output, err := ioutil.ReadFile(ssh.GetDefaultPublicKeyFile())
+// prepareSSHKey returns the keypair named name, created is false if an existing key is used
+func (a *app) prepareSSHKey(name string, useExistKey bool) (id string, created bool, err error) {
+	output, err := ioutil.ReadFile(a.publicKeyFile)
 	if err != nil {
 		klog.Errorln("Failed to read ssh public key")
-		return "", err
+		return "", false, err
 	}
 	if useExistKey {
 		klog.Info("Try to get exsit keypair")
-		key, err := a.sshKeyIface.GetKeyPairByName(api.SSHKeyName)
-		if err != nil {
-			return "", err
-		}
-		if key != "" {
-			return key, err
+		// keys of the cluster are preferred over the one shared by old versions
+		for _, n := range []string{name, api.SSHKeyName} {
+			key, err := a.sshKeyIface.GetKeyPairByName(n)
+			if err != nil {
+				return "", false, err
+			}
+			if key != "" {
+				return key, false, nil
+			}
 		}
 		klog.Warning("Cannot find any exist key, will create a new one")
 	}
 	klog.Info("Try to create a new ssh key")
-	return a.sshKeyIface.CreateSSHKey(api.SSHKeyName, string(output))
+	id, err = a.sshKeyIface.CreateSSHKey(name, string(output))
+	return id, err == nil, err
+}
+
+// prepareTag returns the tag of the cluster, created is false if an existing tag is used, creation is retried
+// as runs in parallel may race on it
+func (a *app) prepareTag(opt *api.CreateClusterOption) (id string, created bool, err error) {
+	var t *tag.TagCluster
+	var createdID string
+	var lastErr error
+	err = retry.Do(3, time.Second*2, func() error {
+		var newID string
+		t, newID, lastErr = a.getOrCreateTag(opt)
+		if newID != "" {
+			createdID = newID
+		}
+		if lastErr != nil {
+			klog.Warningf("Failed to prepare tag, err: %s", lastErr.Error())
+		}
+		return lastErr
+	})
+	if err != nil {
+		return "", false, lastErr
+	}
+	if err = a.checkOwner(t); err != nil {
+		return "", false, err
+	}
+	return t.TagID, t.TagID == createdID, nil
+}
+
+// getOrCreateTag returns the tag named after the cluster and the id of the tag it created, which is "" if a tag is found
+func (a *app) getOrCreateTag(opt *api.CreateClusterOption) (*tag.TagCluster, string, error) {
+	name := a.tagName(opt.ClusterName)
+	t, err := a.tagService.GetTagClusterByName(name)
+	if err != nil || t != nil {
+		return t, "", err
+	}
+	metadata := api.ClusterMetadata{
+		Owner:               a.owner,
+		ConfirmDeleteByName: opt.ConfirmDeleteByName,
+		Protected:           opt.Protect,
+		KubernetesVersion:   opt.KubernetesVersion,
+		CNIName:             opt.CNIName,
+		PodNetworkCIDR:      opt.PodNetWorkCIDR,
+		NodeImageVariant:    opt.NodeImageVariant,
+		DriftPolicy:         opt.DriftPolicy,
+	}
+	id, err := a.tagService.CreateTag(name, metadata.String())
+	if err != nil {
+		klog.Errorf("Failed to create tag %s", name)
+		return nil, "", err
+	}
+	// another run may have created a tag of the same name meanwhile, all runs agree on the one of the lowest id
+	t, err = a.tagService.GetTagClusterByName(name)
+	if err != nil {
+		return nil, id, err
+	}
+	if t == nil {
+		return nil, id, fmt.Errorf("Tag %s is not found after creation", name)
+	}
+	if t.TagID != id {
+		klog.Warningf("Tag %s is created by another run at the same time, use %s instead of %s", name, t.TagID, id)
+		if err = a.tagService.DeleteTag(id); err != nil {
+			klog.Warningf("Failed to delete duplicated tag %s, err: %s", id, err.Error())
+		}
+	}
+	return t, id, nil
 }
 
 func (a *app) createAllMachines(opt *api.CreateClusterOption, keyid string) (*instance.Instance, []*instance.Instance, error) {
 	var wg sync.WaitGroup
 	klog.Infoln("Creating Master")
-	if _, ok := api.PresetKubernetes[opt.KubernetesVersion]; !ok {
-		return nil, nil, fmt.Errorf(api.ErrorK8sVersionNotSupport, opt.KubernetesVersion)
+	preset, err := presetOf(opt)
+	if err != nil {
+		return nil, nil, err
 	}
 	wg.Add(1)
 	var master *instance.Instance
+	var mu sync.Mutex
 	errs := make([]error, 0)
 	createMasterOpt := &instance.CreateInstancesOption{
 		Name:          opt.ClusterName,
 		VxNet:         opt.VxNet,
 		Count:         1,
 		Role:          api.RoleMaster,
-		ImagesPreset:  api.PresetKubernetes[opt.KubernetesVersion],
+		ImagesPreset:  preset,
 		InstanceClass: opt.InstanceClass,
 		SSHKeyID:      keyid,
+		SecurityGroup: opt.SecurityGroup,
 	}
 	go func() {
 		defer wg.Done()
-		instances, err := a.instanceIface.CreateInstances(createMasterOpt)
+		instances, err := a.createMachines(opt, createMasterOpt, &opt.MasterInstanceType)
 		if err != nil {
+			mu.Lock()
 			errs = append(errs, err)
+			mu.Unlock()
 			return
 		}
 		master = instances[0]
@@ -150,13 +429,16 @@ func (a *app) createAllMachines(opt *api.CreateClusterOption, keyid string) (*in
 			VxNet:         opt.VxNet,
 			Count:         opt.NodeCount,
 			Role:          api.RoleNode,
-			ImagesPreset:  api.PresetKubernetes[opt.KubernetesVersion],
+			ImagesPreset:  preset,
 			InstanceClass: opt.InstanceClass,
 			SSHKeyID:      keyid,
+			SecurityGroup: opt.SecurityGroup,
 		}
-		instances, err := a.instanceIface.CreateInstances(createNodesOpt)
+		instances, err := a.createMachines(opt, createNodesOpt, &opt.NodeInstanceType)
 		if err != nil {
+			mu.Lock()
 			errs = append(errs, err)
+			mu.Unlock()
 			return
 		}
 		for _, machine := range instances {
@@ -168,36 +450,202 @@ func (a *app) createAllMachines(opt *api.CreateClusterOption, keyid string) (*in
 	klog.Infoln("Waiting for machines to start")
 	wg.Wait()
 	if len(errs) != 0 {
-		return nil, nil, fmt.Errorf("Creating Machines failed, errs: %+v", errs)
+		return nil, nil, api.WithClass(api.ClassOf(errs[0]), fmt.Errorf("Creating Machines failed, errs: %+v", errs))
 	}
 	return master, nodes, nil
 }
 
-func (a *app) runCreate(opt *api.CreateClusterOption) error {
-	klog.Info("Prepare Tag")
-	tag := tagName(opt.ClusterName)
-	id, err := a.tagService.GetTagClusterByName(tag)
+// checkImages makes sure images of the preset can be used in the zone before any resource is created
+func (a *app) checkImages(opt *api.CreateClusterOption) error {
+	if a.imageService == nil {
+		return nil
+	}
+	preset, err := presetOf(opt)
 	if err != nil {
-		klog.Error("Failed to get current tag")
 		return err
 	}
-	var tagID string
-	if id != nil {
-		tagID = id.TagID
-	} else {
-		tagID, err = a.tagService.CreateTag(tag)
+	ids := []string{preset.MasterImageID, preset.NodeImageID}
+	if opt.WindowsNodeCount > 0 {
+		ids = append(ids, preset.WindowsNodeImageID)
+	}
+	status, err := a.imageService.GetImageStatus(ids...)
+	if err != nil {
+		klog.Error("Failed to get images")
+		return err
+	}
+	for _, id := range ids {
+		s, ok := status[id]
+		if !ok {
+			s = "not found"
+		}
+		if s != image.StatusAvailable {
+			return api.NewValidationError("Image %s of kubernetes %s is %s in zone %s, build one by 'qks create image <name> -z %s -f <scripts>' and list it in %s", id, opt.KubernetesVersion, s, opt.Zone, opt.Zone, api.ZoneImagesFile())
+		}
+	}
+	return nil
+}
+
+// createWindowsNodes creates windows nodes after the linux machines, they are experimental and never share a CreateInstances call
+func (a *app) createWindowsNodes(opt *api.CreateClusterOption, keyid string) ([]*instance.Instance, error) {
+	klog.Infof("Creating %d windows nodes", opt.WindowsNodeCount)
+	preset, err := api.PresetFor(opt.KubernetesVersion, opt.Zone, opt.Arch)
+	if err != nil {
+		return nil, err
+	}
+	createOpt := &instance.CreateInstancesOption{
+		Name:          opt.ClusterName,
+		VxNet:         opt.VxNet,
+		Count:         opt.WindowsNodeCount,
+		Role:          api.RoleWindowsNode,
+		ImagesPreset:  preset,
+		InstanceClass: opt.InstanceClass,
+		SSHKeyID:      keyid,
+		SecurityGroup: opt.SecurityGroup,
+	}
+	applyInstanceType(createOpt, opt.WindowsNodeInstanceType)
+	instances, err := a.instanceIface.CreateInstances(createOpt)
+	if err != nil {
+		return nil, err
+	}
+	for _, machine := range instances {
+		klog.Infof("Windows node creating done, id=%s, ip=%s", machine.ID, machine.IP)
+	}
+	return instances, nil
+}
+
+// mergeJoinErrors adds failed nodes of windows to those of linux, any other error wins
+func mergeJoinErrors(linux, windows error) error {
+	if windows == nil {
+		return linux
+	}
+	if linux == nil {
+		return windows
+	}
+	l, ok1 := linux.(*bootstrap.JoinError)
+	w, ok2 := windows.(*bootstrap.JoinError)
+	if !ok1 {
+		return linux
+	}
+	if !ok2 {
+		return windows
+	}
+	return &bootstrap.JoinError{Failed: append(l.Failed, w.Failed...), Errs: append(l.Errs, w.Errs...)}
+}
+
+// checkInstanceTypes makes sure instance types given by id are available in the zone
+func (a *app) checkInstanceTypes(opt *api.CreateClusterOption) error {
+	var available []string
+	for _, s := range []string{opt.MasterInstanceType, opt.NodeInstanceType, opt.WindowsNodeInstanceType} {
+		if s == "" {
+			continue
+		}
+		t, err := instance.ParseInstanceType(s)
 		if err != nil {
-			klog.Errorf("Failed to create tag %s", tag)
 			return err
 		}
+		if t.ID == "" {
+			continue
+		}
+		if available == nil {
+			if available, err = a.instanceIface.GetInstanceTypes(); err != nil {
+				return err
+			}
+		}
+		if !containsString(available, t.ID) {
+			return api.NewValidationError("Instance type %s is not available in zone %s, available types: %v", t.ID, opt.Zone, available)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// applyInstanceType sets the size of machines by the instance type of their role
+func applyInstanceType(createOpt *instance.CreateInstancesOption, s string) {
+	if s == "" {
+		return
+	}
+	// already validated by validateCreateInput
+	t, _ := instance.ParseInstanceType(s)
+	t.Apply(createOpt)
+}
+
+func (a *app) runCreate(opt *api.CreateClusterOption) error {
+	if err := a.beginPhase("images"); err != nil {
+		return err
+	}
+	if err := a.checkCapacity(opt); err != nil {
+		return err
+	}
+	if opt.NodeSnapshot != "" {
+		if err := a.useNodeSnapshot(opt); err != nil {
+			return err
+		}
+	}
+	klog.Info("Checking images")
+	if err := a.checkImages(opt); err != nil {
+		return err
+	}
+	if err := a.checkInstanceTypes(opt); err != nil {
+		return err
+	}
+	if opt.ResourceGroup != "" {
+		if err := a.resourceGroupService.CheckResourceGroup(opt.ResourceGroup); err != nil {
+			return err
+		}
+	}
+	if opt.SecurityGroup != "" {
+		if err := a.securityGroupService.CheckSecurityGroup(opt.SecurityGroup); err != nil {
+			return err
+		}
+	}
+	if err := a.runHooks(createHookContext(hook.PreCreate, opt, "")); err != nil {
+		return err
+	}
+	if err := a.beginPhase("tag"); err != nil {
+		return err
+	}
+	if err := a.checkNameAvailable(opt); err != nil {
+		return err
+	}
+	klog.Info("Prepare Tag")
+	tagID, createdTag, err := a.prepareTag(opt)
+	if err != nil {
+		return err
+	}
+	// the record keeps what this run creates only, it is what a timed out create deletes
+	if createdTag {
+		a.record.AddResource("tag", tagID)
+	}
+	if err := a.beginPhase("keypair"); err != nil {
+		return err
 	}
 	klog.Info("Prepare ssh key")
-	keyid, err := a.prepareSSHKey(opt.UseExistKey)
+	keyid, created, err := a.prepareSSHKey(api.SSHKeyNameOf(opt.ClusterName), opt.UseExistKey)
 	if err != nil {
 		return err
 	}
+	if created {
+		a.record.AddResource("keypair", keyid)
+		// the key belongs to this cluster only, tag it so it is deleted with the cluster
+		if err = a.tagService.TagResources(tagID, api.ResourceTypeKeyPair, []string{keyid}); err != nil {
+			return err
+		}
+	}
+	if err := a.beginPhase("instances"); err != nil {
+		return err
+	}
 	//create master
+	phaseStart := time.Now()
 	master, nodes, err := a.createAllMachines(opt, keyid)
+	metrics.ObservePhase("create", "instances", phaseStart)
 	if err != nil {
 		klog.Error("Failed to create machines")
 		return err
@@ -207,139 +655,498 @@ func (a *app) runCreate(opt *api.CreateClusterOption) error {
 	for _, node := range nodes {
 		machines = append(machines, node.ID)
 	}
+	a.record.AddResource("instance", machines...)
 	err = a.tagService.TagInstances(tagID, machines)
 	if err != nil {
 		return err
 	}
+	var windowsNodes []*instance.Instance
+	if opt.WindowsNodeCount > 0 {
+		// linux machines are tagged already, so they are deleted with the cluster if this fails
+		if windowsNodes, err = a.createWindowsNodes(opt, keyid); err != nil {
+			klog.Error("Failed to create windows nodes")
+			return err
+		}
+		ids := make([]string, 0, len(windowsNodes))
+		for _, node := range windowsNodes {
+			ids = append(ids, node.ID)
+		}
+		a.record.AddResource("instance", ids...)
+		if err = a.tagService.TagInstances(tagID, ids); err != nil {
+			return err
+		}
+		machines = append(machines, ids...)
+	}
+	resources := append([]string{tagID}, machines...)
+	etcdDevice := ""
+	if opt.EtcdVolumeSize > 0 {
+		klog.Info("Creating etcd volume of master")
+		var volumeID string
+		volumeID, etcdDevice, err = a.createEtcdVolume(tagID, opt, master)
+		if err != nil {
+			klog.Error("Failed to create etcd volume")
+			return err
+		}
+		resources = append(resources, volumeID)
+	}
+	if opt.ResourceGroup != "" {
+		klog.Infof("Adding resources to resource group %s", opt.ResourceGroup)
+		// the shared ssh key is not owned by the cluster, so it is left out
+		if err = a.resourceGroupService.AddResources(opt.ResourceGroup, resources); err != nil {
+			return err
+		}
+	}
+	if opt.ResourcesManifest != "" {
+		if err = a.writeResourcesManifest(opt); err != nil {
+			// resources are created anyway, 'qks export cluster' can write it again
+			klog.Warningf("Failed to write resources manifest %s, err: %s", opt.ResourcesManifest, err.Error())
+		}
+	}
+	hookCtx := createHookContext(hook.PostInstances, opt, tagID)
+	addHookMachines(hookCtx, api.RoleMaster, master)
+	addHookMachines(hookCtx, api.RoleNode, nodes...)
+	addHookMachines(hookCtx, api.RoleWindowsNode, windowsNodes...)
+	if err = a.runHooks(hookCtx); err != nil {
+		return err
+	}
+	if err := a.beginPhase("bootstrap"); err != nil {
+		return err
+	}
 	klog.Infoln("Machines are ready, bring the cluster up")
-	joinCmd, err := bootstrapMaster(master, opt)
+	bootstrapper := a.newBootstrapper(a.sshRunner, opt)
+	phaseStart = time.Now()
+	if etcdDevice != "" {
+		klog.Infof("Mounting %s at %s on master", etcdDevice, bootstrap.EtcdDataDir)
+		if err = bootstrapper.MountEtcdVolume(master, etcdDevice); err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+	}
+	joinCmd, err := bootstrapper.InitMaster(master)
+	metrics.ObservePhase("create", "bootstrap", phaseStart)
 	if err != nil {
 		klog.Errorln("Failed to bootstrap master node")
+		return api.WithClass(api.ErrorClassBootstrap, a.withConsole(opt, master, err))
+	}
+	if err := a.beginPhase("cni"); err != nil {
 		return err
 	}
 	if !opt.SkipCNI {
 		klog.Info("Applying CNI")
-		err = applyCNI(opt, master.IP)
+		phaseStart = time.Now()
+		err = bootstrapper.ApplyCNI(master)
+		metrics.ObservePhase("create", "cni", phaseStart)
 		if err != nil {
 			klog.Errorf("Failed to apply CNI plugin %s", opt.CNIName)
-			return err
+			return api.WithClass(api.ErrorClassBootstrap, err)
 		}
 		klog.Info("CNI is applied now")
 	} else {
 		klog.Info("Skipping creating CNI")
 	}
+	if err := a.beginPhase("join"); err != nil {
+		return err
+	}
 	klog.Infof("Joining nodes, cmd: %s", joinCmd)
-	err = joinNodes(joinCmd, nodes)
-	if err != nil {
-		klog.Error("Failed to join nodes")
+	summary := &ClusterSummary{
+		Name:              opt.ClusterName,
+		Zone:              opt.Zone,
+		KubernetesVersion: opt.KubernetesVersion,
+		CNIName:           opt.CNIName,
+		Master:            master,
+		Nodes:             nodes,
+	}
+	endpoint := bootstrap.ControlPlaneEndpointOf(opt, master)
+	summary.APIServer = endpoint.Address()
+	if endpoint.PinnedIP != "" {
+		summary.EndpointHost = endpoint.Host
+	}
+	hookCtx.Point = hook.PreJoin
+	hookCtx.APIServer = summary.APIServer
+	if err = a.runHooks(hookCtx); err != nil {
+		return err
+	}
+	phaseStart = time.Now()
+	joinErr := bootstrapper.JoinNodes(joinCmd, nodes)
+	if len(windowsNodes) != 0 {
+		klog.Infof("Joining %d windows nodes", len(windowsNodes))
+		summary.Nodes = append(summary.Nodes, windowsNodes...)
+		joinErr = mergeJoinErrors(joinErr, bootstrapper.JoinWindowsNodes(master, a.windowsRunner, joinCmd, windowsNodes))
+	}
+	metrics.ObservePhase("create", "join", phaseStart)
+	// the token is useless once nodes have joined, failed ones can be joined later by 'qks get join-command'
+	if err = bootstrapper.DeleteToken(master, joinCmd); err != nil {
+		klog.Warningf("Failed to delete the bootstrap token, it expires by its ttl, err: %s", err.Error())
+	}
+	if joinErr != nil {
+		partial, ok := joinErr.(*bootstrap.JoinError)
+		if !ok {
+			klog.Error("Failed to join nodes")
+			return api.WithClass(api.ErrorClassBootstrap, joinErr)
+		}
+		klog.Errorf("%d nodes failed to join, the cluster is usable but they need repair", len(partial.Failed))
+		for i, n := range partial.Failed {
+			partial.Errs[i] = a.withConsole(opt, n, partial.Errs[i])
+		}
+		summary.FailedNodes = partial.Failed
+		joinErr = api.WithClass(api.ErrorClassPartialSuccess, joinErr)
+	}
+	if err := a.beginPhase("verify-nodes"); err != nil {
+		return err
+	}
+	klog.Info("Verifying machines are registered as nodes")
+	joined := append([]*instance.Instance{master}, joinedNodes(append(nodes, windowsNodes...), summary.FailedNodes)...)
+	if err = bootstrapper.VerifyNodes(master, joined); err != nil {
+		klog.Errorf("Failed to verify nodes, err: %s", err.Error())
+		if unregistered, ok := err.(*bootstrap.UnregisteredError); ok {
+			// they are repaired like nodes failing to join
+			summary.FailedNodes = append(summary.FailedNodes, unregistered.Machines...)
+		}
+		if joinErr == nil {
+			joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+		}
+	}
+	if err := a.beginPhase("label"); err != nil {
+		return err
+	}
+	klog.Info("Labeling nodes with their instances")
+	labeled := append([]*instance.Instance{master}, joinedNodes(append(nodes, windowsNodes...), summary.FailedNodes)...)
+	if err = bootstrapper.LabelNodes(master, labeled); err != nil {
+		klog.Errorf("Failed to label nodes, err: %s", err.Error())
+		if joinErr == nil {
+			joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+		}
+	}
+	if err = bootstrapper.SetProviderIDs(master, labeled); err != nil {
+		klog.Errorf("Failed to set provider id of nodes, err: %s", err.Error())
+		if joinErr == nil {
+			joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+		}
+	}
+	if err := a.beginPhase("network-check"); err != nil {
+		return err
+	}
+	if !opt.SkipCNI && !opt.SkipNetworkCheck {
+		klog.Info("Checking network of the cluster")
+		phaseStart = time.Now()
+		err = bootstrapper.CheckNetwork(master)
+		metrics.ObservePhase("create", "network-check", phaseStart)
+		if err != nil {
+			klog.Error("Network of the cluster is broken")
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+	}
+	if err := a.beginPhase("registries"); err != nil {
+		return err
+	}
+	if len(opt.Registry.Credentials) != 0 {
+		klog.Info("Configuring registry credentials")
+		if err = bootstrapper.ConfigureRegistries(master, joinedNodes(nodes, summary.FailedNodes)); err != nil {
+			klog.Errorf("Failed to configure registry credentials, err: %s", err.Error())
+			if joinErr == nil {
+				// the cluster works, only pulls from private registries fail
+				joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+			}
+		}
+	}
+	if err := a.beginPhase("teams"); err != nil {
+		return err
+	}
+	if len(opt.Teams) != 0 {
+		klog.Info("Creating namespaces of teams")
+		manifest, err := bootstrap.TeamsManifest(opt.Teams)
+		if err == nil {
+			err = bootstrapper.ApplyManifest(master, bootstrap.TeamsManifestName, manifest)
+		}
+		if err != nil {
+			klog.Errorf("Failed to create namespaces of teams, err: %s", err.Error())
+			if joinErr == nil {
+				// the cluster works, teams can be created by kubectl later
+				joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+			}
+		}
+	}
+	if err := a.beginPhase("ingress"); err != nil {
+		return err
+	}
+	if opt.ExposeIngress {
+		klog.Info("Exposing ingress")
+		summary.IngressAddress, err = a.exposeIngress(tagID, opt, append(joinedNodes(nodes, summary.FailedNodes), master))
+		if err != nil {
+			klog.Errorf("Failed to expose ingress, err: %s", err.Error())
+			if joinErr == nil {
+				joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+			}
+		}
+	}
+	if err := a.beginPhase("addons"); err != nil {
+		return err
+	}
+	if err = a.installAddons(bootstrapper, master, opt); err != nil {
+		klog.Errorf("Failed to install addons, err: %s", err.Error())
+		if joinErr == nil {
+			joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+		}
+	} else if installsKubeSphere(opt) {
+		klog.Info("Waiting for ks-installer to finish")
+		phaseStart = time.Now()
+		summary.KubeSphereConsole, err = waitKubeSphere(bootstrapper, master)
+		metrics.ObservePhase("create", "kubesphere", phaseStart)
+		if err != nil {
+			klog.Errorf("Failed to install KubeSphere, err: %s", err.Error())
+			if joinErr == nil {
+				joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+			}
+		}
+	}
+	if err := a.beginPhase("pre-pull"); err != nil {
+		return err
+	}
+	if len(opt.PrePullImages) != 0 {
+		klog.Infof("Pre-pulling %d images on nodes", len(opt.PrePullImages))
+		phaseStart = time.Now()
+		err = bootstrapper.PrePullImages(joinedNodes(nodes, summary.FailedNodes))
+		metrics.ObservePhase("create", "pre-pull", phaseStart)
+		if err != nil {
+			// nodes pull images on demand anyway
+			klog.Warningf("Pre-pulling images is incomplete, err: %s", err.Error())
+		}
+	}
+	if err := a.beginPhase("kubeconfig"); err != nil {
 		return err
 	}
 	if opt.ScpKubeConfigToLocal {
 		klog.Infoln("Transfer kubeconfig to local")
-		err = transferKubeconfigToLocal(master.IP, opt.LocalKubeConfigPath)
+		err = transferKubeconfigToLocal(bootstrapper, master, opt.LocalKubeConfigPath, opt.OverwriteKubeConfig)
 		if err != nil {
 			klog.Error("Failed to transfer kubeconfig")
 			return err
 		}
-		klog.Infof("kubeconfig has been copied to local, type 'export KUBECONFIG=%s/kubeconfig; kubectl cluster-info' to have a try", opt.LocalKubeConfigPath)
+		klog.Infof("kubeconfig has been copied to local, type 'export KUBECONFIG=%s; kubectl cluster-info' to have a try", opt.LocalKubeConfigPath)
+		summary.KubeconfigPath = opt.LocalKubeConfigPath
 	}
-	klog.Infof("Congratulations! The cluster is ready now, the master is [ID: %s,IP: %s], check it out", master.ID, master.IP)
-	return nil
+	hookCtx.Point = hook.PostCreate
+	if err = a.runHooks(hookCtx); err != nil {
+		klog.Errorln(err)
+		// the cluster is up anyway, only what the hook does is missing
+		if joinErr == nil {
+			joinErr = api.WithClass(api.ErrorClassPartialSuccess, err)
+		}
+	}
+	if joinErr == nil {
+		klog.Infof("Congratulations! The cluster is ready now, the master is [ID: %s,IP: %s], check it out", master.ID, master.IP)
+	}
+	if opt.EndpointsFile != "" {
+		if err = a.endpointsOf(summary).Write(opt.EndpointsFile, opt.EndpointsFormat); err != nil {
+			// the cluster is up anyway, automation depending on the file fails by its own
+			klog.Warningf("Failed to write endpoints %s, err: %s", opt.EndpointsFile, err.Error())
+		}
+	}
+	summary.Duration = time.Since(a.record.Time)
+	if a.onSummary != nil {
+		a.onSummary(summary)
+	} else {
+		summary.Print(output.Out)
+	}
+	return joinErr
 }
 
-func joinNodes(cmd string, nodes []*instance.Instance) error {
-	var wg sync.WaitGroup
-	errs := []error{}
-	for _, node := range nodes {
-		wg.Add(1)
-		go func(n *instance.Instance) {
-			defer wg.Done()
-			bytes, err := ssh.QuickConnectAndGetRunOutput(n.IP, cmd)
-			klog.V(2).Info(string(bytes))
-			if err != nil {
-				klog.Errorf("Failed to join %s %s to cluster", n.ID, n.IP)
-				errs = append(errs, err)
-			} else {
-				klog.Infof("%s has successfully joined the cluster", n.IP)
-			}
-		}(node)
+// deleteTimedOut deletes what a create which ran out of its timeout created, the deletion itself is not bounded.
+// Only resources in the record of the create are deleted, so instances of an adopted or protected cluster are kept.
+// Failures are only logged, the timeout is what the create returns.
+func (a *app) deleteTimedOut(opt *api.CreateClusterOption) {
+	created := a.record.Resources
+	if len(created) == 0 {
+		return
 	}
-	wg.Wait()
-	if len(errs) != 0 {
-		return fmt.Errorf("Joining nodes failed, errs: %+v", errs)
+	klog.Warningf("Deleting what the create of cluster %s created as it timed out", opt.ClusterName)
+	deleteOpt := &api.DeleteClusterOption{ClusterName: opt.ClusterName, ForceDelete: true, Zone: opt.Zone}
+	createRecord := a.record
+	a.record = audit.NewRecord("delete", opt.ClusterName, opt.Zone, deleteOpt)
+	err := a.deleteCreated(opt.ClusterName, created)
+	audit.Finish(a.record, a.userID, err)
+	a.record = createRecord
+	if err != nil {
+		klog.Errorf("Failed to delete what the create of cluster %s created, delete them by hand, err: %s", opt.ClusterName, err.Error())
 	}
-	return nil
 }
 
-func generateKubeadmInitCmd(opt api.NetworkOption, version string) (string, error) {
-	if opt.PodNetWorkCIDR == "" {
-		return "", fmt.Errorf("Must specify a network for pod")
+// deleteCreated deletes resources by kind in the order of runDelete, instances go first as eips and volumes must be
+// detached before. The tag is deleted only with all it holds, which is the case if this run created it.
+func (a *app) deleteCreated(name string, created map[string][]string) error {
+	if ids := created["instance"]; len(ids) > 0 {
+		if err := a.instanceIface.DeleteInstances(ids); err != nil {
+			return err
+		}
+		a.record.AddResource("instance", ids...)
 	}
-
-	if opt.CNIName == api.CalicoCNI || opt.CNIName == api.FlannelCNI || opt.CNIName == api.HostnicCNI {
-		return fmt.Sprintf("kubeadm init --pod-network-cidr=%s --kubernetes-version=v%s", opt.PodNetWorkCIDR, version), nil
+	tagged := &tag.TagCluster{Resources: map[string][]string{
+		api.ResourceTypeEIP:     created[api.ResourceTypeEIP],
+		api.ResourceTypeVolume:  created[api.ResourceTypeVolume],
+		api.ResourceTypeKeyPair: created["keypair"],
+	}}
+	if err := a.deleteTaggedResources(&api.DeleteClusterOption{}, tagged); err != nil {
+		return err
+	}
+	for _, id := range created["tag"] {
+		if err := a.tagService.DeleteTag(id); err != nil {
+			return err
+		}
+		a.record.AddResource("tag", id)
+		removeLocalKubeconfig(name)
 	}
+	return nil
+}
 
-	return "", fmt.Errorf("CNI plugin %s is not supported right now", opt.CNIName)
+// installAddons applies addons in order, it stops at the first failure as later ones may depend on it.
+// Versions of installed addons are saved in the cluster metadata for later upgrades.
+func (a *app) installAddons(b bootstrap.Interface, master *instance.Instance, opt *api.CreateClusterOption) error {
+	if len(opt.Addons) == 0 {
+		return nil
+	}
+	installed := make(map[string]string)
+	defer a.saveAddonVersions(opt.ClusterName, installed)
+	for i := range opt.Addons {
+		o := &opt.Addons[i]
+		klog.Infof("Installing addon %s", o.Name)
+		ad, ctx, err := addon.NewContext(o, opt)
+		if err == nil {
+			err = installAddon(b, master, ad, ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to install addon %s, err: %s", o.Name, err.Error())
+		}
+		installed[o.Name] = ctx.Version
+	}
+	return nil
 }
 
-func bootstrapMaster(master *instance.Instance, opt *api.CreateClusterOption) (string, error) {
-	cmd, err := generateKubeadmInitCmd(opt.NetworkOption, opt.KubernetesVersion)
-	if err != nil {
-		return "", err
+func installAddon(b bootstrap.Interface, master *instance.Instance, a *addon.Addon, ctx *addon.Context) error {
+	if a.URLs != nil {
+		for _, url := range a.URLs(ctx) {
+			if err := b.ApplyURL(master, url); err != nil {
+				return err
+			}
+		}
 	}
-	output, err := ssh.QuickConnectAndGetRunOutput(master.IP, cmd)
-	defer klog.V(1).Infoln(string(output))
-	if err != nil {
-		klog.Errorln("Failed to run 'kubeadm init'")
-		return "", err
+	if a.Chart != nil {
+		values, err := a.Values(ctx)
+		if err != nil {
+			return err
+		}
+		release := &bootstrap.HelmRelease{
+			Name:      a.Name,
+			Namespace: a.Chart.Namespace,
+			Repo:      a.Chart.Repo,
+			RepoURL:   a.Chart.RepoURL,
+			Chart:     a.Chart.Name,
+			Version:   ctx.Version,
+			Values:    values,
+		}
+		if err = b.InstallHelmRelease(master, release); err != nil {
+			return err
+		}
+	}
+	if a.WaitNamespace != "" {
+		cmd := fmt.Sprintf("wait --for=condition=Available deployment --all -n %s --timeout=%s", a.WaitNamespace, addon.DefaultWaitTimeout)
+		if output, err := b.Kubectl(master, cmd); err != nil {
+			return fmt.Errorf("Deployments in %s are not available, output: %s", a.WaitNamespace, string(output))
+		}
+	}
+	if a.Manifests == nil {
+		return nil
+	}
+	manifest, err := a.Manifests(ctx)
+	if err != nil || len(manifest) == 0 {
+		return err
 	}
-	klog.Info("Getting 'kubeadm join'")
-	return GetKubeJoinFromOutput(string(output)), nil
+	return b.ApplyManifest(master, "addon-"+a.Name, manifest)
 }
 
-func buildShellScripts(scripts []string) string {
-	var buf bytes.Buffer
-	buf.WriteString("#!/bin/bash\n")
-	buf.WriteString("swapoff -a\n")
-	for _, s := range scripts {
-		buf.WriteString(s)
-		buf.WriteString("\n")
-	}
-	return buf.String()
+// joinedNodes returns nodes which are not in failed
+func joinedNodes(nodes, failed []*instance.Instance) []*instance.Instance {
+	result := make([]*instance.Instance, 0, len(nodes))
+	for _, n := range nodes {
+		ok := true
+		for _, f := range failed {
+			if f.ID == n.ID {
+				ok = false
+			}
+		}
+		if ok {
+			result = append(result, n)
+		}
+	}
+	return result
 }
 
-func GetKubeJoinFromOutput(output string) string {
-	output = strings.TrimSpace(output)
-	index := strings.LastIndex(output, "kubeadm join")
-	output = output[index:]
-	if i := strings.Index(output, "\\"); i != -1 {
-		// new line exists
-		l := strings.Index(output, "--discovery-token-ca-cert-hash")
-		if l == -1 {
-			panic("cannot find kubeadm join")
-		}
-		return output[:i] + output[l:]
-	}
-	return output
+func transferKubeconfigToLocal(b bootstrap.Interface, master *instance.Instance, localPath string, overwrite bool) error {
+	bytes, err := b.FetchKubeconfig(master)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(localPath), 0700)
+	if err != nil {
+		klog.Errorf("Failed to create directory of kubeconfig %s", localPath)
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flag |= os.O_EXCL
+	}
+	f, err := os.OpenFile(localPath, flag, 0600)
+	if os.IsExist(err) {
+		return api.NewValidationError("Kubeconfig %s already exists, use --force to overwrite it", localPath)
+	}
+	if err != nil {
+		klog.Error("Failed to write kubeconfig")
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(bytes)
+	if err != nil {
+		klog.Error("Failed to write kubeconfig")
+		return err
+	}
+	return nil
 }
 
-func applyCNI(opt *api.CreateClusterOption, masterip string) error {
-	preset := api.PresetKubernetes[opt.KubernetesVersion]
-	cmd := fmt.Sprintf("bash %s -n %s --pod-cidr %s --mode %s", ScriptsLocation+preset.CNICmd, opt.CNIName, opt.PodNetWorkCIDR, opt.Mode)
-	return ssh.QuickConnectAndRun(masterip, cmd)
+// endpointsOf tells how machines of the summarized cluster are reached, nodes which failed to join are left out
+func (a *app) endpointsOf(summary *ClusterSummary) *manifest.Endpoints {
+	e := &manifest.Endpoints{
+		Cluster:    summary.Name,
+		Zone:       summary.Zone,
+		APIServer:  summary.APIServer,
+		MasterIP:   summary.Master.IP,
+		SSHUser:    sshUser,
+		SSHKeyFile: a.privateKeyFile(),
+		Kubeconfig: summary.KubeconfigPath,
+	}
+	windowsName := instance.GeneateName(summary.Name, api.RoleWindowsNode)
+	for _, n := range summary.Nodes {
+		if summary.nodeStatus(n) != "joined" {
+			continue
+		}
+		if n.Name == windowsName {
+			e.WindowsSSHUser = ssh.WindowsUser
+			e.WindowsNodeIPs = append(e.WindowsNodeIPs, n.IP)
+		} else {
+			e.NodeIPs = append(e.NodeIPs, n.IP)
+		}
+	}
+	return e
 }
 
-func transferKubeconfigToLocal(masterip, localPath string) error {
-	bytes, err := ssh.QuickConnectAndGetRunOutput(masterip, "cat /etc/kubernetes/admin.conf")
+func (a *app) writeResourcesManifest(opt *api.CreateClusterOption) error {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
 	if err != nil {
-		klog.Errorf(string(bytes))
 		return err
 	}
-	err = ioutil.WriteFile(localPath+"/kubeconfig", bytes, 0600)
+	if t == nil {
+		return fmt.Errorf("Cannot find tag of cluster %s", opt.ClusterName)
+	}
+	resources, err := a.clusterResources(opt.ClusterName, opt.Zone, t)
 	if err != nil {
-		klog.Error("Failed to write kubeconfig")
 		return err
 	}
-	return nil
+	return resources.Write(opt.ResourcesManifest)
 }
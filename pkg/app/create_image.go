@@ -2,19 +2,19 @@ package app
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"path"
 	"time"
 
 	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
 	"github.com/magicsong/yunify-k8s/pkg/instance"
 	"github.com/magicsong/yunify-k8s/pkg/ssh"
 	"k8s.io/klog"
 )
 
 const (
-	ScriptsLocation = "/root/scripts/"
+	ScriptsLocation = bootstrap.ScriptsLocation
 )
 
 var defaultImage = api.ImagesPreset{
@@ -50,6 +50,7 @@ func (a *app) createImageInstance(opt *api.CreateImageOption, sshkey string) (*i
 		InstanceClass: 101,
 		ImagesPreset:  defaultImage,
 	}
+	createInstanceOpt.InstanceType = opt.InstanceInfo.InstanceType
 	if opt.InstanceInfo.Role == api.RoleMaster {
 		createInstanceOpt.MasterImageID = opt.InstanceInfo.BaseImage
 	} else {
@@ -78,7 +79,7 @@ func (a *app) RunCreateImage(opt *api.CreateImageOption) error {
 
 func (a *app) runCreateImage(opt *api.CreateImageOption) error {
 	klog.Info("Prepare ssh key")
-	keyid, err := a.prepareSSHKey(opt.InstanceInfo.UseExistKey)
+	keyid, _, err := a.prepareSSHKey(api.SSHKeyNameOf("image-"+opt.ImageName), opt.InstanceInfo.UseExistKey)
 	if err != nil {
 		return err
 	}
@@ -95,7 +96,7 @@ func (a *app) runCreateImage(opt *api.CreateImageOption) error {
 		klog.Error("Failed to add host to known_hosts")
 		return err
 	}
-	err = ssh.QuickConnectAndRun(inst.IP, "mkdir -p "+ScriptsLocation)
+	err = a.sshRunner.Run(inst.IP, "mkdir -p "+ScriptsLocation)
 	if err != nil {
 		klog.Error("Falied to create <scripts> folder")
 		return err
@@ -140,18 +141,7 @@ func (a *app) runCreateImage(opt *api.CreateImageOption) error {
 }
 
 func runScript(masterip string, script string) error {
-	session, err := ssh.QuickConnectUsingDefaultSSHKey(masterip)
-	if err != nil {
-		return err
-	}
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
-
-	err = session.Run("bash " + script)
-	if err != nil {
-		return err
-	}
-	return nil
+	return ssh.QuickConnectAndRun(masterip, "bash "+script)
 }
 
 func transferFolder(ip, folder string) error {
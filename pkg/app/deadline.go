@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// TimeoutError is returned when an operation runs out of its timeout, it tells what is done before
+type TimeoutError struct {
+	Timeout time.Duration
+	// Phase is the one which is not begun
+	Phase     string
+	Completed []string
+	// Resources are the cloud resources created or deleted so far, by kind
+	Resources map[string][]string
+}
+
+func (e *TimeoutError) Error() string {
+	completed := "none"
+	if len(e.Completed) != 0 {
+		completed = strings.Join(e.Completed, ", ")
+	}
+	kinds := make([]string, 0, len(e.Resources))
+	for kind := range e.Resources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	resources := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		resources = append(resources, kind+"="+strings.Join(e.Resources[kind], ","))
+	}
+	if len(resources) == 0 {
+		resources = append(resources, "none")
+	}
+	return fmt.Sprintf("Timeout %s is exceeded before phase %s, completed phases: %s, resources: %s",
+		e.Timeout, e.Phase, completed, strings.Join(resources, " "))
+}
+
+// deadline bounds the runtime of an operation. Calls to qingcloud and ssh cannot be interrupted,
+// so it is checked whenever a phase begins and the running phase always finishes, waits inside a phase like
+// the ones of instances, boot and join are bounded by their own timeouts only.
+type deadline struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	timeout   time.Duration
+	current   string
+	completed []string
+}
+
+// newDeadline returns a deadline after timeout, there is none if timeout is 0
+func newDeadline(timeout time.Duration) *deadline {
+	d := &deadline{timeout: timeout}
+	if timeout > 0 {
+		d.ctx, d.cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		d.ctx, d.cancel = context.WithCancel(context.Background())
+	}
+	return d
+}
+
+// begin marks the running phase completed and begins phase, it fails once the deadline is exceeded.
+// A nil deadline never fails.
+func (d *deadline) begin(phase string, resources map[string][]string) error {
+	if d == nil {
+		return nil
+	}
+	if d.current != "" {
+		d.completed = append(d.completed, d.current)
+		d.current = ""
+	}
+	if d.ctx.Err() != nil {
+		return api.WithClass(api.ErrorClassTimeout, &TimeoutError{
+			Timeout:   d.timeout,
+			Phase:     phase,
+			Completed: append([]string{}, d.completed...),
+			Resources: resources,
+		})
+	}
+	d.current = phase
+	return nil
+}
+
+func (d *deadline) stop() {
+	if d != nil {
+		d.cancel()
+	}
+}
+
+// beginPhase begins phase of the running operation, it fails if the operation runs out of its timeout
+func (a *app) beginPhase(phase string) error {
+	resources := make(map[string][]string)
+	if a.record != nil {
+		for kind, ids := range a.record.Resources {
+			resources[kind] = append([]string{}, ids...)
+		}
+	}
+	return a.deadline.begin(phase, resources)
+}
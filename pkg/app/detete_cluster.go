@@ -1,10 +1,24 @@
 package app
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/kube"
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
 	"k8s.io/klog"
 )
 
@@ -23,18 +37,34 @@ func (a *app) RunDelete(opt *api.DeleteClusterOption) error {
 		klog.Error("Falied to init command")
 		return err
 	}
-	return a.runDelete(opt)
+	span := a.scope.StartRoot("RunDelete")
+	span.SetAttribute("cluster.name", opt.ClusterName)
+	a.record = audit.NewRecord("delete", opt.ClusterName, opt.Zone, opt)
+	a.deadline = newDeadline(opt.Timeout)
+	err = a.runDelete(opt)
+	a.deadline.stop()
+	a.deadline = nil
+	audit.Finish(a.record, a.userID, err)
+	span.Finish(err)
+	metrics.ClustersDeleted.Inc(metrics.Result(err))
+	metrics.ObserveOperation("delete", start, err)
+	metrics.Push()
+	notify.Send(notify.NewEvent("delete", opt.ClusterName, start, err))
+	return err
 }
 
 func (a *app) validateDeleteInput(opt *api.DeleteClusterOption) error {
 	if opt.ClusterName == "" {
-		return fmt.Errorf("ClusterName cannot be empty")
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if opt.Timeout < 0 {
+		return api.NewValidationError("Timeout %s cannot be negative", opt.Timeout)
 	}
 	return nil
 }
 
 func (a *app) runDelete(opt *api.DeleteClusterOption) error {
-	tagInstances, err := a.tagService.GetTagClusterByName(tagName(opt.ClusterName))
+	tagInstances, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
 	if err != nil {
 		klog.Errorf("Failed to get instances of cluster %s", opt.ClusterName)
 		return err
@@ -43,17 +73,223 @@ func (a *app) runDelete(opt *api.DeleteClusterOption) error {
 		err = fmt.Errorf("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
 		return err
 	}
+	if err = a.checkOwner(tagInstances); err != nil {
+		return err
+	}
+	if err = checkDeletable(opt.ClusterName, tagInstances); err != nil {
+		return err
+	}
+	if err = a.confirmDelete(opt, tagInstances); err != nil {
+		return err
+	}
+	if len(a.hooks) != 0 {
+		if err = a.runHooks(a.deleteHookContext(opt, tagInstances.TagID, tagInstances.Instances)); err != nil {
+			return err
+		}
+	}
+	a.record.AddResource("instance", tagInstances.Instances...)
+	a.record.AddResource("tag", tagInstances.TagID)
+	if err := a.beginPhase("instances"); err != nil {
+		return err
+	}
 	klog.Info("Begin to terminate cluster machines")
+	phaseStart := time.Now()
 	err = a.instanceIface.DeleteInstances(tagInstances.Instances)
+	metrics.ObservePhase("delete", "instances", phaseStart)
+	if err != nil {
+		return err
+	}
+	if err := a.beginPhase("tagged-resources"); err != nil {
+		return err
+	}
+	err = a.deleteTaggedResources(opt, tagInstances)
 	if err != nil {
 		return err
 	}
 
+	if err := a.beginPhase("tag"); err != nil {
+		return err
+	}
 	klog.Info("Deleting tag")
 	err = a.tagService.DeleteTag(tagInstances.TagID)
 	if err != nil {
 		return err
 	}
+	removeLocalKubeconfig(opt.ClusterName)
 	klog.Info("Cluster has been successfully deleted")
+	output.Printf("cluster %s deleted, %d instances terminated\n", opt.ClusterName, len(tagInstances.Instances))
+	return nil
+}
+
+// removeLocalKubeconfig deletes the default kubeconfig of cluster, and what was merged from it into
+// the kubeconfig of kubectl, so stale contexts do not pile up. Kubeconfigs at custom locations are left alone.
+func removeLocalKubeconfig(name string) {
+	standalone := api.DefaultKubeConfigPath(name)
+	own, err := ioutil.ReadFile(standalone)
+	if err != nil {
+		return
+	}
+	merged := kubectlConfigPath(filepath.Dir(standalone))
+	if resolved, err := filepath.EvalSymlinks(merged); err == nil {
+		merged = resolved
+	}
+	if info, err := os.Stat(merged); err == nil && !sameFile(info, standalone) {
+		pruned, removed, err := pruneKubeconfigFile(merged, own)
+		if err != nil {
+			klog.Warningf("Failed to remove cluster %s from %s, err: %s", name, merged, err.Error())
+		} else if len(removed) > 0 {
+			if err := replaceFile(merged, pruned, info.Mode().Perm()); err != nil {
+				klog.Warningf("Failed to write %s, err: %s", merged, err.Error())
+			} else {
+				klog.Infof("Removed %s from %s", strings.Join(removed, ", "), merged)
+			}
+		}
+	}
+	if err := os.Remove(standalone); err != nil {
+		klog.Warningf("Failed to delete kubeconfig %s, err: %s", standalone, err.Error())
+	}
+}
+
+// kubectlConfigPath is the kubeconfig kubectl writes to, the first file of $KUBECONFIG or config in dir
+func kubectlConfigPath(dir string) string {
+	for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if path != "" {
+			return path
+		}
+	}
+	return filepath.Join(dir, "config")
+}
+
+func pruneKubeconfigFile(path string, own []byte) ([]byte, []string, error) {
+	config, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kube.PruneKubeconfig(config, own)
+}
+
+func sameFile(info os.FileInfo, path string) bool {
+	other, err := os.Stat(path)
+	return err == nil && os.SameFile(info, other)
+}
+
+// replaceFile writes content to a temp file renamed to path, so path is never left half written
+func replaceFile(path string, content []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// deleteTaggedResources removes resources other than instances which are tagged with the cluster,
+// it runs after instances are terminated because eips and volumes must be detached first
+func (a *app) deleteTaggedResources(opt *api.DeleteClusterOption, t *tag.TagCluster) error {
+	if ids := t.Resources[api.ResourceTypeEIP]; len(ids) > 0 {
+		if opt.KeepEIP {
+			klog.Infof("Keeping eips %v", ids)
+		} else if a.eipService == nil {
+			return fmt.Errorf("Cannot release eips %v, no eip service is configured", ids)
+		} else {
+			klog.Info("Releasing eips")
+			if err := a.eipService.ReleaseEIPs(ids); err != nil {
+				return err
+			}
+			a.record.AddResource(api.ResourceTypeEIP, ids...)
+		}
+	}
+	if ids := t.Resources[api.ResourceTypeVolume]; len(ids) > 0 {
+		if opt.KeepVolumes {
+			klog.Infof("Keeping volumes %v", ids)
+		} else if a.volumeService == nil {
+			return fmt.Errorf("Cannot delete volumes %v, no volume service is configured", ids)
+		} else {
+			klog.Info("Deleting volumes")
+			if err := a.volumeService.DeleteVolumes(ids); err != nil {
+				return err
+			}
+			a.record.AddResource(api.ResourceTypeVolume, ids...)
+		}
+	}
+	if ids := t.Resources[api.ResourceTypeKeyPair]; len(ids) > 0 {
+		if opt.KeepSSHKey {
+			klog.Infof("Keeping keypairs %v", ids)
+			return nil
+		}
+		klog.Info("Deleting keypairs")
+		for _, id := range ids {
+			if err := a.sshKeyIface.DeleteSSHKey(id); err != nil {
+				return err
+			}
+		}
+		a.record.AddResource(api.ResourceTypeKeyPair, ids...)
+	}
 	return nil
 }
+
+// confirmDelete lists resources of the cluster and asks the user unless ForceDelete is set,
+// clusters created with ConfirmDeleteByName always need their name typed
+func (a *app) confirmDelete(opt *api.DeleteClusterOption, t *tag.TagCluster) error {
+	printClusterResources(output.Out, opt.ClusterName, t)
+	metadata := api.ParseClusterMetadata(t.Description)
+	if metadata.ConfirmDeleteByName {
+		if opt.ConfirmName == opt.ClusterName {
+			return nil
+		}
+		output.Printf("Cluster %s is protected, type its name to delete it: ", opt.ClusterName)
+		if a.readAnswer() != opt.ClusterName {
+			return api.NewValidationError("Typed name does not match, cluster %s is not deleted", opt.ClusterName)
+		}
+		return nil
+	}
+	if opt.ForceDelete {
+		return nil
+	}
+	output.Printf("Delete cluster %s and its instances? [y/N]: ", opt.ClusterName)
+	switch strings.ToLower(a.readAnswer()) {
+	case "y", "yes":
+		return nil
+	}
+	return api.NewValidationError("Deletion of cluster %s is cancelled", opt.ClusterName)
+}
+
+func (a *app) readAnswer() string {
+	line, _ := bufio.NewReader(a.stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func printClusterResources(w io.Writer, name string, t *tag.TagCluster) {
+	fmt.Fprintf(w, "Cluster %s has the following resources:\n", name)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  tag\t%s\n", t.TagID)
+	for _, id := range t.Instances {
+		fmt.Fprintf(tw, "  instance\t%s\n", id)
+	}
+	kinds := make([]string, 0, len(t.Resources))
+	for kind := range t.Resources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		for _, id := range t.Resources[kind] {
+			fmt.Fprintf(tw, "  %s\t%s\n", kind, id)
+		}
+	}
+	tw.Flush()
+}
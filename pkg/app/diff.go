@@ -0,0 +1,139 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+// Drift is one field of a cluster which differs from its spec
+type Drift struct {
+	Field    string
+	Declared string
+	Actual   string
+}
+
+// RunDiff compares a spec with the running cluster and reports what differs, nothing is changed
+func (a *app) RunDiff(opt *api.DiffOption) error {
+	spec, err := readSpec(opt.SpecPath)
+	if err != nil {
+		return err
+	}
+	if spec.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if spec.Zone == "" {
+		spec.Zone = opt.Zone
+	}
+	if err = a.init(spec.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	state, err := a.discoverCluster(spec.ClusterName, spec.Zone)
+	if err != nil {
+		return err
+	}
+	drifts, err := diffSpec(spec, state)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		output.Printf("cluster %s matches %s\n", spec.ClusterName, opt.SpecPath)
+		return nil
+	}
+	w := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tDECLARED\tACTUAL")
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Field, d.Declared, d.Actual)
+	}
+	w.Flush()
+	return api.WithClass(api.ErrorClassDrift, fmt.Errorf("Cluster %s drifts from %s in %d fields", spec.ClusterName, opt.SpecPath, len(drifts)))
+}
+
+// readSpec reads a spec of a cluster as exported by 'qks export'
+func readSpec(path string) (*api.CreateClusterOption, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, api.WithClass(api.ErrorClassValidation, err)
+	}
+	spec := &api.CreateClusterOption{}
+	if err = yaml.UnmarshalStrict(content, spec); err != nil {
+		return nil, api.NewValidationError("Failed to parse spec %s, err: %s", path, err.Error())
+	}
+	// a declared version without a preset is kept, clusters may be upgraded to one by hand
+	if resolved, err := api.ResolveKubernetesVersion(spec.KubernetesVersion, spec.Zone, spec.Arch); err == nil {
+		spec.KubernetesVersion = resolved
+	}
+	return spec, nil
+}
+
+// diffSpec only checks fields set in spec, as empty ones take defaults which cannot be told afterwards
+func diffSpec(spec *api.CreateClusterOption, state *clusterState) ([]Drift, error) {
+	drifts := make([]Drift, 0)
+	compare := func(field, declared, actual string) {
+		if declared != "" && declared != actual {
+			drifts = append(drifts, Drift{Field: field, Declared: declared, Actual: actual})
+		}
+	}
+	actual := state.spec
+	compare("kubernetesVersion", spec.KubernetesVersion, actual.KubernetesVersion)
+	compare("vxNet", spec.VxNet, actual.VxNet)
+	compare("networkOption.cniName", spec.CNIName, actual.CNIName)
+	compare("networkOption.podNetWorkCIDR", spec.PodNetWorkCIDR, actual.PodNetWorkCIDR)
+	compare("nodeImageVariant", spec.NodeImageVariant, actual.NodeImageVariant)
+	compare("driftPolicy", spec.DriftPolicy, actual.DriftPolicy)
+	if spec.NodeCount != 0 {
+		compare("nodeCount", strconv.Itoa(spec.NodeCount), strconv.Itoa(actual.NodeCount))
+	}
+	if spec.Protect != actual.Protect {
+		compare("protect", strconv.FormatBool(spec.Protect), strconv.FormatBool(actual.Protect))
+	}
+	roles := []struct {
+		field     string
+		declared  string
+		instances []*instance.Instance
+	}{
+		{"masterInstanceType", spec.MasterInstanceType, []*instance.Instance{state.master}},
+		{"nodeInstanceType", spec.NodeInstanceType, state.nodes},
+	}
+	for _, role := range roles {
+		declared := role.declared
+		if declared == "" && spec.InstanceClass != 0 {
+			declared = typeOfClass(spec.InstanceClass)
+		}
+		if declared == "" {
+			continue
+		}
+		t, err := instance.ParseInstanceType(declared)
+		if err != nil {
+			return nil, err
+		}
+		for _, ins := range role.instances {
+			if !t.Matches(ins) {
+				drifts = append(drifts, Drift{
+					Field:    fmt.Sprintf("%s (%s)", role.field, ins.ID),
+					Declared: declared,
+					Actual:   fmt.Sprintf("%s, class %d", ins.InstanceType, ins.InstanceClass),
+				})
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// typeOfClass returns the family name of instance class, so a class given by --class is checked like a family
+func typeOfClass(class int) string {
+	for name, c := range instance.Families {
+		if c == class {
+			return name
+		}
+	}
+	return strconv.Itoa(class)
+}
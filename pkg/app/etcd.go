@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// volumeTypes are accepted by CreateVolumes
+var volumeTypes = []int{0, 1, 2, 3, 4, 5, 10, 100, 200}
+
+const (
+	// qingcloud volumes are sized in steps of 10GB
+	volumeSizeStep = 10
+	// volumeTypeSSD is "super high performance" for performance instances
+	volumeTypeSSD = 3
+	// volumeTypeSSDEnterprise is usable by basic and enterprise instances
+	volumeTypeSSDEnterprise = 200
+)
+
+func validateEtcdVolume(opt *api.CreateClusterOption) error {
+	if opt.EtcdVolumeSize == 0 {
+		return nil
+	}
+	if opt.EtcdVolumeSize < 0 || opt.EtcdVolumeSize%volumeSizeStep != 0 {
+		return api.NewValidationError("Size of etcd volume must be a multiple of %dGB, got %d", volumeSizeStep, opt.EtcdVolumeSize)
+	}
+	for _, t := range volumeTypes {
+		if t == opt.EtcdVolumeType {
+			return nil
+		}
+	}
+	return api.NewValidationError("Invalid volume type %d of etcd, available values: %v", opt.EtcdVolumeType, volumeTypes)
+}
+
+func etcdVolumeType(opt *api.CreateClusterOption) int {
+	if opt.EtcdVolumeType != 0 {
+		return opt.EtcdVolumeType
+	}
+	if opt.InstanceClass == 0 || opt.InstanceClass == 1 {
+		return volumeTypeSSD
+	}
+	return volumeTypeSSDEnterprise
+}
+
+// createEtcdVolume attaches a new volume tagged with the cluster to master, it returns the id and the device on master
+func (a *app) createEtcdVolume(tagID string, opt *api.CreateClusterOption, master *instance.Instance) (string, string, error) {
+	if a.volumeService == nil {
+		return "", "", api.NewValidationError("Volumes are not available in this cloud")
+	}
+	id, err := a.volumeService.CreateVolume(fmt.Sprintf("qks-%s-etcd", opt.ClusterName), opt.EtcdVolumeSize, etcdVolumeType(opt))
+	if id != "" {
+		// deleted with the cluster even if it is not attached
+		a.record.AddResource(api.ResourceTypeVolume, id)
+		if tagErr := a.tagService.TagResources(tagID, api.ResourceTypeVolume, []string{id}); tagErr != nil {
+			return id, "", tagErr
+		}
+	}
+	if err != nil {
+		return id, "", err
+	}
+	device, err := a.volumeService.AttachVolume(id, master.ID)
+	if err != nil {
+		return id, "", err
+	}
+	klog.Infof("Volume %s is attached to master %s as %s for etcd", id, master.ID, device)
+	return id, device, nil
+}
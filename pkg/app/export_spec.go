@@ -0,0 +1,175 @@
+package app
+
+import (
+	"io/ioutil"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/manifest"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+// FormatSpec exports options of the cluster instead of its resources
+const FormatSpec = "spec"
+
+// RunExportSpec writes the spec of a running cluster in the yaml accepted by 'qks create cluster -Y', so it can be created again
+func (a *app) RunExportSpec(opt *api.ExportSpecOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	err := a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	var content []byte
+	switch opt.Format {
+	case "", FormatSpec:
+		state, err := a.discoverCluster(opt.ClusterName, opt.Zone)
+		if err != nil {
+			return err
+		}
+		if content, err = yaml.Marshal(state.spec); err != nil {
+			return err
+		}
+	default:
+		t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+		if err != nil {
+			return err
+		}
+		resources, err := a.clusterResources(opt.ClusterName, opt.Zone, t)
+		if err != nil {
+			return err
+		}
+		if content, err = resources.Render(opt.Format); err != nil {
+			return err
+		}
+	}
+	if opt.OutputPath == "" {
+		output.Printf("%s", content)
+		return nil
+	}
+	if err = ioutil.WriteFile(opt.OutputPath, content, 0644); err != nil {
+		return err
+	}
+	output.Printf("cluster %s is exported to %s\n", opt.ClusterName, opt.OutputPath)
+	return nil
+}
+
+// getOwnedCluster returns the tag of cluster, it fails if the cluster does not exist or belongs to others
+func (a *app) getOwnedCluster(name, zone string) (*tag.TagCluster, error) {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(name))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, api.NewValidationError("Cannot find the cluster %s in zone %s", name, zone)
+	}
+	if err = a.checkOwner(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// clusterResources lists everything tagged with the cluster tag
+func (a *app) clusterResources(name, zone string, t *tag.TagCluster) (*manifest.Resources, error) {
+	r := &manifest.Resources{Cluster: name, Zone: zone, TagID: t.TagID, Instances: make([]manifest.Instance, 0), Others: t.Resources}
+	masterName := instance.GeneateName(name, api.RoleMaster)
+	for _, id := range t.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			return nil, err
+		}
+		role := "node"
+		if ins.Name == masterName {
+			role = "master"
+		}
+		r.Instances = append(r.Instances, manifest.Instance{ID: ins.ID, Name: ins.Name, Role: role, IP: ins.IP})
+	}
+	return r, nil
+}
+
+// clusterState is what is found about a running cluster
+type clusterState struct {
+	// spec is the options the cluster would be created with
+	spec   *api.CreateClusterOption
+	master *instance.Instance
+	nodes  []*instance.Instance
+}
+
+// discoverCluster rebuilds options of a cluster from its tag, instances and what is running on master
+func (a *app) discoverCluster(name, zone string) (*clusterState, error) {
+	t, err := a.getOwnedCluster(name, zone)
+	if err != nil {
+		return nil, err
+	}
+	metadata := api.ParseClusterMetadata(t.Description)
+	spec := &api.CreateClusterOption{
+		ClusterName:         name,
+		Zone:                zone,
+		KubernetesVersion:   metadata.KubernetesVersion,
+		ConfirmDeleteByName: metadata.ConfirmDeleteByName,
+		Protect:             metadata.Protected,
+		NodeImageVariant:    metadata.NodeImageVariant,
+		DriftPolicy:         metadata.DriftPolicy,
+		NetworkOption: api.NetworkOption{
+			CNIName:        metadata.CNIName,
+			PodNetWorkCIDR: metadata.PodNetworkCIDR,
+		},
+	}
+	masterName := instance.GeneateName(name, api.RoleMaster)
+	var master *instance.Instance
+	nodes := make([]*instance.Instance, 0)
+	for _, id := range t.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			return nil, err
+		}
+		if ins.Name == masterName {
+			master = ins
+		} else {
+			nodes = append(nodes, ins)
+		}
+	}
+	if master == nil {
+		return nil, api.NewValidationError("Cannot find the master of cluster %s", name)
+	}
+	spec.VxNet = master.VxNet
+	spec.InstanceClass = master.InstanceClass
+	spec.MasterInstanceType = master.InstanceType
+	spec.NodeCount = len(nodes)
+	for _, node := range nodes {
+		if spec.NodeInstanceType == "" {
+			spec.NodeInstanceType = node.InstanceType
+		} else if node.InstanceType != spec.NodeInstanceType {
+			klog.Warningf("Node %s is %s while others are %s, the spec cannot tell them apart", node.ID, node.InstanceType, spec.NodeInstanceType)
+		}
+	}
+	if spec.KubernetesVersion == "" {
+		spec.KubernetesVersion = api.VersionOfMasterImage(zone, master.ImageID)
+	}
+	if arch := api.ArchOfMasterImage(zone, master.ImageID); arch != api.ArchAMD64 {
+		spec.Arch = arch
+	}
+	if spec.KubernetesVersion == "" || spec.CNIName == "" || spec.PodNetWorkCIDR == "" {
+		// clusters created by old versions have no such metadata, ask the cluster itself
+		info, err := a.newBootstrapper(a.sshRunner, spec).Discover(master)
+		if err != nil {
+			klog.Warningf("Failed to discover cluster %s on master, the spec may be incomplete, err: %s", name, err.Error())
+		} else {
+			if spec.KubernetesVersion == "" {
+				spec.KubernetesVersion = info.KubernetesVersion
+			}
+			if spec.CNIName == "" {
+				spec.CNIName = info.CNIName
+			}
+			if spec.PodNetWorkCIDR == "" {
+				spec.PodNetWorkCIDR = info.PodNetworkCIDR
+			}
+		}
+	}
+	return &clusterState{spec: spec, master: master, nodes: nodes}, nil
+}
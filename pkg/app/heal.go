@@ -0,0 +1,119 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+const (
+	// healOperation names events of replacing nodes in notifications and audit records
+	healOperation = "heal"
+	// DefaultNotReadyThreshold leaves time for kubelet to recover from a restart or a short network outage
+	DefaultNotReadyThreshold = 10 * time.Minute
+	// DefaultMaxReplacementsPerHour is low, nodes breaking faster than this need a human
+	DefaultMaxReplacementsPerHour = 2
+)
+
+// replacement is the result of replacing a broken node
+type replacement struct {
+	Old    *instance.Instance
+	New    *instance.Instance
+	Reason string
+	Err    error
+}
+
+func (r *replacement) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("failed to replace instance %s (%s), err: %s", r.Old.ID, r.Reason, r.Err.Error())
+	}
+	return fmt.Sprintf("replaced instance %s (%s) by %s %s", r.Old.ID, r.Reason, r.New.ID, r.New.IP)
+}
+
+// healer replaces broken nodes of the pool found by watching, the master is never touched
+type healer struct {
+	pool       *nodePool
+	threshold  time.Duration
+	maxPerHour int
+	// notReadySince are when nodes, keyed by their instance ids, are first seen not ready
+	notReadySince map[string]time.Time
+	// history are when replacements of the last hour started
+	history []time.Time
+}
+
+func newHealer(pool *nodePool, opt *api.WatchOption) *healer {
+	return &healer{
+		pool:          pool,
+		threshold:     opt.NotReadyThreshold,
+		maxPerHour:    opt.MaxReplacementsPerHour,
+		notReadySince: make(map[string]time.Time),
+	}
+}
+
+// heal replaces nodes broken in health, nothing is done if new nodes cannot join as the apiserver is unreachable
+func (h *healer) heal(health *clusterHealth, now time.Time) []*replacement {
+	if health.nodeStatuses == nil || health.version == "" {
+		return nil
+	}
+	results := make([]*replacement, 0)
+	for _, node := range h.pool.members(health) {
+		reason := h.brokenReason(node, health, now)
+		if reason == "" {
+			continue
+		}
+		recent := h.history[:0]
+		for _, t := range h.history {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		h.history = recent
+		if len(h.history) >= h.maxPerHour {
+			klog.Warningf("Instance %s is broken (%s), but %d nodes are replaced in the last hour, leave it to a human", node.ID, reason, len(h.history))
+			continue
+		}
+		h.history = append(h.history, now)
+		klog.Infof("Replacing instance %s of cluster %s, %s", node.ID, h.pool.name, reason)
+		r := &replacement{Old: node, Reason: reason}
+		record := h.pool.newRecord(healOperation, map[string]string{"instance": node.ID, "reason": reason})
+		var created []*instance.Instance
+		if created, r.Err = h.pool.add(health, node, 1); r.Err == nil {
+			r.New = created[0]
+			// broken nodes are not drained, evicting from them may never finish
+			r.Err = h.pool.remove(health, node, false)
+			delete(h.notReadySince, node.ID)
+		}
+		audit.Finish(record, h.pool.a.userID, r.Err)
+		results = append(results, r)
+	}
+	return results
+}
+
+// brokenReason returns why node needs replacing, or "" if it is fine or not broken for long enough
+func (h *healer) brokenReason(node *instance.Instance, health *clusterHealth, now time.Time) string {
+	switch node.Status {
+	case instance.StatusStopped, instance.StatusTerminated, instance.StatusCeased:
+		return "instance is " + node.Status
+	case instance.StatusRunning:
+	default:
+		// pending or suspended, replacing does not help
+		return ""
+	}
+	if status, ok := health.nodeStatuses[node.IP]; ok && status.Conditions["Ready"] == "True" {
+		delete(h.notReadySince, node.ID)
+		return ""
+	}
+	since, ok := h.notReadySince[node.ID]
+	if !ok {
+		h.notReadySince[node.ID] = now
+		return ""
+	}
+	if now.Sub(since) < h.threshold {
+		return ""
+	}
+	return fmt.Sprintf("node is not ready for %s", now.Sub(since).Round(time.Second))
+}
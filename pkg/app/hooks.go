@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/hook"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// runHooks runs hooks at the point of ctx in order, the first failure stops the rest
+func (a *app) runHooks(ctx *hook.Context) error {
+	for _, h := range a.hooks {
+		if err := h.Run(ctx); err != nil {
+			return fmt.Errorf("Hook at %s of cluster %s failed, err: %s", ctx.Point, ctx.ClusterName, err.Error())
+		}
+	}
+	return nil
+}
+
+// createHookContext is the context of a cluster being created by opt
+func createHookContext(point string, opt *api.CreateClusterOption, tagID string) *hook.Context {
+	return &hook.Context{
+		Point:             point,
+		ClusterName:       opt.ClusterName,
+		Zone:              opt.Zone,
+		KubernetesVersion: opt.KubernetesVersion,
+		TagID:             tagID,
+		VxNet:             opt.VxNet,
+	}
+}
+
+// addHookMachines adds machines in the pool of role to ctx
+func addHookMachines(ctx *hook.Context, role byte, machines ...*instance.Instance) {
+	for _, m := range machines {
+		ctx.Machines = append(ctx.Machines, hook.Machine{ID: m.ID, Role: poolOf(role), IP: m.IP})
+	}
+}
+
+func poolOf(role byte) string {
+	for name, r := range pools {
+		if r == role {
+			return name
+		}
+	}
+	return ""
+}
+
+// deleteHookContext describes instances of the cluster being deleted, those which cannot be described are left out
+func (a *app) deleteHookContext(opt *api.DeleteClusterOption, tagID string, ids []string) *hook.Context {
+	ctx := &hook.Context{Point: hook.PreDelete, ClusterName: opt.ClusterName, Zone: opt.Zone, TagID: tagID}
+	for _, id := range ids {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			klog.Warningf("Failed to get instance %s for hooks, err: %s", id, err.Error())
+			continue
+		}
+		m := hook.Machine{ID: ins.ID, IP: ins.IP}
+		for name, role := range pools {
+			if ins.Name == instance.GeneateName(opt.ClusterName, role) {
+				m.Role = name
+			}
+		}
+		ctx.Machines = append(ctx.Machines, m)
+	}
+	return ctx
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// exposeIngress binds a new eip to the first of targets and makes the ingress-nginx addon publish it, it returns the address
+func (a *app) exposeIngress(tagID string, opt *api.CreateClusterOption, targets []*instance.Instance) (string, error) {
+	if a.eipService == nil {
+		return "", api.NewValidationError("Eips are not available in this cloud")
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("No machine to bind the ingress eip to")
+	}
+	e, err := a.eipService.AllocateEIP(fmt.Sprintf("qks-%s-ingress", opt.ClusterName), opt.IngressBandwidth)
+	if e != nil {
+		// tag it even if it is not ready, so it is released with the cluster
+		a.record.AddResource(api.ResourceTypeEIP, e.ID)
+		if tagErr := a.tagService.TagResources(tagID, api.ResourceTypeEIP, []string{e.ID}); tagErr != nil {
+			return "", tagErr
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = a.eipService.AssociateEIP(e.ID, targets[0].ID); err != nil {
+		return "", err
+	}
+	klog.Infof("Eip %s %s is bound to %s for ingress", e.ID, e.Addr, targets[0].ID)
+	params := map[string]string{"publishStatusAddress": e.Addr}
+	for i := range opt.Addons {
+		if opt.Addons[i].Name == addon.IngressNginx {
+			if opt.Addons[i].Params == nil {
+				opt.Addons[i].Params = params
+			} else {
+				opt.Addons[i].Params["publishStatusAddress"] = e.Addr
+			}
+			return e.Addr, nil
+		}
+	}
+	// the ingress goes first, addons like cert-manager may rely on it
+	opt.Addons = append([]api.AddonOption{{Name: addon.IngressNginx, Params: params}}, opt.Addons...)
+	return e.Addr, nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/manifest"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"k8s.io/klog"
+)
+
+// sshUser is who bootstrap logs into linux machines as
+const sshUser = "root"
+
+// privateKeyFile is the key of publicKeyFile, the one machines let in
+func (a *app) privateKeyFile() string {
+	return strings.TrimSuffix(a.publicKeyFile, ".pub")
+}
+
+// RunInventory prints or writes an ansible inventory of the machines a cluster has now, grouped by pools with the
+// connection variables bootstrap uses, so configuration after provisioning can be managed by ansible
+func (a *app) RunInventory(opt *api.InventoryOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if opt.Format == "" {
+		opt.Format = manifest.FormatINI
+	}
+	if _, err := (&manifest.Inventory{}).Render(opt.Format); err != nil {
+		return err
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	inv := &manifest.Inventory{
+		Cluster: opt.ClusterName,
+		Zone:    opt.Zone,
+		Vars:    map[string]string{"qks_cluster": opt.ClusterName, "qks_zone": opt.Zone},
+	}
+	for _, pool := range []string{"master", "node", "winnode"} {
+		role := pools[pool]
+		members, err := a.poolMachines(opt.ClusterName, t, role)
+		if err != nil {
+			return err
+		}
+		vars := manifest.SSHVars(sshUser, a.privateKeyFile(), false)
+		if role == api.RoleWindowsNode {
+			if len(members) == 0 {
+				continue
+			}
+			vars = manifest.SSHVars(ssh.WindowsUser, a.privateKeyFile(), true)
+		}
+		group := manifest.InventoryGroup{Pool: pool, Hosts: make([]manifest.InventoryHost, 0, len(members)), Vars: vars}
+		for _, m := range members {
+			if isDeleted(m) || m.IP == "" {
+				klog.Warningf("Instance %s of cluster %s has no address, it is left out of the inventory", m.ID, opt.ClusterName)
+				continue
+			}
+			group.Hosts = append(group.Hosts, inventoryHost(m))
+		}
+		inv.Groups = append(inv.Groups, group)
+	}
+	content, err := inv.Render(opt.Format)
+	if err != nil {
+		return err
+	}
+	if opt.OutputPath == "" {
+		output.Printf("%s", content)
+		return nil
+	}
+	if err = ioutil.WriteFile(opt.OutputPath, content, 0644); err != nil {
+		return err
+	}
+	output.Printf("inventory of cluster %s is written to %s\n", opt.ClusterName, opt.OutputPath)
+	return nil
+}
+
+// inventoryHost names a machine by its instance id, which stays the same while ips of vxnets may be taken again
+func inventoryHost(ins *instance.Instance) manifest.InventoryHost {
+	return manifest.InventoryHost{Name: ins.ID, Vars: map[string]string{"ansible_host": ins.IP}}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/kube"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+// RunKubectl runs kubectl against the cluster. The local kubeconfig of the cluster is used if there is one,
+// otherwise it is fetched from master and saved if the apiserver is reachable from here.
+// kubectl runs on master over ssh when it is not, or kubectl is not installed locally.
+func (a *app) RunKubectl(opt *api.KubectlOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if len(opt.Args) == 0 {
+		return api.NewValidationError("Args of kubectl cannot be empty")
+	}
+	local := api.DefaultKubeConfigPath(opt.ClusterName)
+	useLocal := !opt.OnMaster && a.kubectl != nil
+	if useLocal {
+		if _, err := os.Stat(local); err == nil {
+			return a.kubectl(local, opt.Args)
+		}
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return api.NewValidationError("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
+	}
+	if err = a.checkOwner(t); err != nil {
+		return err
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	version := api.ParseClusterMetadata(t.Description).KubernetesVersion
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{ClusterName: opt.ClusterName, Zone: opt.Zone, KubernetesVersion: version})
+	if useLocal {
+		kubeconfig, err := bootstrapper.FetchKubeconfig(master)
+		if err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		if reachable(kubeconfig) {
+			if err = saveKubeconfig(local, kubeconfig); err != nil {
+				return err
+			}
+			klog.Infof("kubeconfig of cluster %s is saved in %s", opt.ClusterName, local)
+			return a.kubectl(local, opt.Args)
+		}
+		klog.V(1).Infof("apiserver of cluster %s is not reachable from here, running kubectl on master %s", opt.ClusterName, master.IP)
+	}
+	quoted := make([]string, 0, len(opt.Args))
+	for _, arg := range opt.Args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	result, err := bootstrapper.Kubectl(master, strings.Join(quoted, " "))
+	output.Printf("%s", result)
+	if err != nil {
+		return fmt.Errorf("kubectl on master %s failed, err: %s", master.IP, err.Error())
+	}
+	return nil
+}
+
+// reachable tells if the apiserver in kubeconfig answers from here
+func reachable(kubeconfig []byte) bool {
+	client, err := kube.NewClient(kubeconfig)
+	if err != nil {
+		return false
+	}
+	_, err = client.ServerVersion()
+	return err == nil
+}
+
+func saveKubeconfig(path string, kubeconfig []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, kubeconfig, 0600)
+}
+
+// localKubectl returns how the local kubectl runs, nil if it is not installed
+func localKubectl() func(string, []string) error {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return nil
+	}
+	return execKubectl
+}
+
+// execKubectl runs the local kubectl with kubeconfig, it reads and writes the terminal of qks
+func execKubectl(kubeconfig string, args []string) error {
+	cmd := exec.Command("kubectl", append([]string{"--kubeconfig=" + kubeconfig}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = output.Out
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// shellQuote quotes s for bash on master
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
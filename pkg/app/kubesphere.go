@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+)
+
+// ks-installer takes 10 to 20 minutes for a minimal installation
+const (
+	kubeSphereWaitTimeout  = time.Minute * 30
+	kubeSphereWaitInterval = time.Second * 30
+)
+
+// addKubeSphere installs KubeSphere as the last addon, after everything it may run on
+func addKubeSphere(opt *api.CreateClusterOption) {
+	if opt.KubeSphere == "" {
+		return
+	}
+	if installsKubeSphere(opt) {
+		return
+	}
+	opt.Addons = append(opt.Addons, api.AddonOption{Name: addon.KubeSphere, Version: opt.KubeSphere})
+}
+
+func installsKubeSphere(opt *api.CreateClusterOption) bool {
+	for _, o := range opt.Addons {
+		if o.Name == addon.KubeSphere {
+			return true
+		}
+	}
+	return false
+}
+
+// waitKubeSphere waits until ks-installer finishes, it returns the console url
+func waitKubeSphere(b bootstrap.Interface, master *instance.Instance) (string, error) {
+	err := retry.Until(kubeSphereWaitTimeout, kubeSphereWaitInterval, func() error {
+		output, err := b.Kubectl(master, "logs -n "+addon.KubeSphereNamespace+" deploy/ks-installer --tail=200")
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(output, []byte(addon.KubeSphereReadyMessage)) {
+			return fmt.Errorf("KubeSphere is still installing")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("KubeSphere is not ready in %s, check 'kubectl logs -n %s deploy/ks-installer -f' on master", kubeSphereWaitTimeout, addon.KubeSphereNamespace)
+	}
+	return fmt.Sprintf("http://%s:%d", master.IP, addon.KubeSphereConsolePort), nil
+}
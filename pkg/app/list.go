@@ -6,12 +6,15 @@ import (
 )
 
 func (a *app) getClusters() error {
-	tags, err := a.tagService.GetTags(api.ClusterTagPrefix)
+	tags, err := a.tagService.GetTags(a.tagPrefix)
 	if err != nil {
 		klog.Errorln("Failed to get tags")
 	}
 	for _, t := range tags {
-		klog.Infof("Get cluster [%s]", t[len(api.ClusterTagPrefix):])
+		if api.OwnerOf(t.Description) != a.owner {
+			continue
+		}
+		klog.Infof("Get cluster [%s]", t.Name[len(a.tagPrefix):])
 	}
 	return nil
 }
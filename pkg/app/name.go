@@ -0,0 +1,35 @@
+package app
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"k8s.io/klog"
+)
+
+// normalizeClusterName normalizes name in place and validates it, including the tag named by it with the prefix of the app
+func (a *app) normalizeClusterName(name *string) error {
+	normalized := api.NormalizeClusterName(*name)
+	if normalized != *name {
+		klog.Warningf("Cluster name '%s' is normalized to %s", *name, normalized)
+		*name = normalized
+	}
+	if err := api.ValidateClusterName(*name); err != nil {
+		return err
+	}
+	if tagName := a.tagName(*name); len(tagName) > api.NameLimit {
+		return api.NewValidationError("Tag %s of cluster is longer than %d characters, use a shorter name or tag prefix", tagName, api.NameLimit)
+	}
+	return nil
+}
+
+// checkNameAvailable refuses a name whose tag already exists in the zone, unless the cluster adopts the tag
+func (a *app) checkNameAvailable(opt *api.CreateClusterOption) error {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil || t == nil {
+		return err
+	}
+	if !opt.Adopt {
+		return api.NewValidationError("Cluster %s already exists in zone %s, delete it or use --adopt to create into its tag %s", opt.ClusterName, opt.Zone, t.TagID)
+	}
+	klog.Infof("Adopting tag %s of cluster %s", t.TagID, opt.ClusterName)
+	return nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"k8s.io/klog"
+)
+
+const (
+	// a rebooted node has 5 minutes to be Ready before it is given up
+	nodeReadyWaitTimeout  = time.Minute * 5
+	nodeReadyWaitInterval = time.Second * 10
+)
+
+// RunPatch rolls through workers applying updates of OS packages, a node is drained, patched, rebooted
+// and uncordoned once it is Ready again. Nodes not started yet are skipped after any failure,
+// the failed node is left cordoned for inspection.
+func (a *app) RunPatch(opt *api.PatchOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if opt.Parallelism < 0 {
+		return api.NewValidationError("Parallelism cannot be negative, got %d", opt.Parallelism)
+	}
+	if opt.Parallelism == 0 {
+		opt.Parallelism = 1
+	}
+	if opt.BootstrapLogDir == "" {
+		opt.BootstrapLogDir = filepath.Join(api.ConfigDir(), "logs", opt.ClusterName)
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	workers, err := a.poolMachines(opt.ClusterName, t, api.RoleNode)
+	if err != nil {
+		return err
+	}
+	if len(workers) == 0 {
+		return api.NewValidationError("Cluster %s has no workers to patch", opt.ClusterName)
+	}
+	version := api.ParseClusterMetadata(t.Description).KubernetesVersion
+	if _, err := bootstrap.OSFor(version); err != nil {
+		return err
+	}
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{
+		ClusterName:       opt.ClusterName,
+		Zone:              opt.Zone,
+		KubernetesVersion: version,
+		BootstrapLogDir:   opt.BootstrapLogDir,
+	})
+	nodes, err := bootstrapper.NodeStatuses(master)
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	names := make(map[string]string)
+	for _, n := range nodes {
+		names[n.IP] = n.Name
+	}
+
+	results := make([]string, len(workers))
+	slots := make(chan struct{}, opt.Parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stopped := false
+	patched := 0
+	for i, w := range workers {
+		slots <- struct{}{}
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip {
+			<-slots
+			results[i] = "skipped"
+			continue
+		}
+		wg.Add(1)
+		go func(i int, w *instance.Instance) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := a.patchNode(bootstrapper, master, w, names[w.IP])
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				klog.Errorf("Failed to patch node %s %s, err: %s", w.ID, w.IP, err.Error())
+				stopped = true
+				results[i] = "failed, left cordoned"
+				return
+			}
+			patched++
+			results[i] = "patched"
+		}(i, w)
+	}
+	wg.Wait()
+
+	tw := tabwriter.NewWriter(output.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tNODE\tRESULT")
+	for i, w := range workers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", w.ID, names[w.IP], results[i])
+	}
+	tw.Flush()
+	if patched == len(workers) {
+		return nil
+	}
+	err = fmt.Errorf("Failed to patch %d of %d nodes of cluster %s", len(workers)-patched, len(workers), opt.ClusterName)
+	if patched > 0 {
+		return api.WithClass(api.ErrorClassPartialSuccess, err)
+	}
+	return api.WithClass(api.ErrorClassBootstrap, err)
+}
+
+func (a *app) patchNode(bootstrapper bootstrap.Interface, master, machine *instance.Instance, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s has no node", machine.IP)
+	}
+	if err := bootstrapper.DrainNode(master, name); err != nil {
+		return err
+	}
+	if err := bootstrapper.PatchOS(machine); err != nil {
+		return err
+	}
+	err := retry.Until(nodeReadyWaitTimeout, nodeReadyWaitInterval, func() error {
+		nodes, err := bootstrapper.NodeStatuses(master)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n.Name == name && n.Conditions["Ready"] == "True" {
+				return nil
+			}
+		}
+		return fmt.Errorf("node %s is not Ready", name)
+	})
+	if err != nil {
+		return fmt.Errorf("Node %s is not Ready in %s after reboot", name, nodeReadyWaitTimeout)
+	}
+	if output, err := bootstrapper.Kubectl(master, "uncordon "+name); err != nil {
+		return fmt.Errorf("Failed to uncordon node %s, err: %s, output: %s", name, err.Error(), string(output))
+	}
+	klog.Infof("Node %s is patched", name)
+	return nil
+}
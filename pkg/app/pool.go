@@ -0,0 +1,182 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// nodePool is the linux nodes of a watched cluster, which healing and scaling add and remove
+type nodePool struct {
+	a      *app
+	name   string
+	zone   string
+	logDir string
+	// userData runs on nodes before they join, as on those created with the cluster
+	userData string
+	// bootWait and bootWaitTimeout tell nodes are booted, as for those created with the cluster
+	bootWait        string
+	bootWaitTimeout time.Duration
+	// retired are ids of instances removed by qks, qingcloud keeps listing deleted instances for a while
+	retired map[string]bool
+}
+
+func (p *nodePool) bootstrapper(health *clusterHealth) bootstrap.Interface {
+	return p.a.newBootstrapper(p.a.sshRunner, &api.CreateClusterOption{
+		ClusterName:       p.name,
+		Zone:              p.zone,
+		KubernetesVersion: health.version,
+		BootstrapLogDir:   p.logDir,
+		UserData:          p.userData,
+		BootWait:          p.bootWait,
+		BootWaitTimeout:   p.bootWaitTimeout,
+	})
+}
+
+// newRecord starts the audit record of an operation changing nodes of the pool, instances it adds and removes go in it
+func (p *nodePool) newRecord(operation string, parameters interface{}) *audit.Record {
+	p.a.record = audit.NewRecord(operation, p.name, p.zone, parameters)
+	return p.a.record
+}
+
+// members are linux nodes in health not retired by qks, including those deleted by others
+func (p *nodePool) members(health *clusterHealth) []*instance.Instance {
+	name := instance.GeneateName(p.name, api.RoleNode)
+	result := make([]*instance.Instance, 0)
+	for _, node := range health.nodes {
+		if node.Name != name || p.retired[node.ID] {
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// add creates count nodes like the given one and joins them, nodes failing to join are deleted
+func (p *nodePool) add(health *clusterHealth, like *instance.Instance, count int) ([]*instance.Instance, error) {
+	a := p.a
+	preset, err := api.PresetFor(health.version, p.zone, api.ArchOfMasterImage(p.zone, health.master.ImageID))
+	if err != nil {
+		return nil, err
+	}
+	if preset, err = preset.WithNodeImageVariant(health.nodeImageVariant); err != nil {
+		return nil, err
+	}
+	keyid := ""
+	for _, n := range []string{api.SSHKeyNameOf(p.name), api.SSHKeyName} {
+		if keyid, err = a.sshKeyIface.GetKeyPairByName(n); err != nil {
+			return nil, err
+		}
+		if keyid != "" {
+			break
+		}
+	}
+	if keyid == "" {
+		return nil, fmt.Errorf("Cannot find the keypair of cluster %s", p.name)
+	}
+	createOpt := &instance.CreateInstancesOption{
+		Name:          p.name,
+		VxNet:         like.VxNet,
+		Count:         count,
+		Role:          api.RoleNode,
+		ImagesPreset:  preset,
+		InstanceClass: like.InstanceClass,
+		SSHKeyID:      keyid,
+		SecurityGroup: like.SecurityGroup,
+	}
+	if t, err := instance.ParseInstanceType(like.InstanceType); err == nil {
+		t.Apply(createOpt)
+	} else if like.InstanceType != "" {
+		klog.Warningf("Instance type %s of %s is unknown, new nodes take the default of the preset", like.InstanceType, like.ID)
+	}
+	created, err := a.instanceIface.CreateInstances(createOpt)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(created))
+	for _, node := range created {
+		ids = append(ids, node.ID)
+	}
+	a.record.AddResource("instance", ids...)
+	// tagged first, so they are deleted with the cluster even if qks stops here
+	if err = a.tagService.TagInstances(health.tagID, ids); err != nil {
+		return nil, err
+	}
+	bootstrapper := p.bootstrapper(health)
+	cmds, err := bootstrapper.CreateJoinCommands(health.master, "")
+	if err != nil {
+		p.deleteInstances(ids)
+		return nil, api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	joined := created
+	if err = bootstrapper.JoinNodes(cmds.Worker, created); err != nil {
+		partial, ok := err.(*bootstrap.JoinError)
+		if !ok {
+			p.deleteInstances(ids)
+			return nil, api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		failed := make([]string, 0, len(partial.Failed))
+		for i, node := range partial.Failed {
+			failed = append(failed, node.ID)
+			// the console is gone once the instance is deleted
+			partial.Errs[i] = p.a.withConsole(&api.CreateClusterOption{BootstrapLogDir: p.logDir}, node, partial.Errs[i])
+		}
+		p.deleteInstances(failed)
+		joined = joinedNodes(created, partial.Failed)
+		err = api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	if len(joined) != 0 {
+		if labelErr := bootstrapper.LabelNodes(health.master, joined); labelErr != nil {
+			klog.Warningf("Failed to label new nodes, err: %s", labelErr.Error())
+		}
+		if idErr := bootstrapper.SetProviderIDs(health.master, joined); idErr != nil {
+			klog.Warningf("Failed to set provider id of new nodes, err: %s", idErr.Error())
+		}
+	}
+	return joined, err
+}
+
+// remove deletes the node from the cluster and its instance, pods are evicted first if drain is set
+func (p *nodePool) remove(health *clusterHealth, old *instance.Instance, drain bool) error {
+	bootstrapper := p.bootstrapper(health)
+	if status, ok := health.nodeStatuses[old.IP]; ok {
+		if drain {
+			if err := bootstrapper.DrainNode(health.master, status.Name); err != nil {
+				return err
+			}
+		}
+		if output, err := bootstrapper.Kubectl(health.master, "delete node "+status.Name); err != nil {
+			klog.Warningf("Failed to delete node %s, err: %s, output: %s", status.Name, err.Error(), string(output))
+		}
+	}
+	p.retired[old.ID] = true
+	if isDeleted(old) {
+		return nil
+	}
+	p.a.record.AddResource("instance", old.ID)
+	if err := p.a.instanceIface.DeleteInstances([]string{old.ID}); err != nil {
+		klog.Warningf("Failed to delete instance %s, delete it by hand, err: %s", old.ID, err.Error())
+	}
+	return nil
+}
+
+func (p *nodePool) deleteInstances(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		p.retired[id] = true
+	}
+	if err := p.a.instanceIface.DeleteInstances(ids); err != nil {
+		klog.Warningf("Failed to delete instances %v which cannot join, err: %s", ids, err.Error())
+	}
+}
+
+func isDeleted(ins *instance.Instance) bool {
+	return ins.Status == instance.StatusTerminated || ins.Status == instance.StatusCeased
+}
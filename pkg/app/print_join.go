@@ -0,0 +1,70 @@
+package app
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"k8s.io/klog"
+)
+
+// RunPrintJoin prints how to join machines provisioned by other tools to the cluster
+func (a *app) RunPrintJoin(opt *api.PrintJoinOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	err := a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return api.NewValidationError("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
+	}
+	if err = a.checkOwner(t); err != nil {
+		return err
+	}
+	master, err := a.findMaster(opt.ClusterName, t)
+	if err != nil {
+		return err
+	}
+	// flags of kubeadm depend on the version, which is empty for clusters created before it was saved
+	version := api.ParseClusterMetadata(t.Description).KubernetesVersion
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{ClusterName: opt.ClusterName, Zone: opt.Zone, KubernetesVersion: version})
+	if opt.CAHashOnly {
+		hash, err := bootstrapper.CACertHash(master)
+		if err != nil {
+			return api.WithClass(api.ErrorClassBootstrap, err)
+		}
+		output.Printf("%s\n", hash)
+		return nil
+	}
+	cmds, err := bootstrapper.CreateJoinCommands(master, opt.TokenTTL)
+	if err != nil {
+		return api.WithClass(api.ErrorClassBootstrap, err)
+	}
+	output.Printf("To join a worker, run on it as root:\n\n  %s\n\n", cmds.Worker)
+	if cmds.ControlPlane != "" {
+		output.Printf("To join a control plane, run on it as root:\n\n  %s\n\n", cmds.ControlPlane)
+	}
+	return nil
+}
+
+// findMaster looks for the instance named as master among instances of the cluster
+func (a *app) findMaster(name string, t *tag.TagCluster) (*instance.Instance, error) {
+	masterName := instance.GeneateName(name, api.RoleMaster)
+	for _, id := range t.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			return nil, err
+		}
+		if ins.Name == masterName {
+			return ins, nil
+		}
+	}
+	return nil, api.NewValidationError("Cannot find the master of cluster %s", name)
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"k8s.io/klog"
+)
+
+func (a *app) RunProtect(opt *api.ProtectClusterOption) error {
+	start := time.Now()
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	err := a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	operation := "protect"
+	if opt.Unprotect {
+		operation = "unprotect"
+	}
+	span := a.scope.StartRoot("RunProtect")
+	span.SetAttribute("cluster.name", opt.ClusterName)
+	a.record = audit.NewRecord(operation, opt.ClusterName, opt.Zone, opt)
+	err = a.runProtect(opt)
+	audit.Finish(a.record, a.userID, err)
+	span.Finish(err)
+	notify.Send(notify.NewEvent(operation, opt.ClusterName, start, err))
+	return err
+}
+
+func (a *app) runProtect(opt *api.ProtectClusterOption) error {
+	t, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return api.NewValidationError("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
+	}
+	if err = a.checkOwner(t); err != nil {
+		return err
+	}
+	a.record.AddResource("tag", t.TagID)
+	metadata := api.ParseClusterMetadata(t.Description)
+	metadata.Protected = !opt.Unprotect
+	err = a.tagService.SetDescription(t.TagID, metadata.String())
+	if err != nil {
+		return err
+	}
+	if metadata.Protected {
+		output.Printf("cluster %s is protected from deletion\n", opt.ClusterName)
+	} else {
+		output.Printf("cluster %s is no longer protected\n", opt.ClusterName)
+	}
+	return nil
+}
+
+// checkDeletable refuses to remove protected clusters, anything deleting clusters must call it
+func checkDeletable(name string, t *tag.TagCluster) error {
+	if api.ParseClusterMetadata(t.Description).Protected {
+		return api.NewValidationError("Cluster %s is protected, run 'qks protect cluster %s --unprotect' before deleting it", name, name)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// reconcileOperation names events of reconciling a cluster with its spec in notifications and audit records
+const reconcileOperation = "reconcile"
+
+func validateDriftPolicy(policy string) error {
+	if policy != "" && policy != api.DriftPolicyFlag && policy != api.DriftPolicyCorrect {
+		return api.NewValidationError("Unknown drift policy %s, available policies: %s, %s", policy, api.DriftPolicyFlag, api.DriftPolicyCorrect)
+	}
+	return nil
+}
+
+// reconciliation is what reconciling a cluster with its spec finds and does in a poll
+type reconciliation struct {
+	Policy string
+	// Drifts are new ones, those reported by earlier polls are left out
+	Drifts  []Drift
+	Added   []*instance.Instance
+	Removed []*instance.Instance
+	Err     error
+}
+
+func (r *reconciliation) String() string {
+	items := make([]string, 0, len(r.Drifts))
+	for _, d := range r.Drifts {
+		items = append(items, fmt.Sprintf("%s drifts from %s to %s", d.Field, d.Declared, d.Actual))
+	}
+	msg := strings.Join(items, ", ")
+	if msg == "" {
+		msg = "corrected drifts"
+	}
+	for _, n := range r.Added {
+		msg += ", added " + n.ID
+	}
+	for _, n := range r.Removed {
+		msg += ", removed " + n.ID
+	}
+	if r.Err != nil {
+		msg += ", err: " + r.Err.Error()
+	}
+	return msg + " (" + r.Policy + ")"
+}
+
+// Healthy tells whether the cluster is back at its spec, flagged drifts are not
+func (r *reconciliation) Healthy() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, d := range r.Drifts {
+		if d.Field != "nodeCount" || r.Policy != api.DriftPolicyCorrect {
+			return false
+		}
+	}
+	return true
+}
+
+// reconciler keeps the cluster of the pool at its spec, the count of nodes is corrected if the policy of the cluster is
+// DriftPolicyCorrect and flagged otherwise, versions are always flagged as upgrades are not done by watching
+type reconciler struct {
+	pool *nodePool
+	spec *api.CreateClusterOption
+	// policy overrides the one of the cluster if set
+	policy string
+	// countByProfiles leaves the count of nodes to scaling profiles
+	countByProfiles bool
+	// reported are drifts found by earlier polls, they are reported again only after they are gone
+	reported map[Drift]bool
+	// failed stops correcting after a correction fails, drifts are flagged for a human from then on
+	failed bool
+}
+
+func (r *reconciler) reconcile(health *clusterHealth) *reconciliation {
+	if health.nodeStatuses == nil || health.version == "" {
+		return nil
+	}
+	for subject, state := range health.states {
+		// instances which cannot be described are not counted, the count of nodes cannot be told then
+		if strings.HasPrefix(subject, "instance ") && state == "unknown" {
+			return nil
+		}
+	}
+	policy := r.policy
+	if policy == "" {
+		policy = health.driftPolicy
+	}
+	if policy == "" {
+		policy = api.DriftPolicyFlag
+	}
+	members := make([]*instance.Instance, 0)
+	deleted := make([]*instance.Instance, 0)
+	for _, node := range r.pool.members(health) {
+		if isDeleted(node) {
+			deleted = append(deleted, node)
+		} else {
+			members = append(members, node)
+		}
+	}
+	drifts := make([]Drift, 0)
+	compare := func(field, declared, actual string) {
+		if declared != "" && declared != actual {
+			drifts = append(drifts, Drift{Field: field, Declared: declared, Actual: actual})
+		}
+	}
+	compare("kubernetesVersion", r.spec.KubernetesVersion, health.version)
+	compare("nodeImageVariant", r.spec.NodeImageVariant, health.nodeImageVariant)
+	if r.spec.NodeCount != 0 && !r.countByProfiles {
+		compare("nodeCount", strconv.Itoa(r.spec.NodeCount), strconv.Itoa(len(members)))
+	}
+	result := &reconciliation{Policy: policy}
+	current := make(map[Drift]bool)
+	countDrifts := false
+	for _, d := range drifts {
+		current[d] = true
+		if d.Field == "nodeCount" {
+			countDrifts = true
+		}
+		if !r.reported[d] {
+			result.Drifts = append(result.Drifts, d)
+		}
+	}
+	r.reported = current
+	if policy != api.DriftPolicyCorrect || !countDrifts || r.failed {
+		if len(result.Drifts) == 0 {
+			return nil
+		}
+		return result
+	}
+	klog.Infof("Correcting nodes of cluster %s from %d to %d by its spec", r.pool.name, len(members), r.spec.NodeCount)
+	record := r.pool.newRecord(reconcileOperation, map[string]interface{}{"policy": policy, "nodeCount": r.spec.NodeCount})
+	result.Err = r.correctCount(health, members, deleted, result)
+	audit.Finish(record, r.pool.a.userID, result.Err)
+	if result.Err != nil {
+		klog.Errorf("Failed to correct nodes of cluster %s, drifts are only flagged from now on, err: %s", r.pool.name, result.Err.Error())
+		r.failed = true
+	} else {
+		// the count is found again by the next poll, it is reported if the correction does not hold
+		delete(r.reported, Drift{Field: "nodeCount", Declared: strconv.Itoa(r.spec.NodeCount), Actual: strconv.Itoa(len(members))})
+	}
+	return result
+}
+
+// correctCount adds or removes members to the count of the spec, nodes whose instances are gone leave the cluster first,
+// so they are not listed as not ready forever
+func (r *reconciler) correctCount(health *clusterHealth, members, deleted []*instance.Instance, result *reconciliation) error {
+	for _, node := range deleted {
+		if err := r.pool.remove(health, node, false); err != nil {
+			return err
+		}
+	}
+	if len(members) < r.spec.NodeCount {
+		like := &instance.Instance{VxNet: health.master.VxNet, InstanceClass: health.master.InstanceClass, SecurityGroup: health.master.SecurityGroup}
+		if len(members) != 0 {
+			like = members[0]
+		}
+		var err error
+		result.Added, err = r.pool.add(health, like, r.spec.NodeCount-len(members))
+		return err
+	}
+	for _, node := range removalOrder(health, members)[:len(members)-r.spec.NodeCount] {
+		if err := r.pool.remove(health, node, true); err != nil {
+			return err
+		}
+		result.Removed = append(result.Removed, node)
+	}
+	return nil
+}
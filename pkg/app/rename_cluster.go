@@ -0,0 +1,131 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+func (a *app) RunRename(opt *api.RenameClusterOption) error {
+	start := time.Now()
+	err := a.validateRenameInput(opt)
+	if err != nil {
+		return err
+	}
+	err = a.init(opt.Zone)
+	if err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	span := a.scope.StartRoot("RunRename")
+	span.SetAttribute("cluster.name", opt.ClusterName)
+	span.SetAttribute("cluster.new_name", opt.NewName)
+	a.record = audit.NewRecord("rename", opt.ClusterName, opt.Zone, opt)
+	err = a.runRename(opt)
+	audit.Finish(a.record, a.userID, err)
+	span.Finish(err)
+	notify.Send(notify.NewEvent("rename", opt.ClusterName, start, err))
+	return err
+}
+
+func (a *app) validateRenameInput(opt *api.RenameClusterOption) error {
+	if opt.ClusterName == "" || opt.NewName == "" {
+		return api.NewValidationError("Both old and new name of cluster must be specified")
+	}
+	if err := a.normalizeClusterName(&opt.NewName); err != nil {
+		return err
+	}
+	if opt.ClusterName == opt.NewName {
+		return api.NewValidationError("New name %s is the same as the old one", opt.NewName)
+	}
+	return nil
+}
+
+func (a *app) runRename(opt *api.RenameClusterOption) error {
+	oldTag, err := a.tagService.GetTagClusterByName(a.tagName(opt.ClusterName))
+	if err != nil {
+		klog.Errorf("Failed to get tag of cluster %s", opt.ClusterName)
+		return err
+	}
+	if oldTag == nil {
+		return api.NewValidationError("Cannot find the cluster %s in zone %s", opt.ClusterName, opt.Zone)
+	}
+	if err = a.checkOwner(oldTag); err != nil {
+		return err
+	}
+	exist, err := a.tagService.GetTagClusterByName(a.tagName(opt.NewName))
+	if err != nil {
+		return err
+	}
+	if exist != nil {
+		return api.NewValidationError("Cluster %s already exists", opt.NewName)
+	}
+	klog.Infof("Creating tag of cluster %s", opt.NewName)
+	newTagID, err := a.tagService.CreateTag(a.tagName(opt.NewName), oldTag.Description)
+	if err != nil {
+		return err
+	}
+	a.record.AddResource("tag", newTagID)
+	a.record.AddResource("instance", oldTag.Instances...)
+	err = a.tagService.TagInstances(newTagID, oldTag.Instances)
+	if err != nil {
+		klog.Error("Failed to tag instances with the new tag, the old tag is kept")
+		return err
+	}
+	for kind, ids := range oldTag.Resources {
+		if err = a.tagService.TagResources(newTagID, kind, ids); err != nil {
+			klog.Errorf("Failed to tag %s with the new tag, the old tag is kept", kind)
+			return err
+		}
+	}
+	for _, id := range oldTag.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			return err
+		}
+		name, ok := instance.RenameClusterInName(ins.Name, opt.ClusterName, opt.NewName)
+		if !ok {
+			klog.Warningf("Instance %s has a custom name %s, keep it", ins.ID, ins.Name)
+			continue
+		}
+		if err = a.instanceIface.RenameInstance(id, name); err != nil {
+			return err
+		}
+	}
+	klog.Infof("Deleting tag of cluster %s", opt.ClusterName)
+	err = a.tagService.DeleteTag(oldTag.TagID)
+	if err != nil {
+		return err
+	}
+	renameLocalFiles(opt.ClusterName, opt.NewName)
+	output.Printf("cluster %s renamed to %s\n", opt.ClusterName, opt.NewName)
+	return nil
+}
+
+// renameLocalFiles moves the default kubeconfig and bootstrap logs of cluster, files at custom locations are left alone
+func renameLocalFiles(oldName, newName string) {
+	logs := filepath.Join(api.ConfigDir(), "logs")
+	paths := [][2]string{
+		{api.DefaultKubeConfigPath(oldName), api.DefaultKubeConfigPath(newName)},
+		{filepath.Join(logs, oldName), filepath.Join(logs, newName)},
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p[0]); err != nil {
+			continue
+		}
+		if _, err := os.Stat(p[1]); err == nil {
+			klog.Warningf("%s already exists, keep %s", p[1], p[0])
+			continue
+		}
+		if err := os.Rename(p[0], p[1]); err != nil {
+			klog.Warningf("Failed to move %s to %s, err: %s", p[0], p[1], err.Error())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/audit"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// scaleOperation names events of scheduled scaling in notifications and audit records
+const scaleOperation = "scale"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// scalingProfile is how many nodes the pool has in a window of some weekdays, in local time
+type scalingProfile struct {
+	spec string
+	days [7]bool
+	// from and to are minutes of the day, the whole day if they are equal, windows like 22:00-06:00 pass midnight
+	from  int
+	to    int
+	count int
+}
+
+// parseScalingProfile parses profiles like "Mon-Fri 09:00-19:00=10", "Sat,Sun=2" or "*=3"
+func parseScalingProfile(s string) (*scalingProfile, error) {
+	invalid := api.NewValidationError("Invalid scaling profile '%s', it looks like 'Mon-Fri 09:00-19:00=10' or '*=3'", s)
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return nil, invalid
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(s[i+1:]))
+	if err != nil || count < 0 {
+		return nil, invalid
+	}
+	p := &scalingProfile{spec: s, count: count}
+	fields := strings.Fields(s[:i])
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, invalid
+	}
+	if fields[0] == "*" {
+		for d := range p.days {
+			p.days[d] = true
+		}
+	} else {
+		for _, part := range strings.Split(strings.ToLower(fields[0]), ",") {
+			bounds := strings.SplitN(part, "-", 2)
+			first, ok1 := weekdays[bounds[0]]
+			last, ok2 := first, true
+			if len(bounds) == 2 {
+				last, ok2 = weekdays[bounds[1]]
+			}
+			if !ok1 || !ok2 {
+				return nil, invalid
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				p.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+	if len(fields) == 2 {
+		bounds := strings.SplitN(fields[1], "-", 2)
+		if len(bounds) != 2 {
+			return nil, invalid
+		}
+		from, err1 := time.Parse("15:04", bounds[0])
+		to, err2 := time.Parse("15:04", bounds[1])
+		if err1 != nil || err2 != nil {
+			return nil, invalid
+		}
+		p.from = from.Hour()*60 + from.Minute()
+		p.to = to.Hour()*60 + to.Minute()
+	}
+	return p, nil
+}
+
+func (p *scalingProfile) matches(t time.Time) bool {
+	if !p.days[t.Weekday()] {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case p.from == p.to:
+		return true
+	case p.from < p.to:
+		return m >= p.from && m < p.to
+	}
+	return m >= p.from || m < p.to
+}
+
+// scaling is the result of scaling the pool to the count of a profile
+type scaling struct {
+	Profile string
+	From    int
+	To      int
+	Added   []*instance.Instance
+	Removed []*instance.Instance
+	Err     error
+}
+
+func (s *scaling) String() string {
+	msg := fmt.Sprintf("scaled nodes from %d to %d by profile '%s'", s.From, s.To, s.Profile)
+	for _, n := range s.Added {
+		msg += ", added " + n.ID
+	}
+	for _, n := range s.Removed {
+		msg += ", removed " + n.ID
+	}
+	if s.Err != nil {
+		msg += ", err: " + s.Err.Error()
+	}
+	return msg
+}
+
+// scaler keeps the count of nodes of the pool at the first profile matching the time, nothing is done if none matches
+type scaler struct {
+	pool     *nodePool
+	profiles []*scalingProfile
+}
+
+func (s *scaler) scale(health *clusterHealth, now time.Time) *scaling {
+	if health.nodeStatuses == nil || health.version == "" {
+		return nil
+	}
+	var profile *scalingProfile
+	for _, p := range s.profiles {
+		if p.matches(now) {
+			profile = p
+			break
+		}
+	}
+	if profile == nil {
+		return nil
+	}
+	members := make([]*instance.Instance, 0)
+	for _, node := range s.pool.members(health) {
+		if !isDeleted(node) {
+			members = append(members, node)
+		}
+	}
+	if len(members) == profile.count {
+		return nil
+	}
+	result := &scaling{Profile: profile.spec, From: len(members), To: profile.count}
+	klog.Infof("Scaling nodes of cluster %s from %d to %d by profile '%s'", s.pool.name, result.From, result.To, profile.spec)
+	record := s.pool.newRecord(scaleOperation, map[string]interface{}{"profile": profile.spec, "from": result.From, "to": result.To})
+	defer func() { audit.Finish(record, s.pool.a.userID, result.Err) }()
+	if len(members) < profile.count {
+		like := &instance.Instance{VxNet: health.master.VxNet, InstanceClass: health.master.InstanceClass, SecurityGroup: health.master.SecurityGroup}
+		if len(members) != 0 {
+			like = members[0]
+		}
+		result.Added, result.Err = s.pool.add(health, like, profile.count-len(members))
+		return result
+	}
+	for _, node := range removalOrder(health, members)[:len(members)-profile.count] {
+		if result.Err = s.pool.remove(health, node, true); result.Err != nil {
+			break
+		}
+		result.Removed = append(result.Removed, node)
+	}
+	return result
+}
+
+// removalOrder sorts members in the order they are removed, nodes which are not ready go first, then the newest ones
+func removalOrder(health *clusterHealth, members []*instance.Instance) []*instance.Instance {
+	victims := make([]*instance.Instance, 0, len(members))
+	for i := len(members) - 1; i >= 0; i-- {
+		if status, ok := health.nodeStatuses[members[i].IP]; !ok || status.Conditions["Ready"] != "True" {
+			victims = append(victims, members[i])
+		}
+	}
+	for i := len(members) - 1; i >= 0; i-- {
+		if status, ok := health.nodeStatuses[members[i].IP]; ok && status.Conditions["Ready"] == "True" {
+			victims = append(victims, members[i])
+		}
+	}
+	return victims
+}
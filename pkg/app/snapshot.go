@@ -0,0 +1,48 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	"k8s.io/klog"
+)
+
+func validateSnapshotID(id string) error {
+	if id != "" && !strings.HasPrefix(id, "ss-") {
+		return api.NewValidationError("Snapshot %s must be the id of an instance snapshot like 'ss-xxxx'", id)
+	}
+	return nil
+}
+
+// useNodeSnapshot makes the snapshot of opt the node image variant of opt, it is captured only if the zone has no
+// available image of it yet, so clusters created from the same snapshot share one image
+func (a *app) useNodeSnapshot(opt *api.CreateClusterOption) error {
+	if a.imageService == nil {
+		return fmt.Errorf("No image service to capture snapshot %s in zone %s", opt.NodeSnapshot, opt.Zone)
+	}
+	preset, err := api.PresetFor(opt.KubernetesVersion, opt.Zone, opt.Arch)
+	if err != nil {
+		return err
+	}
+	opt.NodeImageVariant = opt.NodeSnapshot
+	if id, ok := preset.NodeImageVariants[opt.NodeSnapshot]; ok {
+		status, err := a.imageService.GetImageStatus(id)
+		if err != nil {
+			return err
+		}
+		if status[id] == image.StatusAvailable {
+			klog.Infof("Creating nodes from image %s of snapshot %s", id, opt.NodeSnapshot)
+			return nil
+		}
+		klog.Warningf("Image %s of snapshot %s is not available in zone %s, capturing it again", id, opt.NodeSnapshot, opt.Zone)
+	}
+	name := fmt.Sprintf("qks-%s-%s", opt.KubernetesVersion, opt.NodeSnapshot)
+	klog.Infof("Capturing snapshot %s as image %s", opt.NodeSnapshot, name)
+	id, err := a.imageService.CaptureImageFromSnapshot(opt.NodeSnapshot, name)
+	if err != nil {
+		return err
+	}
+	return api.SaveNodeImageVariant(api.ZoneImagesFile(), opt.KubernetesVersion, opt.Zone, opt.Arch, opt.NodeSnapshot, id)
+}
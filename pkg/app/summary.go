@@ -0,0 +1,88 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+)
+
+// ClusterSummary is printed after a cluster is created
+type ClusterSummary struct {
+	Name              string
+	Zone              string
+	KubernetesVersion string
+	CNIName           string
+	Master            *instance.Instance
+	// APIServer is host:port of apiserver in kubeconfig
+	APIServer string
+	// EndpointHost is the dns name of control plane endpoint which is pinned to master on machines only,
+	// it must resolve to master for others as well
+	EndpointHost string
+	Nodes        []*instance.Instance
+	// FailedNodes are nodes which could not join the cluster
+	FailedNodes    []*instance.Instance
+	KubeconfigPath string
+	// IngressAddress is the eip of ingress if it is exposed
+	IngressAddress string
+	// KubeSphereConsole is the url of KubeSphere console if it is installed
+	KubeSphereConsole string
+	Duration          time.Duration
+}
+
+func (s *ClusterSummary) Print(w io.Writer) {
+	if output.IsQuiet() {
+		fmt.Fprintf(w, "cluster %s is ready, apiserver https://%s\n", s.Name, s.APIServer)
+		for _, n := range s.FailedNodes {
+			fmt.Fprintf(w, "node %s %s failed to join\n", n.ID, n.IP)
+		}
+		return
+	}
+	fmt.Fprintf(w, "\nCluster %s is ready (k8s v%s, cni %s, zone %s) in %s\n\n", s.Name, s.KubernetesVersion, s.CNIName, s.Zone, s.Duration.Round(time.Second))
+	fmt.Fprintf(w, "API server: https://%s\n", s.APIServer)
+	if s.IngressAddress != "" {
+		fmt.Fprintf(w, "Ingress: http://%s\n", s.IngressAddress)
+	}
+	if s.KubeSphereConsole != "" {
+		fmt.Fprintf(w, "KubeSphere console: %s (%s / %s)\n", s.KubeSphereConsole, addon.KubeSphereDefaultUser, addon.KubeSphereDefaultPassword)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tID\tIP\tSTATUS")
+	fmt.Fprintf(tw, "master\t%s\t%s\tjoined\n", s.Master.ID, s.Master.IP)
+	for _, n := range s.Nodes {
+		fmt.Fprintf(tw, "node\t%s\t%s\t%s\n", n.ID, n.IP, s.nodeStatus(n))
+	}
+	tw.Flush()
+	if len(s.FailedNodes) != 0 {
+		fmt.Fprintf(w, "\n%d nodes need repair, check their join logs in the bootstrap log dir\n", len(s.FailedNodes))
+	}
+	fmt.Fprintln(w, "\nNext steps:")
+	if s.IngressAddress != "" {
+		fmt.Fprintf(w, "  allow tcp 80 and 443 in the security group of machines to reach the ingress\n")
+	}
+	if s.KubeSphereConsole != "" {
+		fmt.Fprintf(w, "  log into KubeSphere console and change the default password\n")
+	}
+	if s.EndpointHost != "" {
+		fmt.Fprintf(w, "  make sure %s resolves to %s, e.g. by a dns record\n", s.EndpointHost, s.Master.IP)
+	}
+	if s.KubeconfigPath != "" {
+		fmt.Fprintf(w, "  export KUBECONFIG=%s\n  kubectl get nodes\n", s.KubeconfigPath)
+	} else {
+		fmt.Fprintf(w, "  ssh root@%s kubectl get nodes\n", s.Master.IP)
+	}
+}
+
+func (s *ClusterSummary) nodeStatus(n *instance.Instance) string {
+	for _, f := range s.FailedNodes {
+		if f.ID == n.ID {
+			return "NEEDS REPAIR"
+		}
+	}
+	return "joined"
+}
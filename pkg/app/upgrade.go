@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/addon"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"github.com/magicsong/yunify-k8s/pkg/upgrade"
+	"k8s.io/klog"
+)
+
+// RunUpgradePlan reports the upgrade path of a cluster and what breaks on the way, nothing is changed
+func (a *app) RunUpgradePlan(opt *api.UpgradePlanOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	state, err := a.discoverCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	from := state.spec.KubernetesVersion
+	if from == "" {
+		return api.NewValidationError("Cannot tell the kubernetes version of cluster %s", opt.ClusterName)
+	}
+	// the target may have no images in the zone yet, they are built for the upgrade
+	if err := resolveKubernetesVersion(&opt.KubernetesVersion, "", ""); err != nil {
+		return err
+	}
+	steps, err := upgrade.Path(from, opt.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	fromMinor, _ := upgrade.Minor(from)
+	removed := upgrade.RemovedBetween(fromMinor, steps[len(steps)-1].Minor)
+	report := &upgrade.Report{Cluster: opt.ClusterName, From: from, To: opt.KubernetesVersion, Steps: steps}
+	bootstrapper := a.newBootstrapper(a.sshRunner, state.spec)
+	scanObjects(report, bootstrapper, state.master, removed)
+	t, err := a.getOwnedCluster(opt.ClusterName, opt.Zone)
+	if err != nil {
+		return err
+	}
+	checkAddons(report, api.ParseClusterMetadata(t.Description).Addons, opt, removed)
+	report.Render(output.Out)
+	return nil
+}
+
+// scanObjects lists every resource with removed apis once, and reports objects applied with them
+func scanObjects(report *upgrade.Report, b bootstrap.Interface, master *instance.Instance, removed []upgrade.RemovedAPI) {
+	listed := make(map[string]bool)
+	for _, r := range removed {
+		if listed[r.Resource] {
+			continue
+		}
+		listed[r.Resource] = true
+		out, err := b.Kubectl(master, "get "+r.Resource+" --all-namespaces -o json")
+		if err != nil {
+			// kinds newer than the cluster are not served at all
+			if !strings.Contains(string(out), "doesn't have a resource type") {
+				klog.Warningf("Failed to list %s, err: %s, output: %s", r.Resource, err.Error(), strings.TrimSpace(string(out)))
+				report.Unchecked = append(report.Unchecked, r.Resource+" cannot be listed")
+			}
+			continue
+		}
+		objects, err := upgrade.AppliedObjects(out)
+		if err != nil {
+			report.Unchecked = append(report.Unchecked, fmt.Sprintf("%s cannot be parsed, err: %s", r.Resource, err.Error()))
+			continue
+		}
+		for _, o := range objects {
+			report.AddRemoved(o.Kind+" "+o.Name, o.TypeMeta, removed)
+		}
+	}
+}
+
+// checkAddons renders installed addons for the target version, addons from urls or charts cannot be rendered here
+func checkAddons(report *upgrade.Report, installed map[string]string, opt *api.UpgradePlanOption, removed []upgrade.RemovedAPI) {
+	names := make([]string, 0, len(installed))
+	for name := range installed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cluster := &api.CreateClusterOption{ClusterName: opt.ClusterName, Zone: opt.Zone, KubernetesVersion: opt.KubernetesVersion}
+	for _, name := range names {
+		subject := "addon " + name
+		if installed[name] != "" {
+			subject += " " + installed[name]
+		}
+		a, ctx, err := addon.NewContext(&api.AddonOption{Name: name, Version: installed[name]}, cluster)
+		if err != nil {
+			report.Unchecked = append(report.Unchecked, subject+" is unknown to this qks")
+			continue
+		}
+		if a.MinKubernetesVersion != "" {
+			var major, minor int
+			fmt.Sscanf(a.MinKubernetesVersion, "%d.%d", &major, &minor)
+			if !api.VersionAtLeast(opt.KubernetesVersion, major, minor) {
+				report.Findings = append(report.Findings, upgrade.Finding{Subject: subject, Problem: "needs kubernetes " + a.MinKubernetesVersion + " or later"})
+			}
+		}
+		if a.Manifests != nil {
+			manifests, err := a.Manifests(ctx)
+			if err != nil {
+				report.Unchecked = append(report.Unchecked, fmt.Sprintf("%s cannot be rendered, err: %s", subject, err.Error()))
+			}
+			for _, t := range upgrade.ManifestTypes(manifests) {
+				report.AddRemoved(subject, t, removed)
+			}
+		}
+		if a.URLs != nil {
+			report.Unchecked = append(report.Unchecked, fmt.Sprintf("%s applies %s", subject, strings.Join(a.URLs(ctx), ", ")))
+		}
+		if a.Chart != nil {
+			report.Unchecked = append(report.Unchecked, fmt.Sprintf("%s is chart %s/%s, check it supports kubernetes %s", subject, a.Chart.Repo, a.Chart.Name, opt.KubernetesVersion))
+		}
+	}
+}
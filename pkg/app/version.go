@@ -0,0 +1,19 @@
+package app
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"k8s.io/klog"
+)
+
+// resolveKubernetesVersion resolves an alias like "1.15" or "latest" in place, logging what it resolves to
+func resolveKubernetesVersion(version *string, zone, arch string) error {
+	resolved, err := api.ResolveKubernetesVersion(*version, zone, arch)
+	if err != nil {
+		return err
+	}
+	if resolved != *version {
+		klog.Infof("Kubernetes version %s resolves to %s", *version, resolved)
+		*version = resolved
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/notify"
+	"github.com/magicsong/yunify-k8s/pkg/output"
+	"k8s.io/klog"
+)
+
+const (
+	// watchOperation names events of watching in notifications
+	watchOperation = "watch"
+	// apiserverSubject is the state of listing nodes from master
+	apiserverSubject = "apiserver"
+)
+
+// healthTransition is a subject, like an instance or a node, changing its state between two polls
+type healthTransition struct {
+	Subject string
+	From    string
+	To      string
+}
+
+func (t healthTransition) String() string {
+	switch {
+	case t.From == "":
+		return fmt.Sprintf("%s is %s", t.Subject, t.To)
+	case t.To == "":
+		return fmt.Sprintf("%s is gone, it was %s", t.Subject, t.From)
+	}
+	return fmt.Sprintf("%s: %s -> %s", t.Subject, t.From, t.To)
+}
+
+// Healthy tells whether the new state is fine, pressures of nodes are not
+func (t healthTransition) Healthy() bool {
+	return t.To == instance.StatusRunning || t.To == "Ready" || t.To == "reachable"
+}
+
+// RunWatch polls instances and nodes of a cluster and prints their state transitions until interrupted
+func (a *app) RunWatch(opt *api.WatchOption) error {
+	if opt.ClusterName == "" {
+		return api.NewValidationError("ClusterName cannot be empty")
+	}
+	if opt.Interval <= 0 {
+		return api.NewValidationError("Interval of watching must be positive, got %s", opt.Interval)
+	}
+	if opt.Heal && (opt.NotReadyThreshold <= 0 || opt.MaxReplacementsPerHour <= 0) {
+		return api.NewValidationError("Healing needs a positive threshold of not ready nodes and max replacements per hour")
+	}
+	profiles := make([]*scalingProfile, 0, len(opt.ScalingProfiles))
+	for _, s := range opt.ScalingProfiles {
+		p, err := parseScalingProfile(s)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+	if err := validateDriftPolicy(opt.DriftPolicy); err != nil {
+		return err
+	}
+	var spec *api.CreateClusterOption
+	if opt.SpecPath != "" {
+		var err error
+		if spec, err = readSpec(opt.SpecPath); err != nil {
+			return err
+		}
+		if spec.ClusterName != "" && spec.ClusterName != opt.ClusterName {
+			return api.NewValidationError("Spec %s is of cluster %s, not %s", opt.SpecPath, spec.ClusterName, opt.ClusterName)
+		}
+		if spec.UserData != "" {
+			if _, err = bootstrap.LoadUserData(spec.UserData); err != nil {
+				return err
+			}
+		}
+		if err = bootstrap.ValidateBootWait(spec.BootWait); err != nil {
+			return err
+		}
+	}
+	if err := a.init(opt.Zone); err != nil {
+		klog.Error("Falied to init command")
+		return err
+	}
+	if _, err := a.getOwnedCluster(opt.ClusterName, opt.Zone); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	if opt.BootstrapLogDir == "" {
+		opt.BootstrapLogDir = filepath.Join(api.ConfigDir(), "logs", opt.ClusterName)
+	}
+	pool := &nodePool{a: a, name: opt.ClusterName, zone: opt.Zone, logDir: opt.BootstrapLogDir, retired: make(map[string]bool)}
+	var h *healer
+	if opt.Heal {
+		h = newHealer(pool, opt)
+	}
+	var sc *scaler
+	if len(profiles) != 0 {
+		sc = &scaler{pool: pool, profiles: profiles}
+	}
+	var rc *reconciler
+	if spec != nil {
+		pool.userData = spec.UserData
+		pool.bootWait, pool.bootWaitTimeout = spec.BootWait, spec.BootWaitTimeout
+		rc = &reconciler{pool: pool, spec: spec, policy: opt.DriftPolicy, countByProfiles: sc != nil}
+	}
+	var last map[string]string
+	for round := 1; ; round++ {
+		health := a.pollHealth(opt.ClusterName, opt.Zone)
+		for _, t := range healthTransitions(last, health.states) {
+			output.Printf("%s %s\n", time.Now().Format("15:04:05"), t)
+			// the first poll is what the cluster looks like, not something that happens
+			if opt.Notify && last != nil {
+				notify.Send(notify.NewMessageEvent(watchOperation, opt.ClusterName, t.String(), t.Healthy()))
+			}
+		}
+		last = health.states
+		healed := 0
+		if h != nil {
+			for _, r := range h.heal(health, time.Now()) {
+				healed++
+				output.Printf("%s %s\n", time.Now().Format("15:04:05"), r)
+				if opt.Notify {
+					notify.Send(notify.NewMessageEvent(healOperation, opt.ClusterName, r.String(), r.Err == nil))
+				}
+			}
+		}
+		// nodes are counted again in the next poll if healing changed them
+		scaled := false
+		if sc != nil && healed == 0 {
+			if s := sc.scale(health, time.Now()); s != nil {
+				scaled = true
+				output.Printf("%s %s\n", time.Now().Format("15:04:05"), s)
+				if opt.Notify {
+					notify.Send(notify.NewMessageEvent(scaleOperation, opt.ClusterName, s.String(), s.Err == nil))
+				}
+			}
+		}
+		if rc != nil && healed == 0 && !scaled {
+			if r := rc.reconcile(health); r != nil {
+				output.Printf("%s %s\n", time.Now().Format("15:04:05"), r)
+				if opt.Notify {
+					notify.Send(notify.NewMessageEvent(reconcileOperation, opt.ClusterName, r.String(), r.Healthy()))
+				}
+			}
+		}
+		if opt.Rounds > 0 && round >= opt.Rounds {
+			return nil
+		}
+		select {
+		case <-interrupt:
+			return nil
+		case <-time.After(opt.Interval):
+		}
+	}
+}
+
+// clusterHealth is what a poll sees of a cluster
+type clusterHealth struct {
+	// states are keyed by their subjects, like "instance i-xxx" or "node name"
+	states  map[string]string
+	tagID   string
+	version string
+	// nodeImageVariant is the one in the metadata of the cluster
+	nodeImageVariant string
+	master           *instance.Instance
+	nodes            []*instance.Instance
+	// nodeStatuses are keyed by internal ips, it is nil if the apiserver cannot be reached
+	nodeStatuses map[string]bootstrap.NodeStatus
+	// driftPolicy is the one in the metadata of the cluster
+	driftPolicy string
+}
+
+// pollHealth looks up the cluster again in every poll, as its instances may change
+func (a *app) pollHealth(name, zone string) *clusterHealth {
+	health := &clusterHealth{states: make(map[string]string)}
+	// polls may be closer than the ttl of the caches
+	cache.Invalidate(a.tagService, a.instanceIface)
+	t, err := a.getOwnedCluster(name, zone)
+	if err != nil {
+		klog.Warningf("Failed to get cluster %s, err: %s", name, err.Error())
+		health.states["cluster"] = "unknown"
+		return health
+	}
+	health.tagID = t.TagID
+	masterName := instance.GeneateName(name, api.RoleMaster)
+	for _, id := range t.Instances {
+		ins, err := a.instanceIface.GetInstance(id)
+		if err != nil {
+			klog.Warningf("Failed to get instance %s, err: %s", id, err.Error())
+			health.states["instance "+id] = "unknown"
+			continue
+		}
+		health.states["instance "+id] = ins.Status
+		if ins.Name == masterName {
+			health.master = ins
+		} else {
+			health.nodes = append(health.nodes, ins)
+		}
+	}
+	master := health.master
+	if master == nil || master.Status != instance.StatusRunning {
+		health.states[apiserverSubject] = "unreachable"
+		return health
+	}
+	metadata := api.ParseClusterMetadata(t.Description)
+	health.version = metadata.KubernetesVersion
+	health.nodeImageVariant = metadata.NodeImageVariant
+	health.driftPolicy = metadata.DriftPolicy
+	if health.version == "" {
+		health.version = api.VersionOfMasterImage(zone, master.ImageID)
+	}
+	bootstrapper := a.newBootstrapper(a.sshRunner, &api.CreateClusterOption{ClusterName: name, Zone: zone, KubernetesVersion: health.version})
+	nodes, err := bootstrapper.NodeStatuses(master)
+	if err != nil {
+		klog.Warningf("Failed to get nodes of cluster %s, err: %s", name, err.Error())
+		health.states[apiserverSubject] = "unreachable"
+		return health
+	}
+	health.states[apiserverSubject] = "reachable"
+	health.nodeStatuses = make(map[string]bootstrap.NodeStatus)
+	for _, n := range nodes {
+		health.states["node "+n.Name] = n.State()
+		health.nodeStatuses[n.IP] = n
+	}
+	return health
+}
+
+// healthTransitions compares two polls, subjects are sorted so instances come before nodes
+func healthTransitions(last, current map[string]string) []healthTransition {
+	subjects := make([]string, 0, len(current))
+	for s := range current {
+		subjects = append(subjects, s)
+	}
+	for s := range last {
+		if _, ok := current[s]; !ok {
+			subjects = append(subjects, s)
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if strings.HasPrefix(subjects[i], "instance ") != strings.HasPrefix(subjects[j], "instance ") {
+			return strings.HasPrefix(subjects[i], "instance ")
+		}
+		return subjects[i] < subjects[j]
+	})
+	transitions := make([]healthTransition, 0)
+	for _, s := range subjects {
+		if last[s] != current[s] {
+			transitions = append(transitions, healthTransition{Subject: s, From: last[s], To: current[s]})
+		}
+	}
+	return transitions
+}
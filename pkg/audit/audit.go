@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"k8s.io/klog"
+)
+
+const QingStorScheme = "qingstor://"
+
+// Record is one audited operation
+type Record struct {
+	Time       time.Time           `json:"time"`
+	User       string              `json:"user"`
+	CloudUser  string              `json:"cloudUser,omitempty"`
+	Operation  string              `json:"operation"`
+	Cluster    string              `json:"cluster"`
+	Zone       string              `json:"zone"`
+	Parameters interface{}         `json:"parameters,omitempty"`
+	Result     string              `json:"result"`
+	Error      string              `json:"error,omitempty"`
+	Resources  map[string][]string `json:"resources,omitempty"`
+
+	mu sync.Mutex
+}
+
+// NewRecord starts a record of operation, secret fields of parameters are redacted as records are kept for long
+func NewRecord(operation, cluster, zone string, parameters interface{}) *Record {
+	r := &Record{
+		Time:       time.Now(),
+		User:       currentUser(),
+		Operation:  operation,
+		Cluster:    cluster,
+		Zone:       zone,
+		Parameters: log.RedactFields(parameters),
+		Resources:  make(map[string][]string),
+	}
+	return r
+}
+
+// AddResource records ids of resources touched by the operation, it is safe to call on nil
+func (r *Record) AddResource(kind string, ids ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Resources[kind] = append(r.Resources[kind], ids...)
+}
+
+func (r *Record) finish(err error) {
+	r.Result = "success"
+	if err != nil {
+		r.Result = "failure"
+		// errors may carry output of bootstrap, like join commands with tokens
+		r.Error = log.Redact(err.Error())
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+type Sink interface {
+	Write(*Record) error
+}
+
+type fileSink struct {
+	path string
+}
+
+func (f *fileSink) Write(r *Record) error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+var target string
+var sink Sink
+
+var qingStor *qingStorSink
+
+// Configure sets where audit records go, either a local file path or "qingstor://bucket/prefix?zone=pek3b"
+func Configure(t string) error {
+	target = t
+	sink = nil
+	qingStor = nil
+	if t == "" {
+		return nil
+	}
+	if strings.HasPrefix(t, QingStorScheme) {
+		// records are put once the access key is given
+		s, err := newQingStorSink(t)
+		if err != nil {
+			return err
+		}
+		qingStor = s
+		return nil
+	}
+	sink = &fileSink{path: t}
+	return nil
+}
+
+// SetCredentials is called once the access key is loaded, qingstor sink needs it to sign requests.
+// It is called again whenever qks switches zone, the sink is kept if the access key is the same.
+func SetCredentials(accessKeyID, secretAccessKey string) error {
+	if qingStor == nil {
+		return nil
+	}
+	if sink == nil || qingStor.accessKeyID != accessKeyID || qingStor.secretAccessKey != secretAccessKey {
+		qingStor.accessKeyID, qingStor.secretAccessKey = accessKeyID, secretAccessKey
+		sink = qingStor
+	}
+	return nil
+}
+
+// Finish writes the record with the result of operation, failures are only logged
+func Finish(r *Record, cloudUser string, err error) {
+	if target == "" || r == nil {
+		return
+	}
+	r.CloudUser = cloudUser
+	r.finish(err)
+	if sink == nil {
+		klog.Warningf("Audit target %s is not ready, record of %s is dropped", target, r.Operation)
+		return
+	}
+	if werr := sink.Write(r); werr != nil {
+		klog.Warningf("Failed to write audit record, err: %s", werr.Error())
+	}
+}
+
+func objectKey(prefix string, r *Record) string {
+	name := fmt.Sprintf("%s-%s-%s.json", r.Time.UTC().Format("20060102T150405Z"), r.Operation, r.Cluster)
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "qks-audit")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Configure("")
+		os.RemoveAll(dir)
+	})
+
+	It("Should append records to a local file with secrets redacted", func() {
+		path := filepath.Join(dir, "audit.log")
+		Expect(Configure(path)).To(Succeed())
+		Expect(SetCredentials("AKID", "SECRET")).To(Succeed())
+		r := NewRecord("create", "test", "ap2a", map[string]string{"clusterName": "test", "secretAccessKey": "SECRET"})
+		r.AddResource("instance", "i-1", "i-2")
+		Finish(r, "usr-test", fmt.Errorf("join failed: kubeadm join 192.168.0.2:6443 --token abcdef.0123456789abcdef"))
+		Finish(NewRecord("delete", "test", "ap2a", nil), "usr-test", nil)
+		// nil records of operations which never started are skipped
+		Finish(nil, "usr-test", nil)
+
+		info, err := os.Stat(path)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		content, err := ioutil.ReadFile(path)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(content)).NotTo(ContainSubstring("SECRET"))
+		Expect(string(content)).NotTo(ContainSubstring("abcdef.0123456789abcdef"))
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		Expect(lines).To(HaveLen(2))
+		var failed, deleted map[string]interface{}
+		Expect(json.Unmarshal([]byte(lines[0]), &failed)).To(Succeed())
+		Expect(json.Unmarshal([]byte(lines[1]), &deleted)).To(Succeed())
+		Expect(failed).To(HaveKeyWithValue("operation", "create"))
+		Expect(failed).To(HaveKeyWithValue("cloudUser", "usr-test"))
+		Expect(failed).To(HaveKeyWithValue("result", "failure"))
+		Expect(failed["error"]).To(ContainSubstring("--token"))
+		Expect(failed["parameters"]).To(HaveKeyWithValue("clusterName", "test"))
+		Expect(failed["resources"]).To(HaveKeyWithValue("instance", ConsistOf("i-1", "i-2")))
+		Expect(deleted).To(HaveKeyWithValue("result", "success"))
+		Expect(deleted).NotTo(HaveKey("error"))
+
+		// a record keeps nothing if audit is not configured
+		Configure("")
+		Finish(NewRecord("create", "other", "ap2a", nil), "usr-test", nil)
+		content, _ = ioutil.ReadFile(path)
+		Expect(strings.Split(strings.TrimSpace(string(content)), "\n")).To(HaveLen(2))
+	})
+
+	It("Should put records to a bucket of the qingstor zone in the target signed by the access key", func() {
+		type put struct {
+			method, path, contentType, date, authorization string
+			body                                           []byte
+		}
+		puts := make([]put, 0)
+		status := http.StatusCreated
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			puts = append(puts, put{r.Method, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Date"), r.Header.Get("Authorization"), body})
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+
+		Expect(Configure("qingstor://audit/qks/records")).To(MatchError(ContainSubstring("zone")))
+		Expect(Configure("qingstor:///qks?zone=pek3b")).To(MatchError(ContainSubstring("bucket")))
+		Expect(Configure("qingstor://audit/qks/records?zone=pek3b")).To(Succeed())
+		Expect(qingStor.endpoint).To(Equal("https://audit.pek3b.qingstor.com"))
+		Expect(qingStor.prefix).To(Equal("qks/records"))
+		qingStor.endpoint = server.URL
+
+		// records before the access key is loaded are dropped
+		Finish(NewRecord("create", "test", "ap2a", nil), "usr-test", nil)
+		Expect(puts).To(BeEmpty())
+
+		Expect(SetCredentials("AKID", "SECRET")).To(Succeed())
+		s := sink
+		// init switching zone gives the same access key again
+		Expect(SetCredentials("AKID", "SECRET")).To(Succeed())
+		Expect(sink).To(BeIdenticalTo(s))
+
+		r := NewRecord("create", "test", "ap2a", nil)
+		Finish(r, "usr-test", nil)
+		Expect(puts).To(HaveLen(1))
+		p := puts[0]
+		Expect(p.method).To(Equal(http.MethodPut))
+		Expect(p.path).To(Equal("/" + objectKey("qks/records", r)))
+		Expect(p.path).To(MatchRegexp(`^/qks/records/\d{8}T\d{6}Z-create-test\.json$`))
+		Expect(p.contentType).To(Equal("application/json"))
+		Expect(p.date).NotTo(BeEmpty())
+		h := hmac.New(sha256.New, []byte("SECRET"))
+		h.Write([]byte("PUT\n\napplication/json\n" + p.date + "\n/audit" + p.path))
+		Expect(p.authorization).To(Equal("QS AKID:" + base64.StdEncoding.EncodeToString(h.Sum(nil))))
+		var written map[string]interface{}
+		Expect(json.Unmarshal(p.body, &written)).To(Succeed())
+		Expect(written).To(HaveKeyWithValue("cluster", "test"))
+
+		// failures of qingstor do not fail the operation
+		status = http.StatusForbidden
+		Expect(func() { Finish(NewRecord("delete", "test", "ap2a", nil), "usr-test", nil) }).NotTo(Panic())
+		Expect(puts).To(HaveLen(2))
+		Expect(qingStor.Write(NewRecord("delete", "test", "ap2a", nil))).To(MatchError(ContainSubstring("403")))
+
+		Expect(SetCredentials("AKID2", "SECRET2")).To(Succeed())
+		Expect(qingStor.accessKeyID).To(Equal("AKID2"))
+	})
+})
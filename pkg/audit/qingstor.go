@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type qingStorSink struct {
+	bucket string
+	prefix string
+	// endpoint is where objects of the bucket are put, https://<bucket>.<zone>.qingstor.com
+	endpoint        string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+}
+
+// newQingStorSink parses target like qingstor://bucket/prefix?zone=pek3b, zones of qingstor are not those of instances
+func newQingStorSink(target string) (*qingStorSink, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Must specify a bucket for audit records, e.g. qingstor://bucket/prefix?zone=pek3b")
+	}
+	zone := u.Query().Get("zone")
+	if zone == "" {
+		return nil, fmt.Errorf("Must specify the qingstor zone of bucket %s for audit records, e.g. qingstor://%s/prefix?zone=pek3b", u.Host, u.Host)
+	}
+	return &qingStorSink{
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		endpoint: fmt.Sprintf("https://%s.%s.qingstor.com", u.Host, zone),
+		client:   &http.Client{Timeout: time.Second * 30},
+	}, nil
+}
+
+// Write puts every record as a standalone object, object keys are ordered by time
+func (q *qingStorSink) Write(r *Record) error {
+	r.mu.Lock()
+	body, err := json.Marshal(r)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	key := objectKey(q.prefix, r)
+	req, err := http.NewRequest(http.MethodPut, q.endpoint+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Authorization", q.sign(req, "/"+q.bucket+"/"+key))
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Failed to put audit record %s, qingstor returns %s", key, resp.Status)
+	}
+	return nil
+}
+
+// sign implements the qingstor header signature
+func (q *qingStorSink) sign(req *http.Request, resource string) string {
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+		resource,
+	}, "\n")
+	h := hmac.New(sha256.New, []byte(q.secretAccessKey))
+	h.Write([]byte(stringToSign))
+	return fmt.Sprintf("QS %s:%s", q.accessKeyID, base64.StdEncoding.EncodeToString(h.Sum(nil)))
+}
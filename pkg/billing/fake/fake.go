@@ -0,0 +1,29 @@
+package fake
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+)
+
+var _ billing.Interface = &BillingService{}
+
+// BillingService returns leases set by tests, other resources are free
+type BillingService struct {
+	recorder.Recorder
+	Leases map[string]*billing.Lease
+}
+
+func NewBillingService() *BillingService {
+	return &BillingService{Leases: make(map[string]*billing.Lease)}
+}
+
+func (f *BillingService) SetLease(lease *billing.Lease) {
+	f.Leases[lease.ResourceID] = lease
+}
+
+func (f *BillingService) GetLease(resourceID string) (*billing.Lease, error) {
+	if err := f.Record("GetLease", resourceID); err != nil {
+		return nil, err
+	}
+	return f.Leases[resourceID], nil
+}
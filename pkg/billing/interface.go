@@ -0,0 +1,42 @@
+package billing
+
+import "time"
+
+const (
+	UnitHour  = "hour"
+	UnitMonth = "month"
+	// HoursPerMonth is how qingcloud converts monthly leases to hours
+	HoursPerMonth = 24 * 30
+)
+
+// Lease is how a resource is charged
+type Lease struct {
+	ResourceID string
+	// Price is charged every Unit
+	Price float64
+	Unit  string
+	// Since is when the charge starts
+	Since time.Time
+}
+
+// HourlyPrice converts the price of lease to the price of one hour
+func (l *Lease) HourlyPrice() float64 {
+	if l.Unit == UnitMonth {
+		return l.Price / HoursPerMonth
+	}
+	return l.Price
+}
+
+// Accumulated is the cost from Since to now
+func (l *Lease) Accumulated(now time.Time) float64 {
+	hours := now.Sub(l.Since).Hours()
+	if hours < 0 {
+		return 0
+	}
+	return l.HourlyPrice() * hours
+}
+
+type Interface interface {
+	// GetLease returns nil for resources which are not charged, like stopped instances
+	GetLease(resourceID string) (*Lease, error)
+}
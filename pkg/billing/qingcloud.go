@@ -0,0 +1,81 @@
+package billing
+
+import (
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/yunify/qingcloud-sdk-go/config"
+	"github.com/yunify/qingcloud-sdk-go/request"
+	"github.com/yunify/qingcloud-sdk-go/request/data"
+)
+
+// the vendored sdk has no billing apis, GetLeaseInfo is built like the generated operations
+type qingcloudBilling struct {
+	config     *config.Config
+	properties *properties
+}
+
+type properties struct {
+	Zone *string `json:"zone" name:"zone"`
+}
+
+func NewQingCloudBillingService(config *config.Config, zone string) Interface {
+	return &qingcloudBilling{
+		config:     config,
+		properties: &properties{Zone: &zone},
+	}
+}
+
+type getLeaseInfoInput struct {
+	Resource *string `json:"resource" name:"resource" location:"params"`
+}
+
+func (v *getLeaseInfoInput) Validate() error {
+	return nil
+}
+
+type leaseInfo struct {
+	ResourceID *string `json:"resource_id" name:"resource_id"`
+	Status     *string `json:"status" name:"status"`
+	Contract   *struct {
+		Price      *float64   `json:"price" name:"price"`
+		Unit       *string    `json:"unit" name:"unit"`
+		CreateTime *time.Time `json:"create_time" name:"create_time" format:"ISO 8601"`
+	} `json:"contract" name:"contract"`
+}
+
+type getLeaseInfoOutput struct {
+	Message   *string    `json:"message" name:"message"`
+	Action    *string    `json:"action" name:"action" location:"elements"`
+	LeaseInfo *leaseInfo `json:"lease_info" name:"lease_info" location:"elements"`
+	RetCode   *int       `json:"ret_code" name:"ret_code" location:"elements"`
+}
+
+func (q *qingcloudBilling) GetLease(resourceID string) (*Lease, error) {
+	o := &data.Operation{
+		Config:        q.config,
+		Properties:    q.properties,
+		APIName:       "GetLeaseInfo",
+		RequestMethod: "GET",
+	}
+	output := &getLeaseInfoOutput{}
+	r, err := request.New(o, &getLeaseInfoInput{Resource: &resourceID}, output)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Send(); err != nil {
+		return nil, api.FromQingCloud(err, "Error in getting lease of %s", resourceID)
+	}
+	info := output.LeaseInfo
+	if info == nil || info.Contract == nil || info.Contract.Price == nil || (info.Status != nil && *info.Status != "active") {
+		return nil, nil
+	}
+	lease := &Lease{ResourceID: resourceID, Price: *info.Contract.Price, Unit: UnitHour}
+	if info.Contract.Unit != nil {
+		lease.Unit = *info.Contract.Unit
+	}
+	if info.Contract.CreateTime != nil {
+		lease.Since = *info.Contract.CreateTime
+	}
+	return lease, nil
+}
@@ -0,0 +1,21 @@
+package billing
+
+import "github.com/magicsong/yunify-k8s/pkg/trace"
+
+type tracedBilling struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given billing service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedBilling{Interface: i, scope: scope}
+}
+
+func (t *tracedBilling) GetLease(resourceID string) (*Lease, error) {
+	span := t.scope.Start("billing.GetLease")
+	span.SetAttribute("resource.id", resourceID)
+	lease, err := t.Interface.GetLease(resourceID)
+	span.Finish(err)
+	return lease, err
+}
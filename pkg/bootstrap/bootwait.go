@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"k8s.io/klog"
+)
+
+const (
+	// BootWaitSSH begins bootstrap once ssh connects, which is all done if no strategy is given
+	BootWaitSSH = "ssh"
+	// BootWaitCloudInit waits for cloud-init to be done, machines without cloud-init are taken as booted
+	BootWaitCloudInit = "cloud-init"
+	// BootWaitFilePrefix waits for a sentinel file, like 'file:/var/run/site-ready' written by the user data of an image
+	BootWaitFilePrefix = "file:"
+	// DefaultBootWaitTimeout is how long a machine may take to signal it is booted
+	DefaultBootWaitTimeout = 10 * time.Minute
+	bootWaitInterval       = 5 * time.Second
+)
+
+// cloudInitDone passes once cloud-init is done or disabled, older cloud-init without 'status' marks boot-finished
+const cloudInitDone = "! command -v cloud-init >/dev/null 2>&1 || cloud-init status 2>/dev/null | grep -Eq 'status: (done|disabled)' || test -f /var/lib/cloud/instance/boot-finished"
+
+// ValidateBootWait makes sure strategy is one of BootWaitSSH, BootWaitCloudInit and BootWaitFilePrefix with an absolute path
+func ValidateBootWait(strategy string) error {
+	_, err := bootWaitCommand(strategy)
+	return err
+}
+
+// bootWaitCommand is what passes on a booted machine, "" if connecting by ssh is enough
+func bootWaitCommand(strategy string) (string, error) {
+	switch {
+	case strategy == "" || strategy == BootWaitSSH:
+		return "", nil
+	case strategy == BootWaitCloudInit:
+		return cloudInitDone, nil
+	case strings.HasPrefix(strategy, BootWaitFilePrefix):
+		path := strings.TrimPrefix(strategy, BootWaitFilePrefix)
+		if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "'\n") {
+			return "", api.NewValidationError("Sentinel file of boot wait %s must be an absolute path without quotes", strategy)
+		}
+		return fmt.Sprintf("test -e '%s'", path), nil
+	}
+	return "", api.NewValidationError("Unknown boot wait %s, available ones: %s, %s, %s<path>", strategy, BootWaitSSH, BootWaitCloudInit, BootWaitFilePrefix)
+}
+
+// waitBoot waits for machine to signal it is booted by the boot wait of opt, so kubeadm does not race with what the
+// image does at boot, like cloud-init installing packages
+func (k *kubeadmBootstrapper) waitBoot(machine *instance.Instance) error {
+	cmd, err := bootWaitCommand(k.opt.BootWait)
+	if err != nil || cmd == "" {
+		return err
+	}
+	timeout := k.opt.BootWaitTimeout
+	if timeout == 0 {
+		timeout = DefaultBootWaitTimeout
+	}
+	klog.V(2).Infof("Waiting for %s to be booted by %s", machine.IP, k.opt.BootWait)
+	err = retry.Until(timeout, bootWaitInterval, func() error {
+		_, err := k.runner.RunAndGetOutput(machine.IP, cmd)
+		return err
+	})
+	if err == nil || ssh.IsUnreachable(err) {
+		return err
+	}
+	return fmt.Errorf("%s %s is not booted by %s in %s", machine.ID, machine.IP, k.opt.BootWait, timeout)
+}
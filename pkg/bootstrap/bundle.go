@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/cni"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+)
+
+const (
+	// RemoteBundleDir is where the bundle is gathered on the builder before it is packed
+	RemoteBundleDir = "/root/qks-bundle"
+	// BundleChecksumsFile lists sha256 of every file in the bundle, in the format of sha256sum
+	BundleChecksumsFile = "SHA256SUMS"
+)
+
+// BundlePackages are what nodes install to run kubeadm, packages missing on the builder are left out
+var BundlePackages = []string{
+	"kubelet", "kubeadm", "kubectl", "kubernetes-cni", "cri-tools",
+	"containerd", "containerd.io", "docker-ce", "docker-ce-cli", "docker.io",
+	"conntrack", "conntrack-tools", "socat", "ebtables", "ethtool",
+}
+
+// BundleManifest is a manifest of a CNI release downloaded into the bundle as Name.yaml
+type BundleManifest struct {
+	Name string
+	URL  string
+	// SHA256 is what the download has to match, it is not checked if empty
+	SHA256 string
+}
+
+// BundleManifests returns releases of CNIs which are downloaded and tested with version, the bundled ones are in images already
+func BundleManifests(version string) []BundleManifest {
+	manifests := make([]BundleManifest, 0)
+	for _, name := range cni.Names() {
+		p, _ := cni.Get(name)
+		for _, r := range p.Releases() {
+			if r.ManifestURL != "" && r.Supports(version) {
+				manifests = append(manifests, BundleManifest{Name: name + "-" + r.Version, URL: r.ManifestURL, SHA256: r.ManifestSHA256})
+			}
+		}
+	}
+	return manifests
+}
+
+// BundleFileName returns the name of the bundle of version and arch
+func BundleFileName(version, arch string) string {
+	if arch == "" {
+		arch = api.ArchAMD64
+	}
+	return fmt.Sprintf("qks-bundle-%s-%s.tar.gz", version, arch)
+}
+
+func (k *kubeadmBootstrapper) BuildBundle(machine *instance.Instance, bundle string) (string, error) {
+	vars := k.scriptVars()
+	vars.BundleDir = RemoteBundleDir
+	vars.BundleFile = bundle
+	vars.BundlePackages = BundlePackages
+	vars.BundleManifests = BundleManifests(k.opt.KubernetesVersion)
+	vars.CNIYamlPath = api.PresetKubernetes[k.opt.KubernetesVersion].CNIYamlPath
+	output, err := k.runScript(machine, BundleScript, vars)
+	if err != nil {
+		lines := RelevantLogLines(log.Redact(string(output)), DiagnoseLines)
+		return "", fmt.Errorf("Failed to build the bundle on %s, err: %s, output: %s", machine.IP, err.Error(), strings.Join(lines, "\n"))
+	}
+	// the last line is printed by sha256sum of the bundle
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) != 2 || fields[1] != bundle || len(fields[0]) != 64 {
+		return "", fmt.Errorf("Failed to read the checksum of bundle %s, output: %s", bundle, lines[len(lines)-1])
+	}
+	return fields[0], nil
+}
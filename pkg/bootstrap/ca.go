@@ -0,0 +1,63 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+const (
+	PKILocation   = "/etc/kubernetes/pki"
+	CAKeyFilePath = PKILocation + "/ca.key"
+	// kubeadm signs certificates valid for a year no matter when the CA expires
+	minCALifetime = time.Hour * 24 * 365
+)
+
+// LoadCA reads a CA certificate and its unencrypted key in PEM, the certificate can be an intermediate of another CA
+func LoadCA(certFile, keyFile string) (cert []byte, key []byte, err error) {
+	if certFile == "" || keyFile == "" {
+		return nil, nil, api.NewValidationError("Both the certificate and the key of CA must be given")
+	}
+	if cert, err = ioutil.ReadFile(certFile); err != nil {
+		return nil, nil, api.NewValidationError("Cannot read CA certificate %s, err: %s", certFile, err.Error())
+	}
+	if key, err = ioutil.ReadFile(keyFile); err != nil {
+		return nil, nil, api.NewValidationError("Cannot read CA key %s, err: %s", keyFile, err.Error())
+	}
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, nil, api.NewValidationError("CA certificate %s does not match key %s, err: %s", certFile, keyFile, err.Error())
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, api.NewValidationError("Cannot parse CA certificate %s, err: %s", certFile, err.Error())
+	}
+	if !ca.IsCA || (ca.KeyUsage != 0 && ca.KeyUsage&x509.KeyUsageCertSign == 0) {
+		return nil, nil, api.NewValidationError("Certificate %s is not allowed to sign certificates", certFile)
+	}
+	if time.Until(ca.NotAfter) < minCALifetime {
+		return nil, nil, api.NewValidationError("CA %s expires at %s, it must be valid for at least a year", certFile, ca.NotAfter.Format(time.RFC3339))
+	}
+	return cert, key, nil
+}
+
+// uploadCA puts the CA where kubeadm init looks for an existing one before generating its own
+func (k *kubeadmBootstrapper) uploadCA(master *instance.Instance) error {
+	cert, key, err := LoadCA(k.opt.CACertFile, k.opt.CAKeyFile)
+	if err != nil {
+		return err
+	}
+	// the key is unreadable by others during the upload
+	if output, err := k.runner.RunAndGetOutput(master.IP, "mkdir -p -m 700 "+PKILocation); err != nil {
+		return fmt.Errorf("Failed to create %s, output: %s", PKILocation, string(output))
+	}
+	if err = k.uploadSecret(master, key, CAKeyFilePath); err != nil {
+		return err
+	}
+	return k.runner.Upload(master.IP, cert, CACertFilePath, 0644)
+}
@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// ValidateChecksums checks checksums of the spec are sha256 in hex of http urls
+func ValidateChecksums(checksums map[string]string) error {
+	for url, sum := range checksums {
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return api.NewValidationError("Checksum is declared for %s, which is not an http url", url)
+		}
+		if !sha256Regexp.MatchString(sum) {
+			return api.NewValidationError("Checksum %s of %s is not a sha256 in hex", sum, url)
+		}
+	}
+	return nil
+}
+
+// ChecksumOf returns the sha256 url has to match, the one in checksums of opt wins over declared by qks.
+// It fails if there is none but opt requires checksums.
+func ChecksumOf(opt *api.CreateClusterOption, url, declared string) (string, error) {
+	if sum, ok := opt.Checksums[url]; ok {
+		return strings.ToLower(sum), nil
+	}
+	if declared == "" && opt.RequireChecksums {
+		return "", api.NewValidationError("No sha256 of %s is declared in checksums, downloads without one are refused", url)
+	}
+	return declared, nil
+}
+
+// HelmURL returns where helm of version for linux on arch is downloaded from
+func HelmURL(version, arch string) string {
+	return fmt.Sprintf("https://get.helm.sh/helm-%s-linux-%s.tar.gz", version, arch)
+}
+
+// HelmChecksums returns lines of sha256sum for helm of every arch with a declared sha256,
+// it fails if there is none but opt requires checksums
+func HelmChecksums(opt *api.CreateClusterOption) ([]string, error) {
+	lines := make([]string, 0)
+	for _, arch := range []string{api.ArchAMD64, api.ArchARM64} {
+		if sum, ok := opt.Checksums[HelmURL(HelmVersion, arch)]; ok {
+			lines = append(lines, fmt.Sprintf("%s  /tmp/helm-%s.tar.gz", strings.ToLower(sum), arch))
+		}
+	}
+	if len(lines) == 0 && opt.RequireChecksums {
+		return nil, api.NewValidationError("No sha256 of %s is declared in checksums, downloads without one are refused", HelmURL(HelmVersion, "<arch>"))
+	}
+	return lines, nil
+}
+
+func (k *kubeadmBootstrapper) ApplyURL(master *instance.Instance, url string) error {
+	sum, err := ChecksumOf(k.opt, url, "")
+	if err != nil {
+		return err
+	}
+	if sum == "" {
+		if output, err := k.Kubectl(master, "apply -f "+url); err != nil {
+			return fmt.Errorf("Failed to apply %s, output: %s", url, string(output))
+		}
+		return nil
+	}
+	remote := RemoteManifestsLocation + "downloaded-" + sum[:12] + ".yaml"
+	cmd := fmt.Sprintf("mkdir -p %s && curl -fsSL %s -o %s && echo \"%s  %s\" | sha256sum -c --quiet - && kubectl --kubeconfig=%s apply -f %s",
+		RemoteManifestsLocation, url, remote, sum, remote, KubeconfigFilePath, remote)
+	if output, err := k.runner.RunAndGetOutput(master.IP, cmd); err != nil {
+		return fmt.Errorf("Failed to apply %s verified by sha256 %s, output: %s", url, sum, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package bootstrap
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/kube"
+	"k8s.io/klog"
+)
+
+// apiClient returns a client using admin.conf of master, or nil if manifests have to be applied by kubectl on master.
+// Server-side apply is on by default since 1.16, and the apiserver is often only reachable inside the vxnet.
+func (k *kubeadmBootstrapper) apiClient(master *instance.Instance) *kube.Client {
+	if k.clientChecked {
+		return k.client
+	}
+	k.clientChecked = true
+	kubeconfig, err := k.FetchKubeconfig(master)
+	if err != nil || len(kubeconfig) == 0 {
+		return nil
+	}
+	client, err := kube.NewClient(kubeconfig)
+	if err != nil {
+		klog.V(1).Infof("Applying manifests by kubectl on master, err: %s", err.Error())
+		return nil
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		klog.V(1).Infof("Applying manifests by kubectl on master as the apiserver is not reachable, err: %s", err.Error())
+		return nil
+	}
+	if kubeadm, err := KubeadmFor(version); err != nil || !kubeadm.ServerSideApply {
+		klog.V(1).Infof("Applying manifests by kubectl on master as apiserver %s has no server-side apply", version)
+		return nil
+	}
+	k.client = client
+	return client
+}
@@ -0,0 +1,149 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"gopkg.in/yaml.v2"
+)
+
+// KubeadmConfigFilePath is where the generated config of kubeadm init is uploaded to on master
+const KubeadmConfigFilePath = RemoteScriptsLocation + "kubeadm.yaml"
+
+const (
+	// defaults of etcd, used to check a timeout or an interval given alone
+	etcdDefaultHeartbeatInterval = 100
+	etcdDefaultElectionTimeout   = 1000
+	// etcdMaxQuotaBackendBytes is the largest quota suggested by etcd
+	etcdMaxQuotaBackendBytes = 8 << 30
+)
+
+type bootstrapToken struct {
+	TTL string `yaml:"ttl"`
+}
+
+type nodeRegistration struct {
+	CRISocket string `yaml:"criSocket,omitempty"`
+}
+
+type initConfiguration struct {
+	APIVersion       string           `yaml:"apiVersion"`
+	Kind             string           `yaml:"kind"`
+	BootstrapTokens  []bootstrapToken `yaml:"bootstrapTokens,omitempty"`
+	NodeRegistration nodeRegistration `yaml:"nodeRegistration,omitempty"`
+}
+
+type clusterConfiguration struct {
+	APIVersion           string `yaml:"apiVersion"`
+	Kind                 string `yaml:"kind"`
+	KubernetesVersion    string `yaml:"kubernetesVersion"`
+	ControlPlaneEndpoint string `yaml:"controlPlaneEndpoint,omitempty"`
+	Networking           struct {
+		PodSubnet string `yaml:"podSubnet"`
+	} `yaml:"networking"`
+	APIServer struct {
+		CertSANs []string `yaml:"certSANs,omitempty"`
+	} `yaml:"apiServer,omitempty"`
+	Etcd struct {
+		Local struct {
+			ExtraArgs map[string]string `yaml:"extraArgs,omitempty"`
+		} `yaml:"local"`
+	} `yaml:"etcd"`
+}
+
+// ValidateEtcdOption checks the values are usable by etcd, not only positive
+func ValidateEtcdOption(opt api.EtcdOption) error {
+	if opt.QuotaBackendBytes < 0 || opt.HeartbeatInterval < 0 || opt.ElectionTimeout < 0 || opt.SnapshotCount < 0 {
+		return api.NewValidationError("Options of etcd cannot be negative")
+	}
+	if opt.QuotaBackendBytes > etcdMaxQuotaBackendBytes {
+		return api.NewValidationError("Quota of etcd backend cannot exceed %d bytes, got %d", etcdMaxQuotaBackendBytes, opt.QuotaBackendBytes)
+	}
+	heartbeat, election := opt.HeartbeatInterval, opt.ElectionTimeout
+	if heartbeat == 0 {
+		heartbeat = etcdDefaultHeartbeatInterval
+	}
+	if election == 0 {
+		election = etcdDefaultElectionTimeout
+	}
+	// etcd suggests a timeout of at least 5 heartbeats, or leaders are lost on a single slow heartbeat
+	if election < 5*heartbeat {
+		return api.NewValidationError("Election timeout %dms of etcd must be at least 5 times the heartbeat interval %dms", election, heartbeat)
+	}
+	return nil
+}
+
+func etcdExtraArgs(opt api.EtcdOption) map[string]string {
+	args := make(map[string]string)
+	if opt.QuotaBackendBytes > 0 {
+		args["quota-backend-bytes"] = strconv.FormatInt(opt.QuotaBackendBytes, 10)
+	}
+	if opt.HeartbeatInterval > 0 {
+		args["heartbeat-interval"] = strconv.Itoa(opt.HeartbeatInterval)
+	}
+	if opt.ElectionTimeout > 0 {
+		args["election-timeout"] = strconv.Itoa(opt.ElectionTimeout)
+	}
+	if opt.SnapshotCount > 0 {
+		args["snapshot-count"] = strconv.Itoa(opt.SnapshotCount)
+	}
+	return args
+}
+
+// GenerateKubeadmConfig returns the config of kubeadm init for what flags cannot set, like args of etcd.
+// kubeadm refuses most flags together with --config, so token ttl and control plane endpoint move into it as well.
+func GenerateKubeadmConfig(opt *api.CreateClusterOption) ([]byte, error) {
+	if _, err := GenerateKubeadmInitCmd(opt.NetworkOption, opt.KubernetesVersion); err != nil {
+		return nil, err
+	}
+	if err := ValidateEtcdOption(opt.Etcd); err != nil {
+		return nil, err
+	}
+	kubeadm, err := KubeadmFor(opt.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	apiVersion := kubeadm.ConfigAPIVersion
+	initConfig := initConfiguration{APIVersion: apiVersion, Kind: "InitConfiguration"}
+	if opt.TokenTTL != "" {
+		initConfig.BootstrapTokens = []bootstrapToken{{TTL: opt.TokenTTL}}
+	}
+	initConfig.NodeRegistration.CRISocket = CRISocket(opt.KubernetesVersion)
+	clusterConfig := clusterConfiguration{
+		APIVersion:        apiVersion,
+		Kind:              "ClusterConfiguration",
+		KubernetesVersion: "v" + opt.KubernetesVersion,
+	}
+	clusterConfig.Networking.PodSubnet = opt.PodNetWorkCIDR
+	if opt.ControlPlaneEndpoint != "" {
+		if _, err := ControlPlaneEndpointFlags(opt.KubernetesVersion, opt.ControlPlaneEndpoint); err != nil {
+			return nil, err
+		}
+		clusterConfig.ControlPlaneEndpoint = opt.ControlPlaneEndpoint
+	}
+	clusterConfig.APIServer.CertSANs = CertSANs(opt)
+	clusterConfig.Etcd.Local.ExtraArgs = etcdExtraArgs(opt.Etcd)
+	initYaml, err := yaml.Marshal(&initConfig)
+	if err != nil {
+		return nil, err
+	}
+	clusterYaml, err := yaml.Marshal(&clusterConfig)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s---\n%s", initYaml, clusterYaml)), nil
+}
+
+// uploadKubeadmConfig returns the kubeadm init command using the uploaded config
+func (k *kubeadmBootstrapper) uploadKubeadmConfig(master *instance.Instance) (string, error) {
+	config, err := GenerateKubeadmConfig(k.opt)
+	if err != nil {
+		return "", err
+	}
+	if err = k.runner.Upload(master.IP, config, KubeadmConfigFilePath, 0600); err != nil {
+		return "", fmt.Errorf("Failed to upload config of kubeadm, err: %s", err.Error())
+	}
+	return "kubeadm init --config=" + KubeadmConfigFilePath, nil
+}
@@ -0,0 +1,119 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// APIServerPort is where apiserver listens on master, and the port of endpoints without one
+const APIServerPort = "6443"
+
+// dnsNameRegexp matches dns names of labels, a leading wildcard label is allowed as x509 does
+var dnsNameRegexp = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9]([-a-zA-Z0-9]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([-a-zA-Z0-9]{0,61}[a-zA-Z0-9])?$`)
+
+// ControlPlaneEndpointFlags returns flags of kubeadm init making endpoint the address of apiserver,
+// the host of endpoint is put into cert SANs by CertSANsFlag
+func ControlPlaneEndpointFlags(version, endpoint string) (string, error) {
+	kubeadm, err := KubeadmFor(version)
+	if err != nil {
+		return "", err
+	}
+	if !kubeadm.ControlPlaneEndpoint {
+		return "", api.NewValidationError("Control plane endpoint needs kubeadm 1.16 or later, but the cluster is %s", version)
+	}
+	host := EndpointHost(endpoint)
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return "", api.NewValidationError("Invalid control plane endpoint %s", endpoint)
+	}
+	return "--control-plane-endpoint=" + endpoint, nil
+}
+
+// ValidateCertSANs checks every SAN is an ip or a dns name, which is all kubeadm puts into certificates
+func ValidateCertSANs(sans []string) error {
+	for _, san := range sans {
+		if net.ParseIP(san) != nil {
+			continue
+		}
+		if !dnsNameRegexp.MatchString(san) || len(san) > 253 {
+			return api.NewValidationError("Cert SAN %s is neither an ip nor a dns name", san)
+		}
+	}
+	return nil
+}
+
+// CertSANs returns extra SANs of the apiserver certificate, the host of control plane endpoint goes first
+func CertSANs(opt *api.CreateClusterOption) []string {
+	sans := make([]string, 0, len(opt.APIServerCertSANs)+1)
+	seen := make(map[string]bool)
+	candidates := opt.APIServerCertSANs
+	if opt.ControlPlaneEndpoint != "" {
+		candidates = append([]string{EndpointHost(opt.ControlPlaneEndpoint)}, candidates...)
+	}
+	for _, san := range candidates {
+		if !seen[san] {
+			seen[san] = true
+			sans = append(sans, san)
+		}
+	}
+	return sans
+}
+
+// CertSANsFlag returns the flag of kubeadm init adding sans to the apiserver certificate, empty if there is none
+func CertSANsFlag(sans []string) string {
+	if len(sans) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--apiserver-cert-extra-sans=%s", strings.Join(sans, ","))
+}
+
+// EndpointHost strips the port of endpoint
+func EndpointHost(endpoint string) string {
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		return host
+	}
+	return endpoint
+}
+
+// Endpoint is where machines and users reach the apiserver of a cluster
+type Endpoint struct {
+	Host string
+	Port string
+	// PinnedIP resolves Host in /etc/hosts of machines, it is empty if Host is an ip or resolves by itself
+	PinnedIP string
+}
+
+// Address returns host:port of e
+func (e *Endpoint) Address() string {
+	return net.JoinHostPort(e.Host, e.Port)
+}
+
+// ControlPlaneEndpointOf returns the endpoint of the cluster of opt with master, which is master itself if opt has none.
+// A dns name is pinned to master unless opt tells it resolves by itself, like a record of an internal load balancer.
+func ControlPlaneEndpointOf(opt *api.CreateClusterOption, master *instance.Instance) *Endpoint {
+	if opt.ControlPlaneEndpoint == "" {
+		return &Endpoint{Host: master.IP, Port: APIServerPort}
+	}
+	e := &Endpoint{Host: opt.ControlPlaneEndpoint, Port: APIServerPort}
+	if host, port, err := net.SplitHostPort(opt.ControlPlaneEndpoint); err == nil {
+		e.Host, e.Port = host, port
+	}
+	if net.ParseIP(e.Host) == nil && !opt.ControlPlaneEndpointResolvable {
+		e.PinnedIP = master.IP
+	}
+	return e
+}
+
+// JoinCommandTo makes join reach apiserver at e instead of the address kubeadm printed it with
+func JoinCommandTo(join string, e *Endpoint) string {
+	fields := strings.Fields(join)
+	if len(fields) < 3 || fields[0] != "kubeadm" || fields[1] != "join" || strings.HasPrefix(fields[2], "-") {
+		return join
+	}
+	fields[2] = e.Address()
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,74 @@
+package bootstrap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"k8s.io/klog"
+)
+
+const (
+	// ControlPlaneWaitTimeout is how long the static pods of master have to become ready after kubeadm init
+	ControlPlaneWaitTimeout  = time.Minute * 5
+	controlPlaneWaitInterval = time.Second * 5
+	// DiagnoseLines is the number of log lines of master put into the error of a failed bootstrap
+	DiagnoseLines = 50
+)
+
+var controlPlaneComponents = []string{"etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+
+// relevantLogLine matches what kubelet and container runtimes log when pods cannot start
+var relevantLogLine = regexp.MustCompile(`(?i)error|fail|timeout|timed out|refused|back-off|unhealthy|\bE\d{4} `)
+
+// RelevantLogLines returns the last n lines of output looking like errors, or the last n lines if none does
+func RelevantLogLines(output string, n int) []string {
+	var all, relevant []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		all = append(all, line)
+		if relevantLogLine.MatchString(line) {
+			relevant = append(relevant, line)
+		}
+	}
+	if len(relevant) == 0 {
+		relevant = all
+	}
+	if len(relevant) > n {
+		relevant = relevant[len(relevant)-n:]
+	}
+	return relevant
+}
+
+// waitControlPlane waits for /healthz of apiserver and all static pods of master to be ready
+func (k *kubeadmBootstrapper) waitControlPlane(master *instance.Instance) error {
+	vars := k.scriptVars()
+	vars.ControlPlaneComponents = controlPlaneComponents
+	var output []byte
+	err := retry.Until(ControlPlaneWaitTimeout, controlPlaneWaitInterval, func() error {
+		var err error
+		output, err = k.runScript(master, HealthScript, vars)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Control plane is not ready in %s, %s", ControlPlaneWaitTimeout, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// diagnose wraps err of bootstrapping master with the last relevant lines of kubelet and container runtime logs
+func (k *kubeadmBootstrapper) diagnose(master *instance.Instance, err error) error {
+	output, diagErr := k.runScript(master, DiagnoseScript, k.scriptVars())
+	if diagErr != nil || len(output) == 0 {
+		klog.Warningf("Failed to collect logs of kubelet on %s", master.IP)
+		return err
+	}
+	lines := RelevantLogLines(log.Redact(string(output)), DiagnoseLines)
+	return fmt.Errorf("%s\nLast logs of kubelet and container runtime on %s:\n%s", err.Error(), master.IP, strings.Join(lines, "\n"))
+}
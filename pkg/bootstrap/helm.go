@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// HelmVersion is installed on master if it has no helm
+const HelmVersion = "v3.3.4"
+
+// HelmRelease is a chart installed or upgraded by InstallHelmRelease
+type HelmRelease struct {
+	Name      string
+	Namespace string
+	// Repo is the local name of RepoURL
+	Repo    string
+	RepoURL string
+	Chart   string
+	Version string
+	Values  []byte
+}
+
+func (k *kubeadmBootstrapper) InstallHelmRelease(master *instance.Instance, r *HelmRelease) error {
+	values := RemoteManifestsLocation + r.Name + "-values.yaml"
+	// values may hold passwords of the addon
+	if err := k.uploadSecret(master, r.Values, values); err != nil {
+		return err
+	}
+	vars := k.scriptVars()
+	vars.HelmVersion = HelmVersion
+	checksums, err := HelmChecksums(k.opt)
+	if err != nil {
+		return err
+	}
+	vars.HelmChecksums = checksums
+	vars.HelmCommands = []string{
+		fmt.Sprintf("repo add %s %s", r.Repo, r.RepoURL),
+		"repo update",
+		fmt.Sprintf("upgrade --install %s %s/%s --version %s -n %s --create-namespace -f %s --wait --timeout 10m",
+			r.Name, r.Repo, r.Chart, r.Version, r.Namespace, values),
+	}
+	output, err := k.runScript(master, HelmScript, vars)
+	if err != nil {
+		return fmt.Errorf("Failed to install chart %s, err: %s, output: %s", r.Chart, err.Error(), string(output))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) UninstallHelmRelease(master *instance.Instance, name, namespace string) error {
+	vars := k.scriptVars()
+	vars.HelmVersion = HelmVersion
+	checksums, err := HelmChecksums(k.opt)
+	if err != nil {
+		return err
+	}
+	vars.HelmChecksums = checksums
+	vars.HelmCommands = []string{fmt.Sprintf("uninstall %s -n %s", name, namespace)}
+	output, err := k.runScript(master, HelmScript, vars)
+	if err != nil {
+		return fmt.Errorf("Failed to uninstall release %s, err: %s, output: %s", name, err.Error(), string(output))
+	}
+	// the values may hold passwords
+	if output, err = k.runner.RunAndGetOutput(master.IP, "rm -f "+RemoteManifestsLocation+name+"-values.yaml"); err != nil {
+		return fmt.Errorf("Failed to remove values of release %s, output: %s", name, string(output))
+	}
+	return nil
+}
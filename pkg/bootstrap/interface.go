@@ -0,0 +1,81 @@
+package bootstrap
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+)
+
+const (
+	ScriptsLocation    = "/root/scripts/"
+	KubeconfigFilePath = "/etc/kubernetes/admin.conf"
+	CACertFilePath     = "/etc/kubernetes/pki/ca.crt"
+)
+
+// Interface brings up kubernetes on machines which are already running
+type Interface interface {
+	// MountEtcdVolume formats device if it is empty and mounts it at EtcdDataDir on master, before InitMaster
+	MountEtcdVolume(master *instance.Instance, device string) error
+	// InitMaster runs kubeadm init on master and returns the join command
+	InitMaster(master *instance.Instance) (string, error)
+	ApplyCNI(master *instance.Instance) error
+	JoinNodes(joinCmd string, nodes []*instance.Instance) error
+	// JoinWindowsNodes joins windows nodes by runner after linux ones, it is experimental
+	JoinWindowsNodes(master *instance.Instance, runner ssh.Runner, joinCmd string, nodes []*instance.Instance) error
+	// VerifyNodes checks every machine is registered as a node, it returns an *UnregisteredError of those which are not
+	VerifyNodes(master *instance.Instance, machines []*instance.Instance) error
+	// LabelNodes labels nodes of machines with the zone, instance type and id of their instance
+	LabelNodes(master *instance.Instance, machines []*instance.Instance) error
+	// NodeStatuses lists nodes of the cluster with their conditions
+	NodeStatuses(master *instance.Instance) ([]NodeStatus, error)
+	// CheckNetwork checks pods reach each other across nodes, services and DNS once nodes have joined
+	CheckNetwork(master *instance.Instance) error
+	// DrainNode cordons the node named name and evicts its pods
+	DrainNode(master *instance.Instance, name string) error
+	// ResetNode undoes kubeadm join on machine and removes what CNI left, so it can join again
+	ResetNode(machine *instance.Instance) error
+	// PatchOS applies updates of OS packages on machine, reboots it and waits until it is up again
+	PatchOS(machine *instance.Instance) error
+	// BuildBundle packs images, packages and CNI manifests of the image of machine into the file bundle on it and returns its sha256
+	BuildBundle(machine *instance.Instance, bundle string) (string, error)
+	// SetProviderIDs sets spec.providerID of nodes on machines to ProviderIDPrefix and their instance ids
+	SetProviderIDs(master *instance.Instance, machines []*instance.Instance) error
+	// PrePullImages pulls images of the option on machines in parallel, so workloads do not wait for the registry later
+	PrePullImages(machines []*instance.Instance) error
+	// ConfigureRegistries creates imagePullSecrets of the option, and gives credentials to kubelet of machines if asked
+	ConfigureRegistries(master *instance.Instance, nodes []*instance.Instance) error
+	// ApplyManifest applies manifest on master, name tells manifests apart in logs and on the machine
+	ApplyManifest(master *instance.Instance, name string, manifest []byte) error
+	// ApplyURL applies the manifest of url on master, it is downloaded and verified first if a checksum is declared for it
+	ApplyURL(master *instance.Instance, url string) error
+	// DeleteManifest deletes what ApplyManifest applied with name, nothing is done if it was never applied
+	DeleteManifest(master *instance.Instance, name string) error
+	// Kubectl runs kubectl with the admin kubeconfig on master
+	Kubectl(master *instance.Instance, args string) ([]byte, error)
+	// InstallHelmRelease installs or upgrades a chart on master, helm is installed if missing
+	InstallHelmRelease(master *instance.Instance, r *HelmRelease) error
+	// UninstallHelmRelease uninstalls the release of name in namespace on master
+	UninstallHelmRelease(master *instance.Instance, name, namespace string) error
+	// FetchKubeconfig returns the admin kubeconfig of cluster
+	FetchKubeconfig(master *instance.Instance) ([]byte, error)
+	// CreateJoinCommands creates a new token on master and returns how to join workers and control planes
+	CreateJoinCommands(master *instance.Instance, ttl string) (*JoinCommands, error)
+	// DeleteToken deletes the bootstrap token in joinCmd
+	DeleteToken(master *instance.Instance, joinCmd string) error
+	// CACertHash returns the hash used by --discovery-token-ca-cert-hash
+	CACertHash(master *instance.Instance) (string, error)
+	// Discover reads how a running cluster is set up, fields which cannot be found are left empty
+	Discover(master *instance.Instance) (*ClusterInfo, error)
+}
+
+// ClusterInfo is what can be found on the master of a running cluster
+type ClusterInfo struct {
+	KubernetesVersion string
+	CNIName           string
+	PodNetworkCIDR    string
+}
+
+type JoinCommands struct {
+	Worker string
+	// ControlPlane is empty if the kubeadm on master cannot upload certificates
+	ControlPlane string
+}
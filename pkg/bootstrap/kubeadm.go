@@ -0,0 +1,572 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/cni"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/kube"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"k8s.io/klog"
+)
+
+const DefaultJoinRetryInterval = time.Second * 10
+
+// DefaultInitRetryInterval is short as resetting master already takes a while
+const DefaultInitRetryInterval = time.Second * 5
+
+const (
+	// MasterNodeWaitTimeout is how long kubelet of master has to register the node before CNI is applied
+	MasterNodeWaitTimeout  = time.Minute * 3
+	masterNodeWaitInterval = time.Second * 5
+	// CNIApplyRetries and DefaultCNIRetryInterval cover apiserver hiccups right after init, applying CNI again is harmless
+	CNIApplyRetries         = 3
+	DefaultCNIRetryInterval = time.Second * 10
+)
+
+// cleanCNICommand removes what CNI left on a host after kubeadm reset
+const cleanCNICommand = "rm -rf /etc/cni/net.d /var/lib/cni && " +
+	"for link in cni0 flannel.1; do ip link delete $link 2>/dev/null || true; done"
+
+// CRISocketContainerd is given to kubeadm on images running containerd, it cannot guess if docker is installed as well
+const CRISocketContainerd = "unix:///run/containerd/containerd.sock"
+
+// CRISocket returns the cri socket kubeadm of version has to use, empty if kubeadm finds it by itself
+func CRISocket(version string) string {
+	if api.PresetKubernetes[version].ContainerRuntime == api.ContainerRuntimeContainerd {
+		return CRISocketContainerd
+	}
+	return ""
+}
+
+func (k *kubeadmBootstrapper) withCRISocket(cmd string) string {
+	if socket := CRISocket(k.opt.KubernetesVersion); socket != "" && !strings.Contains(cmd, "--cri-socket") {
+		return cmd + " --cri-socket=" + socket
+	}
+	return cmd
+}
+
+// RemoteManifestsLocation is where manifests applied by ApplyManifest are kept on master
+const RemoteManifestsLocation = RemoteScriptsLocation + "manifests/"
+
+// JoinError lists nodes which still fail to join after all retries, the cluster itself is usable
+type JoinError struct {
+	Failed []*instance.Instance
+	Errs   []error
+}
+
+func (j *JoinError) Error() string {
+	ips := make([]string, 0, len(j.Failed))
+	for _, n := range j.Failed {
+		ips = append(ips, n.IP)
+	}
+	return fmt.Sprintf("Joining nodes [%s] failed, errs: %+v", strings.Join(ips, ","), j.Errs)
+}
+
+type kubeadmBootstrapper struct {
+	runner ssh.Runner
+	opt    *api.CreateClusterOption
+	// endpoint of apiserver is known after InitMaster
+	endpoint *Endpoint
+	// client applies manifests if the apiserver is reachable from here, it is looked up once
+	client        *kube.Client
+	clientChecked bool
+}
+
+var _ Interface = &kubeadmBootstrapper{}
+
+// NewKubeadmBootstrapper bootstraps the cluster described by opt with kubeadm over ssh
+func NewKubeadmBootstrapper(runner ssh.Runner, opt *api.CreateClusterOption) Interface {
+	return &kubeadmBootstrapper{
+		runner: runner,
+		opt:    opt,
+	}
+}
+
+func GenerateKubeadmInitCmd(opt api.NetworkOption, version string) (string, error) {
+	if opt.PodNetWorkCIDR == "" {
+		return "", api.NewValidationError("Must specify a network for pod")
+	}
+
+	if _, err := KubeadmFor(version); err != nil {
+		return "", err
+	}
+	provider, err := cni.Get(opt.CNIName)
+	if err != nil {
+		return "", err
+	}
+	args := append(provider.KubeadmArgs(opt), "--kubernetes-version=v"+version)
+	return "kubeadm init " + strings.Join(args, " "), nil
+}
+
+func GetKubeJoinFromOutput(output string) string {
+	output = strings.TrimSpace(output)
+	index := strings.LastIndex(output, "kubeadm join")
+	if index == -1 {
+		return ""
+	}
+	output = output[index:]
+	if i := strings.Index(output, "\\"); i != -1 {
+		// new line exists
+		l := strings.Index(output, "--discovery-token-ca-cert-hash")
+		if l == -1 {
+			return ""
+		}
+		return output[:i] + output[l:]
+	}
+	return output
+}
+
+func appendFlags(cmd string, flags []string) string {
+	if len(flags) == 0 {
+		return cmd
+	}
+	return cmd + " " + strings.Join(flags, " ")
+}
+
+// GetTokenFromJoin returns the value of --token in a join command
+func GetTokenFromJoin(join string) string {
+	fields := strings.Fields(join)
+	for i, f := range fields {
+		if f == "--token" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+		if strings.HasPrefix(f, "--token=") {
+			return strings.TrimPrefix(f, "--token=")
+		}
+	}
+	return ""
+}
+
+// CACertHash computes the hash of the public key of a PEM encoded CA certificate, in the form used by kubeadm
+func CACertHash(caPEM []byte) (string, error) {
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		return "", fmt.Errorf("Cannot find a PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (k *kubeadmBootstrapper) scriptVars() *ScriptVars {
+	preset := api.PresetKubernetes[k.opt.KubernetesVersion]
+	system, err := OSFor(k.opt.KubernetesVersion)
+	if err != nil {
+		klog.Warningf("Scripts are rendered for the default OS, err: %s", err.Error())
+		system = &debian
+	}
+	vars := &ScriptVars{
+		ClusterName:       k.opt.ClusterName,
+		KubernetesVersion: k.opt.KubernetesVersion,
+		PodNetworkCIDR:    k.opt.PodNetWorkCIDR,
+		CNIName:           k.opt.CNIName,
+		CNIMode:           k.opt.Mode,
+		CNICmd:            preset.CNICmd,
+		ScriptsLocation:   ScriptsLocation,
+		KubeconfigPath:    KubeconfigFilePath,
+		OS:                *system,
+	}
+	if k.opt.UserData != "" {
+		vars.UserDataPath = RemoteUserDataPath
+	}
+	if k.endpoint != nil && k.endpoint.PinnedIP != "" {
+		vars.ControlPlaneHost = k.endpoint.Host
+		vars.MasterIP = k.endpoint.PinnedIP
+	}
+	return vars
+}
+
+func (k *kubeadmBootstrapper) InitMaster(master *instance.Instance) (string, error) {
+	cmd, err := GenerateKubeadmInitCmd(k.opt.NetworkOption, k.opt.KubernetesVersion)
+	if err != nil {
+		return "", err
+	}
+	// nothing is uploaded before the machine is booted, like patches of static pods
+	if err = k.waitBoot(master); err != nil {
+		return "", err
+	}
+	if !k.opt.Etcd.IsEmpty() {
+		// args of etcd can only be given by a config file
+		if cmd, err = k.uploadKubeadmConfig(master); err != nil {
+			return "", err
+		}
+	} else {
+		cmd = k.withCRISocket(cmd)
+		if k.opt.TokenTTL != "" {
+			cmd += " --token-ttl=" + k.opt.TokenTTL
+		}
+		if k.opt.ControlPlaneEndpoint != "" {
+			flags, err := ControlPlaneEndpointFlags(k.opt.KubernetesVersion, k.opt.ControlPlaneEndpoint)
+			if err != nil {
+				return "", err
+			}
+			cmd += " " + flags
+		}
+		if flag := CertSANsFlag(CertSANs(k.opt)); flag != "" {
+			cmd += " " + flag
+		}
+	}
+	k.endpoint = ControlPlaneEndpointOf(k.opt, master)
+	if k.opt.ControlPlanePatchesDir != "" {
+		flag, err := k.uploadPatches(master)
+		if err != nil {
+			return "", err
+		}
+		cmd += " " + flag
+	}
+	cmd = appendFlags(cmd, k.opt.KubeadmInitExtraFlags)
+	vars := k.scriptVars()
+	vars.InitCommand = cmd
+	attempt := 0
+	var join string
+	var lastErr error
+	err = retry.Do(k.opt.InitRetries+1, DefaultInitRetryInterval, func() error {
+		if attempt > 0 {
+			klog.Warningf("Retry kubeadm init on %s, attempt %d, last err: %s", master.IP, attempt+1, lastErr.Error())
+			if output, err := k.runner.RunAndGetOutput(master.IP, k.withCRISocket("kubeadm reset -f")+" && "+cleanCNICommand); err != nil {
+				klog.Warningf("Failed to reset %s, output: %s", master.IP, string(output))
+			}
+		}
+		attempt++
+		join, lastErr = k.initOnce(master, vars)
+		return lastErr
+	})
+	if err != nil {
+		return "", k.diagnose(master, lastErr)
+	}
+	return join, nil
+}
+
+// initOnce runs kubeadm init on a clean master, files in pki are uploaded every time as kubeadm reset deletes them
+func (k *kubeadmBootstrapper) initOnce(master *instance.Instance, vars *ScriptVars) (string, error) {
+	if k.opt.CACertFile != "" {
+		if err := k.uploadCA(master); err != nil {
+			return "", err
+		}
+	}
+	if err := k.uploadUserData(master); err != nil {
+		return "", err
+	}
+	output, err := k.runScript(master, InitScript, vars)
+	defer klog.V(1).Infoln(string(output))
+	if err != nil {
+		klog.Errorln("Failed to run 'kubeadm init'")
+		return "", fmt.Errorf("Failed to run 'kubeadm init', err: %s", err.Error())
+	}
+	klog.Info("Waiting for control plane to be ready")
+	if err = k.waitControlPlane(master); err != nil {
+		return "", err
+	}
+	klog.Info("Getting 'kubeadm join'")
+	join := GetKubeJoinFromOutput(string(output))
+	if join == "" {
+		return "", fmt.Errorf("Cannot find 'kubeadm join' in output of 'kubeadm init'")
+	}
+	return JoinCommandTo(join, k.endpoint), nil
+}
+
+func (k *kubeadmBootstrapper) MountEtcdVolume(master *instance.Instance, device string) error {
+	vars := k.scriptVars()
+	vars.EtcdDevice = device
+	vars.EtcdDataDir = EtcdDataDir
+	output, err := k.runScript(master, EtcdScript, vars)
+	if err != nil {
+		return fmt.Errorf("Failed to mount %s at %s, err: %s, output: %s", device, EtcdDataDir, err.Error(), string(output))
+	}
+	return nil
+}
+
+// ApplyCNI waits for master to register itself first, slow instances are still starting kubelet when init returns
+// cniRelease returns the CNI of the option and its release, which is nil if images of the version are unknown
+func (k *kubeadmBootstrapper) cniRelease() (cni.Provider, *cni.Release, error) {
+	provider, err := cni.Get(k.opt.CNIName)
+	if err != nil {
+		return nil, nil, err
+	}
+	release, err := cni.ReleaseFor(provider, k.opt.KubernetesVersion, k.opt.CNIVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider, release, nil
+}
+
+func (k *kubeadmBootstrapper) ApplyCNI(master *instance.Instance) error {
+	vars := k.scriptVars()
+	provider, release, err := k.cniRelease()
+	if err != nil {
+		return err
+	}
+	if release != nil {
+		klog.Infof("Applying %s %s", provider.Name(), release.Version)
+		vars.CNIDaemonSets = release.DaemonSets
+		if release.BundledIn == "" {
+			vars.CNIManifestURL = release.ManifestURL
+			vars.CNIFilter = provider.PodCIDRFilter(k.opt.PodNetWorkCIDR)
+			if vars.CNIManifestSHA256, err = ChecksumOf(k.opt, release.ManifestURL, release.ManifestSHA256); err != nil {
+				return err
+			}
+		}
+	}
+	var output []byte
+	err = retry.Until(MasterNodeWaitTimeout, masterNodeWaitInterval, func() error {
+		var err error
+		output, err = k.runScript(master, MasterNodeScript, vars)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Node of master is not registered in %s, output: %s", MasterNodeWaitTimeout, strings.TrimSpace(string(output)))
+	}
+	var lastErr error
+	err = retry.Do(CNIApplyRetries+1, DefaultCNIRetryInterval, func() error {
+		output, lastErr = k.runScript(master, CNIScript, vars)
+		klog.V(1).Infoln(string(output))
+		if lastErr != nil {
+			klog.Warningf("Failed to apply CNI on %s, err: %s", master.IP, lastErr.Error())
+		}
+		return lastErr
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to apply CNI, err: %s, output: %s", lastErr.Error(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) JoinNodes(cmd string, nodes []*instance.Instance) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	joinErr := &JoinError{}
+	vars := k.scriptVars()
+	vars.JoinCommand = appendFlags(k.withCRISocket(cmd), k.opt.KubeadmJoinExtraFlags)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(n *instance.Instance) {
+			defer wg.Done()
+			err := k.joinNode(n, vars)
+			if err != nil {
+				klog.Errorf("Failed to join %s %s to cluster", n.ID, n.IP)
+				mu.Lock()
+				joinErr.Failed = append(joinErr.Failed, n)
+				joinErr.Errs = append(joinErr.Errs, err)
+				mu.Unlock()
+			} else {
+				klog.Infof("%s has successfully joined the cluster", n.IP)
+			}
+		}(node)
+	}
+	wg.Wait()
+	if len(joinErr.Failed) != 0 {
+		return joinErr
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) PrePullImages(machines []*instance.Instance) error {
+	if len(k.opt.PrePullImages) == 0 {
+		return nil
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := make([]string, 0)
+	vars := k.scriptVars()
+	vars.Images = k.opt.PrePullImages
+	for _, machine := range machines {
+		wg.Add(1)
+		go func(m *instance.Instance) {
+			defer wg.Done()
+			output, err := k.runScript(m, PullScript, vars)
+			if err != nil {
+				klog.Warningf("Failed to pull images on %s, output: %s", m.IP, string(output))
+				mu.Lock()
+				failed = append(failed, m.IP)
+				mu.Unlock()
+			}
+		}(machine)
+	}
+	wg.Wait()
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to pull images on [%s]", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) ApplyManifest(master *instance.Instance, name string, manifest []byte) error {
+	remote := RemoteManifestsLocation + name + ".yaml"
+	// kept on master for DeleteManifest even if it is applied by the client, only readable by root as it may hold secrets
+	if err := k.runner.Upload(master.IP, manifest, remote, 0600); err != nil {
+		return err
+	}
+	if client := k.apiClient(master); client != nil {
+		applied, err := client.Apply(manifest)
+		var output bytes.Buffer
+		for _, obj := range applied {
+			fmt.Fprintf(&output, "%s serverside-applied\n", obj)
+		}
+		k.saveLog(master, name+".yaml", output.Bytes())
+		return err
+	}
+	output, err := k.Kubectl(master, "apply -f "+remote)
+	k.saveLog(master, name+".yaml", output)
+	if err != nil {
+		return fmt.Errorf("Failed to apply %s, err: %s, output: %s", name, err.Error(), string(output))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) DeleteManifest(master *instance.Instance, name string) error {
+	remote := RemoteManifestsLocation + name + ".yaml"
+	cmd := fmt.Sprintf("if [ -f %s ]; then kubectl --kubeconfig=%s delete --ignore-not-found -f %s && rm -f %s; fi", remote, KubeconfigFilePath, remote, remote)
+	output, err := k.runner.RunAndGetOutput(master.IP, cmd)
+	k.saveLog(master, name+"-delete.yaml", output)
+	if err != nil {
+		return fmt.Errorf("Failed to delete %s, err: %s, output: %s", name, err.Error(), string(output))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) Kubectl(master *instance.Instance, args string) ([]byte, error) {
+	return k.runner.RunAndGetOutput(master.IP, fmt.Sprintf("kubectl --kubeconfig=%s %s", KubeconfigFilePath, args))
+}
+
+// joinNode joins a node, a failed attempt is cleaned by 'kubeadm reset' before next one
+func (k *kubeadmBootstrapper) joinNode(n *instance.Instance, vars *ScriptVars) error {
+	if err := k.waitBoot(n); err != nil {
+		return err
+	}
+	attempt := 0
+	var lastErr error
+	err := retry.Do(k.opt.JoinRetries+1, DefaultJoinRetryInterval, func() error {
+		if attempt > 0 {
+			klog.Warningf("Retry joining %s, attempt %d", n.IP, attempt+1)
+			if output, err := k.runner.RunAndGetOutput(n.IP, k.withCRISocket("kubeadm reset -f")); err != nil {
+				klog.Warningf("Failed to reset %s, output: %s", n.IP, string(output))
+			}
+		}
+		attempt++
+		if err := k.uploadUserData(n); err != nil {
+			lastErr = err
+			return err
+		}
+		output, err := k.runScript(n, JoinScript, vars)
+		klog.V(2).Info(string(output))
+		lastErr = err
+		return err
+	})
+	if err != nil {
+		return lastErr
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) FetchKubeconfig(master *instance.Instance) ([]byte, error) {
+	bytes, err := k.runner.RunAndGetOutput(master.IP, "cat "+KubeconfigFilePath)
+	if err != nil {
+		klog.Errorf(string(bytes))
+		return nil, err
+	}
+	return bytes, nil
+}
+
+func (k *kubeadmBootstrapper) CreateJoinCommands(master *instance.Instance, ttl string) (*JoinCommands, error) {
+	cmd := "kubeadm token create --print-join-command"
+	if ttl != "" {
+		cmd += " --ttl " + ttl
+	}
+	output, err := k.runner.RunAndGetOutput(master.IP, cmd)
+	if err != nil {
+		klog.Errorf("Failed to create token, output: %s", string(output))
+		return nil, err
+	}
+	join := GetKubeJoinFromOutput(string(output))
+	if join == "" {
+		return nil, fmt.Errorf("Cannot find 'kubeadm join' in output of 'kubeadm token create'")
+	}
+	join = k.withCRISocket(join)
+	result := &JoinCommands{Worker: join}
+	kubeadm, err := KubeadmFor(k.opt.KubernetesVersion)
+	if err != nil {
+		kubeadm = newestKubeadm()
+	}
+	if kubeadm.UploadCertsFlag == "" {
+		klog.Warningf("kubeadm %s cannot upload certificates, only workers can be joined", k.opt.KubernetesVersion)
+		return result, nil
+	}
+	output, err = k.runner.RunAndGetOutput(master.IP, "kubeadm init phase upload-certs "+kubeadm.UploadCertsFlag)
+	if err != nil {
+		klog.Warningf("Failed to upload certificates, only workers can be joined, output: %s", string(output))
+		return result, nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	key := strings.TrimSpace(lines[len(lines)-1])
+	result.ControlPlane = fmt.Sprintf("%s %s --certificate-key %s", join, kubeadm.ControlPlaneFlag, key)
+	return result, nil
+}
+
+func (k *kubeadmBootstrapper) DeleteToken(master *instance.Instance, joinCmd string) error {
+	token := GetTokenFromJoin(joinCmd)
+	if token == "" {
+		return fmt.Errorf("Cannot find the token in '%s'", joinCmd)
+	}
+	output, err := k.runner.RunAndGetOutput(master.IP, "kubeadm token delete "+token)
+	if err != nil {
+		klog.Errorf("Failed to delete token, output: %s", string(output))
+		return err
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) CACertHash(master *instance.Instance) (string, error) {
+	output, err := k.runner.RunAndGetOutput(master.IP, "cat "+CACertFilePath)
+	if err != nil {
+		klog.Errorf("Failed to read CA certificate, output: %s", string(output))
+		return "", err
+	}
+	return CACertHash(output)
+}
+
+func (k *kubeadmBootstrapper) Discover(master *instance.Instance) (*ClusterInfo, error) {
+	info := &ClusterInfo{}
+	output, err := k.runner.RunAndGetOutput(master.IP, "kubeadm version -o short")
+	if err != nil {
+		klog.Errorf("Failed to get kubeadm version, output: %s", string(output))
+		return nil, err
+	}
+	info.KubernetesVersion = strings.TrimPrefix(strings.TrimSpace(string(output)), "v")
+	kubectl := "kubectl --kubeconfig=" + KubeconfigFilePath + " -n kube-system "
+	output, err = k.runner.RunAndGetOutput(master.IP, kubectl+"get ds -o name")
+	if err != nil {
+		klog.Errorf("Failed to list daemonsets, output: %s", string(output))
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		// names are like "daemonset.apps/calico-node", or "daemonset.extensions/calico-node" in old versions
+		name := strings.TrimSpace(line[strings.LastIndex(line, "/")+1:])
+		if found := cni.Discover(name); found != "" {
+			info.CNIName = found
+		}
+	}
+	output, err = k.runner.RunAndGetOutput(master.IP, kubectl+"get cm kubeadm-config -o jsonpath='{.data.ClusterConfiguration}'")
+	if err != nil {
+		klog.Errorf("Failed to get kubeadm config, output: %s", string(output))
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if v := strings.TrimPrefix(strings.TrimSpace(line), "podSubnet:"); v != strings.TrimSpace(line) {
+			info.PodNetworkCIDR = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return info, nil
+}
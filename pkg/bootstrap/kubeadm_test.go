@@ -0,0 +1,966 @@
+package bootstrap_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	sshfake "github.com/magicsong/yunify-k8s/pkg/ssh/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Kubeadm", func() {
+	It("Should be able to extract kubeadm join", func() {
+		case1 := `
+		You should now deploy a pod network to the cluster.
+		Run "kubectl apply -f [podnetwork].yaml" with one of the options listed at:
+		  https://kubernetes.io/docs/concepts/cluster-administration/addons/
+		
+		You can now join any number of machines by running the following on each node
+		as root:
+		
+		  kubeadm join 192.168.97.4:6443 --token t2hu0m.iwosu060ldiaezuj --discovery-token-ca-cert-hash sha256:7c9c9419b645f772338246fba984adf033a06add4e8583549de05a3ad504cd89
+		
+		`
+		Expect(bootstrap.GetKubeJoinFromOutput(case1)).To(Equal("kubeadm join 192.168.97.4:6443 --token t2hu0m.iwosu060ldiaezuj --discovery-token-ca-cert-hash sha256:7c9c9419b645f772338246fba984adf033a06add4e8583549de05a3ad504cd89"))
+		case1 = `You should now deploy a pod network to the cluster.
+		Run "kubectl apply -f [podnetwork].yaml" with one of the options listed at:
+		  https://kubernetes.io/docs/concepts/cluster-administration/addons/
+		
+		Then you can join any number of worker nodes by running the following on each as root:
+		
+		kubeadm join 192.168.97.2:6443 --token ifqc4s.w1kemvf5d66v0qw1 \\
+			--discovery-token-ca-cert-hash sha256:912f6349636027c61d5d98dbfef2393106119e47093efa721afe9522f963df32`
+		Expect(bootstrap.GetKubeJoinFromOutput(case1)).To(Equal("kubeadm join 192.168.97.2:6443 --token ifqc4s.w1kemvf5d66v0qw1 --discovery-token-ca-cert-hash sha256:912f6349636027c61d5d98dbfef2393106119e47093efa721afe9522f963df32"))
+	})
+
+	It("Should init master, apply cni and join nodes over ssh", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(join).To(Equal("kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c"))
+		Expect(b.ApplyCNI(master)).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(Equal([]string{
+			"bash /root/scripts/qks/init.sh",
+			"bash /root/scripts/qks/control-plane-health.sh",
+			"bash /root/scripts/qks/master-node.sh",
+			"bash /root/scripts/qks/cni.sh",
+		}))
+		script, ok := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(ok).To(BeTrue())
+		Expect(script).To(ContainSubstring("\nkubeadm init --pod-network-cidr=10.233.0.0/16 --kubernetes-version=v1.15.5\n"))
+		script, _ = runner.File(master.IP, "/root/scripts/qks/cni.sh")
+		Expect(script).To(ContainSubstring("\nbash /root/scripts/cni.sh -n calico --pod-cidr 10.233.0.0/16 --mode \n"))
+		script, _ = runner.File(master.IP, "/root/scripts/qks/master-node.sh")
+		Expect(script).To(ContainSubstring(`kubectl get node "$(hostname | tr '[:upper:]' '[:lower:]')"`))
+		Expect(b.JoinNodes(join, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(node.IP)).To(Equal([]string{"bash /root/scripts/qks/join.sh"}))
+		script, _ = runner.File(node.IP, "/root/scripts/qks/join.sh")
+		Expect(script).To(ContainSubstring(join))
+		Expect(b.DeleteToken(master, join)).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubeadm token delete a.b"))
+	})
+
+	It("Should check network by pods on two nodes and fail with diagnostics", func() {
+		runner := sshfake.NewRunner()
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			NetworkOption:     api.NetworkOption{CNIName: api.CalicoCNI, PodNetWorkCIDR: "10.233.0.0/16"},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		Expect(b.CheckNetwork(master)).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(Equal([]string{"bash /root/scripts/qks/network-check.sh"}))
+		script, _ := runner.File(master.IP, "/root/scripts/qks/network-check.sh")
+		Expect(script).To(ContainSubstring("kubectl -n kube-system rollout status ds/calico-node --timeout=300s"))
+		Expect(script).To(ContainSubstring("ns=" + bootstrap.NetworkCheckNamespace + "\n"))
+		Expect(script).To(ContainSubstring("run server --image=" + bootstrap.NetworkCheckImage))
+		Expect(script).To(ContainSubstring(`--overrides="{\"spec\":{\"nodeName\":\"$client\"}}"`))
+
+		runner.RespondTo(bootstrap.NetworkCheckScript, "--- pods of the check\nclient 1/1 Running\npod on node-2 cannot reach pod 10.233.1.5 on node-1", fmt.Errorf("exit status 1"))
+		err := b.CheckNetwork(master)
+		Expect(err).To(MatchError(ContainSubstring("Network of the cluster is broken")))
+		Expect(err.Error()).To(HaveSuffix("cannot reach pod 10.233.1.5 on node-1"))
+	})
+
+	It("Should verify downloads against checksums declared in the spec", func() {
+		runner := sshfake.NewRunner()
+		flannel := "https://github.com/flannel-io/flannel/releases/download/v0.26.1/kube-flannel.yml"
+		certManager := "https://github.com/jetstack/cert-manager/releases/download/v1.0.4/cert-manager.yaml"
+		sum := strings.Repeat("0f", 32)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.FlannelCNI,
+				CNIVersion:     "v0.26.1",
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+			Checksums: map[string]string{
+				flannel:     strings.ToUpper(sum),
+				certManager: sum,
+				bootstrap.HelmURL(bootstrap.HelmVersion, api.ArchARM64): sum,
+			},
+		}
+		Expect(bootstrap.ValidateChecksums(opt.Checksums)).To(Succeed())
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		Expect(b.ApplyCNI(master)).To(Succeed())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/cni.sh")
+		Expect(script).To(ContainSubstring("curl -fsSL " + flannel + " -o $manifest\necho \"" + sum + "  $manifest\" | sha256sum -c --quiet - || {"))
+		Expect(script).To(ContainSubstring("sed -e 's?10.244.0.0/16?10.233.0.0/16?g' $manifest | kubectl apply -f -\n"))
+
+		Expect(b.ApplyURL(master, certManager)).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(ContainSubstring("curl -fsSL " + certManager + " -o /root/scripts/qks/manifests/downloaded-0f0f0f0f0f0f.yaml && echo \"" + sum + "  /root/scripts/qks/manifests/downloaded-0f0f0f0f0f0f.yaml\" | sha256sum -c --quiet - && kubectl")))
+		Expect(b.ApplyURL(master, "https://example.com/other.yaml")).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f https://example.com/other.yaml"))
+
+		Expect(b.InstallHelmRelease(master, &bootstrap.HelmRelease{Name: "loki", Namespace: "logging", Repo: "grafana", RepoURL: "https://grafana.github.io/helm-charts", Chart: "loki-stack", Version: "2.1.2"})).To(Succeed())
+		script, _ = runner.File(master.IP, "/root/scripts/qks/helm.sh")
+		Expect(script).To(ContainSubstring("printf '%s\\n' '" + sum + "  /tmp/helm-arm64.tar.gz' | grep -F \" /tmp/helm-$arch.tar.gz\" | sha256sum -c --quiet -"))
+
+		opt.RequireChecksums = true
+		err := b.ApplyURL(master, "https://example.com/other.yaml")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		delete(opt.Checksums, flannel)
+		Expect(api.ExitCode(b.ApplyCNI(master))).To(Equal(api.ExitCodeValidation))
+
+		for _, bad := range []map[string]string{{flannel: "abc"}, {"kube-flannel.yml": sum}} {
+			Expect(api.ExitCode(bootstrap.ValidateChecksums(bad))).To(Equal(api.ExitCodeValidation))
+		}
+	})
+
+	It("Should apply a pinned release of CNI from its manifest", func() {
+		runner := sshfake.NewRunner()
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.FlannelCNI,
+				CNIVersion:     "v0.26.1",
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		Expect(bootstrap.NewKubeadmBootstrapper(runner, opt).ApplyCNI(master)).To(Succeed())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/cni.sh")
+		Expect(script).To(ContainSubstring("\ncurl -fsSL https://github.com/flannel-io/flannel/releases/download/v0.26.1/kube-flannel.yml | sed -e 's?10.244.0.0/16?10.233.0.0/16?g' | kubectl apply -f -\n"))
+		Expect(script).To(ContainSubstring("kubectl -n kube-flannel rollout status ds/kube-flannel-ds --timeout=300s\n"))
+		Expect(script).NotTo(ContainSubstring("/root/scripts/cni.sh"))
+
+		opt.CNIVersion = ""
+		Expect(bootstrap.NewKubeadmBootstrapper(runner, opt).ApplyCNI(master)).To(Succeed())
+		script, _ = runner.File(master.IP, "/root/scripts/qks/cni.sh")
+		Expect(script).To(ContainSubstring("\nbash /root/scripts/cni.sh -n flannel --pod-cidr 10.233.0.0/16 --mode \n"))
+		Expect(script).To(ContainSubstring("rollout status ds/kube-flannel-ds"))
+	})
+
+	It("Should wait for control plane and surface kubelet logs if init fails", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "[kubelet-check] Initial timeout of 40s passed.", fmt.Errorf("exit status 1"))
+		var journal []string
+		for i := 0; i < 80; i++ {
+			journal = append(journal, fmt.Sprintf("Oct 14 kubelet[42]: E1014 %d kubelet.go:2183] Container runtime network not ready", i))
+			journal = append(journal, fmt.Sprintf("Oct 14 kubelet[42]: I1014 %d kubelet.go:100] Starting", i))
+		}
+		runner.RespondTo(bootstrap.DiagnoseScript, strings.Join(journal, "\n"), nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		_, err := bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).Should(HaveOccurred())
+		lines := strings.Split(err.Error(), "\n")
+		Expect(lines[0]).To(Equal("Failed to run 'kubeadm init', err: exit status 1"))
+		Expect(lines).To(HaveLen(bootstrap.DiagnoseLines + 2))
+		Expect(lines[len(lines)-1]).To(ContainSubstring("E1014 79 kubelet.go:2183]"))
+		Expect(err.Error()).NotTo(ContainSubstring("Starting"))
+		Expect(runner.CommandsOn(master.IP)).NotTo(ContainElement("bash /root/scripts/qks/control-plane-health.sh"))
+		script, _ := runner.File(master.IP, "/root/scripts/qks/control-plane-health.sh")
+		Expect(script).To(BeEmpty())
+
+		runner = sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ = runner.File(master.IP, "/root/scripts/qks/control-plane-health.sh")
+		Expect(script).To(ContainSubstring("for c in etcd kube-apiserver kube-controller-manager kube-scheduler; do"))
+
+		Expect(bootstrap.RelevantLogLines("a\nb\nc", 2)).To(Equal([]string{"b", "c"}))
+	})
+
+	It("Should append extra flags to kubeadm", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:     "1.15.5",
+			KubeadmInitExtraFlags: []string{"--feature-gates=A=true,B=false", "--ignore-preflight-errors=all"},
+			KubeadmJoinExtraFlags: []string{"--node-name=n1"},
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("--kubernetes-version=v1.15.5 --feature-gates=A=true,B=false --ignore-preflight-errors=all\n"))
+		Expect(b.JoinNodes(join, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		script, _ = runner.File(node.IP, "/root/scripts/qks/join.sh")
+		Expect(script).To(ContainSubstring(join + " --node-name=n1\n"))
+	})
+
+	It("Should upload patches of static pods and pass them to kubeadm init", func() {
+		dir, err := ioutil.TempDir("", "patches")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "kube-apiserver+strategic.yaml"), []byte("spec: {}"), 0644)).ShouldNot(HaveOccurred())
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:      "1.19.3",
+			ControlPlanePatchesDir: dir,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		patch, ok := runner.File(master.IP, bootstrap.RemotePatchesLocation+"kube-apiserver+strategic.yaml")
+		Expect(ok).To(BeTrue())
+		Expect(patch).To(Equal("spec: {}"))
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("--experimental-patches " + bootstrap.RemotePatchesLocation))
+
+		opt.KubernetesVersion = "1.15.5"
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(ioutil.WriteFile(filepath.Join(dir, "coredns.yaml"), []byte("spec: {}"), 0644)).ShouldNot(HaveOccurred())
+		_, err = bootstrap.LoadPatches(dir)
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Should use the control plane endpoint and resolve it on machines", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join k8s.example.com:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:    "1.16.2",
+			ControlPlaneEndpoint: "k8s.example.com:6443",
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("--control-plane-endpoint=k8s.example.com:6443 --apiserver-cert-extra-sans=k8s.example.com"))
+		Expect(b.JoinNodes(join, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		script, _ = runner.File(node.IP, "/root/scripts/qks/join.sh")
+		Expect(script).To(ContainSubstring(`echo "192.168.0.2 k8s.example.com # qks control-plane-endpoint" >> /etc/hosts`))
+
+		_, err = bootstrap.ControlPlaneEndpointFlags("1.15.5", "k8s.example.com")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should join nodes through an endpoint which resolves by itself", func() {
+		runner := sshfake.NewRunner()
+		// kubeadm prints the address of master when the config has no endpoint
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:              "1.16.2",
+			ControlPlaneEndpoint:           "lb.k8s.internal",
+			ControlPlaneEndpointResolvable: true,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(join).To(Equal("kubeadm join lb.k8s.internal:6443 --token a.b --discovery-token-ca-cert-hash sha256:c"))
+		Expect(b.JoinNodes(join, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		script, _ := runner.File(node.IP, "/root/scripts/qks/join.sh")
+		Expect(script).To(ContainSubstring("kubeadm join lb.k8s.internal:6443"))
+		Expect(script).NotTo(ContainSubstring("/etc/hosts"))
+
+		endpoint := bootstrap.ControlPlaneEndpointOf(&api.CreateClusterOption{ControlPlaneEndpoint: "10.0.0.100:8443"}, master)
+		Expect(*endpoint).To(Equal(bootstrap.Endpoint{Host: "10.0.0.100", Port: "8443"}))
+		endpoint = bootstrap.ControlPlaneEndpointOf(&api.CreateClusterOption{ControlPlaneEndpoint: "k8s.example.com"}, master)
+		Expect(*endpoint).To(Equal(bootstrap.Endpoint{Host: "k8s.example.com", Port: bootstrap.APIServerPort, PinnedIP: master.IP}))
+		Expect(bootstrap.ControlPlaneEndpointOf(&api.CreateClusterOption{}, master).Address()).To(Equal("192.168.0.2:6443"))
+	})
+
+	It("Should add extra SANs to the apiserver certificate by flags or the config file", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join k8s.example.com:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:    "1.16.2",
+			ControlPlaneEndpoint: "k8s.example.com:6443",
+			APIServerCertSANs:    []string{"10.8.0.1", "k8s.example.com", "api.internal.example.com"},
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		_, err := bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("--apiserver-cert-extra-sans=k8s.example.com,10.8.0.1,api.internal.example.com"))
+
+		opt.Etcd = api.EtcdOption{SnapshotCount: 5000}
+		config, err := bootstrap.GenerateKubeadmConfig(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(config)).To(ContainSubstring("certSANs:\n  - k8s.example.com\n  - 10.8.0.1\n  - api.internal.example.com\n"))
+
+		Expect(bootstrap.ValidateCertSANs([]string{"192.168.1.10", "fd00::1", "*.apps.example.com", "vpn-gw"})).ShouldNot(HaveOccurred())
+		for _, san := range []string{"https://k8s.example.com", "10.0.0.1:6443", "bad name", "-k8s.example.com"} {
+			Expect(api.ExitCode(bootstrap.ValidateCertSANs([]string{san}))).To(Equal(api.ExitCodeValidation), san)
+		}
+	})
+
+	It("Should pass etcd options to kubeadm init by a config file", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join k8s.example.com:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion:    "1.16.2",
+			TokenTTL:             "1h",
+			ControlPlaneEndpoint: "k8s.example.com:6443",
+			Etcd:                 api.EtcdOption{QuotaBackendBytes: 8 << 30, HeartbeatInterval: 250, ElectionTimeout: 2500},
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		_, err := bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("kubeadm init --config=" + bootstrap.KubeadmConfigFilePath))
+		Expect(script).NotTo(ContainSubstring("--token-ttl"))
+		Expect(script).NotTo(ContainSubstring("--pod-network-cidr"))
+		config, ok := runner.File(master.IP, bootstrap.KubeadmConfigFilePath)
+		Expect(ok).To(BeTrue())
+		for _, s := range []string{
+			"apiVersion: kubeadm.k8s.io/v1beta2\nkind: InitConfiguration\nbootstrapTokens:\n- ttl: 1h\n---\n",
+			"kubernetesVersion: v1.16.2\n",
+			"controlPlaneEndpoint: k8s.example.com:6443\n",
+			"podSubnet: 10.233.0.0/16\n",
+			"certSANs:\n  - k8s.example.com\n",
+			"election-timeout: \"2500\"\n",
+			"heartbeat-interval: \"250\"\n",
+			"quota-backend-bytes: \"8589934592\"\n",
+		} {
+			Expect(config).To(ContainSubstring(s))
+		}
+
+		Expect(bootstrap.ValidateEtcdOption(api.EtcdOption{HeartbeatInterval: 500})).Should(HaveOccurred())
+		Expect(bootstrap.ValidateEtcdOption(api.EtcdOption{ElectionTimeout: 5000, HeartbeatInterval: 500})).ShouldNot(HaveOccurred())
+		Expect(api.ExitCode(bootstrap.ValidateEtcdOption(api.EtcdOption{QuotaBackendBytes: 16 << 30}))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should choose flags of kubeadm by the minor version", func() {
+		for version, expected := range map[string][]string{
+			"1.13.1":  {"kubeadm.k8s.io/v1beta1", "", "--experimental-control-plane", ""},
+			"1.14.3":  {"kubeadm.k8s.io/v1beta1", "--experimental-upload-certs", "--experimental-control-plane", ""},
+			"1.15.5":  {"kubeadm.k8s.io/v1beta2", "--upload-certs", "--control-plane", ""},
+			"1.20.1":  {"kubeadm.k8s.io/v1beta2", "--upload-certs", "--control-plane", "--experimental-patches"},
+			"v1.24.0": {"kubeadm.k8s.io/v1beta3", "--upload-certs", "--control-plane", "--patches"},
+		} {
+			kubeadm, err := bootstrap.KubeadmFor(version)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect([]string{kubeadm.ConfigAPIVersion, kubeadm.UploadCertsFlag, kubeadm.ControlPlaneFlag, kubeadm.PatchesFlag}).To(Equal(expected), version)
+		}
+		for _, version := range []string{"1.12.3", "1.99.0", "2.0.0", "latest"} {
+			_, err := bootstrap.KubeadmFor(version)
+			Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation), version)
+		}
+
+		runner := sshfake.NewRunner()
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		runner.RespondTo("upload-certs", "[upload-certs] Using certificate key:\nabcdef", nil)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		cmds, err := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.14.3"}).CreateJoinCommands(master, "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubeadm init phase upload-certs --experimental-upload-certs"))
+		Expect(cmds.ControlPlane).To(HaveSuffix("sha256:c --experimental-control-plane --certificate-key abcdef"))
+		cmds, err = bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.13.1"}).CreateJoinCommands(master, "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(cmds.ControlPlane).To(BeEmpty())
+	})
+
+	It("Should give the containerd socket to kubeadm for versions running containerd", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		runner.RespondTo("kubeadm token create", "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			NetworkOption:     api.NetworkOption{CNIName: api.CalicoCNI, PodNetWorkCIDR: "10.233.0.0/16"},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("--kubernetes-version=v1.30.5 --cri-socket=" + bootstrap.CRISocketContainerd))
+		cmds, err := b.CreateJoinCommands(master, "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(cmds.Worker).To(HaveSuffix("sha256:c --cri-socket=" + bootstrap.CRISocketContainerd))
+
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		Expect(b.JoinNodes(cmds.Worker, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		script, _ = runner.File(node.IP, "/root/scripts/qks/join.sh")
+		Expect(strings.Count(script, "--cri-socket")).To(Equal(1))
+		Expect(join).NotTo(ContainSubstring("--cri-socket"))
+
+		runner = sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt.Etcd = api.EtcdOption{SnapshotCount: 5000}
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		config, _ := runner.File(master.IP, bootstrap.KubeadmConfigFilePath)
+		Expect(config).To(ContainSubstring("criSocket: " + bootstrap.CRISocketContainerd))
+
+		Expect(bootstrap.CRISocket("1.15.5")).To(BeEmpty())
+	})
+
+	It("Should render scripts for the OS of the preset", func() {
+		preset := api.PresetKubernetes["1.30.5"]
+		preset.KubernetesVersion = "1.30.9"
+		preset.OS = api.OSRocky9
+		api.PresetKubernetes["1.30.9"] = preset
+		defer delete(api.PresetKubernetes, "1.30.9")
+
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.9",
+			NetworkOption:     api.NetworkOption{CNIName: api.CalicoCNI, PodNetWorkCIDR: "10.233.0.0/16"},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		_, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		script, _ := runner.File(master.IP, "/root/scripts/qks/init.sh")
+		Expect(script).To(ContainSubstring("swapoff -a\nsetenforce 0 2>/dev/null || true\n"))
+		Expect(script).To(ContainSubstring("systemctl disable --now firewalld"))
+		release := &bootstrap.HelmRelease{Name: "dashboard", Namespace: "kubernetes-dashboard", Repo: "dashboard", RepoURL: "https://kubernetes.github.io/dashboard", Chart: "kubernetes-dashboard", Version: "2.7.0"}
+		Expect(b.InstallHelmRelease(master, release)).To(Succeed())
+		script, _ = runner.File(master.IP, "/root/scripts/qks/helm.sh")
+		Expect(script).To(ContainSubstring("command -v tar >/dev/null 2>&1 || dnf install -y -q tar\n"))
+
+		runner = sshfake.NewRunner()
+		opt.KubernetesVersion = "1.15.5"
+		Expect(bootstrap.NewKubeadmBootstrapper(runner, opt).InstallHelmRelease(master, release)).To(Succeed())
+		script, _ = runner.File(master.IP, "/root/scripts/qks/helm.sh")
+		Expect(script).To(ContainSubstring("apt-get install -y -q tar\n"))
+		Expect(script).NotTo(ContainSubstring("setenforce"))
+
+		preset.OS = "freebsd-12"
+		api.PresetKubernetes["1.30.9"] = preset
+		_, err = bootstrap.OSFor("1.30.9")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should join windows nodes by powershell after preparing flannel", func() {
+		runner := sshfake.NewRunner()
+		windows := sshfake.NewRunner()
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			WindowsNodeCount:  2,
+			NetworkOption:     api.NetworkOption{CNIName: api.FlannelCNI, PodNetWorkCIDR: "10.244.0.0/16"},
+		}
+		Expect(bootstrap.ValidateWindowsNodes(opt)).To(Succeed())
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		nodes := []*instance.Instance{{ID: "i-win1", IP: "192.168.0.5"}, {ID: "i-win2", IP: "192.168.0.6"}}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		Expect(b.JoinWindowsNodes(master, windows, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nodes)).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(Equal([]string{"bash /root/scripts/qks/windows-network.sh"}))
+		network, _ := runner.File(master.IP, "/root/scripts/qks/windows-network.sh")
+		Expect(network).To(ContainSubstring(`'.Backend = {"Type": "vxlan", "VNI": 4096, "Port": 4789}'`))
+		Expect(network).To(ContainSubstring("sed 's/KUBE_PROXY_VERSION/v1.30.5/g'"))
+		Expect(network).NotTo(ContainSubstring("/master/"))
+
+		for _, n := range nodes {
+			script, ok := windows.File(n.IP, `C:\qks\join-windows.ps1`)
+			Expect(ok).To(BeTrue())
+			Expect(script).To(ContainSubstring("\nkubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c --cri-socket " + bootstrap.CRISocketWindows + "\n"))
+			Expect(windows.CommandsOn(n.IP)).To(Equal([]string{`& 'C:\qks\join-windows.ps1'`}))
+		}
+
+		// downloads of sig-windows-tools are verified like other manifests
+		manifests, err := bootstrap.WindowsManifests(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(manifests).To(HaveLen(2))
+		sum := strings.Repeat("0f", 32)
+		opt.Checksums = map[string]string{manifests[0].URL: sum}
+		opt.RequireChecksums = true
+		Expect(api.ExitCode(b.JoinWindowsNodes(master, windows, "kubeadm join 192.168.0.2:6443", nodes))).To(Equal(api.ExitCodeValidation))
+		opt.Checksums[manifests[1].URL] = sum
+		Expect(b.JoinWindowsNodes(master, windows, "kubeadm join 192.168.0.2:6443", nodes)).To(Succeed())
+		network, _ = runner.File(master.IP, "/root/scripts/qks/windows-network.sh")
+		Expect(network).To(ContainSubstring("curl -fsSL " + manifests[0].URL + " -o $manifest\necho \"" + sum + "  $manifest\" | sha256sum -c --quiet - || {"))
+		Expect(network).To(ContainSubstring("sed 's/FLANNEL_VERSION/" + bootstrap.WindowsFlannelVersion + "/g' $manifest | kubectl apply -f -\n"))
+		opt.Checksums, opt.RequireChecksums = nil, false
+
+		windows.RespondTo("& 'C:", "[preflight] error", fmt.Errorf("exit status 1"))
+		err = b.JoinWindowsNodes(master, windows, "kubeadm join 192.168.0.2:6443", nodes[:1])
+		joinErr, ok := err.(*bootstrap.JoinError)
+		Expect(ok).To(BeTrue())
+		Expect(joinErr.Failed).To(Equal(nodes[:1]))
+		Expect(err.Error()).To(ContainSubstring("[preflight] error"))
+
+		opt.CNIName = api.CalicoCNI
+		Expect(api.ExitCode(bootstrap.ValidateWindowsNodes(opt))).To(Equal(api.ExitCodeValidation))
+		opt.CNIName = api.FlannelCNI
+		opt.KubernetesVersion = "1.15.5"
+		Expect(api.ExitCode(bootstrap.ValidateWindowsNodes(opt))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should label nodes with zone, instance type and id of their instances", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo("get nodes -o jsonpath", "i-master 192.168.0.2\nnode-1 192.168.0.3\n", nil)
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{Zone: "ap2a", KubernetesVersion: "1.15.5"})
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2", InstanceType: "c4m8"}
+		node := &instance.Instance{ID: "i-node1", IP: "192.168.0.3"}
+		Expect(b.LabelNodes(master, []*instance.Instance{master, node})).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf label node i-master --overwrite " +
+			"node.kubernetes.io/instance-type=c4m8 qingcloud.com/instance-id=i-master topology.kubernetes.io/zone=ap2a"))
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement("kubectl --kubeconfig=/etc/kubernetes/admin.conf label node node-1 --overwrite " +
+			"qingcloud.com/instance-id=i-node1 topology.kubernetes.io/zone=ap2a"))
+
+		missing := &instance.Instance{ID: "i-node2", IP: "192.168.0.4"}
+		err := b.LabelNodes(master, []*instance.Instance{node, missing})
+		Expect(err).To(MatchError(ContainSubstring("192.168.0.4 has no node")))
+
+		Expect(b.SetProviderIDs(master, []*instance.Instance{master, node})).To(Succeed())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(`kubectl --kubeconfig=/etc/kubernetes/admin.conf patch node node-1 -p '{"spec":{"providerID":"qingcloud://i-node1"}}'`))
+		runner.RespondTo("patch node i-master", "spec.providerID: Forbidden: node updates may not change providerID except from \"\" to valid", fmt.Errorf("exit status 1"))
+		Expect(b.SetProviderIDs(master, []*instance.Instance{master})).To(MatchError(ContainSubstring("may not change providerID")))
+	})
+
+	It("Should point to logs of machines which never registered as nodes", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo("get nodes -o jsonpath", "i-master 192.168.0.2\nnode-1 192.168.0.3\nstray 192.168.0.9\n", nil)
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.15.5", BootstrapLogDir: "/tmp/qks-logs"})
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node1", IP: "192.168.0.3"}
+		Expect(b.VerifyNodes(master, []*instance.Instance{master, node})).To(Succeed())
+
+		missing := &instance.Instance{ID: "i-node2", IP: "192.168.0.4"}
+		err := b.VerifyNodes(master, []*instance.Instance{master, node, missing})
+		unregistered, ok := err.(*bootstrap.UnregisteredError)
+		Expect(ok).To(BeTrue())
+		Expect(unregistered.Machines).To(Equal([]*instance.Instance{missing}))
+		Expect(err.Error()).To(Equal("1 machines never registered as nodes: i-node2 [192.168.0.4] (logs: /tmp/qks-logs/i-node2-*.log)"))
+	})
+
+	It("Should report states of nodes from their conditions", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo("get nodes -o jsonpath", "i-master 192.168.0.2 Ready=True,DiskPressure=True,\nnode-1 192.168.0.3 Ready=Unknown,\nnode-2 192.168.0.4\n", nil)
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.15.5"})
+		statuses, err := b.NodeStatuses(&instance.Instance{IP: "192.168.0.2"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(statuses).To(HaveLen(3))
+		Expect(statuses[0].IP).To(Equal("192.168.0.2"))
+		Expect(statuses[0].State()).To(Equal("Ready, DiskPressure"))
+		Expect(statuses[1].State()).To(Equal("Unknown"))
+		Expect(statuses[2].State()).To(Equal("Unknown"))
+
+		runner.RespondTo("get nodes -o jsonpath", "The connection to the server was refused", fmt.Errorf("exit status 1"))
+		_, err = b.NodeStatuses(&instance.Instance{IP: "192.168.0.2"})
+		Expect(err).To(MatchError(ContainSubstring("connection to the server was refused")))
+	})
+
+	It("Should patch a machine and wait for it to reboot", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo("cat /proc/sys/kernel/random/boot_id", "8d1c2a6e\n", nil)
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.15.5"})
+		node := &instance.Instance{IP: "192.168.0.3"}
+		Expect(b.PatchOS(node)).To(Succeed())
+		commands := runner.CommandsOn(node.IP)
+		Expect(commands).To(HaveLen(4))
+		Expect(commands[0]).To(ContainSubstring("apt-get upgrade -y"))
+		Expect(commands[2]).To(ContainSubstring("systemctl reboot"))
+		Expect(commands[3]).To(Equal(`test "$(cat /proc/sys/kernel/random/boot_id)" != "8d1c2a6e"`))
+
+		runner.RespondTo("apt-get upgrade", "E: Could not get lock /var/lib/dpkg/lock-frontend", fmt.Errorf("exit status 100"))
+		Expect(b.PatchOS(node)).To(MatchError(ContainSubstring("Could not get lock")))
+		Expect(runner.CommandsOn(node.IP)).To(HaveLen(5))
+	})
+
+	It("Should compute the hash of CA like kubeadm", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ShouldNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "kubernetes"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			IsCA:         true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).ShouldNot(HaveOccurred())
+		spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).ShouldNot(HaveOccurred())
+		sum := sha256.Sum256(spki)
+		hash, err := bootstrap.CACertHash(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(hash).To(Equal("sha256:" + hex.EncodeToString(sum[:])))
+		Expect(bootstrap.GetTokenFromJoin("kubeadm join 1.1.1.1:6443 --token=x.y --discovery-token-ca-cert-hash " + hash)).To(Equal("x.y"))
+	})
+
+	It("Should upload a given CA before kubeadm init", func() {
+		dir, err := ioutil.TempDir("", "ca")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		writeCA := func(name string, lifetime time.Duration) (string, string) {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).ShouldNot(HaveOccurred())
+			template := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "corp intermediate"},
+				NotBefore:             time.Now(),
+				NotAfter:              time.Now().Add(lifetime),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+				KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			Expect(err).ShouldNot(HaveOccurred())
+			certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+			Expect(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)).ShouldNot(HaveOccurred())
+			Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)).ShouldNot(HaveOccurred())
+			return certFile, keyFile
+		}
+		certFile, keyFile := writeCA("ca", time.Hour*24*365*5)
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			CACertFile:        certFile,
+			CAKeyFile:         keyFile,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		cert, _ := ioutil.ReadFile(certFile)
+		uploaded, ok := runner.File(master.IP, bootstrap.CACertFilePath)
+		Expect(ok).To(BeTrue())
+		Expect(uploaded).To(Equal(string(cert)))
+		_, ok = runner.File(master.IP, bootstrap.CAKeyFilePath)
+		Expect(ok).To(BeTrue())
+		Expect(runner.FileMode(master.IP, bootstrap.CACertFilePath)).To(Equal(os.FileMode(0644)))
+		commands := strings.Join(runner.HistoryOn(master.IP), "\n")
+		Expect(commands).To(ContainSubstring("mkdir -p -m 700 /etc/kubernetes/pki\nupload 0600 /etc/kubernetes/pki/ca.key"))
+		Expect(strings.Index(commands, "upload 0600 /etc/kubernetes/pki/ca.key")).To(BeNumerically("<", strings.Index(commands, bootstrap.InitScript)))
+
+		// kubeadm reset deletes the uploaded CA, so every retry uploads it again
+		runner = sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "[ERROR Port-6443]: Port 6443 is in use", fmt.Errorf("exit status 1"))
+		opt.InitRetries = 1
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(master)
+		Expect(err).Should(HaveOccurred())
+		commands = strings.Join(runner.HistoryOn(master.IP), "\n")
+		Expect(strings.Count(commands, "bash /root/scripts/qks/init.sh")).To(Equal(2))
+		Expect(strings.Count(commands, "upload 0600 /etc/kubernetes/pki/ca.key")).To(Equal(2))
+		reset := strings.Index(commands, "kubeadm reset -f && rm -rf /etc/cni/net.d /var/lib/cni")
+		Expect(reset).To(BeNumerically(">", strings.Index(commands, "bash /root/scripts/qks/init.sh")))
+		Expect(reset).To(BeNumerically("<", strings.LastIndex(commands, "upload 0600 /etc/kubernetes/pki/ca.key")))
+
+		shortCert, shortKey := writeCA("short", time.Hour)
+		_, _, err = bootstrap.LoadCA(shortCert, shortKey)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		_, _, err = bootstrap.LoadCA(certFile, shortKey)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should wait for machines to signal they are booted before kubeadm", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			BootWait:          bootstrap.BootWaitFilePrefix + "/var/run/site-ready",
+			BootWaitTimeout:   time.Nanosecond,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		commands := runner.CommandsOn(master.IP)
+		Expect(commands[0]).To(Equal("test -e '/var/run/site-ready'"))
+
+		runner.RespondTo("test -e", "", fmt.Errorf("exit status 1"))
+		err = b.JoinNodes(join, []*instance.Instance{node})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("i-node 192.168.0.3 is not booted by file:/var/run/site-ready"))
+		Expect(runner.CommandsOn(node.IP)).To(Equal([]string{"test -e '/var/run/site-ready'"}))
+
+		// patches are not uploaded to a master which is not booted
+		dir, err := ioutil.TempDir("", "patches")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "kube-apiserver+strategic.yaml"), []byte("spec: {}"), 0644)).ShouldNot(HaveOccurred())
+		opt.KubernetesVersion = "1.19.3"
+		opt.ControlPlanePatchesDir = dir
+		other := &instance.Instance{ID: "i-other", IP: "192.168.0.4"}
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(other)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("i-other 192.168.0.4 is not booted"))
+		_, ok := runner.File(other.IP, bootstrap.RemotePatchesLocation+"kube-apiserver+strategic.yaml")
+		Expect(ok).To(BeFalse())
+
+		// a machine ssh cannot reach is checked until the timeout only, and fails as unreachable
+		runner.Unreachable(other.IP)
+		opt.BootWaitTimeout = 100 * time.Millisecond
+		start := time.Now()
+		_, err = bootstrap.NewKubeadmBootstrapper(runner, opt).InitMaster(other)
+		Expect(ssh.IsUnreachable(err)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+
+		Expect(bootstrap.ValidateBootWait(bootstrap.BootWaitCloudInit)).To(Succeed())
+		Expect(api.ExitCode(bootstrap.ValidateBootWait("file:var/run/site-ready"))).To(Equal(api.ExitCodeValidation))
+		Expect(api.ExitCode(bootstrap.ValidateBootWait("agent"))).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should run user data once on every machine before kubeadm", func() {
+		dir, err := ioutil.TempDir("", "userdata")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "agents.sh")
+		Expect(ioutil.WriteFile(file, []byte("#!/bin/bash\ncurl -fsSL https://scanner.corp/install.sh | TOKEN=secret bash\n"), 0600)).ShouldNot(HaveOccurred())
+		runner := sshfake.NewRunner()
+		runner.RespondTo(bootstrap.InitScript, "kubeadm join 192.168.0.2:6443 --token a.b --discovery-token-ca-cert-hash sha256:c", nil)
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			UserData:          file,
+			NetworkOption: api.NetworkOption{
+				CNIName:        api.CalicoCNI,
+				PodNetWorkCIDR: "10.233.0.0/16",
+			},
+		}
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		join, err := b.InitMaster(master)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(b.JoinNodes(join, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		for _, m := range []*instance.Instance{master, node} {
+			uploaded, ok := runner.File(m.IP, bootstrap.RemoteUserDataPath)
+			Expect(ok).To(BeTrue())
+			Expect(uploaded).To(ContainSubstring("TOKEN=secret"))
+			Expect(runner.FileMode(m.IP, bootstrap.RemoteUserDataPath)).To(Equal(os.FileMode(0600)))
+		}
+		for ip, name := range map[string]string{master.IP: bootstrap.InitScript, node.IP: bootstrap.JoinScript} {
+			script, ok := runner.File(ip, bootstrap.RemoteScriptsLocation+name)
+			Expect(ok).To(BeTrue())
+			step := strings.Index(script, "[ -f /root/scripts/qks/user-data.done ] || { chmod 700 /root/scripts/qks/user-data && /root/scripts/qks/user-data && touch /root/scripts/qks/user-data.done; }")
+			Expect(step).To(BeNumerically(">", 0))
+			Expect(step).To(BeNumerically("<", strings.Index(script, "kubeadm ")))
+		}
+
+		Expect(ioutil.WriteFile(file, []byte("apt-get install -y agent\n"), 0600)).ShouldNot(HaveOccurred())
+		_, err = bootstrap.LoadUserData(file)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+	})
+
+	It("Should pre-pull images on every machine", func() {
+		runner := sshfake.NewRunner()
+		opt := &api.CreateClusterOption{KubernetesVersion: "1.15.5", PrePullImages: []string{"nginx:1.17", "harbor.local/app/web:v1"}}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		nodes := []*instance.Instance{{ID: "i-node1", IP: "192.168.0.3"}, {ID: "i-node2", IP: "192.168.0.4"}}
+		Expect(b.PrePullImages(nodes)).ShouldNot(HaveOccurred())
+		for _, n := range nodes {
+			Expect(runner.CommandsOn(n.IP)).To(Equal([]string{"bash /root/scripts/qks/pull.sh"}))
+			script, _ := runner.File(n.IP, "/root/scripts/qks/pull.sh")
+			Expect(script).To(ContainSubstring("\npull nginx:1.17\npull harbor.local/app/web:v1\n"))
+		}
+		runner.RespondTo(bootstrap.PullScript, "manifest unknown", fmt.Errorf("exit status 1"))
+		err := b.PrePullImages(nodes[:1])
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("192.168.0.3"))
+	})
+
+	It("Should distribute registry credentials as secrets and to kubelet", func() {
+		os.Setenv("QKS_TEST_HARBOR_PASSWORD", "s3cret")
+		defer os.Unsetenv("QKS_TEST_HARBOR_PASSWORD")
+		runner := sshfake.NewRunner()
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.15.5",
+			Registry: api.RegistryOption{
+				Credentials: []api.RegistryCredential{{Server: "harbor.local", Username: "robot", PasswordEnv: "QKS_TEST_HARBOR_PASSWORD"}},
+				Namespaces:  []string{"default", "apps"},
+				NodeAuth:    true,
+			},
+		}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		node := &instance.Instance{ID: "i-node", IP: "192.168.0.3"}
+		Expect(b.ConfigureRegistries(master, []*instance.Instance{node})).ShouldNot(HaveOccurred())
+		Expect(runner.CommandsOn(master.IP)).To(ContainElement(ContainSubstring("apply -f " + bootstrap.RemoteRegistrySecretsPath + "; code=$?; rm -f")))
+		manifest, _ := runner.File(master.IP, bootstrap.RemoteRegistrySecretsPath)
+		config, err := bootstrap.DockerConfigJSON(opt.Registry.Credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(config)).To(ContainSubstring(`"auth":"` + base64.StdEncoding.EncodeToString([]byte("robot:s3cret")) + `"`))
+		Expect(manifest).To(ContainSubstring(base64.StdEncoding.EncodeToString(config)))
+		Expect(strings.Count(manifest, "name: "+api.DefaultRegistrySecretName)).To(Equal(2))
+		Expect(manifest).To(ContainSubstring("namespace: apps"))
+		for _, m := range []*instance.Instance{master, node} {
+			kubelet, ok := runner.File(m.IP, bootstrap.KubeletDockerConfigPath)
+			Expect(ok).To(BeTrue())
+			Expect(kubelet).To(Equal(string(config)))
+			Expect(runner.FileMode(m.IP, bootstrap.KubeletDockerConfigPath)).To(Equal(os.FileMode(0600)))
+		}
+
+		os.Unsetenv("QKS_TEST_HARBOR_PASSWORD")
+		Expect(b.ConfigureRegistries(master, nil)).Should(HaveOccurred())
+	})
+
+	It("Should generate namespaces of teams with quotas, limits and role bindings", func() {
+		teams := []api.TeamOption{
+			{
+				Name:   "payments",
+				Users:  []string{"alice@example.com"},
+				Groups: []string{"payments-dev"},
+				Quota:  map[string]string{"requests.cpu": "8", "requests.memory": "16Gi", "pods": "50"},
+				Limits: api.TeamLimits{Default: map[string]string{"cpu": "500m"}, DefaultRequest: map[string]string{"cpu": "100m"}},
+			},
+			{Name: "search", Namespace: "search-prod", Role: "admin", Users: []string{"bob"}},
+		}
+		Expect(bootstrap.ValidateTeams(teams)).ShouldNot(HaveOccurred())
+		manifest, err := bootstrap.TeamsManifest(teams)
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, s := range []string{
+			"kind: Namespace\nmetadata:\n  labels:\n    qks.io/team: payments\n  name: payments\n",
+			"kind: ResourceQuota\nmetadata:\n  name: qks-team\n  namespace: payments\nspec:\n  hard:\n    pods: \"50\"\n",
+			"defaultRequest:\n      cpu: 100m\n",
+			"- apiGroup: rbac.authorization.k8s.io\n  kind: Group\n  name: payments-dev\n",
+			"name: search-prod\n",
+			"roleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: ClusterRole\n  name: admin\n",
+		} {
+			Expect(string(manifest)).To(ContainSubstring(s))
+		}
+		// no quota or limits are asked for by search
+		Expect(strings.Count(string(manifest), "kind: ResourceQuota")).To(Equal(1))
+		Expect(strings.Count(string(manifest), "kind: LimitRange")).To(Equal(1))
+		Expect(strings.Count(string(manifest), "kind: RoleBinding")).To(Equal(2))
+
+		for _, bad := range [][]api.TeamOption{
+			{{Name: "Payments", Users: []string{"alice"}}},
+			{{Name: "a", Users: []string{"alice"}}, {Name: "b", Namespace: "a", Users: []string{"bob"}}},
+			{{Name: "a"}},
+			{{Name: "a", Users: []string{"alice"}, Quota: map[string]string{"requests.cpu": "eight"}}},
+		} {
+			Expect(api.ExitCode(bootstrap.ValidateTeams(bad))).To(Equal(api.ExitCodeValidation))
+		}
+	})
+
+	It("Should build a bundle of packages, images and CNI manifests", func() {
+		runner := sshfake.NewRunner()
+		checksum := strings.Repeat("ab", 32)
+		runner.RespondTo(bootstrap.BundleScript, "saved\n"+checksum+"  /root/qks-bundle-1.30.5-amd64.tar.gz\n", nil)
+		opt := &api.CreateClusterOption{KubernetesVersion: "1.30.5"}
+		b := bootstrap.NewKubeadmBootstrapper(runner, opt)
+		builder := &instance.Instance{ID: "i-builder", IP: "192.168.0.9"}
+		got, err := b.BuildBundle(builder, "/root/qks-bundle-1.30.5-amd64.tar.gz")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(got).To(Equal(checksum))
+		script, _ := runner.File(builder.IP, "/root/scripts/qks/bundle.sh")
+		for _, s := range []string{
+			"if pkg=$(dpkg-query -W -f='${Package}=${Version}' kubeadm 2>/dev/null); then apt-get download $pkg; fi\n",
+			"dir=/root/qks-bundle\n",
+			"cp -r /root/CNI/. $dir/cni/\n",
+			"curl -fsSL https://raw.githubusercontent.com/projectcalico/calico/v3.29.1/manifests/calico.yaml -o $dir/cni/calico-v3.29.1.yaml\n",
+			"kubeadm config images list --kubernetes-version v1.30.5",
+			"xargs sha256sum > SHA256SUMS",
+			"tar -czf /root/qks-bundle-1.30.5-amd64.tar.gz -C $(dirname $dir) $(basename $dir)\n",
+		} {
+			Expect(script).To(ContainSubstring(s))
+		}
+		Expect(bootstrap.BundleManifests("1.30.5")).To(ContainElement(bootstrap.BundleManifest{Name: "flannel-v0.26.1", URL: "https://github.com/flannel-io/flannel/releases/download/v0.26.1/kube-flannel.yml"}))
+		Expect(bootstrap.BundleManifests("1.15.5")).To(BeEmpty())
+
+		runner.RespondTo(bootstrap.BundleScript, "tar: no space left on device", fmt.Errorf("exit status 2"))
+		_, err = b.BuildBundle(builder, "/root/qks-bundle-1.30.5-amd64.tar.gz")
+		Expect(err).To(MatchError(ContainSubstring("no space left on device")))
+	})
+
+	It("Should install a helm chart with values only readable by root", func() {
+		runner := sshfake.NewRunner()
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{KubernetesVersion: "1.18.6"})
+		master := &instance.Instance{ID: "i-master", IP: "192.168.0.2"}
+		release := &bootstrap.HelmRelease{Name: "monitoring", Namespace: "monitoring", Repo: "prometheus-community", RepoURL: "https://prometheus-community.github.io/helm-charts", Chart: "kube-prometheus-stack", Version: "9.4.10", Values: []byte("grafana: {}\n")}
+		Expect(b.InstallHelmRelease(master, release)).ShouldNot(HaveOccurred())
+		values := bootstrap.RemoteManifestsLocation + "monitoring-values.yaml"
+		content, _ := runner.File(master.IP, values)
+		Expect(content).To(Equal("grafana: {}\n"))
+		Expect(runner.FileMode(master.IP, values)).To(Equal(os.FileMode(0600)))
+		Expect(runner.CommandsOn(master.IP)).To(Equal([]string{"bash /root/scripts/qks/helm.sh"}))
+		script, _ := runner.File(master.IP, "/root/scripts/qks/helm.sh")
+		Expect(script).To(ContainSubstring("helm-" + bootstrap.HelmVersion + "-linux-$arch.tar.gz"))
+		Expect(script).To(ContainSubstring("export KUBECONFIG=/etc/kubernetes/admin.conf\nhelm repo add prometheus-community https://prometheus-community.github.io/helm-charts\n"))
+		Expect(script).To(ContainSubstring("helm upgrade --install monitoring prometheus-community/kube-prometheus-stack --version 9.4.10 -n monitoring --create-namespace -f " + values))
+	})
+
+	It("Should discover version, cni and pod cidr of a running cluster", func() {
+		runner := sshfake.NewRunner()
+		runner.RespondTo("kubeadm version", "v1.15.5\n", nil)
+		runner.RespondTo("get ds", "daemonset.extensions/calico-node\ndaemonset.extensions/kube-proxy\n", nil)
+		runner.RespondTo("kubeadm-config", "networking:\n  dnsDomain: cluster.local\n  podSubnet: 10.233.0.0/16\n", nil)
+		b := bootstrap.NewKubeadmBootstrapper(runner, &api.CreateClusterOption{ClusterName: "test"})
+		info, err := b.Discover(&instance.Instance{IP: "192.168.0.2"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(*info).To(Equal(bootstrap.ClusterInfo{KubernetesVersion: "1.15.5", CNIName: api.CalicoCNI, PodNetworkCIDR: "10.233.0.0/16"}))
+	})
+})
@@ -0,0 +1,107 @@
+package bootstrap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// well-known labels the cloud provider would set, so schedulers and tools work without it
+const (
+	ZoneLabel         = "topology.kubernetes.io/zone"
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+	InstanceIDLabel   = "qingcloud.com/instance-id"
+)
+
+// ProviderIDPrefix is followed by the instance id in spec.providerID, the same as the qingcloud cloud controller manager
+const ProviderIDPrefix = "qingcloud://"
+
+// nodeAddressesJSONPath prints a node per line as "name internal-ip"
+const nodeAddressesJSONPath = `'{range .items[*]}{.metadata.name}{" "}{.status.addresses[?(@.type=="InternalIP")].address}{"\n"}{end}'`
+
+// NodeLabels returns the labels of machine in zone, instance type is left out if unknown
+func NodeLabels(zone string, machine *instance.Instance) map[string]string {
+	labels := map[string]string{InstanceIDLabel: machine.ID}
+	if zone != "" {
+		labels[ZoneLabel] = zone
+	}
+	if machine.InstanceType != "" {
+		labels[InstanceTypeLabel] = machine.InstanceType
+	}
+	return labels
+}
+
+// nodeNames maps internal ips to names of nodes
+func (k *kubeadmBootstrapper) nodeNames(master *instance.Instance) (map[string]string, error) {
+	output, err := k.Kubectl(master, "get nodes -o jsonpath="+nodeAddressesJSONPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list nodes, err: %s, output: %s", err.Error(), string(output))
+	}
+	names := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			names[fields[1]] = fields[0]
+		}
+	}
+	return names, nil
+}
+
+// LabelNodes finds nodes of machines by their internal ip and labels them with NodeLabels
+func (k *kubeadmBootstrapper) LabelNodes(master *instance.Instance, machines []*instance.Instance) error {
+	names, err := k.nodeNames(master)
+	if err != nil {
+		return err
+	}
+	failed := make([]string, 0)
+	for _, m := range machines {
+		name, ok := names[m.IP]
+		if !ok {
+			failed = append(failed, m.IP+" has no node")
+			continue
+		}
+		labels := NodeLabels(k.opt.Zone, m)
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		args := "label node " + name + " --overwrite"
+		for _, key := range keys {
+			args += " " + key + "=" + labels[key]
+		}
+		if output, err := k.Kubectl(master, args); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", m.IP, strings.TrimSpace(string(output))))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to label nodes, %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// SetProviderIDs sets spec.providerID of nodes on machines, which cannot be changed once kubelet or anyone sets it
+func (k *kubeadmBootstrapper) SetProviderIDs(master *instance.Instance, machines []*instance.Instance) error {
+	names, err := k.nodeNames(master)
+	if err != nil {
+		return err
+	}
+	failed := make([]string, 0)
+	for _, m := range machines {
+		name, ok := names[m.IP]
+		if !ok {
+			failed = append(failed, m.IP+" has no node")
+			continue
+		}
+		patch := fmt.Sprintf(`'{"spec":{"providerID":"%s%s"}}'`, ProviderIDPrefix, m.ID)
+		if output, err := k.Kubectl(master, "patch node "+name+" -p "+patch); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", m.IP, strings.TrimSpace(string(output))))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to set provider id of nodes, %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+)
+
+// NetworkCheckNamespace holds pods of the check, it is deleted even if the check fails, pods are described in the error then
+const NetworkCheckNamespace = "qks-netcheck"
+
+// NetworkCheckImage is pulled by pods of the check, so pulling images from the registry is checked too
+const NetworkCheckImage = "busybox:1.36"
+
+func (k *kubeadmBootstrapper) CheckNetwork(master *instance.Instance) error {
+	_, release, err := k.cniRelease()
+	if err != nil {
+		return err
+	}
+	vars := k.scriptVars()
+	if release != nil {
+		vars.CNIDaemonSets = release.DaemonSets
+	}
+	vars.NetworkCheckImage = NetworkCheckImage
+	vars.NetworkCheckNamespace = NetworkCheckNamespace
+	output, err := k.runScript(master, NetworkCheckScript, vars)
+	if err != nil {
+		// what failed is printed after the diagnostics, the tail is kept in order rather than filtered
+		lines := strings.Split(strings.TrimSpace(log.Redact(string(output))), "\n")
+		if len(lines) > DiagnoseLines {
+			lines = lines[len(lines)-DiagnoseLines:]
+		}
+		return fmt.Errorf("Network of the cluster is broken, err: %s, output:\n%s", err.Error(), strings.Join(lines, "\n"))
+	}
+	return nil
+}
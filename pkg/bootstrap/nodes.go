@@ -0,0 +1,84 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// nodeConditionsJSONPath prints a node per line as "name internal-ip type=status,type=status,"
+const nodeConditionsJSONPath = `'{range .items[*]}{.metadata.name}{" "}{.status.addresses[?(@.type=="InternalIP")].address}{" "}{range .status.conditions[*]}{.type}{"="}{.status}{","}{end}{"\n"}{end}'`
+
+// NodeStatus is what the cluster reports of a node
+type NodeStatus struct {
+	Name string
+	IP   string
+	// Conditions maps types like Ready or DiskPressure to True, False or Unknown
+	Conditions map[string]string
+}
+
+// State is Ready, NotReady or Unknown followed by pressures the node is under, like "Ready, DiskPressure"
+func (n *NodeStatus) State() string {
+	state := "Unknown"
+	switch n.Conditions["Ready"] {
+	case "True":
+		state = "Ready"
+	case "False":
+		state = "NotReady"
+	}
+	for _, pressure := range []string{"MemoryPressure", "DiskPressure", "PIDPressure", "NetworkUnavailable"} {
+		if n.Conditions[pressure] == "True" {
+			state += ", " + pressure
+		}
+	}
+	return state
+}
+
+// NodeStatuses lists nodes by kubectl on master, it fails if the apiserver cannot be reached
+func (k *kubeadmBootstrapper) NodeStatuses(master *instance.Instance) ([]NodeStatus, error) {
+	output, err := k.Kubectl(master, "get nodes -o jsonpath="+nodeConditionsJSONPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list nodes, err: %s, output: %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+	statuses := make([]NodeStatus, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		status := NodeStatus{Name: fields[0], IP: fields[1], Conditions: make(map[string]string)}
+		if len(fields) > 2 {
+			for _, c := range strings.Split(fields[2], ",") {
+				if i := strings.Index(c, "="); i != -1 {
+					status.Conditions[c[:i]] = c[i+1:]
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// DrainTimeout bounds how long draining a node waits for its pods to be evicted
+const DrainTimeout = "5m"
+
+// DrainNode cordons the node and evicts its pods, pods of daemonsets are left running
+func (k *kubeadmBootstrapper) DrainNode(master *instance.Instance, name string) error {
+	kubeadm, err := KubeadmFor(k.opt.KubernetesVersion)
+	if err != nil {
+		kubeadm = newestKubeadm()
+	}
+	args := fmt.Sprintf("drain %s --ignore-daemonsets --force %s --timeout=%s", name, kubeadm.DrainEmptyDirFlag, DrainTimeout)
+	if output, err := k.Kubectl(master, args); err != nil {
+		return fmt.Errorf("Failed to drain node %s, err: %s, output: %s", name, err.Error(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) ResetNode(machine *instance.Instance) error {
+	if output, err := k.runner.RunAndGetOutput(machine.IP, k.withCRISocket("kubeadm reset -f")+" && "+cleanCNICommand); err != nil {
+		return fmt.Errorf("Failed to reset %s, err: %s, output: %s", machine.IP, err.Error(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package bootstrap
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// OS is what differs between base OSes of images, scripts use it instead of assuming ubuntu
+type OS struct {
+	// InstallCommand installs the packages given after it
+	InstallCommand string
+	// ServiceLogsCommand prints recent logs of the unit given after it
+	ServiceLogsCommand string
+	// KubeletEnvFile is where the kubelet unit of kubeadm packages reads KUBELET_EXTRA_ARGS from
+	KubeletEnvFile string
+	// Prepare runs before every script, it must not fail if done already
+	Prepare []string
+	// PatchCommand applies updates of packages, kubernetes packages are kept at their versions
+	PatchCommand string
+	// PinnedPackageCommand prints the package given after it at its installed version, in the form DownloadCommand takes
+	PinnedPackageCommand string
+	// DownloadCommand downloads the packages given after it into the current folder without installing them
+	DownloadCommand string
+}
+
+var debian = OS{
+	InstallCommand:     "DEBIAN_FRONTEND=noninteractive apt-get install -y -q",
+	ServiceLogsCommand: "journalctl --no-pager -n 500 -u",
+	KubeletEnvFile:     "/etc/default/kubelet",
+	// images hold kubelet, kubeadm and kubectl by apt-mark, upgrade leaves held packages alone
+	PatchCommand:         "apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get upgrade -y -q -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold",
+	PinnedPackageCommand: "dpkg-query -W -f='${Package}=${Version}'",
+	DownloadCommand:      "apt-get download",
+}
+
+// redhat images keep selinux and firewalld on, kubeadm does not pass preflight with them
+func redhat(packageManager string) OS {
+	patch := packageManager + " update -y -q --exclude='kube*' --exclude=cri-tools"
+	// repositories of centos 7 have no security metadata, all updates are applied there
+	if packageManager == "dnf" {
+		patch += " --security"
+	}
+	return OS{
+		InstallCommand:     packageManager + " install -y -q",
+		ServiceLogsCommand: "journalctl --no-pager -n 500 -u",
+		KubeletEnvFile:     "/etc/sysconfig/kubelet",
+		PatchCommand:       patch,
+		// rpm prints name-version-release.arch, reinstall takes it and needs no plugin to download installed packages
+		PinnedPackageCommand: "rpm -q",
+		DownloadCommand:      packageManager + " reinstall -y -q --downloadonly --downloaddir=.",
+		Prepare: []string{
+			"setenforce 0 2>/dev/null || true",
+			"sed -i 's/^SELINUX=enforcing$/SELINUX=permissive/' /etc/selinux/config 2>/dev/null || true",
+			"systemctl disable --now firewalld 2>/dev/null || true",
+		},
+	}
+}
+
+var operatingSystems = map[string]OS{
+	"":               debian,
+	api.OSUbuntu2004: debian,
+	api.OSUbuntu2204: debian,
+	api.OSCentOS7:    redhat("yum"),
+	api.OSRocky8:     redhat("dnf"),
+	api.OSRocky9:     redhat("dnf"),
+}
+
+// OSFor returns the OS of the preset of version, versions without a preset are running on the default ubuntu
+func OSFor(version string) (*OS, error) {
+	name := api.PresetKubernetes[version].OS
+	result, ok := operatingSystems[name]
+	if !ok {
+		return nil, api.NewValidationError("OS %s of kubernetes %s is not supported by qks", name, version)
+	}
+	return &result, nil
+}
@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"k8s.io/klog"
+)
+
+const (
+	bootIDFile = "/proc/sys/kernel/random/boot_id"
+	// rebootCommand is delayed by systemd, so the ssh session returns before the machine goes down
+	rebootCommand = "systemd-run --on-active=3 /bin/systemctl reboot"
+	// a machine has 10 minutes to reboot and accept ssh again
+	rebootWaitTimeout  = time.Minute * 10
+	rebootWaitInterval = time.Second * 10
+)
+
+func (k *kubeadmBootstrapper) PatchOS(machine *instance.Instance) error {
+	system, err := OSFor(k.opt.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	output, err := k.runner.RunAndGetOutput(machine.IP, system.PatchCommand)
+	k.saveLog(machine, "patch", output)
+	if err != nil {
+		lines := RelevantLogLines(log.Redact(string(output)), DiagnoseLines)
+		return fmt.Errorf("Failed to patch %s, err: %s, output: %s", machine.IP, err.Error(), strings.Join(lines, "\n"))
+	}
+	bootID, err := k.runner.RunAndGetOutput(machine.IP, "cat "+bootIDFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read boot id of %s, err: %s, output: %s", machine.IP, err.Error(), string(bootID))
+	}
+	if output, err := k.runner.RunAndGetOutput(machine.IP, rebootCommand); err != nil {
+		return fmt.Errorf("Failed to reboot %s, err: %s, output: %s", machine.IP, err.Error(), strings.TrimSpace(string(output)))
+	}
+	klog.Infof("Patched %s, waiting for it to reboot", machine.IP)
+	// fails while the machine is down, or up but not rebooted yet
+	check := fmt.Sprintf(`test "$(cat %s)" != "%s"`, bootIDFile, strings.TrimSpace(string(bootID)))
+	err = retry.Until(rebootWaitTimeout, rebootWaitInterval, func() error {
+		_, err := k.runner.RunAndGetOutput(machine.IP, check)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s does not come back from reboot in %s", machine.IP, rebootWaitTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// RemotePatchesLocation is where patches to static pods are uploaded to on master
+const RemotePatchesLocation = RemoteScriptsLocation + "patches/"
+
+var patchTargets = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler", "etcd"}
+
+// LoadPatches reads patches in dir, file names must be "target[suffix][+patchtype].(yaml|json)" as kubeadm requires
+func LoadPatches(dir string) (map[string][]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, api.NewValidationError("Failed to read patches in %s, err: %s", dir, err.Error())
+	}
+	patches := make(map[string][]byte)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if !isPatchFile(f.Name()) {
+			return nil, api.NewValidationError("Patch %s must be named after one of %v and end with .yaml or .json", f.Name(), patchTargets)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		patches[f.Name()] = content
+	}
+	if len(patches) == 0 {
+		return nil, api.NewValidationError("No patches found in %s", dir)
+	}
+	return patches, nil
+}
+
+func isPatchFile(name string) bool {
+	ext := filepath.Ext(name)
+	if ext != ".yaml" && ext != ".json" {
+		return false
+	}
+	for _, t := range patchTargets {
+		if strings.HasPrefix(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchesFlag returns the kubeadm flag taking a patches folder, which is experimental until 1.22
+func PatchesFlag(version string) (string, error) {
+	kubeadm, err := KubeadmFor(version)
+	if err != nil {
+		return "", err
+	}
+	if kubeadm.PatchesFlag == "" {
+		return "", api.NewValidationError("Patching static pods needs kubeadm 1.19 or later, but the cluster is %s", version)
+	}
+	return kubeadm.PatchesFlag, nil
+}
+
+func (k *kubeadmBootstrapper) uploadPatches(master *instance.Instance) (string, error) {
+	flag, err := PatchesFlag(k.opt.KubernetesVersion)
+	if err != nil {
+		return "", err
+	}
+	patches, err := LoadPatches(k.opt.ControlPlanePatchesDir)
+	if err != nil {
+		return "", err
+	}
+	for name, content := range patches {
+		if err := k.runner.Upload(master.IP, content, RemotePatchesLocation+name, 0644); err != nil {
+			return "", fmt.Errorf("Failed to upload patch %s, err: %s", name, err.Error())
+		}
+	}
+	return fmt.Sprintf("%s %s", flag, RemotePatchesLocation), nil
+}
@@ -0,0 +1,104 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+const (
+	// KubeletDockerConfigPath is read by kubelet when it pulls images for pods without imagePullSecrets
+	KubeletDockerConfigPath   = "/var/lib/kubelet/config.json"
+	RemoteRegistrySecretsPath = RemoteScriptsLocation + "registry-secrets.yaml"
+)
+
+// DockerConfigJSON encodes credentials in the format of ~/.docker/config.json
+func DockerConfigJSON(creds []api.RegistryCredential) ([]byte, error) {
+	auths := make(map[string]map[string]string)
+	for i := range creds {
+		password, err := creds[i].GetPassword()
+		if err != nil {
+			return nil, err
+		}
+		auths[creds[i].Server] = map[string]string{
+			"username": creds[i].Username,
+			"password": password,
+			"auth":     base64.StdEncoding.EncodeToString([]byte(creds[i].Username + ":" + password)),
+		}
+	}
+	return json.Marshal(map[string]interface{}{"auths": auths})
+}
+
+// RegistrySecretsManifest returns namespaces and an imagePullSecret in each of them
+func RegistrySecretsManifest(opt *api.RegistryOption) ([]byte, error) {
+	config, err := DockerConfigJSON(opt.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	name := opt.SecretName
+	if name == "" {
+		name = api.DefaultRegistrySecretName
+	}
+	namespaces := opt.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{"default"}
+	}
+	items := make([]interface{}, 0, len(namespaces)*2)
+	for _, ns := range namespaces {
+		items = append(items, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]string{"name": ns},
+		}, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       "kubernetes.io/dockerconfigjson",
+			"metadata":   map[string]string{"name": name, "namespace": ns},
+			"data":       map[string]string{".dockerconfigjson": base64.StdEncoding.EncodeToString(config)},
+		})
+	}
+	return yaml.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+}
+
+func (k *kubeadmBootstrapper) ConfigureRegistries(master *instance.Instance, nodes []*instance.Instance) error {
+	opt := &k.opt.Registry
+	if len(opt.Credentials) == 0 {
+		return nil
+	}
+	manifest, err := RegistrySecretsManifest(opt)
+	if err != nil {
+		return err
+	}
+	if err = k.uploadSecret(master, manifest, RemoteRegistrySecretsPath); err != nil {
+		return err
+	}
+	// the manifest holds passwords, it is removed even if apply fails
+	cmd := fmt.Sprintf("kubectl --kubeconfig=%s apply -f %s; code=$?; rm -f %s; exit $code", KubeconfigFilePath, RemoteRegistrySecretsPath, RemoteRegistrySecretsPath)
+	if output, err := k.runner.RunAndGetOutput(master.IP, cmd); err != nil {
+		klog.Errorf("Failed to create imagePullSecrets, output: %s", string(output))
+		return err
+	}
+	if !opt.NodeAuth {
+		return nil
+	}
+	config, err := DockerConfigJSON(opt.Credentials)
+	if err != nil {
+		return err
+	}
+	for _, m := range append([]*instance.Instance{master}, nodes...) {
+		if err = k.uploadSecret(m, config, KubeletDockerConfigPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadSecret uploads content only readable by root
+func (k *kubeadmBootstrapper) uploadSecret(machine *instance.Instance, content []byte, path string) error {
+	return k.runner.Upload(machine.IP, content, path, 0600)
+}
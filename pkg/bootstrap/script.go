@@ -0,0 +1,341 @@
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/magicsong/yunify-k8s/pkg/cni"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	"k8s.io/klog"
+)
+
+// RemoteScriptsLocation is where rendered scripts are uploaded to on machines
+const RemoteScriptsLocation = ScriptsLocation + "qks/"
+
+const (
+	InitScript = "init.sh"
+	CNIScript  = "cni.sh"
+	JoinScript = "join.sh"
+	PullScript = "pull.sh"
+	HelmScript = "helm.sh"
+	EtcdScript = "etcd-volume.sh"
+	// HealthScript fails until the apiserver and static pods of master are ready
+	HealthScript   = "control-plane-health.sh"
+	DiagnoseScript = "diagnose.sh"
+	// MasterNodeScript fails until the apiserver accepts requests and has the node object of master
+	MasterNodeScript = "master-node.sh"
+	// WindowsNetworkScript runs on master before windows nodes join, WindowsJoinScript is powershell run on them
+	WindowsNetworkScript = "windows-network.sh"
+	WindowsJoinScript    = "join-windows.ps1"
+	// NetworkCheckScript runs pods on two linux nodes and fails with diagnostics unless they reach each other
+	NetworkCheckScript = "network-check.sh"
+	// BundleScript packs images, packages and CNI manifests of a master image into BundleFile
+	BundleScript = "bundle.sh"
+)
+
+// EtcdDataDir is where etcd of kubeadm keeps its data
+const EtcdDataDir = "/var/lib/etcd"
+
+const scriptHeader = `#!/bin/bash
+# rendered by qks for cluster {{ .ClusterName }}, do not edit
+set -e
+swapoff -a
+{{- range .OS.Prepare }}
+{{ . }}
+{{- end }}
+{{- if .ControlPlaneHost }}
+grep -q " {{ .ControlPlaneHost }} # qks" /etc/hosts || echo "{{ .MasterIP }} {{ .ControlPlaneHost }} # qks control-plane-endpoint" >> /etc/hosts
+{{- end }}
+`
+
+// userDataStep runs user data of the site once on a machine before kubeadm touches it, a failure stops the script
+const userDataStep = `
+{{- if .UserDataPath }}
+[ -f {{ .UserDataPath }}.done ] || { chmod 700 {{ .UserDataPath }} && {{ .UserDataPath }} && touch {{ .UserDataPath }}.done; }
+{{- end }}`
+
+var scriptTemplates = map[string]string{
+	InitScript: scriptHeader + userDataStep + `
+{{ .InitCommand }}
+`,
+	CNIScript: scriptHeader + `
+{{- if .CNIManifestURL }}
+export KUBECONFIG={{ .KubeconfigPath }}
+{{- if .CNIManifestSHA256 }}
+manifest={{ .ScriptsLocation }}qks/cni-manifest.yaml
+curl -fsSL {{ .CNIManifestURL }} -o $manifest
+echo "{{ .CNIManifestSHA256 }}  $manifest" | sha256sum -c --quiet - || { echo "sha256 of {{ .CNIManifestURL }} is not {{ .CNIManifestSHA256 }}"; exit 1; }
+sed -e '{{ .CNIFilter }}' $manifest | kubectl apply -f -
+{{- else }}
+curl -fsSL {{ .CNIManifestURL }} | sed -e '{{ .CNIFilter }}' | kubectl apply -f -
+{{- end }}
+{{- else }}
+bash {{ .ScriptsLocation }}{{ .CNICmd }} -n {{ .CNIName }} --pod-cidr {{ .PodNetworkCIDR }} --mode {{ .CNIMode }}
+{{- end }}
+{{- range .CNIDaemonSets }}
+KUBECONFIG={{ $.KubeconfigPath }} kubectl -n {{ .Namespace }} rollout status ds/{{ .Name }} --timeout=300s
+{{- end }}
+`,
+	JoinScript: scriptHeader + userDataStep + `
+{{ .JoinCommand }}
+`,
+	PullScript: scriptHeader + `
+# credentials given to kubelet by registry.nodeAuth are used for private images
+pull() {
+  if ! command -v docker >/dev/null 2>&1; then crictl pull "$1"
+  elif [ -f /var/lib/kubelet/config.json ]; then docker --config /var/lib/kubelet pull "$1"
+  else docker pull "$1"; fi
+}
+{{- range .Images }}
+pull {{ . }}
+{{- end }}
+`,
+	HelmScript: scriptHeader + `
+if ! command -v helm >/dev/null 2>&1; then
+  command -v tar >/dev/null 2>&1 || {{ .OS.InstallCommand }} tar
+  arch=$(uname -m | sed 's/x86_64/amd64/;s/aarch64/arm64/')
+{{- if .HelmChecksums }}
+  curl -fsSL https://get.helm.sh/helm-{{ .HelmVersion }}-linux-$arch.tar.gz -o /tmp/helm-$arch.tar.gz
+  # an arch without a declared sha256 fails as well, sha256sum finds no line for it
+  printf '%s\n'{{ range .HelmChecksums }} '{{ . }}'{{ end }} | grep -F " /tmp/helm-$arch.tar.gz" | sha256sum -c --quiet - || { echo "helm of $arch does not match a declared sha256"; exit 1; }
+  tar -xzf /tmp/helm-$arch.tar.gz -C /tmp
+{{- else }}
+  curl -fsSL https://get.helm.sh/helm-{{ .HelmVersion }}-linux-$arch.tar.gz | tar -xz -C /tmp
+{{- end }}
+  mv /tmp/linux-$arch/helm /usr/local/bin/helm
+fi
+export KUBECONFIG={{ .KubeconfigPath }}
+{{- range .HelmCommands }}
+helm {{ . }}
+{{- end }}
+`,
+	EtcdScript: scriptHeader + `
+device={{ .EtcdDevice }}
+for i in $(seq 1 30); do [ -b $device ] && break; sleep 2; done
+[ -b $device ] || { echo "$device does not show up"; exit 1; }
+blkid $device >/dev/null 2>&1 || mkfs.ext4 -q -F $device
+uuid=$(blkid -s UUID -o value $device)
+mkdir -p {{ .EtcdDataDir }}
+grep -q "UUID=$uuid " /etc/fstab || echo "UUID=$uuid {{ .EtcdDataDir }} ext4 defaults,noatime,nofail 0 2" >> /etc/fstab
+mountpoint -q {{ .EtcdDataDir }} || mount {{ .EtcdDataDir }}
+# kubeadm refuses a data dir which is not empty
+rmdir {{ .EtcdDataDir }}/lost+found 2>/dev/null || true
+chmod 700 {{ .EtcdDataDir }}
+`,
+	HealthScript: scriptHeader + `
+export KUBECONFIG={{ .KubeconfigPath }}
+[ "$(kubectl get --raw=/healthz 2>&1)" = "ok" ] || { echo "apiserver is not healthy"; exit 1; }
+for c in{{ range .ControlPlaneComponents }} {{ . }}{{ end }}; do
+  kubectl -n kube-system get pods -l component=$c -o jsonpath='{.items[*].status.conditions[?(@.type=="Ready")].status}' | grep -q True || { echo "$c is not ready"; exit 1; }
+done
+`,
+	MasterNodeScript: scriptHeader + `
+export KUBECONFIG={{ .KubeconfigPath }}
+kubectl get --raw=/readyz >/dev/null 2>&1 || kubectl get --raw=/healthz >/dev/null
+# kubelet of kubeadm names the node after the hostname in lower case
+kubectl get node "$(hostname | tr '[:upper:]' '[:lower:]')"
+`,
+	WindowsNetworkScript: scriptHeader + `
+export KUBECONFIG={{ .KubeconfigPath }}
+# flannel of windows only speaks vxlan on VNI 4096 and port 4789, linux nodes have to use the same
+ns=$(kubectl get cm -A --field-selector metadata.name=kube-flannel-cfg -o jsonpath='{.items[0].metadata.namespace}')
+conf=$(kubectl -n $ns get cm kube-flannel-cfg -o jsonpath='{.data.net-conf\.json}' | jq -c '.Backend = {"Type": "vxlan", "VNI": 4096, "Port": 4789}')
+kubectl -n $ns patch cm kube-flannel-cfg --type merge -p "$(jq -n --arg c "$conf" '{data: {"net-conf.json": $c}}')"
+kubectl -n $ns rollout restart ds -l app=flannel
+kubectl -n $ns rollout status ds -l app=flannel --timeout 5m
+{{- range .WindowsManifests }}
+{{- if .SHA256 }}
+manifest={{ $.ScriptsLocation }}qks/windows-{{ .Name }}.yaml
+curl -fsSL {{ .URL }} -o $manifest
+echo "{{ .SHA256 }}  $manifest" | sha256sum -c --quiet - || { echo "sha256 of {{ .URL }} is not {{ .SHA256 }}"; exit 1; }
+sed 's/{{ .Placeholder }}/{{ .Value }}/g' $manifest | kubectl apply -f -
+{{- else }}
+curl -fsSL {{ .URL }} | sed 's/{{ .Placeholder }}/{{ .Value }}/g' | kubectl apply -f -
+{{- end }}
+{{- end }}
+`,
+	NetworkCheckScript: scriptHeader + `
+export KUBECONFIG={{ .KubeconfigPath }}
+ns={{ .NetworkCheckNamespace }}
+diagnose() {
+  echo "--- pods of the check"
+  kubectl -n $ns get pods -o wide
+  kubectl -n $ns describe pods | tail -n 40
+  echo "--- pods which are not running"
+  kubectl get pods --all-namespaces -o wide | grep -v -E 'Running|Completed' || true
+  kubectl delete ns $ns --wait=false >/dev/null 2>&1 || true
+}
+fail() { diagnose; echo "$1"; exit 1; }
+{{- range .CNIDaemonSets }}
+kubectl -n {{ .Namespace }} rollout status ds/{{ .Name }} --timeout=300s || fail "daemonset {{ .Name }} of CNI is not ready"
+{{- end }}
+kubectl wait --for=condition=Ready nodes --all --timeout=300s || fail "nodes are not ready"
+nodes=$(kubectl get nodes -o jsonpath='{range .items[*]}{.metadata.name} {.status.nodeInfo.operatingSystem}{"\n"}{end}' | awk '$2 == "linux" {print $1}')
+server=$(echo "$nodes" | sed -n 1p)
+client=$(echo "$nodes" | sed -n 2p)
+# a cluster of one node checks pods on the same node
+[ -n "$client" ] || client=$server
+kubectl delete ns $ns --ignore-not-found --timeout=60s >/dev/null
+kubectl create ns $ns
+# nodeName skips the scheduler, so the taint of master does not matter
+kubectl -n $ns run server --image={{ .NetworkCheckImage }} --restart=Never --labels=app=server --overrides="{\"spec\":{\"nodeName\":\"$server\"}}" -- sh -c 'echo ok > /tmp/index.html && httpd -f -p 8080 -h /tmp'
+kubectl -n $ns run client --image={{ .NetworkCheckImage }} --restart=Never --overrides="{\"spec\":{\"nodeName\":\"$client\"}}" -- sleep 600
+kubectl -n $ns expose pod server --port 8080
+kubectl -n $ns wait --for=condition=Ready pod/server pod/client --timeout=180s || fail "pods of the check are not ready"
+ip=$(kubectl -n $ns get pod server -o jsonpath='{.status.podIP}')
+kubectl -n $ns exec client -- wget -q -O- -T 5 http://$ip:8080/ | grep -q ok || fail "pod on $client cannot reach pod $ip on $server"
+svc=$(kubectl -n $ns get svc server -o jsonpath='{.spec.clusterIP}')
+kubectl -n $ns exec client -- wget -q -O- -T 5 http://$svc:8080/ | grep -q ok || fail "pod on $client cannot reach service $svc"
+kubectl -n $ns exec client -- wget -q -O- -T 5 http://server.$ns:8080/ | grep -q ok || fail "pod on $client cannot resolve service server.$ns by DNS"
+kubectl delete ns $ns --wait=false
+echo "network is ok"
+`,
+	BundleScript: scriptHeader + `
+dir={{ .BundleDir }}
+rm -rf $dir {{ .BundleFile }}
+mkdir -p $dir/packages $dir/images $dir/cni
+cd $dir/packages
+{{- range .BundlePackages }}
+if pkg=$({{ $.OS.PinnedPackageCommand }} {{ . }} 2>/dev/null); then {{ $.OS.DownloadCommand }} $pkg; fi
+{{- end }}
+# manifests of bundled CNIs are kept with the cni script of the image
+cp -r {{ .CNIYamlPath }}/. $dir/cni/
+{{- range .BundleManifests }}
+curl -fsSL {{ .URL }} -o $dir/cni/{{ .Name }}.yaml
+{{- if .SHA256 }}
+echo "{{ .SHA256 }}  $dir/cni/{{ .Name }}.yaml" | sha256sum -c --quiet - || { echo "sha256 of {{ .URL }} is not {{ .SHA256 }}"; exit 1; }
+{{- end }}
+{{- end }}
+images="$(kubeadm config images list --kubernetes-version v{{ .KubernetesVersion }} 2>/dev/null) $(grep -rh 'image:' $dir/cni --include='*.y*ml' | awk '{print $2}' | tr -d '"')"
+arch=$(uname -m | sed 's/x86_64/amd64/;s/aarch64/arm64/')
+for image in $(echo $images | tr ' ' '\n' | sort -u); do
+  file=$dir/images/$(echo $image | tr '/:@' '___').tar
+  if command -v docker >/dev/null 2>&1; then
+    docker pull -q $image && docker save -o $file $image
+  else
+    crictl pull $image >/dev/null && ctr -n k8s.io images export --platform linux/$arch $file $image
+  fi
+done
+(cd $dir && find . -type f ! -name ` + BundleChecksumsFile + ` | sort | xargs sha256sum > ` + BundleChecksumsFile + `)
+tar -czf {{ .BundleFile }} -C $(dirname $dir) $(basename $dir)
+rm -rf $dir
+sha256sum {{ .BundleFile }}
+`,
+	WindowsJoinScript: `# rendered by qks for cluster {{ .ClusterName }}, do not edit
+$ErrorActionPreference = 'Stop'
+Start-Service containerd
+{{ .JoinCommand }}
+if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+`,
+	DiagnoseScript: `#!/bin/bash
+# rendered by qks for cluster {{ .ClusterName }}, do not edit
+for unit in kubelet containerd docker; do
+  systemctl cat $unit >/dev/null 2>&1 && {{ .OS.ServiceLogsCommand }} $unit
+done
+cat {{ .OS.KubeletEnvFile }} 2>/dev/null
+exit 0
+`,
+}
+
+// ScriptVars are the cluster variables available in script templates
+type ScriptVars struct {
+	ClusterName       string
+	KubernetesVersion string
+	PodNetworkCIDR    string
+	CNIName           string
+	CNIMode           string
+	CNICmd            string
+	// CNIManifestURL is applied with CNIFilter instead of running CNICmd of images if set
+	CNIManifestURL string
+	CNIFilter      string
+	// CNIManifestSHA256 is what the manifest has to match before it is applied, it is not checked if empty
+	CNIManifestSHA256 string
+	// CNIDaemonSets are waited for after the CNI is applied
+	CNIDaemonSets   []cni.DaemonSet
+	ScriptsLocation string
+	InitCommand     string
+	JoinCommand     string
+	// ControlPlaneHost is resolved to MasterIP in /etc/hosts of machines if set, it is empty unless the endpoint is pinned to master
+	ControlPlaneHost string
+	MasterIP         string
+	// Images are pulled by PullScript
+	Images []string
+	// HelmCommands are run by HelmScript with helm of HelmVersion
+	HelmCommands []string
+	HelmVersion  string
+	// HelmChecksums are lines of sha256sum for /tmp/helm-<arch>.tar.gz, helm is downloaded without a check if empty
+	HelmChecksums  []string
+	KubeconfigPath string
+	// EtcdDevice is mounted at EtcdDataDir by EtcdScript
+	EtcdDevice  string
+	EtcdDataDir string
+	// ControlPlaneComponents are static pods checked by HealthScript
+	ControlPlaneComponents []string
+	OS                     OS
+	// WindowsManifests are applied by WindowsNetworkScript
+	WindowsManifests []WindowsManifest
+	// NetworkCheckImage runs httpd and wget for NetworkCheckScript, in NetworkCheckNamespace
+	NetworkCheckImage     string
+	NetworkCheckNamespace string
+	// BundleScript packs BundlePackages, BundleManifests and images into BundleFile, by way of BundleDir
+	BundleDir       string
+	BundleFile      string
+	BundlePackages  []string
+	BundleManifests []BundleManifest
+	CNIYamlPath     string
+	// UserDataPath is user data run by InitScript and JoinScript before kubeadm if set
+	UserDataPath string
+}
+
+// RenderScript renders the builtin script of name with vars
+func RenderScript(name string, vars *ScriptVars) ([]byte, error) {
+	text, ok := scriptTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown script %s", name)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("Failed to render script %s, err: %s", name, err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// runScript renders, uploads and runs a script on the machine, and keeps its output in logDir
+func (k *kubeadmBootstrapper) runScript(machine *instance.Instance, name string, vars *ScriptVars) ([]byte, error) {
+	content, err := RenderScript(name, vars)
+	if err != nil {
+		return nil, err
+	}
+	remote := RemoteScriptsLocation + name
+	if err := k.runner.Upload(machine.IP, content, remote, 0755); err != nil {
+		return nil, err
+	}
+	output, err := k.runner.RunAndGetOutput(machine.IP, "bash "+remote)
+	k.saveLog(machine, name, output)
+	return output, err
+}
+
+func (k *kubeadmBootstrapper) saveLog(machine *instance.Instance, name string, output []byte) {
+	if k.opt.BootstrapLogDir == "" {
+		return
+	}
+	if err := os.MkdirAll(k.opt.BootstrapLogDir, 0755); err != nil {
+		klog.Warningf("Failed to create log dir %s, err: %s", k.opt.BootstrapLogDir, err.Error())
+		return
+	}
+	file := filepath.Join(k.opt.BootstrapLogDir, fmt.Sprintf("%s-%s.log", machine.ID, name))
+	if err := ioutil.WriteFile(file, []byte(log.Redact(string(output))), 0644); err != nil {
+		klog.Warningf("Failed to write log %s, err: %s", file, err.Error())
+		return
+	}
+	klog.V(1).Infof("Output of %s on %s is saved in %s", name, machine.IP, file)
+}
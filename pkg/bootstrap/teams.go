@@ -0,0 +1,125 @@
+package bootstrap
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// TeamsManifestName names the manifest of teams on master
+	TeamsManifestName = "teams"
+	// TeamLabel on namespaces of teams holds the name of the team
+	TeamLabel = "qks.io/team"
+	// teamObjectName names the quota, limit range and role binding in namespaces of teams
+	teamObjectName = "qks-team"
+)
+
+var (
+	// namespaceRegexp matches a DNS-1123 label, which is what names of namespaces are
+	namespaceRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	// quantityRegexp matches quantities of kubernetes like 500m, 8 or 16Gi
+	quantityRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$`)
+)
+
+// ValidateTeams checks namespaces of teams are valid and not shared, and values of quotas and limits are quantities
+func ValidateTeams(teams []api.TeamOption) error {
+	seen := make(map[string]string)
+	for i := range teams {
+		t := &teams[i]
+		if t.Name == "" {
+			return api.NewValidationError("Name of a team is missing")
+		}
+		ns := t.GetNamespace()
+		if !namespaceRegexp.MatchString(ns) {
+			return api.NewValidationError("Namespace %s of team %s must be lower case letters, digits and '-'", ns, t.Name)
+		}
+		if other, ok := seen[ns]; ok {
+			return api.NewValidationError("Teams %s and %s share the namespace %s", other, t.Name, ns)
+		}
+		seen[ns] = t.Name
+		if len(t.Users) == 0 && len(t.Groups) == 0 {
+			return api.NewValidationError("Team %s has neither users nor groups", t.Name)
+		}
+		for _, values := range []map[string]string{t.Quota, t.Limits.Default, t.Limits.DefaultRequest, t.Limits.Max} {
+			for resource, value := range values {
+				// counts like pods or services.loadbalancers are plain integers, which are quantities as well
+				if !quantityRegexp.MatchString(value) {
+					return api.NewValidationError("%s=%s of team %s is not a quantity", resource, value, t.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// TeamsManifest returns a namespace of each team with its ResourceQuota, LimitRange and a RoleBinding of its users and groups
+func TeamsManifest(teams []api.TeamOption) ([]byte, error) {
+	var manifest bytes.Buffer
+	for i := range teams {
+		t := &teams[i]
+		ns := t.GetNamespace()
+		objects := []interface{}{
+			map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata":   map[string]interface{}{"name": ns, "labels": map[string]string{TeamLabel: t.Name}},
+			},
+		}
+		if len(t.Quota) != 0 {
+			objects = append(objects, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ResourceQuota",
+				"metadata":   map[string]string{"name": teamObjectName, "namespace": ns},
+				"spec":       map[string]interface{}{"hard": t.Quota},
+			})
+		}
+		if !t.Limits.IsEmpty() {
+			limit := map[string]interface{}{"type": "Container"}
+			if len(t.Limits.Default) != 0 {
+				limit["default"] = t.Limits.Default
+			}
+			if len(t.Limits.DefaultRequest) != 0 {
+				limit["defaultRequest"] = t.Limits.DefaultRequest
+			}
+			if len(t.Limits.Max) != 0 {
+				limit["max"] = t.Limits.Max
+			}
+			objects = append(objects, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "LimitRange",
+				"metadata":   map[string]string{"name": teamObjectName, "namespace": ns},
+				"spec":       map[string]interface{}{"limits": []interface{}{limit}},
+			})
+		}
+		subjects := make([]map[string]string, 0, len(t.Users)+len(t.Groups))
+		for _, u := range t.Users {
+			subjects = append(subjects, map[string]string{"kind": "User", "apiGroup": "rbac.authorization.k8s.io", "name": u})
+		}
+		for _, g := range t.Groups {
+			subjects = append(subjects, map[string]string{"kind": "Group", "apiGroup": "rbac.authorization.k8s.io", "name": g})
+		}
+		role := t.Role
+		if role == "" {
+			role = api.DefaultTeamRole
+		}
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "RoleBinding",
+			"metadata":   map[string]string{"name": teamObjectName, "namespace": ns},
+			"roleRef":    map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": role},
+			"subjects":   subjects,
+		})
+		for _, obj := range objects {
+			doc, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			manifest.WriteString("---\n")
+			manifest.Write(doc)
+		}
+	}
+	return manifest.Bytes(), nil
+}
@@ -0,0 +1,36 @@
+package bootstrap
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+)
+
+// RemoteUserDataPath is where user data is uploaded to on machines, it is marked done by a file next to it once it succeeds
+const RemoteUserDataPath = RemoteScriptsLocation + "user-data"
+
+// LoadUserData reads the user data of file, which has to be an executable script starting with '#!'
+func LoadUserData(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, api.NewValidationError("Cannot read user data %s, err: %s", file, err.Error())
+	}
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return nil, api.NewValidationError("User data %s must be a script starting with '#!', like '#!/bin/bash'", file)
+	}
+	return content, nil
+}
+
+// uploadUserData puts user data on machine for init and join scripts, it may hold tokens of agents so only root reads it
+func (k *kubeadmBootstrapper) uploadUserData(machine *instance.Instance) error {
+	if k.opt.UserData == "" {
+		return nil
+	}
+	content, err := LoadUserData(k.opt.UserData)
+	if err != nil {
+		return err
+	}
+	return k.uploadSecret(machine, content, RemoteUserDataPath)
+}
@@ -0,0 +1,61 @@
+package bootstrap
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"k8s.io/klog"
+)
+
+// UnregisteredError tells machines which joined, yet the apiserver has no node of them
+type UnregisteredError struct {
+	Machines []*instance.Instance
+	// LogDir keeps output of bootstrap scripts of the machines
+	LogDir string
+}
+
+func (u *UnregisteredError) Error() string {
+	machines := make([]string, 0, len(u.Machines))
+	for _, m := range u.Machines {
+		if u.LogDir == "" {
+			machines = append(machines, fmt.Sprintf("%s [%s]", m.ID, m.IP))
+			continue
+		}
+		machines = append(machines, fmt.Sprintf("%s [%s] (logs: %s)", m.ID, m.IP, filepath.Join(u.LogDir, m.ID+"-*.log")))
+	}
+	return fmt.Sprintf("%d machines never registered as nodes: %s", len(u.Machines), strings.Join(machines, ", "))
+}
+
+// VerifyNodes checks every machine is registered as a node in the apiserver, nodes of no machine are only warned,
+// they are added by someone else and do no harm to the cluster
+func (k *kubeadmBootstrapper) VerifyNodes(master *instance.Instance, machines []*instance.Instance) error {
+	names, err := k.nodeNames(master)
+	if err != nil {
+		return err
+	}
+	unregistered := &UnregisteredError{LogDir: k.opt.BootstrapLogDir}
+	known := make(map[string]bool, len(machines))
+	for _, m := range machines {
+		known[m.IP] = true
+		if _, ok := names[m.IP]; !ok {
+			unregistered.Machines = append(unregistered.Machines, m)
+		}
+	}
+	unexpected := make([]string, 0)
+	for ip, name := range names {
+		if !known[ip] {
+			unexpected = append(unexpected, fmt.Sprintf("%s [%s]", name, ip))
+		}
+	}
+	if len(unexpected) != 0 {
+		sort.Strings(unexpected)
+		klog.Warningf("Nodes %s are not machines of the cluster", strings.Join(unexpected, ", "))
+	}
+	if len(unregistered.Machines) != 0 {
+		return unregistered
+	}
+	return nil
+}
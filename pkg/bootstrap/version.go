@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// KubeadmVersion is what kubeadm of a minor version understands, a field is empty if kubeadm cannot do it yet
+type KubeadmVersion struct {
+	// Minor is the first minor version of kubernetes with these flags
+	Minor            int
+	ConfigAPIVersion string
+	// UploadCertsFlag shares certificates of control plane in a secret, so control planes can join by a key
+	UploadCertsFlag  string
+	ControlPlaneFlag string
+	PatchesFlag      string
+	// ControlPlaneEndpoint tells if --control-plane-endpoint is usable
+	ControlPlaneEndpoint bool
+	// ServerSideApply tells if the apiserver applies manifests by itself
+	ServerSideApply bool
+	// WindowsNodes tells if kubeadm joins windows nodes running containerd
+	WindowsNodes bool
+	// DrainEmptyDirFlag lets kubectl drain evict pods with emptyDir volumes
+	DrainEmptyDirFlag string
+}
+
+// kubeadmVersions are sorted by Minor, each one is what changed since the last one
+var kubeadmVersions = []KubeadmVersion{
+	{Minor: 13, ConfigAPIVersion: "kubeadm.k8s.io/v1beta1", ControlPlaneFlag: "--experimental-control-plane", DrainEmptyDirFlag: "--delete-local-data"},
+	{Minor: 14, ConfigAPIVersion: "kubeadm.k8s.io/v1beta1", ControlPlaneFlag: "--experimental-control-plane", UploadCertsFlag: "--experimental-upload-certs", DrainEmptyDirFlag: "--delete-local-data"},
+	{Minor: 15, ConfigAPIVersion: "kubeadm.k8s.io/v1beta2", ControlPlaneFlag: "--control-plane", UploadCertsFlag: "--upload-certs", DrainEmptyDirFlag: "--delete-local-data"},
+	{Minor: 16, ConfigAPIVersion: "kubeadm.k8s.io/v1beta2", ControlPlaneFlag: "--control-plane", UploadCertsFlag: "--upload-certs",
+		ControlPlaneEndpoint: true, ServerSideApply: true, DrainEmptyDirFlag: "--delete-local-data"},
+	{Minor: 19, ConfigAPIVersion: "kubeadm.k8s.io/v1beta2", ControlPlaneFlag: "--control-plane", UploadCertsFlag: "--upload-certs",
+		ControlPlaneEndpoint: true, ServerSideApply: true, PatchesFlag: "--experimental-patches", DrainEmptyDirFlag: "--delete-local-data"},
+	{Minor: 22, ConfigAPIVersion: "kubeadm.k8s.io/v1beta3", ControlPlaneFlag: "--control-plane", UploadCertsFlag: "--upload-certs",
+		ControlPlaneEndpoint: true, ServerSideApply: true, PatchesFlag: "--patches", DrainEmptyDirFlag: "--delete-emptydir-data"},
+	{Minor: 23, ConfigAPIVersion: "kubeadm.k8s.io/v1beta3", ControlPlaneFlag: "--control-plane", UploadCertsFlag: "--upload-certs",
+		ControlPlaneEndpoint: true, ServerSideApply: true, PatchesFlag: "--patches", WindowsNodes: true, DrainEmptyDirFlag: "--delete-emptydir-data"},
+}
+
+// MaxKubeadmMinor is the newest minor version checked against the flags above, newer ones are refused until they are checked
+const MaxKubeadmMinor = 30
+
+// KubeadmFor returns what kubeadm of version like "1.15.5" understands
+func KubeadmFor(version string) (*KubeadmVersion, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return nil, api.NewValidationError("Invalid kubernetes version '%s'", version)
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || major != 1 {
+		return nil, api.NewValidationError("Invalid kubernetes version '%s'", version)
+	}
+	if minor < kubeadmVersions[0].Minor {
+		return nil, api.NewValidationError("Kubernetes %s is too old, the oldest supported is 1.%d", version, kubeadmVersions[0].Minor)
+	}
+	if minor > MaxKubeadmMinor {
+		return nil, api.NewValidationError("Flags of kubeadm %s are unknown to qks, the newest known is 1.%d", version, MaxKubeadmMinor)
+	}
+	result := kubeadmVersions[0]
+	for _, v := range kubeadmVersions {
+		if v.Minor <= minor {
+			result = v
+		}
+	}
+	return &result, nil
+}
+
+// newestKubeadm is used for clusters whose version is not known
+func newestKubeadm() *KubeadmVersion {
+	v := kubeadmVersions[len(kubeadmVersions)-1]
+	return &v
+}
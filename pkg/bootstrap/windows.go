@@ -0,0 +1,159 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+	"k8s.io/klog"
+)
+
+const (
+	// RemoteWindowsScriptsLocation is where scripts are uploaded to on windows nodes
+	RemoteWindowsScriptsLocation = `C:\qks\`
+	CRISocketWindows             = "npipe:////./pipe/containerd-containerd"
+	// WindowsFlannelVersion must match the flannel of linux nodes closely enough to share the vxlan network
+	WindowsFlannelVersion = "v0.25.7"
+)
+
+// SigWindowsToolsRef pins sig-windows-tools, whose master branch changes without notice, images of vmimage pin the same
+const SigWindowsToolsRef = "v0.1.5"
+
+// sigWindowsToolsURL is where manifests of flannel and kube-proxy running as hostprocess pods on windows are
+const sigWindowsToolsURL = "https://raw.githubusercontent.com/kubernetes-sigs/sig-windows-tools/" + SigWindowsToolsRef + "/hostprocess/flannel"
+
+// WindowsManifest is a manifest of sig-windows-tools applied with Placeholder replaced by Value
+type WindowsManifest struct {
+	Name        string
+	URL         string
+	Placeholder string
+	Value       string
+	// SHA256 is what the download has to match before Placeholder is replaced, it is not checked if empty
+	SHA256 string
+}
+
+// WindowsManifests returns manifests applied on master for windows nodes of opt with their checksums in opt,
+// it fails if one has none but opt requires checksums
+func WindowsManifests(opt *api.CreateClusterOption) ([]WindowsManifest, error) {
+	manifests := []WindowsManifest{
+		{Name: "flannel-overlay", URL: sigWindowsToolsURL + "/flanneld/flannel-overlay.yml", Placeholder: "FLANNEL_VERSION", Value: WindowsFlannelVersion},
+		{Name: "kube-proxy", URL: sigWindowsToolsURL + "/kube-proxy/kube-proxy.yml", Placeholder: "KUBE_PROXY_VERSION", Value: "v" + opt.KubernetesVersion},
+	}
+	for i := range manifests {
+		sum, err := ChecksumOf(opt, manifests[i].URL, "")
+		if err != nil {
+			return nil, err
+		}
+		manifests[i].SHA256 = sum
+	}
+	return manifests, nil
+}
+
+// windowsCNIs are CNIs whose manifests qks can extend to windows nodes
+var windowsCNIs = []string{api.FlannelCNI}
+
+// ValidateWindowsNodes checks windows nodes of opt can join the cluster, nothing is checked if there are none
+func ValidateWindowsNodes(opt *api.CreateClusterOption) error {
+	if opt.WindowsNodeCount == 0 {
+		return nil
+	}
+	if opt.WindowsNodeCount < 0 {
+		return api.NewValidationError("Count of windows nodes cannot be negative, got %d", opt.WindowsNodeCount)
+	}
+	supported := false
+	for _, cni := range windowsCNIs {
+		supported = supported || cni == opt.CNIName
+	}
+	if !supported {
+		return api.NewValidationError("CNI %s does not support windows nodes, use one of %v", opt.CNIName, windowsCNIs)
+	}
+	if opt.Arch != "" && opt.Arch != api.ArchAMD64 {
+		return api.NewValidationError("Windows nodes are amd64 only, cannot join a cluster of arch %s", opt.Arch)
+	}
+	kubeadm, err := KubeadmFor(opt.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	if !kubeadm.WindowsNodes || CRISocket(opt.KubernetesVersion) != CRISocketContainerd {
+		return api.NewValidationError("Windows nodes need a newer kubernetes running containerd, got %s", opt.KubernetesVersion)
+	}
+	return nil
+}
+
+// JoinWindowsNodes prepares the network of windows on master, then joins nodes by runner which speaks powershell
+func (k *kubeadmBootstrapper) JoinWindowsNodes(master *instance.Instance, runner ssh.Runner, cmd string, nodes []*instance.Instance) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	manifests, err := WindowsManifests(k.opt)
+	if err != nil {
+		return err
+	}
+	vars := k.scriptVars()
+	vars.WindowsManifests = manifests
+	if output, err := k.runScript(master, WindowsNetworkScript, vars); err != nil {
+		return fmt.Errorf("Failed to prepare network of windows nodes, err: %s, output: %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+	vars.JoinCommand = cmd + " --cri-socket " + CRISocketWindows
+	script, err := RenderScript(WindowsJoinScript, vars)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	joinErr := &JoinError{}
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(n *instance.Instance) {
+			defer wg.Done()
+			if err := k.joinWindowsNode(runner, n, script); err != nil {
+				klog.Errorf("Failed to join windows node %s %s to cluster", n.ID, n.IP)
+				mu.Lock()
+				joinErr.Failed = append(joinErr.Failed, n)
+				joinErr.Errs = append(joinErr.Errs, err)
+				mu.Unlock()
+			} else {
+				klog.Infof("Windows node %s has successfully joined the cluster", n.IP)
+			}
+		}(node)
+	}
+	wg.Wait()
+	if len(joinErr.Failed) != 0 {
+		return joinErr
+	}
+	return nil
+}
+
+func (k *kubeadmBootstrapper) joinWindowsNode(runner ssh.Runner, n *instance.Instance, script []byte) error {
+	remote := RemoteWindowsScriptsLocation + WindowsJoinScript
+	attempt := 0
+	var lastErr error
+	err := retry.Do(k.opt.JoinRetries+1, DefaultJoinRetryInterval, func() error {
+		if attempt > 0 {
+			klog.Warningf("Retry joining windows node %s, attempt %d", n.IP, attempt+1)
+			if output, err := runner.RunAndGetOutput(n.IP, "kubeadm reset -f --cri-socket "+CRISocketWindows); err != nil {
+				klog.Warningf("Failed to reset %s, output: %s", n.IP, string(output))
+			}
+		}
+		attempt++
+		if err := runner.Upload(n.IP, script, remote, 0755); err != nil {
+			lastErr = err
+			return err
+		}
+		output, err := runner.RunAndGetOutput(n.IP, "& '"+remote+"'")
+		k.saveLog(n, WindowsJoinScript, output)
+		if err != nil {
+			err = fmt.Errorf("%s, output: %s", err.Error(), strings.TrimSpace(string(output)))
+		}
+		lastErr = err
+		return err
+	})
+	if err != nil {
+		return lastErr
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is short enough that status read by one command is never stale for the next one, polls which may run
+// more often invalidate caches of services by Invalidate instead
+const DefaultTTL = time.Second * 10
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache keeps results of describe calls for a short time, services invalidate it after mutations
+type Cache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	items map[string]entry
+}
+
+// New returns a cache keeping values for ttl, zero ttl disables caching
+func New(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:   ttl,
+		items: make(map[string]entry),
+	}
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.expires) {
+		delete(c.items, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = entry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate drops everything, mutations call it as they may change any cached result
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]entry)
+}
+
+// Invalidate drops the caches of services wrapped by WithCache, so the next reads see what others changed. Services
+// without a cache are skipped.
+func Invalidate(services ...interface{}) {
+	for _, s := range services {
+		if c, ok := s.(interface{ Invalidate() }); ok {
+			c.Invalidate()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cache_test
+
+import (
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	instancefake "github.com/magicsong/yunify-k8s/pkg/instance/fake"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	tagfake "github.com/magicsong/yunify-k8s/pkg/tag/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	It("Should expire values and drop all on invalidation", func() {
+		c := cache.New(time.Millisecond * 50)
+		c.Set("a", 1)
+		c.Set("b", 2)
+		v, ok := c.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(1))
+		c.Invalidate()
+		_, ok = c.Get("b")
+		Expect(ok).To(BeFalse())
+		c.Set("a", 1)
+		time.Sleep(time.Millisecond * 60)
+		_, ok = c.Get("a")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should not cache with zero ttl", func() {
+		c := cache.New(0)
+		c.Set("a", 1)
+		_, ok := c.Get("a")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should cache tags until a mutation", func() {
+		fake := tagfake.NewTagService()
+		tags := tag.WithCache(fake, time.Minute)
+		t, err := tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t).To(BeNil())
+		tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(fake.CallsOf("GetTagClusterByName")).To(HaveLen(1))
+		id, err := tags.CreateTag("K8S-Cluster-test", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		t, _ = tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(t.TagID).To(Equal(id))
+		Expect(tags.TagInstances(id, []string{"i-1"})).ShouldNot(HaveOccurred())
+		t, _ = tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(t.Instances).To(Equal([]string{"i-1"}))
+		t.Instances[0] = "changed"
+		t, _ = tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(t.Instances).To(Equal([]string{"i-1"}))
+		Expect(fake.CallsOf("GetTagClusterByName")).To(HaveLen(3))
+	})
+
+	It("Should cache instances until a mutation", func() {
+		fake := instancefake.NewInstanceService()
+		instances := instance.WithCache(fake, time.Minute)
+		created, err := instances.CreateInstances(&instance.CreateInstancesOption{Name: "test", Count: 1})
+		Expect(err).ShouldNot(HaveOccurred())
+		ins, _ := instances.GetInstance(created[0].ID)
+		instances.GetInstance(created[0].ID)
+		Expect(fake.CallsOf("GetInstance")).To(HaveLen(1))
+		Expect(instances.RenameInstance(ins.ID, "renamed")).ShouldNot(HaveOccurred())
+		ins, _ = instances.GetInstance(created[0].ID)
+		Expect(ins.Name).To(Equal("renamed"))
+		Expect(fake.CallsOf("GetInstance")).To(HaveLen(2))
+	})
+
+	It("Should drop caches of services for polls and skip services without one", func() {
+		fakeInstances, fakeTags := instancefake.NewInstanceService(), tagfake.NewTagService()
+		instances, tags := instance.WithCache(fakeInstances, time.Minute), tag.WithCache(fakeTags, time.Minute)
+		created, err := instances.CreateInstances(&instance.CreateInstancesOption{Name: "test", Count: 1})
+		Expect(err).ShouldNot(HaveOccurred())
+		instances.GetInstance(created[0].ID)
+		tags.GetTagClusterByName("K8S-Cluster-test")
+		cache.Invalidate(instances, tags, fakeInstances)
+		instances.GetInstance(created[0].ID)
+		tags.GetTagClusterByName("K8S-Cluster-test")
+		Expect(fakeInstances.CallsOf("GetInstance")).To(HaveLen(2))
+		Expect(fakeTags.CallsOf("GetTagClusterByName")).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,226 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/log"
+)
+
+// volatileParams change in every request of the same call, they are left out of recordings
+var volatileParams = []string{"access_key_id", "signature", "signature_method", "signature_version", "time_stamp", "expires"}
+
+// Interaction is a request to qingcloud and its response, secrets of both are redacted
+type Interaction struct {
+	Action   string     `json:"action"`
+	Params   url.Values `json:"params"`
+	Status   int        `json:"status"`
+	Response string     `json:"response"`
+}
+
+var (
+	recordWriter io.Writer
+	replayer     *replayTransport
+)
+
+// ConfigureRecord makes every exchange with qingcloud recorded in the file, which is truncated first.
+// Empty path disables it.
+func ConfigureRecord(path string) error {
+	if path == "" {
+		recordWriter = nil
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to open api recording %s, err: %s", path, err.Error())
+	}
+	recordWriter = f
+	return nil
+}
+
+// ConfigureReplay makes requests to qingcloud answered by the recording in the file instead, empty path disables it
+func ConfigureReplay(path string) error {
+	if path == "" {
+		replayer = nil
+		return nil
+	}
+	r, err := newReplayTransport(path)
+	if err != nil {
+		return err
+	}
+	replayer = r
+	return nil
+}
+
+// Replaying tells if requests are answered by a recording, so no credentials of qingcloud are needed
+func Replaying() bool {
+	return replayer != nil
+}
+
+// WrapTransport records through or replaces the transport if recording or replaying is configured
+func WrapTransport(next http.RoundTripper) http.RoundTripper {
+	if replayer != nil {
+		return replayer
+	}
+	if recordWriter != nil {
+		return NewRecordTransport(next, recordWriter)
+	}
+	return next
+}
+
+// interactionOf returns the interaction of req without its response, the params are what replaying matches
+func interactionOf(req *http.Request, body []byte) (*Interaction, error) {
+	params, err := url.ParseQuery(log.RedactForm(req.URL.RawQuery))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		form, err := url.ParseQuery(log.RedactForm(string(body)))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range form {
+			params[k] = v
+		}
+	}
+	for _, p := range volatileParams {
+		params.Del(p)
+	}
+	return &Interaction{Action: params.Get("action"), Params: params}, nil
+}
+
+func readBody(req *http.Request) []byte {
+	if req.Body == nil {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+type recordTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewRecordTransport writes every exchange through next to w as a line of json
+func NewRecordTransport(next http.RoundTripper, w io.Writer) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordTransport{next: next, w: w}
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := readBody(req)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		// failures of the network cannot be replayed
+		return resp, err
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	i, err := interactionOf(req, body)
+	if err != nil {
+		return resp, nil
+	}
+	i.Status = resp.StatusCode
+	i.Response = log.RedactJSON(respBody)
+	line, err := json.Marshal(i)
+	if err != nil {
+		return resp, nil
+	}
+	t.mu.Lock()
+	t.w.Write(append(line, '\n'))
+	t.mu.Unlock()
+	return resp, nil
+}
+
+type replayTransport struct {
+	path string
+	mu   sync.Mutex
+	// recorded are queues of interactions by their keys, the same call is answered in the order it was recorded
+	recorded map[string][]*Interaction
+}
+
+// NewReplayTransport answers requests by interactions recorded in path. Once the recordings of a call are used up,
+// the last one answers it again, as polling may take more rounds than when it was recorded.
+func NewReplayTransport(path string) (http.RoundTripper, error) {
+	t, err := newReplayTransport(path)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newReplayTransport(path string) (*replayTransport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open api recording %s, err: %s", path, err.Error())
+	}
+	defer f.Close()
+	t := &replayTransport{path: path, recorded: make(map[string][]*Interaction)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		i := &Interaction{}
+		if err := json.Unmarshal(scanner.Bytes(), i); err != nil {
+			return nil, fmt.Errorf("Invalid interaction at line %d of %s, err: %s", n, path, err.Error())
+		}
+		key := keyOf(i)
+		t.recorded[key] = append(t.recorded[key], i)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func keyOf(i *Interaction) string {
+	return i.Action + "?" + i.Params.Encode()
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	want, err := interactionOf(req, readBody(req))
+	if err != nil {
+		return nil, err
+	}
+	key := keyOf(want)
+	t.mu.Lock()
+	queue := t.recorded[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("No response of %s with %s is recorded in %s", want.Action, want.Params.Encode(), t.path)
+	}
+	got := queue[0]
+	if len(queue) > 1 {
+		t.recorded[key] = queue[1:]
+	}
+	t.mu.Unlock()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", got.Status, http.StatusText(got.Status)),
+		StatusCode:    got.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(got.Response)),
+		ContentLength: int64(len(got.Response)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package cassette_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/cassette"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/yunify/qingcloud-sdk-go/service"
+)
+
+var _ = Describe("Cassette", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "qks-cassette")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cassette.ConfigureRecord("")
+		cassette.ConfigureReplay("")
+		os.RemoveAll(dir)
+	})
+
+	It("Should replay sanitized exchanges recorded with qingcloud without credentials", func() {
+		polls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the sdk decodes json responses only
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Query().Get("action") {
+			case "DescribeAccessKeys":
+				fmt.Fprint(w, `{"action":"DescribeAccessKeysResponse","ret_code":0,"total_count":1,"access_key_set":[{"access_key_id":"AKID","owner":"usr-test","secret_access_key":"s3cr3t"}]}`)
+			case "DescribeTags":
+				polls++
+				fmt.Fprintf(w, `{"action":"DescribeTagsResponse","ret_code":0,"total_count":1,"tag_set":[{"tag_id":"tag-%d","tag_name":"k8s-test"}]}`, polls)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+		recording := filepath.Join(dir, "api.jsonl")
+		tagsOf := func(helper *accesskey.QingCloudAccessKeyHelper, zone string) (string, error) {
+			tags, _ := helper.GetService().Tag(zone)
+			output, err := tags.DescribeTags(&service.DescribeTagsInput{SearchWord: service.String("k8s-test")})
+			if err != nil {
+				return "", err
+			}
+			return *output.TagSet[0].TagID, nil
+		}
+
+		Expect(cassette.ConfigureRecord(recording)).To(Succeed())
+		helper := accesskey.NewQingCloudAccessKeyHelper("ap2a", filepath.Join(dir, "config.yaml"))
+		helper.Endpoint = server.URL + "/iaas"
+		helper.Credentials = &accesskey.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}
+		Expect(helper.Init()).To(Succeed())
+		for _, want := range []string{"tag-1", "tag-2"} {
+			Expect(tagsOf(helper, "ap2a")).To(Equal(want))
+		}
+		content, err := ioutil.ReadFile(recording)
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, secret := range []string{"AKID", "SECRET", "s3cr3t", "signature", "time_stamp"} {
+			Expect(string(content)).NotTo(ContainSubstring(secret))
+		}
+		Expect(cassette.ConfigureRecord("")).To(Succeed())
+
+		Expect(cassette.ConfigureReplay(recording)).To(Succeed())
+		Expect(cassette.Replaying()).To(BeTrue())
+		server.Close()
+		helper = accesskey.NewQingCloudAccessKeyHelper("ap2a", filepath.Join(dir, "config.yaml"))
+		helper.Endpoint = server.URL + "/iaas"
+		Expect(helper.Init()).To(Succeed())
+		Expect(helper.GetUserID()).To(Equal("usr-test"))
+		// the last recording of a call answers it once the others are used up
+		for _, want := range []string{"tag-1", "tag-2", "tag-2"} {
+			Expect(tagsOf(helper, "ap2a")).To(Equal(want))
+		}
+		_, err = tagsOf(helper, "pek3")
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("No response of DescribeTags"))
+	})
+})
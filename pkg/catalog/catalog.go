@@ -0,0 +1,121 @@
+package catalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"gopkg.in/yaml.v2"
+)
+
+// Template is a named set of cluster options, values given on the command line override it
+type Template struct {
+	Name        string                  `yaml:"-"`
+	Description string                  `yaml:"description,omitempty"`
+	Cluster     api.CreateClusterOption `yaml:"cluster,omitempty"`
+	// Builtin is false for templates read from the config directory
+	Builtin bool `yaml:"-"`
+}
+
+var builtins = map[string]string{
+	"dev-small": `
+description: one small node for development, kubeconfig copied to local
+cluster:
+  kubernetesVersion: 1.15.5
+  nodeCount: 1
+  masterInstanceType: c2m4
+  nodeInstanceType: c2m4
+  scpKubeConfigToLocal: true
+  networkOption:
+    cniName: calico
+    podNetWorkCIDR: 10.233.0.0/16
+`,
+	"prod-ha": `
+description: three enterprise nodes, protected from deletion which also needs the cluster name typed
+cluster:
+  kubernetesVersion: 1.15.5
+  nodeCount: 3
+  masterInstanceType: enterprise-general
+  nodeInstanceType: enterprise-general
+  protect: true
+  confirmDeleteByName: true
+  joinRetries: 3
+  networkOption:
+    cniName: calico
+    podNetWorkCIDR: 10.233.0.0/16
+`,
+}
+
+// Dir is where users put their own templates as <name>.yaml, they shadow builtin ones of the same name
+func Dir() string {
+	return filepath.Join(api.ConfigDir(), "templates")
+}
+
+func parse(name string, content []byte, builtin bool) (*Template, error) {
+	t := &Template{Name: name, Builtin: builtin}
+	if err := yaml.UnmarshalStrict(content, t); err != nil {
+		return nil, api.NewValidationError("Invalid template %s, err: %s", name, err.Error())
+	}
+	return t, nil
+}
+
+// Get returns the template of name from the config directory or builtin ones
+func Get(name string) (*Template, error) {
+	content, err := ioutil.ReadFile(filepath.Join(Dir(), name+".yaml"))
+	if err == nil {
+		return parse(name, content, false)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if b, ok := builtins[name]; ok {
+		return parse(name, []byte(b), true)
+	}
+	return nil, api.NewValidationError("Template %s is not found, available templates: %s", name, strings.Join(names(), ", "))
+}
+
+// List returns all templates sorted by name
+func List() ([]*Template, error) {
+	result := make([]*Template, 0)
+	for _, name := range names() {
+		t, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func names() []string {
+	set := make(map[string]bool)
+	for name := range builtins {
+		set[name] = true
+	}
+	files, _ := filepath.Glob(filepath.Join(Dir(), "*.yaml"))
+	for _, f := range files {
+		set[strings.TrimSuffix(filepath.Base(f), ".yaml")] = true
+	}
+	result := make([]string, 0, len(set))
+	for name := range set {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Apply sets options given by the template, others are kept
+func (t *Template) Apply(opt *api.CreateClusterOption) error {
+	content, err := yaml.Marshal(&t.Cluster)
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(content, opt); err != nil {
+		return fmt.Errorf("Failed to apply template %s, err: %s", t.Name, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package catalog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/catalog"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalog", func() {
+	var home, oldHome string
+
+	BeforeEach(func() {
+		var err error
+		home, err = ioutil.TempDir("", "qks-home")
+		Expect(err).ShouldNot(HaveOccurred())
+		oldHome = os.Getenv("HOME")
+		os.Setenv("HOME", home)
+	})
+
+	AfterEach(func() {
+		os.Setenv("HOME", oldHome)
+		os.RemoveAll(home)
+	})
+
+	It("Should apply a builtin template and keep other options", func() {
+		t, err := catalog.Get("prod-ha")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t.Builtin).To(BeTrue())
+		opt := &api.CreateClusterOption{NodeCount: 2, VxNet: "vxnet-1", KubeadmInitExtraFlags: []string{"--v=5"}}
+		Expect(t.Apply(opt)).ShouldNot(HaveOccurred())
+		Expect(opt.NodeCount).To(Equal(3))
+		Expect(opt.Protect).To(BeTrue())
+		Expect(opt.CNIName).To(Equal(api.CalicoCNI))
+		Expect(opt.VxNet).To(Equal("vxnet-1"))
+		Expect(opt.KubeadmInitExtraFlags).To(Equal([]string{"--v=5"}))
+	})
+
+	It("Should prefer templates of users and list all", func() {
+		Expect(os.MkdirAll(catalog.Dir(), 0755)).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(catalog.Dir(), "dev-small.yaml"), []byte("description: mine\ncluster:\n  nodeCount: 5\n"), 0644)).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(catalog.Dir(), "bad.yaml"), []byte("cluster:\n  unknown: 1\n"), 0644)).ShouldNot(HaveOccurred())
+		t, err := catalog.Get("dev-small")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t.Builtin).To(BeFalse())
+		Expect(t.Cluster.NodeCount).To(Equal(5))
+		_, err = catalog.Get("bad")
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		_, err = catalog.Get("missing")
+		Expect(err).To(MatchError(ContainSubstring("dev-small, prod-ha")))
+		Expect(os.Remove(filepath.Join(catalog.Dir(), "bad.yaml"))).ShouldNot(HaveOccurred())
+		templates, err := catalog.List()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(templates).To(HaveLen(2))
+	})
+})
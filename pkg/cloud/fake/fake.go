@@ -0,0 +1,111 @@
+package fake
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	billingfake "github.com/magicsong/yunify-k8s/pkg/billing/fake"
+	"github.com/magicsong/yunify-k8s/pkg/cloud"
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	consolefake "github.com/magicsong/yunify-k8s/pkg/console/fake"
+	"github.com/magicsong/yunify-k8s/pkg/eip"
+	eipfake "github.com/magicsong/yunify-k8s/pkg/eip/fake"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	imagefake "github.com/magicsong/yunify-k8s/pkg/image/fake"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	instancefake "github.com/magicsong/yunify-k8s/pkg/instance/fake"
+	"github.com/magicsong/yunify-k8s/pkg/resourcegroup"
+	resourcegroupfake "github.com/magicsong/yunify-k8s/pkg/resourcegroup/fake"
+	"github.com/magicsong/yunify-k8s/pkg/securitygroup"
+	securitygroupfake "github.com/magicsong/yunify-k8s/pkg/securitygroup/fake"
+	"github.com/magicsong/yunify-k8s/pkg/sshkey"
+	sshkeyfake "github.com/magicsong/yunify-k8s/pkg/sshkey/fake"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	tagfake "github.com/magicsong/yunify-k8s/pkg/tag/fake"
+	"github.com/magicsong/yunify-k8s/pkg/volume"
+	volumefake "github.com/magicsong/yunify-k8s/pkg/volume/fake"
+)
+
+const UserID = "usr-fake"
+
+var _ cloud.Provider = &Provider{}
+
+// Provider keeps everything in memory, the fakes are exported so tests can inspect and tweak them
+type Provider struct {
+	InstanceService      *instancefake.InstanceService
+	KeyPairService       *sshkeyfake.KeyPairService
+	TagService           *tagfake.TagService
+	ImageService         *imagefake.ImageService
+	EIPService           *eipfake.EIPService
+	VolumeService        *volumefake.VolumeService
+	ResourceGroupService *resourcegroupfake.ResourceGroupService
+	SecurityGroupService *securitygroupfake.SecurityGroupService
+	ConsoleService       *consolefake.ConsoleService
+	BillingService       *billingfake.BillingService
+}
+
+// NewProvider returns a provider where all preset images are available
+func NewProvider() *Provider {
+	p := &Provider{
+		InstanceService:      instancefake.NewInstanceService(),
+		KeyPairService:       sshkeyfake.NewKeyPairService(),
+		TagService:           tagfake.NewTagService(),
+		ImageService:         imagefake.NewImageService(),
+		EIPService:           eipfake.NewEIPService(),
+		VolumeService:        volumefake.NewVolumeService(),
+		ResourceGroupService: resourcegroupfake.NewResourceGroupService(),
+		SecurityGroupService: securitygroupfake.NewSecurityGroupService(),
+		ConsoleService:       consolefake.NewConsoleService(),
+		BillingService:       billingfake.NewBillingService(),
+	}
+	for _, preset := range api.PresetKubernetes {
+		for _, images := range preset.Zones {
+			p.ImageService.SetStatus(images.MasterImageID, image.StatusAvailable)
+			p.ImageService.SetStatus(images.NodeImageID, image.StatusAvailable)
+		}
+	}
+	return p
+}
+
+func (p *Provider) Instances() instance.Interface {
+	return p.InstanceService
+}
+
+func (p *Provider) KeyPairs() sshkey.Interface {
+	return p.KeyPairService
+}
+
+func (p *Provider) Tags() tag.Interface {
+	return p.TagService
+}
+
+func (p *Provider) Images() image.Interface {
+	return p.ImageService
+}
+
+func (p *Provider) EIPs() eip.Interface {
+	return p.EIPService
+}
+
+func (p *Provider) Volumes() volume.Interface {
+	return p.VolumeService
+}
+
+func (p *Provider) ResourceGroups() resourcegroup.Interface {
+	return p.ResourceGroupService
+}
+
+func (p *Provider) SecurityGroups() securitygroup.Interface {
+	return p.SecurityGroupService
+}
+
+func (p *Provider) Consoles() console.Interface {
+	return p.ConsoleService
+}
+
+func (p *Provider) Billing() billing.Interface {
+	return p.BillingService
+}
+
+func (p *Provider) UserID() string {
+	return UserID
+}
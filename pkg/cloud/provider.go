@@ -0,0 +1,31 @@
+package cloud
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	"github.com/magicsong/yunify-k8s/pkg/eip"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/resourcegroup"
+	"github.com/magicsong/yunify-k8s/pkg/securitygroup"
+	"github.com/magicsong/yunify-k8s/pkg/sshkey"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"github.com/magicsong/yunify-k8s/pkg/volume"
+)
+
+// Provider gives all services the orchestration needs from a cloud, so backends can be swapped without touching it
+type Provider interface {
+	Instances() instance.Interface
+	KeyPairs() sshkey.Interface
+	Tags() tag.Interface
+	Images() image.Interface
+	EIPs() eip.Interface
+	Volumes() volume.Interface
+	ResourceGroups() resourcegroup.Interface
+	SecurityGroups() securitygroup.Interface
+	// Consoles give console output of instances which cannot be reached by ssh
+	Consoles() console.Interface
+	Billing() billing.Interface
+	// UserID is the account owning the created resources
+	UserID() string
+}
@@ -0,0 +1,103 @@
+package cloud
+
+import (
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/billing"
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	"github.com/magicsong/yunify-k8s/pkg/eip"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	"github.com/magicsong/yunify-k8s/pkg/resourcegroup"
+	"github.com/magicsong/yunify-k8s/pkg/securitygroup"
+	"github.com/magicsong/yunify-k8s/pkg/sshkey"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+	"github.com/magicsong/yunify-k8s/pkg/volume"
+)
+
+type qingcloudProvider struct {
+	userID         string
+	instances      instance.Interface
+	keyPairs       sshkey.Interface
+	tags           tag.Interface
+	images         image.Interface
+	eips           eip.Interface
+	volumes        volume.Interface
+	resourceGroups resourcegroup.Interface
+	securityGroups securitygroup.Interface
+	consoles       console.Interface
+	billing        billing.Interface
+}
+
+// NewQingCloudProvider creates services of zone from an initialized access key, their calls are traced in scope
+func NewQingCloudProvider(keyHelper *accesskey.QingCloudAccessKeyHelper, zone string, scope *trace.Scope) Provider {
+	userid := keyHelper.GetUserID()
+	qcService := keyHelper.GetService()
+	instanceService, _ := qcService.Instance(zone)
+	jobService, _ := qcService.Job(zone)
+	keyService, _ := qcService.KeyPair(zone)
+	tagService, _ := qcService.Tag(zone)
+	eipService, _ := qcService.EIP(zone)
+	volumeService, _ := qcService.Volume(zone)
+	imageSerivice, _ := qcService.Image(zone)
+	securityGroupService, _ := qcService.SecurityGroup(zone)
+	snapshotService, _ := qcService.Snapshot(zone)
+	return &qingcloudProvider{
+		userID:         userid,
+		instances:      instance.WithCache(instance.WithTracing(instance.NewQingCloudInstanceService(instanceService, jobService), scope), cache.DefaultTTL),
+		keyPairs:       sshkey.WithTracing(sshkey.NewQingCloudKeyPairService(keyService, userid), scope),
+		tags:           tag.WithCache(tag.WithTracing(tag.NewQingCloudTagService(tagService, userid), scope), cache.DefaultTTL),
+		eips:           eip.WithTracing(eip.NewQingCloudEIPService(eipService, jobService), scope),
+		volumes:        volume.WithTracing(volume.NewQingCloudVolumeService(volumeService, jobService), scope),
+		resourceGroups: resourcegroup.WithTracing(resourcegroup.NewQingCloudResourceGroupService(keyHelper.GetConfig(), zone), scope),
+		securityGroups: securitygroup.WithTracing(securitygroup.NewQingCloudSecurityGroupService(securityGroupService), scope),
+		consoles:       console.WithTracing(console.NewQingCloudConsoleService(), scope),
+		billing:        billing.WithTracing(billing.NewQingCloudBillingService(keyHelper.GetConfig(), zone), scope),
+		images:         image.NewQingCloudImageService(instanceService, jobService, imageSerivice, snapshotService, userid),
+	}
+}
+
+func (q *qingcloudProvider) Instances() instance.Interface {
+	return q.instances
+}
+
+func (q *qingcloudProvider) KeyPairs() sshkey.Interface {
+	return q.keyPairs
+}
+
+func (q *qingcloudProvider) Tags() tag.Interface {
+	return q.tags
+}
+
+func (q *qingcloudProvider) Images() image.Interface {
+	return q.images
+}
+
+func (q *qingcloudProvider) EIPs() eip.Interface {
+	return q.eips
+}
+
+func (q *qingcloudProvider) Volumes() volume.Interface {
+	return q.volumes
+}
+
+func (q *qingcloudProvider) ResourceGroups() resourcegroup.Interface {
+	return q.resourceGroups
+}
+
+func (q *qingcloudProvider) SecurityGroups() securitygroup.Interface {
+	return q.securityGroups
+}
+
+func (q *qingcloudProvider) Consoles() console.Interface {
+	return q.consoles
+}
+
+func (q *qingcloudProvider) Billing() billing.Interface {
+	return q.billing
+}
+
+func (q *qingcloudProvider) UserID() string {
+	return q.userID
+}
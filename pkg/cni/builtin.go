@@ -0,0 +1,81 @@
+package cni
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// builtin is a CNI whose kubeadm needs nothing but the pod cidr
+type builtin struct {
+	name     string
+	prefix   string
+	releases []Release
+	// filter is a sed script with %s for the pod cidr
+	filter string
+}
+
+func (b *builtin) Name() string            { return b.name }
+func (b *builtin) Releases() []Release     { return b.releases }
+func (b *builtin) DaemonSetPrefix() string { return b.prefix }
+
+func (b *builtin) KubeadmArgs(opt api.NetworkOption) []string {
+	return []string{"--pod-network-cidr=" + opt.PodNetWorkCIDR}
+}
+
+func (b *builtin) PodCIDRFilter(cidr string) string {
+	return fmt.Sprintf(b.filter, cidr)
+}
+
+// releases bundled in images are what vmimage/<minor>/master/master-run.sh downloads, keep them in step
+func init() {
+	Register(&builtin{
+		name:   api.CalicoCNI,
+		prefix: "calico-node",
+		// the pool cidr is commented out in manifests of calico, it is detected from kubeadm otherwise
+		filter: `s?# - name: CALICO_IPV4POOL_CIDR?- name: CALICO_IPV4POOL_CIDR?; s?#   value: "192.168.0.0/16"?  value: "%s"?`,
+		releases: []Release{
+			{
+				Version:       "v3.29.1",
+				MinKubernetes: "1.29",
+				MaxKubernetes: "1.31",
+				Modes:         []string{"k8s"},
+				ManifestURL:   "https://raw.githubusercontent.com/projectcalico/calico/v3.29.1/manifests/calico.yaml",
+				DaemonSets:    []DaemonSet{{Namespace: "kube-system", Name: "calico-node"}},
+			},
+			{
+				Version:       "v3.28.2",
+				MinKubernetes: "1.27",
+				MaxKubernetes: "1.30",
+				Modes:         []string{"k8s"},
+				BundledIn:     "1.30",
+				DaemonSets:    []DaemonSet{{Namespace: "kube-system", Name: "calico-node"}},
+			},
+			{Version: "v3.8.1", MinKubernetes: "1.13", MaxKubernetes: "1.15", Modes: []string{"k8s", "etcd"}, BundledIn: "1.15"},
+			{Version: "v3.3.2", MinKubernetes: "1.10", MaxKubernetes: "1.12", BundledIn: "1.13"},
+		},
+	})
+	Register(&builtin{
+		name:   api.FlannelCNI,
+		prefix: "kube-flannel-ds",
+		filter: `s?10.244.0.0/16?%s?g`,
+		// the flannel manifest of 1.13 images is saved as kube-flannel.yml, which their cni.sh does not look for
+		releases: []Release{
+			{
+				Version:       "v0.26.1",
+				MinKubernetes: "1.20",
+				ManifestURL:   "https://github.com/flannel-io/flannel/releases/download/v0.26.1/kube-flannel.yml",
+				DaemonSets:    []DaemonSet{{Namespace: "kube-flannel", Name: "kube-flannel-ds"}},
+			},
+			{
+				Version:       "v0.25.7",
+				MinKubernetes: "1.20",
+				BundledIn:     "1.30",
+				DaemonSets:    []DaemonSet{{Namespace: "kube-flannel", Name: "kube-flannel-ds"}},
+			},
+			{Version: "v0.11.0", BundledIn: "1.15"},
+		},
+	})
+	// hostnic is installed by qingcloud outside of qks, it is known so clusters running it can be discovered
+	Register(&builtin{name: api.HostnicCNI, prefix: "hostnic-node"})
+}
@@ -0,0 +1,211 @@
+// Package cni is the catalog of CNIs qks can install, a new CNI is added by registering a Provider
+package cni
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"k8s.io/klog"
+)
+
+// DaemonSet runs a CNI on every node
+type DaemonSet struct {
+	Namespace string
+	Name      string
+}
+
+// Release is a version of a CNI qks knows how to apply
+type Release struct {
+	Version string
+	// MinKubernetes and MaxKubernetes are the minors the release is tested with by its project, empty if unknown
+	MinKubernetes string
+	MaxKubernetes string
+	// Modes are what the release accepts as NetworkOption.Mode, any mode is passed on if empty
+	Modes []string
+	// BundledIn is the minor of kubernetes whose master images have the release in /root/CNI,
+	// such releases are applied by the cni script of the images
+	BundledIn string
+	// ManifestURL is downloaded and applied by kubectl if the release is not bundled
+	ManifestURL string
+	// ManifestSHA256 is what the manifest of ManifestURL has to match, empty if qks has not recorded it
+	ManifestSHA256 string
+	// DaemonSets are waited for after the release is applied, cni scripts of old images wait themselves
+	DaemonSets []DaemonSet
+}
+
+// Supports tells if the release is tested with version, an unknown bound is taken as supported
+func (r *Release) Supports(version string) bool {
+	minor := Minor(version)
+	return !(r.MinKubernetes != "" && lessMinor(minor, r.MinKubernetes)) && !(r.MaxKubernetes != "" && lessMinor(r.MaxKubernetes, minor))
+}
+
+// Provider is a CNI, it tells kubeadm what the CNI needs and how manifests of its releases are applied
+type Provider interface {
+	Name() string
+	// Releases are the known versions, newest first
+	Releases() []Release
+	// KubeadmArgs are flags of kubeadm init the CNI needs
+	KubeadmArgs(opt api.NetworkOption) []string
+	// PodCIDRFilter is a sed script putting cidr into manifests downloaded from ManifestURL
+	PodCIDRFilter(cidr string) string
+	// DaemonSetPrefix is the name prefix of daemonsets in kube-system which tell a cluster runs the CNI
+	DaemonSetPrefix() string
+}
+
+var catalog = map[string]Provider{}
+
+// Register adds p to the catalog, a provider of the same name is replaced
+func Register(p Provider) {
+	catalog[p.Name()] = p
+}
+
+// Names returns names of registered CNIs in order
+func Names() []string {
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the provider of name
+func Get(name string) (Provider, error) {
+	p, ok := catalog[name]
+	if !ok {
+		return nil, api.NewValidationError("CNI plugin %s is not supported right now, use one of %s", name, strings.Join(Names(), ", "))
+	}
+	return p, nil
+}
+
+// Discover returns the CNI running a daemonset of name, empty if there is none
+func Discover(daemonSet string) string {
+	for _, name := range Names() {
+		if strings.HasPrefix(daemonSet, catalog[name].DaemonSetPrefix()) {
+			return name
+		}
+	}
+	return ""
+}
+
+// ReleaseFor picks the release of p applied to kubernetes version, pinned to a version if it is not empty.
+// Without a pin, the release bundled in images of the version wins over downloaded ones.
+// It returns nil if images of the version are unknown, their cni script is run as it is then.
+func ReleaseFor(p Provider, version, pinned string) (*Release, error) {
+	releases := p.Releases()
+	minor := Minor(version)
+	if pinned != "" {
+		for i := range releases {
+			r := &releases[i]
+			if r.Version != pinned {
+				continue
+			}
+			if r.BundledIn != minor && r.ManifestURL == "" {
+				return nil, api.NewValidationError("%s %s is only bundled in images of kubernetes %s", p.Name(), pinned, r.BundledIn)
+			}
+			return r, nil
+		}
+		versions := make([]string, 0, len(releases))
+		for _, r := range releases {
+			versions = append(versions, r.Version)
+		}
+		return nil, api.NewValidationError("%s %s is unknown to qks, known versions: %s", p.Name(), pinned, strings.Join(versions, ", "))
+	}
+	known := false
+	for _, provider := range catalog {
+		for _, r := range provider.Releases() {
+			known = known || r.BundledIn == minor
+		}
+	}
+	for i := range releases {
+		if releases[i].BundledIn == minor {
+			return &releases[i], nil
+		}
+	}
+	if !known {
+		return nil, nil
+	}
+	for i := range releases {
+		if releases[i].ManifestURL != "" && releases[i].Supports(version) {
+			return &releases[i], nil
+		}
+	}
+	return nil, api.NewValidationError("CNI %s is not bundled in images of kubernetes %s, use one of %s", p.Name(), version, strings.Join(bundledIn(minor), ", "))
+}
+
+// Validate rejects CNIs and modes which cannot be applied to the kubernetes version of opt, and warns about
+// a release which is not tested with the version, instead of seeing the CNI crash after install
+func Validate(opt *api.CreateClusterOption) error {
+	// a missing CNI is rejected when the kubeadm init command is generated
+	if opt.CNIName == "" {
+		return nil
+	}
+	p, err := Get(opt.CNIName)
+	if err != nil {
+		return err
+	}
+	release, err := ReleaseFor(p, opt.KubernetesVersion, opt.CNIVersion)
+	if err != nil {
+		return err
+	}
+	if release == nil {
+		klog.Warningf("CNIs in images of kubernetes %s are unknown, %s may not be bundled", opt.KubernetesVersion, opt.CNIName)
+		return nil
+	}
+	if opt.Mode != "" && len(release.Modes) > 0 {
+		supported := false
+		for _, m := range release.Modes {
+			supported = supported || m == opt.Mode
+		}
+		if !supported {
+			return api.NewValidationError("Mode %s of %s %s is not supported, use one of %s", opt.Mode, p.Name(), release.Version, strings.Join(release.Modes, ", "))
+		}
+	}
+	if !release.Supports(opt.KubernetesVersion) {
+		klog.Warningf("%s %s is tested with kubernetes %s to %s, not %s", p.Name(), release.Version, orUnknown(release.MinKubernetes), orUnknown(release.MaxKubernetes), opt.KubernetesVersion)
+	}
+	return nil
+}
+
+// bundledIn returns CNIs bundled in images of minor
+func bundledIn(minor string) []string {
+	names := make([]string, 0)
+	for _, name := range Names() {
+		for _, r := range catalog[name].Releases() {
+			if r.BundledIn == minor {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// Minor returns major.minor of version, like 1.15 of 1.15.5
+func Minor(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// lessMinor compares minors like 1.9 and 1.13 by numbers
+func lessMinor(a, b string) bool {
+	pb := strings.SplitN(b, ".", 2)
+	major, _ := strconv.Atoi(pb[0])
+	minor := 0
+	if len(pb) == 2 {
+		minor, _ = strconv.Atoi(pb[1])
+	}
+	return !api.VersionAtLeast(a, major, minor)
+}
+
+func orUnknown(minor string) string {
+	if minor == "" {
+		return "?"
+	}
+	return minor
+}
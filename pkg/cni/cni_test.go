@@ -0,0 +1,61 @@
+package cni_test
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/cni"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CNI", func() {
+	It("Should check CNIs against what images of the kubernetes version bundle", func() {
+		opt := &api.CreateClusterOption{
+			KubernetesVersion: "1.30.5",
+			NetworkOption:     api.NetworkOption{CNIName: api.CalicoCNI, Mode: "k8s"},
+		}
+		Expect(cni.Validate(opt)).To(Succeed())
+		calico, err := cni.Get(api.CalicoCNI)
+		Expect(err).ShouldNot(HaveOccurred())
+		release, err := cni.ReleaseFor(calico, "1.30.5", "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(release.Version).To(Equal("v3.28.2"))
+		Expect(release.BundledIn).To(Equal("1.30"))
+
+		opt.Mode = "etcd"
+		err = cni.Validate(opt)
+		Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation))
+		Expect(err.Error()).To(ContainSubstring("Mode etcd of calico v3.28.2 is not supported"))
+		opt.KubernetesVersion = "1.15.5"
+		Expect(cni.Validate(opt)).To(Succeed())
+
+		opt.CNIName = api.HostnicCNI
+		Expect(api.ExitCode(cni.Validate(opt))).To(Equal(api.ExitCodeValidation))
+		opt.CNIName = "weave"
+		Expect(cni.Validate(opt)).To(MatchError(ContainSubstring("use one of calico, flannel, hostnic")))
+		opt.CNIName = api.FlannelCNI
+		opt.KubernetesVersion = "1.13.1"
+		Expect(cni.Validate(opt)).To(MatchError(ContainSubstring("flannel is not bundled in images of kubernetes 1.13.1, use one of calico")))
+		opt.KubernetesVersion = "1.22.0"
+		Expect(cni.Validate(opt)).To(Succeed())
+	})
+
+	It("Should pin releases which can be downloaded", func() {
+		flannel, err := cni.Get(api.FlannelCNI)
+		Expect(err).ShouldNot(HaveOccurred())
+		release, err := cni.ReleaseFor(flannel, "1.30.5", "v0.26.1")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(release.ManifestURL).To(ContainSubstring("v0.26.1/kube-flannel.yml"))
+		_, err = cni.ReleaseFor(flannel, "1.30.5", "v0.11.0")
+		Expect(err).To(MatchError(ContainSubstring("flannel v0.11.0 is only bundled in images of kubernetes 1.15")))
+		_, err = cni.ReleaseFor(flannel, "1.30.5", "v0.1.0")
+		Expect(err).To(MatchError(ContainSubstring("known versions: v0.26.1, v0.25.7, v0.11.0")))
+		Expect(flannel.PodCIDRFilter("10.233.0.0/16")).To(Equal("s?10.244.0.0/16?10.233.0.0/16?g"))
+		Expect(flannel.KubeadmArgs(api.NetworkOption{PodNetWorkCIDR: "10.233.0.0/16"})).To(Equal([]string{"--pod-network-cidr=10.233.0.0/16"}))
+	})
+
+	It("Should tell the CNI of a cluster by its daemonsets", func() {
+		Expect(cni.Discover("calico-node")).To(Equal(api.CalicoCNI))
+		Expect(cni.Discover("kube-flannel-ds-amd64")).To(Equal(api.FlannelCNI))
+		Expect(cni.Discover("kube-proxy")).To(BeEmpty())
+	})
+})
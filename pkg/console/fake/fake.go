@@ -0,0 +1,29 @@
+package fake
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/console"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+)
+
+var _ console.Interface = &ConsoleService{}
+
+// ConsoleService gives the console output set for instances, others are not supported like on qingcloud
+type ConsoleService struct {
+	recorder.Recorder
+	Outputs map[string]string
+}
+
+func NewConsoleService() *ConsoleService {
+	return &ConsoleService{Outputs: make(map[string]string)}
+}
+
+func (f *ConsoleService) Output(instanceID string) ([]byte, error) {
+	if err := f.Record("Output", instanceID); err != nil {
+		return nil, err
+	}
+	output, ok := f.Outputs[instanceID]
+	if !ok {
+		return nil, console.ErrNotSupported
+	}
+	return []byte(output), nil
+}
@@ -0,0 +1,11 @@
+package console
+
+import "errors"
+
+// ErrNotSupported is returned by clouds which cannot give the console output of instances
+var ErrNotSupported = errors.New("console output of instances is not supported")
+
+type Interface interface {
+	// Output returns what the instance printed to its serial console, like messages of the kernel and cloud-init
+	Output(instanceID string) ([]byte, error)
+}
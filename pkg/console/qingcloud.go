@@ -0,0 +1,13 @@
+package console
+
+// the vendored sdk has no api giving the console of instances, it is only seen by vnc in the web console of qingcloud.
+// The service is kept so embedders with access to console output can give it by their own provider.
+type qingcloudConsole struct{}
+
+func NewQingCloudConsoleService() Interface {
+	return qingcloudConsole{}
+}
+
+func (qingcloudConsole) Output(instanceID string) ([]byte, error) {
+	return nil, ErrNotSupported
+}
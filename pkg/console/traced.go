@@ -0,0 +1,23 @@
+package console
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedConsole struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given console service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedConsole{Interface: i, scope: scope}
+}
+
+func (t *tracedConsole) Output(instanceID string) ([]byte, error) {
+	span := t.scope.Start("console.Output")
+	span.SetAttribute("instance.id", instanceID)
+	output, err := t.Interface.Output(instanceID)
+	span.Finish(err)
+	return output, err
+}
@@ -0,0 +1,57 @@
+package fake
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/eip"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+)
+
+var _ eip.Interface = &EIPService{}
+
+// EIPService keeps allocated eips and the instance each one is associated to
+type EIPService struct {
+	recorder.Recorder
+	EIPs map[string]*eip.EIP
+	// Associations maps eip ids to instance ids
+	Associations map[string]string
+}
+
+func NewEIPService() *EIPService {
+	return &EIPService{
+		EIPs:         make(map[string]*eip.EIP),
+		Associations: make(map[string]string),
+	}
+}
+
+func (f *EIPService) ReleaseEIPs(ids []string) error {
+	if err := f.Record("ReleaseEIPs", ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(f.EIPs, id)
+		delete(f.Associations, id)
+	}
+	return nil
+}
+
+func (f *EIPService) AllocateEIP(name string, bandwidth int) (*eip.EIP, error) {
+	if err := f.Record("AllocateEIP", name, bandwidth); err != nil {
+		return nil, err
+	}
+	n := len(f.EIPs) + 1
+	e := &eip.EIP{ID: fmt.Sprintf("eip-%d", n), Addr: fmt.Sprintf("139.198.0.%d", n)}
+	f.EIPs[e.ID] = e
+	return &eip.EIP{ID: e.ID, Addr: e.Addr}, nil
+}
+
+func (f *EIPService) AssociateEIP(id, instanceID string) error {
+	if err := f.Record("AssociateEIP", id, instanceID); err != nil {
+		return err
+	}
+	if _, ok := f.EIPs[id]; !ok {
+		return fmt.Errorf("Cannot find eip %s", id)
+	}
+	f.Associations[id] = instanceID
+	return nil
+}
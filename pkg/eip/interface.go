@@ -0,0 +1,14 @@
+package eip
+
+// EIP is a public ip of qingcloud
+type EIP struct {
+	ID   string
+	Addr string
+}
+
+type Interface interface {
+	ReleaseEIPs(ids []string) error
+	// AllocateEIP allocates an eip charged by bandwidth in Mbps, it returns once the address is known
+	AllocateEIP(name string, bandwidth int) (*EIP, error)
+	AssociateEIP(id, instanceID string) error
+}
@@ -0,0 +1,80 @@
+package eip
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
+	"github.com/yunify/qingcloud-sdk-go/client"
+	"github.com/yunify/qingcloud-sdk-go/service"
+)
+
+const DefaultEIPWait = time.Minute * 2
+
+type qingcloudEIP struct {
+	jobService *service.JobService
+	eipService *service.EIPService
+}
+
+func NewQingCloudEIPService(eipService *service.EIPService, jobService *service.JobService) Interface {
+	return &qingcloudEIP{
+		jobService: jobService,
+		eipService: eipService,
+	}
+}
+
+func (q *qingcloudEIP) ReleaseEIPs(ids []string) error {
+	input := &service.ReleaseEIPsInput{
+		EIPs: service.StringSlice(ids),
+	}
+	output, err := q.eipService.ReleaseEIPs(input)
+	if err != nil {
+		return api.FromQingCloud(err, "Error in releasing eips")
+	}
+	return client.WaitJob(q.jobService, *output.JobID, DefaultEIPWait, time.Second*5)
+}
+
+func (q *qingcloudEIP) AllocateEIP(name string, bandwidth int) (*EIP, error) {
+	input := &service.AllocateEIPsInput{
+		Bandwidth:   &bandwidth,
+		BillingMode: service.String("bandwidth"),
+		Count:       service.Int(1),
+		EIPName:     &name,
+	}
+	output, err := q.eipService.AllocateEIPs(input)
+	if err != nil {
+		return nil, api.FromQingCloud(err, "Error in allocating eip")
+	}
+	if len(output.EIPs) == 0 {
+		return nil, fmt.Errorf("No eip is allocated")
+	}
+	result := &EIP{ID: *output.EIPs[0]}
+	err = retry.Until(DefaultEIPWait, time.Second*5, func() error {
+		describe, err := q.eipService.DescribeEIPs(&service.DescribeEIPsInput{EIPs: []*string{&result.ID}})
+		if err != nil {
+			return api.FromQingCloud(err, "Error in describing eip %s", result.ID)
+		}
+		if len(describe.EIPSet) == 0 {
+			return fmt.Errorf("Cannot find eip %s", result.ID)
+		}
+		e := describe.EIPSet[0]
+		if e.Status == nil || *e.Status != "available" || e.EIPAddr == nil {
+			return fmt.Errorf("Eip %s is not available yet", result.ID)
+		}
+		result.Addr = *e.EIPAddr
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("Eip %s is not available in %s", result.ID, DefaultEIPWait)
+	}
+	return result, nil
+}
+
+func (q *qingcloudEIP) AssociateEIP(id, instanceID string) error {
+	output, err := q.eipService.AssociateEIP(&service.AssociateEIPInput{EIP: &id, Instance: &instanceID})
+	if err != nil {
+		return api.FromQingCloud(err, "Error in associating eip %s to %s", id, instanceID)
+	}
+	return client.WaitJob(q.jobService, *output.JobID, DefaultEIPWait, time.Second*5)
+}
@@ -0,0 +1,45 @@
+package eip
+
+import (
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedEIP struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given eip service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedEIP{Interface: i, scope: scope}
+}
+
+func (t *tracedEIP) ReleaseEIPs(ids []string) error {
+	span := t.scope.Start("eip.ReleaseEIPs")
+	span.SetAttribute("eip.ids", strings.Join(ids, ","))
+	err := t.Interface.ReleaseEIPs(ids)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedEIP) AllocateEIP(name string, bandwidth int) (*EIP, error) {
+	span := t.scope.Start("eip.AllocateEIP")
+	span.SetAttribute("eip.name", name)
+	e, err := t.Interface.AllocateEIP(name, bandwidth)
+	if e != nil {
+		span.SetAttribute("eip.id", e.ID)
+	}
+	span.Finish(err)
+	return e, err
+}
+
+func (t *tracedEIP) AssociateEIP(id, instanceID string) error {
+	span := t.scope.Start("eip.AssociateEIP")
+	span.SetAttribute("eip.id", id)
+	span.SetAttribute("instance.id", instanceID)
+	err := t.Interface.AssociateEIP(id, instanceID)
+	span.Finish(err)
+	return err
+}
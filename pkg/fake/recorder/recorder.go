@@ -0,0 +1,60 @@
+package recorder
+
+import (
+	"sync"
+)
+
+// Call is one recorded method call of a fake
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Recorder is embedded by fakes to record calls and inject failures
+type Recorder struct {
+	mu     sync.Mutex
+	calls  []Call
+	errors map[string]error
+}
+
+// FailOn makes every following call of method return err, a nil err clears it
+func (r *Recorder) FailOn(method string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errors == nil {
+		r.errors = make(map[string]error)
+	}
+	if err == nil {
+		delete(r.errors, method)
+		return
+	}
+	r.errors[method] = err
+}
+
+// Record saves the call and returns the injected error of method
+func (r *Recorder) Record(method string, args ...interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+	return r.errors[method]
+}
+
+// Calls returns all recorded calls in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]Call, len(r.calls))
+	copy(result, r.calls)
+	return result
+}
+
+// CallsOf returns recorded calls of method
+func (r *Recorder) CallsOf(method string) []Call {
+	result := make([]Call, 0)
+	for _, c := range r.Calls() {
+		if c.Method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
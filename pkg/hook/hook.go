@@ -0,0 +1,137 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// lifecycle points where hooks run
+const (
+	// PreCreate runs after the input is checked, before any resource is created
+	PreCreate = "pre-create"
+	// PostInstances runs when machines are created and tagged, before kubernetes is set up on them
+	PostInstances = "post-instances"
+	// PreJoin runs when master is up with its CNI, before nodes join
+	PreJoin = "pre-join"
+	// PostCreate runs when the cluster is created, even if some nodes need repair
+	PostCreate = "post-create"
+	// PreDelete runs before any resource of the cluster is deleted
+	PreDelete = "pre-delete"
+)
+
+// Points are all lifecycle points in the order they are reached
+var Points = []string{PreCreate, PostInstances, PreJoin, PostCreate, PreDelete}
+
+// DefaultExecTimeout bounds how long a command of an exec hook runs
+const DefaultExecTimeout = 10 * time.Minute
+
+// Machine is an instance of the cluster as hooks see it
+type Machine struct {
+	ID string `json:"id"`
+	// Role is master, node or winnode
+	Role string `json:"role"`
+	IP   string `json:"ip,omitempty"`
+}
+
+// Context tells hooks about the cluster at a point, exec hooks read it as JSON on stdin
+type Context struct {
+	Point             string    `json:"point"`
+	ClusterName       string    `json:"clusterName"`
+	Zone              string    `json:"zone"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+	TagID             string    `json:"tagID,omitempty"`
+	VxNet             string    `json:"vxNet,omitempty"`
+	APIServer         string    `json:"apiServer,omitempty"`
+	Machines          []Machine `json:"machines,omitempty"`
+}
+
+// Hook runs site specific automation at lifecycle points, an error stops the operation at that point
+type Hook interface {
+	// Run is called at every point, hooks ignore the points they are not interested in
+	Run(ctx *Context) error
+}
+
+// Func is a Hook of a function
+type Func func(ctx *Context) error
+
+func (f Func) Run(ctx *Context) error {
+	return f(ctx)
+}
+
+type execHook struct {
+	points  map[string]bool
+	command string
+	timeout time.Duration
+}
+
+// NewExec parses an exec hook in form of "point[,point]=command", the command runs by sh with the context on stdin,
+// and QKS_HOOK_POINT and QKS_CLUSTER_NAME in its environment. It fails the point if it exits with an error.
+func NewExec(spec string) (Hook, error) {
+	i := strings.Index(spec, "=")
+	if i <= 0 || strings.TrimSpace(spec[i+1:]) == "" {
+		return nil, fmt.Errorf("Invalid hook %s, it should be in form of 'point[,point]=command'", spec)
+	}
+	h := &execHook{points: make(map[string]bool), command: spec[i+1:], timeout: DefaultExecTimeout}
+	for _, p := range strings.Split(spec[:i], ",") {
+		if !isPoint(p) {
+			return nil, fmt.Errorf("Unknown point %s of hook %s, available points: %s", p, spec, strings.Join(Points, ", "))
+		}
+		h.points[p] = true
+	}
+	return h, nil
+}
+
+// ParseExecs parses exec hooks of specs in order
+func ParseExecs(specs ...string) ([]Hook, error) {
+	hooks := make([]Hook, 0, len(specs))
+	for _, spec := range specs {
+		h, err := NewExec(spec)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+func isPoint(p string) bool {
+	for _, point := range Points {
+		if p == point {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *execHook) Run(c *Context) error {
+	if !h.points[c.Point] {
+		return nil
+	}
+	input, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "QKS_HOOK_POINT="+c.Point, "QKS_CLUSTER_NAME="+c.ClusterName)
+	klog.Infof("Running hook '%s' at %s", h.command, c.Point)
+	out, err := cmd.CombinedOutput()
+	klog.V(2).Info(string(out))
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Hook '%s' does not finish in %s", h.command, h.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("Hook '%s' failed, err: %s, output: %s", h.command, err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
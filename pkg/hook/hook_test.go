@@ -0,0 +1,53 @@
+package hook_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/magicsong/yunify-k8s/pkg/hook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hook", func() {
+	It("Should parse exec hooks", func() {
+		_, err := hook.ParseExecs("pre-create,post-create=echo hi", "pre-delete=a=b")
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, spec := range []string{"echo hi", "=echo hi", "pre-create=", "post-join=echo hi"} {
+			_, err = hook.NewExec(spec)
+			Expect(err).Should(HaveOccurred(), spec)
+		}
+	})
+
+	It("Should run the command at its points with the context on stdin", func() {
+		dir, err := ioutil.TempDir("", "qks-hook")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		out := filepath.Join(dir, "context.json")
+		h, err := hook.NewExec("post-instances,pre-join=cat > " + out + " && test \"$QKS_HOOK_POINT\" = pre-join")
+		Expect(err).ShouldNot(HaveOccurred())
+		ctx := &hook.Context{
+			Point:       hook.PreCreate,
+			ClusterName: "test",
+			Zone:        "ap2a",
+			Machines:    []hook.Machine{{ID: "i-1", Role: "master", IP: "192.168.0.2"}},
+		}
+		Expect(h.Run(ctx)).To(Succeed())
+		Expect(out).NotTo(BeAnExistingFile())
+
+		ctx.Point = hook.PostInstances
+		err = h.Run(ctx)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("exit status 1"))
+
+		ctx.Point = hook.PreJoin
+		Expect(h.Run(ctx)).To(Succeed())
+		content, err := ioutil.ReadFile(out)
+		Expect(err).ShouldNot(HaveOccurred())
+		read := &hook.Context{}
+		Expect(json.Unmarshal(content, read)).To(Succeed())
+		Expect(read).To(Equal(ctx))
+	})
+})
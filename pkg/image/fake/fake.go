@@ -0,0 +1,82 @@
+package fake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/image"
+)
+
+var _ image.Interface = &ImageService{}
+
+// ImageService keeps status of images in memory
+type ImageService struct {
+	recorder.Recorder
+
+	mu     sync.Mutex
+	nextID int
+	images map[string]string
+}
+
+func NewImageService() *ImageService {
+	return &ImageService{images: make(map[string]string)}
+}
+
+// SetStatus adds an image or changes its status
+func (f *ImageService) SetStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[id] = status
+}
+
+func (f *ImageService) CreateImageBasedInstanceID(instanceID string, name string) (string, error) {
+	if err := f.Record("CreateImageBasedInstanceID", instanceID, name); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("img-fake%04d", f.nextID)
+	f.images[id] = image.StatusAvailable
+	return id, nil
+}
+
+func (f *ImageService) CaptureImageFromSnapshot(snapshotID, name string) (string, error) {
+	if err := f.Record("CaptureImageFromSnapshot", snapshotID, name); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("img-fake%04d", f.nextID)
+	f.images[id] = image.StatusAvailable
+	return id, nil
+}
+
+func (f *ImageService) DeleteImage(ids ...string) error {
+	if err := f.Record("DeleteImage", ids); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.images, id)
+	}
+	return nil
+}
+
+func (f *ImageService) GetImageStatus(ids ...string) (map[string]string, error) {
+	if err := f.Record("GetImageStatus", ids); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make(map[string]string)
+	for _, id := range ids {
+		if status, ok := f.images[id]; ok {
+			result[id] = status
+		}
+	}
+	return result, nil
+}
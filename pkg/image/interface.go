@@ -2,5 +2,11 @@ package image
 
 type Interface interface {
 	CreateImageBasedInstanceID(string, string) (string, error)
+	// CaptureImageFromSnapshot creates an image from a snapshot of an instance, so machines boot with what the snapshot has
+	CaptureImageFromSnapshot(snapshotID, imageName string) (string, error)
 	DeleteImage(...string) error
+	// GetImageStatus returns status of the images found, missing ones are not in the result
+	GetImageStatus(...string) (map[string]string, error)
 }
+
+const StatusAvailable = "available"
@@ -1,9 +1,9 @@
 package image
 
 import (
-	"fmt"
 	"time"
 
+	"github.com/magicsong/yunify-k8s/pkg/api"
 	"github.com/magicsong/yunify-k8s/pkg/instance"
 	"github.com/yunify/qingcloud-sdk-go/client"
 	"github.com/yunify/qingcloud-sdk-go/service"
@@ -12,11 +12,15 @@ import (
 
 const DefaultCreateImageWait = time.Minute
 
+// DefaultCaptureSnapshotWait is longer as the whole disk of the snapshot is copied into the image
+const DefaultCaptureSnapshotWait = 10 * time.Minute
+
 type qingCloudImageService struct {
 	instance.Interface
-	imageService *service.ImageService
-	jobService   *service.JobService
-	userid       string
+	imageService    *service.ImageService
+	snapshotService *service.SnapshotService
+	jobService      *service.JobService
+	userid          string
 }
 
 func (q *qingCloudImageService) CreateImageBasedInstanceID(instanceid string, imageName string) (string, error) {
@@ -33,12 +37,7 @@ func (q *qingCloudImageService) CreateImageBasedInstanceID(instanceid string, im
 	output, err := q.imageService.CaptureInstance(input)
 	if err != nil {
 		klog.Error("error in capture instances, pls try again")
-		return "", err
-	}
-	if *output.RetCode != 0 {
-		err = fmt.Errorf("err: %s", *output.Message)
-		klog.Error("error in capture  instances")
-		return "", err
+		return "", api.FromQingCloud(err, "Error in capturing instance %s", instanceid)
 	}
 	time.Sleep(time.Second * 30)
 	klog.Info("Waiting for building image done")
@@ -49,6 +48,21 @@ func (q *qingCloudImageService) CreateImageBasedInstanceID(instanceid string, im
 	return *output.ImageID, nil
 }
 
+func (q *qingCloudImageService) CaptureImageFromSnapshot(snapshotID, imageName string) (string, error) {
+	output, err := q.snapshotService.CaptureInstanceFromSnapshot(&service.CaptureInstanceFromSnapshotInput{
+		ImageName: &imageName,
+		Snapshot:  &snapshotID,
+	})
+	if err != nil {
+		return "", api.FromQingCloud(err, "Error in capturing snapshot %s", snapshotID)
+	}
+	klog.Infof("Waiting for image %s captured from snapshot %s", *output.ImageID, snapshotID)
+	if err = client.WaitJob(q.jobService, *output.JobID, DefaultCaptureSnapshotWait, time.Second*5); err != nil {
+		return "", err
+	}
+	return *output.ImageID, nil
+}
+
 func (q *qingCloudImageService) DeleteImage(ids ...string) error {
 	input := &service.DeleteImagesInput{
 		Images: service.StringSlice(ids),
@@ -56,12 +70,7 @@ func (q *qingCloudImageService) DeleteImage(ids ...string) error {
 	output, err := q.imageService.DeleteImages(input)
 	if err != nil {
 		klog.Error("error in deleting images, pls try again")
-		return err
-	}
-	if *output.RetCode != 0 {
-		err = fmt.Errorf("err: %s", *output.Message)
-		klog.Error(err, "error in delete images")
-		return err
+		return api.FromQingCloud(err, "Error in deleting images %v", ids)
 	}
 	klog.Info("Waiting for image deletition done")
 	err = client.WaitJob(q.jobService, *output.JobID, DefaultCreateImageWait, time.Second*5)
@@ -71,10 +80,29 @@ func (q *qingCloudImageService) DeleteImage(ids ...string) error {
 	return nil
 }
 
-func NewQingCloudImageService(inst *service.InstanceService, job *service.JobService, image *service.ImageService, userid string) Interface {
+func (q *qingCloudImageService) GetImageStatus(ids ...string) (map[string]string, error) {
+	input := &service.DescribeImagesInput{
+		Images: service.StringSlice(ids),
+		Limit:  service.Int(len(ids)),
+	}
+	output, err := q.imageService.DescribeImages(input)
+	if err != nil {
+		return nil, api.FromQingCloud(err, "Error in describing images")
+	}
+	result := make(map[string]string)
+	for _, img := range output.ImageSet {
+		if img.ImageID != nil && img.Status != nil {
+			result[*img.ImageID] = *img.Status
+		}
+	}
+	return result, nil
+}
+
+func NewQingCloudImageService(inst *service.InstanceService, job *service.JobService, image *service.ImageService, snapshot *service.SnapshotService, userid string) Interface {
 	return &qingCloudImageService{
-		jobService:   job,
-		imageService: image,
-		Interface:    instance.NewQingCloudInstanceService(inst, job),
+		jobService:      job,
+		imageService:    image,
+		snapshotService: snapshot,
+		Interface:       instance.NewQingCloudInstanceService(inst, job),
 	}
 }
@@ -0,0 +1,74 @@
+package instance
+
+import (
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+)
+
+type cachedInstance struct {
+	Interface
+	cache *cache.Cache
+}
+
+// WithCache keeps results of GetInstance and GetInstanceTypes for ttl, any other call invalidates them
+func WithCache(i Interface, ttl time.Duration) Interface {
+	return &cachedInstance{Interface: i, cache: cache.New(ttl)}
+}
+
+// Invalidate drops cached results, for polls which must see changes made by others
+func (c *cachedInstance) Invalidate() {
+	c.cache.Invalidate()
+}
+
+func (c *cachedInstance) CreateInstances(opt *CreateInstancesOption) ([]*Instance, error) {
+	defer c.cache.Invalidate()
+	return c.Interface.CreateInstances(opt)
+}
+
+func (c *cachedInstance) DeleteInstances(ids []string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.DeleteInstances(ids)
+}
+
+func (c *cachedInstance) StopInstances(ids ...string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.StopInstances(ids...)
+}
+
+func (c *cachedInstance) StartInstances(ids ...string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.StartInstances(ids...)
+}
+
+func (c *cachedInstance) RenameInstance(id, name string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.RenameInstance(id, name)
+}
+
+func (c *cachedInstance) GetInstance(id string) (*Instance, error) {
+	key := "instance/" + id
+	if v, ok := c.cache.Get(key); ok {
+		ins := *v.(*Instance)
+		return &ins, nil
+	}
+	ins, err := c.Interface.GetInstance(id)
+	if err != nil || ins == nil {
+		return ins, err
+	}
+	cached := *ins
+	c.cache.Set(key, &cached)
+	return ins, nil
+}
+
+func (c *cachedInstance) GetInstanceTypes() ([]string, error) {
+	if v, ok := c.cache.Get("types"); ok {
+		return append([]string(nil), v.([]string)...), nil
+	}
+	types, err := c.Interface.GetInstanceTypes()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set("types", append([]string(nil), types...))
+	return types, nil
+}
@@ -0,0 +1,183 @@
+package fake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/instance"
+	qcerrors "github.com/yunify/qingcloud-sdk-go/request/errors"
+)
+
+var _ instance.Interface = &InstanceService{}
+
+// InstanceService keeps instances in memory, ips are allocated from 192.168.0.0/16
+type InstanceService struct {
+	recorder.Recorder
+
+	mu        sync.Mutex
+	nextID    int
+	instances map[string]*instance.Instance
+	stopped   map[string]bool
+	// Types are instance types available in the zone
+	Types []string
+	// Exhausted are instance types listed in Types which the zone has no capacity of when instances are created
+	Exhausted []string
+}
+
+func NewInstanceService() *InstanceService {
+	return &InstanceService{
+		instances: make(map[string]*instance.Instance),
+		stopped:   make(map[string]bool),
+		Types:     []string{"c1m1", "c1m2", "c2m4", "c4m8", "c8m16"},
+	}
+}
+
+func (f *InstanceService) CreateInstances(opt *instance.CreateInstancesOption) ([]*instance.Instance, error) {
+	if err := f.Record("CreateInstances", opt); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.Exhausted {
+		if opt.InstanceType == t {
+			// what the sdk returns for the ret code qingcloud answers with
+			return nil, &qcerrors.QingCloudError{RetCode: api.RetCodeResourceNotEnough, Message: fmt.Sprintf("resources of %s are not enough", t)}
+		}
+	}
+	result := make([]*instance.Instance, 0, opt.Count)
+	for i := 0; i < opt.Count; i++ {
+		f.nextID++
+		ins := &instance.Instance{
+			ID:            fmt.Sprintf("i-fake%04d", f.nextID),
+			Name:          instance.GeneateName(opt.Name, opt.Role),
+			IP:            fmt.Sprintf("192.168.%d.%d", f.nextID/250, f.nextID%250+2),
+			Status:        instance.StatusRunning,
+			InstanceType:  opt.InstanceType,
+			InstanceClass: opt.InstanceClass,
+			ImageID:       opt.NodeImageID,
+			VxNet:         opt.VxNet,
+			SecurityGroup: opt.SecurityGroup,
+		}
+		if opt.Role == api.RoleMaster {
+			ins.ImageID = opt.MasterImageID
+		} else if opt.Role == api.RoleWindowsNode {
+			ins.ImageID = opt.WindowsNodeImageID
+		}
+		f.instances[ins.ID] = ins
+		result = append(result, ins)
+	}
+	return result, nil
+}
+
+func (f *InstanceService) DeleteInstances(ids []string) error {
+	if err := f.Record("DeleteInstances", ids); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := f.instances[id]; !ok {
+			return fmt.Errorf("Instance %s not found", id)
+		}
+	}
+	for _, id := range ids {
+		delete(f.instances, id)
+		delete(f.stopped, id)
+	}
+	return nil
+}
+
+func (f *InstanceService) GetInstance(id string) (*instance.Instance, error) {
+	if err := f.Record("GetInstance", id); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ins, ok := f.instances[id]
+	if !ok {
+		return nil, fmt.Errorf("Instance %s not found", id)
+	}
+	copied := *ins
+	return &copied, nil
+}
+
+func (f *InstanceService) StopInstances(ids ...string) error {
+	if err := f.Record("StopInstances", ids); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := f.instances[id]; !ok {
+			return fmt.Errorf("Instance %s not found", id)
+		}
+		f.stopped[id] = true
+		f.instances[id].Status = "stopped"
+	}
+	return nil
+}
+
+func (f *InstanceService) StartInstances(ids ...string) error {
+	if err := f.Record("StartInstances", ids); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := f.instances[id]; !ok {
+			return fmt.Errorf("Instance %s not found", id)
+		}
+		delete(f.stopped, id)
+		f.instances[id].Status = "running"
+	}
+	return nil
+}
+
+// SetStatus changes the status of an instance as something outside of qks does, like terminated once it is deleted by hand
+func (f *InstanceService) SetStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ins, ok := f.instances[id]; ok {
+		ins.Status = status
+	}
+}
+
+func (f *InstanceService) RenameInstance(id, name string) error {
+	if err := f.Record("RenameInstance", id, name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ins, ok := f.instances[id]
+	if !ok {
+		return fmt.Errorf("Instance %s not found", id)
+	}
+	ins.Name = name
+	return nil
+}
+
+func (f *InstanceService) GetInstanceTypes() ([]string, error) {
+	if err := f.Record("GetInstanceTypes"); err != nil {
+		return nil, err
+	}
+	return append([]string{}, f.Types...), nil
+}
+
+// Instances returns ids of all existing instances
+func (f *InstanceService) Instances() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]string, 0, len(f.instances))
+	for id := range f.instances {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (f *InstanceService) IsStopped(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped[id]
+}
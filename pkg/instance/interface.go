@@ -4,9 +4,26 @@ import (
 	"github.com/magicsong/yunify-k8s/pkg/api"
 )
 
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+	// deleted instances are listed as terminated, then ceased before they are gone
+	StatusTerminated = "terminated"
+	StatusCeased     = "ceased"
+)
+
 type Instance struct {
-	ID string
-	IP string
+	ID     string
+	Name   string
+	IP     string
+	Status string
+	// InstanceType is like "c4m8", InstanceClass, ImageID and VxNet are what the instance is created with
+	InstanceType  string
+	InstanceClass int
+	ImageID       string
+	VxNet         string
+	// SecurityGroup guards the instance, it is the default one of the zone unless one is given at creation
+	SecurityGroup string
 }
 
 type CreateInstancesOption struct {
@@ -16,6 +33,10 @@ type CreateInstancesOption struct {
 	Count         int
 	Role          byte
 	InstanceClass int
+	// InstanceType overrides cpu and memory of the preset if set
+	InstanceType string
+	// SecurityGroup is attached instead of the default one of the zone if set
+	SecurityGroup string
 	api.ImagesPreset
 }
 
@@ -24,4 +45,9 @@ type Interface interface {
 	DeleteInstances(instanceID []string) error
 	GetInstance(string) (*Instance, error)
 	StopInstances(...string) error
+	// StartInstances starts stopped instances and waits until they are running
+	StartInstances(...string) error
+	RenameInstance(id, name string) error
+	// GetInstanceTypes returns instance types available in the zone
+	GetInstanceTypes() ([]string, error)
 }
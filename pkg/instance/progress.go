@@ -0,0 +1,103 @@
+package instance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProgressQuiet is how long progress waits without any transition before it tells what is still pending
+const DefaultProgressQuiet = 30 * time.Second
+
+// progress follows instances being created, it reports each transition of status or ip
+// so minutes of waiting for qingcloud do not look like a hang
+type progress struct {
+	start      time.Time
+	lastReport time.Time
+	quiet      time.Duration
+	total      int
+	seen       map[string]*Instance
+}
+
+func newProgress(total int) *progress {
+	now := time.Now()
+	return &progress{
+		start:      now,
+		lastReport: now,
+		quiet:      DefaultProgressQuiet,
+		total:      total,
+		seen:       make(map[string]*Instance),
+	}
+}
+
+// isReady tells if ins is running with an ip, which is when ssh can reach it
+func isReady(ins *Instance) bool {
+	return ins.Status == StatusRunning && ins.IP != ""
+}
+
+// observe compares instances with what was seen before, it returns the messages to report
+func (p *progress) observe(instances []*Instance) []string {
+	now := time.Now()
+	elapsed := now.Sub(p.start).Round(time.Second)
+	messages := make([]string, 0)
+	for _, ins := range instances {
+		old, ok := p.seen[ins.ID]
+		switch {
+		case !ok:
+			messages = append(messages, fmt.Sprintf("Instance %s is %s (%s)", ins.ID, ins.Status, elapsed))
+		case old.Status != ins.Status:
+			messages = append(messages, fmt.Sprintf("Instance %s: %s -> %s (%s)", ins.ID, old.Status, ins.Status, elapsed))
+		}
+		if ins.IP != "" && (!ok || old.IP == "") {
+			messages = append(messages, fmt.Sprintf("Instance %s got ip %s (%s)", ins.ID, ins.IP, elapsed))
+		}
+		copied := *ins
+		p.seen[ins.ID] = &copied
+	}
+	if len(messages) != 0 {
+		messages = append(messages, fmt.Sprintf("%d/%d instances are running with ip", p.ready(), p.total))
+		p.lastReport = now
+	} else if now.Sub(p.lastReport) >= p.quiet {
+		pending := p.pending()
+		if len(pending) == 0 {
+			pending = append(pending, "the creating job")
+		}
+		messages = append(messages, fmt.Sprintf("Still waiting for %s (%s)", strings.Join(pending, ", "), elapsed))
+		p.lastReport = now
+	}
+	return messages
+}
+
+func (p *progress) ready() int {
+	count := 0
+	for _, ins := range p.seen {
+		if isReady(ins) {
+			count++
+		}
+	}
+	return count
+}
+
+// pending returns instances which are not ready with their status, instances not described yet are left out
+func (p *progress) pending() []string {
+	result := make([]string, 0)
+	for id, ins := range p.seen {
+		if isReady(ins) {
+			continue
+		}
+		status := ins.Status
+		if ins.Status == StatusRunning {
+			status += ", no ip"
+		}
+		result = append(result, fmt.Sprintf("%s (%s)", id, status))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (p *progress) report(instances []*Instance) {
+	for _, m := range p.observe(instances) {
+		log.Info(m)
+	}
+}
@@ -0,0 +1,37 @@
+package instance
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Progress", func() {
+	It("Should report transitions of status and ip", func() {
+		p := newProgress(2)
+		messages := p.observe([]*Instance{{ID: "i-1", Status: "pending"}, {ID: "i-2", Status: "pending"}})
+		Expect(messages).To(HaveLen(3))
+		Expect(messages[0]).To(HavePrefix("Instance i-1 is pending"))
+		Expect(messages[2]).To(Equal("0/2 instances are running with ip"))
+
+		Expect(p.observe([]*Instance{{ID: "i-1", Status: "pending"}, {ID: "i-2", Status: "pending"}})).To(BeEmpty())
+
+		messages = p.observe([]*Instance{{ID: "i-1", Status: "running", IP: "192.168.0.2"}, {ID: "i-2", Status: "running"}})
+		Expect(messages).To(HaveLen(4))
+		Expect(messages[0]).To(HavePrefix("Instance i-1: pending -> running"))
+		Expect(messages[1]).To(HavePrefix("Instance i-1 got ip 192.168.0.2"))
+		Expect(messages[2]).To(HavePrefix("Instance i-2: pending -> running"))
+		Expect(messages[3]).To(Equal("1/2 instances are running with ip"))
+	})
+
+	It("Should tell what is pending after a quiet while", func() {
+		p := newProgress(2)
+		p.observe([]*Instance{{ID: "i-1", Status: "running", IP: "192.168.0.2"}, {ID: "i-2", Status: "running"}})
+		p.lastReport = time.Now().Add(-p.quiet)
+		messages := p.observe([]*Instance{{ID: "i-1", Status: "running", IP: "192.168.0.2"}, {ID: "i-2", Status: "running"}})
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0]).To(HavePrefix("Still waiting for i-2 (running, no ip)"))
+		Expect(p.observe([]*Instance{{ID: "i-1", Status: "running", IP: "192.168.0.2"}, {ID: "i-2", Status: "running"}})).To(BeEmpty())
+	})
+})
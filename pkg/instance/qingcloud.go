@@ -1,18 +1,23 @@
 package instance
 
 import (
+	"crypto/rand"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/magicsong/yunify-k8s/pkg/api"
 	"github.com/magicsong/yunify-k8s/pkg/retry"
 	"github.com/yunify/qingcloud-sdk-go/client"
 	"github.com/yunify/qingcloud-sdk-go/service"
+	"github.com/yunify/qingcloud-sdk-go/utils"
 	"k8s.io/klog/klogr"
 )
 
 const (
 	DefaultCreateInstanceWait = time.Minute * 2
+	DefaultWaitInstanceReady  = time.Minute * 3
 	DefaultRetryCount         = 3
 
 	ClusterNamePrefix = "K8S-APP"
@@ -22,10 +27,35 @@ func GeneateName(clusterName string, role byte) string {
 	roleName := "master"
 	if role == api.RoleNode {
 		roleName = "node"
+	} else if role == api.RoleWindowsNode {
+		roleName = "winnode"
 	}
 	return fmt.Sprintf("%s-%s-%s", ClusterNamePrefix, clusterName, roleName)
 }
 
+// randomPassword meets the rule of qingcloud, 8 to 14 characters with upper and lower letters and digits
+func randomPassword() (string, error) {
+	const letters = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := []byte("Qk5")
+	for len(b) < 14 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		b = append(b, letters[n.Int64()])
+	}
+	return string(b), nil
+}
+
+// RenameClusterInName replaces the cluster part of a name generated by GeneateName, ok is false if name is not generated by us
+func RenameClusterInName(name, oldCluster, newCluster string) (string, bool) {
+	oldPrefix := fmt.Sprintf("%s-%s-", ClusterNamePrefix, oldCluster)
+	if !strings.HasPrefix(name, oldPrefix) {
+		return name, false
+	}
+	return fmt.Sprintf("%s-%s-%s", ClusterNamePrefix, newCluster, strings.TrimPrefix(name, oldPrefix)), true
+}
+
 var log = klogr.New().WithName("Instance")
 
 var _ Interface = &qingcloudInstance{}
@@ -59,39 +89,141 @@ func (q *qingcloudInstance) CreateInstances(opt *CreateInstancesOption) ([]*Inst
 		input.CPU = &opt.NodeCPU
 		input.Memory = &opt.NodeMemory
 		input.ImageID = &opt.NodeImageID
+	} else if opt.Role == api.RoleWindowsNode {
+		input.CPU = &opt.NodeCPU
+		input.Memory = &opt.NodeMemory
+		input.ImageID = &opt.WindowsNodeImageID
+		// windows images cannot log in by keypair, ssh uses the key baked into the image and the password is never used
+		password, err := randomPassword()
+		if err != nil {
+			return nil, err
+		}
+		input.LoginMode = service.String("passwd")
+		input.LoginPasswd = &password
+		input.LoginKeyPair = nil
+	}
+	if opt.InstanceType != "" {
+		input.InstanceType = &opt.InstanceType
+		input.CPU = nil
+		input.Memory = nil
+	}
+	if opt.SecurityGroup != "" {
+		input.SecurityGroup = &opt.SecurityGroup
 	}
 
 	output, err := q.instanceService.RunInstances(input)
 	if err != nil {
-		return nil, err
+		return nil, api.FromQingCloud(err, "Error in creating instances")
 	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in creating instances, err: %s", *output.Message)
-		return nil, err
-	}
-	log.V(1).Info("Waiting for instance starting")
-	err = client.WaitJob(q.jobService, *output.JobID, DefaultCreateInstanceWait, time.Second*5)
+	log.Info("Waiting for instances to start", "count", len(output.Instances), "job", *output.JobID)
+	p := newProgress(len(output.Instances))
+	err = q.waitCreatingJob(*output.JobID, output.Instances, p, DefaultCreateInstanceWait, time.Second*5)
 	if err != nil {
 		return nil, err
 	}
 	log.V(1).Info("Machines starting successfully")
 	log.V(1).Info("Waiting for instance getting its ip")
-	time.Sleep(time.Second * 15)
-	result := make([]*Instance, 0)
-	for _, i := range output.Instances {
-		ins, err := client.WaitInstanceNetwork(q.instanceService, *i, DefaultCreateInstanceWait, time.Second*5)
+	return q.waitInstancesReady(output.Instances, p, DefaultWaitInstanceReady, time.Second*5)
+}
+
+// waitCreatingJob waits for the job of RunInstances, instances are described on every check to report their progress
+func (q *qingcloudInstance) waitCreatingJob(jobID string, ids []*string, p *progress, timeout, interval time.Duration) error {
+	input := &service.DescribeInstancesInput{
+		Instances: ids,
+		Verbose:   service.Int(1),
+	}
+	return utils.WaitForSpecificOrError(func() (bool, error) {
+		status, err := client.CheckJobStatus(q.jobService, jobID)
 		if err != nil {
-			log.Error(nil, "Timeout waiting for ip of instance", "ID", *i)
-			return nil, err
+			return false, err
 		}
-		result = append(result, &Instance{
-			ID: *ins.InstanceID,
-			IP: *ins.VxNets[0].PrivateIP,
-		})
+		// progress is informational, failures to describe are left to the check of readiness
+		if output, err := q.instanceService.DescribeInstances(input); err == nil {
+			p.report(convertInstances(output.InstanceSet))
+		}
+		switch status {
+		case "successful":
+			return true, nil
+		case "failed":
+			return false, fmt.Errorf("Job [%s] failed", jobID)
+		}
+		return false, nil
+	}, timeout, interval)
+}
+
+// waitInstancesReady describes instances until all of them are running and have a private ip,
+// ip may be empty until dhcp completes even after the creating job is done
+func (q *qingcloudInstance) waitInstancesReady(ids []*string, p *progress, timeout, interval time.Duration) ([]*Instance, error) {
+	input := &service.DescribeInstancesInput{
+		Instances: ids,
+		Verbose:   service.Int(1),
+	}
+	var result []*Instance
+	err := utils.WaitForSpecificOrError(func() (bool, error) {
+		output, err := q.instanceService.DescribeInstances(input)
+		if err != nil {
+			// qingcloud refusing the request does not change by retrying, failures of network may
+			if _, refused := api.QingCloudRetCode(err); refused {
+				return false, api.FromQingCloud(err, "Error in getting instances")
+			}
+			log.Error(err, "error in getting instances, retry again")
+			return false, nil
+		}
+		result = convertInstances(output.InstanceSet)
+		p.report(result)
+		for _, ins := range result {
+			if !isReady(ins) {
+				return false, nil
+			}
+		}
+		return len(result) == len(ids), nil
+	}, timeout, interval)
+	if err != nil {
+		log.Error(err, "Timeout waiting for instances to be running with ip")
+		return nil, err
 	}
 	return result, nil
 }
 
+func convertInstances(set []*service.Instance) []*Instance {
+	result := make([]*Instance, 0, len(set))
+	for _, i := range set {
+		result = append(result, convertInstance(i))
+	}
+	return result
+}
+
+func convertInstance(i *service.Instance) *Instance {
+	ins := &Instance{
+		ID: *i.InstanceID,
+	}
+	if i.InstanceName != nil {
+		ins.Name = *i.InstanceName
+	}
+	if i.Status != nil {
+		ins.Status = *i.Status
+	}
+	if len(i.VxNets) > 0 && i.VxNets[0].PrivateIP != nil {
+		ins.IP = *i.VxNets[0].PrivateIP
+	}
+	if len(i.VxNets) > 0 && i.VxNets[0].VxNetID != nil {
+		ins.VxNet = *i.VxNets[0].VxNetID
+	}
+	if i.InstanceType != nil {
+		ins.InstanceType = *i.InstanceType
+	}
+	if i.InstanceClass != nil {
+		ins.InstanceClass = *i.InstanceClass
+	}
+	if i.Image != nil && i.Image.ImageID != nil {
+		ins.ImageID = *i.Image.ImageID
+	}
+	if i.SecurityGroup != nil && i.SecurityGroup.SecurityGroupID != nil {
+		ins.SecurityGroup = *i.SecurityGroup.SecurityGroupID
+	}
+	return ins
+}
+
 func (q *qingcloudInstance) GetInstance(id string) (*Instance, error) {
 	result, err := q.getInstancesWithRetry([]*string{&id}, DefaultRetryCount)
 	if err != nil {
@@ -110,18 +242,10 @@ func (q *qingcloudInstance) getInstancesWithRetry(ids []*string, retryTimes int)
 		output, err := q.instanceService.DescribeInstances(input)
 		if err != nil {
 			log.Error(err, "error in getting instances, retry again")
-			return err
-		}
-		if *output.RetCode != 0 {
-			err := fmt.Errorf("err: %s", *output.Message)
-			log.Error(err, "error in getting instances, retry again")
-			return err
+			return api.FromQingCloud(err, "Error in getting instances")
 		}
 		for _, i := range output.InstanceSet {
-			result = append(result, &Instance{
-				ID: *i.InstanceID,
-				IP: *i.VxNets[0].PrivateIP,
-			})
+			result = append(result, convertInstance(i))
 		}
 		return nil
 	})
@@ -134,13 +258,8 @@ func (q *qingcloudInstance) DeleteInstances(instances []string) error {
 	}
 	output, err := q.instanceService.TerminateInstances(input)
 	if err != nil {
-		log.Error(err, "error in getting instances, pls try again")
-		return err
-	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("err: %s", *output.Message)
-		log.Error(err, "error in deleting instances")
-		return err
+		log.Error(err, "error in deleting instances, pls try again")
+		return api.FromQingCloud(err, "Error in deleting instances %v", instances)
 	}
 	log.Info("Waiting for instance terminating")
 	err = client.WaitJob(q.jobService, *output.JobID, DefaultCreateInstanceWait, time.Second*5)
@@ -158,12 +277,7 @@ func (q *qingcloudInstance) StopInstances(instances ...string) error {
 	output, err := q.instanceService.StopInstances(input)
 	if err != nil {
 		log.Error(err, "error in stopping instances, pls try again")
-		return err
-	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("err: %s", *output.Message)
-		log.Error(err, "error in stopping instances")
-		return err
+		return api.FromQingCloud(err, "Error in stopping instances %v", instances)
 	}
 	log.Info("Waiting for instance terminating")
 	err = client.WaitJob(q.jobService, *output.JobID, DefaultCreateInstanceWait, time.Second*5)
@@ -173,3 +287,39 @@ func (q *qingcloudInstance) StopInstances(instances ...string) error {
 	log.Info("Instances has been stopped")
 	return nil
 }
+
+func (q *qingcloudInstance) StartInstances(instances ...string) error {
+	output, err := q.instanceService.StartInstances(&service.StartInstancesInput{
+		Instances: service.StringSlice(instances),
+	})
+	if err != nil {
+		return api.FromQingCloud(err, "Error in starting instances %v", instances)
+	}
+	log.Info("Waiting for instances starting")
+	return client.WaitJob(q.jobService, *output.JobID, DefaultCreateInstanceWait, time.Second*5)
+}
+
+func (q *qingcloudInstance) RenameInstance(id, name string) error {
+	_, err := q.instanceService.ModifyInstanceAttributes(&service.ModifyInstanceAttributesInput{
+		Instance:     &id,
+		InstanceName: &name,
+	})
+	if err != nil {
+		return api.FromQingCloud(err, "Error in renaming instance %s", id)
+	}
+	return nil
+}
+
+func (q *qingcloudInstance) GetInstanceTypes() ([]string, error) {
+	output, err := q.instanceService.DescribeInstanceTypes(&service.DescribeInstanceTypesInput{})
+	if err != nil {
+		return nil, api.FromQingCloud(err, "Error in describing instance types")
+	}
+	result := make([]string, 0, len(output.InstanceTypeSet))
+	for _, t := range output.InstanceTypeSet {
+		if t.InstanceTypeID != nil && (t.Status == nil || *t.Status == "available") {
+			result = append(result, *t.InstanceTypeID)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package instance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	accesskey "github.com/magicsong/yunify-k8s/pkg/access-key"
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QingCloud", func() {
+	var (
+		dir     string
+		retCode int
+		server  *httptest.Server
+		service Interface
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "qks-instance")
+		Expect(err).ShouldNot(HaveOccurred())
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// qingcloud answers refused requests with 200 and a non-zero ret code
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("action") == "DescribeAccessKeys" {
+				fmt.Fprint(w, `{"action":"DescribeAccessKeysResponse","ret_code":0,"total_count":1,"access_key_set":[{"access_key_id":"AKID","owner":"usr-test"}]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"action":"%sResponse","ret_code":%d,"message":"refused by the test"}`, r.URL.Query().Get("action"), retCode)
+		}))
+		helper := accesskey.NewQingCloudAccessKeyHelper("ap2a", filepath.Join(dir, "config.yaml"))
+		helper.Endpoint = server.URL + "/iaas"
+		helper.Credentials = &accesskey.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}
+		Expect(helper.Init()).To(Succeed())
+		instances, err := helper.GetService().Instance("ap2a")
+		Expect(err).ShouldNot(HaveOccurred())
+		jobs, err := helper.GetService().Job("ap2a")
+		Expect(err).ShouldNot(HaveOccurred())
+		service = NewQingCloudInstanceService(instances, jobs)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("Should classify ret codes of errors returned by the sdk", func() {
+		opt := &CreateInstancesOption{Name: "test", Role: api.RoleNode, Count: 1, InstanceType: "s1.small.r1", VxNet: "vxnet-test", SSHKeyID: "kp-test"}
+		opt.NodeImageID = "img-test"
+		for code, class := range map[int]api.ErrorClass{
+			api.RetCodeBalanceNotEnough:  api.ErrorClassQuota,
+			api.RetCodeQuotaNotEnough:    api.ErrorClassQuota,
+			api.RetCodeResourceNotEnough: api.ErrorClassCapacity,
+			1400:                         api.ErrorClassCloudAPI,
+		} {
+			retCode = code
+			_, err := service.CreateInstances(opt)
+			Expect(err).Should(HaveOccurred())
+			Expect(api.ClassOf(err)).To(Equal(class), "ret code %d", code)
+			Expect(err.Error()).To(ContainSubstring("Error in creating instances"))
+			Expect(err.Error()).To(ContainSubstring("refused by the test"))
+		}
+		retCode = 1400
+		Expect(api.ExitCode(service.RenameInstance("i-test", "test"))).To(Equal(api.ExitCodeCloudAPI))
+		retCode = api.RetCodeQuotaNotEnough
+		Expect(api.ExitCode(service.StartInstances("i-test"))).To(Equal(api.ExitCodeQuota))
+	})
+
+	It("Should not retry waiting for instances qingcloud refuses to describe", func() {
+		retCode = 1300
+		id := "i-test"
+		_, err := service.(*qingcloudInstance).waitInstancesReady([]*string{&id}, newProgress(1), DefaultWaitInstanceReady, time.Millisecond)
+		Expect(err).Should(HaveOccurred())
+		Expect(api.ClassOf(err)).To(Equal(api.ErrorClassCloudAPI))
+	})
+})
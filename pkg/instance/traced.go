@@ -0,0 +1,73 @@
+package instance
+
+import (
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedInstance struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given instance service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedInstance{Interface: i, scope: scope}
+}
+
+func (t *tracedInstance) CreateInstances(opt *CreateInstancesOption) ([]*Instance, error) {
+	span := t.scope.Start("instance.CreateInstances")
+	span.SetAttribute("instance.name", GeneateName(opt.Name, opt.Role))
+	result, err := t.Interface.CreateInstances(opt)
+	span.Finish(err)
+	return result, err
+}
+
+func (t *tracedInstance) DeleteInstances(ids []string) error {
+	span := t.scope.Start("instance.DeleteInstances")
+	span.SetAttribute("instance.ids", strings.Join(ids, ","))
+	err := t.Interface.DeleteInstances(ids)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedInstance) GetInstance(id string) (*Instance, error) {
+	span := t.scope.Start("instance.GetInstance")
+	span.SetAttribute("instance.id", id)
+	result, err := t.Interface.GetInstance(id)
+	span.Finish(err)
+	return result, err
+}
+
+func (t *tracedInstance) StopInstances(ids ...string) error {
+	span := t.scope.Start("instance.StopInstances")
+	span.SetAttribute("instance.ids", strings.Join(ids, ","))
+	err := t.Interface.StopInstances(ids...)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedInstance) StartInstances(ids ...string) error {
+	span := t.scope.Start("instance.StartInstances")
+	span.SetAttribute("instance.ids", strings.Join(ids, ","))
+	err := t.Interface.StartInstances(ids...)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedInstance) RenameInstance(id, name string) error {
+	span := t.scope.Start("instance.RenameInstance")
+	span.SetAttribute("instance.id", id)
+	span.SetAttribute("instance.name", name)
+	err := t.Interface.RenameInstance(id, name)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedInstance) GetInstanceTypes() ([]string, error) {
+	span := t.scope.Start("instance.GetInstanceTypes")
+	result, err := t.Interface.GetInstanceTypes()
+	span.Finish(err)
+	return result, err
+}
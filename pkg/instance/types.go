@@ -0,0 +1,111 @@
+package instance
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// Families maps friendly names of instance families to instance_class of qingcloud
+var Families = map[string]int{
+	"performance":      0,
+	"high-performance": 1,
+	"basic":            100,
+	"standard":         101,
+	"enterprise":       200,
+	"enterprise-e2":    201,
+	"professional":     300,
+	"professional-e2":  301,
+}
+
+// Shapes are memory(MB) per vcpu, they are appended to a family like "enterprise-memory"
+var Shapes = map[string]int{
+	"compute": 1024,
+	"general": 2048,
+	"memory":  8192,
+}
+
+var instanceTypeIDRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*(\.[a-z0-9]+)*$`)
+
+// InstanceType is what users choose for machines of a role, either a family with optional shape or a qingcloud instance type
+type InstanceType struct {
+	Class int
+	// MemoryPerCPU is 0 if memory of the preset is kept
+	MemoryPerCPU int
+	// ID like "c4m8" replaces cpu and memory of the preset, Class is not used then
+	ID string
+}
+
+// ParseInstanceType parses "standard", "enterprise-memory" or a qingcloud instance type like "c4m8"
+func ParseInstanceType(s string) (*InstanceType, error) {
+	if class, ok := Families[s]; ok {
+		return &InstanceType{Class: class}, nil
+	}
+	if i := strings.LastIndex(s, "-"); i != -1 {
+		class, ok := Families[s[:i]]
+		memory, shapeOk := Shapes[s[i+1:]]
+		if ok && shapeOk {
+			return &InstanceType{Class: class, MemoryPerCPU: memory}, nil
+		}
+	}
+	if instanceTypeIDRegexp.MatchString(s) && strings.ContainsAny(s, "0123456789") {
+		return &InstanceType{ID: s}, nil
+	}
+	return nil, api.NewValidationError("Unknown instance type %s, use one of families %s with optional suffix of %s, or an instance type of qingcloud like 'c4m8'",
+		s, strings.Join(sortedKeys(Families), ","), strings.Join(sortedKeys(Shapes), ","))
+}
+
+// Apply sets the instance class and size of machines to create
+func (t *InstanceType) Apply(opt *CreateInstancesOption) {
+	if t.ID != "" {
+		opt.InstanceType = t.ID
+		return
+	}
+	opt.InstanceClass = t.Class
+	if t.MemoryPerCPU == 0 {
+		return
+	}
+	if opt.Role == api.RoleMaster {
+		opt.MasterMemory = opt.MasterCPU * t.MemoryPerCPU
+	} else {
+		opt.NodeMemory = opt.NodeCPU * t.MemoryPerCPU
+	}
+}
+
+// Matches tells whether an existing instance is of the type
+func (t *InstanceType) Matches(ins *Instance) bool {
+	if t.ID != "" {
+		return t.ID == ins.InstanceType
+	}
+	if t.Class != ins.InstanceClass {
+		return false
+	}
+	var cpu, memory int
+	if t.MemoryPerCPU == 0 {
+		return true
+	}
+	// qingcloud types are like "c4m8" or "e2.2xlarge.r1", only the former tells the size
+	if _, err := fmt.Sscanf(ins.InstanceType, "c%dm%d", &cpu, &memory); err != nil || cpu == 0 {
+		return true
+	}
+	return memory*1024/cpu == t.MemoryPerCPU
+}
+
+func (t *InstanceType) String() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return fmt.Sprintf("class %d", t.Class)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,219 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FieldManager owns the fields qks applies, so later applies by qks can change them
+const FieldManager = "qks"
+
+const applyPatchType = "application/apply-patch+yaml"
+
+// StatusError is a failure returned by the apiserver, Reason is like "NotFound" or "Invalid"
+type StatusError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("apiserver returns %d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+// ApplyError tells which object of a manifest failed to apply
+type ApplyError struct {
+	// Object is like "Deployment kube-system/coredns"
+	Object string
+	Err    error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("Failed to apply %s, err: %s", e.Object, e.Err.Error())
+}
+
+type resource struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+}
+
+// Client talks to the apiserver directly, so manifests are applied without kubectl on machines
+type Client struct {
+	server string
+	token  string
+	http   *http.Client
+
+	mu sync.Mutex
+	// resources caches discovery by group version
+	resources map[string][]resource
+}
+
+// NewClient returns a client using the current context of kubeconfig
+func NewClient(kubeconfig []byte) (*Client, error) {
+	config, err := parseKubeconfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: config.tls,
+		// the apiserver is often not reachable from where qks runs, fail fast then
+		DialContext:         (&net.Dialer{Timeout: time.Second * 5}).DialContext,
+		TLSHandshakeTimeout: time.Second * 5,
+	}
+	return &Client{
+		server:    strings.TrimSuffix(config.server, "/"),
+		token:     config.token,
+		http:      &http.Client{Transport: transport, Timeout: time.Second * 30},
+		resources: make(map[string][]resource),
+	}, nil
+}
+
+func (c *Client) do(method, path, contentType string, body []byte, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		status := &StatusError{}
+		if json.Unmarshal(data, status) != nil || status.Reason == "" {
+			status = &StatusError{Code: resp.StatusCode, Reason: http.StatusText(resp.StatusCode), Message: strings.TrimSpace(string(data))}
+		}
+		if status.Code == 0 {
+			status.Code = resp.StatusCode
+		}
+		return status
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// ServerVersion returns the version of apiserver like "v1.16.2"
+func (c *Client) ServerVersion() (string, error) {
+	info := struct {
+		GitVersion string `json:"gitVersion"`
+	}{}
+	if err := c.do(http.MethodGet, "/version", "", nil, &info); err != nil {
+		return "", err
+	}
+	return info.GitVersion, nil
+}
+
+func groupVersionPath(apiVersion string) string {
+	if apiVersion == "v1" {
+		return "/api/v1"
+	}
+	return "/apis/" + apiVersion
+}
+
+// findResource looks up kind by discovery, which is done again once if kind is missing, e.g. a CRD applied just now
+func (c *Client) findResource(apiVersion, kind string) (*resource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for refreshed := false; ; refreshed = true {
+		list, ok := c.resources[apiVersion]
+		if !ok || refreshed {
+			discovery := struct {
+				Resources []resource `json:"resources"`
+			}{}
+			if err := c.do(http.MethodGet, groupVersionPath(apiVersion), "", nil, &discovery); err != nil {
+				if status, ok := err.(*StatusError); !ok || status.Code != http.StatusNotFound {
+					return nil, err
+				}
+			}
+			list = discovery.Resources
+			c.resources[apiVersion] = list
+		}
+		for i := range list {
+			// subresources like "deployments/scale" share the kind
+			if list[i].Kind == kind && !strings.Contains(list[i].Name, "/") {
+				return &list[i], nil
+			}
+		}
+		if refreshed {
+			return nil, fmt.Errorf("The server does not know kind %s of %s", kind, apiVersion)
+		}
+	}
+}
+
+type object struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// Apply applies every object of a multi-document yaml by server-side apply, in order, and returns them like "Deployment kube-system/coredns"
+func (c *Client) Apply(manifest []byte) ([]string, error) {
+	var applied []string
+	for _, doc := range documentSeparator.Split(string(manifest), -1) {
+		obj := &object{}
+		if err := yaml.Unmarshal([]byte(doc), obj); err != nil {
+			return applied, fmt.Errorf("Invalid manifest, err: %s", err.Error())
+		}
+		if obj.Kind == "" {
+			// only comments or empty
+			continue
+		}
+		name := obj.Kind + " " + obj.Metadata.Name
+		if obj.APIVersion == "" || obj.Metadata.Name == "" || strings.HasSuffix(obj.Kind, "List") {
+			return applied, &ApplyError{Object: name, Err: fmt.Errorf("apiVersion and metadata.name are required, lists are not supported")}
+		}
+		r, err := c.findResource(obj.APIVersion, obj.Kind)
+		if err != nil {
+			return applied, &ApplyError{Object: name, Err: err}
+		}
+		path := groupVersionPath(obj.APIVersion)
+		if r.Namespaced {
+			namespace := obj.Metadata.Namespace
+			if namespace == "" {
+				namespace = "default"
+			}
+			path += "/namespaces/" + namespace
+			name = obj.Kind + " " + namespace + "/" + obj.Metadata.Name
+		}
+		path += "/" + r.Name + "/" + obj.Metadata.Name + "?fieldManager=" + FieldManager + "&force=true"
+		if err = c.do(http.MethodPatch, path, applyPatchType, []byte(doc), nil); err != nil {
+			return applied, &ApplyError{Object: name, Err: err}
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
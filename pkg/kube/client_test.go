@@ -0,0 +1,212 @@
+package kube_test
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/kube"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const discoveryV1 = `{"resources":[{"name":"namespaces","kind":"Namespace","namespaced":false},{"name":"configmaps","kind":"ConfigMap","namespaced":true}]}`
+
+const discoveryApps = `{"resources":[{"name":"deployments/scale","kind":"Scale","namespaced":true},{"name":"deployments","kind":"Deployment","namespaced":true}]}`
+
+const manifest = `# applied by qks
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: monitoring
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: monitoring
+data:
+  a: b
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+
+var _ = Describe("Client", func() {
+	var (
+		mu      sync.Mutex
+		patches map[string]string
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		patches = make(map[string]string)
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"kind":"Status","reason":"Unauthorized","message":"Unauthorized","code":401}`)
+				return
+			}
+			switch {
+			case r.URL.Path == "/version":
+				fmt.Fprint(w, `{"gitVersion":"v1.16.2"}`)
+			case r.URL.Path == "/api/v1":
+				fmt.Fprint(w, discoveryV1)
+			case r.URL.Path == "/apis/apps/v1":
+				fmt.Fprint(w, discoveryApps)
+			case r.Method == http.MethodPatch && r.URL.Path == "/apis/apps/v1/namespaces/default/deployments/web":
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"kind":"Status","reason":"Invalid","message":"spec.template is required","code":422}`)
+			case r.Method == http.MethodPatch:
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/apply-patch+yaml"))
+				Expect(r.URL.Query().Get("fieldManager")).To(Equal(kube.FieldManager))
+				body, _ := ioutil.ReadAll(r.Body)
+				mu.Lock()
+				patches[r.URL.Path] = string(body)
+				mu.Unlock()
+				fmt.Fprint(w, "{}")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	kubeconfig := func(token string) []byte {
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: admin@test
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: admin@test
+  context:
+    cluster: test
+    user: admin
+users:
+- name: admin
+  user:
+    token: %s
+`, server.URL, base64.StdEncoding.EncodeToString(ca), token))
+	}
+
+	It("Should apply objects of a manifest in order by server-side apply", func() {
+		client, err := kube.NewClient(kubeconfig("secret"))
+		Expect(err).ShouldNot(HaveOccurred())
+		version, err := client.ServerVersion()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(version).To(Equal("v1.16.2"))
+
+		applied, err := client.Apply([]byte(manifest))
+		Expect(applied).To(Equal([]string{"Namespace monitoring", "ConfigMap monitoring/settings"}))
+		Expect(patches).To(HaveKey("/api/v1/namespaces/monitoring"))
+		Expect(patches["/api/v1/namespaces/monitoring/configmaps/settings"]).To(ContainSubstring("data:\n  a: b\n"))
+		applyErr, ok := err.(*kube.ApplyError)
+		Expect(ok).To(BeTrue())
+		Expect(applyErr.Object).To(Equal("Deployment default/web"))
+		status, ok := applyErr.Err.(*kube.StatusError)
+		Expect(ok).To(BeTrue())
+		Expect(status.Code).To(Equal(422))
+		Expect(status.Reason).To(Equal("Invalid"))
+	})
+
+	It("Should return typed errors of the apiserver", func() {
+		client, err := kube.NewClient(kubeconfig("wrong"))
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = client.ServerVersion()
+		status, ok := err.(*kube.StatusError)
+		Expect(ok).To(BeTrue())
+		Expect(status.Reason).To(Equal("Unauthorized"))
+
+		client, err = kube.NewClient(kubeconfig("secret"))
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = client.Apply([]byte("apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n"))
+		Expect(err).To(MatchError(ContainSubstring("does not know kind Widget")))
+		_, err = kube.NewClient([]byte("clusters: []"))
+		Expect(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("Kubeconfig", func() {
+	const own = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Q0EtT0xE
+    server: https://192.168.0.2:6443
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    user: kubernetes-admin
+  name: kubernetes-admin@kubernetes
+current-context: kubernetes-admin@kubernetes
+kind: Config
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: Q0VSVA==
+`
+
+	It("Should remove only entries of the cluster from a merged kubeconfig", func() {
+		merged := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Q0EtT0xE
+    server: https://192.168.0.2:6443
+  name: kubernetes
+- cluster:
+    certificate-authority-data: Q0EtTkVX
+    server: https://192.168.0.2:6443
+  name: reused-ip
+contexts:
+- context:
+    cluster: kubernetes
+    user: kubernetes-admin
+  name: kubernetes-admin@kubernetes
+- context:
+    cluster: reused-ip
+    user: ops
+    namespace: web
+  name: ops@reused-ip
+current-context: kubernetes-admin@kubernetes
+kind: Config
+preferences: {}
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: Q0VSVA==
+- name: ops
+  user:
+    token: secret
+`
+		pruned, removed, err := kube.PruneKubeconfig([]byte(merged), []byte(own))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(removed).To(Equal([]string{"cluster kubernetes", "context kubernetes-admin@kubernetes", "user kubernetes-admin"}))
+		Expect(string(pruned)).To(ContainSubstring("name: reused-ip"))
+		Expect(string(pruned)).To(ContainSubstring("namespace: web"))
+		Expect(string(pruned)).To(ContainSubstring("preferences: {}"))
+		Expect(string(pruned)).To(ContainSubstring(`current-context: ""`))
+		Expect(string(pruned)).NotTo(ContainSubstring("Q0VSVA=="))
+
+		again, removed, err := kube.PruneKubeconfig(pruned, []byte(own))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(removed).To(BeEmpty())
+		Expect(again).To(Equal(pruned))
+		_, _, err = kube.PruneKubeconfig([]byte("clusters: ["), []byte(own))
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeconfig holds the fields of a kubeconfig used to reach the apiserver, like admin.conf of kubeadm
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Token                 string `yaml:"token"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// restConfig is what a client needs from the current context of a kubeconfig
+type restConfig struct {
+	server string
+	token  string
+	tls    *tls.Config
+}
+
+func parseKubeconfig(data []byte) (*restConfig, error) {
+	config := &kubeconfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Invalid kubeconfig, err: %s", err.Error())
+	}
+	if len(config.Contexts) == 0 {
+		return nil, fmt.Errorf("No context found in kubeconfig")
+	}
+	context := config.Contexts[0].Context
+	for _, c := range config.Contexts {
+		if c.Name == config.CurrentContext {
+			context = c.Context
+		}
+	}
+	result := &restConfig{tls: &tls.Config{}}
+	found := false
+	for _, c := range config.Clusters {
+		if c.Name != context.Cluster {
+			continue
+		}
+		found = true
+		result.server = c.Cluster.Server
+		result.tls.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		if c.Cluster.CertificateAuthorityData != "" {
+			ca, err := base64.StdEncoding.DecodeString(c.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid CA of cluster %s in kubeconfig, err: %s", c.Name, err.Error())
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("No certificate found in CA of cluster %s in kubeconfig", c.Name)
+			}
+			result.tls.RootCAs = pool
+		}
+	}
+	if !found || result.server == "" {
+		return nil, fmt.Errorf("Cannot find the server of cluster %s in kubeconfig", context.Cluster)
+	}
+	for _, u := range config.Users {
+		if u.Name != context.User {
+			continue
+		}
+		result.token = u.User.Token
+		if u.User.ClientCertificateData == "" {
+			continue
+		}
+		cert, err := base64.StdEncoding.DecodeString(u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate of user %s in kubeconfig, err: %s", u.Name, err.Error())
+		}
+		key, err := base64.StdEncoding.DecodeString(u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client key of user %s in kubeconfig, err: %s", u.Name, err.Error())
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate of user %s in kubeconfig, err: %s", u.Name, err.Error())
+		}
+		result.tls.Certificates = []tls.Certificate{pair}
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package kube
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PruneKubeconfig removes from config the clusters whose server and CA are those of a cluster in standalone,
+// contexts of such clusters, and users of those contexts which no other context uses. Names are not compared,
+// since every kubeadm cluster is called kubernetes. It returns the new config and what was removed,
+// config is returned unchanged if nothing matches. Fields unknown to qks are kept as they are.
+func PruneKubeconfig(config, standalone []byte) ([]byte, []string, error) {
+	own := &kubeconfig{}
+	if err := yaml.Unmarshal(standalone, own); err != nil {
+		return nil, nil, fmt.Errorf("Invalid kubeconfig, err: %s", err.Error())
+	}
+	servers := make(map[string]bool)
+	for _, c := range own.Clusters {
+		servers[c.Cluster.Server+" "+c.Cluster.CertificateAuthorityData] = true
+	}
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, nil, fmt.Errorf("Invalid kubeconfig, err: %s", err.Error())
+	}
+	removed := make([]string, 0)
+
+	clusters := make(map[string]bool)
+	changed := filterEntries(doc, "clusters", func(name string, entry yaml.MapSlice) bool {
+		server, _ := lookup(entry, "server").(string)
+		ca, _ := lookup(entry, "certificate-authority-data").(string)
+		if servers[server+" "+ca] {
+			clusters[name] = true
+			removed = append(removed, "cluster "+name)
+			return false
+		}
+		return true
+	})
+	if !changed {
+		return config, nil, nil
+	}
+	contexts := make(map[string]bool)
+	users := make(map[string]bool)
+	inUse := make(map[string]bool)
+	filterEntries(doc, "contexts", func(name string, entry yaml.MapSlice) bool {
+		cluster, _ := lookup(entry, "cluster").(string)
+		user, _ := lookup(entry, "user").(string)
+		if clusters[cluster] {
+			contexts[name] = true
+			users[user] = true
+			removed = append(removed, "context "+name)
+			return false
+		}
+		inUse[user] = true
+		return true
+	})
+	filterEntries(doc, "users", func(name string, _ yaml.MapSlice) bool {
+		if users[name] && !inUse[name] {
+			removed = append(removed, "user "+name)
+			return false
+		}
+		return true
+	})
+	for i := range doc {
+		if current, ok := doc[i].Value.(string); ok && doc[i].Key == "current-context" && contexts[current] {
+			doc[i].Value = ""
+		}
+	}
+	result, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, removed, nil
+}
+
+// filterEntries keeps entries of the named list in doc for which keep returns true, it is given the name
+// of an entry and what is under its cluster, context or user. It returns false if nothing is removed.
+func filterEntries(doc yaml.MapSlice, list string, keep func(name string, entry yaml.MapSlice) bool) bool {
+	changed := false
+	for i := range doc {
+		if doc[i].Key != list {
+			continue
+		}
+		entries, _ := doc[i].Value.([]interface{})
+		kept := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			item, _ := e.(yaml.MapSlice)
+			name, _ := lookup(item, "name").(string)
+			var entry yaml.MapSlice
+			for _, field := range item {
+				if field.Key != "name" {
+					entry, _ = field.Value.(yaml.MapSlice)
+				}
+			}
+			if keep(name, entry) {
+				kept = append(kept, e)
+			} else {
+				changed = true
+			}
+		}
+		doc[i].Value = kept
+	}
+	return changed
+}
+
+func lookup(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
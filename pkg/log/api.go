@@ -0,0 +1,151 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+// secretKeys are parts of parameter or field names whose values never reach the debug log
+var secretKeys = []string{"access_key", "secret", "signature", "passwd", "password", "token", "private_key"}
+
+var apiDebugWriter io.Writer
+
+// ConfigureAPIDebug makes every qingcloud request and response appended to the file, empty path disables it
+func ConfigureAPIDebug(path string) error {
+	if path == "" {
+		apiDebugWriter = nil
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to open api debug log %s, err: %s", path, err.Error())
+	}
+	apiDebugWriter = f
+	return nil
+}
+
+// WrapAPITransport logs through the transport if api debugging is configured
+func WrapAPITransport(next http.RoundTripper) http.RoundTripper {
+	if apiDebugWriter == nil {
+		return next
+	}
+	return NewAPIDebugTransport(next, apiDebugWriter)
+}
+
+type apiDebugTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewAPIDebugTransport writes requests and responses to w with secrets redacted
+func NewAPIDebugTransport(next http.RoundTripper, w io.Writer) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &apiDebugTransport{next: next, w: w}
+}
+
+func (t *apiDebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s >>> %s %s\n", start.Format(time.RFC3339), req.Method, RedactURL(req.URL))
+	if len(reqBody) > 0 {
+		fmt.Fprintf(&b, "%s\n", RedactForm(string(reqBody)))
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "<<< error after %s: %s\n\n", time.Since(start), err.Error())
+	} else {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		fmt.Fprintf(&b, "<<< %s after %s\n%s\n\n", resp.Status, time.Since(start), RedactJSON(respBody))
+	}
+	t.mu.Lock()
+	io.WriteString(t.w, b.String())
+	t.mu.Unlock()
+	return resp, err
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL hides secret query parameters like access_key_id and signature
+func RedactURL(u *url.URL) string {
+	c := *u
+	c.RawQuery = RedactForm(u.RawQuery)
+	return c.String()
+}
+
+// RedactForm hides secret values of url encoded parameters, the order is kept
+func RedactForm(form string) string {
+	pairs := strings.Split(form, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err == nil && len(kv) == 2 && isSecret(key) {
+			pairs[i] = kv[0] + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactJSON hides values of secret fields in a json body, other bodies are returned as is
+func RedactJSON(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				// like access_key_set, only secrets inside are hidden so the body keeps its shape
+				value[k] = redactValue(item)
+			default:
+				if isSecret(k) {
+					value[k] = redacted
+				}
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,43 @@
+package log_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("API debug log", func() {
+	It("Should redact secrets of requests and responses", func() {
+		next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"ret_code":0,"access_key_set":[{"secret_access_key":"s3cr3t"}],"instances":["i-1"]}`)),
+			}, nil
+		})
+		var buf bytes.Buffer
+		client := &http.Client{Transport: log.NewAPIDebugTransport(next, &buf)}
+		resp, err := client.Get("https://api.qingcloud.com/iaas/?action=RunInstances&access_key_id=AKID&login_passwd=p4ss&signature=abc%3D&zone=ap2a")
+		Expect(err).ShouldNot(HaveOccurred())
+		body, _ := ioutil.ReadAll(resp.Body)
+		Expect(string(body)).To(ContainSubstring("s3cr3t"))
+		logged := buf.String()
+		Expect(logged).To(ContainSubstring("action=RunInstances&access_key_id=REDACTED&login_passwd=REDACTED&signature=REDACTED&zone=ap2a"))
+		Expect(logged).To(ContainSubstring(`"instances":["i-1"]`))
+		Expect(logged).To(ContainSubstring("200 OK"))
+		Expect(logged).NotTo(ContainSubstring("AKID"))
+		Expect(logged).NotTo(ContainSubstring("p4ss"))
+		Expect(logged).NotTo(ContainSubstring("s3cr3t"))
+	})
+})
@@ -0,0 +1,173 @@
+package log
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levels = map[string]int{
+	"info":    0,
+	"warning": 1,
+	"error":   2,
+	"fatal":   3,
+}
+
+var severityChars = map[byte]string{
+	'I': "info",
+	'W': "warning",
+	'E': "error",
+	'F': "fatal",
+}
+
+// Entry is one parsed klog message
+type Entry struct {
+	Time    time.Time `json:"ts"`
+	Level   string    `json:"level"`
+	Caller  string    `json:"caller,omitempty"`
+	Message string    `json:"msg"`
+
+	raw []byte
+}
+
+// Backend receives every log entry, implement it to route logs elsewhere
+type Backend interface {
+	Write(*Entry) error
+}
+
+type textBackend struct {
+	w io.Writer
+}
+
+// NewTextBackend keeps the klog format
+func NewTextBackend(w io.Writer) Backend {
+	return &textBackend{w: w}
+}
+
+func (t *textBackend) Write(e *Entry) error {
+	_, err := t.w.Write(e.raw)
+	return err
+}
+
+type jsonBackend struct {
+	encoder *json.Encoder
+}
+
+// NewJSONBackend writes one json object per line
+func NewJSONBackend(w io.Writer) Backend {
+	return &jsonBackend{encoder: json.NewEncoder(w)}
+}
+
+func (j *jsonBackend) Write(e *Entry) error {
+	return j.encoder.Encode(e)
+}
+
+type klogWriter struct {
+	mu      sync.Mutex
+	backend Backend
+	level   int
+}
+
+func (k *klogWriter) Write(p []byte) (int, error) {
+	e := ParseKlogLine(p)
+	if levels[e.Level] < k.level {
+		return len(p), nil
+	}
+	if !showSecrets {
+		e.Message = Redact(e.Message)
+		e.raw = []byte(Redact(string(e.raw)))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.backend.Write(e); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ParseKlogLine parses a message in format of "Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg"
+func ParseKlogLine(p []byte) *Entry {
+	line := string(p)
+	e := &Entry{
+		Time:    time.Now(),
+		Level:   "info",
+		Message: strings.TrimRight(line, "\n"),
+		raw:     p,
+	}
+	if len(line) == 0 {
+		return e
+	}
+	if level, ok := severityChars[line[0]]; ok {
+		e.Level = level
+	}
+	end := strings.Index(line, "] ")
+	if end == -1 {
+		return e
+	}
+	fields := strings.Fields(line[1:end])
+	if len(fields) == 4 {
+		if t, err := time.ParseInLocation("0102 15:04:05.000000", fields[0]+" "+fields[1], time.Local); err == nil {
+			e.Time = t.AddDate(time.Now().Year(), 0, 0)
+		}
+		e.Caller = fields[3]
+	}
+	e.Message = strings.TrimRight(line[end+2:], "\n")
+	return e
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+// Setup routes klog output through a backend chosen by format, which redacts secrets.
+// klog is kept untouched if nothing is specified and secrets are shown.
+func Setup(format, file, level string) error {
+	if format == FormatText && file == "" && level == "" && showSecrets {
+		return nil
+	}
+	minLevel, ok := levels[strings.ToLower(level)]
+	if level != "" && !ok {
+		return fmt.Errorf("Unknown log level %s, available values: info, warning, error", level)
+	}
+	var out io.Writer = os.Stderr
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+	var backend Backend
+	switch format {
+	case FormatText:
+		backend = NewTextBackend(out)
+	case FormatJSON:
+		backend = NewJSONBackend(out)
+	default:
+		return fmt.Errorf("Unknown log format %s, available values: text, json", format)
+	}
+	Use(backend, minLevel)
+	return nil
+}
+
+// Use installs a backend for klog, messages below minLevel are dropped
+func Use(backend Backend, minLevel int) {
+	flag.Set("logtostderr", "false")
+	flag.Set("alsologtostderr", "false")
+	flag.Set("stderrthreshold", "FATAL")
+	// klog writes a message to files of all lower severities, so only the info one is needed
+	klog.SetOutput(nopWriter{})
+	klog.SetOutputBySeverity("INFO", &klogWriter{backend: backend, level: minLevel})
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+var showSecrets bool
+
+// ShowSecrets stops redacting logs, for debugging bootstrap by hand
+func ShowSecrets(show bool) {
+	showSecrets = show
+}
+
+// secretPatterns match kubeadm tokens, CA hashes and certificate keys, the first group is kept
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(--(?:discovery-)?token[= ])\S+`),
+	regexp.MustCompile(`(--discovery-token-ca-cert-hash[= ])\S+`),
+	regexp.MustCompile(`(--certificate-key[= ])\S+`),
+	regexp.MustCompile(`(Using token: )\S+`),
+	regexp.MustCompile(`(Using certificate key:\s+)\S+`),
+	regexp.MustCompile(`()\b[a-z0-9]{6}\.[a-z0-9]{16}\b`),
+	regexp.MustCompile(`(?s)(-----BEGIN [A-Z ]*PRIVATE KEY-----).*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// Redact hides secrets in text like a kubeadm join command, unless they are asked to be shown
+func Redact(s string) string {
+	if showSecrets {
+		return s
+	}
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// RedactFields returns v as generic json values with secret fields hidden, v is returned if it cannot be encoded
+func RedactFields(v interface{}) interface{} {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var generic interface{}
+	if err = json.Unmarshal(body, &generic); err != nil {
+		return v
+	}
+	return redactValue(generic)
+}
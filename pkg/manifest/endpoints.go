@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const (
+	// FormatEnv is a dotenv file of QKS_ variables, for shells and docker compose
+	FormatEnv = "env"
+	// FormatTerraformOutput is in form of 'terraform output -json', for terraform_remote_state like consumers
+	FormatTerraformOutput = "terraform-output"
+	// FormatAnsible is an ini inventory of ansible
+	FormatAnsible = "ansible"
+)
+
+// EndpointsFormats are what endpoints of a cluster are rendered in
+var EndpointsFormats = []string{FormatEnv, FormatTerraformOutput, FormatAnsible}
+
+// Endpoints are how machines of one cluster are reached, so downstream automation needs no call to qingcloud
+type Endpoints struct {
+	Cluster   string
+	Zone      string
+	APIServer string
+	MasterIP  string
+	// NodeIPs are linux nodes which joined the cluster
+	NodeIPs        []string
+	WindowsNodeIPs []string
+	// SSHUser reaches master and linux nodes with SSHKeyFile, and WindowsSSHUser windows nodes
+	SSHUser        string
+	WindowsSSHUser string
+	SSHKeyFile     string
+	// Kubeconfig is the local kubeconfig of the cluster, empty if it is not copied to local
+	Kubeconfig string
+}
+
+// EndpointsFormatOf tells the format by extension of path, .json is terraform outputs, .ini an ansible inventory, the
+// rest dotenv
+func EndpointsFormatOf(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".json"):
+		return FormatTerraformOutput
+	case strings.HasSuffix(path, ".ini"):
+		return FormatAnsible
+	}
+	return FormatEnv
+}
+
+// ValidateEndpointsFormat makes sure format is one of EndpointsFormats, "" is told by extension
+func ValidateEndpointsFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	_, err := (&Endpoints{}).Render(format)
+	return err
+}
+
+func (e *Endpoints) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatEnv:
+		return e.env(), nil
+	case FormatTerraformOutput:
+		return e.terraformOutput()
+	case FormatAnsible:
+		return e.ansible(), nil
+	}
+	return nil, api.NewValidationError("Unknown endpoints format '%s', available formats: %s", format, strings.Join(EndpointsFormats, ", "))
+}
+
+func (e *Endpoints) env() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# endpoints of qks cluster %s in zone %s\n", e.Cluster, e.Zone)
+	for _, kv := range [][2]string{
+		{"QKS_CLUSTER", e.Cluster},
+		{"QKS_ZONE", e.Zone},
+		{"QKS_APISERVER", e.APIServer},
+		{"QKS_MASTER_IP", e.MasterIP},
+		{"QKS_NODE_IPS", strings.Join(e.NodeIPs, ",")},
+		{"QKS_WINDOWS_NODE_IPS", strings.Join(e.WindowsNodeIPs, ",")},
+		{"QKS_SSH_USER", e.SSHUser},
+		{"QKS_WINDOWS_SSH_USER", e.WindowsSSHUser},
+		{"QKS_SSH_KEY", e.SSHKeyFile},
+		{"KUBECONFIG", e.Kubeconfig},
+	} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s=%q\n", kv[0], kv[1])
+		}
+	}
+	return []byte(b.String())
+}
+
+// terraformOutput is one output of 'terraform output -json'
+type terraformOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Type      interface{} `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+func (e *Endpoints) terraformOutput() ([]byte, error) {
+	str := func(v string) terraformOutput { return terraformOutput{Type: "string", Value: v} }
+	list := func(v []string) terraformOutput {
+		if v == nil {
+			v = []string{}
+		}
+		return terraformOutput{Type: []string{"list", "string"}, Value: v}
+	}
+	return json.MarshalIndent(map[string]terraformOutput{
+		"cluster":          str(e.Cluster),
+		"zone":             str(e.Zone),
+		"apiserver":        str(e.APIServer),
+		"master_ip":        str(e.MasterIP),
+		"node_ips":         list(e.NodeIPs),
+		"windows_node_ips": list(e.WindowsNodeIPs),
+		"ssh_user":         str(e.SSHUser),
+		"windows_ssh_user": str(e.WindowsSSHUser),
+		"ssh_key_file":     str(e.SSHKeyFile),
+		"kubeconfig":       str(e.Kubeconfig),
+	}, "", "  ")
+}
+
+// ansible is the inventory of master and nodes, hosts are called by their ips
+func (e *Endpoints) ansible() []byte {
+	hosts := func(ips ...string) []InventoryHost {
+		out := make([]InventoryHost, 0, len(ips))
+		for _, ip := range ips {
+			out = append(out, InventoryHost{Name: ip})
+		}
+		return out
+	}
+	inv := &Inventory{
+		Cluster: e.Cluster,
+		Zone:    e.Zone,
+		Groups: []InventoryGroup{
+			{Pool: "master", Hosts: hosts(e.MasterIP)},
+			{Pool: "node", Hosts: hosts(e.NodeIPs...)},
+		},
+		Vars: SSHVars(e.SSHUser, e.SSHKeyFile, false),
+	}
+	if len(e.WindowsNodeIPs) != 0 {
+		inv.Groups = append(inv.Groups, InventoryGroup{Pool: "winnode", Hosts: hosts(e.WindowsNodeIPs...), Vars: SSHVars(e.WindowsSSHUser, e.SSHKeyFile, true)})
+	}
+	inv.Vars["apiserver"] = e.APIServer
+	if e.Kubeconfig != "" {
+		inv.Vars["kubeconfig"] = e.Kubeconfig
+	}
+	return inv.ini()
+}
+
+// Write renders the endpoints in format, or the one told by extension of path if format is empty. The file holds no
+// secret but paths to them, it is readable by the user only anyway
+func (e *Endpoints) Write(path, format string) error {
+	if format == "" {
+		format = EndpointsFormatOf(path)
+	}
+	content, err := e.Render(format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
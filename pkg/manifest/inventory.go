@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+// FormatINI is the static inventory of ansible, FormatJSON of an inventory is what dynamic inventory scripts print for --list
+const FormatINI = "ini"
+
+// InventoryFormats are what an inventory is rendered in
+var InventoryFormats = []string{FormatINI, FormatJSON}
+
+// InventoryHost is a machine, Name is how ansible calls it and Vars like ansible_host tell how to reach it
+type InventoryHost struct {
+	Name string
+	Vars map[string]string
+}
+
+// InventoryGroup are the machines of a pool like "master", "node" or "winnode", named <cluster>_<pool> in the inventory
+type InventoryGroup struct {
+	Pool  string
+	Hosts []InventoryHost
+	Vars  map[string]string
+}
+
+// Inventory is an ansible inventory of one cluster, groups of pools are children of a group named after the cluster
+type Inventory struct {
+	Cluster string
+	Zone    string
+	Groups  []InventoryGroup
+	// Vars apply to all machines of the cluster
+	Vars map[string]string
+}
+
+// SSHVars are connection variables of ansible for machines reached by ssh as user with keyFile, windows machines run
+// cmd.exe behind OpenSSH
+func SSHVars(user, keyFile string, windows bool) map[string]string {
+	vars := map[string]string{"ansible_user": user}
+	if keyFile != "" {
+		vars["ansible_ssh_private_key_file"] = keyFile
+	}
+	if windows {
+		vars["ansible_shell_type"] = "cmd"
+	}
+	return vars
+}
+
+func (inv *Inventory) groupName(g *InventoryGroup) string {
+	return terraformName(inv.Cluster) + "_" + g.Pool
+}
+
+func (inv *Inventory) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatINI:
+		return inv.ini(), nil
+	case FormatJSON:
+		return inv.dynamic()
+	}
+	return nil, api.NewValidationError("Unknown inventory format '%s', available formats: %s", format, strings.Join(InventoryFormats, ", "))
+}
+
+func (inv *Inventory) ini() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# inventory of qks cluster %s in zone %s\n", inv.Cluster, inv.Zone)
+	children := make([]string, 0, len(inv.Groups))
+	for i := range inv.Groups {
+		g := &inv.Groups[i]
+		name := inv.groupName(g)
+		children = append(children, name)
+		fmt.Fprintf(&b, "[%s]\n", name)
+		for _, h := range g.Hosts {
+			fmt.Fprintln(&b, strings.TrimSpace(h.Name+" "+iniVars(h.Vars, " ")))
+		}
+		if len(g.Vars) != 0 {
+			fmt.Fprintf(&b, "\n[%s:vars]\n%s\n", name, iniVars(g.Vars, "\n"))
+		}
+		fmt.Fprintln(&b)
+	}
+	cluster := terraformName(inv.Cluster)
+	fmt.Fprintf(&b, "[%s:children]\n%s\n", cluster, strings.Join(children, "\n"))
+	if len(inv.Vars) != 0 {
+		fmt.Fprintf(&b, "\n[%s:vars]\n%s\n", cluster, iniVars(inv.Vars, "\n"))
+	}
+	return []byte(b.String())
+}
+
+// iniVars joins vars in order of names, so inventories of the same cluster are the same
+func iniVars(vars map[string]string, sep string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, name+"="+vars[name])
+	}
+	return strings.Join(items, sep)
+}
+
+// dynamicGroup is a group printed by dynamic inventory scripts
+type dynamicGroup struct {
+	Hosts    []string          `json:"hosts,omitempty"`
+	Children []string          `json:"children,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+}
+
+// dynamic prints hostvars in _meta, so ansible does not call the script with --host for every machine
+func (inv *Inventory) dynamic() ([]byte, error) {
+	cluster := &dynamicGroup{Vars: inv.Vars}
+	out := map[string]interface{}{}
+	hostVars := map[string]map[string]string{}
+	for i := range inv.Groups {
+		g := &inv.Groups[i]
+		name := inv.groupName(g)
+		cluster.Children = append(cluster.Children, name)
+		group := &dynamicGroup{Hosts: make([]string, 0, len(g.Hosts)), Vars: g.Vars}
+		for _, h := range g.Hosts {
+			group.Hosts = append(group.Hosts, h.Name)
+			if len(h.Vars) != 0 {
+				hostVars[h.Name] = h.Vars
+			}
+		}
+		out[name] = group
+	}
+	out[terraformName(inv.Cluster)] = cluster
+	out["_meta"] = map[string]interface{}{"hostvars": hostVars}
+	return json.MarshalIndent(out, "", "  ")
+}
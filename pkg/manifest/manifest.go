@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+)
+
+const (
+	FormatJSON      = "json"
+	FormatTerraform = "terraform"
+)
+
+// Instance is a machine of the cluster, Role is "master" or "node"
+type Instance struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	IP   string `json:"ip,omitempty"`
+}
+
+// Resources are the cloud resources of one cluster, the json form is stable for inventory tools
+type Resources struct {
+	Cluster   string              `json:"cluster"`
+	Zone      string              `json:"zone"`
+	TagID     string              `json:"tag"`
+	Instances []Instance          `json:"instances"`
+	Others    map[string][]string `json:"resources,omitempty"`
+}
+
+// terraformTypes maps our resource types to ones of the qingcloud terraform provider
+var terraformTypes = map[string]string{
+	api.ResourceTypeEIP:     "qingcloud_eip",
+	api.ResourceTypeVolume:  "qingcloud_volume",
+	api.ResourceTypeKeyPair: "qingcloud_keypair",
+}
+
+// FormatOf tells the format by extension of path, files ending with .tf are terraform
+func FormatOf(path string) string {
+	if strings.HasSuffix(path, ".tf") {
+		return FormatTerraform
+	}
+	return FormatJSON
+}
+
+func (r *Resources) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(r, "", "  ")
+	case FormatTerraform:
+		return r.terraform(), nil
+	}
+	return nil, api.NewValidationError("Unknown manifest format %s, available formats: %s, %s", format, FormatJSON, FormatTerraform)
+}
+
+// terraform writes import blocks, so terraform can adopt the resources with 'terraform plan -generate-config-out'
+func (r *Resources) terraform() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# resources of qks cluster %s in zone %s\n", r.Cluster, r.Zone)
+	name := terraformName(r.Cluster)
+	writeImport(&b, "qingcloud_tag", name, r.TagID)
+	for i, ins := range r.Instances {
+		writeImport(&b, "qingcloud_instance", fmt.Sprintf("%s_%s_%d", name, ins.Role, i), ins.ID)
+	}
+	kinds := make([]string, 0, len(r.Others))
+	for kind := range r.Others {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		t, ok := terraformTypes[kind]
+		if !ok {
+			fmt.Fprintf(&b, "\n# %s %s cannot be imported\n", kind, strings.Join(r.Others[kind], ", "))
+			continue
+		}
+		for i, id := range r.Others[kind] {
+			writeImport(&b, t, fmt.Sprintf("%s_%d", name, i), id)
+		}
+	}
+	return []byte(b.String())
+}
+
+func writeImport(b *strings.Builder, resourceType, name, id string) {
+	fmt.Fprintf(b, "\nimport {\n  to = %s.%s\n  id = %q\n}\n", resourceType, name, id)
+}
+
+// terraformName turns a cluster name into a valid terraform identifier
+func terraformName(s string) string {
+	out := []rune(s)
+	for i, c := range out {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			out[i] = '_'
+		}
+	}
+	if len(out) == 0 || out[0] >= '0' && out[0] <= '9' {
+		return "cluster_" + string(out)
+	}
+	return string(out)
+}
+
+// Write renders the resources in the format told by extension of path
+func (r *Resources) Write(path string) error {
+	content, err := r.Render(FormatOf(path))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
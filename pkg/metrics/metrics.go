@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var DefaultBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// OperationBuckets fit whole creations and deletions, which take minutes
+var OperationBuckets = []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 3600}
+
+var (
+	ClustersCreated = NewCounter("qks_clusters_created_total", "Number of cluster creations by result", "result")
+	ClustersDeleted = NewCounter("qks_clusters_deleted_total", "Number of cluster deletions by result", "result")
+	PhaseDuration   = NewHistogram("qks_phase_duration_seconds", "Duration of each provisioning phase", DefaultBuckets, "operation", "phase")
+	APIRequests     = NewCounter("qks_qingcloud_api_requests_total", "Number of QingCloud API calls by action and result", "action", "result")
+	APIDuration     = NewHistogram("qks_qingcloud_api_request_duration_seconds", "Latency of QingCloud API calls", DefaultBuckets, "action")
+	SSHRetries      = NewCounter("qks_ssh_retries_total", "Number of retried ssh connections", "host")
+
+	OperationDuration = NewHistogram("qks_operation_duration_seconds", "Duration of whole cluster creations and deletions by result", OperationBuckets, "operation", "result")
+)
+
+var registry = []collector{ClustersCreated, ClustersDeleted, PhaseDuration, APIRequests, APIDuration, SSHRetries, OperationDuration}
+
+type collector interface {
+	write(io.Writer)
+}
+
+// Result returns the value of the "result" label for an error
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// ObserveOperation records how long an operation like create took since start and how it ended
+func ObserveOperation(operation string, start time.Time, err error) {
+	OperationDuration.Observe(time.Since(start).Seconds(), operation, Result(err))
+}
+
+// ObservePhase records the time elapsed since start, it is meant to be used with defer
+func ObservePhase(operation, phase string, start time.Time) {
+	PhaseDuration.Observe(time.Since(start).Seconds(), operation, phase)
+}
+
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, "\xff")] += v
+}
+
+func (c *Counter) Get(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, key, ""), c.values[key])
+	}
+}
+
+type histogramValue struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{buckets: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			value.buckets[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, fmt.Sprintf("%g", upper)), value.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "+Inf"), value.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, key, ""), value.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, ""), value.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(names []string, key string, le string) string {
+	pairs := make([]string, 0, len(names)+1)
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteTo writes all metrics in the prometheus text exposition format
+func WriteTo(w io.Writer) {
+	for _, c := range registry {
+		c.write(w)
+	}
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteTo(w)
+	})
+}
+
+// Serve exposes /metrics on addr in background
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		klog.Infof("Serving metrics on %s/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			klog.Errorf("Metrics server exited, err: %s", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	It("Should write counters and histograms in text format", func() {
+		c := metrics.NewCounter("test_total", "test counter", "result")
+		c.Inc("success")
+		c.Add(2, "success")
+		Expect(c.Get("success")).To(Equal(float64(3)))
+		metrics.PhaseDuration.Observe(3, "create", "join")
+		var buf bytes.Buffer
+		metrics.WriteTo(&buf)
+		Expect(buf.String()).To(ContainSubstring(`qks_phase_duration_seconds_bucket{operation="create",phase="join",le="5"} 1`))
+		Expect(buf.String()).To(ContainSubstring(`qks_phase_duration_seconds_bucket{operation="create",phase="join",le="2.5"} 0`))
+		Expect(buf.String()).To(ContainSubstring(`qks_phase_duration_seconds_count{operation="create",phase="join"} 1`))
+	})
+
+	It("Should get api action from request", func() {
+		req, _ := http.NewRequest("GET", "https://api.qingcloud.com/iaas/?action=RunInstances&zone=ap2a", nil)
+		Expect(metrics.APIAction(req)).To(Equal("RunInstances"))
+		req, _ = http.NewRequest("POST", "https://api.qingcloud.com/iaas/", strings.NewReader("action=DescribeTags&zone=ap2a"))
+		Expect(metrics.APIAction(req)).To(Equal("DescribeTags"))
+	})
+
+	It("Should count api calls refused by qingcloud as failures", func() {
+		retCode := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"action":"DescribeZonesResponse","ret_code":%d}`, retCode)
+		}))
+		defer server.Close()
+		client := &http.Client{Transport: metrics.InstrumentTransport(nil)}
+		success, failure := metrics.APIRequests.Get("DescribeZones", "success"), metrics.APIRequests.Get("DescribeZones", "failure")
+		resp, err := client.Get(server.URL + "/iaas/?action=DescribeZones")
+		Expect(err).ShouldNot(HaveOccurred())
+		resp.Body.Close()
+		retCode = 2100
+		resp, err = client.Get(server.URL + "/iaas/?action=DescribeZones")
+		Expect(err).ShouldNot(HaveOccurred())
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(string(body)).To(ContainSubstring(`"ret_code":2100`))
+		Expect(metrics.APIRequests.Get("DescribeZones", "success")).To(Equal(success + 1))
+		Expect(metrics.APIRequests.Get("DescribeZones", "failure")).To(Equal(failure + 1))
+	})
+
+	It("Should push all metrics to the pushgateway grouped by job and labels", func() {
+		var method, path, contentType, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}))
+		defer server.Close()
+		Expect(metrics.ConfigurePush(server.URL+"/", "", "instance=ci-1")).To(Succeed())
+		defer metrics.ConfigurePush("", "")
+		metrics.ObserveOperation("create", time.Now().Add(-90*time.Second), nil)
+		metrics.Push()
+		Expect(method).To(Equal(http.MethodPut))
+		Expect(path).To(Equal("/metrics/job/qks/instance/ci-1"))
+		Expect(contentType).To(HavePrefix("text/plain"))
+		Expect(body).To(ContainSubstring(`qks_operation_duration_seconds_bucket{operation="create",result="success",le="120"} 1`))
+		Expect(body).To(ContainSubstring(`qks_operation_duration_seconds_bucket{operation="create",result="success",le="60"} 0`))
+	})
+
+	It("Should reject an invalid pushgateway", func() {
+		Expect(metrics.ConfigurePush("pushgateway:9091", "qks")).NotTo(Succeed())
+		Expect(metrics.ConfigurePush("http://pushgateway:9091", "qks", "instance")).NotTo(Succeed())
+		Expect(metrics.ConfigurePush("", "qks")).To(Succeed())
+	})
+})
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// EnvPushgateway is the environment variable of the pushgateway, so runs in CI push without flags
+const EnvPushgateway = "QKS_PUSHGATEWAY"
+
+// DefaultPushJob is the job label of metrics pushed to a pushgateway if none is given
+const DefaultPushJob = "qks"
+
+var pushURL string
+
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// ConfigurePush sets the pushgateway metrics are pushed to once an operation finishes, so one-shot runs of the cli can
+// be charted like a server. labels in form of 'name=value' group the metrics with job, an empty gateway disables pushing.
+func ConfigurePush(gateway, job string, labels ...string) error {
+	pushURL = ""
+	if gateway == "" {
+		return nil
+	}
+	u, err := url.Parse(gateway)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Pushgateway %s must be an url like 'http://pushgateway:9091'", gateway)
+	}
+	if job == "" {
+		job = DefaultPushJob
+	}
+	path := "/metrics/job/" + url.PathEscape(job)
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("Label %s of pushgateway must be in form of 'name=value'", l)
+		}
+		path += "/" + url.PathEscape(kv[0]) + "/" + url.PathEscape(kv[1])
+	}
+	pushURL = strings.TrimSuffix(gateway, "/") + path
+	return nil
+}
+
+// Push replaces metrics of the group on the configured pushgateway with all metrics of this run, failures are only
+// logged since metrics must not fail an operation
+func Push() {
+	if pushURL == "" {
+		return
+	}
+	if err := pushTo(pushURL); err != nil {
+		klog.Warningf("Failed to push metrics to %s, err: %s", pushURL, err.Error())
+	}
+}
+
+func pushTo(target string) error {
+	var buf bytes.Buffer
+	WriteTo(&buf)
+	req, err := http.NewRequest(http.MethodPut, target, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("pushgateway responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// InstrumentTransport wraps the transport used by the qingcloud sdk to count api calls
+func InstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	action := APIAction(req)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	APIDuration.Observe(time.Since(start).Seconds(), action)
+	result := Result(err)
+	if err == nil && (resp.StatusCode >= 400 || refused(resp)) {
+		result = "failure"
+	}
+	APIRequests.Inc(action, result)
+	return resp, err
+}
+
+// refused tells whether qingcloud answers with a non-zero ret code, which comes with status 200.
+// The body is read and put back for the sdk.
+func refused(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+	answer := struct {
+		RetCode int `json:"ret_code"`
+	}{}
+	return json.Unmarshal(body, &answer) == nil && answer.RetCode != 0
+}
+
+// APIAction gets the api name of a qingcloud request, which is passed as "action" in query or form
+func APIAction(req *http.Request) string {
+	if action := req.URL.Query().Get("action"); action != "" {
+		return action
+	}
+	if req.Body != nil && req.Method == http.MethodPost {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err == nil {
+			if values, err := url.ParseQuery(string(body)); err == nil && values.Get("action") != "" {
+				return values.Get("action")
+			}
+		}
+	}
+	return "unknown"
+}
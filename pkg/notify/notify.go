@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	TypeGeneric  = "http"
+	TypeSlack    = "slack"
+	TypeDingTalk = "dingtalk"
+)
+
+// Event describes a finished operation
+type Event struct {
+	Operation   string        `json:"operation"`
+	ClusterName string        `json:"clusterName"`
+	Success     bool          `json:"success"`
+	Duration    time.Duration `json:"-"`
+	Error       string        `json:"error,omitempty"`
+	// Message is set by events of watching instead of finished operations
+	Message string `json:"message,omitempty"`
+}
+
+// MarshalJSON gives the duration in seconds as duration_seconds, nanoseconds of time.Duration mean nothing to receivers
+func (e *Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return json.Marshal(&struct {
+		*event
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{(*event)(e), e.Duration.Seconds()})
+}
+
+func NewEvent(operation, clusterName string, start time.Time, err error) *Event {
+	e := &Event{
+		Operation:   operation,
+		ClusterName: clusterName,
+		Success:     err == nil,
+		Duration:    time.Since(start),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// NewMessageEvent tells something happening to a cluster, healthy is reported as Success
+func NewMessageEvent(operation, clusterName, message string, healthy bool) *Event {
+	return &Event{
+		Operation:   operation,
+		ClusterName: clusterName,
+		Success:     healthy,
+		Message:     message,
+	}
+}
+
+// Summary is the human readable message used in chat notifications
+func (e *Event) Summary() string {
+	if e.Message != "" {
+		return fmt.Sprintf("[qks] %s of cluster %s: %s", e.Operation, e.ClusterName, e.Message)
+	}
+	result := "succeeded"
+	if !e.Success {
+		result = "failed"
+	}
+	msg := fmt.Sprintf("[qks] %s of cluster %s %s in %s", e.Operation, e.ClusterName, result, e.Duration.Round(time.Second))
+	if e.Error != "" {
+		msg += ", err: " + e.Error
+	}
+	return msg
+}
+
+type Notifier interface {
+	Notify(*Event) error
+}
+
+type webhook struct {
+	kind   string
+	url    string
+	client *http.Client
+}
+
+// NewWebhook parses a webhook in form of "[type=]url", type can be http, slack or dingtalk, default is http
+func NewWebhook(spec string) (Notifier, error) {
+	kind := TypeGeneric
+	addr := spec
+	if i := strings.Index(spec, "="); i != -1 && !strings.Contains(spec[:i], "/") {
+		kind, addr = spec[:i], spec[i+1:]
+	}
+	if kind != TypeGeneric && kind != TypeSlack && kind != TypeDingTalk {
+		return nil, fmt.Errorf("Unknown webhook type %s", kind)
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return nil, fmt.Errorf("Invalid webhook url of type %s, it must start with http:// or https://", kind)
+	}
+	return &webhook{
+		kind:   kind,
+		url:    addr,
+		client: &http.Client{Timeout: time.Second * 10},
+	}, nil
+}
+
+func (w *webhook) payload(e *Event) interface{} {
+	switch w.kind {
+	case TypeSlack:
+		return map[string]string{"text": e.Summary()}
+	case TypeDingTalk:
+		return map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": e.Summary()},
+		}
+	}
+	return e
+}
+
+func (w *webhook) Notify(e *Event) error {
+	body, err := json.Marshal(w.payload(e))
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// errors of the client hold the url, which is the credential of slack and dingtalk webhooks
+		if u, ok := err.(*url.Error); ok {
+			err = u.Err
+		}
+		return fmt.Errorf("Failed to post to webhook %s, err: %s", w.host(), err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook %s returns %s", w.host(), resp.Status)
+	}
+	return nil
+}
+
+// host is the webhook to be logged, without the path and query its token is in
+func (w *webhook) host() string {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return w.kind + " webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+var notifiers []Notifier
+
+// Register adds webhooks which will be fired by Send
+func Register(specs ...string) error {
+	for _, spec := range specs {
+		n, err := NewWebhook(spec)
+		if err != nil {
+			return err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return nil
+}
+
+// Send fires all registered webhooks, failures are only logged
+func Send(e *Event) {
+	for _, n := range notifiers {
+		if err := n.Notify(e); err != nil {
+			klog.Warningf("Failed to send notification, err: %s", err.Error())
+		}
+	}
+}
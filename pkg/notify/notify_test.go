@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Notify", func() {
+	var (
+		bodies map[string][]map[string]interface{}
+		status int
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		notifiers = nil
+		bodies = make(map[string][]map[string]interface{})
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			content, _ := ioutil.ReadAll(r.Body)
+			body := make(map[string]interface{})
+			Expect(json.Unmarshal(content, &body)).To(Succeed())
+			bodies[r.URL.Path] = append(bodies[r.URL.Path], body)
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		notifiers = nil
+		server.Close()
+	})
+
+	It("Should post events in the body of every type of webhook", func() {
+		Expect(Register(server.URL+"/generic", "slack="+server.URL+"/slack", "dingtalk="+server.URL+"/dingtalk")).To(Succeed())
+		Send(NewEvent("create", "test", time.Now().Add(-90*time.Second), fmt.Errorf("no capacity")))
+
+		Expect(bodies["/generic"]).To(HaveLen(1))
+		generic := bodies["/generic"][0]
+		Expect(generic).To(HaveKeyWithValue("operation", "create"))
+		Expect(generic).To(HaveKeyWithValue("clusterName", "test"))
+		Expect(generic).To(HaveKeyWithValue("success", false))
+		Expect(generic).To(HaveKeyWithValue("error", "no capacity"))
+		Expect(generic["duration_seconds"]).To(BeNumerically(">=", 90))
+		Expect(generic).NotTo(HaveKey("duration"))
+		Expect(generic).NotTo(HaveKey("message"))
+
+		summary := "[qks] create of cluster test failed in 1m30s, err: no capacity"
+		Expect(bodies["/slack"]).To(Equal([]map[string]interface{}{{"text": summary}}))
+		Expect(bodies["/dingtalk"]).To(Equal([]map[string]interface{}{{
+			"msgtype": "text",
+			"text":    map[string]interface{}{"content": summary},
+		}}))
+
+		Send(NewMessageEvent("watch", "test", "node node3 is NotReady", false))
+		Expect(bodies["/slack"][1]).To(HaveKeyWithValue("text", "[qks] watch of cluster test: node node3 is NotReady"))
+		Expect(bodies["/generic"][1]).To(HaveKeyWithValue("message", "node node3 is NotReady"))
+		Expect(bodies["/generic"][1]).NotTo(HaveKey("error"))
+	})
+
+	It("Should only log webhooks which fail, later ones are still fired", func() {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		Expect(Register(closed.URL+"/gone", server.URL+"/failing", "slack="+server.URL+"/slack")).To(Succeed())
+		status = http.StatusInternalServerError
+		Expect(func() { Send(NewEvent("delete", "test", time.Now(), nil)) }).NotTo(Panic())
+		Expect(bodies["/failing"]).To(HaveLen(1))
+		Expect(bodies["/slack"]).To(HaveLen(1))
+		Expect(bodies["/slack"][0]["text"]).To(HavePrefix("[qks] delete of cluster test succeeded"))
+
+		err := notifiers[1].Notify(NewEvent("delete", "test", time.Now(), nil))
+		Expect(err).To(MatchError(ContainSubstring("500")))
+		Expect(err.Error()).NotTo(ContainSubstring("/failing"))
+		err = notifiers[0].Notify(NewEvent("delete", "test", time.Now(), nil))
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).NotTo(ContainSubstring("/gone"))
+	})
+
+	It("Should reject webhooks of unknown types or urls", func() {
+		_, err := NewWebhook("teams=https://example.com/hook")
+		Expect(err).To(MatchError("Unknown webhook type teams"))
+		_, err = NewWebhook("slack=hooks.slack.com/services/x")
+		Expect(err).To(MatchError(ContainSubstring("Invalid webhook url")))
+		// an = in the url is not taken as the type
+		w, err := NewWebhook("https://example.com/hook?token=abc")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(w.(*webhook).kind).To(Equal(TypeGeneric))
+		Expect(Register("teams=https://example.com/hook")).Should(HaveOccurred())
+		Expect(notifiers).To(BeEmpty())
+	})
+})
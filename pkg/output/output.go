@@ -0,0 +1,32 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type Mode int
+
+const (
+	// Quiet prints only the final result or errors
+	Quiet Mode = iota
+	// Normal prints progress logs and a human summary in the end
+	Normal
+	// Verbose also prints output of remote commands
+	Verbose
+)
+
+var (
+	CurrentMode           = Normal
+	Out         io.Writer = os.Stdout
+)
+
+// Printf writes to the output in all modes
+func Printf(format string, args ...interface{}) {
+	fmt.Fprintf(Out, format, args...)
+}
+
+func IsQuiet() bool {
+	return CurrentMode == Quiet
+}
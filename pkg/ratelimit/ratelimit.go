@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter lets events happen at rate per second on average, with bursts up to burst events.
+// It is shared by operations running in parallel, so together they stay under limits of qingcloud.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter which is full at first, a burst less than 1 is 1
+func New(rate float64, burst int) *Limiter {
+	b := float64(burst)
+	if b < 1 {
+		b = 1
+	}
+	return &Limiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// Wait blocks until an event is allowed, a nil limiter never blocks
+func (l *Limiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		// the token is borrowed from the future, later callers wait behind this one
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type transport struct {
+	next    http.RoundTripper
+	limiter *Limiter
+}
+
+// Transport waits for limiter before every request through next, next is returned if limiter is nil
+func Transport(next http.RoundTripper, limiter *Limiter) http.RoundTripper {
+	if limiter == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next, limiter: limiter}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.limiter.Wait()
+	return t.next.RoundTrip(req)
+}
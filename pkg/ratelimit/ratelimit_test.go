@@ -0,0 +1,37 @@
+package ratelimit_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/ratelimit"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	It("Should allow a burst and then the rate shared by callers", func() {
+		l := ratelimit.New(50, 5)
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					l.Wait()
+				}
+			}()
+		}
+		wg.Wait()
+		// 5 at once, the other 15 take 300ms at 50 per second
+		Expect(time.Since(start)).To(BeNumerically(">=", 280*time.Millisecond))
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("Should never block if it is nil", func() {
+		var l *ratelimit.Limiter
+		l.Wait()
+		Expect(ratelimit.Transport(nil, nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,45 @@
+package fake
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/resourcegroup"
+)
+
+var _ resourcegroup.Interface = &ResourceGroupService{}
+
+// ResourceGroupService keeps resources added to each group in memory
+type ResourceGroupService struct {
+	recorder.Recorder
+	Groups map[string][]string
+}
+
+// NewResourceGroupService returns a fake where the given groups exist
+func NewResourceGroupService(groups ...string) *ResourceGroupService {
+	f := &ResourceGroupService{Groups: make(map[string][]string)}
+	for _, g := range groups {
+		f.Groups[g] = nil
+	}
+	return f
+}
+
+func (f *ResourceGroupService) CheckResourceGroup(group string) error {
+	if err := f.Record("CheckResourceGroup", group); err != nil {
+		return err
+	}
+	if _, ok := f.Groups[group]; !ok {
+		return api.NewValidationError("Resource group %s does not exist", group)
+	}
+	return nil
+}
+
+func (f *ResourceGroupService) AddResources(group string, ids []string) error {
+	if err := f.Record("AddResources", group, ids); err != nil {
+		return err
+	}
+	if _, ok := f.Groups[group]; !ok {
+		return api.NewValidationError("Resource group %s does not exist", group)
+	}
+	f.Groups[group] = append(f.Groups[group], ids...)
+	return nil
+}
@@ -0,0 +1,7 @@
+package resourcegroup
+
+type Interface interface {
+	// CheckResourceGroup fails if the group does not exist or cannot be seen with the access key
+	CheckResourceGroup(group string) error
+	AddResources(group string, ids []string) error
+}
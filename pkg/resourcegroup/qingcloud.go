@@ -0,0 +1,97 @@
+package resourcegroup
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/yunify/qingcloud-sdk-go/config"
+	"github.com/yunify/qingcloud-sdk-go/request"
+	"github.com/yunify/qingcloud-sdk-go/request/data"
+	"github.com/yunify/qingcloud-sdk-go/service"
+)
+
+// the vendored sdk has no resource group apis, the operations below are built the same way as generated ones
+type qingcloudResourceGroup struct {
+	config     *config.Config
+	properties *properties
+}
+
+type properties struct {
+	Zone *string `json:"zone" name:"zone"`
+}
+
+func NewQingCloudResourceGroupService(config *config.Config, zone string) Interface {
+	return &qingcloudResourceGroup{
+		config:     config,
+		properties: &properties{Zone: &zone},
+	}
+}
+
+type describeResourceGroupsInput struct {
+	ResourceGroups []*string `json:"resource_groups" name:"resource_groups" location:"params"`
+}
+
+func (v *describeResourceGroupsInput) Validate() error {
+	return nil
+}
+
+type describeResourceGroupsOutput struct {
+	Message          *string `json:"message" name:"message"`
+	Action           *string `json:"action" name:"action" location:"elements"`
+	ResourceGroupSet []*struct {
+		ResourceGroupID *string `json:"resource_group_id" name:"resource_group_id"`
+	} `json:"resource_group_set" name:"resource_group_set" location:"elements"`
+	RetCode    *int `json:"ret_code" name:"ret_code" location:"elements"`
+	TotalCount *int `json:"total_count" name:"total_count" location:"elements"`
+}
+
+type addResourceGroupItemsInput struct {
+	ResourceGroup *string   `json:"resource_group" name:"resource_group" location:"params"`
+	Resources     []*string `json:"resources" name:"resources" location:"params"`
+}
+
+func (v *addResourceGroupItemsInput) Validate() error {
+	return nil
+}
+
+type addResourceGroupItemsOutput struct {
+	Message *string `json:"message" name:"message"`
+	Action  *string `json:"action" name:"action" location:"elements"`
+	RetCode *int    `json:"ret_code" name:"ret_code" location:"elements"`
+}
+
+func (q *qingcloudResourceGroup) send(apiName string, input data.Input, output interface{}) error {
+	o := &data.Operation{
+		Config:        q.config,
+		Properties:    q.properties,
+		APIName:       apiName,
+		RequestMethod: "GET",
+	}
+	r, err := request.New(o, input, output)
+	if err != nil {
+		return err
+	}
+	return r.Send()
+}
+
+func (q *qingcloudResourceGroup) CheckResourceGroup(group string) error {
+	output := &describeResourceGroupsOutput{}
+	err := q.send("DescribeResourceGroups", &describeResourceGroupsInput{ResourceGroups: service.StringSlice([]string{group})}, output)
+	if err != nil {
+		return api.FromQingCloud(err, "Error in describing resource group %s", group)
+	}
+	if len(output.ResourceGroupSet) == 0 {
+		return api.NewValidationError("Resource group %s does not exist", group)
+	}
+	return nil
+}
+
+func (q *qingcloudResourceGroup) AddResources(group string, ids []string) error {
+	input := &addResourceGroupItemsInput{
+		ResourceGroup: &group,
+		Resources:     service.StringSlice(ids),
+	}
+	output := &addResourceGroupItemsOutput{}
+	if err := q.send("AddResourceGroupItems", input, output); err != nil {
+		return api.FromQingCloud(err, "Error in adding resources to group %s", group)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package resourcegroup
+
+import (
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedResourceGroup struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given resource group service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedResourceGroup{Interface: i, scope: scope}
+}
+
+func (t *tracedResourceGroup) CheckResourceGroup(group string) error {
+	span := t.scope.Start("resourcegroup.CheckResourceGroup")
+	span.SetAttribute("resourcegroup.id", group)
+	err := t.Interface.CheckResourceGroup(group)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedResourceGroup) AddResources(group string, ids []string) error {
+	span := t.scope.Start("resourcegroup.AddResources")
+	span.SetAttribute("resourcegroup.id", group)
+	span.SetAttribute("resourcegroup.resources", strings.Join(ids, ","))
+	err := t.Interface.AddResources(group, ids)
+	span.Finish(err)
+	return err
+}
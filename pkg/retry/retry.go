@@ -10,8 +10,8 @@ var errMaxRetriesReached = errors.New("exceeded retry limit")
 // Func represents functions that can be retried.
 type Func func() error
 
-// Do keeps trying the function until the second argument
-// returns false, or no error is returned.
+// Do keeps trying the function, waiting interval between attempts, until no error is returned
+// or it has been tried maxRetries times.
 func Do(maxRetries int, interval time.Duration, fn Func) error {
 	var err error
 	attempt := 1
@@ -24,6 +24,29 @@ func Do(maxRetries int, interval time.Duration, fn Func) error {
 		if attempt > maxRetries {
 			return errMaxRetriesReached
 		}
+		time.Sleep(interval)
+	}
+}
+
+// Until keeps trying the function every interval until no error is returned or timeout passes,
+// the timeout is of wall clock as an attempt may take longer than interval, like ssh to a machine which is down.
+// It returns the last error of the function.
+func Until(timeout, interval time.Duration, fn Func) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return err
+		}
+		// the last attempt is at the deadline
+		if wait > interval {
+			wait = interval
+		}
+		time.Sleep(wait)
 	}
 }
 
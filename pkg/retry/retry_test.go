@@ -14,7 +14,7 @@ var _ = Describe("Retry", func() {
 		var alwaysError = func() error {
 			return fmt.Errorf("Error")
 		}
-		err := retry.Do(5, time.Second, alwaysError)
+		err := retry.Do(5, time.Millisecond, alwaysError)
 		Expect(retry.IsMaxRetries(err)).To(BeTrue())
 	})
 
@@ -27,6 +27,35 @@ var _ = Describe("Retry", func() {
 			i++
 			return fmt.Errorf("Error")
 		}
-		Expect(retry.Do(5, time.Second, willOK)).ShouldNot(HaveOccurred())
+		Expect(retry.Do(5, time.Millisecond, willOK)).ShouldNot(HaveOccurred())
+	})
+
+	It("Should wait for the interval between attempts", func() {
+		start := time.Now()
+		Expect(retry.IsMaxRetries(retry.Do(3, 50*time.Millisecond, func() error { return fmt.Errorf("Error") }))).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("Should try until the timeout however long an attempt takes", func() {
+		attempts := 0
+		start := time.Now()
+		err := retry.Until(250*time.Millisecond, 10*time.Millisecond, func() error {
+			attempts++
+			time.Sleep(100 * time.Millisecond)
+			return fmt.Errorf("attempt %d", attempts)
+		})
+		Expect(err).To(MatchError(fmt.Sprintf("attempt %d", attempts)))
+		Expect(attempts).To(BeNumerically("<=", 4))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		attempts = 0
+		Expect(retry.Until(time.Second, time.Millisecond, func() error {
+			attempts++
+			if attempts == 3 {
+				return nil
+			}
+			return fmt.Errorf("Error")
+		})).To(Succeed())
+		Expect(attempts).To(Equal(3))
 	})
 })
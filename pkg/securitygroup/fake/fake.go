@@ -0,0 +1,34 @@
+package fake
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/securitygroup"
+)
+
+var _ securitygroup.Interface = &SecurityGroupService{}
+
+// SecurityGroupService knows which security groups exist
+type SecurityGroupService struct {
+	recorder.Recorder
+	Groups map[string]bool
+}
+
+// NewSecurityGroupService returns a fake where the given security groups exist
+func NewSecurityGroupService(groups ...string) *SecurityGroupService {
+	f := &SecurityGroupService{Groups: make(map[string]bool)}
+	for _, g := range groups {
+		f.Groups[g] = true
+	}
+	return f
+}
+
+func (f *SecurityGroupService) CheckSecurityGroup(id string) error {
+	if err := f.Record("CheckSecurityGroup", id); err != nil {
+		return err
+	}
+	if !f.Groups[id] {
+		return api.NewValidationError("Security group %s does not exist", id)
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+package securitygroup
+
+type Interface interface {
+	// CheckSecurityGroup fails if the security group does not exist or cannot be seen with the access key
+	CheckSecurityGroup(id string) error
+}
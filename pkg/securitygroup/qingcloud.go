@@ -0,0 +1,27 @@
+package securitygroup
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/yunify/qingcloud-sdk-go/service"
+)
+
+type qingcloudSecurityGroup struct {
+	securityGroupService *service.SecurityGroupService
+}
+
+func NewQingCloudSecurityGroupService(s *service.SecurityGroupService) Interface {
+	return &qingcloudSecurityGroup{securityGroupService: s}
+}
+
+func (q *qingcloudSecurityGroup) CheckSecurityGroup(id string) error {
+	output, err := q.securityGroupService.DescribeSecurityGroups(&service.DescribeSecurityGroupsInput{
+		SecurityGroups: service.StringSlice([]string{id}),
+	})
+	if err != nil {
+		return api.FromQingCloud(err, "Error in describing security group %s", id)
+	}
+	if len(output.SecurityGroupSet) == 0 {
+		return api.NewValidationError("Security group %s does not exist", id)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package securitygroup
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedSecurityGroup struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given security group service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedSecurityGroup{Interface: i, scope: scope}
+}
+
+func (t *tracedSecurityGroup) CheckSecurityGroup(id string) error {
+	span := t.scope.Start("securitygroup.CheckSecurityGroup")
+	span.SetAttribute("securitygroup.id", id)
+	err := t.Interface.CheckSecurityGroup(id)
+	span.Finish(err)
+	return err
+}
@@ -0,0 +1,173 @@
+package fake
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/ssh"
+)
+
+var _ ssh.Runner = &Runner{}
+
+type response struct {
+	substr string
+	output string
+	err    error
+}
+
+// Runner records commands instead of running them, outputs can be stubbed by a substring of the command
+type Runner struct {
+	recorder.Recorder
+
+	mu          sync.Mutex
+	responses   []response
+	files       map[string][]byte
+	modes       map[string]os.FileMode
+	unreachable map[string]bool
+}
+
+func NewRunner() *Runner {
+	return &Runner{
+		files:       make(map[string][]byte),
+		modes:       make(map[string]os.FileMode),
+		unreachable: make(map[string]bool),
+	}
+}
+
+// Unreachable makes every call to host fail as if ssh cannot connect to it, like to a machine which never boots
+func (f *Runner) Unreachable(host string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unreachable[host] = true
+}
+
+func (f *Runner) reach(host string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.unreachable[host] {
+		return &ssh.UnreachableError{Host: host, Err: fmt.Errorf("dial tcp %s:22: i/o timeout", host)}
+	}
+	return nil
+}
+
+// RespondTo makes commands containing substr return output and err, later stubs win
+func (f *Runner) RespondTo(substr, output string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, response{substr: substr, output: output, err: err})
+}
+
+func (f *Runner) respond(cmd string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.responses) - 1; i >= 0; i-- {
+		r := f.responses[i]
+		if strings.Contains(cmd, r.substr) {
+			return []byte(r.output), r.err
+		}
+	}
+	return nil, nil
+}
+
+func (f *Runner) Run(host, cmd string) error {
+	if err := f.Record("Run", host, cmd); err != nil {
+		return err
+	}
+	if err := f.reach(host); err != nil {
+		return err
+	}
+	_, err := f.respond(cmd)
+	return err
+}
+
+func (f *Runner) RunAndGetOutput(host, cmd string) ([]byte, error) {
+	if err := f.Record("RunAndGetOutput", host, cmd); err != nil {
+		return nil, err
+	}
+	if err := f.reach(host); err != nil {
+		return nil, err
+	}
+	return f.respond(cmd)
+}
+
+func (f *Runner) Upload(host string, content []byte, path string, mode os.FileMode) error {
+	if err := f.Record("Upload", host, path, mode); err != nil {
+		return err
+	}
+	if err := f.reach(host); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[host+":"+path] = content
+	f.modes[host+":"+path] = mode
+	return nil
+}
+
+// Download writes the content uploaded to path on host, or the output stubbed for path
+func (f *Runner) Download(host, path string, w io.Writer) error {
+	if err := f.Record("Download", host, path); err != nil {
+		return err
+	}
+	if err := f.reach(host); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	content, ok := f.files[host+":"+path]
+	f.mu.Unlock()
+	if !ok {
+		output, err := f.respond(path)
+		if err != nil {
+			return err
+		}
+		content = output
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+// File returns the content uploaded to path on host
+func (f *Runner) File(host, path string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, ok := f.files[host+":"+path]
+	return string(content), ok
+}
+
+// FileMode returns the mode path on host is uploaded with, 0 if it is not uploaded
+func (f *Runner) FileMode(host, path string) os.FileMode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.modes[host+":"+path]
+}
+
+// CommandsOn returns all commands run on host in order
+func (f *Runner) CommandsOn(host string) []string {
+	result := make([]string, 0)
+	for _, c := range f.Calls() {
+		if c.Method != "Upload" && c.Method != "Download" && c.Args[0] == host {
+			result = append(result, c.Args[1].(string))
+		}
+	}
+	return result
+}
+
+// HistoryOn returns commands run on host and uploads to it in order, an upload is like "upload 0600 /path"
+func (f *Runner) HistoryOn(host string) []string {
+	result := make([]string, 0)
+	for _, c := range f.Calls() {
+		if c.Args[0] != host || c.Method == "Download" {
+			continue
+		}
+		if c.Method == "Upload" {
+			result = append(result, fmt.Sprintf("upload %04o %s", c.Args[2], c.Args[1]))
+		} else {
+			result = append(result, c.Args[1].(string))
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package ssh
+
+import (
+	"io"
+	"os"
+)
+
+// Runner runs commands on machines, it is the seam between orchestration and real ssh connections
+type Runner interface {
+	// Run runs cmd on host, output goes to stdout and stderr
+	Run(host, cmd string) error
+	// RunAndGetOutput runs cmd on host and returns the combined output
+	RunAndGetOutput(host, cmd string) ([]byte, error)
+	// Upload writes content to the file at path on host with mode, it is not readable by others before it has mode
+	Upload(host string, content []byte, path string, mode os.FileMode) error
+	// Download streams the file at path on host to w, for files too large to be read as output
+	Download(host, path string, w io.Writer) error
+}
+
+type defaultRunner struct{}
+
+// NewDefaultRunner connects as root with the default ssh key
+func NewDefaultRunner() Runner {
+	return defaultRunner{}
+}
+
+func (defaultRunner) Run(host, cmd string) error {
+	return QuickConnectAndRun(host, cmd)
+}
+
+func (defaultRunner) RunAndGetOutput(host, cmd string) ([]byte, error) {
+	return QuickConnectAndGetRunOutput(host, cmd)
+}
+
+func (defaultRunner) Upload(host string, content []byte, path string, mode os.FileMode) error {
+	return QuickUpload(host, content, path, mode)
+}
+
+func (defaultRunner) Download(host, path string, w io.Writer) error {
+	return QuickDownload(host, path, w)
+}
@@ -1,47 +1,179 @@
 package ssh
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"time"
 
+	"github.com/magicsong/yunify-k8s/pkg/metrics"
+	"github.com/magicsong/yunify-k8s/pkg/retry"
 	"golang.org/x/crypto/ssh"
 	"k8s.io/client-go/util/homedir"
 )
 
 func QuickConnectAndRun(host, cmd string) error {
-	s, err := QuickConnectUsingDefaultSSHKey(host)
+	client, err := quickDial(host)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
+	s, err := newSessionWithPty(client)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
 	s.Stdout = os.Stdout
 	s.Stderr = os.Stderr
 	return s.Run(cmd)
 }
 
 func QuickConnectAndGetRunOutput(host, cmd string) ([]byte, error) {
-	s, err := QuickConnectUsingDefaultSSHKey(host)
+	client, err := quickDial(host)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	s, err := newSessionWithPty(client)
 	if err != nil {
 		return nil, err
 	}
+	defer s.Close()
 	return s.CombinedOutput(cmd)
 }
 
+const (
+	DefaultConnectRetries       = 3
+	DefaultConnectRetryInterval = time.Second * 5
+)
+
 func QuickConnectUsingDefaultSSHKey(host string) (*ssh.Session, error) {
-	return Connect("root", "", host, GetDefaultPrivateKeyFile(), 22, nil)
+	client, err := quickDial(host)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionWithPty(client)
+}
+
+// quickDial connects to host as root using the default key, with retries
+func quickDial(host string) (*ssh.Client, error) {
+	return quickDialAs("root", host)
+}
+
+// UnreachableError means host cannot be connected by ssh after retries, the machine may not have booted at all
+type UnreachableError struct {
+	Host string
+	Err  error
+}
+
+func (u *UnreachableError) Error() string {
+	return fmt.Sprintf("Cannot connect to %s by ssh, err: %s", u.Host, u.Err.Error())
+}
+
+func (u *UnreachableError) Unwrap() error {
+	return u.Err
+}
+
+// IsUnreachable tells whether err, or an error it wraps, is an UnreachableError
+func IsUnreachable(err error) bool {
+	for err != nil {
+		if _, ok := err.(*UnreachableError); ok {
+			return true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+func quickDialAs(user, host string) (*ssh.Client, error) {
+	var client *ssh.Client
+	attempt := 0
+	var lastErr error
+	err := retry.Do(DefaultConnectRetries, DefaultConnectRetryInterval, func() error {
+		if attempt > 0 {
+			metrics.SSHRetries.Inc(host)
+		}
+		attempt++
+		var err error
+		client, err = Dial(user, "", host, GetDefaultPrivateKeyFile(), 22, nil)
+		lastErr = err
+		return err
+	})
+	if err != nil {
+		return nil, &UnreachableError{Host: host, Err: lastErr}
+	}
+	return client, nil
+}
+
+// QuickUpload writes content to path on host, parent folders are created if missing.
+// The file is created only readable by root and given mode once it is written, so secrets are never exposed.
+func QuickUpload(host string, content []byte, path string, mode os.FileMode) error {
+	client, err := quickDial(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// no pty here, or the content would be mangled by the terminal
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = bytes.NewReader(content)
+	cmd := fmt.Sprintf("mkdir -p %s && rm -f %s && (umask 077 && cat > %s) && chmod %o %s", filepath.Dir(path), path, path, mode, path)
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("Failed to upload %s to %s, err: %s, output: %s", path, host, err.Error(), string(output))
+	}
+	return nil
+}
+
+// QuickDownload writes the file at path on host to w
+func QuickDownload(host, path string, w io.Writer) error {
+	client, err := quickDial(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// no pty here, or the content would be mangled by the terminal
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdout = w
+	session.Stderr = &stderr
+	if err = session.Run("cat " + path); err != nil {
+		return fmt.Errorf("Failed to download %s from %s, err: %s, output: %s", path, host, err.Error(), stderr.String())
+	}
+	return nil
 }
 
 func Connect(user, password, host, key string, port int, cipherList []string) (*ssh.Session, error) {
+	client, err := Dial(user, password, host, key, port, cipherList)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionWithPty(client)
+}
+
+func Dial(user, password, host, key string, port int, cipherList []string) (*ssh.Client, error) {
 	var (
 		auth         []ssh.AuthMethod
 		addr         string
 		clientConfig *ssh.ClientConfig
 		client       *ssh.Client
 		config       ssh.Config
-		session      *ssh.Session
 		err          error
 	)
 	// get auth method
@@ -92,7 +224,14 @@ func Connect(user, password, host, key string, port int, cipherList []string) (*
 	if client, err = ssh.Dial("tcp", addr, clientConfig); err != nil {
 		return nil, err
 	}
+	return client, nil
+}
 
+func newSessionWithPty(client *ssh.Client) (*ssh.Session, error) {
+	var (
+		session *ssh.Session
+		err     error
+	)
 	// create session
 	if session, err = client.NewSession(); err != nil {
 		return nil, err
@@ -105,6 +244,7 @@ func Connect(user, password, host, key string, port int, cipherList []string) (*
 	}
 
 	if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
+		session.Close()
 		return nil, err
 	}
 
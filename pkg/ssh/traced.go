@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"io"
+	"os"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedRunner struct {
+	Runner
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every command and transfer of r, a runner traced already is traced in scope instead
+func WithTracing(r Runner, scope *trace.Scope) Runner {
+	if t, ok := r.(*tracedRunner); ok {
+		r = t.Runner
+	}
+	return &tracedRunner{Runner: r, scope: scope}
+}
+
+func (t *tracedRunner) start(name, host string) *trace.Span {
+	span := t.scope.Start(name)
+	span.SetAttribute("net.peer.ip", host)
+	return span
+}
+
+func (t *tracedRunner) Run(host, cmd string) error {
+	span := t.start("ssh.Run", host)
+	err := t.Runner.Run(host, cmd)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedRunner) RunAndGetOutput(host, cmd string) ([]byte, error) {
+	span := t.start("ssh.Run", host)
+	output, err := t.Runner.RunAndGetOutput(host, cmd)
+	span.Finish(err)
+	return output, err
+}
+
+func (t *tracedRunner) Upload(host string, content []byte, path string, mode os.FileMode) error {
+	span := t.start("ssh.Upload", host)
+	err := t.Runner.Upload(host, content, path, mode)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedRunner) Download(host, path string, w io.Writer) error {
+	span := t.start("ssh.Download", host)
+	err := t.Runner.Download(host, path, w)
+	span.Finish(err)
+	return err
+}
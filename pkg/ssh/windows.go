@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"k8s.io/klog"
+)
+
+// WindowsUser is who OpenSSH of windows images accepts the default key for, by administrators_authorized_keys
+const WindowsUser = "Administrator"
+
+type windowsRunner struct{}
+
+// NewWindowsRunner runs PowerShell commands on windows machines as WindowsUser with the default ssh key
+func NewWindowsRunner() Runner {
+	return windowsRunner{}
+}
+
+// PowerShellCommand wraps script into a powershell call, encoded so cmd.exe of OpenSSH does not touch its quotes
+func PowerShellCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return "powershell -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " + base64.StdEncoding.EncodeToString(b)
+}
+
+// UploadScript is the powershell writing content to path, parent folders are created if missing.
+// content is inlined, so it has to stay within a few KB as cmd.exe limits a command line to 8191 characters.
+func UploadScript(content []byte, path string) string {
+	dir := path[:strings.LastIndexAny(path, `\/`)+1]
+	return fmt.Sprintf("$ErrorActionPreference = 'Stop'; New-Item -ItemType Directory -Force -Path '%s' | Out-Null; [IO.File]::WriteAllBytes('%s', [Convert]::FromBase64String('%s'))",
+		dir, path, base64.StdEncoding.EncodeToString(content))
+}
+
+// Run logs output of cmd by klog like output of other remote commands, so it is hidden by --quiet and its secrets are redacted
+func (w windowsRunner) Run(host, cmd string) error {
+	output, err := w.RunAndGetOutput(host, cmd)
+	if text := strings.TrimSpace(string(output)); text != "" {
+		klog.V(2).Infof("Output of powershell on %s:\n%s", host, text)
+	}
+	return err
+}
+
+func (windowsRunner) RunAndGetOutput(host, cmd string) ([]byte, error) {
+	client, err := quickDialAs(WindowsUser, host)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.CombinedOutput(PowerShellCommand(cmd))
+}
+
+// Upload ignores mode, files on windows take the permissions of their folder
+func (w windowsRunner) Upload(host string, content []byte, path string, mode os.FileMode) error {
+	if output, err := w.RunAndGetOutput(host, UploadScript(content, path)); err != nil {
+		return fmt.Errorf("Failed to upload %s to %s, err: %s, output: %s", path, host, err.Error(), string(output))
+	}
+	return nil
+}
+
+func (windowsRunner) Download(host, path string, w io.Writer) error {
+	return fmt.Errorf("Downloading %s from windows machine %s is not supported", path, host)
+}
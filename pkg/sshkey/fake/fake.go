@@ -0,0 +1,69 @@
+package fake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/sshkey"
+)
+
+var _ sshkey.Interface = &KeyPairService{}
+
+// KeyPairService keeps keypairs in memory
+type KeyPairService struct {
+	recorder.Recorder
+
+	mu     sync.Mutex
+	nextID int
+	names  map[string]string
+	keys   map[string]string
+}
+
+func NewKeyPairService() *KeyPairService {
+	return &KeyPairService{
+		names: make(map[string]string),
+		keys:  make(map[string]string),
+	}
+}
+
+func (f *KeyPairService) CreateSSHKey(name string, key string) (string, error) {
+	if err := f.Record("CreateSSHKey", name, key); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("kp-fake%04d", f.nextID)
+	f.names[id] = name
+	f.keys[id] = key
+	return id, nil
+}
+
+func (f *KeyPairService) DeleteSSHKey(id string) error {
+	if err := f.Record("DeleteSSHKey", id); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.names[id]; !ok {
+		return fmt.Errorf("Keypair %s not found", id)
+	}
+	delete(f.names, id)
+	delete(f.keys, id)
+	return nil
+}
+
+func (f *KeyPairService) GetKeyPairByName(name string) (string, error) {
+	if err := f.Record("GetKeyPairByName", name); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, n := range f.names {
+		if n == name {
+			return id, nil
+		}
+	}
+	return "", nil
+}
@@ -1,8 +1,7 @@
 package sshkey
 
 import (
-	"fmt"
-
+	"github.com/magicsong/yunify-k8s/pkg/api"
 	"github.com/yunify/qingcloud-sdk-go/service"
 )
 
@@ -25,11 +24,7 @@ func (q *qingcloudSSHKey) GetKeyPairByName(name string) (string, error) {
 	}
 	output, err := q.keyPairService.DescribeKeyPairs(input)
 	if err != nil {
-		return "", err
-	}
-	if *output.RetCode != 0 {
-		err = fmt.Errorf("Error in getting ssh keypair by name %s, err: %s", name, *output.Message)
-		return "", err
+		return "", api.FromQingCloud(err, "Error in getting ssh keypair by name %s", name)
 	}
 	for _, key := range output.KeyPairSet {
 		if *key.KeyPairName == name {
@@ -47,11 +42,7 @@ func (q *qingcloudSSHKey) CreateSSHKey(name string, key string) (string, error)
 	}
 	output, err := q.keyPairService.CreateKeyPair(input)
 	if err != nil {
-		return "", err
-	}
-	if *output.RetCode != 0 {
-		err = fmt.Errorf("Error in creating ssh keypair,err: %s", *output.Message)
-		return "", err
+		return "", api.FromQingCloud(err, "Error in creating ssh keypair")
 	}
 
 	return *output.KeyPairID, nil
@@ -61,13 +52,9 @@ func (q *qingcloudSSHKey) DeleteSSHKey(id string) error {
 	input := &service.DeleteKeyPairsInput{
 		KeyPairs: []*string{&id},
 	}
-	output, err := q.keyPairService.DeleteKeyPairs(input)
+	_, err := q.keyPairService.DeleteKeyPairs(input)
 	if err != nil {
-		return err
-	}
-	if *output.RetCode != 0 {
-		err = fmt.Errorf("Error in creating ssh keypair,err: %s", *output.Message)
-		return err
+		return api.FromQingCloud(err, "Error in deleting ssh keypair %s", id)
 	}
 	return nil
 }
@@ -0,0 +1,39 @@
+package sshkey
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedSSHKey struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given keypair service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedSSHKey{Interface: i, scope: scope}
+}
+
+func (t *tracedSSHKey) CreateSSHKey(name string, key string) (string, error) {
+	span := t.scope.Start("sshkey.CreateSSHKey")
+	span.SetAttribute("keypair.name", name)
+	id, err := t.Interface.CreateSSHKey(name, key)
+	span.Finish(err)
+	return id, err
+}
+
+func (t *tracedSSHKey) DeleteSSHKey(id string) error {
+	span := t.scope.Start("sshkey.DeleteSSHKey")
+	span.SetAttribute("keypair.id", id)
+	err := t.Interface.DeleteSSHKey(id)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedSSHKey) GetKeyPairByName(name string) (string, error) {
+	span := t.scope.Start("sshkey.GetKeyPairByName")
+	span.SetAttribute("keypair.name", name)
+	id, err := t.Interface.GetKeyPairByName(name)
+	span.Finish(err)
+	return id, err
+}
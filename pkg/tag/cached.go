@@ -0,0 +1,97 @@
+package tag
+
+import (
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/cache"
+)
+
+type cachedTag struct {
+	Interface
+	cache *cache.Cache
+}
+
+// WithCache keeps results of GetTagClusterByName and GetTags for ttl, any other call invalidates them
+func WithCache(i Interface, ttl time.Duration) Interface {
+	return &cachedTag{Interface: i, cache: cache.New(ttl)}
+}
+
+// Invalidate drops cached results, for polls which must see changes made by others
+func (c *cachedTag) Invalidate() {
+	c.cache.Invalidate()
+}
+
+func (c *cachedTag) CreateTag(name, description string) (string, error) {
+	defer c.cache.Invalidate()
+	return c.Interface.CreateTag(name, description)
+}
+
+func (c *cachedTag) DeleteTag(id string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.DeleteTag(id)
+}
+
+func (c *cachedTag) SetDescription(id, description string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.SetDescription(id, description)
+}
+
+func (c *cachedTag) TagInstances(id string, instances []string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.TagInstances(id, instances)
+}
+
+func (c *cachedTag) TagResources(id, resourceType string, ids []string) error {
+	defer c.cache.Invalidate()
+	return c.Interface.TagResources(id, resourceType, ids)
+}
+
+func (c *cachedTag) GetTagClusterByName(name string) (*TagCluster, error) {
+	key := "name/" + name
+	if v, ok := c.cache.Get(key); ok {
+		return copyTag(v.(*TagCluster)), nil
+	}
+	t, err := c.Interface.GetTagClusterByName(name)
+	if err != nil {
+		return nil, err
+	}
+	// a missing tag is cached too, so checks before creation hit the api only once
+	c.cache.Set(key, copyTag(t))
+	return t, nil
+}
+
+func (c *cachedTag) GetTags(prefix string) ([]*TagCluster, error) {
+	key := "prefix/" + prefix
+	if v, ok := c.cache.Get(key); ok {
+		return copyTags(v.([]*TagCluster)), nil
+	}
+	tags, err := c.Interface.GetTags(prefix)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(key, copyTags(tags))
+	return tags, nil
+}
+
+func copyTags(tags []*TagCluster) []*TagCluster {
+	result := make([]*TagCluster, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, copyTag(t))
+	}
+	return result
+}
+
+func copyTag(t *TagCluster) *TagCluster {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.Instances = append([]string(nil), t.Instances...)
+	if t.Resources != nil {
+		c.Resources = make(map[string][]string, len(t.Resources))
+		for kind, ids := range t.Resources {
+			c.Resources[kind] = append([]string(nil), ids...)
+		}
+	}
+	return &c
+}
@@ -0,0 +1,156 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/tag"
+)
+
+var _ tag.Interface = &TagService{}
+
+// TagService keeps tags and their instances in memory
+type TagService struct {
+	recorder.Recorder
+
+	mu     sync.Mutex
+	nextID int
+	names  map[string]string
+	tags   map[string]*tag.TagCluster
+}
+
+func NewTagService() *TagService {
+	return &TagService{
+		names: make(map[string]string),
+		tags:  make(map[string]*tag.TagCluster),
+	}
+}
+
+func (f *TagService) CreateTag(name, description string) (string, error) {
+	if err := f.Record("CreateTag", name, description); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("tag-fake%04d", f.nextID)
+	f.names[id] = name
+	f.tags[id] = &tag.TagCluster{TagID: id, Name: name, Description: description, Instances: make([]string, 0)}
+	return id, nil
+}
+
+func (f *TagService) DeleteTag(id string) error {
+	if err := f.Record("DeleteTag", id); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.tags[id]; !ok {
+		return fmt.Errorf("Tag %s not found", id)
+	}
+	delete(f.tags, id)
+	delete(f.names, id)
+	return nil
+}
+
+func (f *TagService) SetDescription(id, description string) error {
+	if err := f.Record("SetDescription", id, description); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tags[id]
+	if !ok {
+		return fmt.Errorf("Tag %s not found", id)
+	}
+	t.Description = description
+	return nil
+}
+
+func (f *TagService) GetTagClusterByName(name string) (*tag.TagCluster, error) {
+	if err := f.Record("GetTagClusterByName", name); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := ""
+	for id, n := range f.names {
+		if n == name && (found == "" || id < found) {
+			found = id
+		}
+	}
+	if found == "" {
+		return nil, nil
+	}
+	return copyTag(f.tags[found]), nil
+}
+
+func (f *TagService) TagInstances(id string, instances []string) error {
+	if err := f.Record("TagInstances", id, instances); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tags[id]
+	if !ok {
+		return fmt.Errorf("Tag %s not found", id)
+	}
+	t.Instances = append(t.Instances, instances...)
+	return nil
+}
+
+func (f *TagService) TagResources(id, resourceType string, ids []string) error {
+	if err := f.Record("TagResources", id, resourceType, ids); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	_, ok := f.tags[id]
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("Tag %s not found", id)
+	}
+	f.AttachResources(id, resourceType, ids...)
+	return nil
+}
+
+// AttachResources tags resources other than instances, it is used to prepare tests
+func (f *TagService) AttachResources(id, kind string, ids ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := f.tags[id]
+	if t.Resources == nil {
+		t.Resources = make(map[string][]string)
+	}
+	t.Resources[kind] = append(t.Resources[kind], ids...)
+}
+
+func (f *TagService) GetTags(prefix string) ([]*tag.TagCluster, error) {
+	if err := f.Record("GetTags", prefix); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := make([]*tag.TagCluster, 0)
+	for id, n := range f.names {
+		if strings.HasPrefix(n, prefix) {
+			res = append(res, copyTag(f.tags[id]))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func copyTag(t *tag.TagCluster) *tag.TagCluster {
+	c := *t
+	c.Instances = append([]string{}, t.Instances...)
+	if t.Resources != nil {
+		c.Resources = make(map[string][]string)
+		for kind, ids := range t.Resources {
+			c.Resources[kind] = append([]string{}, ids...)
+		}
+	}
+	return &c
+}
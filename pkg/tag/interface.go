@@ -1,14 +1,24 @@
 package tag
 
 type TagCluster struct {
-	TagID     string
-	Instances []string
+	TagID       string
+	Name        string
+	Description string
+	Instances   []string
+	// Resources are other tagged resources like volumes and eips, grouped by resource type
+	Resources map[string][]string
 }
 
 type Interface interface {
-	CreateTag(string) (string, error)
+	// CreateTag creates a tag with the given description, which is used to mark the owner of cluster
+	CreateTag(name, description string) (string, error)
 	DeleteTag(string) error
+	SetDescription(id, description string) error
+	// GetTagClusterByName returns the tag of the name with the lowest id if there are several
 	GetTagClusterByName(string) (*TagCluster, error)
 	TagInstances(string, []string) error
-	GetTags(name string) ([]string, error)
+	// TagResources tags resources of other types like "keypair" or "eip", they appear in Resources of TagCluster
+	TagResources(id, resourceType string, ids []string) error
+	// GetTags returns all tags whose name starts with the prefix
+	GetTags(prefix string) ([]*TagCluster, error)
 }
@@ -1,9 +1,9 @@
 package tag
 
 import (
-	"fmt"
 	"strings"
 
+	"github.com/magicsong/yunify-k8s/pkg/api"
 	"github.com/yunify/qingcloud-sdk-go/service"
 	"k8s.io/klog"
 )
@@ -22,7 +22,7 @@ func NewQingCloudTagService(tagService *service.TagService, userID string) Inter
 
 var _ Interface = &qingcloudTagService{}
 
-func (q *qingcloudTagService) CreateTag(name string) (string, error) {
+func (q *qingcloudTagService) CreateTag(name, description string) (string, error) {
 	color := RandomColor()
 	input := &service.CreateTagInput{
 		TagName: &name,
@@ -30,53 +30,77 @@ func (q *qingcloudTagService) CreateTag(name string) (string, error) {
 	}
 	output, err := q.tagService.CreateTag(input)
 	if err != nil {
-		return "", err
+		return "", api.FromQingCloud(err, "Error in creating instances tag")
 	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in creating instances tag, err: %s", *output.Message)
-		return "", err
+	if description == "" {
+		return *output.TagID, nil
 	}
-	return *output.TagID, nil
+	return *output.TagID, q.SetDescription(*output.TagID, description)
+}
+
+func (q *qingcloudTagService) SetDescription(id, description string) error {
+	_, err := q.tagService.ModifyTagAttributes(&service.ModifyTagAttributesInput{
+		Tag:         &id,
+		Description: &description,
+	})
+	if err != nil {
+		return api.FromQingCloud(err, "Error in setting description of tag")
+	}
+	return nil
 }
 
 func (q *qingcloudTagService) DeleteTag(id string) error {
 	input := &service.DeleteTagsInput{
 		Tags: []*string{&id},
 	}
-	output, err := q.tagService.DeleteTags(input)
+	_, err := q.tagService.DeleteTags(input)
 	if err != nil {
-		return err
-	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in deleting  tag, err: %s", *output.Message)
-		return err
+		return api.FromQingCloud(err, "Error in deleting tag")
 	}
 	return nil
 }
 
-func (q *qingcloudTagService) GetTags(name string) ([]string, error) {
+func (q *qingcloudTagService) GetTags(prefix string) ([]*TagCluster, error) {
 	input := &service.DescribeTagsInput{
-		SearchWord: &name,
+		SearchWord: &prefix,
 		Verbose:    service.Int(1),
 	}
 	output, err := q.tagService.DescribeTags(input)
 	if err != nil {
 		klog.Error("Failed to initialize go sdk")
-		return nil, err
+		return nil, api.FromQingCloud(err, "Error in getting tag")
 	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in getting tag, err: %s", *output.Message)
-		return nil, err
-	}
-	res := make([]string, 0)
+	res := make([]*TagCluster, 0)
 	for _, tag := range output.TagSet {
-		if *tag.Owner == q.userID && strings.HasPrefix(*tag.TagName, name) {
-			res = append(res, *tag.TagName)
+		if *tag.Owner == q.userID && strings.HasPrefix(*tag.TagName, prefix) {
+			res = append(res, convertTag(tag))
 		}
 	}
 	return res, nil
 }
 
+func convertTag(tag *service.Tag) *TagCluster {
+	tagCluster := &TagCluster{
+		TagID:     *tag.TagID,
+		Name:      *tag.TagName,
+		Instances: make([]string, 0),
+	}
+	if tag.Description != nil {
+		tagCluster.Description = *tag.Description
+	}
+	for _, tagPair := range tag.ResourceTagPairs {
+		if *tagPair.ResourceType == "instance" {
+			tagCluster.Instances = append(tagCluster.Instances, *tagPair.ResourceID)
+			continue
+		}
+		if tagCluster.Resources == nil {
+			tagCluster.Resources = make(map[string][]string)
+		}
+		tagCluster.Resources[*tagPair.ResourceType] = append(tagCluster.Resources[*tagPair.ResourceType], *tagPair.ResourceID)
+	}
+	return tagCluster
+}
+
 func (q *qingcloudTagService) GetTagClusterByName(name string) (*TagCluster, error) {
 	input := &service.DescribeTagsInput{
 		SearchWord: &name,
@@ -85,48 +109,40 @@ func (q *qingcloudTagService) GetTagClusterByName(name string) (*TagCluster, err
 	output, err := q.tagService.DescribeTags(input)
 	if err != nil {
 		klog.Error("Failed to initialize go sdk")
-		return nil, err
-	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in getting tag, err: %s", *output.Message)
-		return nil, err
+		return nil, api.FromQingCloud(err, "Error in getting tag")
 	}
+	// runs creating the same tag at once may leave several, all of them take the one of the lowest id
+	var found *service.Tag
 	for _, tag := range output.TagSet {
-		if *tag.Owner == q.userID && *tag.TagName == name {
-			tagCluster := &TagCluster{
-				TagID:     *tag.TagID,
-				Instances: make([]string, 0),
-			}
-			for _, tagPair := range tag.ResourceTagPairs {
-				if *tagPair.ResourceType == "instance" {
-					tagCluster.Instances = append(tagCluster.Instances, *tagPair.ResourceID)
-				}
-			}
-			return tagCluster, nil
+		if *tag.Owner == q.userID && *tag.TagName == name && (found == nil || *tag.TagID < *found.TagID) {
+			found = tag
 		}
 	}
-	return nil, nil
+	if found == nil {
+		return nil, nil
+	}
+	return convertTag(found), nil
 }
 
 func (q *qingcloudTagService) TagInstances(tagid string, instances []string) error {
-	resourcePair := make([]*service.ResourceTagPair, len(instances))
-	for index := 0; index < len(instances); index++ {
+	return q.TagResources(tagid, "instance", instances)
+}
+
+func (q *qingcloudTagService) TagResources(tagid, resourceType string, ids []string) error {
+	resourcePair := make([]*service.ResourceTagPair, len(ids))
+	for index := 0; index < len(ids); index++ {
 		resourcePair[index] = &service.ResourceTagPair{
-			ResourceID:   &instances[index],
-			ResourceType: service.String("instance"),
+			ResourceID:   &ids[index],
+			ResourceType: &resourceType,
 			TagID:        &tagid,
 		}
 	}
 	input := &service.AttachTagsInput{
 		ResourceTagPairs: resourcePair,
 	}
-	output, err := q.tagService.AttachTags(input)
+	_, err := q.tagService.AttachTags(input)
 	if err != nil {
-		return err
-	}
-	if *output.RetCode != 0 {
-		err := fmt.Errorf("Error in attaching tag, err: %s", *output.Message)
-		return err
+		return api.FromQingCloud(err, "Error in attaching tag")
 	}
 	return nil
 }
@@ -0,0 +1,72 @@
+package tag
+
+import (
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedTag struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given tag service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedTag{Interface: i, scope: scope}
+}
+
+func (t *tracedTag) CreateTag(name, description string) (string, error) {
+	span := t.scope.Start("tag.CreateTag")
+	span.SetAttribute("tag.name", name)
+	id, err := t.Interface.CreateTag(name, description)
+	span.Finish(err)
+	return id, err
+}
+
+func (t *tracedTag) DeleteTag(id string) error {
+	span := t.scope.Start("tag.DeleteTag")
+	span.SetAttribute("tag.id", id)
+	err := t.Interface.DeleteTag(id)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedTag) SetDescription(id, description string) error {
+	span := t.scope.Start("tag.SetDescription")
+	span.SetAttribute("tag.id", id)
+	err := t.Interface.SetDescription(id, description)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedTag) GetTagClusterByName(name string) (*TagCluster, error) {
+	span := t.scope.Start("tag.GetTagClusterByName")
+	span.SetAttribute("tag.name", name)
+	result, err := t.Interface.GetTagClusterByName(name)
+	span.Finish(err)
+	return result, err
+}
+
+func (t *tracedTag) TagInstances(id string, instances []string) error {
+	span := t.scope.Start("tag.TagInstances")
+	span.SetAttribute("tag.id", id)
+	err := t.Interface.TagInstances(id, instances)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedTag) TagResources(id, resourceType string, ids []string) error {
+	span := t.scope.Start("tag.TagResources")
+	span.SetAttribute("tag.id", id)
+	span.SetAttribute("tag.resource_type", resourceType)
+	err := t.Interface.TagResources(id, resourceType, ids)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedTag) GetTags(prefix string) ([]*TagCluster, error) {
+	span := t.scope.Start("tag.GetTags")
+	span.SetAttribute("tag.prefix", prefix)
+	result, err := t.Interface.GetTags(prefix)
+	span.Finish(err)
+	return result, err
+}
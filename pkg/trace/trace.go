@@ -0,0 +1,254 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const EnvOTLPEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+const (
+	// batchSize of spans with no running root, which are exported together
+	batchSize = 64
+	// batchInterval is how long spans with no running root wait for others before they are exported
+	batchInterval = 5 * time.Second
+)
+
+// Span is a single traced operation, it is a no-op if tracing is not configured
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        error
+
+	tracer *Tracer
+	scope  *Scope
+}
+
+// SetAttribute attaches a key/value to the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// Finish ends the span, err marks the span as failed
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+	t.mu.Lock()
+	s.End = time.Now()
+	s.Err = err
+	if spans, ok := t.finished[s.TraceID]; ok {
+		t.finished[s.TraceID] = append(spans, s)
+	} else {
+		// started with no root running, or finished after its root is exported
+		t.addPending(s)
+	}
+	t.mu.Unlock()
+	// only roots have scopes
+	if s.scope != nil {
+		s.scope.finish(s)
+		t.flush(s.TraceID)
+	}
+}
+
+// Tracer collects spans of operations and exports the spans of one when its root span finishes.
+// Spans with no running root are exported in batches in the background.
+type Tracer struct {
+	exporter Exporter
+
+	mu sync.Mutex
+	// finished are spans by trace id of roots which are running
+	finished map[string][]*Span
+	// pending are spans with no running root, which are not exported yet
+	pending []*Span
+	timer   *time.Timer
+	exports sync.WaitGroup
+}
+
+// Scope holds the root span of the operation running in it, spans started in a scope are children of its root.
+// Operations running at the same time like clusters of a batch have their own scopes, or their spans would mix.
+// Methods of a nil scope use the default scope of the process.
+type Scope struct {
+	mu   sync.Mutex
+	root *Span
+}
+
+// NewScope returns a scope for an operation which runs along with others
+func NewScope() *Scope {
+	return &Scope{}
+}
+
+var defaultScope = &Scope{}
+
+func (s *Scope) orDefault() *Scope {
+	if s == nil {
+		return defaultScope
+	}
+	return s
+}
+
+// finish ends the operation of s if span is its root
+func (s *Scope) finish(span *Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.root == span {
+		s.root = nil
+	}
+}
+
+var defaultTracer *Tracer
+
+// Configure enables tracing, spans are exported to the given OTLP/HTTP endpoint
+func Configure(endpoint string) {
+	Flush()
+	if endpoint == "" {
+		defaultTracer = nil
+		return
+	}
+	defaultTracer = &Tracer{exporter: NewOTLPExporter(endpoint), finished: make(map[string][]*Span)}
+}
+
+// Flush exports spans with no running root which are still waiting for their batch, it returns once all are exported
+func Flush() {
+	t := defaultTracer
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.takePending()
+	t.mu.Unlock()
+	t.export(spans)
+	t.exports.Wait()
+}
+
+// StartRoot starts the span of a whole operation like creating a cluster in the default scope
+func StartRoot(name string) *Span {
+	return defaultScope.StartRoot(name)
+}
+
+// Start starts a span as a child of the root span of the default scope
+func Start(name string) *Span {
+	return defaultScope.Start(name)
+}
+
+// StartRoot starts the span of a whole operation like creating a cluster, spans started in s later are its children
+func (s *Scope) StartRoot(name string) *Span {
+	t := defaultTracer
+	if t == nil {
+		return nil
+	}
+	s = s.orDefault()
+	span := t.newSpan(name, newID(16), "", s)
+	t.mu.Lock()
+	t.finished[span.TraceID] = nil
+	t.mu.Unlock()
+	s.mu.Lock()
+	s.root = span
+	s.mu.Unlock()
+	return span
+}
+
+// Start starts a span as a child of the root span of s
+func (s *Scope) Start(name string) *Span {
+	t := defaultTracer
+	if t == nil {
+		return nil
+	}
+	s = s.orDefault()
+	s.mu.Lock()
+	root := s.root
+	s.mu.Unlock()
+	if root == nil {
+		return t.newSpan(name, newID(16), "", nil)
+	}
+	return t.newSpan(name, root.TraceID, root.SpanID, nil)
+}
+
+func (t *Tracer) newSpan(name, traceID, parentID string, scope *Scope) *Span {
+	return &Span{
+		TraceID:    traceID,
+		SpanID:     newID(8),
+		ParentID:   parentID,
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+		tracer:     t,
+		scope:      scope,
+	}
+}
+
+// flush exports finished spans of the trace along with pending ones, children finishing later become pending
+func (t *Tracer) flush(traceID string) {
+	t.mu.Lock()
+	spans := append(t.finished[traceID], t.takePending()...)
+	delete(t.finished, traceID)
+	t.mu.Unlock()
+	t.export(spans)
+}
+
+// addPending adds a span with no running root, the batch is exported in the background once it is full or
+// batchInterval passes. t.mu must be held.
+func (t *Tracer) addPending(s *Span) {
+	t.pending = append(t.pending, s)
+	if len(t.pending) >= batchSize {
+		t.exportInBackground(t.takePending())
+	} else if t.timer == nil {
+		t.timer = time.AfterFunc(batchInterval, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.exportInBackground(t.takePending())
+		})
+	}
+}
+
+// takePending returns pending spans and stops waiting for more. t.mu must be held.
+func (t *Tracer) takePending() []*Span {
+	spans := t.pending
+	t.pending = nil
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	return spans
+}
+
+func (t *Tracer) exportInBackground(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	t.exports.Add(1)
+	go func() {
+		defer t.exports.Done()
+		t.export(spans)
+	}()
+}
+
+func (t *Tracer) export(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(spans); err != nil {
+		klog.Warningf("Failed to export traces, err: %s", err.Error())
+	}
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
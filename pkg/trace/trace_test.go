@@ -0,0 +1,224 @@
+package trace_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId"`
+	Name              string     `json:"name"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type payload struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []span `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+var _ = Describe("Trace", func() {
+	var (
+		mu        sync.Mutex
+		exports   []payload
+		paths     []string
+		collector *httptest.Server
+	)
+
+	BeforeEach(func() {
+		exports, paths = nil, nil
+		collector = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p payload
+			Expect(json.NewDecoder(r.Body).Decode(&p)).To(Succeed())
+			mu.Lock()
+			defer mu.Unlock()
+			exports = append(exports, p)
+			paths = append(paths, r.URL.Path)
+		}))
+		trace.Configure(collector.URL)
+	})
+
+	AfterEach(func() {
+		trace.Configure("")
+		collector.Close()
+	})
+
+	spansOf := func(p payload) []span {
+		var spans []span
+		for _, rs := range p.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		return spans
+	}
+
+	It("Should export spans of an operation when its root finishes", func() {
+		root := trace.StartRoot("RunCreate")
+		root.SetAttribute("cluster.name", "test")
+		child := trace.Start("CreateInstances")
+		child.Finish(fmt.Errorf("no capacity"))
+		Expect(exports).To(BeEmpty())
+		trace.Start("TagResources").Finish(nil)
+		root.Finish(nil)
+
+		Expect(exports).To(HaveLen(1))
+		Expect(paths).To(Equal([]string{"/v1/traces"}))
+		Expect(exports[0].ResourceSpans).To(HaveLen(1))
+		Expect(exports[0].ResourceSpans[0].Resource.Attributes[0].Key).To(Equal("service.name"))
+		Expect(exports[0].ResourceSpans[0].Resource.Attributes[0].Value.StringValue).To(Equal(trace.ServiceName))
+		spans := spansOf(exports[0])
+		Expect(spans).To(HaveLen(3))
+		byName := make(map[string]span)
+		for _, s := range spans {
+			Expect(s.TraceID).To(Equal(root.TraceID))
+			Expect(s.TraceID).To(HaveLen(32))
+			Expect(s.SpanID).To(HaveLen(16))
+			Expect(s.StartTimeUnixNano).NotTo(BeEmpty())
+			Expect(s.EndTimeUnixNano).NotTo(BeEmpty())
+			byName[s.Name] = s
+		}
+		Expect(byName["RunCreate"].ParentSpanID).To(BeEmpty())
+		Expect(byName["RunCreate"].Attributes).To(HaveLen(1))
+		Expect(byName["RunCreate"].Attributes[0].Key).To(Equal("cluster.name"))
+		Expect(byName["RunCreate"].Attributes[0].Value.StringValue).To(Equal("test"))
+		Expect(byName["RunCreate"].Status.Code).To(Equal(1))
+		Expect(byName["CreateInstances"].ParentSpanID).To(Equal(root.SpanID))
+		Expect(byName["CreateInstances"].Status.Code).To(Equal(2))
+		Expect(byName["CreateInstances"].Status.Message).To(Equal("no capacity"))
+		Expect(byName["TagResources"].ParentSpanID).To(Equal(root.SpanID))
+	})
+
+	It("Should export spans started with no root on their own", func() {
+		orphan := trace.Start("DescribeInstances")
+		Expect(orphan.ParentID).To(BeEmpty())
+		orphan.Finish(nil)
+		Expect(exports).To(BeEmpty())
+		trace.Flush()
+		Expect(exports).To(HaveLen(1))
+		spans := spansOf(exports[0])
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name).To(Equal("DescribeInstances"))
+		Expect(spans[0].SpanID).To(Equal(orphan.SpanID))
+
+		// a root finished before ends its operation, later spans are orphans again
+		root := trace.StartRoot("RunDelete")
+		root.Finish(nil)
+		trace.Start("DeleteInstances").Finish(nil)
+		trace.Flush()
+		Expect(exports).To(HaveLen(3))
+		Expect(spansOf(exports[2])[0].TraceID).NotTo(Equal(root.TraceID))
+	})
+
+	It("Should export spans with no root in batches in the background", func() {
+		for i := 0; i < 64; i++ {
+			trace.Start("DescribeInstances").Finish(nil)
+		}
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(exports)
+		}).Should(Equal(1))
+		mu.Lock()
+		Expect(spansOf(exports[0])).To(HaveLen(64))
+		mu.Unlock()
+
+		// waiting ones go along with the next root
+		trace.Start("DescribeTags").Finish(nil)
+		trace.StartRoot("RunCreate").Finish(nil)
+		Expect(exports).To(HaveLen(2))
+		Expect(spansOf(exports[1])).To(HaveLen(2))
+	})
+
+	It("Should export children finishing after their root instead of keeping them", func() {
+		root := trace.StartRoot("RunCreate")
+		late := trace.Start("WaitKubesphere")
+		root.Finish(nil)
+		Expect(exports).To(HaveLen(1))
+		Expect(spansOf(exports[0])).To(HaveLen(1))
+
+		late.Finish(nil)
+		trace.Flush()
+		Expect(exports).To(HaveLen(2))
+		spans := spansOf(exports[1])
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].TraceID).To(Equal(root.TraceID))
+		Expect(spans[0].ParentSpanID).To(Equal(root.SpanID))
+	})
+
+	It("Should keep spans of operations in their own scopes apart", func() {
+		scopes := []*trace.Scope{trace.NewScope(), trace.NewScope()}
+		roots := make([]*trace.Span, len(scopes))
+		var wg sync.WaitGroup
+		for i, scope := range scopes {
+			roots[i] = scope.StartRoot("RunCreate")
+			wg.Add(1)
+			go func(scope *trace.Scope) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					scope.Start("ssh.Run").Finish(nil)
+				}
+			}(scope)
+		}
+		wg.Wait()
+		Expect(exports).To(BeEmpty())
+		for _, root := range roots {
+			root.Finish(nil)
+		}
+
+		Expect(exports).To(HaveLen(2))
+		for i, p := range exports {
+			spans := spansOf(p)
+			Expect(spans).To(HaveLen(11))
+			for _, s := range spans {
+				Expect(s.TraceID).To(Equal(roots[i].TraceID))
+				if s.Name != "RunCreate" {
+					Expect(s.ParentSpanID).To(Equal(roots[i].SpanID))
+				}
+			}
+		}
+	})
+
+	It("Should do nothing if tracing is not configured", func() {
+		trace.Configure("")
+		root := trace.StartRoot("RunCreate")
+		Expect(root).To(BeNil())
+		root.SetAttribute("cluster.name", "test")
+		trace.Start("CreateInstances").Finish(nil)
+		root.Finish(nil)
+		Expect(exports).To(BeEmpty())
+	})
+
+	It("Should not fail the operation if the collector fails", func() {
+		collector.Close()
+		root := trace.StartRoot("RunCreate")
+		Expect(func() { root.Finish(nil) }).NotTo(Panic())
+	})
+})
@@ -0,0 +1,113 @@
+package upgrade
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RemovedAPI is an api version of a kind which kubernetes stops serving in a minor version
+type RemovedAPI struct {
+	Kind       string
+	APIVersion string
+	// Resource is what kubectl lists to find objects of Kind
+	Resource    string
+	RemovedIn   int
+	Replacement string
+}
+
+// removed lists kinds sharing the same removal
+func removed(minor int, resource, kind, replacement string, versions ...string) []RemovedAPI {
+	result := make([]RemovedAPI, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, RemovedAPI{Kind: kind, APIVersion: v, Resource: resource, RemovedIn: minor, Replacement: replacement})
+	}
+	return result
+}
+
+// RemovedAPIs are persisted kinds of the deprecated api migration guide of kubernetes, up to the newest minor qks knows
+var RemovedAPIs = concat(
+	removed(16, "networkpolicies", "NetworkPolicy", "networking.k8s.io/v1", "extensions/v1beta1"),
+	removed(16, "podsecuritypolicies", "PodSecurityPolicy", "policy/v1beta1", "extensions/v1beta1"),
+	removed(16, "daemonsets", "DaemonSet", "apps/v1", "extensions/v1beta1", "apps/v1beta2"),
+	removed(16, "deployments", "Deployment", "apps/v1", "extensions/v1beta1", "apps/v1beta1", "apps/v1beta2"),
+	removed(16, "statefulsets", "StatefulSet", "apps/v1", "apps/v1beta1", "apps/v1beta2"),
+	removed(16, "replicasets", "ReplicaSet", "apps/v1", "extensions/v1beta1", "apps/v1beta1", "apps/v1beta2"),
+	removed(22, "mutatingwebhookconfigurations", "MutatingWebhookConfiguration", "admissionregistration.k8s.io/v1", "admissionregistration.k8s.io/v1beta1"),
+	removed(22, "validatingwebhookconfigurations", "ValidatingWebhookConfiguration", "admissionregistration.k8s.io/v1", "admissionregistration.k8s.io/v1beta1"),
+	removed(22, "customresourcedefinitions", "CustomResourceDefinition", "apiextensions.k8s.io/v1", "apiextensions.k8s.io/v1beta1"),
+	removed(22, "apiservices", "APIService", "apiregistration.k8s.io/v1", "apiregistration.k8s.io/v1beta1"),
+	removed(22, "certificatesigningrequests", "CertificateSigningRequest", "certificates.k8s.io/v1", "certificates.k8s.io/v1beta1"),
+	removed(22, "leases", "Lease", "coordination.k8s.io/v1", "coordination.k8s.io/v1beta1"),
+	removed(22, "ingresses", "Ingress", "networking.k8s.io/v1", "extensions/v1beta1", "networking.k8s.io/v1beta1"),
+	removed(22, "ingressclasses", "IngressClass", "networking.k8s.io/v1", "networking.k8s.io/v1beta1"),
+	removed(22, "clusterroles", "ClusterRole", "rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"),
+	removed(22, "clusterrolebindings", "ClusterRoleBinding", "rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"),
+	removed(22, "roles", "Role", "rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"),
+	removed(22, "rolebindings", "RoleBinding", "rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"),
+	removed(22, "priorityclasses", "PriorityClass", "scheduling.k8s.io/v1", "scheduling.k8s.io/v1beta1"),
+	removed(22, "csidrivers", "CSIDriver", "storage.k8s.io/v1", "storage.k8s.io/v1beta1"),
+	removed(22, "csinodes", "CSINode", "storage.k8s.io/v1", "storage.k8s.io/v1beta1"),
+	removed(22, "storageclasses", "StorageClass", "storage.k8s.io/v1", "storage.k8s.io/v1beta1"),
+	removed(22, "volumeattachments", "VolumeAttachment", "storage.k8s.io/v1", "storage.k8s.io/v1beta1"),
+	removed(25, "cronjobs", "CronJob", "batch/v1", "batch/v1beta1"),
+	removed(25, "endpointslices", "EndpointSlice", "discovery.k8s.io/v1", "discovery.k8s.io/v1beta1"),
+	removed(25, "horizontalpodautoscalers", "HorizontalPodAutoscaler", "autoscaling/v2", "autoscaling/v2beta1"),
+	removed(25, "poddisruptionbudgets", "PodDisruptionBudget", "policy/v1", "policy/v1beta1"),
+	removed(25, "podsecuritypolicies", "PodSecurityPolicy", "Pod Security admission", "policy/v1beta1"),
+	removed(25, "runtimeclasses", "RuntimeClass", "node.k8s.io/v1", "node.k8s.io/v1beta1"),
+	removed(26, "flowschemas", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1beta3", "flowcontrol.apiserver.k8s.io/v1beta1"),
+	removed(26, "prioritylevelconfigurations", "PriorityLevelConfiguration", "flowcontrol.apiserver.k8s.io/v1beta3", "flowcontrol.apiserver.k8s.io/v1beta1"),
+	removed(26, "horizontalpodautoscalers", "HorizontalPodAutoscaler", "autoscaling/v2", "autoscaling/v2beta2"),
+	removed(27, "csistoragecapacities", "CSIStorageCapacity", "storage.k8s.io/v1", "storage.k8s.io/v1beta1"),
+	removed(29, "flowschemas", "FlowSchema", "flowcontrol.apiserver.k8s.io/v1", "flowcontrol.apiserver.k8s.io/v1beta2"),
+	removed(29, "prioritylevelconfigurations", "PriorityLevelConfiguration", "flowcontrol.apiserver.k8s.io/v1", "flowcontrol.apiserver.k8s.io/v1beta2"),
+)
+
+func concat(lists ...[]RemovedAPI) []RemovedAPI {
+	result := make([]RemovedAPI, 0)
+	for _, l := range lists {
+		result = append(result, l...)
+	}
+	return result
+}
+
+// RemovedBetween returns apis removed by upgrading from minor from to minor to
+func RemovedBetween(from, to int) []RemovedAPI {
+	result := make([]RemovedAPI, 0)
+	for _, r := range RemovedAPIs {
+		if r.RemovedIn > from && r.RemovedIn <= to {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Find returns the removed api of kind in apiVersion, nil if it is not in apis
+func Find(apis []RemovedAPI, apiVersion, kind string) *RemovedAPI {
+	for i := range apis {
+		if apis[i].APIVersion == apiVersion && apis[i].Kind == kind {
+			return &apis[i]
+		}
+	}
+	return nil
+}
+
+// TypeMeta is what manifests are checked by
+type TypeMeta struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+// ManifestTypes returns kinds of all documents in manifests, documents which cannot be parsed are skipped
+func ManifestTypes(manifests []byte) []TypeMeta {
+	result := make([]TypeMeta, 0)
+	for _, doc := range strings.Split("\n"+string(manifests), "\n---") {
+		t := TypeMeta{}
+		if err := yaml.Unmarshal([]byte(doc), &t); err != nil || t.Kind == "" {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package upgrade
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/bootstrap"
+)
+
+// Step is upgrading the cluster to the next minor version, as kubeadm skips no minor version
+type Step struct {
+	// Version is like "1.16.x" if qks has no preset of the minor
+	Version string
+	Minor   int
+	// Preset tells if qks has images of Version
+	Preset bool
+}
+
+func (s Step) String() string {
+	if s.Preset {
+		return s.Version
+	}
+	return s.Version + " (no preset of qks)"
+}
+
+// Minor returns the minor of version like "1.15.5"
+func Minor(version string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, api.NewValidationError("Invalid kubernetes version '%s'", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, api.NewValidationError("Invalid kubernetes version '%s'", version)
+	}
+	return minor, nil
+}
+
+// Path returns steps from version from to version to, the newest preset of each minor is used on the way
+func Path(from, to string) ([]Step, error) {
+	fromMinor, err := Minor(from)
+	if err != nil {
+		return nil, err
+	}
+	toMinor, err := Minor(to)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = bootstrap.KubeadmFor(to); err != nil {
+		return nil, err
+	}
+	if _, ok := api.PresetKubernetes[to]; !ok {
+		return nil, api.NewValidationError("Kubernetes %s has no preset, versions with presets are %v", to, api.PresetVersions())
+	}
+	if toMinor < fromMinor || from == to {
+		return nil, api.NewValidationError("Cannot upgrade from %s to %s", from, to)
+	}
+	steps := make([]Step, 0, toMinor-fromMinor+1)
+	for minor := fromMinor + 1; minor < toMinor; minor++ {
+		step := Step{Version: fmt.Sprintf("1.%d.x", minor), Minor: minor}
+		for _, v := range api.PresetVersions() {
+			if m, _ := Minor(v); m == minor {
+				step = Step{Version: v, Minor: minor, Preset: true}
+			}
+		}
+		steps = append(steps, step)
+	}
+	return append(steps, Step{Version: to, Minor: toMinor, Preset: true}), nil
+}
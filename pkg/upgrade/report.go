@@ -0,0 +1,110 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// LastAppliedAnnotation keeps the manifest of objects applied by kubectl, as it was written
+const LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Finding is something in the cluster which breaks after an upgrade
+type Finding struct {
+	// Subject is like "Deployment default/web" or "addon ingress-nginx"
+	Subject string
+	Problem string
+}
+
+// Report is what upgrading a cluster would run into
+type Report struct {
+	Cluster  string
+	From     string
+	To       string
+	Steps    []Step
+	Findings []Finding
+	// Unchecked are what cannot be checked, like resources failing to be listed
+	Unchecked []string
+}
+
+// AddRemoved adds a finding if the api of subject is removed on the way
+func (r *Report) AddRemoved(subject string, t TypeMeta, apis []RemovedAPI) {
+	if api := Find(apis, t.APIVersion, t.Kind); api != nil {
+		r.Findings = append(r.Findings, Finding{
+			Subject: subject,
+			Problem: fmt.Sprintf("%s %s is removed in 1.%d, use %s", api.APIVersion, api.Kind, api.RemovedIn, api.Replacement),
+		})
+	}
+}
+
+func (r *Report) Render(w io.Writer) {
+	steps := make([]string, 0, len(r.Steps))
+	for _, s := range r.Steps {
+		steps = append(steps, s.String())
+	}
+	fmt.Fprintf(w, "Upgrading cluster %s from %s to %s takes %d steps, kubeadm upgrades one minor version at a time:\n  %s -> %s\n\n",
+		r.Cluster, r.From, r.To, len(r.Steps), r.From, strings.Join(steps, " -> "))
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No problems are found")
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SUBJECT\tPROBLEM")
+		for _, f := range r.Findings {
+			fmt.Fprintf(tw, "%s\t%s\n", f.Subject, f.Problem)
+		}
+		tw.Flush()
+		fmt.Fprintf(w, "\n%d problems are found\n", len(r.Findings))
+	}
+	if len(r.Unchecked) != 0 {
+		fmt.Fprintf(w, "\nNot checked, look at them by hand:\n")
+		for _, u := range r.Unchecked {
+			fmt.Fprintf(w, "  %s\n", u)
+		}
+	}
+}
+
+// AppliedObject is an object listed from the cluster with the type it was applied with
+type AppliedObject struct {
+	// Name is like "default/web", or "web" if the object is not namespaced
+	Name string
+	TypeMeta
+}
+
+// AppliedObjects reads output of "kubectl get -o json", objects not applied by kubectl are skipped,
+// as the apiserver converts everything to the version asked and cannot tell what they are written in
+func AppliedObjects(list []byte) ([]AppliedObject, error) {
+	var result struct {
+		Items []struct {
+			Metadata struct {
+				Name        string            `json:"name"`
+				Namespace   string            `json:"namespace"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(list, &result); err != nil {
+		return nil, err
+	}
+	objects := make([]AppliedObject, 0)
+	for _, item := range result.Items {
+		applied, ok := item.Metadata.Annotations[LastAppliedAnnotation]
+		if !ok {
+			continue
+		}
+		var t struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := json.Unmarshal([]byte(applied), &t); err != nil {
+			continue
+		}
+		name := item.Metadata.Name
+		if item.Metadata.Namespace != "" {
+			name = item.Metadata.Namespace + "/" + name
+		}
+		objects = append(objects, AppliedObject{Name: name, TypeMeta: TypeMeta{APIVersion: t.APIVersion, Kind: t.Kind}})
+	}
+	return objects, nil
+}
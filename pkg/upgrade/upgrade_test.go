@@ -0,0 +1,67 @@
+package upgrade_test
+
+import (
+	"bytes"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/magicsong/yunify-k8s/pkg/upgrade"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upgrade", func() {
+	It("Should upgrade one minor version at a time", func() {
+		steps, err := upgrade.Path("1.13.1", "1.15.5")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(steps).To(Equal([]upgrade.Step{{Version: "1.14.x", Minor: 14}, {Version: "1.15.5", Minor: 15, Preset: true}}))
+		steps, err = upgrade.Path("1.15.2", "1.15.5")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(steps).To(HaveLen(1))
+		steps, err = upgrade.Path("1.15.5", "1.30.5")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(steps).To(HaveLen(15))
+		Expect(steps[0].String()).To(Equal("1.16.x (no preset of qks)"))
+
+		for _, to := range []string{"1.15.5", "1.13.1", "1.16.0", "2.0.0"} {
+			_, err = upgrade.Path("1.15.5", to)
+			Expect(api.ExitCode(err)).To(Equal(api.ExitCodeValidation), to)
+		}
+	})
+
+	It("Should find apis removed on the way", func() {
+		removed := upgrade.RemovedBetween(15, 22)
+		Expect(upgrade.Find(removed, "extensions/v1beta1", "Deployment").RemovedIn).To(Equal(16))
+		Expect(upgrade.Find(removed, "networking.k8s.io/v1beta1", "Ingress").Replacement).To(Equal("networking.k8s.io/v1"))
+		Expect(upgrade.Find(removed, "batch/v1beta1", "CronJob")).To(BeNil())
+		Expect(upgrade.Find(removed, "apps/v1", "Deployment")).To(BeNil())
+		Expect(upgrade.RemovedBetween(16, 21)).To(BeEmpty())
+	})
+
+	It("Should read types objects are applied with", func() {
+		list := []byte(`{"items":[
+{"metadata":{"name":"web","namespace":"default","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"extensions/v1beta1\",\"kind\":\"Deployment\"}"}}},
+{"metadata":{"name":"created-by-helm","namespace":"default"}}]}`)
+		objects, err := upgrade.AppliedObjects(list)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(objects).To(Equal([]upgrade.AppliedObject{{Name: "default/web", TypeMeta: upgrade.TypeMeta{APIVersion: "extensions/v1beta1", Kind: "Deployment"}}}))
+
+		types := upgrade.ManifestTypes([]byte("apiVersion: v1\nkind: Namespace\n---\n# empty\n---\napiVersion: rbac.authorization.k8s.io/v1beta1\nkind: Role\n"))
+		Expect(types).To(HaveLen(2))
+		Expect(types[1].APIVersion).To(Equal("rbac.authorization.k8s.io/v1beta1"))
+	})
+
+	It("Should render findings of the report", func() {
+		report := &upgrade.Report{Cluster: "test", From: "1.15.5", To: "1.16.0"}
+		report.Steps, _ = upgrade.Path("1.13.1", "1.15.5")
+		report.AddRemoved("Deployment default/web", upgrade.TypeMeta{APIVersion: "apps/v1beta2", Kind: "Deployment"}, upgrade.RemovedBetween(15, 16))
+		report.AddRemoved("Deployment default/api", upgrade.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}, upgrade.RemovedBetween(15, 16))
+		report.Unchecked = []string{"addon logging is a chart"}
+		buf := &bytes.Buffer{}
+		report.Render(buf)
+		Expect(buf.String()).To(ContainSubstring("1.15.5 -> 1.14.x (no preset of qks) -> 1.15.5"))
+		Expect(buf.String()).To(MatchRegexp(`Deployment default/web\s+apps/v1beta2 Deployment is removed in 1.16, use apps/v1`))
+		Expect(buf.String()).NotTo(ContainSubstring("default/api"))
+		Expect(buf.String()).To(ContainSubstring("1 problems are found"))
+		Expect(buf.String()).To(ContainSubstring("addon logging is a chart"))
+	})
+})
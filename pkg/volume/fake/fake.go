@@ -0,0 +1,64 @@
+package fake
+
+import (
+	"fmt"
+
+	"github.com/magicsong/yunify-k8s/pkg/fake/recorder"
+	"github.com/magicsong/yunify-k8s/pkg/volume"
+)
+
+var _ volume.Interface = &VolumeService{}
+
+// VolumeService keeps created volumes by id and the instance each one is attached to
+type VolumeService struct {
+	recorder.Recorder
+	// Volumes maps volume ids to names
+	Volumes map[string]string
+	// Attachments maps volume ids to instance ids
+	Attachments map[string]string
+}
+
+func NewVolumeService() *VolumeService {
+	return &VolumeService{
+		Volumes:     make(map[string]string),
+		Attachments: make(map[string]string),
+	}
+}
+
+func (f *VolumeService) DeleteVolumes(ids []string) error {
+	if err := f.Record("DeleteVolumes", ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(f.Volumes, id)
+		delete(f.Attachments, id)
+	}
+	return nil
+}
+
+func (f *VolumeService) CreateVolume(name string, size, volumeType int) (string, error) {
+	if err := f.Record("CreateVolume", name, size, volumeType); err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("vol-%d", len(f.Volumes)+1)
+	f.Volumes[id] = name
+	return id, nil
+}
+
+// AttachVolume gives devices from /dev/vdc, as vda and vdb are used by the os and swap
+func (f *VolumeService) AttachVolume(id, instanceID string) (string, error) {
+	if err := f.Record("AttachVolume", id, instanceID); err != nil {
+		return "", err
+	}
+	if _, ok := f.Volumes[id]; !ok {
+		return "", fmt.Errorf("Cannot find volume %s", id)
+	}
+	attached := 0
+	for _, ins := range f.Attachments {
+		if ins == instanceID {
+			attached++
+		}
+	}
+	f.Attachments[id] = instanceID
+	return fmt.Sprintf("/dev/vd%c", 'c'+attached), nil
+}
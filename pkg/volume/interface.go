@@ -0,0 +1,9 @@
+package volume
+
+type Interface interface {
+	DeleteVolumes(ids []string) error
+	// CreateVolume creates a volume of size in GB and waits until it is available, it returns the id
+	CreateVolume(name string, size, volumeType int) (string, error)
+	// AttachVolume attaches a volume to an instance and returns the device like "/dev/vdc"
+	AttachVolume(id, instanceID string) (string, error)
+}
@@ -0,0 +1,74 @@
+package volume
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/magicsong/yunify-k8s/pkg/api"
+	"github.com/yunify/qingcloud-sdk-go/client"
+	"github.com/yunify/qingcloud-sdk-go/service"
+)
+
+const DefaultVolumeWait = time.Minute * 2
+
+type qingcloudVolume struct {
+	jobService    *service.JobService
+	volumeService *service.VolumeService
+}
+
+func NewQingCloudVolumeService(volumeService *service.VolumeService, jobService *service.JobService) Interface {
+	return &qingcloudVolume{
+		jobService:    jobService,
+		volumeService: volumeService,
+	}
+}
+
+func (q *qingcloudVolume) DeleteVolumes(ids []string) error {
+	input := &service.DeleteVolumesInput{
+		Volumes: service.StringSlice(ids),
+	}
+	output, err := q.volumeService.DeleteVolumes(input)
+	if err != nil {
+		return api.FromQingCloud(err, "Error in deleting volumes")
+	}
+	return client.WaitJob(q.jobService, *output.JobID, DefaultVolumeWait, time.Second*5)
+}
+
+func (q *qingcloudVolume) CreateVolume(name string, size, volumeType int) (string, error) {
+	output, err := q.volumeService.CreateVolumes(&service.CreateVolumesInput{
+		Count:      service.Int(1),
+		Size:       &size,
+		VolumeName: &name,
+		VolumeType: &volumeType,
+	})
+	if err != nil {
+		return "", api.FromQingCloud(err, "Error in creating volume %s", name)
+	}
+	if len(output.Volumes) == 0 {
+		return "", fmt.Errorf("No volume is created")
+	}
+	id := *output.Volumes[0]
+	return id, client.WaitJob(q.jobService, *output.JobID, DefaultVolumeWait, time.Second*5)
+}
+
+func (q *qingcloudVolume) AttachVolume(id, instanceID string) (string, error) {
+	output, err := q.volumeService.AttachVolumes(&service.AttachVolumesInput{Instance: &instanceID, Volumes: []*string{&id}})
+	if err != nil {
+		return "", api.FromQingCloud(err, "Error in attaching volume %s to %s", id, instanceID)
+	}
+	if err = client.WaitJob(q.jobService, *output.JobID, DefaultVolumeWait, time.Second*5); err != nil {
+		return "", err
+	}
+	describe, err := q.volumeService.DescribeVolumes(&service.DescribeVolumesInput{Volumes: []*string{&id}})
+	if err != nil {
+		return "", api.FromQingCloud(err, "Error in describing volume %s", id)
+	}
+	if len(describe.VolumeSet) == 0 {
+		return "", fmt.Errorf("Cannot find volume %s", id)
+	}
+	v := describe.VolumeSet[0]
+	if v.Instance == nil || v.Instance.Device == nil || *v.Instance.Device == "" {
+		return "", fmt.Errorf("Volume %s has no device on %s", id, instanceID)
+	}
+	return *v.Instance.Device, nil
+}
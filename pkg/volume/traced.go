@@ -0,0 +1,45 @@
+package volume
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/yunify-k8s/pkg/trace"
+)
+
+type tracedVolume struct {
+	Interface
+	scope *trace.Scope
+}
+
+// WithTracing records a span in scope for every call of the given volume service
+func WithTracing(i Interface, scope *trace.Scope) Interface {
+	return &tracedVolume{Interface: i, scope: scope}
+}
+
+func (t *tracedVolume) DeleteVolumes(ids []string) error {
+	span := t.scope.Start("volume.DeleteVolumes")
+	span.SetAttribute("volume.ids", strings.Join(ids, ","))
+	err := t.Interface.DeleteVolumes(ids)
+	span.Finish(err)
+	return err
+}
+
+func (t *tracedVolume) CreateVolume(name string, size, volumeType int) (string, error) {
+	span := t.scope.Start("volume.CreateVolume")
+	span.SetAttribute("volume.name", name)
+	span.SetAttribute("volume.size", strconv.Itoa(size))
+	id, err := t.Interface.CreateVolume(name, size, volumeType)
+	span.SetAttribute("volume.id", id)
+	span.Finish(err)
+	return id, err
+}
+
+func (t *tracedVolume) AttachVolume(id, instanceID string) (string, error) {
+	span := t.scope.Start("volume.AttachVolume")
+	span.SetAttribute("volume.id", id)
+	span.SetAttribute("instance.id", instanceID)
+	device, err := t.Interface.AttachVolume(id, instanceID)
+	span.Finish(err)
+	return device, err
+}
@@ -0,0 +1,54 @@
+#!/bin/bash
+POD_CIDR="192.168.0.0/16"
+CNI="calico"
+CNIPATH=/root/CNI
+MODE="k8s"
+
+set -e
+# parse args
+while [[ $# -gt 0 ]]
+do
+key="$1"
+
+case $key in
+    --pod-cidr)
+    POD_CIDR=$2
+    shift
+    shift # past argument
+    ;;
+    -n|--CNI)
+    CNI=$2
+    shift # past argument
+    shift # past value
+    ;;
+    -m|--mode)
+    MODE=$2
+    shift # past argument
+    shift # past value
+    ;;
+    *)    # unknown option
+    shift # past argument
+    ;;
+esac
+done
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+echo "CNI=${CNI}, pod-cidr=${POD_CIDR}"
+
+if [ "$CNI" == "calico" ]; then
+    # calico 3.28 only keeps its data in kubernetes
+    if [ "$MODE" != "" ] && [ "$MODE" != "k8s" ]; then
+        echo "mode $MODE of calico is not supported"
+        exit 1
+    fi
+    sed -i -e "s?# - name: CALICO_IPV4POOL_CIDR?- name: CALICO_IPV4POOL_CIDR?; s?#   value: \"192.168.0.0/16\"?  value: \"$POD_CIDR\"?" ${CNIPATH}/calico/calico.yaml
+    kubectl apply -f ${CNIPATH}/calico/calico.yaml
+    kubectl -n kube-system rollout status ds/calico-node --timeout=300s
+elif [ "$CNI" == "flannel" ]; then
+    sed -i -e "s?10.244.0.0/16?$POD_CIDR?g" ${CNIPATH}/flannel/flannel.yaml
+    kubectl apply -f ${CNIPATH}/flannel/flannel.yaml
+    kubectl -n kube-flannel rollout status ds/kube-flannel-ds --timeout=300s
+else
+    echo "CNI $CNI is not supported by images of 1.30"
+    exit 1
+fi
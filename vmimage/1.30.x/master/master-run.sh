@@ -0,0 +1,58 @@
+#!/bin/bash
+# builds a master image of kubernetes 1.30 running containerd, on ubuntu 22.04
+set -e
+KUBE_VERSION=1.30.5
+CALICO_VERSION=v3.28.2
+FLANNEL_VERSION=v0.25.7
+
+swapoff -a
+sed -i '/ swap / s/^/#/' /etc/fstab
+
+cat <<EOF >/etc/modules-load.d/k8s.conf
+overlay
+br_netfilter
+EOF
+modprobe overlay
+modprobe br_netfilter
+cat <<EOF >/etc/sysctl.d/k8s.conf
+net.bridge.bridge-nf-call-iptables  = 1
+net.bridge.bridge-nf-call-ip6tables = 1
+net.ipv4.ip_forward                 = 1
+EOF
+sysctl --system
+
+apt-get update && apt-get install -y apt-transport-https ca-certificates curl gpg jq containerd
+
+# kubelet of kubeadm uses the systemd cgroup driver since 1.22
+mkdir -p /etc/containerd
+containerd config default > /etc/containerd/config.toml
+sed -i 's/SystemdCgroup = false/SystemdCgroup = true/' /etc/containerd/config.toml
+systemctl enable containerd
+systemctl restart containerd
+cat <<EOF >/etc/crictl.yaml
+runtime-endpoint: unix:///run/containerd/containerd.sock
+image-endpoint: unix:///run/containerd/containerd.sock
+EOF
+
+# apt.kubernetes.io is frozen, packages of new versions are only in pkgs.k8s.io
+mkdir -p /etc/apt/keyrings
+curl -fsSL https://pkgs.k8s.io/core:/stable:/v1.30/deb/Release.key | gpg --dearmor -o /etc/apt/keyrings/kubernetes-apt-keyring.gpg
+echo 'deb [signed-by=/etc/apt/keyrings/kubernetes-apt-keyring.gpg] https://pkgs.k8s.io/core:/stable:/v1.30/deb/ /' > /etc/apt/sources.list.d/kubernetes.list
+apt-get update
+apt-get install -y kubelet=${KUBE_VERSION}-1.1 kubeadm=${KUBE_VERSION}-1.1 kubectl=${KUBE_VERSION}-1.1
+apt-mark hold kubelet kubeadm kubectl
+systemctl enable kubelet
+
+echo "source <(kubectl completion bash)" >> ~/.bashrc
+
+##pull image
+kubeadm config images pull --kubernetes-version v${KUBE_VERSION} --cri-socket unix:///run/containerd/containerd.sock
+
+##pull CNI image
+mkdir -p /root/CNI/flannel
+curl -fsSL https://github.com/flannel-io/flannel/releases/download/${FLANNEL_VERSION}/kube-flannel.yml -o /root/CNI/flannel/flannel.yaml
+for image in $(grep "image:" /root/CNI/flannel/flannel.yaml | awk '{print $2}' | sort -u); do crictl pull $image; done
+
+mkdir -p /root/CNI/calico
+curl -fsSL https://raw.githubusercontent.com/projectcalico/calico/${CALICO_VERSION}/manifests/calico.yaml -o /root/CNI/calico/calico.yaml
+for image in $(grep "image:" /root/CNI/calico/calico.yaml | awk '{print $2}' | sort -u); do crictl pull $image; done
@@ -0,0 +1,34 @@
+# builds a windows node image of kubernetes 1.30 running containerd, on windows server 2022
+# run it as Administrator on a fresh instance, then capture the image and list it as windowsNodeImageID in ~/.qks/images.yaml
+# usage: .\node-run.ps1 -PublicKey "ssh-rsa AAAA... qks"
+param(
+    [Parameter(Mandatory = $true)]
+    [string]$PublicKey
+)
+$ErrorActionPreference = 'Stop'
+$KubeVersion = "1.30.5"
+$ContainerdVersion = "1.7.22"
+# the same ref as bootstrap.SigWindowsToolsRef of qks
+$Tools = "https://raw.githubusercontent.com/kubernetes-sigs/sig-windows-tools/v0.1.5/hostprocess"
+
+# qks connects by ssh as Administrator with its key
+Add-WindowsCapability -Online -Name OpenSSH.Server~~~~0.0.1.0
+Set-Service -Name sshd -StartupType Automatic
+Start-Service sshd
+Set-Content -Path "$env:ProgramData\ssh\administrators_authorized_keys" -Value $PublicKey -Encoding ascii
+icacls.exe "$env:ProgramData\ssh\administrators_authorized_keys" /inheritance:r /grant "Administrators:F" /grant "SYSTEM:F"
+New-NetFirewallRule -Name sshd -DisplayName "OpenSSH Server" -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort 22 -ErrorAction SilentlyContinue
+
+# flannel on windows uses vxlan port 4789, kubelet listens on 10250
+New-NetFirewallRule -Name kubelet -DisplayName "kubelet" -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort 10250 -ErrorAction SilentlyContinue
+New-NetFirewallRule -Name flannel-vxlan -DisplayName "flannel vxlan" -Enabled True -Direction Inbound -Protocol UDP -Action Allow -LocalPort 4789 -ErrorAction SilentlyContinue
+
+Invoke-WebRequest -UseBasicParsing "$Tools/Install-Containerd.ps1" -OutFile "$env:TEMP\Install-Containerd.ps1"
+& "$env:TEMP\Install-Containerd.ps1" -ContainerDVersion $ContainerdVersion
+
+# installs kubelet and kubeadm as services waiting for kubeadm join
+Invoke-WebRequest -UseBasicParsing "$Tools/PrepareNode.ps1" -OutFile "$env:TEMP\PrepareNode.ps1"
+& "$env:TEMP\PrepareNode.ps1" -KubernetesVersion "v$KubeVersion"
+
+# pulled ahead so the first pods do not wait for the large windows layers
+ctr.exe -n k8s.io images pull mcr.microsoft.com/oss/kubernetes/pause:3.9